@@ -0,0 +1,337 @@
+// Command eavenctl runs administration tasks. Most work on the database
+// configured in .env, like the server; streams asks a running API.
+//
+//	eavenctl create-user --email ada@example.com --first Ada --last Lovelace
+//	eavenctl reset-password --email ada@example.com
+//	eavenctl promote-owner --team 12 --email ada@example.com
+//	eavenctl purge-messages --older-than-days 365
+//	eavenctl reindex-search --after-id 0
+//	eavenctl streams --url https://api.example.com
+//
+// Passwords are read from EAVENCTL_PASSWORD, or from standard input.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/queries"
+	"github.com/nikhil/eaven/internal/retention"
+	"github.com/nikhil/eaven/internal/search"
+	services "github.com/nikhil/eaven/internal/service/auth"
+	"github.com/nikhil/eaven/internal/storage"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+func main() {
+	log.SetFlags(0)
+	root := &cobra.Command{
+		Use:   "eavenctl",
+		Short: "Run administration tasks against the database or a running API",
+		// Errors are printed without the usage text, which --help shows
+		SilenceUsage: true,
+	}
+	root.AddCommand(createUserCmd(), resetPasswordCmd(), promoteOwnerCmd(), purgeMessagesCmd(), reindexSearchCmd(), streamsCmd())
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// addWorkspaceFlag adds the --workspace flag of the commands that act on
+// accounts
+func addWorkspaceFlag(cmd *cobra.Command, slug *string) {
+	cmd.Flags().StringVar(slug, "workspace", "", "workspace slug (default: the default workspace)")
+}
+
+// connect opens the database like the server does
+func connect() *sql.DB {
+	database.InitDB()
+	if err := fieldcrypt.Init(); err != nil {
+		log.Fatal("Failed to load field encryption keys: ", err)
+	}
+	return database.DB
+}
+
+// inWorkspace returns a context for the workspace with a slug, or the
+// default workspace when slug is empty
+func inWorkspace(slug string) (context.Context, error) {
+	ctx := context.Background()
+	if slug == "" {
+		return ctx, nil
+	}
+	id, err := workspace.Resolve(ctx, slug)
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s: %w", slug, err)
+	}
+	return workspace.WithID(ctx, id), nil
+}
+
+func authService(db *sql.DB) *services.AuthService {
+	return services.NewAuthService(db, logger.NewLogger("eavenctl"))
+}
+
+// readPassword takes the password from EAVENCTL_PASSWORD, or the first line
+// of standard input, so it stays out of the shell history
+func readPassword() (string, error) {
+	if pw := os.Getenv("EAVENCTL_PASSWORD"); pw != "" {
+		return pw, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	pw := strings.TrimRight(line, "\r\n")
+	if pw == "" {
+		return "", errors.New("no password given")
+	}
+	return pw, nil
+}
+
+func createUserCmd() *cobra.Command {
+	var email, first, last, phone, ws string
+	cmd := &cobra.Command{
+		Use:   "create-user",
+		Short: "Create an account",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return createUser(email, first, last, phone, ws)
+		},
+	}
+	cmd.Flags().StringVar(&email, "email", "", "email address")
+	cmd.Flags().StringVar(&first, "first", "", "first name")
+	cmd.Flags().StringVar(&last, "last", "", "last name")
+	cmd.Flags().StringVar(&phone, "contact", "", "contact number")
+	addWorkspaceFlag(cmd, &ws)
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func createUser(email, first, last, phone, ws string) error {
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	db := connect()
+	ctx, err := inWorkspace(ws)
+	if err != nil {
+		return err
+	}
+	id, err := authService(db).Signup(ctx, &models.User{
+		Email:         email,
+		Password:      password,
+		FirstName:     first,
+		LastName:      last,
+		ContactNumber: phone,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created user %d (%s)\n", id, email)
+	return nil
+}
+
+func resetPasswordCmd() *cobra.Command {
+	var email, ws string
+	cmd := &cobra.Command{
+		Use:   "reset-password",
+		Short: "Set a user's password and sign out their sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return resetPassword(email, ws)
+		},
+	}
+	cmd.Flags().StringVar(&email, "email", "", "email address of the account")
+	addWorkspaceFlag(cmd, &ws)
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func resetPassword(email, ws string) error {
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	db := connect()
+	ctx, err := inWorkspace(ws)
+	if err != nil {
+		return err
+	}
+	id, err := authService(db).ResetPassword(ctx, email, password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no account for %s", email)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Reset the password of user %d and signed out their sessions\n", id)
+	return nil
+}
+
+func promoteOwnerCmd() *cobra.Command {
+	var teamID int64
+	var email, ws string
+	cmd := &cobra.Command{
+		Use:   "promote-owner",
+		Short: "Make a team member an owner of the team",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return promoteOwner(teamID, email, ws)
+		},
+	}
+	cmd.Flags().Int64Var(&teamID, "team", 0, "team ID")
+	cmd.Flags().StringVar(&email, "email", "", "email address of the member")
+	addWorkspaceFlag(cmd, &ws)
+	cmd.MarkFlagRequired("team")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func promoteOwner(teamID int64, email, ws string) error {
+	db := connect()
+	ctx, err := inWorkspace(ws)
+	if err != nil {
+		return err
+	}
+	var userID int64
+	query := "SELECT user_id FROM users WHERE email = ? AND workspace_id = ?"
+	if err := db.QueryRowContext(ctx, query, email, workspace.FromContext(ctx)).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no account for %s", email)
+		}
+		return err
+	}
+	member, err := queries.New(db).SetTeamRole(ctx, teamID, userID, queries.TeamRoleOwner)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return fmt.Errorf("%s is not a member of team %d", email, teamID)
+	}
+	logger.NewLogger("eavenctl").Audit("Team owner promoted", "team_id", teamID, "user_id", userID)
+	fmt.Printf("User %d is now an owner of team %d\n", userID, teamID)
+	return nil
+}
+
+func purgeMessagesCmd() *cobra.Command {
+	var days int
+	cmd := &cobra.Command{
+		Use:   "purge-messages",
+		Short: "Delete messages older than a number of days",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return purgeMessages(days)
+		},
+	}
+	cmd.Flags().IntVar(&days, "older-than-days", 0, "delete messages older than this many days")
+	cmd.MarkFlagRequired("older-than-days")
+	return cmd
+}
+
+func purgeMessages(days int) error {
+	if days <= 0 {
+		return errors.New("--older-than-days must be at least 1")
+	}
+
+	// The retention janitor rolls messages up into channel stats before
+	// deleting them, so analytics keep their history
+	j := &retention.Janitor{DB: connect(), Log: logger.NewLogger("eavenctl"), Storage: storage.Default(), RetentionDays: days}
+	purged, err := j.Purge(context.Background(), time.Now().UTC())
+	fmt.Printf("Purged %d messages\n", purged)
+	return err
+}
+
+func reindexSearchCmd() *cobra.Command {
+	var afterID int64
+	cmd := &cobra.Command{
+		Use:   "reindex-search",
+		Short: "Copy existing messages into the search backend",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return reindexSearch(afterID)
+		},
+	}
+	cmd.Flags().Int64Var(&afterID, "after-id", 0, "copy only messages with a greater ID, to resume an interrupted run")
+	return cmd
+}
+
+func reindexSearch(afterID int64) error {
+	// connect loads .env, which may configure the backend
+	db := connect()
+	backend := search.Default()
+	if backend == nil {
+		return errors.New("ELASTICSEARCH_URL is not set")
+	}
+	copied, last, err := backend.Reindex(context.Background(), db, afterID)
+	fmt.Printf("Copied %d messages, up to message %d\n", copied, last)
+	return err
+}
+
+func streamsCmd() *cobra.Command {
+	var url, token string
+	cmd := &cobra.Command{
+		Use:   "streams",
+		Short: "Show the event streams connected to an API process",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return streams(url, token)
+		},
+	}
+	cmd.Flags().StringVar(&url, "url", "http://localhost:8080", "base URL of the API process")
+	cmd.Flags().StringVar(&token, "token", os.Getenv("EAVENCTL_TOKEN"), "administrator token (env EAVENCTL_TOKEN)")
+	return cmd
+}
+
+func streams(url, token string) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(url, "/")+"/admin/diagnostics/streams", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var stats struct {
+		Enabled bool  `json:"enabled"`
+		Streams int   `json:"streams"`
+		Cursor  int64 `json:"cursor"`
+		Settled int64 `json:"settled"`
+	}
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return err
+	}
+	if !stats.Enabled {
+		fmt.Println("Event streams are disabled on this process")
+		return nil
+	}
+	fmt.Printf("Streams:  %d\nCursor:   %d\nSettled:  %d\n", stats.Streams, stats.Cursor, stats.Settled)
+	return nil
+}
@@ -0,0 +1,108 @@
+//go:build integration
+
+// The integration tests start MySQL in a container, so they need Docker and
+// only build with the integration tag:
+//
+//	go test -tags integration ./cmd/
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mysql"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/mailer"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/queries"
+	"github.com/nikhil/eaven/internal/routes"
+	"github.com/nikhil/eaven/internal/scan"
+	"github.com/nikhil/eaven/internal/smoke"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// TestCoreFlows runs the smoke steps against the full router on a freshly
+// migrated database
+func TestCoreFlows(t *testing.T) {
+	db := startDatabase(t)
+	database.DB = db
+	t.Setenv("JWT_SECRET", "integration-test-secret")
+	t.Setenv("MAIL_DRIVER", "log")
+
+	// Preparing every query checks the migrated schema against the code
+	q, err := queries.Prepare(context.Background(), db)
+	if err != nil {
+		t.Fatalf("prepare queries: %v", err)
+	}
+	if err := mailer.Start(); err != nil {
+		t.Fatalf("start mailer: %v", err)
+	}
+
+	store := &storage.LocalStorage{Dir: t.TempDir()}
+	router := routes.RegisterAllRoutes(buildServices(db, func() *sql.DB { return db }, q, store, scan.Default()))
+	server := httptest.NewServer(middleware.AccessLog(middleware.Localize(router)))
+	defer server.Close()
+
+	c := smoke.NewClient(server.URL, server.Client())
+	for _, step := range smoke.Steps {
+		ok := t.Run(step.Name, func(t *testing.T) {
+			if err := step.Run(c); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !ok {
+			// Later steps build on this one
+			break
+		}
+	}
+}
+
+// startDatabase starts MySQL in a container and applies the base schema and
+// then every migration in order. The test is skipped without Docker.
+func startDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	container, err := mysql.Run(ctx, "mysql:8.0",
+		mysql.WithDatabase("eaven"),
+		mysql.WithUsername("eaven"),
+		mysql.WithPassword("eaven"),
+	)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("start mysql: %v", err)
+	}
+	dsn, err := container.ConnectionString(ctx, "parseTime=true", "multiStatements=true")
+	if err != nil {
+		t.Fatalf("mysql connection string: %v", err)
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("open mysql: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob(filepath.Join("..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Glob sorts the names, and migrations are numbered with leading zeros
+	for _, path := range append([]string{filepath.Join("testdata", "base_schema.sql")}, migrations...) {
+		script, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, string(script)); err != nil {
+			t.Fatalf("apply %s: %v", filepath.Base(path), err)
+		}
+	}
+	return db
+}
@@ -1,18 +1,222 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/nikhil/eaven/internal/archival"
+	"github.com/nikhil/eaven/internal/bots"
 	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/digest"
+	"github.com/nikhil/eaven/internal/export"
+	"github.com/nikhil/eaven/internal/featureflags"
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+	"github.com/nikhil/eaven/internal/floodcontrol"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/httpserver"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/mailer"
+	"github.com/nikhil/eaven/internal/media"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/queries"
+	"github.com/nikhil/eaven/internal/reload"
+	"github.com/nikhil/eaven/internal/retention"
 	"github.com/nikhil/eaven/internal/routes"
+	"github.com/nikhil/eaven/internal/scan"
+	"github.com/nikhil/eaven/internal/search"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+	"github.com/nikhil/eaven/internal/sse"
+	"github.com/nikhil/eaven/internal/storage"
+	"github.com/nikhil/eaven/internal/unfurl"
+	"github.com/nikhil/eaven/pkg/utils"
+)
+
+// Run profiles let the same binary be deployed as separately scaled roles
+const (
+	profileAll    = "all"
+	profileAPI    = "api"
+	profileWorker = "worker"
 )
 
 func main() {
+	defaultProfile := os.Getenv("RUN_PROFILE")
+	if defaultProfile == "" {
+		defaultProfile = profileAll
+	}
+	profile := flag.String("profile", defaultProfile, "run profile: all, api or worker (env RUN_PROFILE)")
+	flag.Parse()
+
+	switch *profile {
+	case profileAll, profileAPI, profileWorker:
+	default:
+		log.Fatalf("Unknown run profile %q (want all, api or worker)", *profile)
+	}
+
 	database.InitDB()
-	router := routes.RegisterAllRoutes()
+	// The reloadable settings are applied once .env is loaded, then again on
+	// every SIGHUP
+	registerReloads()
+	results, err := reload.All()
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+	for _, r := range results {
+		if r.Error != "" {
+			log.Fatal("Invalid configuration: ", r.Error)
+		}
+	}
+	reload.Watch()
+	if err := fieldcrypt.Init(); err != nil {
+		log.Fatal("Failed to load field encryption keys: ", err)
+	}
+	if err := utils.PasswordHashConfig().Validate(); err != nil {
+		log.Fatal("Invalid password hash configuration: ", err)
+	}
+	// Preparing every query up front turns schema mismatches into a startup
+	// failure
+	if err := queries.Init(context.Background()); err != nil {
+		log.Fatal("Failed to prepare queries: ", err)
+	}
+	if err := mailer.Start(); err != nil {
+		log.Fatal("Failed to start mailer: ", err)
+	}
+
+	if *profile == profileAll || *profile == profileWorker {
+		startWorkers()
+	}
+	if *profile == profileWorker {
+		fmt.Println("Workers are running...")
+		waitForShutdown()
+		return
+	}
+	serveAPI()
+}
+
+// startWorkers launches the scheduled background jobs. Each job claims its
+// work in the database before acting on it, with a conditional update or a
+// locking read, so any number of processes can run them.
+func startWorkers() {
+	digest.Start()
+	digest.StartOffline()
+	bots.Start()
+	archival.Start()
+	retention.Start()
+	retention.StartDisappearing()
+	history.Start()
+	scan.Start()
+	media.Start()
+	export.Start()
+}
+
+// serveAPI runs the HTTP API. Link unfurling is fed from message writes in
+// this process, and the outbox publishes to destinations living here, such
+// as the event streams of connected clients, so their workers run alongside
+// the API.
+func serveAPI() {
+	unfurl.Start()
+	outbox.Start()
+	sse.Start()
+	search.StartIndexer()
+	messageService.StartShadow()
+	bots.RegisterCommands()
+	for _, rl := range rateLimits {
+		routes.RegisterRateLimiter(rl.class, rl.limiter.Wrap)
+	}
+	router := routes.RegisterAllRoutes(buildServices(database.DB, database.Reader, queries.Default(), storage.Default(), scan.Default()))
+
+	cfg := httpserver.LoadConfig()
+	scheme := "http"
+	if cfg.TLS() {
+		scheme = "https"
+	}
+	fmt.Printf("Server is running on %s (%s)...\n", cfg.Addr, scheme)
+
+	// On SIGINT or SIGTERM event streams are told to reconnect, which
+	// reaches another process, and requests in flight finish before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		if b := sse.Default(); b != nil {
+			b.Drain(10 * time.Second)
+		}
+	}()
+	if err := httpserver.ListenAndServe(ctx, cfg, middleware.AccessLog(middleware.CORS(middleware.Localize(router)))); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Server stopped")
+}
+
+// rateLimit is the budget of a rate limit class. Classes of signed-in routes
+// count requests per user, auth and public ones per address.
+type rateLimit struct {
+	class    routes.RateLimitClass
+	fallback int
+	limiter  *middleware.RateLimiter
+}
+
+// rateLimits are the enforced classes. Their limits are read from the
+// environment at startup and on every reload.
+var rateLimits = []rateLimit{
+	{class: routes.RateLimitDefault, fallback: 600, limiter: middleware.RateLimitByUser(600, time.Minute)},
+	{class: routes.RateLimitWrite, fallback: 120, limiter: middleware.RateLimitByUser(120, time.Minute)},
+	{class: routes.RateLimitAdmin, fallback: 120, limiter: middleware.RateLimitByUser(120, time.Minute)},
+	{class: routes.RateLimitAuth, fallback: 30, limiter: middleware.RateLimitByIP(30, time.Minute)},
+	{class: routes.RateLimitPublic, fallback: 60, limiter: middleware.RateLimitByIP(60, time.Minute)},
+}
+
+// perMinute is how many requests a minute one client may make in the class,
+// from <CLASS>_RATE_LIMIT_PER_MINUTE: DEFAULT (default 600), WRITE (120),
+// ADMIN (120), AUTH (30) and PUBLIC (60)
+func (rl rateLimit) perMinute() int {
+	if v, err := strconv.Atoi(os.Getenv(strings.ToUpper(string(rl.class)) + "_RATE_LIMIT_PER_MINUTE")); err == nil && v > 0 {
+		return v
+	}
+	return rl.fallback
+}
+
+// registerReloads lists the settings that SIGHUP and the admin API reload
+// without a restart
+func registerReloads() {
+	reload.Register("log_level", func() (interface{}, error) {
+		return logger.ReloadLevel()
+	})
+	reload.Register("rate_limits_per_minute", func() (interface{}, error) {
+		limits := make(map[routes.RateLimitClass]int, len(rateLimits))
+		for _, rl := range rateLimits {
+			limits[rl.class] = rl.perMinute()
+			rl.limiter.SetLimit(limits[rl.class])
+		}
+		return limits, nil
+	})
+	reload.Register("flood_control", func() (interface{}, error) {
+		cfg := floodcontrol.Reload()
+		return map[string]interface{}{"max_messages": cfg.MaxMessages, "window_seconds": cfg.Window.Seconds()}, nil
+	})
+	reload.Register("cors_allowed_origins", func() (interface{}, error) {
+		return middleware.ReloadCORSOrigins(), nil
+	})
+	reload.Register("feature_flags", func() (interface{}, error) {
+		featureflags.Reload()
+		defaults := make(map[string]bool, len(featureflags.Known))
+		for _, f := range featureflags.Known {
+			defaults[f.Name] = featureflags.Default(f.Name)
+		}
+		return defaults, nil
+	})
+}
 
-	fmt.Println("Server is running on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", router))
+func waitForShutdown() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
 }
@@ -0,0 +1,40 @@
+// Command openapi writes the OpenAPI document of the route table, so the
+// committed api/openapi.json used for SDK generation stays in sync. With
+// -check it fails instead when the committed file is stale.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/nikhil/eaven/internal/routes"
+)
+
+func main() {
+	out := flag.String("out", "api/openapi.json", "file to write the document to")
+	check := flag.Bool("check", false, "fail if the file is not up to date instead of writing it")
+	flag.Parse()
+
+	spec, err := json.MarshalIndent(routes.Spec(), "", "  ")
+	if err != nil {
+		log.Fatal("Failed to encode OpenAPI document: ", err)
+	}
+	spec = append(spec, '\n')
+
+	if *check {
+		current, err := os.ReadFile(*out)
+		if err != nil {
+			log.Fatal("Failed to read OpenAPI document: ", err)
+		}
+		if !bytes.Equal(current, spec) {
+			log.Fatalf("%s is out of date; run go generate ./internal/routes", *out)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, spec, 0o644); err != nil {
+		log.Fatal("Failed to write OpenAPI document: ", err)
+	}
+}
@@ -0,0 +1,32 @@
+// Command reencrypt rewrites encrypted columns with the active field
+// encryption key. Run it after putting a new key first in
+// FIELD_ENCRYPTION_KEYS, or after enabling encryption on existing data;
+// the old key can be removed once it finishes.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+)
+
+func main() {
+	database.InitDB()
+	if err := fieldcrypt.Init(); err != nil {
+		log.Fatal("Failed to load field encryption keys: ", err)
+	}
+	keys := fieldcrypt.Default()
+	if keys == nil {
+		log.Fatal("No field encryption keys are configured")
+	}
+
+	for _, col := range fieldcrypt.Columns {
+		n, err := fieldcrypt.Rotate(context.Background(), database.DB, keys, col)
+		if err != nil {
+			log.Fatalf("Failed to re-encrypt %s.%s after %d rows: %v", col.Table, col.Name, n, err)
+		}
+		log.Printf("Re-encrypted %d values of %s.%s with key %s", n, col.Table, col.Name, keys.Active)
+	}
+}
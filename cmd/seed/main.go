@@ -0,0 +1,275 @@
+// Command seed fills a development database with sample users, teams,
+// channels and message history. Without -config it loads the built-in
+// seed.yaml; a custom file has the same shape. Users that already exist are
+// reused, so it can be rerun, but every run adds new teams.
+//
+//	go run ./cmd/seed -config my-seed.yaml
+package main
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/queries"
+	services "github.com/nikhil/eaven/internal/service/auth"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+	"github.com/nikhil/eaven/internal/utils"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+//go:embed seed.yaml
+var defaultConfig []byte
+
+// Channel roles stored in channel members
+const (
+	channelRoleAdmin  = 1
+	channelRoleMember = 2
+)
+
+// Config describes the data to create
+type Config struct {
+	Password    string     `yaml:"password"`
+	HistoryDays int        `yaml:"history_days"`
+	Users       []UserSeed `yaml:"users"`
+	Teams       []TeamSeed `yaml:"teams"`
+}
+
+// UserSeed is a user to sign up
+type UserSeed struct {
+	Email         string `yaml:"email"`
+	FirstName     string `yaml:"first_name"`
+	LastName      string `yaml:"last_name"`
+	ContactNumber string `yaml:"contact_number"`
+}
+
+// TeamSeed is a team owned by Owner. Members are added besides the owner.
+type TeamSeed struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description"`
+	Owner       string        `yaml:"owner"`
+	Members     []string      `yaml:"members"`
+	Channels    []ChannelSeed `yaml:"channels"`
+}
+
+// ChannelSeed is a channel of a team. Without Members every team member
+// joins it. Messages is how many sample messages its members post.
+type ChannelSeed struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Private     bool     `yaml:"private"`
+	Members     []string `yaml:"members"`
+	Messages    int      `yaml:"messages"`
+}
+
+// sampleLines are cycled through to make up message history
+var sampleLines = []string{
+	"Good morning everyone!",
+	"Has anyone looked at the **release notes** yet?",
+	"I pushed a fix for the flaky build, see https://example.com/builds/142",
+	"Let's sync after lunch.",
+	"Thanks, that worked :tada:",
+	"Reminder: the demo is on Thursday.",
+	"Can someone review my change? It's small, I promise.",
+	"`go test ./...` is green again.",
+	"@channel the office will be closed on Monday.",
+	"Sounds good to me.",
+	"Here's the doc we talked about: https://example.com/docs/roadmap",
+	"I'll take a look this afternoon.",
+}
+
+func main() {
+	path := flag.String("config", "", "YAML file describing the data (default: built-in sample data)")
+	flag.Parse()
+
+	if env := os.Getenv("APP_ENV"); env != "" && env != "development" {
+		log.Fatalf("Refusing to seed with APP_ENV=%s; seed data is for development databases", env)
+	}
+
+	raw := defaultConfig
+	if *path != "" {
+		var err error
+		if raw, err = os.ReadFile(*path); err != nil {
+			log.Fatal("Failed to read seed config: ", err)
+		}
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		log.Fatal("Invalid seed config: ", err)
+	}
+	if cfg.HistoryDays <= 0 {
+		cfg.HistoryDays = 7
+	}
+
+	database.InitDB()
+	if err := fieldcrypt.Init(); err != nil {
+		log.Fatal("Failed to load field encryption keys: ", err)
+	}
+
+	s := &seeder{
+		db:       database.DB,
+		q:        queries.New(database.DB),
+		auth:     services.NewAuthService(database.DB, logger.NewLogger("seed")),
+		messages: messageService.NewMessageService(database.DB, queries.New(database.DB), logger.NewLogger("seed")),
+		users:    make(map[string]int64),
+	}
+	if err := s.run(context.Background(), cfg); err != nil {
+		log.Fatal("Seeding failed: ", err)
+	}
+}
+
+type seeder struct {
+	db       *sql.DB
+	q        *queries.Queries
+	auth     *services.AuthService
+	messages *messageService.MessageService
+	// users maps seeded emails to user IDs
+	users map[string]int64
+}
+
+func (s *seeder) run(ctx context.Context, cfg Config) error {
+	for _, u := range cfg.Users {
+		id, err := s.user(ctx, u, cfg.Password)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", u.Email, err)
+		}
+		s.users[u.Email] = id
+	}
+	fmt.Printf("%d users, password %q\n", len(cfg.Users), cfg.Password)
+
+	for _, t := range cfg.Teams {
+		if err := s.team(ctx, t, cfg.HistoryDays); err != nil {
+			return fmt.Errorf("team %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// user signs up a user, or returns the ID of the existing account
+func (s *seeder) user(ctx context.Context, u UserSeed, password string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM users WHERE email = ? AND workspace_id = ?", u.Email, workspace.FromContext(ctx)).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	return s.auth.Signup(ctx, &models.User{
+		Email:         u.Email,
+		Password:      password,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		ContactNumber: u.ContactNumber,
+	})
+}
+
+func (s *seeder) id(email string) (int64, error) {
+	id, ok := s.users[email]
+	if !ok {
+		return 0, fmt.Errorf("%s is not one of the seeded users", email)
+	}
+	return id, nil
+}
+
+func (s *seeder) team(ctx context.Context, t TeamSeed, historyDays int) error {
+	ownerID, err := s.id(t.Owner)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Unix()
+	teamID, err := s.q.CreateTeam(ctx, models.Team{Name: t.Name, Description: t.Description, CreatedBy: ownerID, CreatedAt: now, UpdatedAt: now})
+	if err != nil {
+		return err
+	}
+	if err := s.q.AddTeamMember(ctx, teamID, ownerID, queries.TeamRoleOwner, now, ownerID); err != nil {
+		return err
+	}
+	members := []string{t.Owner}
+	for _, email := range t.Members {
+		userID, err := s.id(email)
+		if err != nil {
+			return err
+		}
+		if err := s.q.AddTeamMember(ctx, teamID, userID, queries.TeamRoleMember, now, ownerID); err != nil {
+			return err
+		}
+		members = append(members, email)
+	}
+
+	for _, c := range t.Channels {
+		if err := s.channel(ctx, teamID, ownerID, members, c, historyDays); err != nil {
+			return fmt.Errorf("channel %s: %w", c.Name, err)
+		}
+	}
+	fmt.Printf("team %q (id %d): %d members, %d channels\n", t.Name, teamID, len(members), len(t.Channels))
+	return nil
+}
+
+func (s *seeder) channel(ctx context.Context, teamID, ownerID int64, teamMembers []string, c ChannelSeed, historyDays int) error {
+	now := time.Now().UTC().Unix()
+	channelID, err := s.q.CreateChannel(ctx, models.Channel{
+		TeamID:      teamID,
+		Name:        c.Name,
+		Slug:        utils.Slugify(c.Name),
+		Description: c.Description,
+		IsPrivate:   c.Private,
+		CreatedBy:   ownerID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+	if err != nil {
+		return err
+	}
+
+	members := c.Members
+	if len(members) == 0 {
+		members = teamMembers
+	}
+	var memberIDs []int64
+	for _, email := range members {
+		userID, err := s.id(email)
+		if err != nil {
+			return err
+		}
+		role := channelRoleMember
+		if userID == ownerID {
+			role = channelRoleAdmin
+		}
+		if err := s.q.AddChannelMember(ctx, channelID, userID, role, now, ownerID); err != nil {
+			return err
+		}
+		memberIDs = append(memberIDs, userID)
+	}
+
+	if c.Messages <= 0 || len(memberIDs) == 0 {
+		return nil
+	}
+	// Spread the history evenly so it reads oldest to newest
+	start := now - int64(historyDays)*24*60*60
+	step := (now - start) / int64(c.Messages)
+	for i := 0; i < c.Messages; i++ {
+		_, err := s.messages.SaveMessage(ctx, models.MessageBody{
+			ChannelID:   channelID,
+			UserID:      memberIDs[i%len(memberIDs)],
+			Content:     sampleLines[i%len(sampleLines)],
+			MessageTime: start + int64(i)*step,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/queries"
+	"github.com/nikhil/eaven/internal/routes"
+	"github.com/nikhil/eaven/internal/scan"
+	adminService "github.com/nikhil/eaven/internal/service/admin"
+	attachmentService "github.com/nikhil/eaven/internal/service/attachments"
+	services "github.com/nikhil/eaven/internal/service/auth"
+	channelService "github.com/nikhil/eaven/internal/service/channels"
+	graphService "github.com/nikhil/eaven/internal/service/graph"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+	teamService "github.com/nikhil/eaven/internal/service/team"
+	profileService "github.com/nikhil/eaven/internal/service/users"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// buildServices wires the API's services to their dependencies. This is
+// the one place that decides which database, read pool, prepared queries,
+// storage, virus scanner and loggers each service uses, so tests and tools
+// can build a service against their own instead. reader returns the pool
+// for reads that tolerate replica lag.
+func buildServices(db *sql.DB, reader func() *sql.DB, q *queries.Queries, store storage.Storage, scanner scan.Scanner) routes.Services {
+	messages := messageService.NewMessageService(db, q, logger.NewLogger("message-service"))
+	messages.Reader = reader
+	team := teamService.NewTeamService(db, q, logger.NewLogger("team-service"))
+	team.Reader = reader
+	admin := adminService.NewAdminService(db, logger.NewLogger("admin-service"))
+	admin.Reader = reader
+	return routes.Services{
+		Auth:       services.NewAuthService(db, logger.NewLogger("auth-service")),
+		Profile:    profileService.NewProfileService(db, logger.NewLogger("profile-service")),
+		Team:       team,
+		Channel:    channelService.NewChannelService(db, q, logger.NewLogger("channel-service"), messages),
+		Message:    messages,
+		Admin:      admin,
+		Attachment: attachmentService.NewAttachmentService(db, store, scanner, logger.NewLogger("attachment-service")),
+		Graph:      graphService.NewGraphService(db, q, logger.NewLogger("graph-service")),
+	}
+}
@@ -0,0 +1,35 @@
+// Command smoke runs the core user flows end to end against a running API:
+// signup and login, profile, team, channel and message. Point it at a server
+// whose database has every migration applied; it creates a fresh user and
+// team on each run.
+//
+//	go run ./cmd/smoke -url http://localhost:8080
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nikhil/eaven/internal/smoke"
+)
+
+func main() {
+	defaultURL := os.Getenv("SMOKE_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:8080"
+	}
+	baseURL := flag.String("url", defaultURL, "base URL of the API (env SMOKE_URL)")
+	flag.Parse()
+
+	c := smoke.NewClient(*baseURL, &http.Client{Timeout: 30 * time.Second})
+	for _, step := range smoke.Steps {
+		if err := step.Run(c); err != nil {
+			log.Fatalf("FAIL %s: %v", step.Name, err)
+		}
+		fmt.Println("ok  ", step.Name)
+	}
+}
@@ -0,0 +1,65 @@
+-- The tables that predate migrations/, as they were before 0001. The
+-- integration tests apply this to an empty database and then every
+-- migration in order, which gives the schema a deployment runs on.
+CREATE TABLE users (
+    user_id        BIGINT       NOT NULL AUTO_INCREMENT,
+    email          VARCHAR(255) NOT NULL,
+    password       VARCHAR(255) NOT NULL,
+    contact_number VARCHAR(32)  NOT NULL DEFAULT '',
+    first_name     VARCHAR(100) NOT NULL,
+    last_name      VARCHAR(100) NOT NULL DEFAULT '',
+    created_at     BIGINT       NOT NULL,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE teams (
+    team_id    BIGINT       NOT NULL AUTO_INCREMENT,
+    team_name  VARCHAR(100) NOT NULL,
+    created_by BIGINT       NOT NULL,
+    created_at BIGINT       NOT NULL,
+    PRIMARY KEY (team_id)
+);
+
+CREATE TABLE user_teams_mapper (
+    team_id    BIGINT  NOT NULL,
+    user_id    BIGINT  NOT NULL,
+    role       TINYINT NOT NULL,
+    joined_at  BIGINT  NOT NULL,
+    invited_by BIGINT  NOT NULL DEFAULT 0,
+    PRIMARY KEY (team_id, user_id),
+    INDEX idx_user_teams_mapper_user (user_id)
+);
+
+CREATE TABLE channels (
+    channel_id   BIGINT       NOT NULL AUTO_INCREMENT,
+    team_id      BIGINT       NOT NULL,
+    channel_name VARCHAR(100) NOT NULL,
+    description  VARCHAR(500) NOT NULL DEFAULT '',
+    is_private   TINYINT(1)   NOT NULL DEFAULT 0,
+    created_by   BIGINT       NOT NULL,
+    created_at   BIGINT       NOT NULL,
+    updated_at   BIGINT       NOT NULL,
+    PRIMARY KEY (channel_id),
+    INDEX idx_channels_team (team_id)
+);
+
+CREATE TABLE channel_members (
+    channel_id BIGINT  NOT NULL,
+    user_id    BIGINT  NOT NULL,
+    role       TINYINT NOT NULL,
+    joined_at  BIGINT  NOT NULL,
+    invited_by BIGINT  NOT NULL DEFAULT 0,
+    PRIMARY KEY (channel_id, user_id),
+    INDEX idx_channel_members_user (user_id)
+);
+
+CREATE TABLE messages (
+    message_id         BIGINT NOT NULL,
+    channel_id         BIGINT NOT NULL,
+    user_id            BIGINT NOT NULL,
+    content            TEXT   NOT NULL,
+    message_created_at BIGINT NOT NULL,
+    PRIMARY KEY (message_id),
+    INDEX idx_messages_channel_created (channel_id, message_created_at),
+    INDEX idx_messages_user (user_id)
+);
@@ -0,0 +1,128 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+var (
+	// ErrSelfImpersonation is returned when an administrator targets themselves
+	ErrSelfImpersonation = errors.New("administrators cannot impersonate themselves")
+	// ErrProtectedAccount is returned when the target is an administrator, a
+	// bot or a merged account
+	ErrProtectedAccount = errors.New("this account cannot be impersonated")
+	// ErrSessionNotFound is returned when an impersonation session does not exist
+	ErrSessionNotFound = errors.New("impersonation session not found")
+)
+
+// ImpersonationSession is one audited impersonation of a user by an
+// administrator
+type ImpersonationSession struct {
+	SessionID    int64  `json:"session_id"`
+	AdminID      int64  `json:"admin_id"`
+	UserID       int64  `json:"user_id"`
+	Reason       string `json:"reason"`
+	CreatedAt    int64  `json:"created_at"`
+	ExpiresAt    int64  `json:"expires_at"`
+	EndedAt      int64  `json:"ended_at"`
+	RequestCount int    `json:"request_count"`
+	LastUsedAt   int64  `json:"last_used_at"`
+
+	UserEmail     string `json:"-"`
+	UserFirstName string `json:"-"`
+}
+
+// StartImpersonation opens a session letting adminID act as userID for ttl
+func StartImpersonation(ctx context.Context, adminID, userID int64, reason string, ttl time.Duration) (ImpersonationSession, error) {
+	if adminID == userID {
+		return ImpersonationSession{}, ErrSelfImpersonation
+	}
+
+	s := ImpersonationSession{AdminID: adminID, UserID: userID, Reason: reason}
+	var isAdmin, isBot bool
+	var mergedInto int64
+	err := database.DB.QueryRowContext(ctx, `SELECT email, first_name, is_admin, is_bot, merged_into FROM users WHERE user_id = ?`, userID).
+		Scan(&s.UserEmail, &s.UserFirstName, &isAdmin, &isBot, &mergedInto)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ImpersonationSession{}, ErrUserNotFound
+	}
+	if err != nil {
+		return ImpersonationSession{}, err
+	}
+	if isAdmin || isBot || mergedInto != 0 {
+		return ImpersonationSession{}, ErrProtectedAccount
+	}
+
+	now := time.Now().UTC()
+	s.CreatedAt = now.Unix()
+	s.ExpiresAt = now.Add(ttl).Unix()
+	result, err := database.DB.ExecContext(ctx, `
+		INSERT INTO impersonation_sessions (admin_id, user_id, reason, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, adminID, userID, reason, s.CreatedAt, s.ExpiresAt)
+	if err != nil {
+		return ImpersonationSession{}, err
+	}
+	s.SessionID, err = result.LastInsertId()
+	return s, err
+}
+
+// UseImpersonation records a request made in a session, reporting false when
+// the session has expired or was ended
+func UseImpersonation(ctx context.Context, sessionID int64) (bool, error) {
+	now := time.Now().UTC().Unix()
+	result, err := database.DB.ExecContext(ctx, `
+		UPDATE impersonation_sessions
+		SET request_count = request_count + 1, last_used_at = ?
+		WHERE session_id = ? AND ended_at = 0 AND expires_at > ?`, now, sessionID, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// EndImpersonation ends a session before it expires
+func EndImpersonation(ctx context.Context, sessionID int64) error {
+	result, err := database.DB.ExecContext(ctx, `UPDATE impersonation_sessions SET ended_at = ? WHERE session_id = ? AND ended_at = 0`, time.Now().UTC().Unix(), sessionID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	var exists bool
+	if err := database.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM impersonation_sessions WHERE session_id = ?)`, sessionID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// ListImpersonations returns the impersonation sessions, newest first
+func ListImpersonations(ctx context.Context, limit, offset int) ([]ImpersonationSession, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT session_id, admin_id, user_id, reason, created_at, expires_at, ended_at, request_count, last_used_at
+		FROM impersonation_sessions
+		ORDER BY session_id DESC
+		LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []ImpersonationSession{}
+	for rows.Next() {
+		var s ImpersonationSession
+		if err := rows.Scan(&s.SessionID, &s.AdminID, &s.UserID, &s.Reason, &s.CreatedAt, &s.ExpiresAt, &s.EndedAt, &s.RequestCount, &s.LastUsedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,248 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+var (
+	// ErrSameUser is returned when merging an account into itself
+	ErrSameUser = errors.New("source and target must be different users")
+	// ErrUserNotFound is returned when either account does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrAlreadyMerged is returned when either account was merged before
+	ErrAlreadyMerged = errors.New("user has already been merged into another account")
+	// ErrBotAccount is returned when either account is a built-in bot
+	ErrBotAccount = errors.New("bot accounts cannot be merged")
+)
+
+// MergeResult records what a merge moved, keyed by table
+type MergeResult struct {
+	MergeID      int64            `json:"merge_id"`
+	SourceUserID int64            `json:"source_user_id"`
+	TargetUserID int64            `json:"target_user_id"`
+	Moved        map[string]int64 `json:"moved"`
+	CreatedAt    int64            `json:"created_at"`
+
+	SourceEmail     string `json:"-"`
+	TargetEmail     string `json:"-"`
+	TargetFirstName string `json:"-"`
+}
+
+// account is one side of a merge
+type account struct {
+	id        int64
+	email     string
+	firstName string
+	merged    int64
+	isBot     bool
+}
+
+// Merge moves everything owned by source to target in one transaction and
+// disables the source account. Where both accounts have a row for the same
+// thing, such as membership of one channel, the rows are combined keeping the
+// stronger role and the furthest read cursor.
+func Merge(ctx context.Context, sourceID, targetID, performedBy int64) (MergeResult, error) {
+	if sourceID == targetID {
+		return MergeResult{}, ErrSameUser
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	// Lock both users so concurrent merges of either account serialise
+	rows, err := tx.QueryContext(ctx, `SELECT user_id, email, first_name, merged_into, is_bot FROM users WHERE user_id IN (?, ?) FOR UPDATE`, sourceID, targetID)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	users := make(map[int64]account, 2)
+	for rows.Next() {
+		var a account
+		if err := rows.Scan(&a.id, &a.email, &a.firstName, &a.merged, &a.isBot); err != nil {
+			rows.Close()
+			return MergeResult{}, err
+		}
+		users[a.id] = a
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return MergeResult{}, err
+	}
+	source, okSource := users[sourceID]
+	target, okTarget := users[targetID]
+	switch {
+	case !okSource || !okTarget:
+		return MergeResult{}, ErrUserNotFound
+	case source.merged != 0 || target.merged != 0:
+		return MergeResult{}, ErrAlreadyMerged
+	case source.isBot || target.isBot:
+		return MergeResult{}, ErrBotAccount
+	}
+
+	result := MergeResult{
+		SourceUserID:    sourceID,
+		TargetUserID:    targetID,
+		Moved:           make(map[string]int64),
+		CreatedAt:       time.Now().UTC().Unix(),
+		SourceEmail:     source.email,
+		TargetEmail:     target.email,
+		TargetFirstName: target.firstName,
+	}
+
+	for _, step := range mergeSteps {
+		res, err := tx.ExecContext(ctx, step.query, step.args(sourceID, targetID)...)
+		if err != nil {
+			return MergeResult{}, fmt.Errorf("failed to merge %s: %v", step.name, err)
+		}
+		if step.name == "" {
+			continue
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return MergeResult{}, err
+		}
+		result.Moved[step.name] += n
+	}
+
+	// Disable the source account; tokens it already holds resolve to target
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET merged_into = ?, password = '!' WHERE user_id = ?`, targetID, sourceID); err != nil {
+		return MergeResult{}, err
+	}
+
+	summary, err := json.Marshal(result.Moved)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO account_merges (source_user_id, target_user_id, performed_by, summary, created_at) VALUES (?, ?, ?, ?, ?)`,
+		sourceID, targetID, performedBy, summary, result.CreatedAt)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	if result.MergeID, err = res.LastInsertId(); err != nil {
+		return MergeResult{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return MergeResult{}, err
+	}
+	invalidateMerged()
+	return result, nil
+}
+
+type mergeStep struct {
+	// name is the summary key; steps without one only prepare a later step
+	name  string
+	query string
+	args  func(source, target int64) []interface{}
+}
+
+func sourceTarget(source, target int64) []interface{} { return []interface{}{source, target} }
+func targetSource(source, target int64) []interface{} { return []interface{}{target, source} }
+
+// mergeSteps run in order inside the merge transaction. Tables keyed by user
+// are combined with a fold into the target's row, a delete of the source's
+// duplicate and a move of whatever remains.
+var mergeSteps = []mergeStep{
+	{name: "messages", query: `UPDATE messages SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{name: "messages", query: `UPDATE messages_archive SET user_id = ? WHERE user_id = ?`, args: targetSource},
+
+	// Channel memberships: lower role numbers are stronger (1 = admin). A
+	// channel starred or ordered by either account stays so; the target's
+	// notification level is kept.
+	{query: `
+		UPDATE channel_members t
+		INNER JOIN channel_members s ON s.channel_id = t.channel_id AND s.user_id = ?
+		SET t.role = LEAST(t.role, s.role),
+			t.joined_at = LEAST(t.joined_at, s.joined_at),
+			t.last_read_message_id = GREATEST(t.last_read_message_id, s.last_read_message_id),
+			t.starred = GREATEST(t.starred, s.starred),
+			t.sort_order = IF(t.sort_order = 0, s.sort_order, t.sort_order),
+			t.layout_updated_at = GREATEST(t.layout_updated_at, s.layout_updated_at)
+		WHERE t.user_id = ?`, args: sourceTarget},
+	{name: "channel_members", query: `
+		DELETE s FROM channel_members s
+		INNER JOIN channel_members t ON t.channel_id = s.channel_id AND t.user_id = ?
+		WHERE s.user_id = ?`, args: targetSource},
+	{name: "channel_members", query: `UPDATE channel_members SET user_id = ? WHERE user_id = ?`, args: targetSource},
+
+	// Team memberships: role 1 is owner
+	{query: `
+		UPDATE user_teams_mapper t
+		INNER JOIN user_teams_mapper s ON s.team_id = t.team_id AND s.user_id = ?
+		SET t.role = LEAST(t.role, s.role), t.joined_at = LEAST(t.joined_at, s.joined_at)
+		WHERE t.user_id = ?`, args: sourceTarget},
+	{name: "team_memberships", query: `
+		DELETE s FROM user_teams_mapper s
+		INNER JOIN user_teams_mapper t ON t.team_id = s.team_id AND t.user_id = ?
+		WHERE s.user_id = ?`, args: targetSource},
+	{name: "team_memberships", query: `UPDATE user_teams_mapper SET user_id = ? WHERE user_id = ?`, args: targetSource},
+
+	// Preferences and replies: the target's own row wins on conflict
+	{name: "digest_preferences", query: `UPDATE IGNORE digest_preferences SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{query: `DELETE FROM digest_preferences WHERE user_id = ?`, args: func(source, _ int64) []interface{} { return []interface{}{source} }},
+	{name: "standup_replies", query: `UPDATE IGNORE standup_replies SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{query: `DELETE FROM standup_replies WHERE user_id = ?`, args: func(source, _ int64) []interface{} { return []interface{}{source} }},
+	{name: "offline_email_preferences", query: `UPDATE IGNORE offline_email_preferences SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{query: `DELETE FROM offline_email_preferences WHERE user_id = ?`, args: func(source, _ int64) []interface{} { return []interface{}{source} }},
+	{name: "user_preferences", query: `UPDATE IGNORE user_preferences SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{query: `DELETE FROM user_preferences WHERE user_id = ?`, args: func(source, _ int64) []interface{} { return []interface{}{source} }},
+	{name: "channel_post_grants", query: `UPDATE IGNORE channel_post_grants SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{query: `DELETE FROM channel_post_grants WHERE user_id = ?`, args: func(source, _ int64) []interface{} { return []interface{}{source} }},
+
+	// The source's devices keep working as the target, so their public keys
+	// move with them
+	{name: "device_keys", query: `UPDATE IGNORE device_keys SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{query: `DELETE FROM device_keys WHERE user_id = ?`, args: func(source, _ int64) []interface{} { return []interface{}{source} }},
+
+	{name: "attachments", query: `UPDATE attachments SET uploader_id = ? WHERE uploader_id = ?`, args: targetSource},
+	{name: "schedules", query: `UPDATE bot_schedules SET user_id = ? WHERE user_id = ?`, args: targetSource},
+	{name: "teams_created", query: `UPDATE teams SET created_by = ? WHERE created_by = ?`, args: targetSource},
+	{name: "channels_created", query: `UPDATE channels SET created_by = ? WHERE created_by = ?`, args: targetSource},
+	{name: "sections_created", query: `UPDATE channel_sections SET created_by = ? WHERE created_by = ?`, args: targetSource},
+	{name: "post_grants_given", query: `UPDATE channel_post_grants SET granted_by = ? WHERE granted_by = ?`, args: targetSource},
+}
+
+// MergeRecord is a recorded account merge
+type MergeRecord struct {
+	MergeID      int64            `json:"merge_id"`
+	SourceUserID int64            `json:"source_user_id"`
+	TargetUserID int64            `json:"target_user_id"`
+	PerformedBy  int64            `json:"performed_by"`
+	Moved        map[string]int64 `json:"moved"`
+	CreatedAt    int64            `json:"created_at"`
+}
+
+// ListMerges returns recorded merges, newest first
+func ListMerges(ctx context.Context, limit, offset int) ([]MergeRecord, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT merge_id, source_user_id, target_user_id, performed_by, summary, created_at
+		FROM account_merges
+		ORDER BY merge_id DESC
+		LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merges := []MergeRecord{}
+	for rows.Next() {
+		var m MergeRecord
+		var summary []byte
+		if err := rows.Scan(&m.MergeID, &m.SourceUserID, &m.TargetUserID, &m.PerformedBy, &summary, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(summary, &m.Moved); err != nil {
+			return nil, err
+		}
+		merges = append(merges, m)
+	}
+	return merges, rows.Err()
+}
@@ -0,0 +1,26 @@
+package accounts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// seenInterval is how often a user's last_seen_at is written at most
+const seenInterval = time.Minute
+
+var seen sync.Map // user ID -> time.Time of the last write
+
+// Touch records that a user is active. Writes are throttled per process, so
+// last_seen_at may lag by up to seenInterval.
+func Touch(ctx context.Context, userID int64) error {
+	now := time.Now()
+	if last, ok := seen.Load(userID); ok && now.Sub(last.(time.Time)) < seenInterval {
+		return nil
+	}
+	seen.Store(userID, now)
+	_, err := database.DB.ExecContext(ctx, `UPDATE users SET last_seen_at = ? WHERE user_id = ?`, now.UTC().Unix(), userID)
+	return err
+}
@@ -0,0 +1,74 @@
+package accounts
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// mergedTTL bounds how long another process may keep treating a merged
+// account as its own after the merge
+const mergedTTL = 30 * time.Second
+
+// merged caches every merged account and the account it was merged into.
+// Merges are rare, so the whole table fits in memory and a request never
+// waits on a query unless the cache is stale.
+var merged struct {
+	sync.Mutex
+	loadedAt time.Time
+	into     map[int64]int64
+}
+
+// Resolve returns the account a user ID belongs to now, following merges.
+// Users that were never merged resolve to themselves.
+func Resolve(ctx context.Context, userID int64) (int64, error) {
+	merged.Lock()
+	defer merged.Unlock()
+
+	if merged.into == nil || time.Since(merged.loadedAt) > mergedTTL {
+		into, err := loadMerged(ctx)
+		if err != nil {
+			return 0, err
+		}
+		merged.into = into
+		merged.loadedAt = time.Now()
+	}
+
+	// Chains form when a merge target is later merged itself; a merge can
+	// never target a merged account, so they cannot loop
+	for i := 0; i <= len(merged.into); i++ {
+		next, ok := merged.into[userID]
+		if !ok {
+			break
+		}
+		userID = next
+	}
+	return userID, nil
+}
+
+func loadMerged(ctx context.Context) (map[int64]int64, error) {
+	rows, err := database.DB.QueryContext(ctx, `SELECT user_id, merged_into FROM users WHERE merged_into <> 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	into := make(map[int64]int64)
+	for rows.Next() {
+		var source, target int64
+		if err := rows.Scan(&source, &target); err != nil {
+			return nil, err
+		}
+		into[source] = target
+	}
+	return into, rows.Err()
+}
+
+// invalidateMerged makes the next Resolve reload the merged accounts
+func invalidateMerged() {
+	merged.Lock()
+	merged.into = nil
+	merged.Unlock()
+}
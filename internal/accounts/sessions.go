@@ -0,0 +1,83 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// TokenVersionClaim holds the account's token version in login tokens.
+// Bumping the version signs out every token issued before.
+const TokenVersionClaim = "token_version"
+
+// versionsTTL bounds how long another process may keep accepting tokens
+// after they were revoked
+const versionsTTL = 30 * time.Second
+
+// versions caches the token version of every account that ever revoked its
+// tokens. Revocations follow password changes, so the table stays small and
+// requests do not wait on a query unless the cache is stale.
+var versions struct {
+	sync.Mutex
+	loadedAt time.Time
+	current  map[int64]int64
+}
+
+// TokenValid reports whether a token carrying version for userID was issued
+// after the account last revoked its tokens. Tokens from before versions
+// existed carry 0, which is valid until the first revocation.
+func TokenValid(ctx context.Context, userID, version int64) (bool, error) {
+	versions.Lock()
+	defer versions.Unlock()
+
+	if versions.current == nil || time.Since(versions.loadedAt) > versionsTTL {
+		current, err := loadVersions(ctx)
+		if err != nil {
+			return false, err
+		}
+		versions.current = current
+		versions.loadedAt = time.Now()
+	}
+	return version >= versions.current[userID], nil
+}
+
+// RevokeTokens bumps the token version of an account in the caller's
+// transaction and returns the new version for the token that replaces the
+// caller's own
+func RevokeTokens(ctx context.Context, tx *sql.Tx, userID int64) (int64, error) {
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET token_version = token_version + 1 WHERE user_id = ?`, userID); err != nil {
+		return 0, err
+	}
+	var version int64
+	err := tx.QueryRowContext(ctx, `SELECT token_version FROM users WHERE user_id = ?`, userID).Scan(&version)
+	return version, err
+}
+
+// InvalidateTokenVersions makes the next TokenValid reload the versions. Call
+// it after committing RevokeTokens.
+func InvalidateTokenVersions() {
+	versions.Lock()
+	versions.current = nil
+	versions.Unlock()
+}
+
+func loadVersions(ctx context.Context) (map[int64]int64, error) {
+	rows, err := database.DB.QueryContext(ctx, `SELECT user_id, token_version FROM users WHERE token_version <> 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	current := make(map[int64]int64)
+	for rows.Next() {
+		var userID, version int64
+		if err := rows.Scan(&userID, &version); err != nil {
+			return nil, err
+		}
+		current[userID] = version
+	}
+	return current, rows.Err()
+}
@@ -0,0 +1,200 @@
+package archival
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/actiontoken"
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/mailer"
+)
+
+// ActionArchiveChannel is the action token scope of archive links
+const ActionArchiveChannel = "archive_channel"
+
+// tokenTTL bounds how long an archive link in an email stays usable
+const tokenTTL = 7 * 24 * time.Hour
+
+// Analyzer finds inactive channels and suggests archiving them
+type Analyzer struct {
+	DB           *sql.DB
+	Log          *logger.Logger
+	InactiveDays int
+}
+
+// Start launches the archival analyzer. ARCHIVE_SUGGESTION_DAYS sets how long
+// a channel must be idle before it is suggested (default 90; 0 disables) and
+// ARCHIVE_SUGGESTION_INTERVAL_HOURS how often channels are checked (default
+// 24). A channel is suggested at most once per idle period.
+func Start() {
+	days := 90
+	if v, err := strconv.Atoi(os.Getenv("ARCHIVE_SUGGESTION_DAYS")); err == nil && v >= 0 {
+		days = v
+	}
+	hours := 24
+	if v, err := strconv.Atoi(os.Getenv("ARCHIVE_SUGGESTION_INTERVAL_HOURS")); err == nil && v > 0 {
+		hours = v
+	}
+	if days == 0 {
+		return
+	}
+
+	a := &Analyzer{
+		DB:           database.DB,
+		Log:          logger.NewLogger("archival-analyzer"),
+		InactiveDays: days,
+	}
+	go a.run(time.Duration(hours) * time.Hour)
+}
+
+func (a *Analyzer) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		if err := a.SuggestInactive(ctx, now.UTC()); err != nil {
+			a.Log.Error("Failed to suggest inactive channels", "error", err)
+		}
+		cancel()
+	}
+}
+
+// Suggestion is the data passed to the archive_suggestion mail template
+type Suggestion struct {
+	FirstName    string
+	ChannelName  string
+	TeamName     string
+	InactiveDays int
+	ArchiveURL   string
+}
+
+type inactiveChannel struct {
+	channelID   int64
+	channelName string
+	teamName    string
+}
+
+// SuggestInactive emails the admins of every channel idle for longer than
+// InactiveDays a signed one-click archive link
+func (a *Analyzer) SuggestInactive(ctx context.Context, now time.Time) error {
+	cutoff := now.AddDate(0, 0, -a.InactiveDays).Unix()
+
+	// Activity is the latest message, or channel creation for empty channels.
+	// Channels already suggested during this idle period are skipped.
+	query := `
+		SELECT c.channel_id, c.channel_name, t.team_name
+		FROM channels c
+		INNER JOIN teams t ON t.team_id = c.team_id
+		WHERE c.archived_at = 0
+			AND c.created_at < ?
+			AND c.archive_suggested_at < ?
+			AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.channel_id = c.channel_id AND m.message_created_at >= ?)
+	`
+	rows, err := a.DB.QueryContext(ctx, query, cutoff, cutoff, cutoff)
+	if err != nil {
+		return err
+	}
+	var inactive []inactiveChannel
+	for rows.Next() {
+		var ch inactiveChannel
+		if err := rows.Scan(&ch.channelID, &ch.channelName, &ch.teamName); err != nil {
+			rows.Close()
+			return err
+		}
+		inactive = append(inactive, ch)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ch := range inactive {
+		// Claim the channel so concurrent workers send one suggestion
+		claim, err := a.DB.ExecContext(ctx, `UPDATE channels SET archive_suggested_at = ? WHERE channel_id = ? AND archive_suggested_at < ?`, now.Unix(), ch.channelID, cutoff)
+		if err != nil {
+			a.Log.Error("Failed to claim channel for archive suggestion", "error", err, "channel_id", ch.channelID)
+			continue
+		}
+		if n, err := claim.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		if err := a.notifyAdmins(ctx, ch); err != nil {
+			a.Log.Error("Failed to send archive suggestion", "error", err, "channel_id", ch.channelID)
+		}
+	}
+	return nil
+}
+
+func (a *Analyzer) notifyAdmins(ctx context.Context, ch inactiveChannel) error {
+	rows, err := a.DB.QueryContext(ctx, adminsQuery, ch.channelID, ch.channelID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sent := 0
+	for rows.Next() {
+		var userID int64
+		var email, firstName string
+		if err := rows.Scan(&userID, &email, &firstName); err != nil {
+			return err
+		}
+		token, err := actiontoken.Sign(ActionArchiveChannel, userID, ch.channelID, tokenTTL)
+		if err != nil {
+			return err
+		}
+		err = mailer.SendTemplate(email, "archive_suggestion", Suggestion{
+			FirstName:    firstName,
+			ChannelName:  ch.channelName,
+			TeamName:     ch.teamName,
+			InactiveDays: a.InactiveDays,
+			ArchiveURL:   mailer.Link("/actions/archive-channel?token=" + url.QueryEscape(token)),
+		})
+		if err != nil {
+			return err
+		}
+		sent++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	a.Log.Info("Archive suggested", "channel_id", ch.channelID, "admins", sent)
+	return nil
+}
+
+// adminsQuery selects the users who may archive a channel: its channel admins
+// and the owners of its team
+const adminsQuery = `
+	SELECT u.user_id, u.email, u.first_name
+	FROM users u
+	WHERE u.is_bot = 0 AND (
+		EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = ? AND cm.user_id = u.user_id AND cm.role = 1)
+		OR EXISTS (
+			SELECT 1 FROM channels c
+			INNER JOIN user_teams_mapper utm ON utm.team_id = c.team_id
+			WHERE c.channel_id = ? AND utm.user_id = u.user_id AND utm.role = 1))
+`
+
+// CanArchive reports whether a user is still allowed to archive a channel
+func CanArchive(ctx context.Context, db *sql.DB, userID, channelID int64) (bool, error) {
+	var allowed bool
+	query := `SELECT EXISTS (SELECT 1 FROM (` + adminsQuery + `) admins WHERE admins.user_id = ?)`
+	err := db.QueryRowContext(ctx, query, channelID, channelID, userID).Scan(&allowed)
+	return allowed, err
+}
+
+// Archive archives a channel, reporting false when it was already archived
+func Archive(ctx context.Context, db *sql.DB, channelID int64) (bool, error) {
+	now := time.Now().UTC().Unix()
+	result, err := db.ExecContext(ctx, `UPDATE channels SET archived_at = ?, updated_at = ? WHERE channel_id = ? AND archived_at = 0`, now, now, channelID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,153 @@
+package bots
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/commands"
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/handles"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/queries"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+// Bot is a built-in account that posts messages on behalf of a feature
+type Bot struct {
+	Handle    string
+	FirstName string
+}
+
+// StandupBot runs channel standups
+var StandupBot = Bot{Handle: "standup", FirstName: "Standup Bot"}
+
+// AnnouncementBot posts team-wide announcements to the default channels
+var AnnouncementBot = Bot{Handle: "announcements", FirstName: "Announcements"}
+
+var (
+	idsMu  sync.Mutex
+	botIDs = make(map[string]int64)
+)
+
+// UserID returns the user account of a bot, creating it on first use. Bot
+// accounts have no usable password, so they can never log in.
+func (b Bot) UserID(ctx context.Context) (int64, error) {
+	idsMu.Lock()
+	defer idsMu.Unlock()
+	if id, ok := botIDs[b.Handle]; ok {
+		return id, nil
+	}
+
+	email := b.Handle + "@bots.eaven.invalid"
+	var id int64
+	err := database.DB.QueryRowContext(ctx, `SELECT user_id FROM users WHERE email = ? AND is_bot = 1`, email).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		now := time.Now().UTC()
+		handle, handleErr := handles.Available(ctx, database.DB, workspace.DefaultID, handles.Suggest(b.Handle), now)
+		if handleErr != nil {
+			return 0, handleErr
+		}
+		query := `INSERT INTO users (email, handle, password, contact_number, first_name, last_name, created_at, is_bot) VALUES (?, ?, '!', '', ?, '', ?, 1)`
+		result, insertErr := database.DB.ExecContext(ctx, query, email, handle, b.FirstName, now.Unix())
+		if insertErr != nil {
+			return 0, insertErr
+		}
+		id, err = result.LastInsertId()
+	}
+	if err != nil {
+		return 0, err
+	}
+	botIDs[b.Handle] = id
+	return id, nil
+}
+
+var postLog = logger.NewLogger("bot-post")
+
+// Post sends a message to a channel as the bot
+func (b Bot) Post(ctx context.Context, channelID int64, text string) error {
+	userID, err := b.UserID(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = messageService.NewMessageService(database.DB, queries.Default(), postLog).SaveMessage(ctx, models.MessageBody{
+		ChannelID:   channelID,
+		UserID:      userID,
+		Content:     text,
+		MessageTime: time.Now().UTC().Unix(),
+	})
+	return err
+}
+
+// PostEphemeral shows a message from the bot to one member of a channel only
+func (b Bot) PostEphemeral(ctx context.Context, channelID, recipientID int64, text string) error {
+	userID, err := b.UserID(ctx)
+	if err != nil {
+		return err
+	}
+	var teamID int64
+	if err := database.DB.QueryRowContext(ctx, `SELECT team_id FROM channels WHERE channel_id = ?`, channelID).Scan(&teamID); err != nil {
+		return err
+	}
+	return messageService.SendEphemeral(ctx, database.DB, events.MessageEphemeral{
+		ChannelID:   channelID,
+		TeamID:      teamID,
+		UserID:      userID,
+		RecipientID: recipientID,
+		Content:     text,
+	})
+}
+
+// RegisterCommands installs the slash commands served by the built-in bots.
+// It runs in the API process, where messages are received.
+func RegisterCommands() {
+	commands.Register("standup", standupCommand)
+	commands.Register("remind", remindCommand)
+	commands.Register("recurring", recurringCommand)
+}
+
+// Start launches the bot scheduler. BOT_INTERVAL_SECONDS controls how often
+// schedules are checked (default 60); 0 disables the built-in bots.
+func Start() {
+	interval := 60
+	if v, err := strconv.Atoi(os.Getenv("BOT_INTERVAL_SECONDS")); err == nil && v >= 0 {
+		interval = v
+	}
+	if interval == 0 {
+		return
+	}
+
+	s := &Scheduler{
+		DB:  database.DB,
+		Log: logger.NewLogger("bot-scheduler"),
+	}
+	go s.run(time.Duration(interval) * time.Second)
+}
+
+// Scheduler runs the timed work of the built-in bots
+type Scheduler struct {
+	DB  *sql.DB
+	Log *logger.Logger
+}
+
+func (s *Scheduler) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := s.runStandups(ctx, now.UTC()); err != nil {
+			s.Log.Error("Failed to run standups", "error", err)
+		}
+		if err := s.runSchedules(ctx, now.UTC()); err != nil {
+			s.Log.Error("Failed to run scheduled posts", "error", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,420 @@
+package bots
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/commands"
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/i18n"
+)
+
+// ReminderBot posts reminders and recurring channel posts
+var ReminderBot = Bot{Handle: "reminders", FirstName: "Reminder Bot"}
+
+// Schedule kinds and repeat intervals
+const (
+	kindReminder  = "reminder"
+	kindRecurring = "recurring"
+
+	repeatNone   = "none"
+	repeatDaily  = "daily"
+	repeatWeekly = "weekly"
+)
+
+const (
+	maxSchedulesPerUser = 50
+	maxReminderDelay    = 365 * 24 * time.Hour
+	schedulesPerRun     = 100
+)
+
+const remindUsage = "Usage: /remind in <30m|2h|3d> <text>, /remind at <HH:MM> <text>, /remind list, /remind cancel <id>"
+
+const recurringUsage = "Usage: /recurring daily <HH:MM> <text>, /recurring weekly <mon..sun> <HH:MM> <text>, /recurring list, /recurring cancel <id>"
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ErrInvalidReminder is returned for reminders without text or whose time is
+// not within the next year
+var ErrInvalidReminder = errors.New("a reminder needs text and a remind_at in the next 365 days")
+
+// ErrTooManySchedules is returned when a user has as many pending reminders
+// and recurring posts as allowed
+var ErrTooManySchedules = fmt.Errorf("you can have at most %d pending reminders and recurring posts", maxSchedulesPerUser)
+
+// ErrReminderNotFound is returned when cancelling a reminder the user does
+// not have
+var ErrReminderNotFound = errors.New("reminder not found")
+
+// Reminder is a pending one-off reminder. There are no direct messages, so
+// reminders are posted in their channel by the Reminder Bot, mentioning the
+// user who set them.
+type Reminder struct {
+	ReminderID int64  `json:"reminder_id"`
+	ChannelID  int64  `json:"channel_id"`
+	Text       string `json:"text"`
+	RemindAt   int64  `json:"remind_at"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// CreateReminder schedules a reminder for a user in a channel they belong to
+func CreateReminder(ctx context.Context, userID, channelID int64, text string, remindAt time.Time) (Reminder, error) {
+	text = strings.TrimSpace(text)
+	now := time.Now().UTC()
+	if text == "" || !remindAt.After(now) || remindAt.Sub(now) > maxReminderDelay {
+		return Reminder{}, ErrInvalidReminder
+	}
+	inv := commands.Invocation{UserID: userID, ChannelID: channelID}
+	id, err := createSchedule(ctx, inv, kindReminder, repeatNone, text, remindAt.UTC())
+	if err != nil {
+		return Reminder{}, err
+	}
+	if id == 0 {
+		return Reminder{}, ErrTooManySchedules
+	}
+	return Reminder{ReminderID: id, ChannelID: channelID, Text: text, RemindAt: remindAt.Unix(), CreatedAt: now.Unix()}, nil
+}
+
+// ListReminders returns a user's pending reminders, soonest first, in one
+// channel or in all of them when channelID is 0
+func ListReminders(ctx context.Context, userID, channelID int64) ([]Reminder, error) {
+	query := `
+		SELECT schedule_id, channel_id, content, next_run_at, created_at
+		FROM bot_schedules
+		WHERE user_id = ? AND kind = ? AND (? = 0 OR channel_id = ?)
+		ORDER BY next_run_at
+	`
+	rows, err := database.DB.QueryContext(ctx, query, userID, kindReminder, channelID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		var r Reminder
+		if err := rows.Scan(&r.ReminderID, &r.ChannelID, &r.Text, &r.RemindAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, r)
+	}
+	return reminders, rows.Err()
+}
+
+// CancelReminder deletes one of a user's pending reminders
+func CancelReminder(ctx context.Context, userID, reminderID int64) error {
+	result, err := database.DB.ExecContext(ctx, `DELETE FROM bot_schedules WHERE schedule_id = ? AND user_id = ? AND kind = ?`, reminderID, userID, kindReminder)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrReminderNotFound
+	}
+	return nil
+}
+
+// remindCommand schedules a one-off reminder in the current channel. All
+// times are UTC.
+func remindCommand(ctx context.Context, inv commands.Invocation) (commands.Response, error) {
+	verb, rest, _ := strings.Cut(inv.Args, " ")
+	rest = strings.TrimSpace(rest)
+	now := time.Now().UTC()
+
+	var runAt time.Time
+	switch strings.ToLower(verb) {
+	case "list":
+		return listSchedules(ctx, inv, kindReminder)
+	case "cancel":
+		return cancelSchedule(ctx, inv, kindReminder, rest)
+	case "in":
+		amount, text, _ := strings.Cut(rest, " ")
+		delay, err := parseDelay(amount)
+		if err != nil || delay <= 0 || delay > maxReminderDelay {
+			return commands.Response{Text: remindUsage}, nil
+		}
+		runAt, rest = now.Add(delay), text
+	case "at":
+		clock, text, _ := strings.Cut(rest, " ")
+		hour, minute, err := parseClock(clock)
+		if err != nil {
+			return commands.Response{Text: remindUsage}, nil
+		}
+		runAt = time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, time.UTC)
+		if !runAt.After(now) {
+			runAt = runAt.AddDate(0, 0, 1)
+		}
+		rest = text
+	default:
+		return commands.Response{Text: remindUsage}, nil
+	}
+
+	text := strings.TrimSpace(rest)
+	if text == "" {
+		return commands.Response{Text: remindUsage}, nil
+	}
+	id, err := createSchedule(ctx, inv, kindReminder, repeatNone, text, runAt)
+	if err != nil || id == 0 {
+		return commands.Response{Text: "You have too many pending reminders and recurring posts."}, err
+	}
+	return commands.Response{Text: fmt.Sprintf("Reminder #%d set for %s.", id, runAt.Format("Mon Jan 2 15:04 UTC"))}, nil
+}
+
+// recurringCommand schedules a post that repeats daily or weekly in the
+// current channel, e.g. "/recurring weekly fri 15:00 Retro thread"
+func recurringCommand(ctx context.Context, inv commands.Invocation) (commands.Response, error) {
+	fields := strings.Fields(inv.Args)
+	if len(fields) == 0 {
+		return commands.Response{Text: recurringUsage}, nil
+	}
+	now := time.Now().UTC()
+
+	repeat := strings.ToLower(fields[0])
+	var weekday time.Weekday
+	var clockIndex int
+	switch repeat {
+	case "list":
+		return listSchedules(ctx, inv, kindRecurring)
+	case "cancel":
+		return cancelSchedule(ctx, inv, kindRecurring, strings.Join(fields[1:], " "))
+	case repeatDaily:
+		clockIndex = 1
+	case repeatWeekly:
+		if len(fields) < 2 {
+			return commands.Response{Text: recurringUsage}, nil
+		}
+		day, ok := weekdayNames[strings.ToLower(fields[1])[:min(3, len(fields[1]))]]
+		if !ok {
+			return commands.Response{Text: recurringUsage}, nil
+		}
+		weekday, clockIndex = day, 2
+	default:
+		return commands.Response{Text: recurringUsage}, nil
+	}
+	if len(fields) <= clockIndex+1 {
+		return commands.Response{Text: recurringUsage}, nil
+	}
+	hour, minute, err := parseClock(fields[clockIndex])
+	if err != nil {
+		return commands.Response{Text: recurringUsage}, nil
+	}
+
+	// Keep the text as typed, including line breaks, after the schedule words
+	text := inv.Args
+	for _, f := range fields[:clockIndex+1] {
+		text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), f))
+	}
+
+	runAt := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, time.UTC)
+	if repeat == repeatWeekly {
+		runAt = runAt.AddDate(0, 0, (int(weekday)-int(now.Weekday())+7)%7)
+	}
+	for !runAt.After(now) {
+		runAt = nextRun(runAt, repeat)
+	}
+
+	id, err := createSchedule(ctx, inv, kindRecurring, repeat, text, runAt)
+	if err != nil || id == 0 {
+		return commands.Response{Text: "You have too many pending reminders and recurring posts."}, err
+	}
+	return commands.Response{Text: fmt.Sprintf("Recurring post #%d scheduled %s, first on %s.", id, repeat, runAt.Format("Mon Jan 2 15:04 UTC"))}, nil
+}
+
+// createSchedule stores a schedule, returning 0 when the user is at their limit
+func createSchedule(ctx context.Context, inv commands.Invocation, kind, repeat, text string, runAt time.Time) (int64, error) {
+	var count int
+	if err := database.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM bot_schedules WHERE user_id = ?`, inv.UserID).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count >= maxSchedulesPerUser {
+		return 0, nil
+	}
+
+	query := `
+		INSERT INTO bot_schedules (channel_id, user_id, kind, repeat_interval, content, next_run_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := database.DB.ExecContext(ctx, query, inv.ChannelID, inv.UserID, kind, repeat, text, runAt.Unix(), time.Now().UTC().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func listSchedules(ctx context.Context, inv commands.Invocation, kind string) (commands.Response, error) {
+	query := `
+		SELECT schedule_id, repeat_interval, content, next_run_at
+		FROM bot_schedules
+		WHERE channel_id = ? AND user_id = ? AND kind = ?
+		ORDER BY next_run_at
+	`
+	rows, err := database.DB.QueryContext(ctx, query, inv.ChannelID, inv.UserID, kind)
+	if err != nil {
+		return commands.Response{}, err
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	for rows.Next() {
+		var id, nextRunAt int64
+		var repeat, text string
+		if err := rows.Scan(&id, &repeat, &text, &nextRunAt); err != nil {
+			return commands.Response{}, err
+		}
+		when := time.Unix(nextRunAt, 0).UTC().Format("Mon Jan 2 15:04 UTC")
+		if repeat != repeatNone {
+			when = repeat + ", next " + when
+		}
+		fmt.Fprintf(&b, "#%d (%s): %s\n", id, when, snippet(text))
+	}
+	if err := rows.Err(); err != nil {
+		return commands.Response{}, err
+	}
+	if b.Len() == 0 {
+		return commands.Response{Text: "You have nothing scheduled in this channel."}, nil
+	}
+	return commands.Response{Text: strings.TrimSuffix(b.String(), "\n")}, nil
+}
+
+// cancelSchedule deletes one of the user's schedules. Channel admins can
+// also cancel recurring posts created by others.
+func cancelSchedule(ctx context.Context, inv commands.Invocation, kind, arg string) (commands.Response, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(arg), "#"), 10, 64)
+	if err != nil {
+		return commands.Response{Text: "Usage: /" + inv.Name + " cancel <id>"}, nil
+	}
+
+	query := `
+		DELETE FROM bot_schedules
+		WHERE schedule_id = ? AND channel_id = ? AND kind = ?
+			AND (user_id = ? OR (kind = 'recurring' AND EXISTS(
+				SELECT 1 FROM channel_members WHERE channel_id = ? AND user_id = ? AND role = 1)))
+	`
+	result, err := database.DB.ExecContext(ctx, query, id, inv.ChannelID, kind, inv.UserID, inv.ChannelID, inv.UserID)
+	if err != nil {
+		return commands.Response{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return commands.Response{}, err
+	} else if n == 0 {
+		return commands.Response{Text: fmt.Sprintf("Nothing to cancel with ID #%d in this channel.", id)}, nil
+	}
+	return commands.Response{Text: fmt.Sprintf("Cancelled #%d.", id)}, nil
+}
+
+// runSchedules posts every reminder and recurring post that is due. Each
+// schedule is claimed by moving or deleting it conditionally on the run time
+// that was read, so concurrent workers never post it twice.
+func (s *Scheduler) runSchedules(ctx context.Context, now time.Time) error {
+	query := `
+		SELECT bs.schedule_id, bs.channel_id, bs.kind, bs.repeat_interval, bs.content, bs.next_run_at, u.handle,
+			EXISTS(SELECT 1 FROM channel_members cm WHERE cm.channel_id = bs.channel_id AND cm.user_id = bs.user_id)
+		FROM bot_schedules bs
+		INNER JOIN users u ON u.user_id = bs.user_id
+		WHERE bs.next_run_at <= ?
+		ORDER BY bs.next_run_at
+		LIMIT ?
+	`
+	rows, err := s.DB.QueryContext(ctx, query, now.Unix(), schedulesPerRun)
+	if err != nil {
+		return err
+	}
+	type due struct {
+		id, channelID, nextRunAt   int64
+		kind, repeat, text, handle string
+		isMember                   bool
+	}
+	var pending []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.channelID, &d.kind, &d.repeat, &d.text, &d.nextRunAt, &d.handle, &d.isMember); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range pending {
+		var claim sql.Result
+		// Schedules of users who left the channel are dropped, not posted
+		if d.repeat == repeatNone || !d.isMember {
+			claim, err = s.DB.ExecContext(ctx, `DELETE FROM bot_schedules WHERE schedule_id = ? AND next_run_at = ?`, d.id, d.nextRunAt)
+		} else {
+			next := time.Unix(d.nextRunAt, 0).UTC()
+			for !next.After(now) {
+				next = nextRun(next, d.repeat)
+			}
+			claim, err = s.DB.ExecContext(ctx, `UPDATE bot_schedules SET next_run_at = ? WHERE schedule_id = ? AND next_run_at = ?`, next.Unix(), d.id, d.nextRunAt)
+		}
+		if err != nil {
+			s.Log.Error("Failed to claim schedule", "error", err, "schedule_id", d.id)
+			continue
+		}
+		if n, err := claim.RowsAffected(); err != nil || n == 0 || !d.isMember {
+			continue
+		}
+
+		text := d.text
+		if d.kind == kindReminder {
+			locale, err := i18n.ChannelLocale(ctx, s.DB, d.channelID)
+			if err != nil {
+				s.Log.Warn("Failed to get channel locale", "error", err, "channel_id", d.channelID)
+			}
+			text = "@" + d.handle + " " + i18n.Text(locale, "reminder.prefix") + " " + d.text
+		}
+		if err := ReminderBot.Post(ctx, d.channelID, text); err != nil {
+			s.Log.Error("Failed to post scheduled message", "error", err, "schedule_id", d.id)
+		}
+	}
+	return nil
+}
+
+func nextRun(t time.Time, repeat string) time.Time {
+	if repeat == repeatWeekly {
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// parseDelay accepts Go durations such as 30m or 1h30m plus whole days (3d)
+func parseDelay(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func parseClock(s string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, errors.New("time must be HH:MM")
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func snippet(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if runes := []rune(s); len(runes) > 80 {
+		return string(runes[:80]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,310 @@
+package bots
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/commands"
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/i18n"
+)
+
+const (
+	defaultCollectMinutes = 120
+	maxCollectMinutes     = 12 * 60
+	maxStandupPrompt      = 1000
+	maxSummaryBytes       = 3500
+)
+
+// ErrInvalidStandup is returned for standup configs that fail validation
+var ErrInvalidStandup = errors.New("invalid standup config")
+
+// ErrStandupNotFound is returned when a channel has no standup configured
+var ErrStandupNotFound = errors.New("standup not found")
+
+// Standup is a channel's standup schedule. Hours and weekdays are in UTC;
+// weekday 0 is Sunday.
+type Standup struct {
+	ChannelID      int64  `json:"channel_id"`
+	Prompt         string `json:"prompt"`
+	SendHour       int    `json:"send_hour"`
+	Weekdays       []int  `json:"weekdays"`
+	CollectMinutes int    `json:"collect_minutes"`
+	CreatedBy      int64  `json:"created_by"`
+	CreatedAt      int64  `json:"created_at"`
+	LastRunAt      int64  `json:"last_run_at,omitempty"`
+}
+
+// GetStandup loads the standup configured for a channel
+func GetStandup(ctx context.Context, channelID int64) (Standup, error) {
+	st := Standup{ChannelID: channelID}
+	var mask int
+	query := `SELECT prompt, send_hour, weekdays, collect_minutes, created_by, created_at, last_run_at FROM standups WHERE channel_id = ?`
+	err := database.DB.QueryRowContext(ctx, query, channelID).Scan(&st.Prompt, &st.SendHour, &mask, &st.CollectMinutes, &st.CreatedBy, &st.CreatedAt, &st.LastRunAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Standup{}, ErrStandupNotFound
+	}
+	st.Weekdays = weekdaysFromMask(mask)
+	return st, err
+}
+
+// SaveStandup creates or replaces a channel's standup schedule
+func SaveStandup(ctx context.Context, st Standup) (Standup, error) {
+	st.Prompt = strings.TrimSpace(st.Prompt)
+	if st.Prompt == "" || len(st.Prompt) > maxStandupPrompt {
+		return Standup{}, fmt.Errorf("%w: prompt must be 1 to %d characters", ErrInvalidStandup, maxStandupPrompt)
+	}
+	if st.SendHour < 0 || st.SendHour > 23 {
+		return Standup{}, fmt.Errorf("%w: send_hour must be between 0 and 23", ErrInvalidStandup)
+	}
+	if st.CollectMinutes == 0 {
+		st.CollectMinutes = defaultCollectMinutes
+	}
+	if st.CollectMinutes < 5 || st.CollectMinutes > maxCollectMinutes {
+		return Standup{}, fmt.Errorf("%w: collect_minutes must be between 5 and %d", ErrInvalidStandup, maxCollectMinutes)
+	}
+	if len(st.Weekdays) == 0 {
+		st.Weekdays = []int{1, 2, 3, 4, 5}
+	}
+	mask := 0
+	for _, d := range st.Weekdays {
+		if d < 0 || d > 6 {
+			return Standup{}, fmt.Errorf("%w: weekdays must be between 0 and 6", ErrInvalidStandup)
+		}
+		mask |= 1 << d
+	}
+	st.Weekdays = weekdaysFromMask(mask)
+	st.CreatedAt = time.Now().UTC().Unix()
+
+	query := `
+		INSERT INTO standups (channel_id, prompt, send_hour, weekdays, collect_minutes, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE prompt = VALUES(prompt), send_hour = VALUES(send_hour),
+			weekdays = VALUES(weekdays), collect_minutes = VALUES(collect_minutes)
+	`
+	_, err := database.DB.ExecContext(ctx, query, st.ChannelID, st.Prompt, st.SendHour, mask, st.CollectMinutes, st.CreatedBy, st.CreatedAt)
+	if err != nil {
+		return Standup{}, err
+	}
+	return GetStandup(ctx, st.ChannelID)
+}
+
+// DeleteStandup stops a channel's standups. A run already collecting replies
+// still posts its summary.
+func DeleteStandup(ctx context.Context, channelID int64) error {
+	result, err := database.DB.ExecContext(ctx, `DELETE FROM standups WHERE channel_id = ?`, channelID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrStandupNotFound
+	}
+	return nil
+}
+
+func weekdaysFromMask(mask int) []int {
+	days := []int{}
+	for d := 0; d < 7; d++ {
+		if mask&(1<<d) != 0 {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// standupCommand records a reply to the standup collecting in the channel:
+// "/standup <update>". Without text it repeats the prompt.
+func standupCommand(ctx context.Context, inv commands.Invocation) (commands.Response, error) {
+	var runID int64
+	var prompt string
+	var closesAt int64
+	query := `
+		SELECT r.run_id, s.prompt, r.closes_at
+		FROM standup_runs r
+		INNER JOIN standups s ON s.standup_id = r.standup_id
+		WHERE r.channel_id = ? AND r.closed_at = 0
+		ORDER BY r.run_id DESC
+		LIMIT 1
+	`
+	err := database.DB.QueryRowContext(ctx, query, inv.ChannelID).Scan(&runID, &prompt, &closesAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return commands.Response{Text: "No standup is collecting updates in this channel right now."}, nil
+	}
+	if err != nil {
+		return commands.Response{}, err
+	}
+
+	closes := time.Unix(closesAt, 0).UTC().Format("15:04 UTC")
+	if inv.Args == "" {
+		return commands.Response{Text: prompt + "\nReply with /standup <your update> before " + closes + "."}, nil
+	}
+
+	upsert := `
+		INSERT INTO standup_replies (run_id, user_id, content, created_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE content = VALUES(content), created_at = VALUES(created_at)
+	`
+	if _, err := database.DB.ExecContext(ctx, upsert, runID, inv.UserID, inv.Args, time.Now().UTC().Unix()); err != nil {
+		return commands.Response{}, err
+	}
+	return commands.Response{Text: "Thanks, your update was recorded. The summary is posted at " + closes + "."}, nil
+}
+
+// runStandups opens the standups scheduled for this hour and posts the
+// summaries of collection windows that have closed. Each step is claimed with
+// a conditional update, so concurrent workers never post twice.
+func (s *Scheduler) runStandups(ctx context.Context, now time.Time) error {
+	query := `
+		SELECT standup_id, channel_id, prompt, collect_minutes
+		FROM standups
+		WHERE send_hour = ? AND weekdays & ? <> 0 AND last_run_at < ?
+	`
+	rows, err := s.DB.QueryContext(ctx, query, now.Hour(), 1<<int(now.Weekday()), now.Add(-20*time.Hour).Unix())
+	if err != nil {
+		return err
+	}
+	type due struct {
+		standupID, channelID int64
+		prompt               string
+		collectMinutes       int
+	}
+	var opening []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.standupID, &d.channelID, &d.prompt, &d.collectMinutes); err != nil {
+			rows.Close()
+			return err
+		}
+		opening = append(opening, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range opening {
+		if err := s.openStandup(ctx, d.standupID, d.channelID, d.prompt, d.collectMinutes, now); err != nil {
+			s.Log.Error("Failed to open standup", "error", err, "channel_id", d.channelID)
+		}
+	}
+
+	rows, err = s.DB.QueryContext(ctx, `SELECT run_id, channel_id FROM standup_runs WHERE closed_at = 0 AND closes_at <= ?`, now.Unix())
+	if err != nil {
+		return err
+	}
+	closing := map[int64]int64{}
+	for rows.Next() {
+		var runID, channelID int64
+		if err := rows.Scan(&runID, &channelID); err != nil {
+			rows.Close()
+			return err
+		}
+		closing[runID] = channelID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for runID, channelID := range closing {
+		if err := s.closeStandup(ctx, runID, channelID, now); err != nil {
+			s.Log.Error("Failed to post standup summary", "error", err, "run_id", runID)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) openStandup(ctx context.Context, standupID, channelID int64, prompt string, collectMinutes int, now time.Time) error {
+	claim, err := s.DB.ExecContext(ctx, `UPDATE standups SET last_run_at = ? WHERE standup_id = ? AND last_run_at < ?`, now.Unix(), standupID, now.Add(-20*time.Hour).Unix())
+	if err != nil {
+		return err
+	}
+	if n, err := claim.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	closesAt := now.Add(time.Duration(collectMinutes) * time.Minute)
+	query := `INSERT INTO standup_runs (standup_id, channel_id, started_at, closes_at) VALUES (?, ?, ?, ?)`
+	if _, err := s.DB.ExecContext(ctx, query, standupID, channelID, now.Unix(), closesAt.Unix()); err != nil {
+		return err
+	}
+
+	// There are no direct messages yet, so the prompt goes to the channel
+	// and mentions everyone in it
+	locale, err := i18n.ChannelLocale(ctx, s.DB, channelID)
+	if err != nil {
+		return err
+	}
+	text := i18n.Text(locale, "standup.prompt", "prompt", prompt, "closes_at", closesAt.Format("15:04 UTC"))
+	return StandupBot.Post(ctx, channelID, text)
+}
+
+func (s *Scheduler) closeStandup(ctx context.Context, runID, channelID int64, now time.Time) error {
+	claim, err := s.DB.ExecContext(ctx, `UPDATE standup_runs SET closed_at = ? WHERE run_id = ? AND closed_at = 0`, now.Unix(), runID)
+	if err != nil {
+		return err
+	}
+	if n, err := claim.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	// Every human member, with their reply if they sent one
+	query := `
+		SELECT u.first_name, u.last_name, COALESCE(sr.content, '')
+		FROM channel_members cm
+		INNER JOIN users u ON u.user_id = cm.user_id AND u.is_bot = 0
+		LEFT JOIN standup_replies sr ON sr.run_id = ? AND sr.user_id = cm.user_id
+		WHERE cm.channel_id = ?
+		ORDER BY sr.created_at IS NULL, sr.created_at, u.first_name
+	`
+	rows, err := s.DB.QueryContext(ctx, query, runID, channelID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var updates, missing []string
+	for rows.Next() {
+		var firstName, lastName, reply string
+		if err := rows.Scan(&firstName, &lastName, &reply); err != nil {
+			return err
+		}
+		name := strings.TrimSpace(firstName + " " + lastName)
+		if reply == "" {
+			missing = append(missing, name)
+			continue
+		}
+		updates = append(updates, "**"+name+"**: "+reply)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	locale, err := i18n.ChannelLocale(ctx, s.DB, channelID)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(i18n.Text(locale, "standup.summary"))
+	if len(updates) == 0 {
+		b.WriteString("\n" + i18n.Text(locale, "standup.nobody"))
+	}
+	for i, u := range updates {
+		// Stay well inside the message length limit on very large channels
+		if b.Len()+len(u) > maxSummaryBytes {
+			b.WriteString("\n" + i18n.Text(locale, "standup.more", "count", strconv.Itoa(len(updates)-i)))
+			break
+		}
+		b.WriteString("\n" + u)
+	}
+	if len(missing) > 0 && len(updates) > 0 {
+		b.WriteString("\n" + i18n.Text(locale, "standup.missing", "names", strings.Join(missing, ", ")))
+	}
+	return StandupBot.Post(ctx, channelID, b.String())
+}
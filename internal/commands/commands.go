@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Invocation describes a slash command sent in a channel
+type Invocation struct {
+	Name      string
+	Args      string
+	UserID    int64
+	ChannelID int64
+	TeamID    int64
+}
+
+// Response is returned to the user who ran the command. It is not posted to
+// the channel.
+type Response struct {
+	Text string `json:"text"`
+}
+
+// Handler runs a slash command
+type Handler func(ctx context.Context, inv Invocation) (Response, error)
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[string]Handler)
+)
+
+// Register installs the handler for /name. Subsystems call this when the API
+// starts.
+func Register(name string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[strings.ToLower(name)] = handler
+}
+
+// Lookup parses message content as a slash command. It reports false when the
+// content is not a registered command, in which case it should be treated as
+// a regular message.
+func Lookup(content string) (Handler, Invocation, bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "/") {
+		return nil, Invocation{}, false
+	}
+
+	name, args, _ := strings.Cut(content[1:], " ")
+	name = strings.ToLower(name)
+
+	mu.RLock()
+	handler, ok := handlers[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, Invocation{}, false
+	}
+	return handler, Invocation{Name: name, Args: strings.TrimSpace(args)}, true
+}
@@ -0,0 +1,191 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrInvalidContent is wrapped by every validation failure so callers can map
+// it to a 400 response
+var ErrInvalidContent = errors.New("invalid message content")
+
+// Config controls the message content pipeline
+type Config struct {
+	// MaxLength is the maximum message length in characters
+	MaxLength int
+	// RenderHTML stores a sanitized HTML rendering next to the raw content
+	RenderHTML bool
+}
+
+// Result is the output of the pipeline
+type Result struct {
+	Content string
+	HTML    string
+}
+
+var (
+	configOnce sync.Once
+	config     Config
+)
+
+// LoadConfig reads the pipeline settings from the environment:
+// MESSAGE_MAX_LENGTH (default 4000) and MESSAGE_RENDER_HTML (default false)
+func LoadConfig() Config {
+	configOnce.Do(func() {
+		config = Config{MaxLength: 4000}
+		if v, err := strconv.Atoi(os.Getenv("MESSAGE_MAX_LENGTH")); err == nil && v > 0 {
+			config.MaxLength = v
+		}
+		config.RenderHTML, _ = strconv.ParseBool(os.Getenv("MESSAGE_RENDER_HTML"))
+	})
+	return config
+}
+
+// Process validates and cleans raw message content using the deployment config
+func Process(raw string) (Result, error) {
+	return ProcessWith(LoadConfig(), raw)
+}
+
+// ProcessWith runs the pipeline with an explicit config
+func ProcessWith(cfg Config, raw string) (Result, error) {
+	if !utf8.ValidString(raw) {
+		return Result{}, fmt.Errorf("%w: content is not valid UTF-8", ErrInvalidContent)
+	}
+
+	cleaned := normalizeMarkdown(stripHTML(raw))
+	if cleaned == "" {
+		return Result{}, fmt.Errorf("%w: message cannot be empty", ErrInvalidContent)
+	}
+	if length := utf8.RuneCountInString(cleaned); length > cfg.MaxLength {
+		return Result{}, fmt.Errorf("%w: message is %d characters, the limit is %d", ErrInvalidContent, length, cfg.MaxLength)
+	}
+
+	result := Result{Content: cleaned}
+	if cfg.RenderHTML {
+		result.HTML = renderMarkdown(cleaned)
+	}
+	return result, nil
+}
+
+// droppedElements have their text content removed along with the tags
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"embed": true, "noscript": true, "template": true, "svg": true,
+}
+
+// maxStripPasses bounds how many layers of escaped markup stripHTML unwraps
+const maxStripPasses = 8
+
+// stripHTML removes all HTML tags, keeping the text of harmless elements.
+// Messages are markdown, so no raw HTML is ever passed through. Text comes
+// out entity-decoded, so &lt;img&gt; would turn into a real tag; the strip
+// repeats until its output is stable, and what is still unstable after
+// maxStripPasses is escaped.
+func stripHTML(raw string) string {
+	for range maxStripPasses {
+		stripped := stripOnce(raw)
+		if stripped == raw {
+			return stripped
+		}
+		raw = stripped
+	}
+	return html.EscapeString(raw)
+}
+
+func stripOnce(raw string) string {
+	if !strings.ContainsAny(raw, "<&") {
+		return raw
+	}
+
+	var b strings.Builder
+	depth := 0
+	tokenizer := html.NewTokenizer(strings.NewReader(raw))
+	for {
+		switch tt := tokenizer.Next(); tt {
+		case html.ErrorToken:
+			return b.String()
+		case html.TextToken:
+			if depth == 0 {
+				b.Write(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// TagName lowers the case of the token in place
+			tag := string(tokenizer.Raw())
+			name, hasAttr := tokenizer.TagName()
+			if droppedElements[string(name)] && tt == html.StartTagToken {
+				depth++
+			}
+			if depth == 0 && keepAsText(name, hasAttr, tokenizer) {
+				b.WriteString(tag)
+			}
+		case html.EndTagToken:
+			tag := string(tokenizer.Raw())
+			name, _ := tokenizer.TagName()
+			if droppedElements[string(name)] && depth > 0 {
+				depth--
+			}
+			if depth == 0 && atom.Lookup(name) == 0 {
+				b.WriteString(tag)
+			}
+		}
+	}
+}
+
+// keepAsText reports whether a tag is ordinary text that looks like markup,
+// such as the type parameter in Vec<T>: not an HTML element and without
+// attributes a browser would act on
+func keepAsText(name []byte, hasAttr bool, tokenizer *html.Tokenizer) bool {
+	if atom.Lookup(name) != 0 {
+		return false
+	}
+	for hasAttr {
+		var key []byte
+		key, _, hasAttr = tokenizer.TagAttr()
+		if k := string(key); strings.HasPrefix(k, "on") || k == "style" || k == "href" || k == "src" {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeMarkdown unifies line endings, removes control characters and
+// trailing whitespace, and collapses runs of blank lines
+func normalizeMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || r == '\u200b' || r == '\ufeff' {
+			return -1
+		}
+		return r
+	}, s)
+
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
@@ -0,0 +1,63 @@
+package content
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	boldPattern   = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	italicPattern = regexp.MustCompile(`(^|[^\w*])\*([^*\n]+)\*`)
+	strikePattern = regexp.MustCompile(`~~([^~\n]+)~~`)
+	linkPattern   = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^\s)]+|mailto:[^\s)]+)\)|(https?://[^\s<]+)`)
+)
+
+// renderMarkdown converts the supported markdown subset to HTML. All text is
+// escaped before formatting is applied, so the output only ever contains tags
+// generated here.
+func renderMarkdown(s string) string {
+	var b strings.Builder
+
+	// Fenced code blocks alternate with regular text when split on ```
+	for i, block := range strings.Split(s, "```") {
+		if i%2 == 1 {
+			block = strings.TrimPrefix(block, "\n")
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(block))
+			b.WriteString("</code></pre>")
+			continue
+		}
+		b.WriteString(renderInline(block))
+	}
+	return b.String()
+}
+
+// renderInline formats a text run, leaving `code spans` untouched
+func renderInline(s string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(s, "`") {
+		if i%2 == 1 {
+			b.WriteString("<code>")
+			b.WriteString(html.EscapeString(part))
+			b.WriteString("</code>")
+			continue
+		}
+
+		part = html.EscapeString(part)
+		part = linkPattern.ReplaceAllStringFunc(part, func(match string) string {
+			groups := linkPattern.FindStringSubmatch(match)
+			text, href := groups[1], groups[2]
+			if groups[3] != "" {
+				text, href = groups[3], groups[3]
+			}
+			return `<a href="` + href + `" rel="nofollow noopener" target="_blank">` + text + `</a>`
+		})
+		part = boldPattern.ReplaceAllString(part, "<strong>$1</strong>")
+		part = strikePattern.ReplaceAllString(part, "<del>$1</del>")
+		part = italicPattern.ReplaceAllString(part, "$1<em>$2</em>")
+		part = strings.ReplaceAll(part, "\n", "<br>")
+		b.WriteString(part)
+	}
+	return b.String()
+}
@@ -1,13 +1,19 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+
+	"github.com/nikhil/eaven/internal/logger"
 )
 
 var DB *sql.DB
@@ -18,38 +24,125 @@ func InitDB() {
 		log.Fatal("Error loading .env file")
 	}
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
+	DB, err = open(os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = DB.Ping()
+	if err != nil {
+		log.Fatal("Database connection is not active:", err)
+	}
+
+	fmt.Println("Database connected successfully!")
+	initReplicas()
+}
+
+// open returns a pool to the configured database on a server at addr
+// (host:port)
+func open(addr string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true",
 		os.Getenv("DB_USER"),
 		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
+		addr,
 		os.Getenv("DB_NAME"),
 	)
 
-	DB, err = sql.Open("mysql", dsn)
+	cfg, err := mysql.ParseDSN(dsn)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return nil, fmt.Errorf("invalid database configuration: %v", err)
 	}
-
-	err = DB.Ping()
+	connector, err := mysql.NewConnector(cfg)
 	if err != nil {
-		log.Fatal("Database connection is not active:", err)
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	fmt.Println("Database connected successfully!")
+	// DB_SLOW_QUERY_MS logs statements slower than the threshold (default
+	// 200; 0 disables)
+	if threshold := envInt("DB_SLOW_QUERY_MS", 200); threshold > 0 {
+		connector = &slowConnector{
+			Connector: connector,
+			slow: &slowLog{
+				threshold: time.Duration(threshold) * time.Millisecond,
+				log:       logger.NewLogger("database"),
+			},
+		}
+	}
+	db := sql.OpenDB(connector)
+	configurePool(db)
+	return db, nil
+}
+
+// configurePool applies the pool limits from the environment:
+// DB_MAX_OPEN_CONNS (default 25), DB_MAX_IDLE_CONNS (default 25),
+// DB_CONN_MAX_LIFETIME_SECONDS (default 300) and
+// DB_CONN_MAX_IDLE_TIME_SECONDS (default 60). A connection lifetime below the
+// server's wait_timeout avoids reusing connections MySQL has already closed.
+func configurePool(db *sql.DB) {
+	db.SetMaxOpenConns(envInt("DB_MAX_OPEN_CONNS", 25))
+	db.SetMaxIdleConns(envInt("DB_MAX_IDLE_CONNS", 25))
+	db.SetConnMaxLifetime(time.Duration(envInt("DB_CONN_MAX_LIFETIME_SECONDS", 300)) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(envInt("DB_CONN_MAX_IDLE_TIME_SECONDS", 60)) * time.Second)
+}
+
+// IsDuplicate reports whether err is MySQL refusing a row whose unique key
+// already exists
+func IsDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v >= 0 {
+		return v
+	}
+	return fallback
+}
+
+// Stats is the connection pool state reported by the diagnostics endpoint
+type Stats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMS     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+	SlowQueries        int64 `json:"slow_queries"`
+	// Replicas lists the read replicas, if any are configured
+	Replicas []ReplicaStats `json:"replicas"`
+}
+
+// PoolStats returns the current pool statistics of DB
+func PoolStats() Stats {
+	s := DB.Stats()
+	return Stats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMS:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+		SlowQueries:        SlowQueries(),
+		Replicas:           ReplicaStatus(),
+	}
 }
 
-func GetSqlQueryRow(query string, args ...interface{}) (map[string]interface{}, error) {
+func GetSqlQueryRow(ctx context.Context, query string, args ...interface{}) (map[string]interface{}, error) {
 	// row := DB.QueryRow(query, args...)
 
 	// Get column names using a prepared statement
-	stmt, err := DB.Prepare(query)
+	stmt, err := DB.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(args...)
+	rows, err := stmt.QueryContext(ctx, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -89,8 +182,8 @@ func GetSqlQueryRow(query string, args ...interface{}) (map[string]interface{},
 	return nil, fmt.Errorf("no rows found")
 }
 
-func GetSqlQueryRows(query string, args ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := DB.Query(query, args...)
+func GetSqlQueryRows(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +222,7 @@ func GetSqlQueryRows(query string, args ...interface{}) ([]map[string]interface{
 	return result, nil
 }
 
-func SendSqlStatement(query string, args ...interface{}) error {
-	_, err := DB.Exec(query, args...)
+func SendSqlStatement(ctx context.Context, query string, args ...interface{}) error {
+	_, err := DB.ExecContext(ctx, query, args...)
 	return err
 }
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// replicaCheckEvery is how often replica lag is measured
+const replicaCheckEvery = 5 * time.Second
+
+// replica is a read-only copy of the primary
+type replica struct {
+	addr string
+	db   *sql.DB
+	// lag is the last measured replication delay in seconds, or -1 while
+	// the replica is unreachable or not replicating
+	lag atomic.Int64
+}
+
+// errNotReplicating is reported for a server that is not applying changes
+// from a source
+var errNotReplicating = errors.New("database is not replicating")
+
+var (
+	replicas    []*replica
+	maxLag      int64
+	nextReplica atomic.Uint64
+	replicaOnce sync.Once
+)
+
+// ReplicaStats is the state of a replica reported by the diagnostics
+// endpoint
+type ReplicaStats struct {
+	Addr       string `json:"addr"`
+	Healthy    bool   `json:"healthy"`
+	LagSeconds int64  `json:"lag_seconds"`
+}
+
+// initReplicas opens the replicas in DB_REPLICAS, a comma-separated list of
+// host:port serving copies of the primary's database with the same
+// credentials. Reads sent to Reader skip replicas more than
+// DB_REPLICA_MAX_LAG_SECONDS (default 5) behind, and replicas whose lag
+// cannot be read; measuring it needs the REPLICATION CLIENT privilege.
+func initReplicas() {
+	replicaOnce.Do(func() {
+		maxLag = int64(envInt("DB_REPLICA_MAX_LAG_SECONDS", 5))
+		log := logger.NewLogger("database-replicas")
+		for _, addr := range strings.Split(os.Getenv("DB_REPLICAS"), ",") {
+			if addr = strings.TrimSpace(addr); addr == "" {
+				continue
+			}
+			db, err := open(addr)
+			if err != nil {
+				log.Error("Ignoring database replica", "addr", addr, "error", err)
+				continue
+			}
+			r := &replica{addr: addr, db: db}
+			r.lag.Store(-1)
+			replicas = append(replicas, r)
+		}
+		if len(replicas) == 0 {
+			return
+		}
+		checkReplicas(log)
+		go func() {
+			for range time.Tick(replicaCheckEvery) {
+				checkReplicas(log)
+			}
+		}()
+	})
+}
+
+// Reader returns a pool for reads that tolerate a few seconds of staleness,
+// such as history, listings and search: a replica within the lag limit,
+// taken in turn, or the primary when there is none. Reads that must see the
+// caller's own writes, and every write, use DB.
+func Reader() *sql.DB {
+	n := len(replicas)
+	start := int(nextReplica.Add(1) % uint64(max(n, 1)))
+	for i := 0; i < n; i++ {
+		r := replicas[(start+i)%n]
+		if lag := r.lag.Load(); lag >= 0 && lag <= maxLag {
+			return r.db
+		}
+	}
+	return DB
+}
+
+// ReplicaStatus returns the state of each configured replica
+func ReplicaStatus() []ReplicaStats {
+	stats := make([]ReplicaStats, 0, len(replicas))
+	for _, r := range replicas {
+		lag := r.lag.Load()
+		stats = append(stats, ReplicaStats{Addr: r.addr, Healthy: lag >= 0 && lag <= maxLag, LagSeconds: lag})
+	}
+	return stats
+}
+
+func checkReplicas(log *logger.Logger) {
+	for _, r := range replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckEvery)
+		lag, err := replicationLag(ctx, r.db)
+		cancel()
+		if err != nil {
+			if r.lag.Swap(-1) != -1 {
+				log.Warn("Database replica is unavailable, reading from the primary instead", "addr", r.addr, "error", err)
+			}
+			continue
+		}
+		r.lag.Store(lag)
+	}
+}
+
+// replicationLag reads how far a replica is behind its source, in seconds.
+// MySQL 8.0.22 renamed SHOW SLAVE STATUS to SHOW REPLICA STATUS and
+// Seconds_Behind_Master to Seconds_Behind_Source; both are understood.
+func replicationLag(ctx context.Context, db *sql.DB) (int64, error) {
+	rows, err := db.QueryContext(ctx, `SHOW REPLICA STATUS`)
+	if err != nil {
+		rows, err = db.QueryContext(ctx, `SHOW SLAVE STATUS`)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errNotReplicating
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, name := range columns {
+		if name != "Seconds_Behind_Source" && name != "Seconds_Behind_Master" {
+			continue
+		}
+		// NULL means the replication threads are stopped
+		if values[i] == nil {
+			return 0, errNotReplicating
+		}
+		return strconv.ParseInt(string(values[i]), 10, 64)
+	}
+	return 0, errNotReplicating
+}
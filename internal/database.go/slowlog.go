@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// slowQueries counts the statements that ran longer than the threshold
+var slowQueries atomic.Int64
+
+// SlowQueries returns how many slow statements were logged since startup
+func SlowQueries() int64 {
+	return slowQueries.Load()
+}
+
+// slowLog times every statement sent through the connections it wraps and
+// logs the ones slower than threshold
+type slowLog struct {
+	threshold time.Duration
+	log       *logger.Logger
+}
+
+func (s *slowLog) observe(ctx context.Context, query string, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		// The driver declined; database/sql retries the statement another way
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < s.threshold {
+		return
+	}
+	slowQueries.Add(1)
+	s.log.WithContext(ctx).Warn("Slow query", "query", query, "duration_ms", elapsed.Milliseconds(), "error", err)
+}
+
+// slowConnector hands out connections wrapped for slow query logging
+type slowConnector struct {
+	driver.Connector
+	slow *slowLog
+}
+
+func (c *slowConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &slowConn{Conn: conn, slow: c.slow}, nil
+}
+
+// slowConn forwards to the driver connection. It implements the optional
+// interfaces the MySQL driver supports so database/sql keeps its fast paths.
+type slowConn struct {
+	driver.Conn
+	slow *slowLog
+}
+
+func (c *slowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	c.slow.observe(ctx, query, start, err)
+	return rows, err
+}
+
+func (c *slowConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := e.ExecContext(ctx, query, args)
+	c.slow.observe(ctx, query, start, err)
+	return result, err
+}
+
+func (c *slowConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slowStmt{Stmt: stmt, query: query, slow: c.slow}, nil
+}
+
+func (c *slowConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *slowConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *slowConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *slowConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *slowConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// slowStmt times executions of a prepared statement
+type slowStmt struct {
+	driver.Stmt
+	query string
+	slow  *slowLog
+}
+
+func (s *slowStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return nil, errors.New("database: statement does not support ExecContext")
+	}
+	start := time.Now()
+	result, err := e.ExecContext(ctx, args)
+	s.slow.observe(ctx, s.query, start, err)
+	return result, err
+}
+
+func (s *slowStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return nil, errors.New("database: statement does not support QueryContext")
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, args)
+	s.slow.observe(ctx, s.query, start, err)
+	return rows, err
+}
+
+func (s *slowStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
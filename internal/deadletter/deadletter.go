@@ -0,0 +1,153 @@
+package deadletter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// ErrNoReplayer is returned when no delivery path is registered for a kind
+var ErrNoReplayer = errors.New("no replayer registered for dead letter kind")
+
+// ErrNotFound is returned when a dead letter does not exist
+var ErrNotFound = errors.New("dead letter not found")
+
+// ErrReplayFailed wraps the delivery error of an unsuccessful replay
+var ErrReplayFailed = errors.New("dead letter replay failed")
+
+// Replayer re-attempts delivery of a dead-lettered payload
+type Replayer func(ctx context.Context, payload json.RawMessage) error
+
+// Entry is a delivery that exhausted its retries
+type Entry struct {
+	ID          int64           `json:"dead_letter_id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	LastError   string          `json:"last_error"`
+	Attempts    int             `json:"attempts"`
+	CreatedAt   int64           `json:"created_at"`
+	ReplayedAt  int64           `json:"replayed_at,omitempty"`
+	ReplayError string          `json:"replay_error,omitempty"`
+}
+
+var (
+	mu        sync.RWMutex
+	replayers = make(map[string]Replayer)
+)
+
+// RegisterReplayer installs the delivery function used to replay entries of
+// the given kind. Delivery subsystems call this when they start.
+func RegisterReplayer(kind string, replayer Replayer) {
+	mu.Lock()
+	defer mu.Unlock()
+	replayers[kind] = replayer
+}
+
+// Record stores a failed delivery. payload is marshalled to JSON.
+func Record(ctx context.Context, kind string, payload interface{}, deliveryErr error, attempts int) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter payload: %v", err)
+	}
+	errMsg := ""
+	if deliveryErr != nil {
+		errMsg = deliveryErr.Error()
+	}
+
+	query := `INSERT INTO dead_letters (kind, payload, last_error, attempts, created_at) VALUES (?, ?, ?, ?, ?)`
+	_, err = database.DB.ExecContext(ctx, query, kind, data, errMsg, attempts, time.Now().UTC().Unix())
+	return err
+}
+
+// List returns dead letters newest first, optionally filtered by kind.
+// Replayed entries are skipped unless includeReplayed is set.
+func List(ctx context.Context, kind string, includeReplayed bool, limit, offset int) ([]Entry, error) {
+	query := `
+		SELECT dead_letter_id, kind, payload, last_error, attempts, created_at, replayed_at, COALESCE(replay_error, '')
+		FROM dead_letters
+		WHERE (? = '' OR kind = ?) AND (? OR replayed_at = 0)
+		ORDER BY dead_letter_id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := database.DB.QueryContext(ctx, query, kind, kind, includeReplayed, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		e, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Get loads a single dead letter
+func Get(ctx context.Context, id int64) (Entry, error) {
+	query := `
+		SELECT dead_letter_id, kind, payload, last_error, attempts, created_at, replayed_at, COALESCE(replay_error, '')
+		FROM dead_letters WHERE dead_letter_id = ?
+	`
+	e, err := scan(database.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Entry{}, ErrNotFound
+	}
+	return e, err
+}
+
+// Replay re-attempts delivery of a dead letter through its registered
+// replayer and records the outcome on the entry
+func Replay(ctx context.Context, id int64) (Entry, error) {
+	e, err := Get(ctx, id)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	mu.RLock()
+	replayer, ok := replayers[e.Kind]
+	mu.RUnlock()
+	if !ok {
+		return e, fmt.Errorf("%w: %s", ErrNoReplayer, e.Kind)
+	}
+
+	replayErr := replayer(ctx, e.Payload)
+	if replayErr != nil {
+		e.ReplayError = replayErr.Error()
+		_, err = database.DB.ExecContext(ctx, `UPDATE dead_letters SET attempts = attempts + 1, replay_error = ? WHERE dead_letter_id = ?`, e.ReplayError, id)
+		e.Attempts++
+	} else {
+		e.ReplayedAt = time.Now().UTC().Unix()
+		e.ReplayError = ""
+		_, err = database.DB.ExecContext(ctx, `UPDATE dead_letters SET attempts = attempts + 1, replayed_at = ?, replay_error = NULL WHERE dead_letter_id = ?`, e.ReplayedAt, id)
+		e.Attempts++
+	}
+	if err != nil {
+		return e, err
+	}
+	if replayErr != nil {
+		return e, fmt.Errorf("%w: %v", ErrReplayFailed, replayErr)
+	}
+	return e, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(s scanner) (Entry, error) {
+	var e Entry
+	var payload []byte
+	err := s.Scan(&e.ID, &e.Kind, &payload, &e.LastError, &e.Attempts, &e.CreatedAt, &e.ReplayedAt, &e.ReplayError)
+	e.Payload = payload
+	return e, err
+}
@@ -0,0 +1,301 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/mailer"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+)
+
+// Supported digest cadences
+const (
+	CadenceOff    = "off"
+	CadenceDaily  = "daily"
+	CadenceWeekly = "weekly"
+)
+
+// Defaults used for users who never configured their digest
+const (
+	DefaultCadence = CadenceWeekly
+	DefaultHour    = 9
+	DefaultWeekday = int(time.Monday)
+)
+
+const (
+	maxMentionsPerTeam = 5
+	maxChannelsPerTeam = 5
+)
+
+// Scheduler periodically sends due digests
+type Scheduler struct {
+	DB  *sql.DB
+	Log *logger.Logger
+}
+
+// Start launches the digest scheduler. DIGEST_INTERVAL_MINUTES controls how
+// often due digests are checked (default 15); 0 disables digests.
+func Start() {
+	interval := 15
+	if v, err := strconv.Atoi(os.Getenv("DIGEST_INTERVAL_MINUTES")); err == nil && v >= 0 {
+		interval = v
+	}
+	if interval == 0 {
+		return
+	}
+
+	s := &Scheduler{
+		DB:  database.DB,
+		Log: logger.NewLogger("digest-scheduler"),
+	}
+	go s.run(time.Duration(interval) * time.Minute)
+}
+
+func (s *Scheduler) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := s.SendDue(ctx, now.UTC()); err != nil {
+			s.Log.Error("Failed to send digests", "error", err)
+		}
+		if err := s.SendDueChannels(ctx, now.UTC()); err != nil {
+			s.Log.Error("Failed to send channel digests", "error", err)
+		}
+		cancel()
+	}
+}
+
+type recipient struct {
+	userID     int64
+	email      string
+	firstName  string
+	cadence    string
+	weekday    int
+	lastSentAt int64
+}
+
+// SendDue sends digests to every user whose schedule falls in the current hour
+func (s *Scheduler) SendDue(ctx context.Context, now time.Time) error {
+	query := `
+		SELECT u.user_id, u.email, u.first_name,
+			COALESCE(dp.cadence, ?), COALESCE(dp.send_weekday, ?), COALESCE(dp.last_sent_at, 0)
+		FROM users u
+		LEFT JOIN digest_preferences dp ON dp.user_id = u.user_id
+		WHERE COALESCE(dp.cadence, ?) <> ? AND COALESCE(dp.send_hour, ?) = ?
+	`
+	rows, err := s.DB.QueryContext(ctx, query, DefaultCadence, DefaultWeekday, DefaultCadence, CadenceOff, DefaultHour, now.Hour())
+	if err != nil {
+		return err
+	}
+
+	var due []recipient
+	for rows.Next() {
+		var rc recipient
+		if err := rows.Scan(&rc.userID, &rc.email, &rc.firstName, &rc.cadence, &rc.weekday, &rc.lastSentAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if isDue(rc, now) {
+			due = append(due, rc)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, rc := range due {
+		if err := s.send(ctx, rc, now); err != nil {
+			s.Log.Error("Failed to send digest", "error", err, "user_id", rc.userID)
+		}
+	}
+	return nil
+}
+
+// isDue reports whether a recipient's digest should go out in this run. The
+// minimum gap guards against sending twice within the scheduled hour.
+func isDue(rc recipient, now time.Time) bool {
+	since := now.Sub(time.Unix(rc.lastSentAt, 0))
+	switch rc.cadence {
+	case CadenceDaily:
+		return since > 20*time.Hour
+	case CadenceWeekly:
+		return int(now.Weekday()) == rc.weekday && since > 6*24*time.Hour
+	}
+	return false
+}
+
+// Email is the data passed to the digest mail template
+type Email struct {
+	FirstName string
+	Period    string
+	Teams     []*TeamSummary
+}
+
+// TeamSummary lists the busiest unread channels and recent mentions in a team
+type TeamSummary struct {
+	Name     string
+	Channels []ChannelSummary
+	Mentions []Mention
+}
+
+// ChannelSummary is the unread state of one channel
+type ChannelSummary struct {
+	Name     string
+	Unread   int
+	Mentions int
+}
+
+// Mention is a message that mentioned the recipient
+type Mention struct {
+	Channel string
+	Author  string
+	Content string
+}
+
+func (s *Scheduler) send(ctx context.Context, rc recipient, now time.Time) error {
+	// Claim the run first so a concurrent worker does not email the digest
+	// too. The run is recorded even when there is nothing to send, so the
+	// user is not re-checked for the rest of the hour.
+	claim, err := s.DB.ExecContext(ctx, `
+		INSERT INTO digest_preferences (user_id, cadence, send_hour, send_weekday, last_sent_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE last_sent_at = IF(last_sent_at = ?, VALUES(last_sent_at), last_sent_at)`,
+		rc.userID, rc.cadence, now.Hour(), rc.weekday, now.Unix(), now.Unix(), rc.lastSentAt)
+	if err != nil {
+		return err
+	}
+	if claimed, err := claim.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+
+	if err := s.deliver(ctx, rc); err != nil {
+		// Hand the run back so the next check tries again
+		if _, releaseErr := s.DB.ExecContext(ctx, `UPDATE digest_preferences SET last_sent_at = ? WHERE user_id = ? AND last_sent_at = ?`,
+			rc.lastSentAt, rc.userID, now.Unix()); releaseErr != nil {
+			s.Log.Error("Failed to release digest claim", "error", releaseErr, "user_id", rc.userID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Scheduler) deliver(ctx context.Context, rc recipient) error {
+	teams, order, err := s.collect(ctx, rc)
+	if err != nil {
+		return err
+	}
+	if len(order) == 0 {
+		return nil
+	}
+
+	email := Email{FirstName: rc.firstName, Period: rc.cadence}
+	for _, teamID := range order {
+		email.Teams = append(email.Teams, teams[teamID])
+	}
+	if err := mailer.SendTemplate(rc.email, "digest", email); err != nil {
+		return err
+	}
+	s.Log.Info("Digest queued", "user_id", rc.userID, "teams", len(order))
+	return nil
+}
+
+// collect gathers unread highlights and mentions per team since the last
+// digest. Muted channels are left out, and mentions-only channels only show
+// when they have mentions.
+func (s *Scheduler) collect(ctx context.Context, rc recipient) (map[int64]*TeamSummary, []int64, error) {
+	teams := make(map[int64]*TeamSummary)
+	var order []int64
+
+	channelQuery := `
+		SELECT t.team_id, t.team_name, c.channel_name,
+			COUNT(m.message_id) AS unread_count,
+			COALESCE(SUM(` + messageService.MentionCondition + `), 0) AS mention_count
+		FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		INNER JOIN teams t ON t.team_id = c.team_id
+		INNER JOIN users u ON u.user_id = cm.user_id
+		INNER JOIN messages m ON m.channel_id = cm.channel_id
+			AND m.message_id > cm.last_read_message_id
+			AND m.user_id <> cm.user_id
+			AND m.message_created_at > ?
+		WHERE cm.user_id = ? AND cm.notify_level <> 'muted'
+		GROUP BY t.team_id, t.team_name, c.channel_id, c.channel_name, cm.notify_level
+		HAVING cm.notify_level = 'all' OR mention_count > 0
+		ORDER BY t.team_name, mention_count DESC, unread_count DESC
+	`
+	rows, err := s.DB.QueryContext(ctx, channelQuery, rc.lastSentAt, rc.userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var teamID int64
+		var teamName string
+		var cs ChannelSummary
+		if err := rows.Scan(&teamID, &teamName, &cs.Name, &cs.Unread, &cs.Mentions); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		team, ok := teams[teamID]
+		if !ok {
+			team = &TeamSummary{Name: teamName}
+			teams[teamID] = team
+			order = append(order, teamID)
+		}
+		if len(team.Channels) < maxChannelsPerTeam {
+			team.Channels = append(team.Channels, cs)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	mentionQuery := `
+		SELECT c.team_id, c.channel_name, a.first_name, m.content
+		FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		INNER JOIN users u ON u.user_id = cm.user_id
+		INNER JOIN messages m ON m.channel_id = cm.channel_id
+		INNER JOIN users a ON a.user_id = m.user_id
+		WHERE cm.user_id = ? AND cm.notify_level <> 'muted'
+			AND m.message_id > cm.last_read_message_id
+			AND m.user_id <> cm.user_id
+			AND m.message_created_at > ?
+			AND ` + messageService.MentionCondition + `
+		ORDER BY m.message_created_at DESC
+	`
+	rows, err = s.DB.QueryContext(ctx, mentionQuery, rc.userID, rc.lastSentAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var teamID int64
+		var mn Mention
+		if err := rows.Scan(&teamID, &mn.Channel, &mn.Author, &mn.Content); err != nil {
+			return nil, nil, err
+		}
+		mn.Content = snippet(mn.Content)
+		if team, ok := teams[teamID]; ok && len(team.Mentions) < maxMentionsPerTeam {
+			team.Mentions = append(team.Mentions, mn)
+		}
+	}
+	return teams, order, rows.Err()
+}
+
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) > 120 {
+		return string(runes[:120]) + "…"
+	}
+	return content
+}
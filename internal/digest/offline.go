@@ -0,0 +1,199 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/mailer"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+)
+
+const (
+	// maxOfflineMentions bounds the mentions listed in one email
+	maxOfflineMentions = 10
+	// offlineEmailGap is the least time between two emails to one user
+	offlineEmailGap = time.Hour
+)
+
+// OfflineNotifier emails users who have been away about mentions they have
+// not read
+type OfflineNotifier struct {
+	DB    *sql.DB
+	Log   *logger.Logger
+	After time.Duration
+}
+
+// StartOffline launches the offline mention notifier. OFFLINE_EMAIL_MINUTES
+// sets how long a user must be inactive before being emailed (default 30; 0
+// disables) and OFFLINE_EMAIL_INTERVAL_MINUTES how often users are checked
+// (default 5).
+func StartOffline() {
+	after := 30
+	if v, err := strconv.Atoi(os.Getenv("OFFLINE_EMAIL_MINUTES")); err == nil && v >= 0 {
+		after = v
+	}
+	interval := 5
+	if v, err := strconv.Atoi(os.Getenv("OFFLINE_EMAIL_INTERVAL_MINUTES")); err == nil && v > 0 {
+		interval = v
+	}
+	if after == 0 {
+		return
+	}
+
+	n := &OfflineNotifier{
+		DB:    database.DB,
+		Log:   logger.NewLogger("offline-notifier"),
+		After: time.Duration(after) * time.Minute,
+	}
+	go n.run(time.Duration(interval) * time.Minute)
+}
+
+func (n *OfflineNotifier) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := n.SendDue(ctx, now.UTC()); err != nil {
+			n.Log.Error("Failed to send offline mention emails", "error", err)
+		}
+		cancel()
+	}
+}
+
+// OfflineEmail is the data passed to the offline_mentions mail template
+type OfflineEmail struct {
+	FirstName string
+	Mentions  []OfflineMention
+	AppURL    string
+}
+
+// OfflineMention is an unread message that mentioned the recipient
+type OfflineMention struct {
+	Team    string
+	Channel string
+	Author  string
+	Content string
+}
+
+type offlineRecipient struct {
+	userID         int64
+	email          string
+	firstName      string
+	lastSeenAt     int64
+	lastNotifiedID int64
+}
+
+// unreadMentions selects the mentions a user has not read, posted after they
+// were last seen and after the last mention they were emailed about, outside
+// the channels they muted
+const unreadMentions = `
+	SELECT m.message_id, t.team_name, c.channel_name, a.first_name, m.content
+	FROM channel_members cm
+	INNER JOIN channels c ON c.channel_id = cm.channel_id
+	INNER JOIN teams t ON t.team_id = c.team_id
+	INNER JOIN users u ON u.user_id = cm.user_id
+	INNER JOIN messages m ON m.channel_id = cm.channel_id
+	INNER JOIN users a ON a.user_id = m.user_id
+	WHERE cm.user_id = ? AND cm.notify_level <> 'muted'
+		AND m.message_id > cm.last_read_message_id
+		AND m.message_id > ?
+		AND m.user_id <> cm.user_id
+		AND m.message_created_at > ?
+		AND ` + messageService.MentionCondition + `
+	ORDER BY m.message_id
+`
+
+// SendDue emails every user who has been away longer than After and has
+// unread mentions they were not emailed about yet
+func (n *OfflineNotifier) SendDue(ctx context.Context, now time.Time) error {
+	// Users never seen since presence tracking began are skipped, otherwise
+	// their whole history would count as unread
+	query := `
+		SELECT u.user_id, u.email, u.first_name, u.last_seen_at, COALESCE(o.last_notified_message_id, 0)
+		FROM users u
+		LEFT JOIN offline_email_preferences o ON o.user_id = u.user_id
+		WHERE u.is_bot = 0 AND u.merged_into = 0
+			AND u.last_seen_at > 0 AND u.last_seen_at < ?
+			AND COALESCE(o.enabled, 1) = 1
+			AND COALESCE(o.last_sent_at, 0) < ?
+	`
+	rows, err := n.DB.QueryContext(ctx, query, now.Add(-n.After).Unix(), now.Add(-offlineEmailGap).Unix())
+	if err != nil {
+		return err
+	}
+	var due []offlineRecipient
+	for rows.Next() {
+		var rc offlineRecipient
+		if err := rows.Scan(&rc.userID, &rc.email, &rc.firstName, &rc.lastSeenAt, &rc.lastNotifiedID); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, rc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, rc := range due {
+		if err := n.send(ctx, rc, now); err != nil {
+			n.Log.Error("Failed to send offline mention email", "error", err, "user_id", rc.userID)
+		}
+	}
+	return nil
+}
+
+func (n *OfflineNotifier) send(ctx context.Context, rc offlineRecipient, now time.Time) error {
+	rows, err := n.DB.QueryContext(ctx, unreadMentions, rc.userID, rc.lastNotifiedID, rc.lastSeenAt)
+	if err != nil {
+		return err
+	}
+	email := OfflineEmail{FirstName: rc.firstName, AppURL: mailer.Link("/")}
+	var lastID int64
+	for rows.Next() {
+		var messageID int64
+		var mn OfflineMention
+		if err := rows.Scan(&messageID, &mn.Team, &mn.Channel, &mn.Author, &mn.Content); err != nil {
+			rows.Close()
+			return err
+		}
+		lastID = messageID
+		if len(email.Mentions) < maxOfflineMentions {
+			mn.Content = snippet(mn.Content)
+			email.Mentions = append(email.Mentions, mn)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(email.Mentions) == 0 {
+		return nil
+	}
+
+	// Claim the mentions first so a concurrent worker does not email them too
+	claim, err := n.DB.ExecContext(ctx, `
+		INSERT INTO offline_email_preferences (user_id, enabled, last_notified_message_id, last_sent_at, updated_at)
+		VALUES (?, 1, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			last_sent_at = IF(last_notified_message_id = ?, VALUES(last_sent_at), last_sent_at),
+			last_notified_message_id = IF(last_notified_message_id = ?, VALUES(last_notified_message_id), last_notified_message_id)`,
+		rc.userID, lastID, now.Unix(), now.Unix(), rc.lastNotifiedID, rc.lastNotifiedID)
+	if err != nil {
+		return err
+	}
+	if claimed, err := claim.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+
+	if err := mailer.SendTemplate(rc.email, "offline_mentions", email); err != nil {
+		return err
+	}
+	n.Log.Info("Offline mention email queued", "user_id", rc.userID, "mentions", len(email.Mentions))
+	return nil
+}
@@ -0,0 +1,305 @@
+package digest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/mailer"
+)
+
+const maxMessagesPerChannelDigest = 10
+
+var (
+	// ErrChannelNotFound is returned when subscribing to a missing channel
+	ErrChannelNotFound = errors.New("channel not found")
+	// ErrPrivateChannel is returned when subscribing to a private channel
+	ErrPrivateChannel = errors.New("only public channels can have email subscribers")
+	// ErrInvalidEmail is returned for addresses that cannot receive mail
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrInvalidCadence is returned for cadences other than daily and weekly
+	ErrInvalidCadence = errors.New("cadence must be daily or weekly")
+	// ErrSubscriptionNotFound is returned when a subscription does not exist
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+)
+
+// ChannelSubscription sends periodic summaries of a public channel to an
+// email address that has no account
+type ChannelSubscription struct {
+	ID         int64  `json:"subscription_id"`
+	ChannelID  int64  `json:"channel_id"`
+	Email      string `json:"email"`
+	Cadence    string `json:"cadence"`
+	CreatedBy  int64  `json:"created_by"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSentAt int64  `json:"last_sent_at"`
+}
+
+// ListChannelSubscriptions returns the email subscribers of a channel
+func ListChannelSubscriptions(ctx context.Context, channelID int64) ([]ChannelSubscription, error) {
+	query := `
+		SELECT subscription_id, channel_id, email, cadence, created_by, created_at, last_sent_at
+		FROM channel_email_subscriptions WHERE channel_id = ? ORDER BY email
+	`
+	rows, err := database.DB.QueryContext(ctx, query, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []ChannelSubscription{}
+	for rows.Next() {
+		var s ChannelSubscription
+		if err := rows.Scan(&s.ID, &s.ChannelID, &s.Email, &s.Cadence, &s.CreatedBy, &s.CreatedAt, &s.LastSentAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+// SubscribeChannel subscribes an email address to a public channel, or
+// updates the cadence of an existing subscription. The first summary covers
+// messages posted after subscribing.
+func SubscribeChannel(ctx context.Context, channelID int64, email, cadence string, createdBy int64) (ChannelSubscription, error) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		return ChannelSubscription{}, ErrInvalidEmail
+	}
+	if cadence != CadenceDaily && cadence != CadenceWeekly {
+		return ChannelSubscription{}, ErrInvalidCadence
+	}
+
+	var isPrivate bool
+	err = database.DB.QueryRowContext(ctx, `SELECT is_private FROM channels WHERE channel_id = ?`, channelID).Scan(&isPrivate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChannelSubscription{}, ErrChannelNotFound
+	}
+	if err != nil {
+		return ChannelSubscription{}, err
+	}
+	if isPrivate {
+		return ChannelSubscription{}, ErrPrivateChannel
+	}
+
+	now := time.Now().UTC().Unix()
+	s := ChannelSubscription{
+		ChannelID:  channelID,
+		Email:      strings.ToLower(addr.Address),
+		Cadence:    cadence,
+		CreatedBy:  createdBy,
+		CreatedAt:  now,
+		LastSentAt: now,
+	}
+	query := `
+		INSERT INTO channel_email_subscriptions (channel_id, email, cadence, unsubscribe_token, created_by, created_at, last_sent_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE cadence = VALUES(cadence)
+	`
+	if _, err := database.DB.ExecContext(ctx, query, s.ChannelID, s.Email, s.Cadence, newToken(), s.CreatedBy, s.CreatedAt, s.LastSentAt); err != nil {
+		return ChannelSubscription{}, err
+	}
+
+	// Reload so an updated subscription reports its original metadata
+	err = database.DB.QueryRowContext(ctx, `
+		SELECT subscription_id, created_by, created_at, last_sent_at
+		FROM channel_email_subscriptions WHERE channel_id = ? AND email = ?
+	`, s.ChannelID, s.Email).Scan(&s.ID, &s.CreatedBy, &s.CreatedAt, &s.LastSentAt)
+	return s, err
+}
+
+// DeleteChannelSubscription removes a subscription by ID
+func DeleteChannelSubscription(ctx context.Context, channelID, subscriptionID int64) error {
+	result, err := database.DB.ExecContext(ctx, `DELETE FROM channel_email_subscriptions WHERE channel_id = ? AND subscription_id = ?`, channelID, subscriptionID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// Unsubscribe removes the subscription identified by the token included in
+// every summary email
+func Unsubscribe(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrSubscriptionNotFound
+	}
+	result, err := database.DB.ExecContext(ctx, `DELETE FROM channel_email_subscriptions WHERE unsubscribe_token = ?`, token)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// unsubscribeURL builds the link placed in summary emails
+func unsubscribeURL(token string) string {
+	return mailer.Link("/email-subscriptions/unsubscribe?token=" + url.QueryEscape(token))
+}
+
+// ChannelEmail is the data passed to the channel_digest mail template
+type ChannelEmail struct {
+	ChannelName    string
+	TeamName       string
+	Period         string
+	MessageCount   int
+	More           int
+	Messages       []ChannelMessage
+	UnsubscribeURL string
+}
+
+// ChannelMessage is a recent message quoted in a channel summary
+type ChannelMessage struct {
+	Author  string
+	Content string
+}
+
+type channelRecipient struct {
+	id          int64
+	channelID   int64
+	email       string
+	cadence     string
+	token       string
+	lastSentAt  int64
+	channelName string
+	teamName    string
+}
+
+// SendDueChannels sends channel summaries whose schedule falls in the current
+// hour. Subscriptions use the default send hour and weekday.
+func (s *Scheduler) SendDueChannels(ctx context.Context, now time.Time) error {
+	if now.Hour() != DefaultHour {
+		return nil
+	}
+
+	// Channels made private or archived after subscribing stop sending
+	query := `
+		SELECT ces.subscription_id, ces.channel_id, ces.email, ces.cadence, ces.unsubscribe_token, ces.last_sent_at,
+			c.channel_name, t.team_name
+		FROM channel_email_subscriptions ces
+		INNER JOIN channels c ON c.channel_id = ces.channel_id
+		INNER JOIN teams t ON t.team_id = c.team_id
+		WHERE c.is_private = 0 AND c.archived_at = 0
+	`
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	var due []channelRecipient
+	for rows.Next() {
+		var rc channelRecipient
+		if err := rows.Scan(&rc.id, &rc.channelID, &rc.email, &rc.cadence, &rc.token, &rc.lastSentAt, &rc.channelName, &rc.teamName); err != nil {
+			rows.Close()
+			return err
+		}
+		if isDue(recipient{cadence: rc.cadence, weekday: DefaultWeekday, lastSentAt: rc.lastSentAt}, now) {
+			due = append(due, rc)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, rc := range due {
+		if err := s.sendChannel(ctx, rc, now); err != nil {
+			s.Log.Error("Failed to send channel digest", "error", err, "subscription_id", rc.id)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) sendChannel(ctx context.Context, rc channelRecipient, now time.Time) error {
+	// Claim the period first so a concurrent worker does not send it too.
+	// Quiet periods still advance the cursor so the next summary only covers
+	// its own period.
+	claim, err := s.DB.ExecContext(ctx, `UPDATE channel_email_subscriptions SET last_sent_at = ? WHERE subscription_id = ? AND last_sent_at = ?`,
+		now.Unix(), rc.id, rc.lastSentAt)
+	if err != nil {
+		return err
+	}
+	if claimed, err := claim.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+
+	if err := s.deliverChannel(ctx, rc); err != nil {
+		// Hand the period back so the next check tries again
+		if _, releaseErr := s.DB.ExecContext(ctx, `UPDATE channel_email_subscriptions SET last_sent_at = ? WHERE subscription_id = ? AND last_sent_at = ?`,
+			rc.lastSentAt, rc.id, now.Unix()); releaseErr != nil {
+			s.Log.Error("Failed to release channel digest claim", "error", releaseErr, "subscription_id", rc.id)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Scheduler) deliverChannel(ctx context.Context, rc channelRecipient) error {
+	email := ChannelEmail{
+		ChannelName:    rc.channelName,
+		TeamName:       rc.teamName,
+		Period:         rc.cadence,
+		UnsubscribeURL: unsubscribeURL(rc.token),
+	}
+
+	countQuery := `SELECT COUNT(*) FROM messages WHERE channel_id = ? AND message_created_at > ?`
+	if err := s.DB.QueryRowContext(ctx, countQuery, rc.channelID, rc.lastSentAt).Scan(&email.MessageCount); err != nil {
+		return err
+	}
+
+	if email.MessageCount > 0 {
+		query := `
+			SELECT a.first_name, m.content
+			FROM messages m
+			INNER JOIN users a ON a.user_id = m.user_id
+			WHERE m.channel_id = ? AND m.message_created_at > ?
+			ORDER BY m.message_created_at DESC
+			LIMIT ?
+		`
+		rows, err := s.DB.QueryContext(ctx, query, rc.channelID, rc.lastSentAt, maxMessagesPerChannelDigest)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var cm ChannelMessage
+			if err := rows.Scan(&cm.Author, &cm.Content); err != nil {
+				rows.Close()
+				return err
+			}
+			cm.Content = snippet(cm.Content)
+			email.Messages = append(email.Messages, cm)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		email.More = email.MessageCount - len(email.Messages)
+
+		if err := mailer.SendTemplate(rc.email, "channel_digest", email); err != nil {
+			return err
+		}
+		s.Log.Info("Channel digest queued", "subscription_id", rc.id, "channel_id", rc.channelID, "messages", email.MessageCount)
+	}
+	return nil
+}
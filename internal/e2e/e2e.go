@@ -0,0 +1,174 @@
+package e2e
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxPayloadBytes bounds the encoded size of an encrypted message
+	MaxPayloadBytes = 64 * 1024
+	// maxPublicKeyBytes bounds a decoded public key
+	maxPublicKeyBytes = 1024
+	// maxDevices bounds the keys a user can publish
+	maxDevices = 20
+)
+
+// ErrInvalidKey is wrapped by every device key validation failure
+var ErrInvalidKey = errors.New("invalid device key")
+
+// ErrTooManyDevices is returned when a user who already has keys on the
+// maximum number of devices publishes one for a new device
+var ErrTooManyDevices = fmt.Errorf("at most %d devices can publish keys", maxDevices)
+
+// ErrInvalidPayload is returned for encrypted payloads that are not base64
+// or are too large
+var ErrInvalidPayload = errors.New("invalid encrypted payload")
+
+// ErrNotPrivate is returned for encrypted messages sent to a channel that is
+// not private
+var ErrNotPrivate = errors.New("encrypted messages can only be sent to private channels")
+
+// DeviceKey is the public key of one of a user's devices. The algorithm is
+// chosen by clients; the server stores keys without interpreting them.
+type DeviceKey struct {
+	UserID    int64  `json:"user_id"`
+	DeviceID  string `json:"device_id"`
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// PublishKey stores or rotates the public key of a device
+func PublishKey(ctx context.Context, db *sql.DB, userID int64, deviceID, algorithm, publicKey string) (DeviceKey, error) {
+	if !validToken(deviceID, 64) {
+		return DeviceKey{}, fmt.Errorf("%w: device_id must be 1 to 64 letters, digits, '-' or '_'", ErrInvalidKey)
+	}
+	if !validToken(algorithm, 32) {
+		return DeviceKey{}, fmt.Errorf("%w: algorithm must be 1 to 32 letters, digits, '-' or '_'", ErrInvalidKey)
+	}
+	if n, err := decodedLen(publicKey); err != nil || n == 0 || n > maxPublicKeyBytes {
+		return DeviceKey{}, fmt.Errorf("%w: public_key must be base64 of at most %d bytes", ErrInvalidKey, maxPublicKeyBytes)
+	}
+
+	var devices int
+	var exists bool
+	query := `SELECT COUNT(*), COALESCE(SUM(device_id = ?), 0) > 0 FROM device_keys WHERE user_id = ?`
+	if err := db.QueryRowContext(ctx, query, deviceID, userID).Scan(&devices, &exists); err != nil {
+		return DeviceKey{}, err
+	}
+	if !exists && devices >= maxDevices {
+		return DeviceKey{}, ErrTooManyDevices
+	}
+
+	key := DeviceKey{UserID: userID, DeviceID: deviceID, Algorithm: algorithm, PublicKey: publicKey, CreatedAt: time.Now().UTC().Unix()}
+	query = `
+		INSERT INTO device_keys (user_id, device_id, algorithm, public_key, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE algorithm = VALUES(algorithm), public_key = VALUES(public_key), created_at = VALUES(created_at)
+	`
+	_, err := db.ExecContext(ctx, query, key.UserID, key.DeviceID, key.Algorithm, key.PublicKey, key.CreatedAt)
+	return key, err
+}
+
+// RevokeKey removes a device's key, reporting whether one existed. Peers
+// stop encrypting to the device once they refetch keys.
+func RevokeKey(ctx context.Context, db *sql.DB, userID int64, deviceID string) (bool, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM device_keys WHERE user_id = ? AND device_id = ?`, userID, deviceID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// UserKeys returns the device keys of a user, newest first
+func UserKeys(ctx context.Context, db *sql.DB, userID int64) ([]DeviceKey, error) {
+	query := `
+		SELECT user_id, device_id, algorithm, public_key, created_at
+		FROM device_keys WHERE user_id = ?
+		ORDER BY created_at DESC, device_id
+	`
+	return scanKeys(db.QueryContext(ctx, query, userID))
+}
+
+// ChannelKeys returns the device keys of every member of a channel, which
+// is what a sender encrypts to
+func ChannelKeys(ctx context.Context, db *sql.DB, channelID int64) ([]DeviceKey, error) {
+	query := `
+		SELECT dk.user_id, dk.device_id, dk.algorithm, dk.public_key, dk.created_at
+		FROM device_keys dk
+		INNER JOIN channel_members cm ON cm.user_id = dk.user_id
+		WHERE cm.channel_id = ?
+		ORDER BY dk.user_id, dk.created_at DESC, dk.device_id
+	`
+	return scanKeys(db.QueryContext(ctx, query, channelID))
+}
+
+// SharesTeam reports whether two users belong to a common team, which is
+// what allows one to fetch the other's keys
+func SharesTeam(ctx context.Context, db *sql.DB, userID, peerID int64) (bool, error) {
+	var shared bool
+	query := `
+		SELECT EXISTS(SELECT 1 FROM user_teams_mapper a
+			INNER JOIN user_teams_mapper b ON b.team_id = a.team_id
+			WHERE a.user_id = ? AND b.user_id = ?)
+	`
+	err := db.QueryRowContext(ctx, query, userID, peerID).Scan(&shared)
+	return shared, err
+}
+
+// ValidatePayload checks only the envelope of an encrypted message: it must
+// be base64 and within MaxPayloadBytes. Its content is never inspected.
+func ValidatePayload(payload string) error {
+	if payload == "" || len(payload) > MaxPayloadBytes {
+		return fmt.Errorf("%w: payload must be between 1 and %d bytes", ErrInvalidPayload, MaxPayloadBytes)
+	}
+	if _, err := decodedLen(payload); err != nil {
+		return fmt.Errorf("%w: payload must be base64", ErrInvalidPayload)
+	}
+	return nil
+}
+
+func scanKeys(rows *sql.Rows, err error) ([]DeviceKey, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []DeviceKey{}
+	for rows.Next() {
+		var k DeviceKey
+		if err := rows.Scan(&k.UserID, &k.DeviceID, &k.Algorithm, &k.PublicKey, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// decodedLen decodes standard or URL-safe base64, padded or not
+func decodedLen(s string) (int, error) {
+	s = strings.TrimRight(s, "=")
+	if b, err := base64.RawStdEncoding.DecodeString(s); err == nil {
+		return len(b), nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	return len(b), err
+}
+
+func validToken(s string, maxLen int) bool {
+	if s == "" || len(s) > maxLen {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,322 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ProtocolVersion is the envelope version produced by this server. Clients
+// send the version they speak; frames from newer versions are rejected.
+const ProtocolVersion = 1
+
+// MaxInboundFrameBytes bounds the size of a frame accepted from a client
+const MaxInboundFrameBytes = 16 * 1024
+
+// Event types
+const (
+	TypeMessageCreated      = "message.created"
+	TypeMessageDeleted      = "message.deleted"
+	TypeMessageEphemeral    = "message.ephemeral"
+	TypeChannelMemberJoined = "channel.member_joined"
+	TypeChannelMemberLeft   = "channel.member_left"
+	TypePresenceChanged     = "presence.changed"
+	TypeTeamAnnouncement    = "team.announcement"
+	TypeTyping              = "typing"
+	TypeUserThrottled       = "user.throttled"
+)
+
+// Schema identifiers, one per event type. A schema changes identifier
+// whenever its payload changes incompatibly.
+const (
+	SchemaMessageCreated      = "eaven.message.created.v1"
+	SchemaMessageDeleted      = "eaven.message.deleted.v1"
+	SchemaMessageEphemeral    = "eaven.message.ephemeral.v1"
+	SchemaChannelMemberJoined = "eaven.channel.member_joined.v1"
+	SchemaChannelMemberLeft   = "eaven.channel.member_left.v1"
+	SchemaPresenceChanged     = "eaven.presence.changed.v1"
+	SchemaTeamAnnouncement    = "eaven.team.announcement.v1"
+	SchemaTyping              = "eaven.typing.v1"
+	SchemaUserThrottled       = "eaven.user.throttled.v1"
+)
+
+// Presence states
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// ErrInvalidFrame is returned for inbound frames that fail validation
+var ErrInvalidFrame = errors.New("invalid event frame")
+
+// Envelope wraps every event sent to or received from a client
+type Envelope struct {
+	Version   int             `json:"v"`
+	Type      string          `json:"type"`
+	Schema    string          `json:"schema"`
+	Timestamp int64           `json:"ts"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// MessageCreated is sent when a message is posted to a channel
+type MessageCreated struct {
+	MessageID    int64  `json:"message_id"`
+	ChannelID    int64  `json:"channel_id"`
+	TeamID       int64  `json:"team_id"`
+	UserID       int64  `json:"user_id"`
+	Content      string `json:"content"`
+	RenderedHTML string `json:"rendered_html,omitempty"`
+	CreatedAt    int64  `json:"message_created_at"`
+	ReplyToID    int64  `json:"reply_to_id,omitempty"`
+	ReplyTo      *Quote `json:"reply_to,omitempty"`
+	// ContentType is "e2e" for encrypted messages, which carry
+	// EncryptedPayload and an empty Content
+	ContentType      string  `json:"content_type,omitempty"`
+	EncryptedPayload string  `json:"encrypted_payload,omitempty"`
+	AttachmentIDs    []int64 `json:"attachment_ids,omitempty"`
+}
+
+// MessageDeleted is sent when a message is removed from a channel
+type MessageDeleted struct {
+	MessageID int64  `json:"message_id"`
+	ChannelID int64  `json:"channel_id"`
+	TeamID    int64  `json:"team_id"`
+	DeletedBy int64  `json:"deleted_by"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// MessageEphemeral is shown only to its recipient, in a channel, and is never
+// stored as a message: command responses, error hints and private bot
+// replies
+type MessageEphemeral struct {
+	ChannelID   int64  `json:"channel_id"`
+	TeamID      int64  `json:"team_id"`
+	UserID      int64  `json:"user_id"`
+	RecipientID int64  `json:"recipient_id"`
+	Content     string `json:"content"`
+	// Command is the slash command answered, if any
+	Command   string `json:"command,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Quote is the snippet of the message a reply quotes
+type Quote struct {
+	MessageID int64  `json:"message_id"`
+	UserID    int64  `json:"user_id"`
+	Snippet   string `json:"snippet"`
+	CreatedAt int64  `json:"message_created_at"`
+}
+
+// ChannelMemberJoined is sent when a user joins a channel or is added to it
+type ChannelMemberJoined struct {
+	ChannelID int64 `json:"channel_id"`
+	TeamID    int64 `json:"team_id"`
+	UserID    int64 `json:"user_id"`
+	JoinedAt  int64 `json:"joined_at"`
+	// AddedBy is the member who added the user, absent when they joined
+	// themselves
+	AddedBy int64 `json:"added_by,omitempty"`
+}
+
+// ChannelMemberLeft is sent when a user leaves a channel or is removed from
+// it. The user receives it too.
+type ChannelMemberLeft struct {
+	ChannelID int64 `json:"channel_id"`
+	TeamID    int64 `json:"team_id"`
+	UserID    int64 `json:"user_id"`
+	LeftAt    int64 `json:"left_at"`
+	// RemovedBy is who removed the user, absent when they left themselves
+	RemovedBy int64 `json:"removed_by,omitempty"`
+}
+
+// TeamAnnouncement is sent to every member of a team, outside any channel,
+// when an owner announces something to the whole team
+type TeamAnnouncement struct {
+	TeamID    int64  `json:"team_id"`
+	UserID    int64  `json:"user_id"`
+	Content   string `json:"content"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// PresenceChanged is sent when a user's presence changes. Clients may send
+// it to report their own state; the server fills in UserID.
+type PresenceChanged struct {
+	UserID int64  `json:"user_id,omitempty"`
+	Status string `json:"status" enum:"online,away,offline"`
+}
+
+// Typing is sent while a user is composing a message in a channel. Clients
+// send it with only ChannelID; the server fills in UserID.
+type Typing struct {
+	ChannelID int64 `json:"channel_id"`
+	UserID    int64 `json:"user_id,omitempty"`
+}
+
+// UserThrottled is sent only to a user who was muted in a channel for
+// posting too fast
+type UserThrottled struct {
+	ChannelID  int64 `json:"channel_id"`
+	UserID     int64 `json:"user_id"`
+	MutedUntil int64 `json:"muted_until"`
+	// Strikes counts the recent mutes; each one lasts longer
+	Strikes int `json:"strikes"`
+}
+
+type eventType struct {
+	schema      string
+	description string
+	inbound     bool
+	payload     reflect.Type
+	decode      func(json.RawMessage) (interface{}, error)
+}
+
+// registry lists every known type. Only inbound types may be sent by clients;
+// everything else is produced by the server.
+var registry = map[string]eventType{
+	TypeMessageCreated: {
+		schema:      SchemaMessageCreated,
+		description: "A message was posted to a channel",
+		payload:     reflect.TypeOf(MessageCreated{}),
+		decode:      decoder[MessageCreated](),
+	},
+	TypeMessageDeleted: {
+		schema:      SchemaMessageDeleted,
+		description: "A message was removed from a channel",
+		payload:     reflect.TypeOf(MessageDeleted{}),
+		decode:      decoder[MessageDeleted](),
+	},
+	TypeMessageEphemeral: {
+		schema:      SchemaMessageEphemeral,
+		description: "A message only the recipient sees, not kept in the channel",
+		payload:     reflect.TypeOf(MessageEphemeral{}),
+		decode:      decoder[MessageEphemeral](),
+	},
+	TypeChannelMemberJoined: {
+		schema:      SchemaChannelMemberJoined,
+		description: "A user joined a channel",
+		payload:     reflect.TypeOf(ChannelMemberJoined{}),
+		decode:      decoder[ChannelMemberJoined](),
+	},
+	TypeChannelMemberLeft: {
+		schema:      SchemaChannelMemberLeft,
+		description: "A user left or was removed from a channel",
+		payload:     reflect.TypeOf(ChannelMemberLeft{}),
+		decode:      decoder[ChannelMemberLeft](),
+	},
+	TypePresenceChanged: {
+		schema:      SchemaPresenceChanged,
+		description: "A user's presence changed",
+		inbound:     true,
+		payload:     reflect.TypeOf(PresenceChanged{}),
+		decode:      decoder[PresenceChanged](),
+	},
+	TypeTeamAnnouncement: {
+		schema:      SchemaTeamAnnouncement,
+		description: "An owner announced something to the whole team",
+		payload:     reflect.TypeOf(TeamAnnouncement{}),
+		decode:      decoder[TeamAnnouncement](),
+	},
+	TypeTyping: {
+		schema:      SchemaTyping,
+		description: "A user is composing a message in a channel",
+		inbound:     true,
+		payload:     reflect.TypeOf(Typing{}),
+		decode:      decoder[Typing](),
+	},
+	TypeUserThrottled: {
+		schema:      SchemaUserThrottled,
+		description: "The recipient was muted in a channel for posting too fast",
+		payload:     reflect.TypeOf(UserThrottled{}),
+		decode:      decoder[UserThrottled](),
+	},
+}
+
+func decoder[T any]() func(json.RawMessage) (interface{}, error) {
+	return func(raw json.RawMessage) (interface{}, error) {
+		var payload T
+		if err := json.Unmarshal(raw, &payload); err != nil {
+			return nil, err
+		}
+		return &payload, nil
+	}
+}
+
+// SchemaFor returns the schema identifier of an event type
+func SchemaFor(eventType string) (string, bool) {
+	t, ok := registry[eventType]
+	return t.schema, ok
+}
+
+// New builds an outbound envelope for a typed payload
+func New(eventType string, payload interface{}) (Envelope, error) {
+	t, ok := registry[eventType]
+	if !ok {
+		return Envelope{}, fmt.Errorf("unknown event type %q", eventType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to marshal %s payload: %v", eventType, err)
+	}
+	return Envelope{
+		Version:   ProtocolVersion,
+		Type:      eventType,
+		Schema:    t.schema,
+		Timestamp: time.Now().UTC().UnixMilli(),
+		Payload:   data,
+	}, nil
+}
+
+// DecodeInbound validates a frame received from a client and returns its
+// envelope and typed payload (*PresenceChanged or *Typing)
+func DecodeInbound(frame []byte) (Envelope, interface{}, error) {
+	var env Envelope
+	if len(frame) > MaxInboundFrameBytes {
+		return env, nil, fmt.Errorf("%w: frame exceeds %d bytes", ErrInvalidFrame, MaxInboundFrameBytes)
+	}
+	if err := json.Unmarshal(frame, &env); err != nil {
+		return env, nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	if env.Version < 1 || env.Version > ProtocolVersion {
+		return env, nil, fmt.Errorf("%w: unsupported protocol version %d", ErrInvalidFrame, env.Version)
+	}
+
+	t, ok := registry[env.Type]
+	if !ok || !t.inbound {
+		return env, nil, fmt.Errorf("%w: event type %q cannot be sent by clients", ErrInvalidFrame, env.Type)
+	}
+	if env.Schema != "" && env.Schema != t.schema {
+		return env, nil, fmt.Errorf("%w: schema %q does not match %s", ErrInvalidFrame, env.Schema, t.schema)
+	}
+	if len(env.Payload) == 0 {
+		return env, nil, fmt.Errorf("%w: missing payload", ErrInvalidFrame)
+	}
+
+	payload, err := t.decode(env.Payload)
+	if err != nil {
+		return env, nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	if err := validate(payload); err != nil {
+		return env, nil, fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	env.Schema = t.schema
+	return env, payload, nil
+}
+
+func validate(payload interface{}) error {
+	switch p := payload.(type) {
+	case *Typing:
+		if p.ChannelID <= 0 {
+			return errors.New("channel_id is required")
+		}
+	case *PresenceChanged:
+		switch p.Status {
+		case PresenceOnline, PresenceAway, PresenceOffline:
+		default:
+			return fmt.Errorf("unknown presence status %q", p.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package events
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// jsonSchemaDialect is the JSON Schema draft the published schemas follow
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaInfo describes one published event schema
+type SchemaInfo struct {
+	Type        string `json:"type"`
+	Schema      string `json:"schema"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	// Inbound types may also be sent by clients
+	Inbound bool `json:"inbound"`
+}
+
+// Schemas lists the schema of every event type, ordered by type
+func Schemas() []SchemaInfo {
+	infos := make([]SchemaInfo, 0, len(registry))
+	for name, t := range registry {
+		infos = append(infos, SchemaInfo{
+			Type:        name,
+			Schema:      t.schema,
+			Version:     schemaVersion(t.schema),
+			Description: t.description,
+			Inbound:     t.inbound,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Type < infos[j].Type })
+	return infos
+}
+
+// JSONSchema returns the JSON Schema of the envelope carrying the event with
+// the given schema identifier. Payloads may gain optional fields within a
+// version, so payload schemas allow additional properties.
+func JSONSchema(schema string) (map[string]interface{}, bool) {
+	for name, t := range registry {
+		if t.schema != schema {
+			continue
+		}
+		return map[string]interface{}{
+			"$schema":     jsonSchemaDialect,
+			"$id":         "urn:eaven:event-schema:" + t.schema,
+			"title":       t.schema,
+			"description": t.description,
+			"type":        "object",
+			"properties": map[string]interface{}{
+				"v":       map[string]interface{}{"type": "integer", "minimum": 1, "maximum": ProtocolVersion},
+				"type":    map[string]interface{}{"const": name},
+				"schema":  map[string]interface{}{"const": t.schema},
+				"ts":      map[string]interface{}{"type": "integer", "description": "Unix time in milliseconds"},
+				"payload": typeSchema(t.payload),
+			},
+			"required": []string{"v", "type", "schema", "ts", "payload"},
+		}, true
+	}
+	return nil, false
+}
+
+// schemaVersion reads the trailing .vN of a schema identifier
+func schemaVersion(schema string) int {
+	i := strings.LastIndex(schema, ".v")
+	if i < 0 {
+		return 0
+	}
+	version := 0
+	for _, c := range schema[i+2:] {
+		if c < '0' || c > '9' {
+			return 0
+		}
+		version = version*10 + int(c-'0')
+	}
+	return version
+}
+
+// typeSchema describes a Go type the way encoding/json marshals it
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			prop := typeSchema(f.Type)
+			if enum := f.Tag.Get("enum"); enum != "" {
+				prop["enum"] = strings.Split(enum, ",")
+			}
+			properties[name] = prop
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": true,
+		}
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,179 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/limits"
+)
+
+// Export formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// ErrInvalidFormat is returned for formats other than json and csv
+var ErrInvalidFormat = errors.New("format must be json or csv")
+
+// ContentType returns the media type of an export format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// Message is one exported message
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	UserID    int64  `json:"user_id"`
+	Author    string `json:"author"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+	ReplyToID int64  `json:"reply_to_id,omitempty"`
+}
+
+// Channel describes the exported channel
+type Channel struct {
+	ChannelID   int64  `json:"channel_id"`
+	TeamID      int64  `json:"team_id"`
+	Name        string `json:"channel_name"`
+	Description string `json:"description"`
+	ExportedAt  string `json:"exported_at"`
+}
+
+// Write streams a channel's full message history to w, oldest first, and
+// returns the number of messages written. Rows are encoded as they are read,
+// so memory use does not grow with the channel.
+func Write(ctx context.Context, db *sql.DB, w io.Writer, channelID int64, format string) (int64, error) {
+	if format != FormatJSON && format != FormatCSV {
+		return 0, ErrInvalidFormat
+	}
+
+	ch := Channel{ChannelID: channelID, ExportedAt: time.Now().UTC().Format(time.RFC3339)}
+	err := db.QueryRowContext(ctx, `SELECT team_id, channel_name, description FROM channels WHERE channel_id = ?`, channelID).
+		Scan(&ch.TeamID, &ch.Name, &ch.Description)
+	if err != nil {
+		return 0, err
+	}
+
+	// Exports include only the history the team's plan keeps
+	cutoff, err := limits.HistoryCutoff(ctx, db, ch.TeamID, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	enc := newEncoder(w, format)
+	if err := enc.begin(ch); err != nil {
+		return 0, err
+	}
+	// Archived messages come first, being the oldest
+	n, err := history.Each(ctx, db, false, 0, `
+		SELECT m.message_id, m.user_id, COALESCE(CONCAT_WS(' ', u.first_name, u.last_name), ''), m.content, m.message_created_at, m.reply_to_id
+		FROM {messages} m
+		LEFT JOIN users u ON u.user_id = m.user_id
+		WHERE m.channel_id = ? AND m.message_created_at >= ?
+		ORDER BY m.message_id`, []interface{}{channelID, cutoff}, func(rows *sql.Rows) error {
+		var m Message
+		var createdAt int64
+		if err := rows.Scan(&m.MessageID, &m.UserID, &m.Author, &m.Content, &createdAt, &m.ReplyToID); err != nil {
+			return err
+		}
+		m.CreatedAt = time.Unix(createdAt, 0).UTC().Format(time.RFC3339)
+		return enc.message(m)
+	})
+	if err != nil {
+		return int64(n), err
+	}
+	return int64(n), enc.end()
+}
+
+type encoder interface {
+	begin(ch Channel) error
+	message(m Message) error
+	end() error
+}
+
+func newEncoder(w io.Writer, format string) encoder {
+	if format == FormatCSV {
+		return &csvEncoder{w: csv.NewWriter(w)}
+	}
+	return &jsonEncoder{w: w}
+}
+
+// jsonEncoder writes {"channel": {...}, "messages": [...]} one message at a
+// time
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) begin(ch Channel) error {
+	header, err := json.Marshal(ch)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, `{"channel":%s,"messages":[`, header)
+	return err
+}
+
+func (e *jsonEncoder) message(m Message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonEncoder) end() error {
+	_, err := io.WriteString(e.w, "]}\n")
+	return err
+}
+
+type csvEncoder struct {
+	w     *csv.Writer
+	count int
+}
+
+func (e *csvEncoder) begin(ch Channel) error {
+	return e.w.Write([]string{"message_id", "created_at", "user_id", "author", "content", "reply_to_id"})
+}
+
+func (e *csvEncoder) message(m Message) error {
+	err := e.w.Write([]string{
+		strconv.FormatInt(m.MessageID, 10),
+		m.CreatedAt,
+		strconv.FormatInt(m.UserID, 10),
+		m.Author,
+		m.Content,
+		strconv.FormatInt(m.ReplyToID, 10),
+	})
+	// Flush regularly so the response streams instead of buffering
+	e.count++
+	if err == nil && e.count%500 == 0 {
+		e.w.Flush()
+		err = e.w.Error()
+	}
+	return err
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
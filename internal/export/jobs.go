@@ -0,0 +1,350 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/mailer"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// Export job statuses
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+const (
+	// jobTimeout bounds how long a background export may run
+	jobTimeout = 30 * time.Minute
+	// claimTTL is how long a claimed job is left to its worker. It outlives
+	// jobTimeout, so only the jobs of workers that died are claimed again.
+	claimTTL = jobTimeout + 5*time.Minute
+	// maxAttempts is how many times a job is claimed before it is failed
+	maxAttempts = 3
+	// reuseWindow is how long a ready export is handed out again instead of
+	// generating a new one
+	reuseWindow = time.Hour
+
+	pollInterval = 15 * time.Second
+	batchSize    = 5
+)
+
+// ErrJobNotFound is returned when a channel has no export with the given ID
+var ErrJobNotFound = errors.New("export not found")
+
+// Job is a background export of a channel
+type Job struct {
+	ExportID     int64  `json:"export_id"`
+	ChannelID    int64  `json:"channel_id"`
+	RequestedBy  int64  `json:"requested_by"`
+	Format       string `json:"format"`
+	Status       string `json:"status"`
+	SizeBytes    int64  `json:"size_bytes"`
+	MessageCount int64  `json:"message_count"`
+	Error        string `json:"error,omitempty"`
+	CreatedAt    int64  `json:"created_at"`
+	CompletedAt  int64  `json:"completed_at,omitempty"`
+	DownloadURL  string `json:"download_url,omitempty"`
+	storageKey   string
+}
+
+// ExportReadyEmail is the data of the channel_export_ready template
+type ExportReadyEmail struct {
+	FirstName    string
+	ChannelName  string
+	Format       string
+	MessageCount int64
+	DownloadURL  string
+}
+
+// Exporter generates the exports too large to stream in a request
+type Exporter struct {
+	DB      *sql.DB
+	Storage storage.Storage
+	Log     *logger.Logger
+	// SyncLimit is the largest channel, in messages, exported in the request
+	SyncLimit int64
+}
+
+// NewExporter returns an exporter writing to the default storage. Channels of
+// up to EXPORT_SYNC_MAX_MESSAGES messages (default 5000) are streamed in the
+// request.
+func NewExporter(db *sql.DB) *Exporter {
+	limit := int64(5000)
+	if v, err := strconv.ParseInt(os.Getenv("EXPORT_SYNC_MAX_MESSAGES"), 10, 64); err == nil && v >= 0 {
+		limit = v
+	}
+	return &Exporter{
+		DB:        db,
+		Storage:   storage.Default(),
+		Log:       logger.NewLogger("channel-export"),
+		SyncLimit: limit,
+	}
+}
+
+// DownloadPath is the API path an export is downloaded from
+func DownloadPath(channelID, exportID int64) string {
+	return fmt.Sprintf("/channel/%d/exports/%d/download", channelID, exportID)
+}
+
+// Fits reports whether a channel is small enough to export in the request
+func (e *Exporter) Fits(ctx context.Context, channelID int64) (bool, error) {
+	var count int64
+	query, args := history.Union(`SELECT COUNT(*) AS n FROM {messages} WHERE channel_id = ?`, channelID)
+	err := e.DB.QueryRowContext(ctx, `SELECT SUM(n) FROM (`+query+`) counts`, args...).Scan(&count)
+	return count <= e.SyncLimit, err
+}
+
+// Enqueue records an export for the workers to generate. The requester is
+// emailed a download link when it is ready. A pending export of the channel
+// in the same format, or one made within the last hour, is returned instead
+// of starting another, with created false.
+func (e *Exporter) Enqueue(ctx context.Context, channelID, userID int64, format string) (Job, bool, error) {
+	if format != FormatJSON && format != FormatCSV {
+		return Job{}, false, ErrInvalidFormat
+	}
+	now := time.Now()
+	existing, err := e.find(ctx, channelID, format, now.Add(-reuseWindow))
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, ErrJobNotFound) {
+		return Job{}, false, err
+	}
+
+	job := Job{
+		ChannelID:   channelID,
+		RequestedBy: userID,
+		Format:      format,
+		Status:      StatusPending,
+		CreatedAt:   now.Unix(),
+	}
+	result, err := e.DB.ExecContext(ctx, `
+		INSERT INTO channel_exports (channel_id, requested_by, format, status, created_at)
+		VALUES (?, ?, ?, ?, ?)`, job.ChannelID, job.RequestedBy, job.Format, job.Status, job.CreatedAt)
+	if err != nil {
+		return Job{}, false, err
+	}
+	if job.ExportID, err = result.LastInsertId(); err != nil {
+		return Job{}, false, err
+	}
+	Notify()
+	return job, true, nil
+}
+
+// find returns the newest pending export of a channel in a format, or a ready
+// one completed since readySince
+func (e *Exporter) find(ctx context.Context, channelID int64, format string, readySince time.Time) (Job, error) {
+	var exportID int64
+	err := e.DB.QueryRowContext(ctx, `
+		SELECT export_id FROM channel_exports
+		WHERE channel_id = ? AND format = ? AND (status = ? OR (status = ? AND completed_at >= ?))
+		ORDER BY export_id DESC
+		LIMIT 1`, channelID, format, StatusPending, StatusReady, readySince.Unix()).Scan(&exportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return e.Get(ctx, channelID, exportID)
+}
+
+// Get returns an export of a channel, or ErrJobNotFound
+func (e *Exporter) Get(ctx context.Context, channelID, exportID int64) (Job, error) {
+	var job Job
+	err := e.DB.QueryRowContext(ctx, `
+		SELECT export_id, channel_id, requested_by, format, status, storage_key, size_bytes, message_count, error, created_at, completed_at
+		FROM channel_exports
+		WHERE export_id = ? AND channel_id = ?`, exportID, channelID).
+		Scan(&job.ExportID, &job.ChannelID, &job.RequestedBy, &job.Format, &job.Status, &job.storageKey,
+			&job.SizeBytes, &job.MessageCount, &job.Error, &job.CreatedAt, &job.CompletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status == StatusReady {
+		job.DownloadURL = DownloadPath(job.ChannelID, job.ExportID)
+	}
+	return job, nil
+}
+
+// Open opens the file of a ready export
+func (e *Exporter) Open(ctx context.Context, job Job) (storage.Object, error) {
+	if job.Status != StatusReady {
+		return nil, ErrJobNotFound
+	}
+	return e.Storage.Open(ctx, job.storageKey)
+}
+
+// wake lets requests in this process start an export without waiting for
+// the next poll
+var wake = make(chan struct{}, 1)
+
+// Notify tells this process's worker that an export is waiting
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start launches the export worker, which generates the pending background
+// exports
+func Start() {
+	e := NewExporter(database.DB)
+	go e.run()
+}
+
+func (e *Exporter) run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+		for {
+			n, err := e.ProcessPending(context.Background(), time.Now().UTC())
+			if err != nil {
+				e.Log.Error("Failed to process channel exports", "error", err)
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+	}
+}
+
+// ProcessPending generates up to batchSize pending exports that no live
+// worker holds and returns how many it claimed. Jobs whose worker died
+// maxAttempts times are failed instead.
+func (e *Exporter) ProcessPending(ctx context.Context, now time.Time) (int, error) {
+	stale := now.Add(-claimTTL).Unix()
+	rows, err := e.DB.QueryContext(ctx, `
+		SELECT export_id, channel_id, requested_by, format, created_at, attempts
+		FROM channel_exports
+		WHERE status = ? AND claimed_at < ?
+		ORDER BY export_id
+		LIMIT ?`, StatusPending, stale, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		job      Job
+		attempts int
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		p.job.Status = StatusPending
+		if err := rows.Scan(&p.job.ExportID, &p.job.ChannelID, &p.job.RequestedBy, &p.job.Format, &p.job.CreatedAt, &p.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	claimed := 0
+	for _, p := range batch {
+		if p.attempts >= maxAttempts {
+			if _, err := e.DB.ExecContext(ctx, `
+				UPDATE channel_exports SET status = ?, error = ?, completed_at = ?
+				WHERE export_id = ? AND status = ? AND claimed_at < ?`,
+				StatusFailed, "Export did not finish", now.Unix(), p.job.ExportID, StatusPending, stale); err != nil {
+				return claimed, err
+			}
+			e.Log.Warn("Channel export abandoned", "export_id", p.job.ExportID, "attempts", p.attempts)
+			continue
+		}
+
+		// Claim the job so concurrent workers generate it once
+		claim, err := e.DB.ExecContext(ctx, `
+			UPDATE channel_exports SET claimed_at = ?, attempts = attempts + 1
+			WHERE export_id = ? AND status = ? AND claimed_at < ?`,
+			now.Unix(), p.job.ExportID, StatusPending, stale)
+		if err != nil {
+			return claimed, err
+		}
+		if n, err := claim.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		claimed++
+		e.generate(ctx, p.job)
+	}
+	return claimed, nil
+}
+
+func (e *Exporter) generate(ctx context.Context, job Job) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	log := e.Log.WithContext(ctx)
+
+	key := storage.NewKey()
+	pr, pw := io.Pipe()
+	written := make(chan int64, 1)
+	go func() {
+		n, err := Write(ctx, e.DB, pw, job.ChannelID, job.Format)
+		written <- n
+		pw.CloseWithError(err)
+	}()
+	size, err := e.Storage.Put(ctx, key, pr)
+	pr.CloseWithError(err)
+	count := <-written
+
+	if err != nil {
+		log.Error("Channel export failed", "error", err, "export_id", job.ExportID, "channel_id", job.ChannelID)
+		e.Storage.Delete(context.Background(), key)
+		if _, err := e.DB.ExecContext(context.Background(), `
+			UPDATE channel_exports SET status = ?, error = ?, completed_at = ? WHERE export_id = ?`,
+			StatusFailed, "Export failed", time.Now().Unix(), job.ExportID); err != nil {
+			log.Error("Failed to record export failure", "error", err, "export_id", job.ExportID)
+		}
+		return
+	}
+
+	_, err = e.DB.ExecContext(ctx, `
+		UPDATE channel_exports SET status = ?, storage_key = ?, size_bytes = ?, message_count = ?, completed_at = ?
+		WHERE export_id = ?`, StatusReady, key, size, count, time.Now().Unix(), job.ExportID)
+	if err != nil {
+		log.Error("Failed to record finished export", "error", err, "export_id", job.ExportID)
+		e.Storage.Delete(context.Background(), key)
+		return
+	}
+	log.Info("Channel export ready", "export_id", job.ExportID, "channel_id", job.ChannelID, "messages", count, "size_bytes", size)
+
+	var to string
+	email := ExportReadyEmail{
+		Format:       job.Format,
+		MessageCount: count,
+		DownloadURL:  mailer.Link(DownloadPath(job.ChannelID, job.ExportID)),
+	}
+	err = e.DB.QueryRowContext(ctx, `
+		SELECT u.email, u.first_name, c.channel_name
+		FROM users u, channels c
+		WHERE u.user_id = ? AND c.channel_id = ?`, job.RequestedBy, job.ChannelID).
+		Scan(&to, &email.FirstName, &email.ChannelName)
+	if err == nil {
+		err = mailer.SendTemplate(to, "channel_export_ready", email)
+	}
+	if err != nil {
+		log.Error("Failed to email export link", "error", err, "export_id", job.ExportID)
+	}
+}
@@ -0,0 +1,131 @@
+package fanout
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// Delivery is who a stored message has to reach. Both lists are sorted by
+// user ID.
+type Delivery struct {
+	MessageID  int64
+	ChannelID  int64
+	Recipients []int64
+	Mentioned  []int64
+}
+
+// broadcastMentions notify every member of the channel
+var broadcastMentions = []string{"@channel", "@here"}
+
+// Plan works out the delivery of a stored message: every channel member
+// except the sender receives it, and the members whose @handle it contains,
+// or all of them for a broadcast mention, are mentioned. Handles changed
+// within their redirect grace period still mention their user.
+func Plan(ctx context.Context, db *sql.DB, msg models.MessageBody) (Delivery, error) {
+	oldHandles, err := redirectedHandles(ctx, db, msg)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.user_id, u.handle
+		FROM channel_members cm
+		INNER JOIN users u ON u.user_id = cm.user_id
+		WHERE cm.channel_id = ? AND cm.user_id <> ?
+		ORDER BY u.user_id`, msg.ChannelID, msg.UserID)
+	if err != nil {
+		return Delivery{}, err
+	}
+	defer rows.Close()
+
+	text := strings.ToLower(msg.Content)
+	broadcast := false
+	for _, m := range broadcastMentions {
+		if strings.Contains(text, m) {
+			broadcast = true
+			break
+		}
+	}
+
+	d := Delivery{MessageID: msg.MessageID, ChannelID: msg.ChannelID}
+	for rows.Next() {
+		var userID int64
+		var handle string
+		if err := rows.Scan(&userID, &handle); err != nil {
+			return Delivery{}, err
+		}
+		d.Recipients = append(d.Recipients, userID)
+		if broadcast || mentions(text, handle) || mentionsAny(text, oldHandles[userID]) {
+			d.Mentioned = append(d.Mentioned, userID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Delivery{}, err
+	}
+	sort.Slice(d.Recipients, func(i, j int) bool { return d.Recipients[i] < d.Recipients[j] })
+	sort.Slice(d.Mentioned, func(i, j int) bool { return d.Mentioned[i] < d.Mentioned[j] })
+	return d, nil
+}
+
+// redirectedHandles returns, per channel member, the old handles that were
+// still redirecting when the message was sent
+func redirectedHandles(ctx context.Context, db *sql.DB, msg models.MessageBody) (map[int64][]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT hr.user_id, hr.handle
+		FROM handle_redirects hr
+		INNER JOIN channel_members cm ON cm.user_id = hr.user_id
+		WHERE cm.channel_id = ? AND hr.expires_at > ?`, msg.ChannelID, msg.MessageTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	old := make(map[int64][]string)
+	for rows.Next() {
+		var userID int64
+		var handle string
+		if err := rows.Scan(&userID, &handle); err != nil {
+			return nil, err
+		}
+		old[userID] = append(old[userID], handle)
+	}
+	return old, rows.Err()
+}
+
+// mentions reports whether lowercased text contains @handle
+func mentions(text, handle string) bool {
+	return handle != "" && strings.Contains(text, "@"+strings.ToLower(handle))
+}
+
+func mentionsAny(text string, handles []string) bool {
+	for _, h := range handles {
+		if mentions(text, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the IDs only in want and the IDs only in got. Both inputs must
+// be sorted.
+func Diff(want, got []int64) (missing, extra []int64) {
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case j == len(got) || (i < len(want) && want[i] < got[j]):
+			missing = append(missing, want[i])
+			i++
+		case i == len(want) || got[j] < want[i]:
+			extra = append(extra, got[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return missing, extra
+}
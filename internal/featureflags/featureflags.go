@@ -0,0 +1,233 @@
+// Package featureflags turns features on and off at runtime, for every team
+// or team by team, so they can be rolled out progressively.
+//
+// A flag's state for a team is, from weakest to strongest: its built-in
+// default, the FEATURE_<NAME> environment variable (true or false), the
+// flag's deployment-wide setting and the team's own setting. The settings
+// are stored in feature_flags and changed through the admin API.
+package featureflags
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// Feature flags checked by the server
+const (
+	GiphyMessages     = "giphy_messages"
+	EncryptedMessages = "encrypted_messages"
+	LinkPreviews      = "link_previews"
+)
+
+// Flag is a feature that can be turned on and off
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+// Known lists every flag. Flags of features still rolling out default to
+// off.
+var Known = []Flag{
+	{Name: GiphyMessages, Description: "Post GIFs from Giphy as messages", Default: true},
+	{Name: EncryptedMessages, Description: "Send end-to-end encrypted messages in private channels", Default: true},
+	{Name: LinkPreviews, Description: "Generate previews of links posted in messages", Default: true},
+}
+
+// ErrUnknownFlag is returned when setting a flag that is not in Known
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// DisabledError is returned when a team uses a feature turned off for it
+type DisabledError struct {
+	Flag string
+}
+
+func (e *DisabledError) Error() string {
+	return fmt.Sprintf("the %s feature is not enabled for this team", e.Flag)
+}
+
+// Body is the JSON error response for the error
+func (e *DisabledError) Body() map[string]interface{} {
+	return map[string]interface{}{"error": e.Error(), "code": "feature_disabled", "flag": e.Flag}
+}
+
+func lookup(name string) (Flag, bool) {
+	for _, f := range Known {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+// Default returns a flag's state before any setting: FEATURE_<NAME> when
+// it is set, the built-in default otherwise
+func Default(name string) bool {
+	f, _ := lookup(name)
+	if v, err := strconv.ParseBool(os.Getenv("FEATURE_" + strings.ToUpper(name))); err == nil {
+		return v
+	}
+	return f.Default
+}
+
+// settingsTTL bounds how long another process may apply old settings
+const settingsTTL = 30 * time.Second
+
+// settings caches the whole feature_flags table, keyed by flag and then by
+// team; team 0 holds the deployment-wide setting
+var settings struct {
+	sync.Mutex
+	loadedAt time.Time
+	rows     map[string]map[int64]bool
+}
+
+func loadSettings(ctx context.Context) (map[string]map[int64]bool, error) {
+	settings.Lock()
+	defer settings.Unlock()
+	if settings.rows != nil && time.Since(settings.loadedAt) <= settingsTTL {
+		return settings.rows, nil
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `SELECT flag, team_id, enabled FROM feature_flags`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := make(map[string]map[int64]bool)
+	for rows.Next() {
+		var flag string
+		var teamID int64
+		var enabled bool
+		if err := rows.Scan(&flag, &teamID, &enabled); err != nil {
+			return nil, err
+		}
+		if loaded[flag] == nil {
+			loaded[flag] = make(map[int64]bool)
+		}
+		loaded[flag][teamID] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	settings.rows = loaded
+	settings.loadedAt = time.Now()
+	return loaded, nil
+}
+
+func resolve(rows map[string]map[int64]bool, name string, teamID int64) bool {
+	if v, ok := rows[name][teamID]; ok && teamID != 0 {
+		return v
+	}
+	if v, ok := rows[name][0]; ok {
+		return v
+	}
+	return Default(name)
+}
+
+// Enabled reports whether a flag is on for a team
+func Enabled(ctx context.Context, teamID int64, name string) (bool, error) {
+	rows, err := loadSettings(ctx)
+	if err != nil {
+		return false, err
+	}
+	return resolve(rows, name, teamID), nil
+}
+
+// Require fails with a *DisabledError when a flag is off for a team
+func Require(ctx context.Context, teamID int64, name string) error {
+	on, err := Enabled(ctx, teamID, name)
+	if err != nil {
+		return err
+	}
+	if !on {
+		return &DisabledError{Flag: name}
+	}
+	return nil
+}
+
+// ForTeam returns the state of every flag for a team
+func ForTeam(ctx context.Context, teamID int64) (map[string]bool, error) {
+	rows, err := loadSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flags := make(map[string]bool, len(Known))
+	for _, f := range Known {
+		flags[f.Name] = resolve(rows, f.Name, teamID)
+	}
+	return flags, nil
+}
+
+// State is a flag with its settings. Default includes FEATURE_<NAME>;
+// Global is nil when the flag has no deployment-wide setting, and Teams
+// lists the teams with their own.
+type State struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Default     bool           `json:"default"`
+	Global      *bool          `json:"global"`
+	Teams       map[int64]bool `json:"teams"`
+}
+
+// List returns every flag with its settings
+func List(ctx context.Context) ([]State, error) {
+	rows, err := loadSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]State, 0, len(Known))
+	for _, f := range Known {
+		s := State{Name: f.Name, Description: f.Description, Default: Default(f.Name), Teams: make(map[int64]bool)}
+		for teamID, enabled := range rows[f.Name] {
+			if teamID == 0 {
+				v := enabled
+				s.Global = &v
+				continue
+			}
+			s.Teams[teamID] = enabled
+		}
+		states = append(states, s)
+	}
+	return states, nil
+}
+
+// Reload drops the cached settings, so the next check reads them again
+// along with FEATURE_<NAME>
+func Reload() {
+	settings.Lock()
+	settings.rows = nil
+	settings.Unlock()
+}
+
+// Set turns a flag on or off for a team, or for every team without a
+// setting of its own when teamID is 0. A nil enabled removes the setting,
+// so the flag inherits again.
+func Set(ctx context.Context, db *sql.DB, name string, teamID int64, enabled *bool) error {
+	if _, ok := lookup(name); !ok {
+		return ErrUnknownFlag
+	}
+	var err error
+	if enabled == nil {
+		_, err = db.ExecContext(ctx, `DELETE FROM feature_flags WHERE flag = ? AND team_id = ?`, name, teamID)
+	} else {
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO feature_flags (flag, team_id, enabled, updated_at) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE enabled = VALUES(enabled), updated_at = VALUES(updated_at)`,
+			name, teamID, *enabled, time.Now().UTC().Unix())
+	}
+	if err != nil {
+		return err
+	}
+	Reload()
+	return nil
+}
@@ -0,0 +1,212 @@
+package fieldcrypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// prefix marks encrypted values. Values without it are legacy plaintext and
+// are returned as they are, so columns can be encrypted gradually.
+const prefix = "enc:"
+
+// ErrUndecryptable is returned for encrypted values whose key is unknown or
+// whose ciphertext does not authenticate
+var ErrUndecryptable = errors.New("field cannot be decrypted")
+
+// Keyring holds the AES-256 keys by ID. Active encrypts new values; every
+// key decrypts, so old keys stay listed until rotation has rewritten their
+// values.
+type Keyring struct {
+	Active string
+	keys   map[string]cipher.AEAD
+}
+
+var (
+	ringOnce sync.Once
+	ring     *Keyring
+	ringErr  error
+)
+
+// Init loads the keyring from FIELD_ENCRYPTION_KEYS, a comma-separated list
+// of id:base64key entries, or from the file named by
+// FIELD_ENCRYPTION_KEYS_FILE with one entry per line, as written by a KMS
+// or secrets manager agent. The first entry is the active key. Without
+// either, values are stored in plaintext.
+func Init() error {
+	ringOnce.Do(func() {
+		entries := strings.Split(os.Getenv("FIELD_ENCRYPTION_KEYS"), ",")
+		if path := os.Getenv("FIELD_ENCRYPTION_KEYS_FILE"); path != "" {
+			entries, ringErr = readKeyFile(path)
+			if ringErr != nil {
+				return
+			}
+		}
+		ring, ringErr = ParseKeyring(entries)
+	})
+	return ringErr
+}
+
+// ParseKeyring builds a keyring from id:base64key entries, the first being
+// the active key. Blank entries are skipped; no entries give a nil keyring.
+func ParseKeyring(entries []string) (*Keyring, error) {
+	var k *Keyring
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || !validKeyID(id) {
+			return nil, fmt.Errorf("fieldcrypt: key entries must look like id:base64key with an id of 1 to 16 letters, digits, '-' or '_'")
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("fieldcrypt: key %s must be 32 bytes of standard base64", id)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			k = &Keyring{Active: id, keys: make(map[string]cipher.AEAD)}
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("fieldcrypt: key %s is listed twice", id)
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// Default returns the keyring loaded by Init, or nil when encryption is off
+func Default() *Keyring {
+	Init()
+	return ring
+}
+
+// Seal encrypts a value with the active key. The empty string stays empty
+// so "not set" remains queryable, and a nil keyring stores plaintext.
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	if k == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	aead := k.keys[k.Active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	// The key ID is authenticated so a value cannot be relabelled
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.Active))
+	return prefix + k.Active + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a stored value. Plaintext values are returned unchanged.
+func (k *Keyring) Open(stored string) (string, error) {
+	if !strings.HasPrefix(stored, prefix) {
+		return stored, nil
+	}
+	id, encoded, ok := strings.Cut(stored[len(prefix):], ":")
+	if !ok || k == nil {
+		return "", ErrUndecryptable
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown key %s", ErrUndecryptable, id)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrUndecryptable
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", ErrUndecryptable
+	}
+	return string(plaintext), nil
+}
+
+// Current reports whether a stored value is already in its final form:
+// encrypted with the active key, or empty. Rotation rewrites the others.
+func (k *Keyring) Current(stored string) bool {
+	if stored == "" {
+		return true
+	}
+	if k == nil {
+		return !strings.HasPrefix(stored, prefix)
+	}
+	return strings.HasPrefix(stored, prefix+k.Active+":")
+}
+
+// String is a column value encrypted at rest with the default keyring. Pass
+// String(v) as a query argument to store v encrypted and scan into
+// (*String)(&v) to read it back decrypted.
+type String string
+
+// Value implements driver.Valuer
+func (s String) Value() (driver.Value, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+	return ring.Seal(string(s))
+}
+
+// Scan implements sql.Scanner
+func (s *String) Scan(src interface{}) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("fieldcrypt: cannot scan %T", src)
+	}
+	if err := Init(); err != nil {
+		return err
+	}
+	plaintext, err := ring.Open(stored)
+	if err != nil {
+		return err
+	}
+	*s = String(plaintext)
+	return nil
+}
+
+func readKeyFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: %v", err)
+	}
+	defer f.Close()
+	var entries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	return entries, scanner.Err()
+}
+
+func validKeyID(id string) bool {
+	if id == "" || len(id) > 16 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
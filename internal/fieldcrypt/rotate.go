@@ -0,0 +1,90 @@
+package fieldcrypt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Column is an encrypted column and the integer primary key of its table
+type Column struct {
+	Table string
+	Key   string
+	Name  string
+}
+
+// Columns lists every column stored through String
+var Columns = []Column{
+	{Table: "users", Key: "user_id", Name: "contact_number"},
+	{Table: "attachments", Key: "attachment_id", Name: "file_name"},
+}
+
+// rotateBatch bounds the rows read per query during rotation
+const rotateBatch = 500
+
+// Rotate rewrites every value of a column that is plaintext or encrypted
+// with a key other than the active one, and returns how many it rewrote.
+// Rows are walked by primary key in batches and each update is guarded by
+// the value it replaces, so rotation can run while the server is serving and
+// can be restarted after an interruption.
+func Rotate(ctx context.Context, db *sql.DB, k *Keyring, col Column) (int, error) {
+	if k == nil {
+		return 0, fmt.Errorf("fieldcrypt: no keys are configured")
+	}
+	selectQuery := fmt.Sprintf(`SELECT %[2]s, %[3]s FROM %[1]s WHERE %[2]s > ? ORDER BY %[2]s LIMIT ?`, col.Table, col.Key, col.Name)
+	updateQuery := fmt.Sprintf(`UPDATE %[1]s SET %[3]s = ? WHERE %[2]s = ? AND %[3]s = ?`, col.Table, col.Key, col.Name)
+
+	type row struct {
+		id     int64
+		stored string
+	}
+	rewritten := 0
+	var after int64
+	for {
+		rows, err := db.QueryContext(ctx, selectQuery, after, rotateBatch)
+		if err != nil {
+			return rewritten, err
+		}
+		var batch []row
+		for rows.Next() {
+			var r row
+			var stored sql.NullString
+			if err := rows.Scan(&r.id, &stored); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			r.stored = stored.String
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewritten, err
+		}
+
+		for _, r := range batch {
+			if k.Current(r.stored) {
+				continue
+			}
+			plaintext, err := k.Open(r.stored)
+			if err != nil {
+				return rewritten, fmt.Errorf("%s.%s of %s %d: %w", col.Table, col.Name, col.Key, r.id, err)
+			}
+			sealed, err := k.Seal(plaintext)
+			if err != nil {
+				return rewritten, err
+			}
+			result, err := db.ExecContext(ctx, updateQuery, sealed, r.id, r.stored)
+			if err != nil {
+				return rewritten, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				rewritten++
+			}
+		}
+
+		if len(batch) < rotateBatch {
+			return rewritten, nil
+		}
+		after = batch[len(batch)-1].id
+	}
+}
@@ -0,0 +1,150 @@
+package floodcontrol
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/outbox"
+)
+
+// Config controls flood control
+type Config struct {
+	// MaxMessages is how many messages a user may post to one channel within
+	// Window; 0 disables flood control
+	MaxMessages int
+	Window      time.Duration
+	// BaseMute is the length of the first mute. Each further strike within
+	// StrikeReset doubles it, up to MaxMute.
+	BaseMute    time.Duration
+	MaxMute     time.Duration
+	StrikeReset time.Duration
+}
+
+// Verdict is the outcome of checking a message against flood control
+type Verdict struct {
+	Muted      bool
+	MutedUntil int64
+	Strikes    int
+}
+
+// RetryAfter is how many seconds the user has to wait before posting again
+func (v Verdict) RetryAfter(now time.Time) int64 {
+	return max(v.MutedUntil-now.Unix(), 1)
+}
+
+var config atomic.Pointer[Config]
+
+// LoadConfig returns the settings read from the environment on first use or
+// by the last Reload
+func LoadConfig() Config {
+	if c := config.Load(); c != nil {
+		return *c
+	}
+	return Reload()
+}
+
+// Reload reads the settings from the environment: FLOOD_MAX_MESSAGES
+// (default 10), FLOOD_WINDOW_SECONDS (default 10), FLOOD_MUTE_SECONDS
+// (default 30), FLOOD_MAX_MUTE_SECONDS (default 3600) and
+// FLOOD_STRIKE_RESET_SECONDS (default 3600)
+func Reload() Config {
+	c := Config{
+		MaxMessages: envInt("FLOOD_MAX_MESSAGES", 10),
+		Window:      time.Duration(envInt("FLOOD_WINDOW_SECONDS", 10)) * time.Second,
+		BaseMute:    time.Duration(envInt("FLOOD_MUTE_SECONDS", 30)) * time.Second,
+		MaxMute:     time.Duration(envInt("FLOOD_MAX_MUTE_SECONDS", 3600)) * time.Second,
+		StrikeReset: time.Duration(envInt("FLOOD_STRIKE_RESET_SECONDS", 3600)) * time.Second,
+	}
+	config.Store(&c)
+	return c
+}
+
+// Check decides whether a user may post another message to a channel, using
+// the deployment config
+func Check(ctx context.Context, db *sql.DB, channelID, userID int64, now time.Time) (Verdict, error) {
+	return CheckWith(ctx, db, LoadConfig(), channelID, userID, now)
+}
+
+// CheckWith decides whether a user may post another message to a channel.
+// Users who already posted the maximum within the window get a strike and
+// are muted; the mute grows with each strike and the user is told through
+// an event addressed only to them. Messages from muted users are refused
+// until the mute ends.
+func CheckWith(ctx context.Context, db *sql.DB, cfg Config, channelID, userID int64, now time.Time) (Verdict, error) {
+	if cfg.MaxMessages <= 0 || cfg.Window <= 0 {
+		return Verdict{}, nil
+	}
+
+	var v Verdict
+	var lastStrikeAt int64
+	query := `SELECT strikes, muted_until, last_strike_at FROM channel_flood_mutes WHERE channel_id = ? AND user_id = ?`
+	err := db.QueryRowContext(ctx, query, channelID, userID).Scan(&v.Strikes, &v.MutedUntil, &lastStrikeAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Verdict{}, err
+	}
+	if v.MutedUntil > now.Unix() {
+		v.Muted = true
+		return v, nil
+	}
+
+	var recent int
+	query = `SELECT COUNT(*) FROM messages WHERE channel_id = ? AND user_id = ? AND message_created_at > ?`
+	err = db.QueryRowContext(ctx, query, channelID, userID, now.Add(-cfg.Window).Unix()).Scan(&recent)
+	if err != nil {
+		return Verdict{}, err
+	}
+	if recent < cfg.MaxMessages {
+		return Verdict{Strikes: v.Strikes}, nil
+	}
+
+	if now.Sub(time.Unix(lastStrikeAt, 0)) > cfg.StrikeReset {
+		v.Strikes = 0
+	}
+	v.Strikes++
+	v.Muted = true
+	v.MutedUntil = now.Add(muteFor(cfg, v.Strikes)).Unix()
+
+	query = `
+		INSERT INTO channel_flood_mutes (channel_id, user_id, strikes, muted_until, last_strike_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE strikes = VALUES(strikes), muted_until = VALUES(muted_until), last_strike_at = VALUES(last_strike_at)
+	`
+	if _, err := db.ExecContext(ctx, query, channelID, userID, v.Strikes, v.MutedUntil, now.Unix()); err != nil {
+		return Verdict{}, err
+	}
+
+	err = outbox.WriteTo(ctx, db, channelID, userID, events.TypeUserThrottled, events.UserThrottled{
+		ChannelID:  channelID,
+		UserID:     userID,
+		MutedUntil: v.MutedUntil,
+		Strikes:    v.Strikes,
+	})
+	if err != nil {
+		// The mute is in place; the response still tells the sender
+		return v, err
+	}
+	outbox.Notify()
+	return v, nil
+}
+
+// muteFor doubles the base mute for every strike after the first
+func muteFor(cfg Config, strikes int) time.Duration {
+	mute := cfg.BaseMute
+	for i := 1; i < strikes && mute < cfg.MaxMute; i++ {
+		mute *= 2
+	}
+	return min(mute, cfg.MaxMute)
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
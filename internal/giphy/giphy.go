@@ -0,0 +1,222 @@
+package giphy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBaseURL = "https://api.giphy.com/v1/gifs"
+	requestTimeout = 5 * time.Second
+	// cacheTTL keeps popular searches from spending the API key's quota
+	cacheTTL = 10 * time.Minute
+	// maxCacheEntries bounds the cache; it is cleared when full
+	maxCacheEntries = 1000
+	// MaxLimit caps the results of one search page
+	MaxLimit = 50
+)
+
+// ErrDisabled is returned when no GIPHY_API_KEY is configured
+var ErrDisabled = errors.New("GIF search is not enabled")
+
+// ErrNotFound is returned for GIF IDs Giphy does not know
+var ErrNotFound = errors.New("GIF not found")
+
+// Image is one rendition of a GIF
+type Image struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// GIF is a Giphy result. Images are served by Giphy's CDN, which needs no
+// key, so clients load them directly.
+type GIF struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Preview is a small rendition for pickers, Original the full one
+	Preview  Image `json:"preview"`
+	Original Image `json:"original"`
+}
+
+// SearchResult is one page of search results
+type SearchResult struct {
+	GIFs       []GIF `json:"gifs"`
+	Offset     int   `json:"offset"`
+	TotalCount int   `json:"total_count"`
+}
+
+// Client calls the Giphy API with the deployment's key, caching results
+type Client struct {
+	APIKey string
+	// Rating is the content rating results are limited to
+	Rating  string
+	BaseURL string
+	HTTP    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultClient *Client
+)
+
+// Default returns the client configured from GIPHY_API_KEY and GIPHY_RATING
+// (default "pg"), or nil when no key is set
+func Default() *Client {
+	defaultOnce.Do(func() {
+		key := os.Getenv("GIPHY_API_KEY")
+		if key == "" {
+			return
+		}
+		rating := os.Getenv("GIPHY_RATING")
+		if rating == "" {
+			rating = "pg"
+		}
+		defaultClient = &Client{
+			APIKey:  key,
+			Rating:  rating,
+			BaseURL: defaultBaseURL,
+			HTTP:    &http.Client{Timeout: requestTimeout},
+		}
+	})
+	return defaultClient
+}
+
+// Search returns a page of GIFs matching query
+func (c *Client) Search(ctx context.Context, query string, limit, offset int) (SearchResult, error) {
+	if c == nil {
+		return SearchResult{}, ErrDisabled
+	}
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("offset", strconv.Itoa(offset))
+	params.Set("rating", c.Rating)
+
+	cacheKey := "search?" + params.Encode()
+	if v, ok := c.cached(cacheKey); ok {
+		return v.(SearchResult), nil
+	}
+
+	var body struct {
+		Data       []gifData `json:"data"`
+		Pagination struct {
+			Offset     int `json:"offset"`
+			TotalCount int `json:"total_count"`
+		} `json:"pagination"`
+	}
+	if err := c.get(ctx, "/search", params, &body); err != nil {
+		return SearchResult{}, err
+	}
+	result := SearchResult{GIFs: make([]GIF, 0, len(body.Data)), Offset: body.Pagination.Offset, TotalCount: body.Pagination.TotalCount}
+	for _, d := range body.Data {
+		result.GIFs = append(result.GIFs, d.gif())
+	}
+	c.remember(cacheKey, result)
+	return result, nil
+}
+
+// Get returns the GIF with an ID
+func (c *Client) Get(ctx context.Context, id string) (GIF, error) {
+	if c == nil {
+		return GIF{}, ErrDisabled
+	}
+	cacheKey := "gif/" + id
+	if v, ok := c.cached(cacheKey); ok {
+		return v.(GIF), nil
+	}
+
+	var body struct {
+		Data gifData `json:"data"`
+	}
+	if err := c.get(ctx, "/"+url.PathEscape(id), url.Values{}, &body); err != nil {
+		return GIF{}, err
+	}
+	if body.Data.ID == "" {
+		return GIF{}, ErrNotFound
+	}
+	gif := body.Data.gif()
+	c.remember(cacheKey, gif)
+	return gif, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	params.Set("api_key", c.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("giphy: status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) cached(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *Client) remember(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil || len(c.cache) >= maxCacheEntries {
+		c.cache = make(map[string]cacheEntry)
+	}
+	c.cache[key] = cacheEntry{value: value, expiresAt: time.Now().Add(cacheTTL)}
+}
+
+// gifData is a GIF as the API returns it, with sizes as strings
+type gifData struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Images struct {
+		FixedHeight imageData `json:"fixed_height"`
+		Original    imageData `json:"original"`
+	} `json:"images"`
+}
+
+type imageData struct {
+	URL    string `json:"url"`
+	Width  string `json:"width"`
+	Height string `json:"height"`
+}
+
+func (d gifData) gif() GIF {
+	return GIF{ID: d.ID, Title: d.Title, Preview: d.Images.FixedHeight.image(), Original: d.Images.Original.image()}
+}
+
+func (d imageData) image() Image {
+	width, _ := strconv.Atoi(d.Width)
+	height, _ := strconv.Atoi(d.Height)
+	return Image{URL: d.URL, Width: width, Height: height}
+}
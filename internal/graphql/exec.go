@@ -0,0 +1,422 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Request is a GraphQL request as sent over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Response is a GraphQL result
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is a request or field error
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Execute runs a query. Request errors, such as a syntax error or an
+// unknown field, leave Data nil; field errors null the affected fields and
+// are listed alongside the rest of the result.
+func Execute(ctx context.Context, schema *Schema, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return requestError("Syntax error: %v", err)
+	}
+
+	var op *operation
+	for _, candidate := range doc.operations {
+		if req.OperationName == "" || candidate.name == req.OperationName {
+			if op != nil {
+				return requestError("operationName is required when a document has several operations")
+			}
+			op = candidate
+		}
+	}
+	if op == nil {
+		return requestError("Unknown operation %q", req.OperationName)
+	}
+	if op.kind != "query" {
+		return requestError("Only queries are supported")
+	}
+
+	vars := make(map[string]interface{}, len(op.vars))
+	for _, def := range op.vars {
+		v, ok := req.Variables[def.name]
+		if !ok && def.defaults != nil {
+			v = def.defaults.resolve(nil)
+		}
+		if v == nil && def.nonNull {
+			return requestError("Variable $%s is required", def.name)
+		}
+		vars[def.name] = normalize(v)
+	}
+
+	ex := &executor{
+		ctx:       ctx,
+		vars:      vars,
+		fragments: doc.fragments,
+		maxDepth:  schema.MaxDepth,
+		maxCost:   schema.MaxCost,
+	}
+	if ex.maxDepth == 0 {
+		ex.maxDepth = 10
+	}
+	if ex.maxCost == 0 {
+		ex.maxCost = 10000
+	}
+	cost, err := ex.validate(schema.Query, op.selections, 1, map[string]bool{})
+	if err != nil {
+		return requestError("%v", err)
+	}
+	if cost > ex.maxCost {
+		return requestError("Query is too expensive: it may return %d results, the limit is %d", cost, ex.maxCost)
+	}
+
+	data := ex.selectionSet(schema.Query, []interface{}{nil}, op.selections, nil)
+	return &Response{Data: data[0], Errors: ex.errors}
+}
+
+func requestError(format string, args ...interface{}) *Response {
+	return &Response{Errors: []*Error{{Message: fmt.Sprintf(format, args...)}}}
+}
+
+// normalize converts decoded JSON numbers to the literal representation
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = normalize(v[k])
+		}
+	}
+	return v
+}
+
+type executor struct {
+	ctx       context.Context
+	vars      map[string]interface{}
+	fragments map[string]*fragment
+	maxDepth  int
+	maxCost   int
+	errors    []*Error
+}
+
+// collected is a response key with the fields merged under it
+type collected struct {
+	key    string
+	fields []*field
+}
+
+// collect flattens fragments and applies @skip and @include, merging fields
+// that share a response key
+func (ex *executor) collect(obj *Object, sels []selection, out []*collected, seen map[string]bool) []*collected {
+	for _, sel := range sels {
+		switch s := sel.(type) {
+		case *field:
+			if !ex.included(s.directives) {
+				continue
+			}
+			merged := false
+			for _, c := range out {
+				if c.key == s.key() {
+					c.fields = append(c.fields, s)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				out = append(out, &collected{key: s.key(), fields: []*field{s}})
+			}
+		case *inlineFragment:
+			if !ex.included(s.directives) || (s.typeCondition != "" && s.typeCondition != obj.Name) {
+				continue
+			}
+			out = ex.collect(obj, s.selections, out, seen)
+		case *fragmentSpread:
+			f := ex.fragments[s.name]
+			if f == nil || seen[s.name] || !ex.included(s.directives) || f.typeCondition != obj.Name {
+				continue
+			}
+			seen[s.name] = true
+			out = ex.collect(obj, f.selections, out, seen)
+			delete(seen, s.name)
+		}
+	}
+	return out
+}
+
+func (ex *executor) included(dirs []*directive) bool {
+	for _, d := range dirs {
+		v, _ := d.args["if"].resolve(ex.vars).(bool)
+		if (d.name == "skip" && v) || (d.name == "include" && !v) {
+			return false
+		}
+	}
+	return true
+}
+
+// validate checks a selection set against its type before anything runs, so
+// a bad query fails as a whole, and returns its estimated result count
+func (ex *executor) validate(obj *Object, sels []selection, depth int, fragmentPath map[string]bool) (int, error) {
+	if depth > ex.maxDepth {
+		return 0, fmt.Errorf("query is nested more than %d levels deep", ex.maxDepth)
+	}
+	cost := 0
+	for _, sel := range sels {
+		switch s := sel.(type) {
+		case *field:
+			for _, d := range s.directives {
+				if d.name != "skip" && d.name != "include" {
+					return 0, fmt.Errorf("unknown directive @%s", d.name)
+				}
+				if _, ok := d.args["if"]; !ok {
+					return 0, fmt.Errorf("directive @%s needs an if argument", d.name)
+				}
+			}
+			if s.name == "__typename" {
+				continue
+			}
+			def := obj.Fields[s.name]
+			if def == nil {
+				return 0, fmt.Errorf("cannot query field %q on type %s", s.name, obj.Name)
+			}
+			args, err := ex.args(def, s)
+			if err != nil {
+				return 0, err
+			}
+			n := 1
+			if def.Cost != nil {
+				n = def.Cost(args)
+			}
+			named := def.Type.named()
+			if named.Kind == KindObject {
+				if len(s.selections) == 0 {
+					return 0, fmt.Errorf("field %q of type %s needs a selection set", s.name, def.Type)
+				}
+				sub, err := ex.validate(named.Object, s.selections, depth+1, fragmentPath)
+				if err != nil {
+					return 0, err
+				}
+				n += n * sub
+			} else if len(s.selections) > 0 {
+				return 0, fmt.Errorf("field %q of type %s has no fields to select", s.name, def.Type)
+			}
+			cost += n
+		case *inlineFragment:
+			if s.typeCondition != "" && s.typeCondition != obj.Name {
+				return 0, fmt.Errorf("fragment on %s can never apply to %s", s.typeCondition, obj.Name)
+			}
+			n, err := ex.validate(obj, s.selections, depth, fragmentPath)
+			if err != nil {
+				return 0, err
+			}
+			cost += n
+		case *fragmentSpread:
+			f := ex.fragments[s.name]
+			if f == nil {
+				return 0, fmt.Errorf("unknown fragment %q", s.name)
+			}
+			if fragmentPath[s.name] {
+				return 0, fmt.Errorf("fragment %q spreads itself", s.name)
+			}
+			if f.typeCondition != obj.Name {
+				return 0, fmt.Errorf("fragment %q on %s can never apply to %s", s.name, f.typeCondition, obj.Name)
+			}
+			fragmentPath[s.name] = true
+			n, err := ex.validate(obj, f.selections, depth, fragmentPath)
+			delete(fragmentPath, s.name)
+			if err != nil {
+				return 0, err
+			}
+			cost += n
+		}
+	}
+	return cost, nil
+}
+
+// args coerces the arguments given to a field, applying defaults
+func (ex *executor) args(def *Field, f *field) (Args, error) {
+	for name := range f.args {
+		if def.Args[name] == nil {
+			return nil, fmt.Errorf("unknown argument %q on field %q", name, f.name)
+		}
+	}
+	args := make(Args, len(def.Args))
+	for name, arg := range def.Args {
+		var v interface{}
+		if given, ok := f.args[name]; ok {
+			v = given.resolve(ex.vars)
+		}
+		if v == nil {
+			v = arg.Default
+		}
+		c, err := coerce(arg.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q on field %q: %v", name, f.name, err)
+		}
+		if c != nil {
+			args[name] = c
+		}
+	}
+	return args, nil
+}
+
+// selectionSet resolves a selection set on every parent at once
+func (ex *executor) selectionSet(obj *Object, parents []interface{}, sels []selection, path []interface{}) []interface{} {
+	results := make([]*orderedObject, len(parents))
+	for i := range results {
+		results[i] = &orderedObject{values: make(map[string]interface{})}
+	}
+
+	for _, c := range ex.collect(obj, sels, nil, map[string]bool{}) {
+		f := c.fields[0]
+		fieldPath := append(append([]interface{}{}, path...), c.key)
+		if f.name == "__typename" {
+			for _, r := range results {
+				r.set(c.key, obj.Name)
+			}
+			continue
+		}
+		def := obj.Fields[f.name]
+		args, _ := ex.args(def, f)
+
+		values, err := def.Resolve(ex.ctx, parents, args)
+		if err == nil && len(values) != len(parents) {
+			err = fmt.Errorf("resolver returned %d values for %d objects", len(values), len(parents))
+		}
+		if err != nil {
+			ex.errors = append(ex.errors, &Error{Message: err.Error(), Path: fieldPath})
+			values = make([]interface{}, len(parents))
+		}
+
+		var subs []selection
+		for _, f := range c.fields {
+			subs = append(subs, f.selections...)
+		}
+		completed := ex.complete(def.Type, values, subs, fieldPath)
+		for i, r := range results {
+			r.set(c.key, completed[i])
+		}
+	}
+
+	out := make([]interface{}, len(results))
+	for i, r := range results {
+		out[i] = r
+	}
+	return out
+}
+
+// complete shapes resolved values by their type, resolving the selections
+// of object values together
+func (ex *executor) complete(t *Type, values []interface{}, sels []selection, path []interface{}) []interface{} {
+	switch t.Kind {
+	case KindNonNull:
+		return ex.complete(t.Of, values, sels, path)
+	case KindScalar:
+		out := make([]interface{}, len(values))
+		for i, v := range values {
+			out[i] = serialize(t, v)
+		}
+		return out
+	case KindObject:
+		var present []interface{}
+		var index []int
+		for i, v := range values {
+			if v != nil {
+				present = append(present, v)
+				index = append(index, i)
+			}
+		}
+		out := make([]interface{}, len(values))
+		if len(present) == 0 {
+			return out
+		}
+		resolved := ex.selectionSet(t.Object, present, sels, path)
+		for j, i := range index {
+			out[i] = resolved[j]
+		}
+		return out
+	case KindList:
+		var flat []interface{}
+		lengths := make([]int, len(values))
+		for i, v := range values {
+			items, ok := v.([]interface{})
+			if !ok {
+				lengths[i] = -1
+				continue
+			}
+			lengths[i] = len(items)
+			flat = append(flat, items...)
+		}
+		completed := ex.complete(t.Of, flat, sels, path)
+		out := make([]interface{}, len(values))
+		offset := 0
+		for i, n := range lengths {
+			if n < 0 {
+				continue
+			}
+			out[i] = completed[offset : offset+n]
+			offset += n
+		}
+		return out
+	}
+	return make([]interface{}, len(values))
+}
+
+// orderedObject marshals its fields in selection order, as GraphQL requires
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *orderedObject) set(key string, v interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		v, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
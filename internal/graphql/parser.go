@@ -0,0 +1,470 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// document is a parsed query document
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string
+	name       string
+	vars       []*varDef
+	selections []selection
+}
+
+type varDef struct {
+	name     string
+	nonNull  bool
+	defaults *value
+}
+
+// selection is a *field, *fragmentSpread or *inlineFragment
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	args       map[string]value
+	directives []*directive
+	selections []selection
+}
+
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	selections    []selection
+}
+
+type directive struct {
+	name string
+	args map[string]value
+}
+
+type valueKind int
+
+const (
+	valueVariable valueKind = iota
+	valueInt
+	valueFloat
+	valueString
+	valueBoolean
+	valueNull
+	valueEnum
+	valueList
+	valueObject
+)
+
+type value struct {
+	kind   valueKind
+	raw    string
+	list   []value
+	fields map[string]value
+}
+
+// resolve turns a literal into the value JSON variables decode to, with
+// variables substituted
+func (v value) resolve(vars map[string]interface{}) interface{} {
+	switch v.kind {
+	case valueVariable:
+		return vars[v.raw]
+	case valueInt:
+		n, _ := strconv.ParseInt(v.raw, 10, 64)
+		return n
+	case valueFloat:
+		f, _ := strconv.ParseFloat(v.raw, 64)
+		return f
+	case valueString, valueEnum:
+		return v.raw
+	case valueBoolean:
+		return v.raw == "true"
+	case valueList:
+		list := make([]interface{}, len(v.list))
+		for i, item := range v.list {
+			list[i] = item.resolve(vars)
+		}
+		return list
+	case valueObject:
+		obj := make(map[string]interface{}, len(v.fields))
+		for name, item := range v.fields {
+			obj[name] = item.resolve(vars)
+		}
+		return obj
+	}
+	return nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func parse(src string) (*document, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.peek().kind != tokEOF {
+		t := p.peek()
+		switch {
+		case t.kind == tokPunct && t.value == "{":
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: sels})
+		case t.kind == tokName && (t.value == "query" || t.value == "mutation" || t.value == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case t.kind == tokName && t.value == "fragment":
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := doc.fragments[f.name]; dup {
+				return nil, fmt.Errorf("fragment %q is defined twice", f.name)
+			}
+			doc.fragments[f.name] = f
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.value == s
+}
+
+func (p *parser) skipPunct(s string) bool {
+	if p.isPunct(s) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectPunct(s string) error {
+	if !p.skipPunct(s) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.peek()
+	if t.kind != tokName {
+		return "", p.unexpected()
+	}
+	p.i++
+	return t.value, nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("unexpected end of document")
+	}
+	return fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.next().value}
+	if p.peek().kind == tokName {
+		op.name = p.next().value
+	}
+	if p.skipPunct("(") {
+		for !p.skipPunct(")") {
+			if err := p.expectPunct("$"); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(":"); err != nil {
+				return nil, err
+			}
+			nonNull, err := p.typeRef()
+			if err != nil {
+				return nil, err
+			}
+			def := &varDef{name: name, nonNull: nonNull}
+			if p.skipPunct("=") {
+				v, err := p.value(true)
+				if err != nil {
+					return nil, err
+				}
+				def.defaults = &v
+			}
+			op.vars = append(op.vars, def)
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = sels
+	return op, nil
+}
+
+// typeRef skips a variable type and reports whether it is non-null.
+// Variables are checked against the arguments they are used for instead.
+func (p *parser) typeRef() (bool, error) {
+	if p.skipPunct("[") {
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	return p.skipPunct("!"), nil
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	p.next()
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if on, err := p.name(); err != nil || on != "on" {
+		return nil, fmt.Errorf("fragment %q needs a type condition", name)
+	}
+	typeCondition, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	sels, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &fragment{name: name, typeCondition: typeCondition, selections: sels}, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for !p.skipPunct("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, fmt.Errorf("empty selection set")
+	}
+	return sels, nil
+}
+
+func (p *parser) selection() (selection, error) {
+	if p.skipPunct("...") {
+		if t := p.peek(); t.kind == tokName && t.value != "on" {
+			p.i++
+			dirs, err := p.directives()
+			if err != nil {
+				return nil, err
+			}
+			return &fragmentSpread{name: t.value, directives: dirs}, nil
+		}
+		inline := &inlineFragment{}
+		if t := p.peek(); t.kind == tokName && t.value == "on" {
+			p.i++
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			inline.typeCondition = name
+		}
+		var err error
+		if inline.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if inline.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+		return inline, nil
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &field{name: name}
+	if p.skipPunct(":") {
+		f.alias = name
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if f.args, err = p.arguments(); err != nil {
+		return nil, err
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) arguments() (map[string]value, error) {
+	if !p.skipPunct("(") {
+		return nil, nil
+	}
+	args := make(map[string]value)
+	for !p.skipPunct(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := args[name]; dup {
+			return nil, fmt.Errorf("argument %q is given twice", name)
+		}
+		args[name] = v
+	}
+	return args, nil
+}
+
+func (p *parser) directives() ([]*directive, error) {
+	var dirs []*directive
+	for p.skipPunct("@") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, &directive{name: name, args: args})
+	}
+	return dirs, nil
+}
+
+func (p *parser) value(constant bool) (value, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokInt:
+		p.i++
+		return value{kind: valueInt, raw: t.value}, nil
+	case tokFloat:
+		p.i++
+		return value{kind: valueFloat, raw: t.value}, nil
+	case tokString:
+		p.i++
+		return value{kind: valueString, raw: t.value}, nil
+	case tokName:
+		p.i++
+		switch t.value {
+		case "true", "false":
+			return value{kind: valueBoolean, raw: t.value}, nil
+		case "null":
+			return value{kind: valueNull}, nil
+		}
+		return value{kind: valueEnum, raw: t.value}, nil
+	case tokPunct:
+		switch t.value {
+		case "$":
+			if constant {
+				return value{}, fmt.Errorf("variables are not allowed at %d", t.pos)
+			}
+			p.i++
+			name, err := p.name()
+			return value{kind: valueVariable, raw: name}, err
+		case "[":
+			p.i++
+			v := value{kind: valueList}
+			for !p.skipPunct("]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return value{}, err
+				}
+				v.list = append(v.list, item)
+			}
+			return v, nil
+		case "{":
+			p.i++
+			v := value{kind: valueObject, fields: make(map[string]value)}
+			for !p.skipPunct("}") {
+				name, err := p.name()
+				if err != nil {
+					return value{}, err
+				}
+				if err := p.expectPunct(":"); err != nil {
+					return value{}, err
+				}
+				item, err := p.value(constant)
+				if err != nil {
+					return value{}, err
+				}
+				v.fields[name] = item
+			}
+			return v, nil
+		}
+	}
+	return value{}, p.unexpected()
+}
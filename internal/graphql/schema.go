@@ -0,0 +1,216 @@
+// Package graphql executes GraphQL queries against a schema declared in Go.
+// It implements the query subset clients need to fetch nested data:
+// operations, aliases, arguments, variables, fragments and the @skip and
+// @include directives. Mutations, subscriptions, interfaces and
+// introspection are not supported.
+//
+// Resolvers receive every parent object of a field at once and return one
+// value per parent, so a field costs one call per level of the query however
+// many objects it is selected on. That batching is what a dataloader would
+// provide.
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Kind is the kind of a GraphQL type
+type Kind int
+
+const (
+	KindScalar Kind = iota
+	KindObject
+	KindList
+	KindNonNull
+)
+
+// Type is a GraphQL type reference
+type Type struct {
+	Kind   Kind
+	Name   string
+	Object *Object
+	Of     *Type
+}
+
+// Built-in scalars
+var (
+	Int     = &Type{Kind: KindScalar, Name: "Int"}
+	Float   = &Type{Kind: KindScalar, Name: "Float"}
+	String  = &Type{Kind: KindScalar, Name: "String"}
+	Boolean = &Type{Kind: KindScalar, Name: "Boolean"}
+	ID      = &Type{Kind: KindScalar, Name: "ID"}
+)
+
+// List returns the list type of t
+func List(t *Type) *Type { return &Type{Kind: KindList, Of: t} }
+
+// NonNull returns the non-null type of t
+func NonNull(t *Type) *Type { return &Type{Kind: KindNonNull, Of: t} }
+
+// Of returns the type of an object
+func Of(o *Object) *Type { return &Type{Kind: KindObject, Name: o.Name, Object: o} }
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case KindList:
+		return "[" + t.Of.String() + "]"
+	case KindNonNull:
+		return t.Of.String() + "!"
+	}
+	return t.Name
+}
+
+// named returns the type with list and non-null wrappers removed
+func (t *Type) named() *Type {
+	for t.Kind == KindList || t.Kind == KindNonNull {
+		t = t.Of
+	}
+	return t
+}
+
+// Object is an object type. Fields may be filled in after the object is
+// declared, so objects can refer to each other.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Resolver returns the value of a field for each parent, in order. List
+// fields return a []interface{} per parent.
+type Resolver func(ctx context.Context, parents []interface{}, args Args) ([]interface{}, error)
+
+// Field is a field of an object type
+type Field struct {
+	Type    *Type
+	Args    map[string]*Arg
+	Resolve Resolver
+	// Cost estimates how many results the field produces per parent, given
+	// its arguments. Fields without one count as one.
+	Cost func(args Args) int
+}
+
+// Arg is a field argument
+type Arg struct {
+	Type    *Type
+	Default interface{}
+}
+
+// Schema is the root of a GraphQL API
+type Schema struct {
+	Query *Object
+	// MaxDepth bounds how deeply selections may nest (default 10)
+	MaxDepth int
+	// MaxCost bounds the estimated number of results of a query (default 10000)
+	MaxCost int
+}
+
+// Args are the coerced arguments of a field: int64 for Int, float64 for
+// Float, string for String and ID, bool for Boolean
+type Args map[string]interface{}
+
+// Int returns an Int argument, or 0 when absent
+func (a Args) Int(name string) int64 {
+	n, _ := a[name].(int64)
+	return n
+}
+
+// String returns a String or ID argument, or "" when absent
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Bool returns a Boolean argument, or false when absent
+func (a Args) Bool(name string) bool {
+	b, _ := a[name].(bool)
+	return b
+}
+
+// IntID returns an ID argument holding a numeric ID
+func (a Args) IntID(name string) (int64, error) {
+	id, err := strconv.ParseInt(a.String(name), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("argument %q is not a valid ID", name)
+	}
+	return id, nil
+}
+
+// coerce converts an input value to the Go type of a scalar or list type
+func coerce(t *Type, v interface{}) (interface{}, error) {
+	if t.Kind == KindNonNull {
+		if v == nil {
+			return nil, fmt.Errorf("expected a non-null %s", t.Of)
+		}
+		return coerce(t.Of, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	switch t.Kind {
+	case KindList:
+		items, ok := v.([]interface{})
+		if !ok {
+			// A single value is accepted where a list is expected
+			items = []interface{}{v}
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			c, err := coerce(t.Of, item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	case KindScalar:
+		switch t.Name {
+		case "Int":
+			switch n := v.(type) {
+			case int64:
+				return n, nil
+			case float64:
+				if n == float64(int64(n)) {
+					return int64(n), nil
+				}
+			}
+		case "Float":
+			switch n := v.(type) {
+			case int64:
+				return float64(n), nil
+			case float64:
+				return n, nil
+			}
+		case "String":
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+		case "Boolean":
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+		case "ID":
+			switch id := v.(type) {
+			case string:
+				return id, nil
+			case int64:
+				return strconv.FormatInt(id, 10), nil
+			case float64:
+				if id == float64(int64(id)) {
+					return strconv.FormatInt(int64(id), 10), nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("expected a %s", t.Name)
+	}
+	return nil, fmt.Errorf("input objects are not supported")
+}
+
+// serialize converts a resolved scalar for the response. IDs are strings.
+func serialize(t *Type, v interface{}) interface{} {
+	if v == nil || t.Name != "ID" {
+		return v
+	}
+	return fmt.Sprint(v)
+}
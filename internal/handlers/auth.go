@@ -2,9 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikhil/eaven/internal/handles"
+	"github.com/nikhil/eaven/internal/lockout"
+	"github.com/nikhil/eaven/internal/middleware"
 	models "github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/passwordpolicy"
 	services "github.com/nikhil/eaven/internal/service/auth"
 )
 
@@ -26,7 +35,18 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	userid, err := h.Service.Signup(user)
+	userid, err := h.Service.Signup(r.Context(), &user)
+	if respondPasswordPolicy(w, err) {
+		return
+	}
+	if errors.Is(err, handles.ErrInvalidHandle) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, handles.ErrHandleTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -34,7 +54,7 @@ func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
 
 	user.UserID = userid
 	user.Password = ""
-	token, err := h.Service.GenerateJWT(user.Email, user.UserID)
+	token, err := h.Service.GenerateJWT(user.Email, user.UserID, 0)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -54,7 +74,10 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, userDetails, err := h.Service.Login(credentials.Email, credentials.Password)
+	token, userDetails, err := h.Service.Login(r.Context(), credentials.Email, credentials.Password, middleware.ClientIP(r))
+	if respondLocked(w, err) {
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -63,3 +86,69 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "user_details": userDetails})
 }
+
+// ChangePassword replaces the caller's password and signs out their other
+// sessions. The response carries a new token for the current session.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.CurrentPassword == "" || body.NewPassword == "" {
+		http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Service.ChangePassword(r.Context(), userID, body.CurrentPassword, body.NewPassword, middleware.ClientIP(r))
+	if respondLocked(w, err) || respondPasswordPolicy(w, err) {
+		return
+	}
+	if errors.Is(err, services.ErrWrongPassword) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Password changed, other sessions were signed out", "token": token})
+}
+
+// respondLocked answers 429 with the time the lockout ends when err is a
+// login lockout, and reports whether it did
+func respondLocked(w http.ResponseWriter, err error) bool {
+	var locked *lockout.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	retryAfter := locked.RetryAfter(time.Now())
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": locked.Error(), "locked_until": locked.Until, "retry_after": retryAfter})
+	return true
+}
+
+// respondPasswordPolicy answers 400 with the list of problems when err is a
+// password policy failure, and reports whether it did
+func respondPasswordPolicy(w http.ResponseWriter, err error) bool {
+	var invalid *passwordpolicy.ValidationError
+	if !errors.As(err, &invalid) {
+		return false
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "400", "message": "Password does not meet the policy", "errors": invalid.Problems})
+	return true
+}
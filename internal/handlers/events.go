@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/events"
+)
+
+// ListEventSchemas lists the published event schemas. A schema identifier
+// ends in its version and never changes meaning, so integrations can pin to
+// it.
+func ListEventSchemas(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"protocol_version": events.ProtocolVersion,
+		"schemas":          events.Schemas(),
+	})
+}
+
+// GetEventSchema returns the JSON Schema of one event schema identifier
+func GetEventSchema(w http.ResponseWriter, r *http.Request) {
+	schema, ok := events.JSONSchema(mux.Vars(r)["schema"])
+	if !ok {
+		http.Error(w, "Unknown event schema", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(schema)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/sse"
+)
+
+const (
+	defaultPollWait = 25 * time.Second
+	maxPollWait     = 30 * time.Second
+	// maxPollEvents bounds one response; clients poll again at once when
+	// more is set
+	maxPollEvents = 100
+)
+
+// PollEvents is the long-poll fallback for clients that can use neither
+// WebSockets nor Server-Sent Events. It returns the user's events after the
+// since cursor, waiting up to wait seconds (default 25, max 30) for one to
+// arrive. Without since it returns the current cursor at once. Clients pass
+// the returned cursor as since on the next poll; team_id narrows events
+// like on /events.
+func PollEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	broker := sse.Default()
+	if broker == nil {
+		http.Error(w, "Event streams are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, teamIDs, ok := streamUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("since") == "" {
+		writePoll(w, nil, broker.Settled(), false)
+		return
+	}
+	since, err := strconv.ParseInt(query.Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		http.Error(w, "Invalid since cursor", http.StatusBadRequest)
+		return
+	}
+	wait := defaultPollWait
+	if v := query.Get("wait"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			http.Error(w, "Invalid wait", http.StatusBadRequest)
+			return
+		}
+		wait = min(time.Duration(seconds)*time.Second, maxPollWait)
+	}
+
+	channels, err := streamChannels(ctx, userID, teamIDs)
+	if err != nil {
+		streamLog.WithContext(ctx).Error("Failed to load channels for poll", "error", err)
+		http.Error(w, "Failed to poll events", http.StatusInternalServerError)
+		return
+	}
+	ids := make([]int64, 0, len(channels))
+	for id := range channels {
+		ids = append(ids, id)
+	}
+
+	// Subscribe before reading the backlog so nothing falls between the two
+	sub, err := broker.Subscribe(userID, middleware.ClientIP(r))
+	if err != nil {
+		refuseStream(w, err)
+		return
+	}
+	defer broker.Unsubscribe(sub)
+
+	// +1 tells whether more events are waiting than fit in the response
+	batch, err := broker.Since(ctx, userID, since, ids, maxPollEvents+1)
+	if err != nil {
+		streamLog.WithContext(ctx).Error("Failed to read events for poll", "error", err)
+		http.Error(w, "Failed to poll events", http.StatusInternalServerError)
+		return
+	}
+	if len(batch) > maxPollEvents {
+		writePoll(w, batch[:maxPollEvents], batch[maxPollEvents-1].ID, true)
+		return
+	}
+	if len(batch) > 0 {
+		writePoll(w, batch, batch[len(batch)-1].ID, false)
+		return
+	}
+
+	// Nothing yet: the cursor moves past the settled events even when none
+	// belong to the user, so the next poll does not scan them again
+	cursor := max(since, broker.Settled())
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done:
+			writePoll(w, nil, cursor, false)
+			return
+		case <-timer.C:
+			writePoll(w, nil, max(cursor, broker.Settled()), false)
+			return
+		case e := <-sub.Events:
+			if e.ID <= since {
+				continue
+			}
+			if joined, _ := membershipChange(e, userID); joined {
+				channels[e.ChannelID] = struct{}{}
+			}
+			if _, ok := channels[e.ChannelID]; !ok || !e.VisibleTo(userID) {
+				continue
+			}
+			// A short grace period lets events written together leave in
+			// one response
+			batch := collectPoll(ctx, sub, userID, channels, since, e)
+			latest := since
+			for _, e := range batch {
+				latest = max(latest, e.ID)
+			}
+			writePoll(w, batch, latest, false)
+			return
+		}
+	}
+}
+
+// collectPoll gathers the events that arrive shortly after the first one
+func collectPoll(ctx context.Context, sub *sse.Subscription, userID int64, channels map[int64]struct{}, since int64, first outbox.Event) []outbox.Event {
+	batch := []outbox.Event{first}
+	grace := time.NewTimer(50 * time.Millisecond)
+	defer grace.Stop()
+	for len(batch) < maxPollEvents {
+		select {
+		case <-ctx.Done():
+			return batch
+		case <-grace.C:
+			return batch
+		case e := <-sub.Events:
+			if joined, _ := membershipChange(e, userID); joined {
+				channels[e.ChannelID] = struct{}{}
+			}
+			if _, ok := channels[e.ChannelID]; ok && e.ID > since && e.VisibleTo(userID) {
+				batch = append(batch, e)
+			}
+		}
+	}
+	return batch
+}
+
+func writePoll(w http.ResponseWriter, batch []outbox.Event, cursor int64, more bool) {
+	envelopes := make([]map[string]interface{}, 0, len(batch))
+	for _, e := range batch {
+		envelopes = append(envelopes, map[string]interface{}{"id": e.ID, "event": e.Envelope})
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": envelopes,
+		"cursor": cursor,
+		"more":   more,
+	})
+}
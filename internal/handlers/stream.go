@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/sse"
+)
+
+const (
+	// streamHeartbeat keeps proxies from closing idle streams, and keeps a
+	// healthy stream well inside sse.StaleAfter
+	streamHeartbeat = 25 * time.Second
+	// streamWriteTimeout bounds each write, so a client that stopped reading
+	// cannot block its stream forever
+	streamWriteTimeout = 30 * time.Second
+	// streamRefresh is how often a stream reloads the user's channels
+	streamRefresh = time.Minute
+	// maxResumeEvents bounds the replay on reconnect; clients that missed
+	// more are told to reload instead
+	maxResumeEvents = 5000
+	resumePage      = 500
+)
+
+var streamLog = logger.NewLogger("event-stream")
+
+// StreamEvents streams realtime events as Server-Sent Events, for clients
+// whose network blocks WebSockets. Only events of the user's channels are
+// sent, optionally narrowed with team_id (repeatable or comma-separated).
+// Each event's id is its outbox ID: reconnecting with Last-Event-ID (or
+// last_event_id, for clients that cannot set headers) replays what was
+// missed. A "reset" event means too much was missed and the client should
+// reload its state; a "shutdown" event that the server is going away and the
+// client should reconnect after the retry delay it sets.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	broker := sse.Default()
+	if broker == nil {
+		http.Error(w, "Event streams are disabled", http.StatusServiceUnavailable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	userID, teamIDs, ok := streamUser(w, r)
+	if !ok {
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var cursor int64
+	if lastID != "" {
+		var err error
+		if cursor, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	channels, err := streamChannels(ctx, userID, teamIDs)
+	if err != nil {
+		streamLog.WithContext(ctx).Error("Failed to load channels for event stream", "error", err)
+		http.Error(w, "Failed to open event stream", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before replaying so nothing falls between the two
+	sub, err := broker.Subscribe(userID, middleware.ClientIP(r))
+	if err != nil {
+		refuseStream(w, err)
+		return
+	}
+	defer broker.Unsubscribe(sub)
+
+	// Writers that cannot take deadlines rely on the broker reaping the
+	// stream instead
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	replayed := make(map[int64]struct{})
+	if cursor > 0 {
+		ids := make([]int64, 0, len(channels))
+		for id := range channels {
+			ids = append(ids, id)
+		}
+		for sent := 0; ; {
+			if sent >= maxResumeEvents {
+				fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+				break
+			}
+			batch, err := broker.Since(ctx, userID, cursor, ids, resumePage)
+			if err != nil {
+				streamLog.WithContext(ctx).Error("Failed to replay events", "error", err)
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			for _, e := range batch {
+				if err := writeStreamEvent(w, e); err != nil {
+					return
+				}
+				cursor = e.ID
+				replayed[e.ID] = struct{}{}
+			}
+			sent += len(batch)
+			if len(batch) < resumePage {
+				break
+			}
+		}
+	}
+	flusher.Flush()
+	sub.Alive(time.Now())
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	refresh := time.NewTicker(streamRefresh)
+	defer refresh.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Done:
+			// Fell too far behind or went stale; the client reconnects and
+			// resumes. A draining server says when, so clients come back
+			// spread out, to another process.
+			if delay, ok := sub.Reconnect(); ok {
+				rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+				fmt.Fprintf(w, "retry: %d\nevent: shutdown\ndata: {\"reconnect_ms\":%d}\n\n", delay.Milliseconds(), delay.Milliseconds())
+				rc.Flush()
+			}
+			return
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-refresh.C:
+			updated, err := streamChannels(ctx, userID, teamIDs)
+			if err != nil {
+				streamLog.WithContext(ctx).Warn("Failed to refresh channels for event stream", "error", err)
+				continue
+			}
+			channels = updated
+			continue
+		case e := <-sub.Events:
+			// Events already sent by the replay may arrive live as well
+			if _, ok := replayed[e.ID]; ok {
+				delete(replayed, e.ID)
+				continue
+			}
+			joined, left := membershipChange(e, userID)
+			if joined {
+				channels[e.ChannelID] = struct{}{}
+			}
+			if _, ok := channels[e.ChannelID]; !ok || !e.VisibleTo(userID) {
+				continue
+			}
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := writeStreamEvent(w, e); err != nil {
+				return
+			}
+			if left {
+				delete(channels, e.ChannelID)
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		sub.Alive(time.Now())
+	}
+}
+
+// streamUser reads the user and the team_id filter of a stream or poll
+func streamUser(w http.ResponseWriter, r *http.Request) (int64, []int64, bool) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return 0, nil, false
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	var teamIDs []int64
+	for _, value := range r.URL.Query()["team_id"] {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid team ID", http.StatusBadRequest)
+				return 0, nil, false
+			}
+			teamIDs = append(teamIDs, id)
+		}
+	}
+	return userID, teamIDs, true
+}
+
+// refuseStream answers a stream or poll the broker turned away. The
+// "too_many_streams" code tells clients to reuse the stream they have, for
+// example by sharing it between tabs, rather than retry at once; "draining"
+// to retry shortly, which reaches another process.
+func refuseStream(w http.ResponseWriter, err error) {
+	if errors.Is(err, sse.ErrDraining) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code":   "draining",
+			"reason": err.Error(),
+		})
+		return
+	}
+	var limit *sse.LimitError
+	if !errors.As(err, &limit) {
+		http.Error(w, "Failed to open event stream", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "30")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":   "too_many_streams",
+		"reason": limit.Error(),
+		"scope":  limit.Scope,
+		"limit":  limit.Limit,
+	})
+}
+
+func writeStreamEvent(w http.ResponseWriter, e outbox.Event) error {
+	data, err := json.Marshal(e.Envelope)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Envelope.Type, data)
+	return err
+}
+
+// membershipChange reports whether e adds the user to its channel or takes
+// them out of it, so streams follow the user's joins and leaves without
+// waiting for the next refresh
+func membershipChange(e outbox.Event, userID int64) (joined, left bool) {
+	switch e.Envelope.Type {
+	case events.TypeChannelMemberJoined, events.TypeChannelMemberLeft:
+	default:
+		return false, false
+	}
+	var payload struct {
+		UserID int64 `json:"user_id"`
+	}
+	if json.Unmarshal(e.Envelope.Payload, &payload) != nil || payload.UserID != userID {
+		return false, false
+	}
+	return e.Envelope.Type == events.TypeChannelMemberJoined, e.Envelope.Type == events.TypeChannelMemberLeft
+}
+
+// streamChannels returns the channels whose events a user may receive,
+// limited to the given teams when there are any
+func streamChannels(ctx context.Context, userID int64, teamIDs []int64) (map[int64]struct{}, error) {
+	query := `
+		SELECT cm.channel_id
+		FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		WHERE cm.user_id = ? AND EXISTS (
+			SELECT 1 FROM user_teams_mapper utm WHERE utm.user_id = cm.user_id AND (utm.team_id = c.team_id OR utm.team_id IN (
+				SELECT s.team_id FROM channel_shares s WHERE s.channel_id = c.channel_id AND s.status = 'active')))`
+	args := []interface{}{userID}
+	if len(teamIDs) > 0 {
+		// A shared channel streams under the teams it is shared with too
+		in := strings.TrimSuffix(strings.Repeat("?,", len(teamIDs)), ",")
+		query += ` AND (c.team_id IN (` + in + `) OR EXISTS (
+			SELECT 1 FROM channel_shares s WHERE s.channel_id = c.channel_id AND s.status = 'active' AND s.team_id IN (` + in + `)))`
+		for range 2 {
+			for _, id := range teamIDs {
+				args = append(args, id)
+			}
+		}
+	}
+
+	rows, err := database.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	// Channel 0 carries the events addressed to the user outside any channel
+	channels := map[int64]struct{}{0: {}}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		channels[id] = struct{}{}
+	}
+	return channels, rows.Err()
+}
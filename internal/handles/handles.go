@@ -0,0 +1,159 @@
+package handles
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GracePeriod is how long a changed handle keeps redirecting to its user.
+// Nobody else can take the handle before it ends.
+const GracePeriod = 30 * 24 * time.Hour
+
+// ErrInvalidHandle is returned for handles that break the handle rules
+var ErrInvalidHandle = errors.New("handle must be 2 to 32 lowercase letters, digits, underscores or dots, not starting or ending with a dot")
+
+// ErrHandleTaken is returned when another user holds the handle or changed
+// away from it within the grace period
+var ErrHandleTaken = errors.New("handle is already taken")
+
+// ErrNotFound is returned when no user has, or recently had, a handle
+var ErrNotFound = errors.New("handle not found")
+
+var validHandle = regexp.MustCompile(`^[a-z0-9_]([a-z0-9_.]{0,30}[a-z0-9_])?$`)
+
+var invalidChars = regexp.MustCompile(`[^a-z0-9_.]+`)
+
+// Normalize lowercases a handle and drops a leading @, so "@Ada" and "ada"
+// name the same user
+func Normalize(handle string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), "@"))
+}
+
+// Valid reports whether a normalized handle can be stored
+func Valid(handle string) bool {
+	return len(handle) >= 2 && validHandle.MatchString(handle)
+}
+
+// Suggest derives a handle from an email address or name. The result may
+// be too short or already taken; see Available.
+func Suggest(s string) string {
+	if at := strings.IndexByte(s, '@'); at > 0 {
+		s = s[:at]
+	}
+	s = strings.Trim(invalidChars.ReplaceAllString(strings.ToLower(s), ""), ".")
+	if len(s) > 20 {
+		s = strings.TrimRight(s[:20], ".")
+	}
+	return s
+}
+
+// Available returns base if nobody in the workspace holds it, or base with
+// the lowest free number appended. Short bases are padded to "user".
+func Available(ctx context.Context, db *sql.DB, workspaceID int64, base string, now time.Time) (string, error) {
+	if len(base) < 2 {
+		base = "user"
+	}
+	for n := 1; ; n++ {
+		candidate := base
+		if n > 1 {
+			candidate += strconv.Itoa(n)
+		}
+		isTaken, err := taken(ctx, db, workspaceID, candidate, 0, now)
+		if err != nil {
+			return "", err
+		}
+		if !isTaken {
+			return candidate, nil
+		}
+	}
+}
+
+// Change gives a user a new handle. The old one redirects to the user for
+// the grace period; changing back to it within that time is allowed.
+func Change(ctx context.Context, db *sql.DB, userID int64, handle string, now time.Time) (string, error) {
+	handle = Normalize(handle)
+	if !Valid(handle) {
+		return "", ErrInvalidHandle
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var workspaceID int64
+	var old string
+	err = tx.QueryRowContext(ctx, `SELECT workspace_id, handle FROM users WHERE user_id = ? FOR UPDATE`, userID).Scan(&workspaceID, &old)
+	if err != nil {
+		return "", err
+	}
+	if handle == old {
+		return handle, nil
+	}
+	isTaken, err := taken(ctx, tx, workspaceID, handle, userID, now)
+	if err != nil {
+		return "", err
+	}
+	if isTaken {
+		return "", ErrHandleTaken
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET handle = ?, updated_at = ? WHERE user_id = ?`, handle, now.Unix(), userID); err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM handle_redirects WHERE workspace_id = ? AND handle = ?`, workspaceID, handle); err != nil {
+		return "", err
+	}
+	if old != "" {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO handle_redirects (workspace_id, handle, user_id, expires_at) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE user_id = VALUES(user_id), expires_at = VALUES(expires_at)`,
+			workspaceID, old, userID, now.Add(GracePeriod).Unix())
+		if err != nil {
+			return "", err
+		}
+	}
+	return handle, tx.Commit()
+}
+
+// Resolve finds the user a handle names in a workspace. moved is set when
+// the handle is an old one still in its grace period.
+func Resolve(ctx context.Context, db *sql.DB, workspaceID int64, handle string, now time.Time) (userID int64, moved bool, err error) {
+	handle = Normalize(handle)
+	err = db.QueryRowContext(ctx, `SELECT user_id FROM users WHERE workspace_id = ? AND handle = ? AND merged_into = 0`, workspaceID, handle).Scan(&userID)
+	if err == nil {
+		return userID, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, err
+	}
+	err = db.QueryRowContext(ctx, `SELECT user_id FROM handle_redirects WHERE workspace_id = ? AND handle = ? AND expires_at > ?`, workspaceID, handle, now.Unix()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, ErrNotFound
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// taken reports whether a user other than userID holds the handle or is
+// still redirected from it
+func taken(ctx context.Context, q querier, workspaceID int64, handle string, userID int64, now time.Time) (bool, error) {
+	var isTaken bool
+	err := q.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM users WHERE workspace_id = ? AND handle = ? AND user_id <> ?)
+			OR EXISTS(SELECT 1 FROM handle_redirects WHERE workspace_id = ? AND handle = ? AND user_id <> ? AND expires_at > ?)`,
+		workspaceID, handle, userID, workspaceID, handle, userID, now.Unix()).Scan(&isTaken)
+	return isTaken, err
+}
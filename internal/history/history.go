@@ -0,0 +1,200 @@
+// Package history splits messages between a hot table and an archive tier.
+// A mover relocates messages older than a number of months to
+// messages_archive, and readers stitch both tables, so history looks the
+// same wherever a message lives.
+//
+// Queries written for the readers name the message table {messages}; it is
+// replaced by each table in turn.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// Message tables. Messages are archived oldest first, so the archive holds
+// the lower IDs.
+const (
+	Hot     = "messages"
+	Archive = "messages_archive"
+)
+
+// Tables lists the message tables, newest messages first
+var Tables = []string{Hot, Archive}
+
+// batchSize bounds how many messages one move transaction relocates
+const batchSize = 1000
+
+const placeholder = "{messages}"
+
+// In returns query with its {messages} placeholder naming table
+func In(query, table string) string {
+	return strings.ReplaceAll(query, placeholder, table)
+}
+
+// Union runs query on every message table, joined with UNION ALL, and
+// repeats its args for each. It suits lookups by message ID, which match in
+// one table at most.
+func Union(query string, args ...interface{}) (string, []interface{}) {
+	parts := make([]string, len(Tables))
+	all := make([]interface{}, 0, len(args)*len(Tables))
+	for i, table := range Tables {
+		parts[i] = "(" + In(query, table) + ")"
+		all = append(all, args...)
+	}
+	return strings.Join(parts, " UNION ALL "), all
+}
+
+// Each runs a query ordered by message ID on the tables in order, newest
+// first or oldest first, and calls scan for every row. With limit above 0
+// the query must end in LIMIT ?, which is filled with what remains of limit,
+// and tables are skipped once it is reached. It returns how many rows were
+// scanned.
+func Each(ctx context.Context, db *sql.DB, newestFirst bool, limit int, query string, args []interface{}, scan func(*sql.Rows) error) (int, error) {
+	tables := Tables
+	if !newestFirst {
+		tables = []string{Archive, Hot}
+	}
+	n := 0
+	for _, table := range tables {
+		if limit > 0 && n >= limit {
+			break
+		}
+		tableArgs := args
+		if limit > 0 {
+			tableArgs = append(append([]interface{}{}, args...), limit-n)
+		}
+		rows, err := db.QueryContext(ctx, In(query, table), tableArgs...)
+		if err != nil {
+			return n, err
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return n, err
+			}
+			n++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Mover relocates messages older than AfterMonths to the archive table
+type Mover struct {
+	DB          *sql.DB
+	Log         *logger.Logger
+	AfterMonths int
+}
+
+// Start launches the history mover. MESSAGE_ARCHIVE_AFTER_MONTHS sets how
+// old messages are when they move to the archive (default 0, which keeps
+// every message hot) and MESSAGE_ARCHIVE_INTERVAL_HOURS how often they are
+// moved (default 24).
+func Start() {
+	months := 0
+	if v, err := strconv.Atoi(os.Getenv("MESSAGE_ARCHIVE_AFTER_MONTHS")); err == nil && v >= 0 {
+		months = v
+	}
+	hours := 24
+	if v, err := strconv.Atoi(os.Getenv("MESSAGE_ARCHIVE_INTERVAL_HOURS")); err == nil && v > 0 {
+		hours = v
+	}
+	if months == 0 {
+		return
+	}
+
+	m := &Mover{
+		DB:          database.DB,
+		Log:         logger.NewLogger("history-mover"),
+		AfterMonths: months,
+	}
+	go m.run(time.Duration(hours) * time.Hour)
+}
+
+func (m *Mover) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		moved, err := m.Move(ctx, now.UTC())
+		if err != nil {
+			m.Log.Error("Failed to archive old messages", "error", err, "moved", moved)
+		} else if moved > 0 {
+			m.Log.Info("Archived old messages", "moved", moved)
+		}
+		cancel()
+	}
+}
+
+// Move relocates every message older than AfterMonths, one batch per
+// transaction, and returns how many were moved
+func (m *Mover) Move(ctx context.Context, now time.Time) (int64, error) {
+	cutoff := now.AddDate(0, -m.AfterMonths, 0).Unix()
+	var total int64
+	for {
+		n, err := m.moveBatch(ctx, cutoff)
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+	}
+}
+
+// moveBatch copies the oldest messages due up to batchSize into the archive
+// and deletes them from the hot table in one transaction, so readers see
+// each message in exactly one table
+func (m *Mover) moveBatch(ctx context.Context, cutoff int64) (int64, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the batch; its highest ID bounds the copy and the delete
+	rows, err := tx.QueryContext(ctx, `
+		SELECT message_id FROM messages
+		WHERE message_created_at < ?
+		ORDER BY message_id
+		LIMIT ?
+		FOR UPDATE`, cutoff, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var maxID int64
+	for rows.Next() {
+		if err := rows.Scan(&maxID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || maxID == 0 {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO messages_archive
+		SELECT * FROM messages WHERE message_created_at < ? AND message_id <= ?`, cutoff, maxID); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE message_created_at < ? AND message_id <= ?`, cutoff, maxID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,207 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config controls how the API is served
+type Config struct {
+	// Addr is where the API listens, over TLS when it is enabled
+	Addr string
+	// CertFile and KeyFile enable TLS. The files are reread when they change,
+	// so certificates renewed in place, for example by certbot for Let's
+	// Encrypt, are picked up without a restart.
+	CertFile string
+	KeyFile  string
+	// RedirectAddr, when TLS is enabled, serves plain HTTP that redirects to
+	// HTTPS. Requests under /.well-known/acme-challenge/ are served from
+	// ACMEWebroot instead, so certbot's webroot mode can renew through it.
+	RedirectAddr string
+	ACMEWebroot  string
+	// ShutdownTimeout is how long requests in flight may take to finish once
+	// the server is asked to stop
+	ShutdownTimeout time.Duration
+}
+
+// TLS reports whether the config enables TLS
+func (c Config) TLS() bool {
+	return c.CertFile != ""
+}
+
+// LoadConfig reads the settings from the environment: TLS_CERT_FILE and
+// TLS_KEY_FILE enable TLS. The API listens on HTTP_ADDR, which defaults to
+// :8080 without TLS and :8443 with it. HTTP_REDIRECT_ADDR, such as :80, adds
+// the HTTP to HTTPS redirect and ACME_WEBROOT the challenge directory it
+// serves. SHUTDOWN_TIMEOUT_SECONDS (default 30) bounds the graceful
+// shutdown.
+func LoadConfig() Config {
+	cfg := Config{
+		Addr:            os.Getenv("HTTP_ADDR"),
+		CertFile:        os.Getenv("TLS_CERT_FILE"),
+		KeyFile:         os.Getenv("TLS_KEY_FILE"),
+		RedirectAddr:    os.Getenv("HTTP_REDIRECT_ADDR"),
+		ACMEWebroot:     os.Getenv("ACME_WEBROOT"),
+		ShutdownTimeout: 30 * time.Second,
+	}
+	if v, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		cfg.ShutdownTimeout = time.Duration(v) * time.Second
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = ":8080"
+		if cfg.TLS() {
+			cfg.Addr = ":8443"
+		}
+	}
+	return cfg
+}
+
+// ListenAndServe serves handler as configured until a listener fails or
+// ctx is done. It then stops accepting connections and waits up to
+// ShutdownTimeout for requests in flight, returning nil once they finished.
+// With TLS, HTTP/2 is negotiated automatically.
+func ListenAndServe(ctx context.Context, cfg Config, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if !cfg.TLS() {
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.ListenAndServe()
+		}()
+		return serveUntil(ctx, cfg, errs, server)
+	}
+	if cfg.KeyFile == "" {
+		return errors.New("TLS_KEY_FILE is required with TLS_CERT_FILE")
+	}
+	certs := &certLoader{certFile: cfg.CertFile, keyFile: cfg.KeyFile}
+	if err := certs.load(); err != nil {
+		return err
+	}
+	server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.get}
+
+	var redirect http.Handler = redirectToHTTPS(cfg.Addr)
+	if cfg.ACMEWebroot != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/.well-known/acme-challenge/", http.FileServer(http.Dir(cfg.ACMEWebroot)))
+		mux.Handle("/", redirect)
+		redirect = mux
+	}
+
+	errs := make(chan error, 2)
+	servers := []*http.Server{server}
+	if cfg.RedirectAddr != "" {
+		redirectServer := &http.Server{Addr: cfg.RedirectAddr, Handler: redirect, ReadHeaderTimeout: 10 * time.Second}
+		servers = append(servers, redirectServer)
+		go func() {
+			errs <- fmt.Errorf("redirect listener: %w", redirectServer.ListenAndServe())
+		}()
+	}
+	go func() {
+		// The certificate comes from GetCertificate
+		errs <- server.ListenAndServeTLS("", "")
+	}()
+	return serveUntil(ctx, cfg, errs, servers...)
+}
+
+// serveUntil waits for a listener to fail or ctx to be done, then shuts the
+// servers down gracefully
+func serveUntil(ctx context.Context, cfg Config, errs <-chan error, servers ...*http.Server) error {
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	var err error
+	for _, s := range servers {
+		err = errors.Join(err, s.Shutdown(shutdownCtx))
+	}
+	return err
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS on
+// the port the API listens on
+func redirectToHTTPS(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		// GET and HEAD get a 301; other methods get a 308 so clients repeat
+		// them with their body
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+// certCheckInterval is how often the certificate files are checked for
+// changes at most
+const certCheckInterval = time.Minute
+
+// certLoader serves a certificate from files and reloads it once they change
+type certLoader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func (c *certLoader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checkedAt) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checkedAt = time.Now()
+	info, err := os.Stat(c.certFile)
+	if err != nil || !info.ModTime().After(c.modTime) {
+		// Keep serving the loaded certificate if the file is briefly missing
+		// during a renewal
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		// The key may not be written yet; try again on the next check
+		return c.cert, nil
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return c.cert, nil
+}
+
+// load reads the certificate for the first time, failing startup when it
+// cannot be used
+func (c *certLoader) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	c.cert, c.modTime, c.checkedAt = &cert, info.ModTime(), time.Now()
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package i18n translates text the server writes for people: system messages
+// posted to channels and the error strings of API responses.
+//
+// Catalogs live in locales/<locale>.json. "messages" maps keys to templates
+// with {name} placeholders; "errors" maps an English error string, as the
+// handlers write it, to its translation. Missing entries fall back to
+// English.
+package i18n
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// English is the locale of the handlers' own strings
+const English = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+type catalog struct {
+	Messages map[string]string `json:"messages"`
+	Errors   map[string]string `json:"errors"`
+}
+
+var (
+	catalogs = load()
+	// Locales lists the supported locales
+	Locales = locales()
+)
+
+func load() map[string]catalog {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]catalog, len(entries))
+	for _, e := range entries {
+		data, err := files.ReadFile("locales/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+		var c catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			panic("i18n: " + e.Name() + ": " + err.Error())
+		}
+		loaded[strings.TrimSuffix(e.Name(), path.Ext(e.Name()))] = c
+	}
+	return loaded
+}
+
+func locales() []string {
+	list := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		list = append(list, l)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Supported returns the supported locale for a language tag such as
+// "pt-BR" or "de", matching on the primary language
+func Supported(tag string) (string, bool) {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	_, ok := catalogs[lang]
+	return lang, ok
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultLocale = English
+)
+
+// Default is the locale used when neither the user nor the team chose one:
+// DEFAULT_LOCALE when it is supported, English otherwise
+func Default() string {
+	defaultOnce.Do(func() {
+		if l, ok := Supported(os.Getenv("DEFAULT_LOCALE")); ok {
+			defaultLocale = l
+		}
+	})
+	return defaultLocale
+}
+
+// Match returns the supported locale a client prefers most in an
+// Accept-Language header, or "" when it accepts none of them
+func Match(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if l, ok := Supported(tag); ok && q > bestQ {
+			best, bestQ = l, q
+		}
+	}
+	return best
+}
+
+// Text renders a system message in a locale. vars are placeholder names
+// and values, in pairs.
+func Text(locale, key string, vars ...string) string {
+	text, ok := catalogs[locale].Messages[key]
+	if !ok {
+		if text, ok = catalogs[English].Messages[key]; !ok {
+			text = key
+		}
+	}
+	for i := 0; i+1 < len(vars); i += 2 {
+		text = strings.ReplaceAll(text, "{"+vars[i]+"}", vars[i+1])
+	}
+	return text
+}
+
+// Error translates an English error string, reporting whether the locale
+// has a translation for it
+func Error(locale, message string) (string, bool) {
+	text, ok := catalogs[locale].Errors[message]
+	return text, ok
+}
+
+// TeamLocale returns the locale of a team's system messages
+func TeamLocale(ctx context.Context, db *sql.DB, teamID int64) (string, error) {
+	var locale string
+	err := db.QueryRowContext(ctx, `SELECT locale FROM teams WHERE team_id = ?`, teamID).Scan(&locale)
+	return teamLocale(locale), err
+}
+
+// ChannelLocale returns the locale of the system messages of a channel's
+// team
+func ChannelLocale(ctx context.Context, db *sql.DB, channelID int64) (string, error) {
+	var locale string
+	err := db.QueryRowContext(ctx, `
+		SELECT t.locale FROM channels c
+		INNER JOIN teams t ON t.team_id = c.team_id
+		WHERE c.channel_id = ?`, channelID).Scan(&locale)
+	return teamLocale(locale), err
+}
+
+func teamLocale(locale string) string {
+	if _, ok := catalogs[locale]; ok {
+		return locale
+	}
+	return Default()
+}
@@ -0,0 +1,410 @@
+package limits
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// Scopes limits can be set for. Team limits override their workspace's,
+// which override the deployment defaults.
+const (
+	ScopeWorkspace = "workspace"
+	ScopeTeam      = "team"
+)
+
+// Codes of the limits a request can exceed, returned to clients
+const (
+	CodeMembers = "member_limit_exceeded"
+	CodeStorage = "storage_quota_exceeded"
+)
+
+// ErrInvalidLimits is returned when setting negative limits or an unknown
+// scope
+var ErrInvalidLimits = errors.New("limits must be zero (unlimited) or positive")
+
+// Limits are the plan limits of a team. Zero means unlimited.
+type Limits struct {
+	MaxTeamMembers int `json:"max_team_members"`
+	// MessageHistoryDays hides older messages from reads without deleting
+	// them, so raising the limit brings them back
+	MessageHistoryDays int   `json:"message_history_days"`
+	StorageBytes       int64 `json:"storage_bytes"`
+}
+
+// Override sets some limits of a workspace or team. Nil fields inherit.
+type Override struct {
+	MaxTeamMembers     *int   `json:"max_team_members"`
+	MessageHistoryDays *int   `json:"message_history_days"`
+	StorageBytes       *int64 `json:"storage_bytes"`
+}
+
+// ExceededError is returned when a change would exceed a limit
+type ExceededError struct {
+	Code  string
+	Limit int64
+	Used  int64
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Code {
+	case CodeMembers:
+		return fmt.Sprintf("the team has reached its limit of %d members", e.Limit)
+	case CodeStorage:
+		return fmt.Sprintf("the team has used %d of its %d bytes of file storage", e.Used, e.Limit)
+	}
+	return "plan limit exceeded"
+}
+
+// Body is the JSON error response for the error
+func (e *ExceededError) Body() map[string]interface{} {
+	return map[string]interface{}{"error": e.Error(), "code": e.Code, "limit": e.Limit, "used": e.Used}
+}
+
+// SetHeaders adds the quota headers of the limit that was exceeded
+func (e *ExceededError) SetHeaders(h http.Header) {
+	switch e.Code {
+	case CodeMembers:
+		setQuota(h, HeaderMembersLimit, HeaderMembersRemaining, e.Limit, e.Used)
+	case CodeStorage:
+		setQuota(h, HeaderStorageLimit, HeaderStorageRemaining, e.Limit, e.Used)
+	}
+}
+
+// Headers carrying a team's plan quota on responses that use it. Unlimited
+// quotas are left out.
+const (
+	HeaderMembersLimit     = "X-Quota-Members-Limit"
+	HeaderMembersRemaining = "X-Quota-Members-Remaining"
+	HeaderStorageLimit     = "X-Quota-Storage-Limit"
+	HeaderStorageRemaining = "X-Quota-Storage-Remaining"
+	HeaderHistoryDays      = "X-Quota-History-Days"
+)
+
+// SetHeaders adds the quota headers for limits and the usage against them
+func SetHeaders(h http.Header, l Limits, u Usage) {
+	if l.MaxTeamMembers > 0 {
+		setQuota(h, HeaderMembersLimit, HeaderMembersRemaining, int64(l.MaxTeamMembers), u.Members)
+	}
+	if l.StorageBytes > 0 {
+		setQuota(h, HeaderStorageLimit, HeaderStorageRemaining, l.StorageBytes, u.StorageBytes)
+	}
+	if l.MessageHistoryDays > 0 {
+		h.Set(HeaderHistoryDays, strconv.Itoa(l.MessageHistoryDays))
+	}
+}
+
+// WriteHeaders looks up a team's limits and usage and adds their quota
+// headers
+func WriteHeaders(ctx context.Context, db *sql.DB, h http.Header, teamID int64) error {
+	l, err := For(ctx, db, teamID)
+	if err != nil {
+		return err
+	}
+	if l == (Limits{}) {
+		return nil
+	}
+	u, err := GetUsage(ctx, db, teamID)
+	if err != nil {
+		return err
+	}
+	SetHeaders(h, l, u)
+	return nil
+}
+
+func setQuota(h http.Header, limitHeader, remainingHeader string, limit, used int64) {
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	h.Set(limitHeader, strconv.FormatInt(limit, 10))
+	h.Set(remainingHeader, strconv.FormatInt(remaining, 10))
+}
+
+var (
+	defaultsOnce sync.Once
+	defaults     Limits
+)
+
+// Defaults returns the deployment defaults: PLAN_MAX_TEAM_MEMBERS,
+// PLAN_MESSAGE_HISTORY_DAYS and PLAN_STORAGE_BYTES, all unlimited when
+// unset
+func Defaults() Limits {
+	defaultsOnce.Do(func() {
+		defaults = Limits{
+			MaxTeamMembers:     int(envInt("PLAN_MAX_TEAM_MEMBERS")),
+			MessageHistoryDays: int(envInt("PLAN_MESSAGE_HISTORY_DAYS")),
+			StorageBytes:       envInt("PLAN_STORAGE_BYTES"),
+		}
+	})
+	return defaults
+}
+
+func envInt(name string) int64 {
+	if v, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 0
+}
+
+func (l Limits) apply(o Override) Limits {
+	if o.MaxTeamMembers != nil {
+		l.MaxTeamMembers = *o.MaxTeamMembers
+	}
+	if o.MessageHistoryDays != nil {
+		l.MessageHistoryDays = *o.MessageHistoryDays
+	}
+	if o.StorageBytes != nil {
+		l.StorageBytes = *o.StorageBytes
+	}
+	return l
+}
+
+// overridesTTL bounds how long another process may apply old limits
+const overridesTTL = 30 * time.Second
+
+// overrides caches the whole plan_limits table, which has a row only for
+// workspaces and teams with custom limits
+var overrides struct {
+	sync.Mutex
+	loadedAt time.Time
+	rows     map[string]Override
+}
+
+func overrideKey(scope string, id int64) string {
+	return scope + ":" + strconv.FormatInt(id, 10)
+}
+
+func loadOverrides(ctx context.Context) (map[string]Override, error) {
+	overrides.Lock()
+	defer overrides.Unlock()
+	if overrides.rows != nil && time.Since(overrides.loadedAt) <= overridesTTL {
+		return overrides.rows, nil
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT scope, subject_id, max_team_members, message_history_days, storage_bytes
+		FROM plan_limits`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := make(map[string]Override)
+	for rows.Next() {
+		var scope string
+		var id int64
+		var members, days, storage sql.NullInt64
+		if err := rows.Scan(&scope, &id, &members, &days, &storage); err != nil {
+			return nil, err
+		}
+		var o Override
+		if members.Valid {
+			v := int(members.Int64)
+			o.MaxTeamMembers = &v
+		}
+		if days.Valid {
+			v := int(days.Int64)
+			o.MessageHistoryDays = &v
+		}
+		if storage.Valid {
+			o.StorageBytes = &storage.Int64
+		}
+		loaded[overrideKey(scope, id)] = o
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	overrides.rows = loaded
+	overrides.loadedAt = time.Now()
+	return loaded, nil
+}
+
+// teamWorkspaces caches the workspace of each team seen; teams never move
+var teamWorkspaces sync.Map
+
+func teamWorkspace(ctx context.Context, db *sql.DB, teamID int64) (int64, error) {
+	if id, ok := teamWorkspaces.Load(teamID); ok {
+		return id.(int64), nil
+	}
+	var id int64
+	if err := db.QueryRowContext(ctx, `SELECT workspace_id FROM teams WHERE team_id = ?`, teamID).Scan(&id); err != nil {
+		return 0, err
+	}
+	teamWorkspaces.Store(teamID, id)
+	return id, nil
+}
+
+// For returns the limits that apply to a team
+func For(ctx context.Context, db *sql.DB, teamID int64) (Limits, error) {
+	workspaceID, err := teamWorkspace(ctx, db, teamID)
+	if err != nil {
+		return Limits{}, err
+	}
+	return resolve(ctx, teamID, workspaceID)
+}
+
+func resolve(ctx context.Context, teamID, workspaceID int64) (Limits, error) {
+	rows, err := loadOverrides(ctx)
+	if err != nil {
+		return Limits{}, err
+	}
+	l := Defaults()
+	l = l.apply(rows[overrideKey(ScopeWorkspace, workspaceID)])
+	return l.apply(rows[overrideKey(ScopeTeam, teamID)]), nil
+}
+
+// Get returns the limits set on a workspace or team itself, without those
+// it inherits
+func Get(ctx context.Context, scope string, id int64) (Override, error) {
+	rows, err := loadOverrides(ctx)
+	if err != nil {
+		return Override{}, err
+	}
+	return rows[overrideKey(scope, id)], nil
+}
+
+// Set replaces the limits of a workspace or team. Nil fields inherit.
+func Set(ctx context.Context, db *sql.DB, scope string, id int64, o Override) error {
+	if scope != ScopeWorkspace && scope != ScopeTeam {
+		return ErrInvalidLimits
+	}
+	if (o.MaxTeamMembers != nil && *o.MaxTeamMembers < 0) ||
+		(o.MessageHistoryDays != nil && *o.MessageHistoryDays < 0) ||
+		(o.StorageBytes != nil && *o.StorageBytes < 0) {
+		return ErrInvalidLimits
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO plan_limits (scope, subject_id, max_team_members, message_history_days, storage_bytes, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE max_team_members = VALUES(max_team_members),
+			message_history_days = VALUES(message_history_days),
+			storage_bytes = VALUES(storage_bytes), updated_at = VALUES(updated_at)`,
+		scope, id, o.MaxTeamMembers, o.MessageHistoryDays, o.StorageBytes, time.Now().UTC().Unix())
+	if err != nil {
+		return err
+	}
+	overrides.Lock()
+	overrides.rows = nil
+	overrides.Unlock()
+	return nil
+}
+
+// Usage is how much of its limits a team uses
+type Usage struct {
+	Members      int64 `json:"members"`
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+// GetUsage measures a team's usage
+func GetUsage(ctx context.Context, db *sql.DB, teamID int64) (Usage, error) {
+	var u Usage
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_teams_mapper WHERE team_id = ?`, teamID).Scan(&u.Members)
+	if err != nil {
+		return Usage{}, err
+	}
+	u.StorageBytes, err = storageUsed(ctx, db, teamID)
+	return u, err
+}
+
+func storageUsed(ctx context.Context, db *sql.DB, teamID int64) (int64, error) {
+	var used int64
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(a.size_bytes), 0)
+		FROM attachments a
+		INNER JOIN channels c ON c.channel_id = a.channel_id
+		WHERE c.team_id = ?`, teamID).Scan(&used)
+	return used, err
+}
+
+// CheckMembers fails with an *ExceededError if adding members to a team
+// would take it over its member limit
+func CheckMembers(ctx context.Context, db *sql.DB, teamID int64, adding int) error {
+	l, err := For(ctx, db, teamID)
+	if err != nil || l.MaxTeamMembers == 0 {
+		return err
+	}
+	var members int64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_teams_mapper WHERE team_id = ?`, teamID).Scan(&members); err != nil {
+		return err
+	}
+	if members+int64(adding) > int64(l.MaxTeamMembers) {
+		return &ExceededError{Code: CodeMembers, Limit: int64(l.MaxTeamMembers), Used: members}
+	}
+	return nil
+}
+
+// CheckStorage fails with an *ExceededError if storing size more bytes
+// would take a team over its storage quota. Check with a size of 0 before
+// accepting an upload and with its size once it is known.
+func CheckStorage(ctx context.Context, db *sql.DB, teamID, size int64) error {
+	l, err := For(ctx, db, teamID)
+	if err != nil || l.StorageBytes == 0 {
+		return err
+	}
+	used, err := storageUsed(ctx, db, teamID)
+	if err != nil {
+		return err
+	}
+	if used+size > l.StorageBytes || (size == 0 && used >= l.StorageBytes) {
+		return &ExceededError{Code: CodeStorage, Limit: l.StorageBytes, Used: used}
+	}
+	return nil
+}
+
+// HistoryCutoff returns the Unix time before which a team's messages are
+// hidden, or 0 when its whole history is visible
+func HistoryCutoff(ctx context.Context, db *sql.DB, teamID int64, now time.Time) (int64, error) {
+	l, err := For(ctx, db, teamID)
+	if err != nil || l.MessageHistoryDays == 0 {
+		return 0, err
+	}
+	return now.AddDate(0, 0, -l.MessageHistoryDays).Unix(), nil
+}
+
+// HistoryCutoffs returns HistoryCutoff for the team of each channel.
+// Unknown channels are left out.
+func HistoryCutoffs(ctx context.Context, db *sql.DB, channelIDs []int64, now time.Time) (map[int64]int64, error) {
+	cutoffs := make(map[int64]int64, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return cutoffs, nil
+	}
+	args := make([]interface{}, len(channelIDs))
+	for i, id := range channelIDs {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.channel_id, c.team_id, t.workspace_id
+		FROM channels c
+		INNER JOIN teams t ON t.team_id = c.team_id
+		WHERE c.channel_id IN (?`+strings.Repeat(", ?", len(channelIDs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var channelID, teamID, workspaceID int64
+		if err := rows.Scan(&channelID, &teamID, &workspaceID); err != nil {
+			return nil, err
+		}
+		l, err := resolve(ctx, teamID, workspaceID)
+		if err != nil {
+			return nil, err
+		}
+		if l.MessageHistoryDays > 0 {
+			cutoffs[channelID] = now.AddDate(0, 0, -l.MessageHistoryDays).Unix()
+		} else {
+			cutoffs[channelID] = 0
+		}
+	}
+	return cutoffs, rows.Err()
+}
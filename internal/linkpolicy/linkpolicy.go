@@ -0,0 +1,165 @@
+package linkpolicy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Verdicts attached to each link in a message
+const (
+	// Allow marks links to domains on the team's allowlist
+	Allow = "allow"
+	// Warn marks links to domains the team has not reviewed; clients should
+	// show an interstitial before opening them
+	Warn = "warn"
+	// Block marks links to blocklisted domains; they are never unfurled
+	Block = "block"
+)
+
+// ErrInvalidDomain is returned for domains that cannot be stored as a rule
+var ErrInvalidDomain = errors.New("invalid domain")
+
+// ErrInvalidAction is returned for rule actions other than allow and block
+var ErrInvalidAction = errors.New("action must be allow or block")
+
+// Rule allows or blocks a domain and all of its subdomains for a team
+type Rule struct {
+	Domain    string `json:"domain"`
+	Action    string `json:"action"`
+	CreatedBy int64  `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Decision is the outcome of evaluating a link against a team's rules
+type Decision struct {
+	Verdict string `json:"policy"`
+	Domain  string `json:"domain"`
+	Warning string `json:"warning,omitempty"`
+}
+
+// Evaluate decides how a link should be treated in a team. The most specific
+// matching rule wins and block beats allow on the same domain; links that
+// match no rule get a warning.
+func Evaluate(ctx context.Context, db *sql.DB, teamID int64, rawURL string) (Decision, error) {
+	host := hostOf(rawURL)
+	if host == "" {
+		return Decision{Verdict: Block, Warning: "This link could not be parsed."}, nil
+	}
+
+	candidates := parentDomains(host)
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(candidates)), ",")
+	args := []interface{}{teamID}
+	for _, d := range candidates {
+		args = append(args, d)
+	}
+
+	query := `
+		SELECT domain, action FROM team_link_policies
+		WHERE team_id = ? AND domain IN (` + placeholders + `)
+		ORDER BY CHAR_LENGTH(domain) DESC, action = 'block' DESC
+		LIMIT 1
+	`
+	var domain, action string
+	err := db.QueryRowContext(ctx, query, args...).Scan(&domain, &action)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Decision{Verdict: Warn, Domain: host, Warning: "This link goes to " + host + ", which your team has not reviewed."}, nil
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+	if action == Block {
+		return Decision{Verdict: Block, Domain: host, Warning: host + " is blocked by your team's link policy."}, nil
+	}
+	return Decision{Verdict: Allow, Domain: host}, nil
+}
+
+// List returns a team's rules ordered by domain
+func List(ctx context.Context, db *sql.DB, teamID int64) ([]Rule, error) {
+	query := `SELECT domain, action, created_by, created_at FROM team_link_policies WHERE team_id = ? ORDER BY domain`
+	rows, err := db.QueryContext(ctx, query, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []Rule{}
+	for rows.Next() {
+		var rule Rule
+		if err := rows.Scan(&rule.Domain, &rule.Action, &rule.CreatedBy, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// Set creates or replaces the rule for a domain
+func Set(ctx context.Context, db *sql.DB, teamID, userID int64, domain, action string) (Rule, error) {
+	domain = NormalizeDomain(domain)
+	if domain == "" {
+		return Rule{}, ErrInvalidDomain
+	}
+	if action != Allow && action != Block {
+		return Rule{}, ErrInvalidAction
+	}
+
+	rule := Rule{Domain: domain, Action: action, CreatedBy: userID, CreatedAt: time.Now().UTC().Unix()}
+	query := `
+		INSERT INTO team_link_policies (team_id, domain, action, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE action = VALUES(action), created_by = VALUES(created_by), created_at = VALUES(created_at)
+	`
+	_, err := db.ExecContext(ctx, query, teamID, rule.Domain, rule.Action, rule.CreatedBy, rule.CreatedAt)
+	return rule, err
+}
+
+// Delete removes the rule for a domain, reporting whether one existed
+func Delete(ctx context.Context, db *sql.DB, teamID int64, domain string) (bool, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM team_link_policies WHERE team_id = ? AND domain = ?`, teamID, NormalizeDomain(domain))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// NormalizeDomain lowercases a domain and strips any scheme, port, path or
+// leading wildcard. It returns "" when nothing usable remains.
+func NormalizeDomain(domain string) string {
+	domain = strings.TrimSpace(strings.ToLower(domain))
+	if strings.Contains(domain, "://") {
+		domain = hostOf(domain)
+	}
+	if i := strings.IndexAny(domain, "/:"); i >= 0 {
+		domain = domain[:i]
+	}
+	domain = strings.TrimPrefix(domain, "*.")
+	domain = strings.Trim(domain, ".")
+	if domain == "" || len(domain) > 253 || strings.ContainsAny(domain, " *@") || !strings.Contains(domain, ".") {
+		return ""
+	}
+	return domain
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(strings.ToLower(u.Hostname()), ".")
+}
+
+// parentDomains returns host and each parent domain, e.g. a.b.com, b.com, com
+func parentDomains(host string) []string {
+	domains := []string{host}
+	for i := 0; i < len(host); i++ {
+		if host[i] == '.' {
+			domains = append(domains, host[i+1:])
+		}
+	}
+	return domains
+}
@@ -0,0 +1,184 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failures are counted separately for the account being logged into and for
+// the address the attempts come from, so both guessing one password and
+// spraying many accounts from one address lead to a lockout
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// Config controls login lockouts
+type Config struct {
+	// MaxAccountFailures and MaxIPFailures are how many failed attempts lock
+	// an account or address out; 0 disables that scope
+	MaxAccountFailures int
+	MaxIPFailures      int
+	// BaseLockout is the length of the first lockout. Each further failure
+	// doubles it, up to MaxLockout.
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// Reset is how long without failures it takes for the count to start over
+	Reset time.Duration
+}
+
+// LockedError is returned for login attempts while the account or address is
+// locked out
+type LockedError struct {
+	Scope string
+	Until int64
+}
+
+func (e *LockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// RetryAfter is how many seconds are left until the lockout ends
+func (e *LockedError) RetryAfter(now time.Time) int64 {
+	return max(e.Until-now.Unix(), 1)
+}
+
+var (
+	configOnce sync.Once
+	config     Config
+)
+
+// LoadConfig reads the settings from the environment: LOGIN_MAX_FAILURES
+// (default 5), LOGIN_MAX_IP_FAILURES (default 50), LOGIN_LOCKOUT_SECONDS
+// (default 60), LOGIN_MAX_LOCKOUT_SECONDS (default 3600) and
+// LOGIN_FAILURE_RESET_SECONDS (default 3600)
+func LoadConfig() Config {
+	configOnce.Do(func() {
+		config = Config{
+			MaxAccountFailures: envInt("LOGIN_MAX_FAILURES", 5),
+			MaxIPFailures:      envInt("LOGIN_MAX_IP_FAILURES", 50),
+			BaseLockout:        time.Duration(envInt("LOGIN_LOCKOUT_SECONDS", 60)) * time.Second,
+			MaxLockout:         time.Duration(envInt("LOGIN_MAX_LOCKOUT_SECONDS", 3600)) * time.Second,
+			Reset:              time.Duration(envInt("LOGIN_FAILURE_RESET_SECONDS", 3600)) * time.Second,
+		}
+	})
+	return config
+}
+
+// Check returns a *LockedError if the account or the address is locked out.
+// It runs before the password is verified, so a locked out attempt learns
+// nothing about the password.
+func Check(ctx context.Context, db *sql.DB, email, ip string, now time.Time) error {
+	query := `
+		SELECT scope, locked_until FROM login_failures
+		WHERE ((scope = ? AND subject = ?) OR (scope = ? AND subject = ?)) AND locked_until > ?
+		ORDER BY locked_until DESC LIMIT 1
+	`
+	var locked LockedError
+	err := db.QueryRowContext(ctx, query, ScopeAccount, accountSubject(email), ScopeIP, ip, now.Unix()).Scan(&locked.Scope, &locked.Until)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &locked
+}
+
+// RecordFailure counts a failed attempt against the account and the address
+// and returns how many failures the account has now. If the failure crosses
+// a limit it also returns a *LockedError for the longest resulting lockout.
+func RecordFailure(ctx context.Context, db *sql.DB, email, ip string, now time.Time) (int, error) {
+	cfg := LoadConfig()
+	accountFailures, accountLock, err := recordFailure(ctx, db, cfg, ScopeAccount, accountSubject(email), cfg.MaxAccountFailures, now)
+	if err != nil {
+		return 0, err
+	}
+	var ipLock *LockedError
+	if ip != "" {
+		if _, ipLock, err = recordFailure(ctx, db, cfg, ScopeIP, ip, cfg.MaxIPFailures, now); err != nil {
+			return accountFailures, err
+		}
+	}
+	if ipLock != nil && (accountLock == nil || ipLock.Until > accountLock.Until) {
+		return accountFailures, ipLock
+	}
+	if accountLock != nil {
+		return accountFailures, accountLock
+	}
+	return accountFailures, nil
+}
+
+// RecordSuccess forgets the failures of an account after a successful login
+// and returns how many there were. Failures from the address are kept, since
+// one address guessing many accounts may get some right.
+func RecordSuccess(ctx context.Context, db *sql.DB, email string) (int, error) {
+	var failures int
+	query := `SELECT failures FROM login_failures WHERE scope = ? AND subject = ?`
+	err := db.QueryRowContext(ctx, query, ScopeAccount, accountSubject(email)).Scan(&failures)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = db.ExecContext(ctx, `DELETE FROM login_failures WHERE scope = ? AND subject = ?`, ScopeAccount, accountSubject(email))
+	return failures, err
+}
+
+func recordFailure(ctx context.Context, db *sql.DB, cfg Config, scope, subject string, limit int, now time.Time) (int, *LockedError, error) {
+	// failures is assigned before last_failure_at, so the reset check still
+	// sees the previous failure time
+	query := `
+		INSERT INTO login_failures (scope, subject, failures, locked_until, last_failure_at)
+		VALUES (?, ?, 1, 0, ?)
+		ON DUPLICATE KEY UPDATE
+			failures = IF(last_failure_at < ?, 1, failures + 1),
+			last_failure_at = VALUES(last_failure_at)
+	`
+	_, err := db.ExecContext(ctx, query, scope, subject, now.Unix(), now.Add(-cfg.Reset).Unix())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var failures int
+	query = `SELECT failures FROM login_failures WHERE scope = ? AND subject = ?`
+	if err := db.QueryRowContext(ctx, query, scope, subject).Scan(&failures); err != nil {
+		return 0, nil, err
+	}
+	if limit <= 0 || failures < limit {
+		return failures, nil, nil
+	}
+
+	lock := &LockedError{Scope: scope, Until: now.Add(lockoutFor(cfg, failures-limit)).Unix()}
+	query = `UPDATE login_failures SET locked_until = ? WHERE scope = ? AND subject = ?`
+	if _, err := db.ExecContext(ctx, query, lock.Until, scope, subject); err != nil {
+		return failures, nil, err
+	}
+	return failures, lock, nil
+}
+
+// lockoutFor doubles the base lockout for every failure past the limit
+func lockoutFor(cfg Config, past int) time.Duration {
+	lockout := cfg.BaseLockout
+	for i := 0; i < past && lockout < cfg.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, cfg.MaxLockout)
+}
+
+func accountSubject(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
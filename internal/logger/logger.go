@@ -2,7 +2,9 @@ package logger
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,6 +17,110 @@ type Logger struct {
 	serviceName string
 }
 
+// level is shared by every logger, so changing it applies to all of them
+var level = zap.NewAtomicLevelAt(defaultLevel())
+
+// override is a temporary level set by an operator; configured is the level
+// it reverts to
+var override struct {
+	sync.Mutex
+	configured zapcore.Level
+	until      time.Time
+	timer      *time.Timer
+}
+
+func init() {
+	override.configured = level.Level()
+}
+
+// LevelState is the level loggers use, and the configured one it reverts to
+// when it is a temporary override
+type LevelState struct {
+	Level      string     `json:"level"`
+	Configured string     `json:"configured"`
+	Until      *time.Time `json:"until,omitempty"`
+}
+
+// Level returns the current log level
+func Level() LevelState {
+	override.Lock()
+	defer override.Unlock()
+	state := LevelState{Level: level.String(), Configured: override.configured.String()}
+	if override.timer != nil {
+		until := override.until
+		state.Until = &until
+	}
+	return state
+}
+
+// SetLevelFor switches every logger to a level, for example debug, for d,
+// then back to the configured level. A new override replaces the previous
+// one.
+func SetLevelFor(name string, d time.Duration) (LevelState, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return Level(), fmt.Errorf("unknown log level %q", name)
+	}
+	override.Lock()
+	if override.timer != nil {
+		override.timer.Stop()
+	}
+	override.until = time.Now().Add(d).UTC()
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		override.Lock()
+		defer override.Unlock()
+		// A later override owns the level now
+		if override.timer == timer {
+			override.timer = nil
+			level.SetLevel(override.configured)
+		}
+	})
+	override.timer = timer
+	level.SetLevel(l)
+	override.Unlock()
+	return Level(), nil
+}
+
+// RevertLevel ends a temporary override early
+func RevertLevel() LevelState {
+	override.Lock()
+	if override.timer != nil {
+		override.timer.Stop()
+		override.timer = nil
+	}
+	level.SetLevel(override.configured)
+	override.Unlock()
+	return Level()
+}
+
+// defaultLevel is debug in development and info elsewhere
+func defaultLevel() zapcore.Level {
+	if env := os.Getenv("APP_ENV"); env == "" || env == "development" {
+		return zap.DebugLevel
+	}
+	return zap.InfoLevel
+}
+
+// ReloadLevel sets the level of every logger from LOG_LEVEL (debug, info,
+// warn or error), or from APP_ENV when it is unset, and returns it. A
+// temporary override stays in effect until it expires.
+func ReloadLevel() (string, error) {
+	l := defaultLevel()
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := l.UnmarshalText([]byte(v)); err != nil {
+			return override.configured.String(), fmt.Errorf("invalid LOG_LEVEL %q", v)
+		}
+	}
+	override.Lock()
+	defer override.Unlock()
+	override.configured = l
+	if override.timer == nil {
+		level.SetLevel(l)
+	}
+	return l.String(), nil
+}
+
 // NewLogger creates a new logger instance for a specific service
 func NewLogger(serviceName string) *Logger {
 	// Get environment - default to development if not specified
@@ -49,17 +155,11 @@ func NewLogger(serviceName string) *Logger {
 		encoder = zapcore.NewConsoleEncoder(encoderConfig)
 	}
 
-	// Configure log level
-	logLevel := zap.InfoLevel
-	if env == "development" {
-		logLevel = zap.DebugLevel
-	}
-
 	// Create core
 	core := zapcore.NewCore(
 		encoder,
 		zapcore.AddSync(os.Stdout),
-		zap.NewAtomicLevelAt(logLevel),
+		level,
 	)
 
 	// Create logger with caller information
@@ -72,16 +172,35 @@ func NewLogger(serviceName string) *Logger {
 	}
 }
 
-// WithContext returns a logger with request context fields added
+type contextKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying extra key/value pairs that
+// WithContext attaches to every log line. Middleware and services call this as
+// tenant identifiers (user, team, channel) are resolved during a request.
+func ContextWithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]interface{})
+	fields := make([]interface{}, 0, len(existing)+len(keysAndValues))
+	fields = append(fields, existing...)
+	fields = append(fields, keysAndValues...)
+	return context.WithValue(ctx, contextKey{}, fields)
+}
+
+// FieldsFromContext returns the log fields stored on ctx
+func FieldsFromContext(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(contextKey{}).([]interface{})
+	return fields
+}
+
+// WithContext returns a logger with the request context fields added
 func (l *Logger) WithContext(ctx context.Context) *Logger {
-	// Extract request ID if present
-	if requestID, ok := ctx.Value("request_id").(string); ok {
-		return &Logger{
-			SugaredLogger: l.With("request_id", requestID),
-			serviceName:   l.serviceName,
-		}
+	fields := FieldsFromContext(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return &Logger{
+		SugaredLogger: l.With(fields...),
+		serviceName:   l.serviceName,
 	}
-	return l
 }
 
 // WithUser returns a logger with user ID added
@@ -0,0 +1,192 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// LogMailer writes messages to the log instead of sending them. It is the
+// default for local development.
+type LogMailer struct {
+	Log *logger.Logger
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.Log.Info("Email (not sent)", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
+
+// SMTPMailer sends mail through an SMTP relay using STARTTLS when offered.
+// Amazon SES can be used through its SMTP interface with this backend.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	port := m.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	body, err := buildMIME(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp has no context support, so run it in the background and
+	// abandon it if the context expires
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.From, []string{msg.To}, body)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildMIME renders msg as a multipart/alternative message when it has an
+// HTML part, or plain text otherwise
+func buildMIME(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := []string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + sanitizeHeader(msg.Subject),
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z),
+		"Message-ID: " + messageID(from),
+		"MIME-Version: 1.0",
+	}
+
+	if msg.HTML == "" {
+		headers = append(headers, "Content-Type: text/plain; charset=UTF-8")
+		buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+		buf.WriteString(msg.Text)
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	headers = append(headers, "Content-Type: multipart/alternative; boundary="+writer.Boundary())
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// sanitizeHeader prevents header injection through user-supplied subjects
+func sanitizeHeader(v string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(v)
+}
+
+func messageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "eaven.local"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// SendGridMailer sends mail through the SendGrid v3 HTTP API
+type SendGridMailer struct {
+	APIKey string
+	From   string
+	Client *http.Client
+}
+
+const sendGridEndpoint = "https://api.sendgrid.com/v3/mail/send"
+
+func (m *SendGridMailer) Send(ctx context.Context, msg Message) error {
+	type address struct {
+		Email string `json:"email"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	payload := struct {
+		Personalizations []map[string][]address `json:"personalizations"`
+		From             address                `json:"from"`
+		Subject          string                 `json:"subject"`
+		Content          []content              `json:"content"`
+	}{
+		Personalizations: []map[string][]address{{"to": {{Email: msg.To}}}},
+		From:             address{Email: m.From},
+		Subject:          msg.Subject,
+		Content:          []content{{Type: "text/plain", Value: msg.Text}},
+	}
+	if msg.HTML != "" {
+		payload.Content = append(payload.Content, content{Type: "text/html", Value: msg.HTML})
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridEndpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("sendgrid returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
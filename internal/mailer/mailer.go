@@ -0,0 +1,166 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/deadletter"
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// DeadLetterKind identifies undeliverable email in the dead-letter store
+const DeadLetterKind = "email"
+
+const (
+	queueSize   = 256
+	maxAttempts = 4
+	baseBackoff = 2 * time.Second
+)
+
+// ErrNotStarted is returned when mail is sent before Start
+var ErrNotStarted = errors.New("mailer not started")
+
+// Message is a single outbound email
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// Mailer delivers email through a provider
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type job struct {
+	msg      Message
+	attempts int
+}
+
+// Queue sends mail asynchronously and retries failed deliveries with
+// exponential backoff before dead-lettering them
+type Queue struct {
+	Mailer Mailer
+	From   string
+	Log    *logger.Logger
+	jobs   chan job
+}
+
+var defaultQueue *Queue
+
+// Start configures the mail backend from the environment and launches the
+// send workers. MAIL_DRIVER selects smtp, sendgrid or log (the default, which
+// only logs messages). MAIL_FROM sets the sender address.
+func Start() error {
+	log := logger.NewLogger("mailer")
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@eaven.local"
+	}
+
+	var backend Mailer
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "log":
+		backend = &LogMailer{Log: log}
+	case "smtp":
+		port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		backend = &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "sendgrid":
+		backend = &SendGridMailer{APIKey: os.Getenv("SENDGRID_API_KEY"), From: from}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+
+	workers := 2
+	if v, err := strconv.Atoi(os.Getenv("MAIL_WORKERS")); err == nil && v > 0 {
+		workers = v
+	}
+
+	q := &Queue{Mailer: backend, From: from, Log: log, jobs: make(chan job, queueSize)}
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+	defaultQueue = q
+
+	// Replaying a dead-lettered email sends it once, synchronously
+	deadletter.RegisterReplayer(DeadLetterKind, func(ctx context.Context, payload json.RawMessage) error {
+		var msg Message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return err
+		}
+		return q.Mailer.Send(ctx, msg)
+	})
+
+	log.Info("Mailer started", "driver", fmt.Sprintf("%T", backend), "workers", workers)
+	return nil
+}
+
+// Send queues msg for asynchronous delivery
+func Send(msg Message) error {
+	if defaultQueue == nil {
+		return ErrNotStarted
+	}
+	return defaultQueue.enqueue(job{msg: msg})
+}
+
+// SendTemplate renders the named template with data and queues the result.
+// Rendering errors are returned immediately.
+func SendTemplate(to, name string, data interface{}) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	return Send(msg)
+}
+
+func (q *Queue) enqueue(j job) error {
+	select {
+	case q.jobs <- j:
+		return nil
+	default:
+		return errors.New("mail queue is full")
+	}
+}
+
+func (q *Queue) run() {
+	for j := range q.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := q.Mailer.Send(ctx, j.msg)
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		j.attempts++
+		if j.attempts >= maxAttempts {
+			q.Log.Error("Giving up on email", "to", j.msg.To, "subject", j.msg.Subject, "attempts", j.attempts, "error", err)
+			if dlErr := deadletter.Record(context.Background(), DeadLetterKind, j.msg, err, j.attempts); dlErr != nil {
+				q.Log.Error("Failed to dead-letter email", "error", dlErr)
+			}
+			continue
+		}
+
+		// Retry later without holding up the worker
+		backoff := baseBackoff << (j.attempts - 1)
+		q.Log.Warn("Email delivery failed, retrying", "to", j.msg.To, "attempt", j.attempts, "backoff", backoff, "error", err)
+		retry := j
+		time.AfterFunc(backoff, func() {
+			if err := q.enqueue(retry); err != nil {
+				q.Log.Error("Failed to requeue email", "to", retry.msg.To, "error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Each template is a <name>.txt file defining a "subject" block plus the
+// plain-text body, and an optional <name>.html with the HTML body.
+//
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	templatesMu sync.Mutex
+	textCache   = make(map[string]*template.Template)
+	htmlCache   = make(map[string]*htmltemplate.Template)
+)
+
+// Render executes the named template with data and returns the resulting
+// message without a recipient
+func Render(name string, data interface{}) (Message, error) {
+	textTmpl, htmlTmpl, err := load(name)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, text bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s subject: %v", name, err)
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s text: %v", name, err)
+	}
+	msg := Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimLeft(text.String(), "\n"),
+	}
+
+	if htmlTmpl != nil {
+		var html bytes.Buffer
+		if err := htmlTmpl.Execute(&html, data); err != nil {
+			return Message{}, fmt.Errorf("failed to render %s html: %v", name, err)
+		}
+		msg.HTML = html.String()
+	}
+	return msg, nil
+}
+
+func load(name string) (*template.Template, *htmltemplate.Template, error) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	if t, ok := textCache[name]; ok {
+		return t, htmlCache[name], nil
+	}
+
+	textTmpl, err := template.ParseFS(templateFS, "templates/"+name+".txt")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown email template %q: %v", name, err)
+	}
+	textCache[name] = textTmpl
+
+	if htmlTmpl, err := htmltemplate.ParseFS(templateFS, "templates/"+name+".html"); err == nil {
+		htmlCache[name] = htmlTmpl
+	}
+	return textTmpl, htmlCache[name], nil
+}
+
+// Link returns an absolute URL for path, for use in email bodies.
+// APP_BASE_URL is the public address of the API (default
+// http://localhost:8080).
+func Link(path string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimRight(base, "/") + path
+}
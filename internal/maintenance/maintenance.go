@@ -0,0 +1,95 @@
+// Package maintenance holds the deployment-wide maintenance mode. While it
+// is on, the API rejects writes with 503 and a Retry-After, so a deploy or
+// migration can run against a quiet database; reads keep working.
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// DefaultRetryAfter is how long clients are told to wait when the admin who
+// turned maintenance on gave no estimate
+const DefaultRetryAfter = 60
+
+// DefaultMessage is the error of rejected requests when maintenance was
+// turned on without a message
+const DefaultMessage = "The service is undergoing maintenance. Please try again later."
+
+// State is the maintenance mode of the deployment
+type State struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	// RetryAfterSeconds is sent as Retry-After with rejected requests
+	RetryAfterSeconds int   `json:"retry_after_seconds,omitempty"`
+	StartedBy         int64 `json:"started_by,omitempty"`
+	StartedAt         int64 `json:"started_at,omitempty"`
+}
+
+// stateTTL bounds how long another process may keep serving writes after
+// maintenance is turned on
+const stateTTL = 5 * time.Second
+
+var cached struct {
+	sync.Mutex
+	loadedAt time.Time
+	state    *State
+}
+
+// Current returns the maintenance mode, read at most every few seconds
+func Current(ctx context.Context) (State, error) {
+	cached.Lock()
+	defer cached.Unlock()
+	if cached.state != nil && time.Since(cached.loadedAt) <= stateTTL {
+		return *cached.state, nil
+	}
+
+	var s State
+	err := database.DB.QueryRowContext(ctx, `
+		SELECT message, retry_after_seconds, started_by, started_at
+		FROM maintenance_mode WHERE id = 1`).Scan(&s.Message, &s.RetryAfterSeconds, &s.StartedBy, &s.StartedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return State{}, err
+	}
+	s.Enabled = err == nil
+	cached.state = &s
+	cached.loadedAt = time.Now()
+	return s, nil
+}
+
+// Enable turns maintenance mode on, or updates its message and retry delay
+// when it is already on
+func Enable(ctx context.Context, db *sql.DB, message string, retryAfterSeconds int, startedBy int64) error {
+	if retryAfterSeconds <= 0 {
+		retryAfterSeconds = DefaultRetryAfter
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO maintenance_mode (id, message, retry_after_seconds, started_by, started_at) VALUES (1, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE message = VALUES(message), retry_after_seconds = VALUES(retry_after_seconds)`,
+		message, retryAfterSeconds, startedBy, time.Now().UTC().Unix())
+	if err != nil {
+		return err
+	}
+	invalidate()
+	return nil
+}
+
+// Disable turns maintenance mode off
+func Disable(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM maintenance_mode WHERE id = 1`); err != nil {
+		return err
+	}
+	invalidate()
+	return nil
+}
+
+func invalidate() {
+	cached.Lock()
+	cached.state = nil
+	cached.Unlock()
+}
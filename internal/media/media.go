@@ -0,0 +1,387 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	// Decoders for the image formats thumbnails are made from
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/scan"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// Media statuses of attachments
+const (
+	// StatusNone attachments are not images or videos
+	StatusNone    = "none"
+	StatusPending = "pending"
+	// StatusDone attachments have been processed, whether or not metadata
+	// could be read from them
+	StatusDone = "done"
+)
+
+const (
+	// ThumbnailSize bounds the longer edge of thumbnails in pixels
+	ThumbnailSize = 320
+	// maxPixels refuses to decode images large enough to exhaust memory
+	maxPixels = 50_000_000
+
+	pollInterval = 10 * time.Second
+	claimTTL     = 5 * time.Minute
+	fileTimeout  = 2 * time.Minute
+	batchSize    = 20
+)
+
+// StatusFor returns the media status a new attachment starts with
+func StatusFor(contentType string) string {
+	if strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") {
+		return StatusPending
+	}
+	return StatusNone
+}
+
+// ThumbnailURL is where clients download an attachment's thumbnail
+func ThumbnailURL(attachmentID int64) string {
+	return "/attachments/" + strconv.FormatInt(attachmentID, 10) + "/thumbnail"
+}
+
+// wake lets uploads in this process start processing without waiting for
+// the next poll
+var wake = make(chan struct{}, 1)
+
+// Enqueue tells this process's worker that an attachment is waiting
+func Enqueue() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Worker extracts media metadata and makes thumbnails for uploaded images
+// and videos. Files wait until their virus scan has passed.
+type Worker struct {
+	DB      *sql.DB
+	Log     *logger.Logger
+	Storage storage.Storage
+}
+
+// Start launches the media worker. MEDIA_PROCESSING=off disables it, leaving
+// new images and videos pending.
+func Start() {
+	if os.Getenv("MEDIA_PROCESSING") == "off" {
+		return
+	}
+	w := &Worker{
+		DB:      database.DB,
+		Log:     logger.NewLogger("media-worker"),
+		Storage: storage.Default(),
+	}
+	go w.run()
+}
+
+func (w *Worker) run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+		for {
+			n, err := w.ProcessPending(context.Background(), time.Now().UTC())
+			if err != nil {
+				w.Log.Error("Failed to process media", "error", err)
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+	}
+}
+
+type pending struct {
+	attachmentID int64
+	contentType  string
+	key          string
+	size         int64
+}
+
+// ProcessPending handles up to batchSize pending attachments whose scan has
+// passed and returns how many it claimed
+func (w *Worker) ProcessPending(ctx context.Context, now time.Time) (int, error) {
+	stale := now.Add(-claimTTL).Unix()
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT attachment_id, content_type, storage_key, size_bytes
+		FROM attachments
+		WHERE media_status = ? AND scan_status IN (?, ?) AND media_claimed_at < ?
+		ORDER BY attachment_id
+		LIMIT ?`, StatusPending, scan.StatusClean, scan.StatusUnscanned, stale, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.attachmentID, &p.contentType, &p.key, &p.size); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	claimed := 0
+	for _, p := range batch {
+		// Claim the file so concurrent workers process it once
+		claim, err := w.DB.ExecContext(ctx, `
+			UPDATE attachments SET media_claimed_at = ?
+			WHERE attachment_id = ? AND media_status = ? AND media_claimed_at < ?`,
+			now.Unix(), p.attachmentID, StatusPending, stale)
+		if err != nil {
+			return claimed, err
+		}
+		if n, err := claim.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		claimed++
+		// A storage failure leaves the file pending until its claim expires
+		if err := w.process(ctx, p); err != nil {
+			w.Log.Error("Failed to process attachment media", "error", err, "attachment_id", p.attachmentID)
+		}
+	}
+	return claimed, nil
+}
+
+func (w *Worker) process(ctx context.Context, p pending) error {
+	ctx, cancel := context.WithTimeout(ctx, fileTimeout)
+	defer cancel()
+
+	object, err := w.Storage.Open(ctx, p.key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return w.record(ctx, p.attachmentID, models.Media{}, "")
+	}
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	// Files that cannot be read as media are recorded without metadata
+	// rather than retried
+	var meta models.Media
+	var thumbnailKey string
+	switch {
+	case strings.HasPrefix(p.contentType, "image/"):
+		var thumb []byte
+		meta, thumb, err = processImage(object)
+		if err != nil {
+			w.Log.Debug("Failed to decode image", "error", err, "attachment_id", p.attachmentID)
+			break
+		}
+		thumbnailKey = storage.NewKey()
+		if _, err := w.Storage.Put(ctx, thumbnailKey, bytes.NewReader(thumb)); err != nil {
+			return err
+		}
+	case p.contentType == "video/mp4" || p.contentType == "video/quicktime":
+		meta.Width, meta.Height, meta.DurationMS, err = probeMP4(object, object.Size())
+		if err != nil {
+			w.Log.Debug("Failed to read video metadata", "error", err, "attachment_id", p.attachmentID)
+			meta = models.Media{}
+		}
+	}
+	return w.record(ctx, p.attachmentID, meta, thumbnailKey)
+}
+
+func (w *Worker) record(ctx context.Context, attachmentID int64, meta models.Media, thumbnailKey string) error {
+	_, err := w.DB.ExecContext(ctx, `
+		UPDATE attachments
+		SET media_status = ?, media_width = ?, media_height = ?, media_duration_ms = ?, thumbnail_key = ?
+		WHERE attachment_id = ?`,
+		StatusDone, meta.Width, meta.Height, meta.DurationMS, thumbnailKey, attachmentID)
+	return err
+}
+
+// processImage reads an image's dimensions and renders its JPEG thumbnail
+func processImage(object storage.Object) (models.Media, []byte, error) {
+	cfg, _, err := image.DecodeConfig(object)
+	if err != nil {
+		return models.Media{}, nil, err
+	}
+	meta := models.Media{Width: cfg.Width, Height: cfg.Height}
+	if cfg.Width*cfg.Height > maxPixels {
+		return meta, nil, errors.New("image is too large to thumbnail")
+	}
+	if _, err := object.Seek(0, 0); err != nil {
+		return meta, nil, err
+	}
+	img, _, err := image.Decode(object)
+	if err != nil {
+		return meta, nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumbnail(img, ThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return meta, nil, err
+	}
+	return meta, buf.Bytes(), nil
+}
+
+// thumbnail scales src down to fit within size pixels by averaging the
+// source pixels under each thumbnail pixel. Transparency is flattened onto
+// white, since JPEG has none.
+func thumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// Colors are premultiplied, so adding the missing alpha
+					// composites onto white
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: 0xff})
+		}
+	}
+	return dst
+}
+
+// ForMessages loads the attachments of messages with their media metadata,
+// keyed by message ID
+func ForMessages(ctx context.Context, db *sql.DB, messageIDs []int64) (map[int64][]models.Attachment, error) {
+	attachments := make(map[int64][]models.Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT attachment_id, message_id, channel_id, uploader_id, file_name, content_type, size_bytes, scan_status, created_at,
+			media_status, media_width, media_height, media_duration_ms, thumbnail_key
+		FROM attachments
+		WHERE message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)
+		ORDER BY attachment_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.Attachment
+		var status, thumbnailKey string
+		var meta models.Media
+		err := rows.Scan(&a.AttachmentID, &a.MessageID, &a.ChannelID, &a.UploaderID, (*fieldcrypt.String)(&a.FileName),
+			&a.ContentType, &a.SizeBytes, &a.ScanStatus, &a.CreatedAt,
+			&status, &meta.Width, &meta.Height, &meta.DurationMS, &thumbnailKey)
+		if err != nil {
+			return nil, err
+		}
+		a.Media = Describe(a.AttachmentID, status, meta, thumbnailKey)
+		attachments[a.MessageID] = append(attachments[a.MessageID], a)
+	}
+	return attachments, rows.Err()
+}
+
+// DeleteForMessages deletes the attachment rows of messages in the caller's
+// transaction and returns the storage keys of their files and thumbnails,
+// for DeleteFiles once it commits
+func DeleteForMessages(ctx context.Context, tx *sql.Tx, messageIDs []int64) ([]string, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	placeholders := "?" + strings.Repeat(", ?", len(messageIDs)-1)
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT storage_key, thumbnail_key FROM attachments
+		WHERE message_id IN (`+placeholders+`)
+		FOR UPDATE`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key, thumbnailKey string
+		if err := rows.Scan(&key, &thumbnailKey); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+		if thumbnailKey != "" {
+			keys = append(keys, thumbnailKey)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM attachments WHERE message_id IN (`+placeholders+`)`, args...); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// DeleteFiles deletes the stored files of deleted attachments, going on past
+// failures, and returns the first one. Their rows are gone, so a file left
+// behind is unreachable.
+func DeleteFiles(ctx context.Context, store storage.Storage, keys []string) error {
+	var first error
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Describe returns the media metadata clients see for an attachment, or nil
+// for attachments that are not media. Pending media has no fields set yet.
+func Describe(attachmentID int64, status string, meta models.Media, thumbnailKey string) *models.Media {
+	if status == StatusNone || status == "" {
+		return nil
+	}
+	meta.Pending = status == StatusPending
+	if thumbnailKey != "" {
+		meta.ThumbnailURL = ThumbnailURL(attachmentID)
+	}
+	return &meta
+}
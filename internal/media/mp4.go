@@ -0,0 +1,131 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// errNotMP4 is returned for files without a movie header
+var errNotMP4 = errors.New("no mp4 movie header")
+
+// probeMP4 reads the dimensions and duration of an MP4 or QuickTime file
+// from its moov box without decoding any frames. Width and height come from
+// the first track with a picture.
+func probeMP4(r io.ReadSeeker, size int64) (width, height int, durationMS int64, err error) {
+	var found bool
+	err = walkBoxes(r, 0, size, func(typ string, start, end int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		return walkBoxes(r, start, end, func(typ string, start, end int64) error {
+			switch typ {
+			case "mvhd":
+				ms, err := readMvhd(r, start)
+				if err != nil {
+					return err
+				}
+				durationMS, found = ms, true
+			case "trak":
+				if width != 0 {
+					return nil
+				}
+				return walkBoxes(r, start, end, func(typ string, start, end int64) error {
+					if typ != "tkhd" {
+						return nil
+					}
+					width, height, err = readTkhd(r, start)
+					return err
+				})
+			}
+			return nil
+		})
+	})
+	if err == nil && !found {
+		err = errNotMP4
+	}
+	return width, height, durationMS, err
+}
+
+// walkBoxes calls fn with the type and payload range of every box between
+// start and end
+func walkBoxes(r io.ReadSeeker, start, end int64, fn func(typ string, start, end int64) error) error {
+	var header [16]byte
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		payload := offset + 8
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			payload += 8
+		}
+		if size < payload-offset || offset+size > end {
+			return errNotMP4
+		}
+		if err := fn(typ, payload, offset+size); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+func readAt(r io.ReadSeeker, offset int64, buf []byte) error {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, buf)
+	return err
+}
+
+// readMvhd returns the movie duration in milliseconds
+func readMvhd(r io.ReadSeeker, start int64) (int64, error) {
+	var buf [32]byte
+	if err := readAt(r, start, buf[:]); err != nil {
+		return 0, err
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(buf[20:24]))
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(buf[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	if timescale == 0 {
+		return 0, errNotMP4
+	}
+	return int64(duration * 1000 / timescale), nil
+}
+
+// readTkhd returns a track's display size, stored as 16.16 fixed point after
+// the header fields, whose length depends on the box version
+func readTkhd(r io.ReadSeeker, start int64) (int, int, error) {
+	var version [1]byte
+	if err := readAt(r, start, version[:]); err != nil {
+		return 0, 0, err
+	}
+	offset := start + 4 + 20
+	if version[0] == 1 {
+		offset = start + 4 + 32
+	}
+	// reserved (8), layer, alternate group, volume, reserved (2 each) and
+	// the 36 byte matrix come before the size
+	var size [8]byte
+	if err := readAt(r, offset+8+8+36, size[:]); err != nil {
+		return 0, 0, err
+	}
+	return int(binary.BigEndian.Uint32(size[:4]) >> 16), int(binary.BigEndian.Uint32(size[4:]) >> 16), nil
+}
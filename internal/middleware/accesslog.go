@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// AccessLogConfig controls the access log
+type AccessLogConfig struct {
+	Enabled bool
+	// Samples maps path prefixes to the share of successful requests under
+	// them that are logged, from 0 to 1. The longest matching prefix wins.
+	// Requests that fail with 4xx or 5xx are always logged.
+	Samples map[string]float64
+}
+
+var (
+	accessLogOnce   sync.Once
+	accessLogConfig AccessLogConfig
+	accessLog       = logger.NewLogger("access")
+)
+
+// LoadAccessLogConfig reads the settings from the environment: ACCESS_LOG
+// ("off" disables it) and ACCESS_LOG_SAMPLE, a comma-separated list of
+// prefix=rate pairs such as "/events=0.01,/poll=0.05"
+func LoadAccessLogConfig() AccessLogConfig {
+	accessLogOnce.Do(func() {
+		accessLogConfig = AccessLogConfig{
+			Enabled: os.Getenv("ACCESS_LOG") != "off",
+			Samples: make(map[string]float64),
+		}
+		for _, pair := range strings.Split(os.Getenv("ACCESS_LOG_SAMPLE"), ",") {
+			prefix, rate, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseFloat(rate, 64); err == nil && v >= 0 && v <= 1 {
+				accessLogConfig.Samples[prefix] = v
+			}
+		}
+	})
+	return accessLogConfig
+}
+
+// sampleRate is the share of successful requests to a path that are logged
+func (c AccessLogConfig) sampleRate(path string) float64 {
+	rate, longest := 1.0, -1
+	for prefix, v := range c.Samples {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			rate, longest = v, len(prefix)
+		}
+	}
+	return rate
+}
+
+type accessInfoKey struct{}
+
+// accessInfo collects what inner middleware learns about a request for its
+// access log entry
+type accessInfo struct {
+	userID interface{}
+}
+
+// setAccessUser records the authenticated user for the access log
+func setAccessUser(ctx context.Context, userID interface{}) {
+	if info, ok := ctx.Value(accessInfoKey{}).(*accessInfo); ok {
+		info.userID = userID
+	}
+}
+
+// AccessLog writes one structured entry per request with its method, path,
+// status, latency, bytes written, user and request ID. It wraps the whole
+// router so unmatched routes are logged too.
+func AccessLog(next http.Handler) http.Handler {
+	cfg := LoadAccessLogConfig()
+	if !cfg.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &accessInfo{}
+		rec := &accessRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessInfoKey{}, info)))
+
+		if rec.status < 400 {
+			if rate := cfg.sampleRate(r.URL.Path); rate < 1 && rand.Float64() >= rate {
+				return
+			}
+		}
+		fields := []interface{}{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", rec.bytes,
+			"request_id", w.Header().Get(RequestIDHeader),
+			"remote_ip", ClientIP(r),
+		}
+		if info.userID != nil {
+			fields = append(fields, "user_id", info.userID)
+		}
+		accessLog.Info("request", fields...)
+	})
+}
+
+// accessRecorder captures the status and size of a response. It passes
+// flushes through so event streams keep working.
+type accessRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rec *accessRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status, rec.wroteHeader = code, true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *accessRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *accessRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *accessRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
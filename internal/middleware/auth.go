@@ -2,17 +2,27 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikhil/eaven/internal/accounts"
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/pat"
+	"github.com/nikhil/eaven/internal/workspace"
 )
 
 type ContextKey string
 
 const UserContextKey ContextKey = "currentUser"
 
+var authLog = logger.NewLogger("auth-middleware")
+
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -24,19 +34,84 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 		secretKey := os.Getenv("JWT_SECRET")
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
+		var claims jwt.MapClaims
+		if strings.HasPrefix(tokenStr, pat.Prefix) {
+			t, err := pat.Authenticate(r.Context(), database.DB, tokenStr)
+			if errors.Is(err, pat.ErrUnauthorized) {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to verify access token", http.StatusInternalServerError)
+				return
+			}
+			claims = jwt.MapClaims{"email": t.Email, "user_id": t.UserID, pat.Claim: t.TokenID, pat.ScopesClaim: t.Scopes}
+		} else {
+			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+				return []byte(secretKey), nil
+			})
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+			var ok bool
+			claims, ok = token.Claims.(jwt.MapClaims)
+			if !ok {
+				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+				return
+			}
 		}
-		claims, ok := token.Claims.(jwt.MapClaims)
+		// Tokens issued to an account that has since been merged act as the
+		// account it was merged into
+		if userID, err := strconv.ParseInt(fmt.Sprintf("%v", claims["user_id"]), 10, 64); err == nil {
+			// Impersonation tokens are ended through their session and access
+			// tokens by revoking them instead
+			_, impersonated := claims[ImpersonationClaim]
+			if _, personal := claims[pat.Claim]; !impersonated && !personal {
+				version, _ := strconv.ParseInt(fmt.Sprintf("%v", claims[accounts.TokenVersionClaim]), 10, 64)
+				valid, err := accounts.TokenValid(r.Context(), userID, version)
+				if err != nil {
+					http.Error(w, "Failed to verify token", http.StatusInternalServerError)
+					return
+				}
+				if !valid {
+					http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+					return
+				}
+			}
+			resolved, err := accounts.Resolve(r.Context(), userID)
+			if err != nil {
+				http.Error(w, "Failed to verify account", http.StatusInternalServerError)
+				return
+			}
+			if resolved != userID {
+				claims["user_id"] = resolved
+			}
+			setLocaleUser(r.Context(), resolved)
+			// Accounts only exist in their own workspace
+			ws, err := workspace.OfUser(r.Context(), resolved)
+			if err != nil {
+				http.Error(w, "Failed to verify account", http.StatusInternalServerError)
+				return
+			}
+			if ws != workspace.FromContext(r.Context()) {
+				http.Error(w, "Token belongs to another workspace", http.StatusUnauthorized)
+				return
+			}
+			// Support staff looking at an account do not make its owner online
+			if _, impersonated := claims[ImpersonationClaim]; !impersonated {
+				if err := accounts.Touch(r.Context(), resolved); err != nil {
+					authLog.WithContext(r.Context()).Warn("Failed to record user activity", "error", err, "user_id", resolved)
+				}
+			}
+		}
+		ctx, ok := checkImpersonation(w, r, claims)
 		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
 			return
 		}
-		ctx := context.WithValue(r.Context(), UserContextKey, claims)
+		ctx = context.WithValue(ctx, UserContextKey, claims)
+		ctx = logger.ContextWithFields(ctx, "user_id", claims["user_id"])
+		setAccessUser(ctx, claims["user_id"])
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -47,3 +122,44 @@ func ResponseWrapperMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// AdminMiddleware only lets instance administrators through. It must run
+// after AuthMiddleware so the user claims are on the context.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(jwt.MapClaims)
+		if !ok {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		var isAdmin bool
+		query := "SELECT is_admin FROM users WHERE user_id = ?"
+		if err := database.DB.QueryRowContext(r.Context(), query, claims["user_id"]).Scan(&isAdmin); err != nil || !isAdmin {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireTokenScope lets requests authenticated with a personal access token
+// through only if the token has scope. An empty scope refuses every token.
+// Login tokens always pass. It must run after AuthMiddleware.
+func RequireTokenScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := r.Context().Value(UserContextKey).(jwt.MapClaims)
+		if _, personal := claims[pat.Claim]; personal {
+			scopes, _ := claims[pat.ScopesClaim].([]string)
+			if scope == "" {
+				http.Error(w, "Not available with personal access tokens", http.StatusForbidden)
+				return
+			}
+			if !pat.HasScope(scopes, scope) {
+				http.Error(w, "Access token lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nikhil/eaven/internal/limits"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+// corsPolicy is the set of origins browsers may call the API from
+type corsPolicy struct {
+	any     bool
+	origins map[string]bool
+}
+
+var cors atomic.Pointer[corsPolicy]
+
+// Request headers clients may send, and response headers they may read,
+// beyond the ones browsers always allow
+var (
+	corsAllowed = strings.Join([]string{"Authorization", "Content-Type", "Accept-Language", "If-None-Match",
+		"If-Modified-Since", "Last-Event-ID", RequestIDHeader, workspace.Header}, ", ")
+	corsExposed = strings.Join([]string{"ETag", "Retry-After", "Deprecation", "Sunset", RequestIDHeader,
+		"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+		limits.HeaderMembersLimit, limits.HeaderMembersRemaining, limits.HeaderStorageLimit,
+		limits.HeaderStorageRemaining, limits.HeaderHistoryDays}, ", ")
+)
+
+// ReloadCORSOrigins reads CORS_ALLOWED_ORIGINS, a comma-separated list of
+// origins such as https://app.example.com, or * for any, and returns the
+// origins now allowed. Unset, cross-origin requests get no CORS headers, so
+// browsers refuse them.
+func ReloadCORSOrigins() []string {
+	p := &corsPolicy{origins: make(map[string]bool)}
+	list := []string{}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			p.any = true
+		}
+		p.origins[origin] = true
+		list = append(list, origin)
+	}
+	cors.Store(p)
+	return list
+}
+
+// CORS lets browsers on the allowed origins call the API. Preflight
+// requests are answered here; tokens are sent as Authorization headers, so
+// credentials (cookies) are never allowed.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		p := cors.Load()
+		if origin == "" || p == nil || !(p.any || p.origins[origin]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Expose-Headers", corsExposed)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			h.Set("Access-Control-Allow-Headers", corsAllowed)
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikhil/eaven/internal/accounts"
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// ImpersonationClaim holds the session ID in impersonation tokens
+const ImpersonationClaim = "impersonation_id"
+
+var impersonationLog = logger.NewLogger("impersonation")
+
+// checkImpersonation lets an impersonation token through only while its
+// session is open and audits the request. Tokens without the claim pass
+// unchanged.
+func checkImpersonation(w http.ResponseWriter, r *http.Request, claims jwt.MapClaims) (context.Context, bool) {
+	ctx := r.Context()
+	value, ok := claims[ImpersonationClaim]
+	if !ok {
+		return ctx, true
+	}
+	sessionID, err := strconv.ParseInt(fmt.Sprintf("%v", value), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return ctx, false
+	}
+	active, err := accounts.UseImpersonation(ctx, sessionID)
+	if err != nil {
+		http.Error(w, "Failed to verify impersonation session", http.StatusInternalServerError)
+		return ctx, false
+	}
+	if !active {
+		http.Error(w, "Impersonation session has ended", http.StatusUnauthorized)
+		return ctx, false
+	}
+
+	ctx = logger.ContextWithFields(ctx, "impersonation_id", sessionID, "impersonator_id", claims["impersonator_id"])
+	impersonationLog.WithContext(ctx).Audit("Impersonated request", "user_id", claims["user_id"], "method", r.Method, "path", r.URL.Path)
+	return ctx, true
+}
+
+// IsImpersonating reports whether the request was made with an impersonation
+// token. It must run after AuthMiddleware.
+func IsImpersonating(ctx context.Context) bool {
+	claims, ok := ctx.Value(UserContextKey).(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	_, ok = claims[ImpersonationClaim]
+	return ok
+}
+
+// DenyImpersonation rejects impersonation tokens, so support staff can only
+// use the routes explicitly opened to them. It must run after AuthMiddleware.
+func DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsImpersonating(r.Context()) {
+			http.Error(w, "Not available while impersonating", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
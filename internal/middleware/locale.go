@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/i18n"
+	"github.com/nikhil/eaven/internal/preferences"
+)
+
+type localeInfoKey struct{}
+
+// localeInfo collects what inner middleware learns about a request to pick
+// the locale of its errors
+type localeInfo struct {
+	userID int64
+}
+
+// setLocaleUser records the authenticated user, whose locale preference
+// wins over Accept-Language
+func setLocaleUser(ctx context.Context, userID int64) {
+	if info, ok := ctx.Value(localeInfoKey{}).(*localeInfo); ok {
+		info.userID = userID
+	}
+}
+
+// Localize translates the error message of failed responses into the
+// user's locale: their locale preference, else the best match of
+// Accept-Language, else the deployment default. JSON bodies have their
+// "error" field translated and plain-text bodies their whole text; strings
+// without a translation are left in English. Successful responses pass
+// through untouched.
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &localeInfo{}
+		lw := &localeWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r.WithContext(context.WithValue(r.Context(), localeInfoKey{}, info)))
+		if lw.body == nil {
+			return
+		}
+
+		locale := i18n.Match(r.Header.Get("Accept-Language"))
+		if info.userID != 0 {
+			if l, err := preferences.Locale(r.Context(), database.DB, info.userID); err == nil && l != "" {
+				locale = l
+			}
+		}
+		if locale == "" {
+			locale = i18n.Default()
+		}
+		body := lw.body.Bytes()
+		if translated, ok := translateError(locale, w.Header().Get("Content-Type"), body); ok {
+			body = translated
+			w.Header().Set("Content-Language", locale)
+			w.Header().Del("Content-Length")
+		}
+		w.WriteHeader(lw.status)
+		w.Write(body)
+	})
+}
+
+// translateError returns body with its error message translated, or false
+// when there is nothing to translate
+func translateError(locale, contentType string, body []byte) ([]byte, bool) {
+	if locale == i18n.English {
+		return nil, false
+	}
+	if strings.HasPrefix(contentType, "application/json") {
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return nil, false
+		}
+		message, _ := fields["error"].(string)
+		text, ok := i18n.Error(locale, message)
+		if !ok {
+			return nil, false
+		}
+		fields["error"] = text
+		translated, err := json.Marshal(fields)
+		return append(translated, '\n'), err == nil
+	}
+	text, ok := i18n.Error(locale, strings.TrimSpace(string(body)))
+	if !ok {
+		return nil, false
+	}
+	return []byte(text + "\n"), true
+}
+
+// localeWriter holds back the body of failed responses so Localize can
+// translate it. Others are written, and flushed, as they come.
+type localeWriter struct {
+	http.ResponseWriter
+	status      int
+	body        *bytes.Buffer
+	wroteHeader bool
+}
+
+func (lw *localeWriter) WriteHeader(code int) {
+	if lw.wroteHeader {
+		return
+	}
+	lw.wroteHeader = true
+	if code >= 400 {
+		lw.status, lw.body = code, &bytes.Buffer{}
+		return
+	}
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *localeWriter) Write(b []byte) (int, error) {
+	if !lw.wroteHeader {
+		lw.WriteHeader(http.StatusOK)
+	}
+	if lw.body != nil {
+		return lw.body.Write(b)
+	}
+	return lw.ResponseWriter.Write(b)
+}
+
+func (lw *localeWriter) Flush() {
+	if lw.body != nil {
+		return
+	}
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (lw *localeWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
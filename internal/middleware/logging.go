@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// RequestIDHeader carries the request ID in and out of the server
+const RequestIDHeader = "X-Request-ID"
+
+// tenantVars are the route variables copied onto the log context
+var tenantVars = []string{"team_id", "channel_id"}
+
+// LogContextMiddleware tags the request context with a request ID and any
+// tenant identifiers in the route, so services logging through
+// Logger.WithContext carry them without passing fields by hand
+func LogContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		fields := []interface{}{"request_id", requestID}
+		vars := mux.Vars(r)
+		for _, name := range tenantVars {
+			if v, ok := vars[name]; ok {
+				fields = append(fields, name, v)
+			}
+		}
+
+		ctx := logger.ContextWithFields(r.Context(), fields...)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/maintenance"
+)
+
+var maintenanceLog = logger.NewLogger("maintenance")
+
+// RejectDuringMaintenance answers writes with 503 and a Retry-After while
+// maintenance mode is on. Reads pass, and so does every request when the
+// mode cannot be read, so an unreachable database fails as it would
+// without it.
+func RejectDuringMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		state, err := maintenance.Current(r.Context())
+		if err != nil {
+			maintenanceLog.WithContext(r.Context()).Warn("Failed to read maintenance mode", "error", err)
+		}
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		message := state.Message
+		if message == "" {
+			message = maintenance.DefaultMessage
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfterSeconds))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":       message,
+			"code":        "maintenance",
+			"retry_after": state.RetryAfterSeconds,
+		})
+	})
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// RateLimiter allows each client a number of requests per window and
+// answers 429 beyond that. Counts are kept per process. Every response
+// carries X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset,
+// the Unix time the window ends, so clients can pace themselves.
+type RateLimiter struct {
+	limit  atomic.Int64
+	window time.Duration
+	// key names the client a request counts against
+	key func(r *http.Request) string
+
+	mu          sync.Mutex
+	counts      map[string]int
+	windowStart time.Time
+}
+
+// RateLimitByIP returns a limiter allowing each address limit requests per
+// window
+func RateLimitByIP(limit int, window time.Duration) *RateLimiter {
+	return newRateLimiter(limit, window, ClientIP)
+}
+
+// RateLimitByUser returns a limiter allowing each signed-in user limit
+// requests per window, wherever they come from. It must run after
+// AuthMiddleware; requests without a user count against their address.
+func RateLimitByUser(limit int, window time.Duration) *RateLimiter {
+	return newRateLimiter(limit, window, func(r *http.Request) string {
+		if claims, ok := r.Context().Value(UserContextKey).(jwt.MapClaims); ok {
+			if userID, ok := claims["user_id"]; ok {
+				return fmt.Sprintf("user:%v", userID)
+			}
+		}
+		return ClientIP(r)
+	})
+}
+
+func newRateLimiter(limit int, window time.Duration, key func(r *http.Request) string) *RateLimiter {
+	l := &RateLimiter{window: window, key: key, counts: make(map[string]int), windowStart: time.Now()}
+	l.limit.Store(int64(limit))
+	return l
+}
+
+// SetLimit changes how many requests a client may make per window, starting
+// with the current one
+func (l *RateLimiter) SetLimit(limit int) {
+	l.limit.Store(int64(limit))
+}
+
+// Limit is how many requests a client may make per window
+func (l *RateLimiter) Limit() int {
+	return int(l.limit.Load())
+}
+
+// Wrap enforces the limit on a handler
+func (l *RateLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := l.key(r)
+		limit := int(l.limit.Load())
+
+		l.mu.Lock()
+		now := time.Now()
+		if now.Sub(l.windowStart) >= l.window {
+			// Starting a new window also forgets every client, so the
+			// map cannot grow without bound
+			l.counts = make(map[string]int)
+			l.windowStart = now
+		}
+		l.counts[client]++
+		used := l.counts[client]
+		reset := l.windowStart.Add(l.window)
+		l.mu.Unlock()
+
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if used > limit {
+			retryAfter := reset.Sub(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP is the address of the peer that sent a request, without its port
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	dbTimeoutOnce sync.Once
+	dbTimeout     = 3 * time.Second
+)
+
+// DBTimeout is the deadline given to each request's context, read from
+// REQUEST_DB_TIMEOUT_MS. Zero disables it.
+func DBTimeout() time.Duration {
+	dbTimeoutOnce.Do(func() {
+		if v, err := strconv.Atoi(os.Getenv("REQUEST_DB_TIMEOUT_MS")); err == nil && v >= 0 {
+			dbTimeout = time.Duration(v) * time.Millisecond
+		}
+	})
+	return dbTimeout
+}
+
+// TimeoutMiddleware puts a deadline on the request context so queries run
+// with it are cancelled when the database stalls, instead of holding the
+// goroutine and its connection until the server gives up
+func TimeoutMiddleware(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+// WorkspaceMiddleware resolves the workspace a request is for: the slug in
+// the X-Workspace header, or else the subdomain under
+// WORKSPACE_BASE_DOMAIN. Requests naming neither belong to the default
+// workspace, so single-tenant deployments need no configuration.
+func WorkspaceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slug := r.Header.Get(workspace.Header)
+		if slug == "" {
+			slug = workspace.FromHost(r.Host)
+		}
+		if slug == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := workspace.Resolve(r.Context(), slug)
+		if errors.Is(err, workspace.ErrUnknown) {
+			http.Error(w, "Unknown workspace", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to resolve workspace", http.StatusInternalServerError)
+			return
+		}
+		ctx := workspace.WithID(r.Context(), id)
+		ctx = logger.ContextWithFields(ctx, "workspace_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,24 @@
+package models
+
+// MessagePreview is a trimmed view of the latest message in a channel
+type MessagePreview struct {
+	MessageID   int64  `json:"message_id"`
+	UserID      int64  `json:"user_id"`
+	Content     string `json:"content"`
+	MessageTime int64  `json:"message_created_at"`
+}
+
+// ChannelActivity summarises unread state for one channel the user belongs to
+type ChannelActivity struct {
+	ChannelID    int64  `json:"channel_id"`
+	ChannelName  string `json:"channel_name"`
+	TeamID       int64  `json:"team_id"`
+	TeamName     string `json:"team_name"`
+	UnreadCount  int    `json:"unread_count"`
+	MentionCount int    `json:"mention_count"`
+	// NotifyLevel is the member's notification level for the channel. Only
+	// channels at NotifyAll add their unread count to the totals, and muted
+	// channels report no mentions.
+	NotifyLevel   string          `json:"notify_level"`
+	LatestMessage *MessagePreview `json:"latest_message,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// Attachment is a file uploaded to a channel
+type Attachment struct {
+	AttachmentID int64 `json:"attachment_id"`
+	// MessageID is the message the file was sent with, 0 until it is sent
+	MessageID   int64  `json:"message_id,omitempty"`
+	ChannelID   int64  `json:"channel_id"`
+	UploaderID  int64  `json:"uploader_id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	// ScanStatus is unscanned, pending, clean or infected
+	ScanStatus string `json:"scan_status"`
+	// Media is set for images and videos
+	Media     *Media `json:"media,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Media describes an image or video attachment so clients can reserve its
+// space before loading it. Pending is set until the file has been
+// processed; fields that could not be read stay zero.
+type Media struct {
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	DurationMS   int64  `json:"duration_ms,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	Pending      bool   `json:"pending,omitempty"`
+}
@@ -2,14 +2,88 @@ package models
 
 // Channel represents a channel entity
 type Channel struct {
-	ChannelID   int64  `json:"channl_id"`
-	TeamID      int64  `json:"team_id"`
-	Name        string `json:"channel_name"`
+	ChannelID int64  `json:"channl_id"`
+	TeamID    int64  `json:"team_id"`
+	Name      string `json:"channel_name"`
+	// Slug addresses the channel in URLs and is unique within the team
+	Slug        string `json:"slug"`
 	Description string `json:"description"`
 	IsPrivate   bool   `json:"is_private"`
 	CreatedBy   int64  `json:"created_by"`
 	CreatedAt   int64  `json:"created_at"`
 	UpdatedAt   int64  `json:"updated_at"`
+	ArchivedAt  int64  `json:"archived_at,omitempty"`
+	// AnnouncementOnly channels take posts only from admins and members
+	// granted posting
+	AnnouncementOnly bool `json:"announcement_only"`
+	// SectionID is the sidebar section the channel is grouped in, 0 for
+	// none; SectionPosition orders the channels of a section
+	SectionID       int64 `json:"section_id"`
+	SectionPosition int   `json:"section_position"`
+	// MessageTTLSeconds deletes messages that long after they are posted; 0
+	// keeps them
+	MessageTTLSeconds int `json:"message_ttl_seconds"`
+	// Starred and SortOrder are the requesting member's own sidebar layout,
+	// set in listings of the user's channels. SortOrder 0 is unordered.
+	Starred   bool `json:"starred"`
+	SortOrder int  `json:"sort_order"`
+}
+
+// ChannelSection is a named group of a team's channels in client sidebars
+type ChannelSection struct {
+	SectionID int64  `json:"section_id"`
+	TeamID    int64  `json:"team_id"`
+	Name      string `json:"name"`
+	Position  int    `json:"position"`
+	CreatedBy int64  `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Channel share statuses stored in channel_shares.status
+const (
+	// SharePending shares wait for an owner of the invited team to accept
+	SharePending = "pending"
+	// ShareActive shares let the invited team's members use the channel
+	ShareActive = "active"
+)
+
+// ChannelShare links a channel to a second team
+type ChannelShare struct {
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	// HostTeamID is the team the channel belongs to, TeamID the team it is
+	// shared with
+	HostTeamID int64  `json:"host_team_id"`
+	TeamID     int64  `json:"team_id"`
+	Status     string `json:"status"`
+	InvitedBy  int64  `json:"invited_by"`
+	InvitedAt  int64  `json:"invited_at"`
+	AcceptedBy int64  `json:"accepted_by,omitempty"`
+	AcceptedAt int64  `json:"accepted_at,omitempty"`
+}
+
+// PostGrant lets a member post in an announcement channel
+type PostGrant struct {
+	ChannelID int64 `json:"channel_id"`
+	UserID    int64 `json:"user_id"`
+	GrantedBy int64 `json:"granted_by"`
+	GrantedAt int64 `json:"granted_at"`
+}
+
+// Channel notification levels stored in channel_members.notify_level
+const (
+	// NotifyAll counts every unread message toward the member's badges
+	NotifyAll = "all"
+	// NotifyMentions only counts mentions; unread messages still show per
+	// channel
+	NotifyMentions = "mentions"
+	// NotifyMuted counts nothing and sends no digest or mention email
+	NotifyMuted = "muted"
+)
+
+// ValidNotifyLevel reports whether level is a channel notification level
+func ValidNotifyLevel(level string) bool {
+	return level == NotifyAll || level == NotifyMentions || level == NotifyMuted
 }
 
 // ChannelMember represents a channel membership with role
@@ -29,6 +103,14 @@ type PaginationResponse struct {
 	PerPage    int       `json:"per_page"`
 }
 
+// ChannelDeltaResponse lists channel changes since a client checkpoint
+type ChannelDeltaResponse struct {
+	Channels    []Channel `json:"channels"`
+	ArchivedIDs []int64   `json:"archived_ids"`
+	Since       int64     `json:"since"`
+	Checkpoint  int64     `json:"checkpoint"`
+}
+
 type ChannelUserDataStruct struct {
 	ChannelID   int64  `json:"channel_id"`
 	TeamID      int64  `json:"team_id"`
@@ -37,3 +119,7 @@ type ChannelUserDataStruct struct {
 	LastName    string `json:"last_name"`
 	ChannelName string `json:"channel_name"`
 }
+
+// ChannelCompactFields are the channel fields returned when a list endpoint
+// is called with compact=true
+var ChannelCompactFields = []string{"channl_id", "team_id", "channel_name", "is_private"}
@@ -1,8 +1,44 @@
 package models
 
 type MessageBody struct {
-	ChannelID   int64  `json:"channel_id"`
+	MessageID    int64  `json:"message_id,omitempty"`
+	ChannelID    int64  `json:"channel_id"`
+	UserID       int64  `json:"user_id"`
+	Content      string `json:"content"`
+	RenderedHTML string `json:"rendered_html,omitempty"`
+	MessageTime  int64  `json:"message_created_at"`
+	// ReplyToID is the message this one quotes. ReplyTo carries its snippet
+	// and is nil when the quoted message no longer exists.
+	ReplyToID int64          `json:"reply_to_id,omitempty"`
+	ReplyTo   *QuotedMessage `json:"reply_to,omitempty"`
+	// ContentType is ContentTypeEncrypted for end-to-end encrypted messages,
+	// whose Content is empty and whose EncryptedPayload the server never
+	// reads
+	ContentType      string `json:"content_type,omitempty"`
+	EncryptedPayload string `json:"encrypted_payload,omitempty"`
+	// AttachmentIDs are files the sender uploaded to the channel and sends
+	// with the message
+	AttachmentIDs []int64 `json:"attachment_ids,omitempty"`
+	// GiphyID picks the GIF a ContentTypeGiphy message posts. The server
+	// looks it up and stores the GIF's URL as Content.
+	GiphyID string `json:"giphy_id,omitempty"`
+}
+
+// MessageCompactFields are the message fields returned when a message list
+// endpoint is called with compact=true
+var MessageCompactFields = []string{"message_id", "channel_id", "user_id", "content", "message_created_at"}
+
+// Message content types
+const (
+	ContentTypeText      = "text"
+	ContentTypeEncrypted = "e2e"
+	ContentTypeGiphy     = "giphy"
+)
+
+// QuotedMessage is the part of a quoted message shown inline with the reply
+type QuotedMessage struct {
+	MessageID   int64  `json:"message_id"`
 	UserID      int64  `json:"user_id"`
-	Content     string `json:"content"`
+	Snippet     string `json:"snippet"`
 	MessageTime int64  `json:"message_created_at"`
 }
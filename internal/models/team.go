@@ -2,11 +2,17 @@ package models
 
 // Team represents a team entity
 type Team struct {
-	ID        int64  `json:"id"`
-	Name      string `json:"name"`
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Locale is the language of the team's system messages; "" follows the
+	// deployment default
+	Locale    string `json:"locale"`
 	CreatedBy int64  `json:"created_by"`
 	CreatedAt int64  `json:"created_at"`
 	UpdatedAt int64  `json:"updated_at"`
+	// WorkspaceID is the workspace the team belongs to
+	WorkspaceID int64 `json:"workspace_id"`
 }
 
 // TeamMember represents a team membership with role
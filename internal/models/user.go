@@ -1,8 +1,11 @@
 package models
 
 type User struct {
-	UserID        int64  `json:"user_id"`
-	Email         string `json:"email"`
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+	// Handle is the unique @name used in mentions, chosen from the email
+	// address at signup when not given
+	Handle        string `json:"handle"`
 	Password      string `json:"password,omitempty"`
 	FirstName     string `json:"first_name"`
 	LastName      string `json:"last_name"`
@@ -0,0 +1,365 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy actions, applied to messages a classifier flags
+const (
+	// ActionOff disables moderation for the team
+	ActionOff = "off"
+	// ActionBlock rejects flagged messages
+	ActionBlock = "block"
+	// ActionMask posts flagged messages with the flagged words masked
+	ActionMask = "mask"
+	// ActionReview posts flagged messages and queues them for admin review
+	ActionReview = "review"
+)
+
+// WordListClassifier names the built-in word list in findings
+const WordListClassifier = "wordlist"
+
+// maxPolicyWords bounds the number of words a team can add to the list
+const maxPolicyWords = 500
+
+// ErrBlocked is returned by the message pipeline for messages the team's
+// policy rejects
+var ErrBlocked = errors.New("this message was blocked by your team's content policy")
+
+// ErrInvalidPolicy is wrapped by every policy validation failure
+var ErrInvalidPolicy = errors.New("invalid moderation policy")
+
+// Policy is a team's moderation settings
+type Policy struct {
+	TeamID int64  `json:"team_id"`
+	Action string `json:"action"`
+	// Words are matched as whole words, case-insensitively, in addition to
+	// the server-wide list when UseDefaultWords is set
+	Words           []string `json:"words"`
+	UseDefaultWords bool     `json:"use_default_words"`
+	UpdatedBy       int64    `json:"updated_by,omitempty"`
+	UpdatedAt       int64    `json:"updated_at,omitempty"`
+}
+
+// Finding is one reason a classifier flagged a message
+type Finding struct {
+	Classifier string `json:"classifier"`
+	Reason     string `json:"reason"`
+	// Start and End delimit the flagged bytes of the text. Both are 0 when
+	// the classifier flags the text as a whole.
+	Start int `json:"-"`
+	End   int `json:"-"`
+}
+
+// Classifier inspects message text and reports why it should be flagged. It
+// returns no findings for text it accepts.
+type Classifier func(ctx context.Context, teamID int64, text string) ([]Finding, error)
+
+var (
+	mu          sync.RWMutex
+	classifiers = make(map[string]Classifier)
+)
+
+// RegisterClassifier installs a classifier that runs on the messages of every
+// team with moderation enabled, after the word list. Register classifiers at
+// startup.
+func RegisterClassifier(name string, c Classifier) {
+	mu.Lock()
+	defer mu.Unlock()
+	classifiers[name] = c
+}
+
+var (
+	defaultWordsOnce sync.Once
+	defaultWords     map[string]bool
+)
+
+// DefaultWords returns the server-wide word list, read once from the
+// comma-separated MODERATION_WORDS and from MODERATION_WORDS_FILE, a file of
+// one word per line where lines starting with # are ignored
+func DefaultWords() map[string]bool {
+	defaultWordsOnce.Do(func() {
+		defaultWords = make(map[string]bool)
+		for _, w := range strings.Split(os.Getenv("MODERATION_WORDS"), ",") {
+			if w = normalizeWord(w); w != "" {
+				defaultWords[w] = true
+			}
+		}
+		path := os.Getenv("MODERATION_WORDS_FILE")
+		if path == "" {
+			return
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			if w := normalizeWord(line); w != "" {
+				defaultWords[w] = true
+			}
+		}
+	})
+	return defaultWords
+}
+
+// GetPolicy returns a team's policy. Teams that never saved one have
+// moderation off.
+func GetPolicy(ctx context.Context, db *sql.DB, teamID int64) (Policy, error) {
+	policy := Policy{TeamID: teamID, Action: ActionOff, Words: []string{}, UseDefaultWords: true}
+	var words []byte
+	query := `SELECT action, words, use_default_words, updated_by, updated_at FROM team_moderation_policies WHERE team_id = ?`
+	err := db.QueryRowContext(ctx, query, teamID).Scan(&policy.Action, &words, &policy.UseDefaultWords, &policy.UpdatedBy, &policy.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return policy, nil
+	}
+	if err != nil {
+		return Policy{}, err
+	}
+	if err := json.Unmarshal(words, &policy.Words); err != nil {
+		return Policy{}, fmt.Errorf("failed to decode moderation words: %v", err)
+	}
+	return policy, nil
+}
+
+// SetPolicy validates and stores a team's policy. Words are lowercased,
+// deduplicated and sorted.
+func SetPolicy(ctx context.Context, db *sql.DB, teamID, userID int64, policy Policy) (Policy, error) {
+	switch policy.Action {
+	case ActionOff, ActionBlock, ActionMask, ActionReview:
+	default:
+		return Policy{}, fmt.Errorf("%w: action must be off, block, mask or review", ErrInvalidPolicy)
+	}
+
+	seen := make(map[string]bool)
+	words := []string{}
+	for _, raw := range policy.Words {
+		w := normalizeWord(raw)
+		if w == "" {
+			return Policy{}, fmt.Errorf("%w: %q is not a single word", ErrInvalidPolicy, raw)
+		}
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	if len(words) > maxPolicyWords {
+		return Policy{}, fmt.Errorf("%w: at most %d words are allowed", ErrInvalidPolicy, maxPolicyWords)
+	}
+	sort.Strings(words)
+
+	policy.TeamID = teamID
+	policy.Words = words
+	policy.UpdatedBy = userID
+	policy.UpdatedAt = time.Now().UTC().Unix()
+	data, err := json.Marshal(words)
+	if err != nil {
+		return Policy{}, err
+	}
+	query := `
+		INSERT INTO team_moderation_policies (team_id, action, words, use_default_words, updated_by, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE action = VALUES(action), words = VALUES(words),
+			use_default_words = VALUES(use_default_words), updated_by = VALUES(updated_by), updated_at = VALUES(updated_at)
+	`
+	_, err = db.ExecContext(ctx, query, teamID, policy.Action, data, policy.UseDefaultWords, policy.UpdatedBy, policy.UpdatedAt)
+	return policy, err
+}
+
+// Result is the outcome of moderating a message
+type Result struct {
+	// Blocked messages must not be stored
+	Blocked bool
+	// Content is the text to store, with flagged words masked under the mask
+	// action
+	Content string
+	// Review messages are stored and queued for admin review
+	Review   bool
+	Findings []Finding
+}
+
+// Check runs the word list and the registered classifiers over a message
+// posted in a team and applies the team's policy. A failing classifier does
+// not stop the others: Check returns what the rest found along with the
+// error, and callers decide whether to post unmoderated.
+//
+// Findings without a span cannot be masked, so under the mask action they
+// queue the message for review instead.
+func Check(ctx context.Context, db *sql.DB, teamID int64, text string) (Result, error) {
+	result := Result{Content: text}
+	policy, err := GetPolicy(ctx, db, teamID)
+	if err != nil {
+		return result, err
+	}
+	if policy.Action == ActionOff {
+		return result, nil
+	}
+
+	result.Findings = matchWords(text, policyWords(policy))
+
+	mu.RLock()
+	names := make([]string, 0, len(classifiers))
+	for name := range classifiers {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		mu.RLock()
+		c := classifiers[name]
+		mu.RUnlock()
+		findings, err := c(ctx, teamID, text)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("classifier %s: %w", name, err))
+			continue
+		}
+		for _, f := range findings {
+			if f.Classifier == "" {
+				f.Classifier = name
+			}
+			result.Findings = append(result.Findings, f)
+		}
+	}
+	err = errors.Join(errs...)
+	if len(result.Findings) == 0 {
+		return result, err
+	}
+
+	switch policy.Action {
+	case ActionBlock:
+		result.Blocked = true
+	case ActionReview:
+		result.Review = true
+	case ActionMask:
+		var masked bool
+		result.Content, masked = mask(text, result.Findings)
+		result.Review = !masked
+	}
+	return result, err
+}
+
+// Reasons lists the distinct reasons of a set of findings
+func Reasons(findings []Finding) []string {
+	seen := make(map[string]bool)
+	reasons := []string{}
+	for _, f := range findings {
+		if !seen[f.Reason] {
+			seen[f.Reason] = true
+			reasons = append(reasons, f.Reason)
+		}
+	}
+	return reasons
+}
+
+func policyWords(policy Policy) map[string]bool {
+	words := make(map[string]bool)
+	if policy.UseDefaultWords {
+		for w := range DefaultWords() {
+			words[w] = true
+		}
+	}
+	for _, w := range policy.Words {
+		words[w] = true
+	}
+	return words
+}
+
+// matchWords finds the words of text that are on the list. Words are runs of
+// letters and digits, compared in lower case.
+func matchWords(text string, list map[string]bool) []Finding {
+	if len(list) == 0 {
+		return nil
+	}
+	var findings []Finding
+	start := -1
+	check := func(end int) {
+		if start < 0 {
+			return
+		}
+		if list[strings.ToLower(text[start:end])] {
+			findings = append(findings, Finding{Classifier: WordListClassifier, Reason: "blocked word", Start: start, End: end})
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		check(i)
+	}
+	check(len(text))
+	return findings
+}
+
+// mask replaces the flagged spans of text with asterisks. It reports false
+// when a finding has no span and so could not be masked.
+func mask(text string, findings []Finding) (string, bool) {
+	covered := true
+	var spans []Finding
+	for _, f := range findings {
+		if f.End <= f.Start || f.Start < 0 || f.End > len(text) {
+			covered = false
+			continue
+		}
+		spans = append(spans, f)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+
+	var b strings.Builder
+	pos := 0
+	for _, s := range spans {
+		if s.End <= pos {
+			continue
+		}
+		if s.Start > pos {
+			b.WriteString(text[pos:s.Start])
+		} else {
+			s.Start = pos
+		}
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[s.Start:s.End])))
+		pos = s.End
+	}
+	b.WriteString(text[pos:])
+	return b.String(), covered
+}
+
+// normalizeWord lowercases a list entry, returning "" unless it is a single
+// word
+func normalizeWord(w string) string {
+	w = strings.ToLower(strings.TrimSpace(w))
+	if w == "" || utf8.RuneCountInString(w) > 64 {
+		return ""
+	}
+	for _, r := range w {
+		if !isWordRune(r) {
+			return ""
+		}
+	}
+	return w
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
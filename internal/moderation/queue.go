@@ -0,0 +1,212 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/media"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// Review queue statuses
+const (
+	StatusPending   = "pending"
+	StatusDismissed = "dismissed"
+	StatusRemoved   = "removed"
+)
+
+// Review decisions
+const (
+	// Dismiss keeps the message
+	Dismiss = "dismiss"
+	// Remove deletes the message from its channel
+	Remove = "remove"
+)
+
+// ErrItemNotFound is returned when a queue item does not exist
+var ErrItemNotFound = errors.New("moderation queue item not found")
+
+// ErrAlreadyResolved is returned when resolving an item twice
+var ErrAlreadyResolved = errors.New("moderation queue item is already resolved")
+
+// ErrInvalidDecision is returned for decisions other than dismiss and remove
+var ErrInvalidDecision = errors.New("action must be dismiss or remove")
+
+// Item is a message held for review
+type Item struct {
+	ItemID     int64     `json:"item_id"`
+	MessageID  int64     `json:"message_id"`
+	ChannelID  int64     `json:"channel_id"`
+	TeamID     int64     `json:"team_id"`
+	UserID     int64     `json:"user_id"`
+	Content    string    `json:"content"`
+	Findings   []Finding `json:"findings"`
+	Status     string    `json:"status"`
+	CreatedAt  int64     `json:"created_at"`
+	ResolvedBy int64     `json:"resolved_by,omitempty"`
+	ResolvedAt int64     `json:"resolved_at,omitempty"`
+}
+
+// Enqueue holds a stored message for review. It runs in the transaction
+// that stores the message so a queued item always has its message.
+func Enqueue(ctx context.Context, tx *sql.Tx, item Item) error {
+	findings, err := json.Marshal(item.Findings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal moderation findings: %v", err)
+	}
+	query := `
+		INSERT INTO moderation_queue (message_id, channel_id, team_id, user_id, content, reasons, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, query, item.MessageID, item.ChannelID, item.TeamID, item.UserID, item.Content,
+		findings, StatusPending, time.Now().UTC().Unix())
+	return err
+}
+
+// List returns queue items with a status, oldest first. teamID 0 lists every
+// team.
+func List(ctx context.Context, db *sql.DB, status string, teamID int64, limit, offset int) ([]Item, error) {
+	query := `
+		SELECT item_id, message_id, channel_id, team_id, user_id, content, reasons, status, created_at, resolved_by, resolved_at
+		FROM moderation_queue
+		WHERE status = ? AND (? = 0 OR team_id = ?)
+		ORDER BY created_at, item_id
+		LIMIT ? OFFSET ?
+	`
+	rows, err := db.QueryContext(ctx, query, status, teamID, teamID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []Item{}
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Resolve records an admin's decision on a pending item. Removing deletes the
+// message and tells the channel in the same transaction.
+func Resolve(ctx context.Context, db *sql.DB, itemID, adminID int64, decision string) (Item, error) {
+	status := StatusDismissed
+	switch decision {
+	case Dismiss:
+	case Remove:
+		status = StatusRemoved
+	default:
+		return Item{}, ErrInvalidDecision
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Item{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT item_id, message_id, channel_id, team_id, user_id, content, reasons, status, created_at, resolved_by, resolved_at
+		FROM moderation_queue WHERE item_id = ? FOR UPDATE
+	`
+	item, err := scanItem(tx.QueryRowContext(ctx, query, itemID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Item{}, ErrItemNotFound
+	}
+	if err != nil {
+		return Item{}, err
+	}
+	if item.Status != StatusPending {
+		return item, ErrAlreadyResolved
+	}
+
+	item.Status = status
+	item.ResolvedBy = adminID
+	item.ResolvedAt = time.Now().UTC().Unix()
+	_, err = tx.ExecContext(ctx, `UPDATE moderation_queue SET status = ?, resolved_by = ?, resolved_at = ? WHERE item_id = ?`,
+		item.Status, item.ResolvedBy, item.ResolvedAt, item.ItemID)
+	if err != nil {
+		return Item{}, err
+	}
+
+	var files []string
+	if decision == Remove {
+		files, err = removeMessage(ctx, tx, item.MessageID, item.ChannelID, item.TeamID, adminID, "moderation")
+		if err != nil {
+			return Item{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Item{}, err
+	}
+	if decision == Remove {
+		outbox.Notify()
+		deleteFiles(ctx, files)
+	}
+	return item, nil
+}
+
+// removeMessage deletes a message with its link previews and attachments
+// and tells the channel, in the caller's transaction. It returns the storage
+// keys of the attachment files, for deleteFiles once the transaction commits.
+func removeMessage(ctx context.Context, tx *sql.Tx, messageID, channelID, teamID, adminID int64, reason string) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_link_previews WHERE message_id = ?`, messageID); err != nil {
+		return nil, err
+	}
+	files, err := media.DeleteForMessages(ctx, tx, []int64{messageID})
+	if err != nil {
+		return nil, err
+	}
+	// Reported messages may have been archived since
+	for _, table := range history.Tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE message_id = ?`, messageID); err != nil {
+			return nil, err
+		}
+	}
+	err = outbox.Write(ctx, tx, channelID, events.TypeMessageDeleted, events.MessageDeleted{
+		MessageID: messageID,
+		ChannelID: channelID,
+		TeamID:    teamID,
+		DeletedBy: adminID,
+		Reason:    reason,
+	})
+	return files, err
+}
+
+// deleteFiles deletes the stored files of a removed message. The message is
+// already gone, so a failure is only logged.
+func deleteFiles(ctx context.Context, keys []string) {
+	if err := media.DeleteFiles(ctx, storage.Default(), keys); err != nil {
+		logger.NewLogger("moderation").WithContext(ctx).Error("Failed to delete removed attachment files", "error", err)
+	}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanItem(row rowScanner) (Item, error) {
+	var item Item
+	var findings []byte
+	err := row.Scan(&item.ItemID, &item.MessageID, &item.ChannelID, &item.TeamID, &item.UserID, &item.Content,
+		&findings, &item.Status, &item.CreatedAt, &item.ResolvedBy, &item.ResolvedAt)
+	if err != nil {
+		return Item{}, err
+	}
+	if err := json.Unmarshal(findings, &item.Findings); err != nil {
+		return Item{}, fmt.Errorf("failed to decode moderation findings: %v", err)
+	}
+	return item, nil
+}
@@ -0,0 +1,379 @@
+package moderation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/mailer"
+	"github.com/nikhil/eaven/internal/outbox"
+)
+
+// Report kinds
+const (
+	ReportMessage = "message"
+	ReportUser    = "user"
+)
+
+// Report statuses
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// Report decisions, besides Dismiss
+const (
+	// DeleteMessage removes the reported message
+	DeleteMessage = "delete_message"
+	// RemoveMember removes the reported user from the team
+	RemoveMember = "remove_member"
+)
+
+// reportReasons are the reasons a report can be filed for
+var reportReasons = map[string]bool{
+	"spam":          true,
+	"harassment":    true,
+	"hate":          true,
+	"inappropriate": true,
+	"other":         true,
+}
+
+// maxReportDetails bounds the free text of a report, in characters
+const maxReportDetails = 1000
+
+// ErrInvalidReport is wrapped by every report validation failure
+var ErrInvalidReport = errors.New("invalid report")
+
+// ErrReportTargetNotFound is returned when the reported message or user does
+// not exist or is not visible to the reporter
+var ErrReportTargetNotFound = errors.New("nothing to report was found")
+
+// ErrDuplicateReport is returned when the reporter already has an open
+// report against the same message or user
+var ErrDuplicateReport = errors.New("you have already reported this")
+
+// ErrReportNotFound is returned when a report does not exist
+var ErrReportNotFound = errors.New("report not found")
+
+// ErrInvalidReportDecision is returned for decisions that do not apply to a
+// report
+var ErrInvalidReportDecision = errors.New("action must be dismiss, delete_message or remove_member")
+
+// Report is an abuse report filed by a user
+type Report struct {
+	ReportID       int64  `json:"report_id"`
+	Kind           string `json:"kind"`
+	TeamID         int64  `json:"team_id"`
+	ChannelID      int64  `json:"channel_id,omitempty"`
+	MessageID      int64  `json:"message_id,omitempty"`
+	ReportedUserID int64  `json:"reported_user_id"`
+	ReporterID     int64  `json:"reporter_id"`
+	Reason         string `json:"reason"`
+	Details        string `json:"details,omitempty"`
+	Content        string `json:"content,omitempty"`
+	Status         string `json:"status"`
+	Resolution     string `json:"resolution,omitempty"`
+	CreatedAt      int64  `json:"created_at"`
+	ResolvedBy     int64  `json:"resolved_by,omitempty"`
+	ResolvedAt     int64  `json:"resolved_at,omitempty"`
+}
+
+// AbuseReportEmail is the data passed to the abuse_report mail template
+type AbuseReportEmail struct {
+	FirstName    string
+	ReporterName string
+	TeamName     string
+	ChannelName  string
+	Reason       string
+	Details      string
+	Content      string
+	ReportID     int64
+}
+
+// FileMessageReport reports a message. The reporter must be a member of its
+// channel.
+func FileMessageReport(ctx context.Context, db *sql.DB, reporterID, messageID int64, reason, details string) (Report, error) {
+	report := Report{Kind: ReportMessage, MessageID: messageID, ReporterID: reporterID}
+	query, args := history.Union(`
+		SELECT m.channel_id, c.team_id, m.user_id, m.content
+		FROM {messages} m
+		INNER JOIN channels c ON c.channel_id = m.channel_id
+		INNER JOIN channel_members cm ON cm.channel_id = m.channel_id AND cm.user_id = ?
+		WHERE m.message_id = ?`, reporterID, messageID)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&report.ChannelID, &report.TeamID, &report.ReportedUserID, &report.Content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrReportTargetNotFound
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	return file(ctx, db, report, reason, details)
+}
+
+// FileUserReport reports a member of a team. The reporter must belong to the
+// same team.
+func FileUserReport(ctx context.Context, db *sql.DB, reporterID, userID, teamID int64, reason, details string) (Report, error) {
+	if userID == reporterID {
+		return Report{}, fmt.Errorf("%w: you cannot report yourself", ErrInvalidReport)
+	}
+	var members int
+	query := `SELECT COUNT(*) FROM user_teams_mapper WHERE team_id = ? AND user_id IN (?, ?)`
+	if err := db.QueryRowContext(ctx, query, teamID, reporterID, userID).Scan(&members); err != nil {
+		return Report{}, err
+	}
+	if members != 2 {
+		return Report{}, ErrReportTargetNotFound
+	}
+	report := Report{Kind: ReportUser, TeamID: teamID, ReportedUserID: userID, ReporterID: reporterID}
+	return file(ctx, db, report, reason, details)
+}
+
+func file(ctx context.Context, db *sql.DB, report Report, reason, details string) (Report, error) {
+	report.Reason = strings.ToLower(strings.TrimSpace(reason))
+	if !reportReasons[report.Reason] {
+		return Report{}, fmt.Errorf("%w: reason must be spam, harassment, hate, inappropriate or other", ErrInvalidReport)
+	}
+	report.Details = strings.TrimSpace(details)
+	if utf8.RuneCountInString(report.Details) > maxReportDetails {
+		return Report{}, fmt.Errorf("%w: details are limited to %d characters", ErrInvalidReport, maxReportDetails)
+	}
+
+	var duplicate bool
+	query := `
+		SELECT EXISTS(SELECT 1 FROM abuse_reports
+			WHERE reporter_id = ? AND reported_user_id = ? AND kind = ? AND message_id = ? AND status = ?)
+	`
+	err := db.QueryRowContext(ctx, query, report.ReporterID, report.ReportedUserID, report.Kind, report.MessageID, ReportOpen).Scan(&duplicate)
+	if err != nil {
+		return Report{}, err
+	}
+	if duplicate {
+		return Report{}, ErrDuplicateReport
+	}
+
+	report.Status = ReportOpen
+	report.CreatedAt = time.Now().UTC().Unix()
+	query = `
+		INSERT INTO abuse_reports (kind, team_id, channel_id, message_id, reported_user_id, reporter_id, reason, details, content, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := db.ExecContext(ctx, query, report.Kind, report.TeamID, report.ChannelID, report.MessageID, report.ReportedUserID,
+		report.ReporterID, report.Reason, report.Details, report.Content, report.Status, report.CreatedAt)
+	if err != nil {
+		return Report{}, err
+	}
+	report.ReportID, err = result.LastInsertId()
+	return report, err
+}
+
+// NotifyReport emails the owners of the report's team, other than the
+// reporter and the reported user, and returns how many were sent
+func NotifyReport(ctx context.Context, db *sql.DB, report Report) (int, error) {
+	email := AbuseReportEmail{Reason: report.Reason, Details: report.Details, Content: report.Content, ReportID: report.ReportID}
+	query := `
+		SELECT t.team_name, COALESCE(c.channel_name, ''), CONCAT(u.first_name, ' ', u.last_name)
+		FROM teams t
+		INNER JOIN users u ON u.user_id = ?
+		LEFT JOIN channels c ON c.channel_id = ?
+		WHERE t.team_id = ?
+	`
+	err := db.QueryRowContext(ctx, query, report.ReporterID, report.ChannelID, report.TeamID).Scan(&email.TeamName, &email.ChannelName, &email.ReporterName)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+		SELECT u.email, u.first_name
+		FROM user_teams_mapper utm
+		INNER JOIN users u ON u.user_id = utm.user_id
+		WHERE utm.team_id = ? AND utm.role = 1 AND u.is_bot = 0 AND u.user_id NOT IN (?, ?)
+	`
+	rows, err := db.QueryContext(ctx, query, report.TeamID, report.ReporterID, report.ReportedUserID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type owner struct{ email, firstName string }
+	var owners []owner
+	for rows.Next() {
+		var o owner
+		if err := rows.Scan(&o.email, &o.firstName); err != nil {
+			return 0, err
+		}
+		owners = append(owners, o)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, o := range owners {
+		email.FirstName = o.firstName
+		if err := mailer.SendTemplate(o.email, "abuse_report", email); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// ListReports returns reports with a status, oldest first. teamID 0 lists
+// every team.
+func ListReports(ctx context.Context, db *sql.DB, status string, teamID int64, limit, offset int) ([]Report, error) {
+	query := reportColumns + `
+		WHERE status = ? AND (? = 0 OR team_id = ?)
+		ORDER BY created_at, report_id
+		LIMIT ? OFFSET ?
+	`
+	rows, err := db.QueryContext(ctx, query, status, teamID, teamID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// GetReport returns a single report
+func GetReport(ctx context.Context, db *sql.DB, reportID int64) (Report, error) {
+	report, err := scanReport(db.QueryRowContext(ctx, reportColumns+` WHERE report_id = ?`, reportID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrReportNotFound
+	}
+	return report, err
+}
+
+// ResolveReport records an admin's decision on an open report and carries it
+// out. Deleting a message also closes the other open reports against it.
+func ResolveReport(ctx context.Context, db *sql.DB, reportID, adminID int64, decision string) (Report, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	report, err := scanReport(tx.QueryRowContext(ctx, reportColumns+` WHERE report_id = ? FOR UPDATE`, reportID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrReportNotFound
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	if report.Status != ReportOpen {
+		return report, ErrAlreadyResolved
+	}
+
+	report.Status = ReportActioned
+	report.Resolution = decision
+	report.ResolvedBy = adminID
+	report.ResolvedAt = time.Now().UTC().Unix()
+	notify := false
+	var files []string
+	switch {
+	case decision == Dismiss:
+		report.Status = ReportDismissed
+	case decision == DeleteMessage && report.Kind == ReportMessage:
+		files, err = removeMessage(ctx, tx, report.MessageID, report.ChannelID, report.TeamID, adminID, "report")
+		if err != nil {
+			return Report{}, err
+		}
+		notify = true
+	case decision == RemoveMember:
+		if err := removeMember(ctx, tx, report.TeamID, report.ReportedUserID, adminID); err != nil {
+			return Report{}, err
+		}
+		notify = true
+	default:
+		return Report{}, ErrInvalidReportDecision
+	}
+
+	query := `UPDATE abuse_reports SET status = ?, resolution = ?, resolved_by = ?, resolved_at = ? WHERE report_id = ?`
+	args := []interface{}{report.Status, report.Resolution, report.ResolvedBy, report.ResolvedAt, report.ReportID}
+	if decision == DeleteMessage {
+		query = `UPDATE abuse_reports SET status = ?, resolution = ?, resolved_by = ?, resolved_at = ?
+			WHERE report_id = ? OR (kind = ? AND message_id = ? AND status = ?)`
+		args = append(args, ReportMessage, report.MessageID, ReportOpen)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return Report{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Report{}, err
+	}
+	if notify {
+		outbox.Notify()
+	}
+	deleteFiles(ctx, files)
+	return report, nil
+}
+
+// removeMember takes a user out of a team and all of its channels, telling
+// each channel the user left
+func removeMember(ctx context.Context, tx *sql.Tx, teamID, userID, removedBy int64) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT cm.channel_id FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		WHERE c.team_id = ? AND cm.user_id = ?`, teamID, userID)
+	if err != nil {
+		return err
+	}
+	var channelIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		channelIDs = append(channelIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	now := time.Now().UTC().Unix()
+	for _, channelID := range channelIDs {
+		left := events.ChannelMemberLeft{ChannelID: channelID, TeamID: teamID, UserID: userID, LeftAt: now, RemovedBy: removedBy}
+		if err := outbox.Write(ctx, tx, channelID, events.TypeChannelMemberLeft, left); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE cm FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		WHERE c.team_id = ? AND cm.user_id = ?`, teamID, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_teams_mapper WHERE team_id = ? AND user_id = ?`, teamID, userID)
+	return err
+}
+
+const reportColumns = `
+	SELECT report_id, kind, team_id, channel_id, message_id, reported_user_id, reporter_id, reason, details, content,
+		status, resolution, created_at, resolved_by, resolved_at
+	FROM abuse_reports`
+
+func scanReport(row rowScanner) (Report, error) {
+	var r Report
+	err := row.Scan(&r.ReportID, &r.Kind, &r.TeamID, &r.ChannelID, &r.MessageID, &r.ReportedUserID, &r.ReporterID,
+		&r.Reason, &r.Details, &r.Content, &r.Status, &r.Resolution, &r.CreatedAt, &r.ResolvedBy, &r.ResolvedAt)
+	return r, err
+}
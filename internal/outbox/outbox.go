@@ -0,0 +1,285 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/deadletter"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// DeadLetterKind identifies outbox events in the dead letter table
+const DeadLetterKind = "outbox_event"
+
+const (
+	batchSize   = 100
+	maxAttempts = 8
+	baseBackoff = 2 * time.Second
+	// keepDispatched is how long published events stay for inspection
+	keepDispatched = 24 * time.Hour
+)
+
+// Event is an outbox entry handed to publishers
+type Event struct {
+	ID int64 `json:"event_id"`
+	// ChannelID is 0 for events addressed to a user outside any channel
+	ChannelID int64 `json:"channel_id"`
+	// RecipientID addresses the event to one user of the channel; 0 means
+	// every member
+	RecipientID int64           `json:"recipient_id,omitempty"`
+	Envelope    events.Envelope `json:"envelope"`
+}
+
+// VisibleTo reports whether the event may be shown to a member of its
+// channel. Events outside any channel are only shown to their recipient.
+func (e Event) VisibleTo(userID int64) bool {
+	return (e.RecipientID == 0 && e.ChannelID != 0) || e.RecipientID == userID
+}
+
+// Publisher delivers an event to one destination, such as connected clients
+// or webhooks. It is called at least once per event, so it must tolerate
+// duplicates.
+type Publisher func(ctx context.Context, e Event) error
+
+var (
+	mu         sync.RWMutex
+	publishers = make(map[string]Publisher)
+)
+
+// RegisterPublisher installs a destination for outbox events. Delivery
+// subsystems call this when they start.
+func RegisterPublisher(name string, p Publisher) {
+	mu.Lock()
+	defer mu.Unlock()
+	publishers[name] = p
+}
+
+// wake nudges the dispatcher after a write so events need not wait for the
+// next poll
+var wake = make(chan struct{}, 1)
+
+// Write stores an event in tx. It is published once tx commits; call Notify
+// after the commit to publish it without waiting for the next poll.
+func Write(ctx context.Context, tx *sql.Tx, channelID int64, eventType string, payload interface{}) error {
+	return WriteTo(ctx, tx, channelID, 0, eventType, payload)
+}
+
+// Execer is a *sql.DB or *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// WriteTo stores an event addressed to a single member of a channel. Events
+// that describe no other change may be written outside a transaction.
+func WriteTo(ctx context.Context, db Execer, channelID, recipientID int64, eventType string, payload interface{}) error {
+	env, err := events.New(eventType, payload)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox envelope: %v", err)
+	}
+	now := time.Now().UTC().Unix()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO event_outbox (event_type, channel_id, recipient_id, envelope, created_at, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, eventType, channelID, recipientID, data, now, now)
+	return err
+}
+
+// Notify wakes the dispatcher of this process. It never blocks.
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending returns how many events are waiting to be published, retries
+// included
+func Pending(ctx context.Context, db *sql.DB) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM event_outbox WHERE dispatched_at = 0`).Scan(&n)
+	return n, err
+}
+
+// Dispatcher publishes pending outbox events
+type Dispatcher struct {
+	DB  *sql.DB
+	Log *logger.Logger
+}
+
+// Start launches the outbox dispatcher. OUTBOX_POLL_MS sets how often pending
+// events are checked when no write woke it (default 1000; 0 disables).
+// Events are claimed with SKIP LOCKED, so several processes can dispatch.
+func Start() {
+	pollMS := 1000
+	if v, err := strconv.Atoi(os.Getenv("OUTBOX_POLL_MS")); err == nil && v >= 0 {
+		pollMS = v
+	}
+	if pollMS == 0 {
+		return
+	}
+
+	d := &Dispatcher{
+		DB:  database.DB,
+		Log: logger.NewLogger("outbox-dispatcher"),
+	}
+
+	// Replaying a dead-lettered event publishes it once, synchronously
+	deadletter.RegisterReplayer(DeadLetterKind, func(ctx context.Context, payload json.RawMessage) error {
+		var e Event
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return publish(ctx, e)
+	})
+
+	go d.run(time.Duration(pollMS) * time.Millisecond)
+}
+
+func (d *Dispatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+
+		// Drain the backlog before waiting again
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			n, err := d.DispatchPending(ctx, time.Now().UTC())
+			cancel()
+			if err != nil {
+				d.Log.Error("Failed to dispatch outbox events", "error", err)
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := d.cleanup(ctx, time.Now().UTC()); err != nil {
+				d.Log.Error("Failed to clean up dispatched outbox events", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// DispatchPending publishes one batch of due events and returns how many it
+// handled. Failed events are retried with backoff and dead-lettered after
+// maxAttempts.
+func (d *Dispatcher) DispatchPending(ctx context.Context, now time.Time) (int, error) {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT event_id, channel_id, recipient_id, envelope, attempts
+		FROM event_outbox
+		WHERE dispatched_at = 0 AND next_attempt_at <= ?
+		ORDER BY event_id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED`, now.Unix(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		event    Event
+		attempts int
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		var envelope []byte
+		if err := rows.Scan(&p.event.ID, &p.event.ChannelID, &p.event.RecipientID, &envelope, &p.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(envelope, &p.event.Envelope); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to decode outbox event %d: %v", p.event.ID, err)
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range batch {
+		err := publish(ctx, p.event)
+		if err == nil {
+			if _, err := tx.ExecContext(ctx, `UPDATE event_outbox SET dispatched_at = ?, attempts = ? WHERE event_id = ?`, now.Unix(), p.attempts+1, p.event.ID); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		attempts := p.attempts + 1
+		if attempts >= maxAttempts {
+			d.Log.Error("Giving up on outbox event", "event_id", p.event.ID, "type", p.event.Envelope.Type, "attempts", attempts, "error", err)
+			if dlErr := deadletter.Record(ctx, DeadLetterKind, p.event, err, attempts); dlErr != nil {
+				return 0, dlErr
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE event_outbox SET dispatched_at = ?, attempts = ?, last_error = ? WHERE event_id = ?`, now.Unix(), attempts, err.Error(), p.event.ID); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		backoff := baseBackoff << (attempts - 1)
+		d.Log.Warn("Outbox event delivery failed, retrying", "event_id", p.event.ID, "attempt", attempts, "backoff", backoff, "error", err)
+		if _, err := tx.ExecContext(ctx, `UPDATE event_outbox SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE event_id = ?`, attempts, now.Add(backoff).Unix(), err.Error(), p.event.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), tx.Commit()
+}
+
+func (d *Dispatcher) cleanup(ctx context.Context, now time.Time) error {
+	_, err := d.DB.ExecContext(ctx, `DELETE FROM event_outbox WHERE dispatched_at > 0 AND dispatched_at < ? LIMIT 10000`, now.Add(-keepDispatched).Unix())
+	return err
+}
+
+// publish hands an event to every publisher, in name order. It fails if any
+// publisher fails; the ones that succeeded see the event again on retry.
+func publish(ctx context.Context, e Event) error {
+	mu.RLock()
+	names := make([]string, 0, len(publishers))
+	for name := range publishers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	targets := make([]Publisher, len(names))
+	for i, name := range names {
+		targets[i] = publishers[name]
+	}
+	mu.RUnlock()
+
+	var errs []error
+	for i, p := range targets {
+		if err := p(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", names[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
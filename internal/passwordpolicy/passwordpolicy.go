@@ -0,0 +1,184 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	_ "embed"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Config controls which passwords are accepted
+type Config struct {
+	MinLength int
+	// MaxLength is capped at 72 bytes, beyond which bcrypt ignores input. The
+	// cap also applies with argon2id, so the deployment can switch back.
+	MaxLength int
+	// MinScore is the lowest accepted Score, from 0 (any) to 4
+	MinScore int
+	denylist map[string]bool
+}
+
+// ValidationError lists every rule a password breaks, phrased so the user
+// knows what to change
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Problems, "; ")
+}
+
+var (
+	configOnce sync.Once
+	config     Config
+)
+
+// LoadConfig reads the policy from the environment: PASSWORD_MIN_LENGTH
+// (default 8), PASSWORD_MAX_LENGTH (default 72), PASSWORD_MIN_SCORE (default
+// 0, off) and PASSWORD_DENYLIST_FILE, a file of further passwords to reject
+// on top of the embedded list, one per line
+func LoadConfig() Config {
+	configOnce.Do(func() {
+		config = Config{
+			MinLength: envInt("PASSWORD_MIN_LENGTH", 8),
+			MaxLength: min(envInt("PASSWORD_MAX_LENGTH", 72), 72),
+			MinScore:  min(envInt("PASSWORD_MIN_SCORE", 0), 4),
+			denylist:  make(map[string]bool),
+		}
+		addWords(config.denylist, bufio.NewScanner(strings.NewReader(commonPasswords)))
+		if path := os.Getenv("PASSWORD_DENYLIST_FILE"); path != "" {
+			if f, err := os.Open(path); err == nil {
+				addWords(config.denylist, bufio.NewScanner(f))
+				f.Close()
+			}
+		}
+	})
+	return config
+}
+
+// Check validates a password against the deployment policy. userInputs are
+// values the password must not contain, such as the email and names.
+func Check(password string, userInputs ...string) error {
+	return LoadConfig().Check(password, userInputs...)
+}
+
+// Check validates a password against the policy and returns a
+// *ValidationError listing every problem
+func (c Config) Check(password string, userInputs ...string) error {
+	var problems []string
+	length := utf8.RuneCountInString(password)
+	if length < c.MinLength {
+		problems = append(problems, "use at least "+strconv.Itoa(c.MinLength)+" characters")
+	}
+	if len(password) > c.MaxLength {
+		problems = append(problems, "use at most "+strconv.Itoa(c.MaxLength)+" bytes")
+	}
+
+	lower := strings.ToLower(password)
+	if c.denylist[lower] || c.denylist[strings.TrimRightFunc(lower, notLetter)] {
+		problems = append(problems, "this password is too common, choose one that is harder to guess")
+	}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if at := strings.IndexByte(input, '@'); at >= 0 {
+			input = input[:at]
+		}
+		if utf8.RuneCountInString(input) >= 4 && strings.Contains(lower, input) {
+			problems = append(problems, "do not include your name or email address")
+			break
+		}
+	}
+	if c.MinScore > 0 && Score(password) < c.MinScore {
+		problems = append(problems, "make the password stronger with more length or a mix of letters, digits and symbols")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Score estimates how hard a password is to guess on zxcvbn's scale of 0
+// (trivial) to 4 (strong). It is a rough entropy estimate that discounts
+// repeated and sequential characters, not a dictionary attack model.
+func Score(password string) int {
+	var lower, upper, digit, other bool
+	effective := 0.0
+	var prev rune
+	for i, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+		// Runs like "aaaa" and "1234" add little over their first character
+		if i > 0 && (r == prev || r == prev+1 || r == prev-1) {
+			effective += 0.25
+		} else {
+			effective++
+		}
+		prev = r
+	}
+
+	charset := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {other, 33}} {
+		if class.present {
+			charset += class.size
+		}
+	}
+	if charset == 0 {
+		return 0
+	}
+
+	bits := effective * math.Log2(float64(charset))
+	switch {
+	case bits < 20:
+		return 0
+	case bits < 32:
+		return 1
+	case bits < 44:
+		return 2
+	case bits < 60:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func addWords(set map[string]bool, scanner *bufio.Scanner) {
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word != "" && !strings.HasPrefix(word, "#") {
+			set[word] = true
+		}
+	}
+}
+
+// notLetter strips trailing digits and symbols, so "password123!" is
+// recognized as "password"
+func notLetter(r rune) bool {
+	return !unicode.IsLetter(r)
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
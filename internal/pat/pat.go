@@ -0,0 +1,215 @@
+package pat
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every personal access token, which is how they are told
+// apart from login tokens and spotted by secret scanners
+const Prefix = "evn_pat_"
+
+// Claim holds the token ID in the claims of requests authenticated with a
+// personal access token, and ScopesClaim its scopes
+const (
+	Claim       = "pat_id"
+	ScopesClaim = "pat_scopes"
+)
+
+// Scopes limit what a token can do. Admin covers everything the owner can do,
+// including admin routes if the owner is an administrator.
+const (
+	ScopeRead        = "read"
+	ScopePostMessage = "post-message"
+	ScopeAdmin       = "admin"
+)
+
+const (
+	// maxTokens bounds the active tokens a user can hold
+	maxTokens = 50
+	// MaxLifetime bounds how far ahead a token can expire
+	MaxLifetime = 365 * 24 * time.Hour
+	// usedInterval is how often last_used_at is written at most per token
+	usedInterval = time.Minute
+)
+
+// ErrInvalidToken is wrapped by token validation failures when creating one
+var ErrInvalidToken = errors.New("invalid token request")
+
+// ErrTooManyTokens is returned when a user who already has the maximum
+// number of active tokens creates another
+var ErrTooManyTokens = fmt.Errorf("at most %d active tokens are allowed", maxTokens)
+
+// ErrTokenNotFound is returned when revoking a token the user does not own
+var ErrTokenNotFound = errors.New("token not found")
+
+// ErrUnauthorized is returned for unknown, revoked and expired tokens
+var ErrUnauthorized = errors.New("invalid or expired access token")
+
+// Token is a personal access token. The secret is only known when the token
+// is created; afterwards only its hash is stored.
+type Token struct {
+	TokenID    int64    `json:"token_id"`
+	UserID     int64    `json:"user_id"`
+	Email      string   `json:"-"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	Secret     string   `json:"token,omitempty"`
+	Hint       string   `json:"hint"`
+	CreatedAt  int64    `json:"created_at"`
+	ExpiresAt  int64    `json:"expires_at"`
+	LastUsedAt int64    `json:"last_used_at,omitempty"`
+	RevokedAt  int64    `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether scopes grant scope
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, ScopeAdmin) || slices.Contains(scopes, scope)
+}
+
+// Create issues a token for a user. The returned token carries the secret,
+// which cannot be recovered later.
+func Create(ctx context.Context, db *sql.DB, userID int64, name string, scopes []string, lifetime time.Duration) (Token, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return Token{}, fmt.Errorf("%w: name must be between 1 and 100 characters", ErrInvalidToken)
+	}
+	if len(scopes) == 0 {
+		return Token{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidToken)
+	}
+	for _, scope := range scopes {
+		if scope != ScopeRead && scope != ScopePostMessage && scope != ScopeAdmin {
+			return Token{}, fmt.Errorf("%w: scopes must be read, post-message or admin", ErrInvalidToken)
+		}
+	}
+	if lifetime <= 0 || lifetime > MaxLifetime {
+		return Token{}, fmt.Errorf("%w: tokens must expire within %d days", ErrInvalidToken, int(MaxLifetime.Hours()/24))
+	}
+
+	now := time.Now().UTC()
+	var active int
+	query := `SELECT COUNT(*) FROM personal_access_tokens WHERE user_id = ? AND revoked_at = 0 AND expires_at > ?`
+	if err := db.QueryRowContext(ctx, query, userID, now.Unix()).Scan(&active); err != nil {
+		return Token{}, err
+	}
+	if active >= maxTokens {
+		return Token{}, ErrTooManyTokens
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return Token{}, err
+	}
+	secret := Prefix + base64.RawURLEncoding.EncodeToString(raw)
+	slices.Sort(scopes)
+	token := Token{
+		UserID:    userID,
+		Name:      name,
+		Scopes:    slices.Compact(scopes),
+		Secret:    secret,
+		Hint:      secret[len(secret)-4:],
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(lifetime).Unix(),
+	}
+	query = `
+		INSERT INTO personal_access_tokens (user_id, name, scopes, token_hash, hint, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := db.ExecContext(ctx, query, token.UserID, token.Name, strings.Join(token.Scopes, ","), hash(secret),
+		token.Hint, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return Token{}, err
+	}
+	token.TokenID, _ = result.LastInsertId()
+	return token, nil
+}
+
+// List returns a user's tokens, newest first, without their secrets
+func List(ctx context.Context, db *sql.DB, userID int64) ([]Token, error) {
+	query := `
+		SELECT token_id, user_id, name, scopes, hint, created_at, expires_at, last_used_at, revoked_at
+		FROM personal_access_tokens WHERE user_id = ?
+		ORDER BY created_at DESC, token_id DESC
+	`
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		var t Token
+		var scopes string
+		if err := rows.Scan(&t.TokenID, &t.UserID, &t.Name, &scopes, &t.Hint, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke disables one of a user's tokens immediately
+func Revoke(ctx context.Context, db *sql.DB, userID, tokenID int64) error {
+	query := `UPDATE personal_access_tokens SET revoked_at = ? WHERE token_id = ? AND user_id = ? AND revoked_at = 0`
+	result, err := db.ExecContext(ctx, query, time.Now().UTC().Unix(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+var used sync.Map // token ID -> time.Time of the last last_used_at write
+
+// Authenticate looks up the token a request presented. Revoked and expired
+// tokens, and tokens of merged accounts, fail with ErrUnauthorized.
+func Authenticate(ctx context.Context, db *sql.DB, secret string) (Token, error) {
+	now := time.Now().UTC()
+	var t Token
+	var scopes string
+	query := `
+		SELECT t.token_id, t.user_id, u.email, t.name, t.scopes, t.expires_at
+		FROM personal_access_tokens t
+		INNER JOIN users u ON u.user_id = t.user_id
+		WHERE t.token_hash = ? AND t.revoked_at = 0 AND u.merged_into = 0
+	`
+	err := db.QueryRowContext(ctx, query, hash(secret)).Scan(&t.TokenID, &t.UserID, &t.Email, &t.Name, &scopes, &t.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, ErrUnauthorized
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if t.ExpiresAt <= now.Unix() {
+		return Token{}, ErrUnauthorized
+	}
+	t.Scopes = strings.Split(scopes, ",")
+
+	if last, ok := used.Load(t.TokenID); !ok || now.Sub(last.(time.Time)) >= usedInterval {
+		used.Store(t.TokenID, now)
+		// Usage tracking is best effort and never fails a request
+		db.ExecContext(ctx, `UPDATE personal_access_tokens SET last_used_at = ? WHERE token_id = ?`, now.Unix(), t.TokenID)
+	}
+	return t, nil
+}
+
+// hash is what is stored in place of a token. Tokens are long and random, so
+// a fast hash is enough and lets them be looked up by it.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,205 @@
+package preferences
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/i18n"
+)
+
+// Limits on what a user can store
+const (
+	MaxKeys       = 100
+	MaxValueBytes = 4096
+)
+
+// Known preference keys. Other keys are stored as given, so clients can
+// sync settings the server does not know about.
+const (
+	KeyTheme             = "theme"
+	KeyNotificationSound = "notification_sound"
+	KeyCompactMode       = "compact_mode"
+	// KeyLocale is the language of the user's API errors; unset follows
+	// their client's Accept-Language
+	KeyLocale = "locale"
+)
+
+// NotificationSounds are the sounds clients ship with
+var NotificationSounds = []string{"none", "default", "chime", "ding", "pop", "knock"}
+
+// Themes are the values of the theme preference; system follows the
+// device's light or dark setting
+var Themes = []string{"system", "light", "dark"}
+
+// Defaults are returned for known keys the user never set
+var Defaults = map[string]json.RawMessage{
+	KeyTheme:             json.RawMessage(`"system"`),
+	KeyNotificationSound: json.RawMessage(`"default"`),
+	KeyCompactMode:       json.RawMessage(`false`),
+}
+
+var validKey = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// ValidationError lists every key of a patch that cannot be stored
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid preferences: " + strings.Join(e.Problems, "; ")
+}
+
+// Preferences are a user's settings, defaults included. UpdatedAt is when
+// they last changed, 0 if never.
+type Preferences struct {
+	Values    map[string]json.RawMessage `json:"preferences"`
+	UpdatedAt int64                      `json:"updated_at"`
+}
+
+// Get returns a user's preferences with defaults filled in
+func Get(ctx context.Context, db *sql.DB, userID int64) (Preferences, error) {
+	rows, err := db.QueryContext(ctx, `SELECT pref_key, value, updated_at FROM user_preferences WHERE user_id = ?`, userID)
+	if err != nil {
+		return Preferences{}, err
+	}
+	defer rows.Close()
+
+	p := Preferences{Values: make(map[string]json.RawMessage, len(Defaults))}
+	for k, v := range Defaults {
+		p.Values[k] = v
+	}
+	for rows.Next() {
+		var key, value string
+		var updatedAt int64
+		if err := rows.Scan(&key, &value, &updatedAt); err != nil {
+			return Preferences{}, err
+		}
+		p.Values[key] = json.RawMessage(value)
+		p.UpdatedAt = max(p.UpdatedAt, updatedAt)
+	}
+	return p, rows.Err()
+}
+
+// Patch applies a JSON merge patch (RFC 7396) to a user's preferences: keys
+// set to null are removed, going back to their default, and every other key
+// is stored. The whole patch is rejected with a *ValidationError if any key
+// is invalid.
+func Patch(ctx context.Context, db *sql.DB, userID int64, patch map[string]json.RawMessage, now time.Time) (Preferences, error) {
+	var problems []string
+	keys := make([]string, 0, len(patch))
+	for k := range patch {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if problem := check(k, patch[k]); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return Preferences{}, &ValidationError{Problems: problems}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Preferences{}, err
+	}
+	defer tx.Rollback()
+
+	for _, k := range keys {
+		v := patch[k]
+		if isNull(v) {
+			_, err = tx.ExecContext(ctx, `DELETE FROM user_preferences WHERE user_id = ? AND pref_key = ?`, userID, k)
+		} else {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, v); err != nil {
+				return Preferences{}, err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO user_preferences (user_id, pref_key, value, updated_at) VALUES (?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE value = VALUES(value), updated_at = VALUES(updated_at)`,
+				userID, k, compact.String(), now.Unix())
+		}
+		if err != nil {
+			return Preferences{}, err
+		}
+	}
+
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_preferences WHERE user_id = ?`, userID).Scan(&n); err != nil {
+		return Preferences{}, err
+	}
+	if n > MaxKeys {
+		return Preferences{}, &ValidationError{Problems: []string{fmt.Sprintf("at most %d preferences can be stored", MaxKeys)}}
+	}
+	if err := tx.Commit(); err != nil {
+		return Preferences{}, err
+	}
+	return Get(ctx, db, userID)
+}
+
+// check returns what is wrong with setting key to value, or ""
+func check(key string, value json.RawMessage) string {
+	if !validKey.MatchString(key) {
+		return fmt.Sprintf("%q is not a valid key: use up to 64 lowercase letters, digits, dots, dashes or underscores", key)
+	}
+	if isNull(value) {
+		return ""
+	}
+	if len(value) > MaxValueBytes {
+		return fmt.Sprintf("%s is longer than %d bytes", key, MaxValueBytes)
+	}
+
+	switch key {
+	case KeyTheme:
+		return checkOneOf(key, value, Themes)
+	case KeyNotificationSound:
+		return checkOneOf(key, value, NotificationSounds)
+	case KeyLocale:
+		return checkOneOf(key, value, i18n.Locales)
+	case KeyCompactMode:
+		var b bool
+		if json.Unmarshal(value, &b) != nil {
+			return key + " must be true or false"
+		}
+	}
+	return ""
+}
+
+// Locale returns the locale a user chose, or "" when they did not
+func Locale(ctx context.Context, db *sql.DB, userID int64) (string, error) {
+	var value string
+	err := db.QueryRowContext(ctx, `SELECT value FROM user_preferences WHERE user_id = ? AND pref_key = ?`, userID, KeyLocale).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	var locale string
+	if err != nil || json.Unmarshal([]byte(value), &locale) != nil {
+		return "", err
+	}
+	return locale, nil
+}
+
+func checkOneOf(key string, value json.RawMessage, allowed []string) string {
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		for _, a := range allowed {
+			if s == a {
+				return ""
+			}
+		}
+	}
+	return fmt.Sprintf("%s must be one of %s", key, strings.Join(allowed, ", "))
+}
+
+func isNull(v json.RawMessage) bool {
+	return len(v) == 0 || string(bytes.TrimSpace(v)) == "null"
+}
@@ -0,0 +1,65 @@
+package queries
+
+import (
+	"context"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// A team's default channels are its own public channels that are not
+// archived; channels other teams share with it are left out
+const defaultChannel = `c.team_id = ? AND c.is_private = 0 AND c.archived_at = 0`
+
+var (
+	listDefaultChannels = newQuery("ListDefaultChannels", `
+		SELECT `+channelColumns+`
+		FROM channels c
+		WHERE `+defaultChannel+`
+		ORDER BY c.channel_id`)
+
+	countDefaultChannelMembers = newQuery("CountDefaultChannelMembers", `
+		SELECT COUNT(DISTINCT cm.user_id)
+		FROM channels c
+		INNER JOIN channel_members cm ON cm.channel_id = c.channel_id
+		WHERE `+defaultChannel)
+
+	listTeamMemberIDs = newQuery("ListTeamMemberIDs", `
+		SELECT utm.user_id
+		FROM user_teams_mapper utm
+		INNER JOIN users u ON u.user_id = utm.user_id
+		WHERE utm.team_id = ? AND u.is_bot = 0
+		ORDER BY utm.user_id`)
+)
+
+// ListDefaultChannels returns the team's default channels, which team-wide
+// announcements are posted to
+func (q *Queries) ListDefaultChannels(ctx context.Context, teamID int64) ([]models.Channel, error) {
+	return scanChannels(q.query(ctx, listDefaultChannels, teamID))
+}
+
+// CountDefaultChannelMembers counts the users who belong to at least one of
+// the team's default channels
+func (q *Queries) CountDefaultChannelMembers(ctx context.Context, teamID int64) (int, error) {
+	var n int
+	err := q.queryRow(ctx, countDefaultChannelMembers, teamID).Scan(&n)
+	return n, err
+}
+
+// ListTeamMemberIDs returns the IDs of every member of a team except bots
+func (q *Queries) ListTeamMemberIDs(ctx context.Context, teamID int64) ([]int64, error) {
+	rows, err := q.query(ctx, listTeamMemberIDs, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
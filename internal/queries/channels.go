@@ -0,0 +1,315 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// teamGuestCheck matches when user ? is a guest of team ?
+const teamGuestCheck = `SELECT 1 FROM user_teams_mapper utm WHERE utm.team_id = ? AND utm.user_id = ? AND utm.role = 3`
+
+// teamChannel matches when channel c belongs to team ? or is shared with it;
+// it takes the team ID twice
+const teamChannel = `(c.team_id = ? OR EXISTS (
+	SELECT 1 FROM channel_shares s WHERE s.channel_id = c.channel_id AND s.team_id = ? AND s.status = 'active'))`
+
+// channelTeamMember matches when the user of utm is in channel c's team or in
+// a team the channel is shared with
+const channelTeamMember = `(utm.team_id = c.team_id OR utm.team_id IN (
+	SELECT s.team_id FROM channel_shares s WHERE s.channel_id = c.channel_id AND s.status = 'active'))`
+
+// memberLayoutColumns are the member's own layout of channel c, read by
+// scanMemberChannels
+const memberLayoutColumns = `cm.starred, cm.sort_order`
+
+const channelColumns = `c.channel_id, c.team_id, c.channel_name, c.description, c.is_private, c.created_by, c.created_at, c.updated_at, c.archived_at, c.announcement_only, c.slug, c.section_id, c.section_position, c.message_ttl_seconds`
+
+var (
+	createChannel = newQuery("CreateChannel", `
+		INSERT INTO channels (team_id, channel_name, slug, description, is_private, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+
+	getChannel = newQuery("GetChannel", `
+		SELECT `+channelColumns+`
+		FROM channels c
+		WHERE c.channel_id = ?`)
+
+	getMemberChannel = newQuery("GetMemberChannel", `
+		SELECT `+channelColumns+`, cm.role
+		FROM channels c
+		INNER JOIN channel_members cm ON cm.channel_id = c.channel_id
+		WHERE c.channel_id = ? AND cm.user_id = ?`)
+
+	getTeamChannelIDBySlug = newQuery("GetTeamChannelIDBySlug", `
+		SELECT channel_id FROM channels WHERE team_id = ? AND slug = ?`)
+
+	// Another channel of the team holds the slug; channel ? is excluded so a
+	// channel keeps its own slug through an update
+	channelSlugTaken = newQuery("ChannelSlugTaken", `
+		SELECT EXISTS(SELECT 1 FROM channels WHERE team_id = ? AND slug = ? AND channel_id <> ?)`)
+
+	updateChannel = newQuery("UpdateChannel", `
+		UPDATE channels SET channel_name = ?, slug = ?, description = ?, updated_at = ? WHERE channel_id = ?`)
+
+	setAnnouncementOnly = newQuery("SetAnnouncementOnly", `
+		UPDATE channels SET announcement_only = ?, updated_at = ? WHERE channel_id = ?`)
+
+	setMessageTTL = newQuery("SetMessageTTL", `
+		UPDATE channels SET message_ttl_seconds = ?, updated_at = ? WHERE channel_id = ?`)
+
+	// Admins (role 1) can always post; other members need a grant when the
+	// channel is announcement only
+	canPost = newQuery("CanPost", `
+		SELECT c.announcement_only = 0 OR cm.role = 1 OR EXISTS(
+			SELECT 1 FROM channel_post_grants g WHERE g.channel_id = c.channel_id AND g.user_id = cm.user_id)
+		FROM channels c
+		INNER JOIN channel_members cm ON cm.channel_id = c.channel_id
+		WHERE c.channel_id = ? AND cm.user_id = ?`)
+
+	grantPosting = newQuery("GrantPosting", `
+		INSERT IGNORE INTO channel_post_grants (channel_id, user_id, granted_by, granted_at) VALUES (?, ?, ?, ?)`)
+
+	revokePosting = newQuery("RevokePosting", `
+		DELETE FROM channel_post_grants WHERE channel_id = ? AND user_id = ?`)
+
+	listPostGrants = newQuery("ListPostGrants", `
+		SELECT user_id, granted_by, granted_at FROM channel_post_grants WHERE channel_id = ? ORDER BY granted_at`)
+
+	// Visible channels are the ones the user belongs to plus, unless the user
+	// is a guest, the team's public channels, shared ones included. Archived
+	// channels are left out; the team delta reports them as archived.
+	countVisibleTeamChannels = newQuery("CountVisibleTeamChannels", `
+		SELECT COUNT(*)
+		FROM channels c
+		WHERE `+teamChannel+` AND c.archived_at = 0 AND (
+			EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = c.channel_id AND cm.user_id = ?) OR
+			(c.is_private = 0 AND NOT EXISTS (`+teamGuestCheck+`))
+		)`)
+
+	listVisibleTeamChannels = newQuery("ListVisibleTeamChannels", `
+		SELECT `+channelColumns+`
+		FROM channels c
+		WHERE `+teamChannel+` AND c.archived_at = 0 AND (
+			EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = c.channel_id AND cm.user_id = ?) OR
+			(c.is_private = 0 AND NOT EXISTS (`+teamGuestCheck+`))
+		)
+		ORDER BY c.created_at DESC
+		LIMIT ? OFFSET ?`)
+
+	countMemberTeamChannels = newQuery("CountMemberTeamChannels", `
+		SELECT COUNT(*)
+		FROM channels c
+		INNER JOIN channel_members cm ON cm.channel_id = c.channel_id
+		WHERE `+teamChannel+` AND cm.user_id = ? AND c.archived_at = 0`)
+
+	// In the member's sidebar order: starred channels first, then the
+	// manually ordered ones, then the rest
+	listMemberTeamChannels = newQuery("ListMemberTeamChannels", `
+		SELECT `+channelColumns+`, `+memberLayoutColumns+`
+		FROM channels c
+		INNER JOIN channel_members cm ON cm.channel_id = c.channel_id
+		WHERE `+teamChannel+` AND cm.user_id = ? AND c.archived_at = 0
+		ORDER BY cm.starred DESC, cm.sort_order = 0, cm.sort_order, c.channel_id
+		LIMIT ? OFFSET ?`)
+
+	listMemberTeamChannelChanges = newQuery("ListMemberTeamChannelChanges", `
+		SELECT `+channelColumns+`, `+memberLayoutColumns+`
+		FROM channels c
+		INNER JOIN channel_members cm ON cm.channel_id = c.channel_id
+		WHERE `+teamChannel+` AND cm.user_id = ?
+			AND (c.created_at >= ? OR c.updated_at >= ? OR c.archived_at >= ? OR cm.layout_updated_at >= ?)
+		ORDER BY c.updated_at`)
+)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanChannel(row rowScanner, extra ...interface{}) (models.Channel, error) {
+	var c models.Channel
+	dest := append([]interface{}{&c.ChannelID, &c.TeamID, &c.Name, &c.Description, &c.IsPrivate, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt, &c.ArchivedAt, &c.AnnouncementOnly, &c.Slug, &c.SectionID, &c.SectionPosition, &c.MessageTTLSeconds}, extra...)
+	err := row.Scan(dest...)
+	return c, err
+}
+
+func scanChannels(rows *sql.Rows, err error) ([]models.Channel, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []models.Channel
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// scanMemberChannels scans channels selected with memberLayoutColumns
+func scanMemberChannels(rows *sql.Rows, err error) ([]models.Channel, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []models.Channel
+	for rows.Next() {
+		var starred bool
+		var sortOrder int
+		c, err := scanChannel(rows, &starred, &sortOrder)
+		if err != nil {
+			return nil, err
+		}
+		c.Starred, c.SortOrder = starred, sortOrder
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
+
+// CreateChannel inserts a channel and returns its ID
+func (q *Queries) CreateChannel(ctx context.Context, c models.Channel) (int64, error) {
+	result, err := q.exec(ctx, createChannel, c.TeamID, c.Name, c.Slug, c.Description, c.IsPrivate, c.CreatedBy, c.CreatedAt, c.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// ChannelSlugTaken reports whether a team has a channel other than
+// channelID with the slug. New channels pass 0.
+func (q *Queries) ChannelSlugTaken(ctx context.Context, teamID int64, slug string, channelID int64) (bool, error) {
+	var taken bool
+	err := q.queryRow(ctx, channelSlugTaken, teamID, slug, channelID).Scan(&taken)
+	return taken, err
+}
+
+// GetTeamChannelIDBySlug returns the ID of the team channel with the slug,
+// or sql.ErrNoRows
+func (q *Queries) GetTeamChannelIDBySlug(ctx context.Context, teamID int64, slug string) (int64, error) {
+	var channelID int64
+	err := q.queryRow(ctx, getTeamChannelIDBySlug, teamID, slug).Scan(&channelID)
+	return channelID, err
+}
+
+// GetChannel returns a channel, or sql.ErrNoRows
+func (q *Queries) GetChannel(ctx context.Context, channelID int64) (models.Channel, error) {
+	return scanChannel(q.queryRow(ctx, getChannel, channelID))
+}
+
+// GetMemberChannel returns a channel with the user's role in it, or
+// sql.ErrNoRows when the user is not a member
+func (q *Queries) GetMemberChannel(ctx context.Context, channelID, userID int64) (models.Channel, int, error) {
+	var role int
+	c, err := scanChannel(q.queryRow(ctx, getMemberChannel, channelID, userID), &role)
+	return c, role, err
+}
+
+// UpdateChannel sets a channel's name, slug and description, reporting the
+// number of rows changed
+func (q *Queries) UpdateChannel(ctx context.Context, channelID int64, name, slug, description string, updatedAt int64) (int64, error) {
+	result, err := q.exec(ctx, updateChannel, name, slug, description, updatedAt, channelID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountVisibleTeamChannels counts the team channels a user can see
+func (q *Queries) CountVisibleTeamChannels(ctx context.Context, teamID, userID int64) (int, error) {
+	var n int
+	err := q.queryRow(ctx, countVisibleTeamChannels, teamID, teamID, userID, teamID, userID).Scan(&n)
+	return n, err
+}
+
+// ListVisibleTeamChannels returns a page of the team channels a user can
+// see, newest first
+func (q *Queries) ListVisibleTeamChannels(ctx context.Context, teamID, userID int64, limit, offset int) ([]models.Channel, error) {
+	return scanChannels(q.query(ctx, listVisibleTeamChannels, teamID, teamID, userID, teamID, userID, limit, offset))
+}
+
+// CountMemberTeamChannels counts the team channels a user belongs to
+func (q *Queries) CountMemberTeamChannels(ctx context.Context, teamID, userID int64) (int, error) {
+	var n int
+	err := q.queryRow(ctx, countMemberTeamChannels, teamID, teamID, userID).Scan(&n)
+	return n, err
+}
+
+// ListMemberTeamChannels returns a page of the team channels a user belongs
+// to, in their sidebar order
+func (q *Queries) ListMemberTeamChannels(ctx context.Context, teamID, userID int64, limit, offset int) ([]models.Channel, error) {
+	return scanMemberChannels(q.query(ctx, listMemberTeamChannels, teamID, teamID, userID, limit, offset))
+}
+
+// ListMemberTeamChannelChanges returns the team channels a user belongs to
+// that were created, updated, archived or rearranged by the user at or after
+// since
+func (q *Queries) ListMemberTeamChannelChanges(ctx context.Context, teamID, userID, since int64) ([]models.Channel, error) {
+	return scanMemberChannels(q.query(ctx, listMemberTeamChannelChanges, teamID, teamID, userID, since, since, since, since))
+}
+
+// SetAnnouncementOnly turns a channel's announcement-only setting on or off,
+// reporting whether the channel exists
+func (q *Queries) SetAnnouncementOnly(ctx context.Context, channelID int64, on bool, updatedAt int64) (bool, error) {
+	result, err := q.exec(ctx, setAnnouncementOnly, on, updatedAt, channelID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// SetMessageTTL sets how long a channel keeps its messages, 0 for ever
+func (q *Queries) SetMessageTTL(ctx context.Context, channelID int64, seconds int, updatedAt int64) error {
+	_, err := q.exec(ctx, setMessageTTL, seconds, updatedAt, channelID)
+	return err
+}
+
+// CanPost reports whether a member may post in a channel, or returns
+// sql.ErrNoRows when the user is not a member
+func (q *Queries) CanPost(ctx context.Context, channelID, userID int64) (bool, error) {
+	var ok bool
+	err := q.queryRow(ctx, canPost, channelID, userID).Scan(&ok)
+	return ok, err
+}
+
+// GrantPosting lets a member post in an announcement channel
+func (q *Queries) GrantPosting(ctx context.Context, channelID, userID, grantedBy, grantedAt int64) error {
+	_, err := q.exec(ctx, grantPosting, channelID, userID, grantedBy, grantedAt)
+	return err
+}
+
+// RevokePosting removes a member's posting grant, reporting whether there
+// was one
+func (q *Queries) RevokePosting(ctx context.Context, channelID, userID int64) (bool, error) {
+	result, err := q.exec(ctx, revokePosting, channelID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListPostGrants returns the posting grants of a channel, oldest first
+func (q *Queries) ListPostGrants(ctx context.Context, channelID int64) ([]models.PostGrant, error) {
+	rows, err := q.query(ctx, listPostGrants, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []models.PostGrant{}
+	for rows.Next() {
+		g := models.PostGrant{ChannelID: channelID}
+		if err := rows.Scan(&g.UserID, &g.GrantedBy, &g.GrantedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
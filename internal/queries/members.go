@@ -0,0 +1,212 @@
+package queries
+
+import (
+	"context"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// Team roles stored in user_teams_mapper.role
+const (
+	TeamRoleOwner  = 1
+	TeamRoleMember = 2
+	// TeamRoleGuest members only reach the channels they were added to: they
+	// cannot list or join the team's other channels, create channels or add
+	// people
+	TeamRoleGuest = 3
+)
+
+var (
+	isTeamMember = newQuery("IsTeamMember", `
+		SELECT EXISTS(SELECT 1 FROM user_teams_mapper WHERE team_id = ? AND user_id = ?)`)
+
+	getTeamRole = newQuery("GetTeamRole", `
+		SELECT role FROM user_teams_mapper WHERE team_id = ? AND user_id = ?`)
+
+	addTeamMember = newQuery("AddTeamMember", `
+		INSERT INTO user_teams_mapper (team_id, user_id, role, joined_at, invited_by)
+		VALUES (?, ?, ?, ?, ?)`)
+
+	setTeamRole = newQuery("SetTeamRole", `
+		UPDATE user_teams_mapper SET role = ? WHERE team_id = ? AND user_id = ?`)
+
+	isChannelMember = newQuery("IsChannelMember", `
+		SELECT EXISTS(SELECT 1 FROM channel_members WHERE channel_id = ? AND user_id = ?)`)
+
+	getChannelRole = newQuery("GetChannelRole", `
+		SELECT role FROM channel_members WHERE channel_id = ? AND user_id = ?`)
+
+	addChannelMember = newQuery("AddChannelMember", `
+		INSERT INTO channel_members (channel_id, user_id, role, joined_at, invited_by)
+		VALUES (?, ?, ?, ?, ?)`)
+
+	joinChannel = newQuery("JoinChannel", `
+		INSERT INTO channel_members (channel_id, user_id, role, joined_at)
+		VALUES (?, ?, ?, ?)`)
+
+	// Never move the cursor backwards
+	markChannelRead = newQuery("MarkChannelRead", `
+		UPDATE channel_members
+		SET last_read_message_id = GREATEST(last_read_message_id,
+			(SELECT COALESCE(MAX(message_id), 0) FROM messages WHERE channel_id = ?))
+		WHERE channel_id = ? AND user_id = ?`)
+
+	getNotifyLevel = newQuery("GetNotifyLevel", `
+		SELECT notify_level FROM channel_members WHERE channel_id = ? AND user_id = ?`)
+
+	setNotifyLevel = newQuery("SetNotifyLevel", `
+		UPDATE channel_members SET notify_level = ? WHERE channel_id = ? AND user_id = ?`)
+
+	setChannelStarred = newQuery("SetChannelStarred", `
+		UPDATE channel_members SET starred = ?, layout_updated_at = ? WHERE channel_id = ? AND user_id = ?`)
+
+	// Only touches the channels that had an order, so their deltas alone
+	// report the change
+	clearChannelOrder = newQuery("ClearChannelOrder", `
+		UPDATE channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		SET cm.sort_order = 0, cm.layout_updated_at = ?
+		WHERE `+teamChannel+` AND cm.user_id = ? AND cm.sort_order <> 0`)
+
+	setChannelOrder = newQuery("SetChannelOrder", `
+		UPDATE channel_members SET sort_order = ?, layout_updated_at = ? WHERE channel_id = ? AND user_id = ?`)
+
+	getChannelMembership = newQuery("GetChannelMembership", `
+		SELECT c.channel_id, cm.user_id, t.team_id, u.first_name, u.last_name, c.channel_name
+		FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		INNER JOIN teams t ON t.team_id = c.team_id
+		INNER JOIN users u ON u.user_id = cm.user_id
+		WHERE cm.channel_id = ? AND cm.user_id = ? AND EXISTS (
+			SELECT 1 FROM user_teams_mapper utm WHERE utm.user_id = cm.user_id AND `+channelTeamMember+`)`)
+
+	// A channel is joinable by the members of its team, and of the teams it
+	// is shared with, other than guests
+	getJoinableChannel = newQuery("GetJoinableChannel", `
+		SELECT c.channel_id, utm.user_id, t.team_id, u.first_name, u.last_name, c.channel_name
+		FROM channels c
+		INNER JOIN teams t ON t.team_id = c.team_id
+		INNER JOIN user_teams_mapper utm ON `+channelTeamMember+`
+		INNER JOIN users u ON u.user_id = utm.user_id
+		WHERE c.channel_id = ? AND utm.user_id = ? AND utm.role <> 3
+		LIMIT 1`)
+)
+
+// IsTeamMember reports whether a user belongs to a team
+func (q *Queries) IsTeamMember(ctx context.Context, teamID, userID int64) (bool, error) {
+	var member bool
+	err := q.queryRow(ctx, isTeamMember, teamID, userID).Scan(&member)
+	return member, err
+}
+
+// GetTeamRole returns a user's role in a team, or sql.ErrNoRows when the user
+// is not a member
+func (q *Queries) GetTeamRole(ctx context.Context, teamID, userID int64) (int, error) {
+	var role int
+	err := q.queryRow(ctx, getTeamRole, teamID, userID).Scan(&role)
+	return role, err
+}
+
+// AddTeamMember adds a user to a team
+func (q *Queries) AddTeamMember(ctx context.Context, teamID, userID int64, role int, joinedAt, invitedBy int64) error {
+	_, err := q.exec(ctx, addTeamMember, teamID, userID, role, joinedAt, invitedBy)
+	return err
+}
+
+// SetTeamRole changes a member's role in a team and reports whether the user
+// is a member
+func (q *Queries) SetTeamRole(ctx context.Context, teamID, userID int64, role int) (bool, error) {
+	if _, err := q.exec(ctx, setTeamRole, role, teamID, userID); err != nil {
+		return false, err
+	}
+	return q.IsTeamMember(ctx, teamID, userID)
+}
+
+// IsChannelMember reports whether a user belongs to a channel
+func (q *Queries) IsChannelMember(ctx context.Context, channelID, userID int64) (bool, error) {
+	var member bool
+	err := q.queryRow(ctx, isChannelMember, channelID, userID).Scan(&member)
+	return member, err
+}
+
+// GetChannelRole returns a user's role in a channel, or sql.ErrNoRows when
+// the user is not a member
+func (q *Queries) GetChannelRole(ctx context.Context, channelID, userID int64) (int, error) {
+	var role int
+	err := q.queryRow(ctx, getChannelRole, channelID, userID).Scan(&role)
+	return role, err
+}
+
+// AddChannelMember adds a user to a channel on someone's invitation
+func (q *Queries) AddChannelMember(ctx context.Context, channelID, userID int64, role int, joinedAt, invitedBy int64) error {
+	_, err := q.exec(ctx, addChannelMember, channelID, userID, role, joinedAt, invitedBy)
+	return err
+}
+
+// JoinChannel adds a user who joined a channel themselves
+func (q *Queries) JoinChannel(ctx context.Context, channelID, userID int64, role int, joinedAt int64) error {
+	_, err := q.exec(ctx, joinChannel, channelID, userID, role, joinedAt)
+	return err
+}
+
+// MarkChannelRead moves a member's read cursor to the channel's latest
+// message. It reports false when nothing changed, which is also the case
+// when the cursor was already current.
+func (q *Queries) MarkChannelRead(ctx context.Context, channelID, userID int64) (bool, error) {
+	result, err := q.exec(ctx, markChannelRead, channelID, channelID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetNotifyLevel returns a member's notification level for a channel, or
+// sql.ErrNoRows when the user is not a member
+func (q *Queries) GetNotifyLevel(ctx context.Context, channelID, userID int64) (string, error) {
+	var level string
+	err := q.queryRow(ctx, getNotifyLevel, channelID, userID).Scan(&level)
+	return level, err
+}
+
+// SetNotifyLevel sets a member's notification level for a channel
+func (q *Queries) SetNotifyLevel(ctx context.Context, channelID, userID int64, level string) error {
+	_, err := q.exec(ctx, setNotifyLevel, level, channelID, userID)
+	return err
+}
+
+// SetChannelStarred stars or unstars a channel in a member's sidebar
+func (q *Queries) SetChannelStarred(ctx context.Context, channelID, userID int64, starred bool, updatedAt int64) error {
+	_, err := q.exec(ctx, setChannelStarred, starred, updatedAt, channelID, userID)
+	return err
+}
+
+// ClearChannelOrder drops a member's manual order of their team channels
+func (q *Queries) ClearChannelOrder(ctx context.Context, teamID, userID, updatedAt int64) error {
+	_, err := q.exec(ctx, clearChannelOrder, updatedAt, teamID, teamID, userID)
+	return err
+}
+
+// SetChannelOrder places a channel in a member's manual sidebar order
+func (q *Queries) SetChannelOrder(ctx context.Context, channelID, userID int64, sortOrder int, updatedAt int64) error {
+	_, err := q.exec(ctx, setChannelOrder, sortOrder, updatedAt, channelID, userID)
+	return err
+}
+
+// GetChannelMembership returns a member's view of a channel, or
+// sql.ErrNoRows when the user is not a member of the channel and its team
+func (q *Queries) GetChannelMembership(ctx context.Context, channelID, userID int64) (models.ChannelUserDataStruct, error) {
+	return scanChannelUser(q.queryRow(ctx, getChannelMembership, channelID, userID))
+}
+
+// GetJoinableChannel returns a channel as seen by a member of its team, or
+// sql.ErrNoRows when the user is not in the channel's team or is a guest
+func (q *Queries) GetJoinableChannel(ctx context.Context, channelID, userID int64) (models.ChannelUserDataStruct, error) {
+	return scanChannelUser(q.queryRow(ctx, getJoinableChannel, channelID, userID))
+}
+
+func scanChannelUser(row rowScanner) (models.ChannelUserDataStruct, error) {
+	var d models.ChannelUserDataStruct
+	err := row.Scan(&d.ChannelID, &d.UserID, &d.TeamID, &d.FirstName, &d.LastName, &d.ChannelName)
+	return d, err
+}
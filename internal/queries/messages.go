@@ -0,0 +1,38 @@
+package queries
+
+import (
+	"context"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+var (
+	insertMessage = newQuery("InsertMessage", `
+		INSERT INTO messages (message_id, channel_id, user_id, content, rendered_html, message_created_at, reply_to_id, content_type, encrypted_payload)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))`)
+
+	// Quoted messages may have moved to the archive
+	getChannelMessage = newQuery("GetChannelMessage", `
+		SELECT message_id, user_id, content, message_created_at
+		FROM messages
+		WHERE message_id = ? AND channel_id = ?
+		UNION ALL
+		SELECT message_id, user_id, content, message_created_at
+		FROM messages_archive
+		WHERE message_id = ? AND channel_id = ?`)
+)
+
+// InsertMessage stores a message under the ID it was given; see
+// package snowflake
+func (q *Queries) InsertMessage(ctx context.Context, m models.MessageBody) error {
+	_, err := q.exec(ctx, insertMessage, m.MessageID, m.ChannelID, m.UserID, m.Content, m.RenderedHTML, m.MessageTime, m.ReplyToID, m.ContentType, m.EncryptedPayload)
+	return err
+}
+
+// GetChannelMessage returns a message of a channel with its full content as
+// the snippet, or sql.ErrNoRows when the channel has no such message
+func (q *Queries) GetChannelMessage(ctx context.Context, messageID, channelID int64) (models.QuotedMessage, error) {
+	var m models.QuotedMessage
+	err := q.queryRow(ctx, getChannelMessage, messageID, channelID, messageID, channelID).Scan(&m.MessageID, &m.UserID, &m.Snippet, &m.MessageTime)
+	return m, err
+}
@@ -0,0 +1,154 @@
+// Package queries holds the SQL for channels, teams, members and messages
+// behind typed methods. Every statement is registered here and prepared when
+// the process starts, so a query that does not match the schema, such as one
+// with a misspelt column, stops startup instead of failing the first request
+// that runs it.
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// DBTX is satisfied by *sql.DB and *sql.Tx
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Query is a named SQL statement
+type Query struct {
+	Name string
+	SQL  string
+}
+
+// registry lists every statement Prepare checks
+var registry []*Query
+
+func newQuery(name, sql string) *Query {
+	q := &Query{Name: name, SQL: sql}
+	registry = append(registry, q)
+	return q
+}
+
+// Queries runs the registered statements, prepared when it came from Prepare
+type Queries struct {
+	db    DBTX
+	tx    *sql.Tx
+	stmts map[*Query]*sql.Stmt
+}
+
+// New returns a query set bound to db that sends statements unprepared
+func New(db DBTX) *Queries {
+	return &Queries{db: db}
+}
+
+// Prepare prepares every registered statement on db. The first statement
+// the database rejects is returned as the error.
+func Prepare(ctx context.Context, db *sql.DB) (*Queries, error) {
+	q := &Queries{db: db, stmts: make(map[*Query]*sql.Stmt, len(registry))}
+	for _, query := range registry {
+		stmt, err := db.PrepareContext(ctx, query.SQL)
+		if err != nil {
+			q.Close()
+			return nil, fmt.Errorf("failed to prepare query %s: %v", query.Name, err)
+		}
+		q.stmts[query] = stmt
+	}
+	return q, nil
+}
+
+// Close releases the prepared statements
+func (q *Queries) Close() error {
+	var firstErr error
+	for _, stmt := range q.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WithTx returns a query set that runs its statements inside tx
+func (q *Queries) WithTx(tx *sql.Tx) *Queries {
+	return &Queries{db: tx, tx: tx, stmts: q.stmts}
+}
+
+// Reads returns a query set for reads that tolerate a few seconds of
+// staleness, on a replica when database.Reader picks one. Statements are sent
+// unprepared there. Inside a transaction q itself is returned.
+func (q *Queries) Reads() *Queries {
+	if q.tx != nil {
+		return q
+	}
+	if db := database.Reader(); db != database.DB {
+		return New(db)
+	}
+	return q
+}
+
+func (q *Queries) stmt(ctx context.Context, query *Query) *sql.Stmt {
+	stmt, ok := q.stmts[query]
+	if !ok {
+		return nil
+	}
+	if q.tx != nil {
+		return q.tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
+
+func (q *Queries) exec(ctx context.Context, query *Query, args ...interface{}) (sql.Result, error) {
+	if stmt := q.stmt(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return q.db.ExecContext(ctx, query.SQL, args...)
+}
+
+func (q *Queries) query(ctx context.Context, query *Query, args ...interface{}) (*sql.Rows, error) {
+	if stmt := q.stmt(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return q.db.QueryContext(ctx, query.SQL, args...)
+}
+
+func (q *Queries) queryRow(ctx context.Context, query *Query, args ...interface{}) *sql.Row {
+	if stmt := q.stmt(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return q.db.QueryRowContext(ctx, query.SQL, args...)
+}
+
+var (
+	sharedMu sync.RWMutex
+	shared   *Queries
+)
+
+// Init prepares every statement on database.DB and shares the result through
+// Default. It must run after database.InitDB.
+func Init(ctx context.Context) error {
+	q, err := Prepare(ctx, database.DB)
+	if err != nil {
+		return err
+	}
+	sharedMu.Lock()
+	shared = q
+	sharedMu.Unlock()
+	return nil
+}
+
+// Default returns the query set prepared by Init, or an unprepared one on
+// database.DB when Init has not run
+func Default() *Queries {
+	sharedMu.RLock()
+	defer sharedMu.RUnlock()
+	if shared != nil {
+		return shared
+	}
+	return New(database.DB)
+}
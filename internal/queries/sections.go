@@ -0,0 +1,135 @@
+package queries
+
+import (
+	"context"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+var (
+	// New sections go last in the team's order
+	createSection = newQuery("CreateSection", `
+		INSERT INTO channel_sections (team_id, name, position, created_by, created_at)
+		SELECT ?, ?, COALESCE(MAX(position), 0) + 1, ?, ? FROM channel_sections WHERE team_id = ?`)
+
+	getSection = newQuery("GetSection", `
+		SELECT section_id, team_id, name, position, created_by, created_at
+		FROM channel_sections
+		WHERE section_id = ? AND team_id = ?`)
+
+	listSections = newQuery("ListSections", `
+		SELECT section_id, team_id, name, position, created_by, created_at
+		FROM channel_sections
+		WHERE team_id = ?
+		ORDER BY position, section_id`)
+
+	renameSection = newQuery("RenameSection", `
+		UPDATE channel_sections SET name = ? WHERE section_id = ? AND team_id = ?`)
+
+	setSectionPosition = newQuery("SetSectionPosition", `
+		UPDATE channel_sections SET position = ? WHERE section_id = ? AND team_id = ?`)
+
+	deleteSection = newQuery("DeleteSection", `
+		DELETE FROM channel_sections WHERE section_id = ? AND team_id = ?`)
+
+	clearSection = newQuery("ClearSection", `
+		UPDATE channels SET section_id = 0, section_position = 0, updated_at = ?
+		WHERE team_id = ? AND section_id = ?`)
+
+	setChannelSection = newQuery("SetChannelSection", `
+		UPDATE channels SET section_id = ?, section_position = ?, updated_at = ?
+		WHERE channel_id = ? AND team_id = ?`)
+
+	// Every team channel the user belongs to, shared ones included, in
+	// sidebar order within each section
+	listMemberSidebarChannels = newQuery("ListMemberSidebarChannels", `
+		SELECT `+channelColumns+`, `+memberLayoutColumns+`
+		FROM channels c
+		INNER JOIN channel_members cm ON cm.channel_id = c.channel_id
+		WHERE `+teamChannel+` AND cm.user_id = ? AND c.archived_at = 0
+		ORDER BY c.section_id, c.section_position, c.channel_name`)
+)
+
+func scanSection(row rowScanner) (models.ChannelSection, error) {
+	var s models.ChannelSection
+	err := row.Scan(&s.SectionID, &s.TeamID, &s.Name, &s.Position, &s.CreatedBy, &s.CreatedAt)
+	return s, err
+}
+
+// CreateSection adds a section at the end of a team's sidebar and returns
+// its ID
+func (q *Queries) CreateSection(ctx context.Context, teamID int64, name string, createdBy, createdAt int64) (int64, error) {
+	result, err := q.exec(ctx, createSection, teamID, name, createdBy, createdAt, teamID)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetSection returns a section of a team, or sql.ErrNoRows
+func (q *Queries) GetSection(ctx context.Context, sectionID, teamID int64) (models.ChannelSection, error) {
+	return scanSection(q.queryRow(ctx, getSection, sectionID, teamID))
+}
+
+// ListSections returns a team's sections in sidebar order
+func (q *Queries) ListSections(ctx context.Context, teamID int64) ([]models.ChannelSection, error) {
+	rows, err := q.query(ctx, listSections, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := []models.ChannelSection{}
+	for rows.Next() {
+		s, err := scanSection(rows)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+	}
+	return sections, rows.Err()
+}
+
+// RenameSection renames a section of a team
+func (q *Queries) RenameSection(ctx context.Context, sectionID, teamID int64, name string) error {
+	_, err := q.exec(ctx, renameSection, name, sectionID, teamID)
+	return err
+}
+
+// SetSectionPosition moves a section of a team
+func (q *Queries) SetSectionPosition(ctx context.Context, sectionID, teamID int64, position int) error {
+	_, err := q.exec(ctx, setSectionPosition, position, sectionID, teamID)
+	return err
+}
+
+// DeleteSection removes a section, reporting whether the team had it. Its
+// channels are left in no section.
+func (q *Queries) DeleteSection(ctx context.Context, sectionID, teamID, updatedAt int64) (bool, error) {
+	result, err := q.exec(ctx, deleteSection, sectionID, teamID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	return true, q.ClearSection(ctx, sectionID, teamID, updatedAt)
+}
+
+// ClearSection takes every channel out of a section
+func (q *Queries) ClearSection(ctx context.Context, sectionID, teamID, updatedAt int64) error {
+	_, err := q.exec(ctx, clearSection, updatedAt, teamID, sectionID)
+	return err
+}
+
+// SetChannelSection puts a team channel in a section at a position; a
+// sectionID of 0 leaves it in none
+func (q *Queries) SetChannelSection(ctx context.Context, channelID, teamID, sectionID int64, position int, updatedAt int64) error {
+	_, err := q.exec(ctx, setChannelSection, sectionID, position, updatedAt, channelID, teamID)
+	return err
+}
+
+// ListMemberSidebarChannels returns the unarchived team channels a user
+// belongs to, ordered by section and position
+func (q *Queries) ListMemberSidebarChannels(ctx context.Context, teamID, userID int64) ([]models.Channel, error) {
+	return scanMemberChannels(q.query(ctx, listMemberSidebarChannels, teamID, teamID, userID))
+}
@@ -0,0 +1,146 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+const shareColumns = `s.channel_id, c.channel_name, c.team_id, s.team_id, s.status, s.invited_by, s.invited_at, s.accepted_by, s.accepted_at`
+
+var (
+	createShare = newQuery("CreateShare", `
+		INSERT INTO channel_shares (channel_id, team_id, status, invited_by, invited_at) VALUES (?, ?, ?, ?, ?)`)
+
+	getShare = newQuery("GetShare", `
+		SELECT `+shareColumns+`
+		FROM channel_shares s
+		INNER JOIN channels c ON c.channel_id = s.channel_id
+		WHERE s.channel_id = ? AND s.team_id = ?`)
+
+	listChannelShares = newQuery("ListChannelShares", `
+		SELECT `+shareColumns+`
+		FROM channel_shares s
+		INNER JOIN channels c ON c.channel_id = s.channel_id
+		WHERE s.channel_id = ?
+		ORDER BY s.invited_at`)
+
+	listTeamShares = newQuery("ListTeamShares", `
+		SELECT `+shareColumns+`
+		FROM channel_shares s
+		INNER JOIN channels c ON c.channel_id = s.channel_id
+		WHERE s.team_id = ?
+		ORDER BY s.invited_at DESC`)
+
+	acceptShare = newQuery("AcceptShare", `
+		UPDATE channel_shares SET status = ?, accepted_by = ?, accepted_at = ?
+		WHERE channel_id = ? AND team_id = ? AND status = ?`)
+
+	deleteShare = newQuery("DeleteShare", `
+		DELETE FROM channel_shares WHERE channel_id = ? AND team_id = ?`)
+
+	// Members left in the channel without a team that gives them access
+	listStrandedMembers = newQuery("ListStrandedMembers", `
+		SELECT cm.user_id
+		FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		WHERE cm.channel_id = ? AND NOT EXISTS (
+			SELECT 1 FROM user_teams_mapper utm WHERE utm.user_id = cm.user_id AND `+channelTeamMember+`)`)
+
+	removeChannelMember = newQuery("RemoveChannelMember", `
+		DELETE FROM channel_members WHERE channel_id = ? AND user_id = ?`)
+)
+
+func scanShares(rows *sql.Rows, err error) ([]models.ChannelShare, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.ChannelShare{}
+	for rows.Next() {
+		s, err := scanShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, s)
+	}
+	return shares, rows.Err()
+}
+
+func scanShare(row rowScanner) (models.ChannelShare, error) {
+	var s models.ChannelShare
+	err := row.Scan(&s.ChannelID, &s.ChannelName, &s.HostTeamID, &s.TeamID, &s.Status, &s.InvitedBy, &s.InvitedAt, &s.AcceptedBy, &s.AcceptedAt)
+	return s, err
+}
+
+// CreateShare invites a team to share a channel
+func (q *Queries) CreateShare(ctx context.Context, channelID, teamID, invitedBy, invitedAt int64) error {
+	_, err := q.exec(ctx, createShare, channelID, teamID, models.SharePending, invitedBy, invitedAt)
+	return err
+}
+
+// GetShare returns the share of a channel with a team, or sql.ErrNoRows
+func (q *Queries) GetShare(ctx context.Context, channelID, teamID int64) (models.ChannelShare, error) {
+	return scanShare(q.queryRow(ctx, getShare, channelID, teamID))
+}
+
+// ListChannelShares returns the teams a channel is shared with or invited
+// to, oldest first
+func (q *Queries) ListChannelShares(ctx context.Context, channelID int64) ([]models.ChannelShare, error) {
+	return scanShares(q.query(ctx, listChannelShares, channelID))
+}
+
+// ListTeamShares returns the channels other teams share with a team or
+// invited it to, newest first
+func (q *Queries) ListTeamShares(ctx context.Context, teamID int64) ([]models.ChannelShare, error) {
+	return scanShares(q.query(ctx, listTeamShares, teamID))
+}
+
+// AcceptShare activates a pending share, reporting whether there was one
+func (q *Queries) AcceptShare(ctx context.Context, channelID, teamID, acceptedBy, acceptedAt int64) (bool, error) {
+	result, err := q.exec(ctx, acceptShare, models.ShareActive, acceptedBy, acceptedAt, channelID, teamID, models.SharePending)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteShare removes a share or invitation, reporting whether there was
+// one. Call ListStrandedMembers afterwards to find who lost access.
+func (q *Queries) DeleteShare(ctx context.Context, channelID, teamID int64) (bool, error) {
+	result, err := q.exec(ctx, deleteShare, channelID, teamID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ListStrandedMembers returns the members of a channel who are in neither
+// its team nor a team it is shared with
+func (q *Queries) ListStrandedMembers(ctx context.Context, channelID int64) ([]int64, error) {
+	rows, err := q.query(ctx, listStrandedMembers, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// RemoveChannelMember takes a user out of a channel
+func (q *Queries) RemoveChannelMember(ctx context.Context, channelID, userID int64) error {
+	_, err := q.exec(ctx, removeChannelMember, channelID, userID)
+	return err
+}
@@ -0,0 +1,104 @@
+package queries
+
+import (
+	"context"
+
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+const teamColumns = `t.team_id, t.team_name, t.description, t.locale, t.created_by, t.created_at, t.updated_at, t.workspace_id`
+
+var (
+	createTeam = newQuery("CreateTeam", `
+		INSERT INTO teams (team_name, description, created_by, created_at, updated_at, workspace_id)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+
+	getTeam = newQuery("GetTeam", `
+		SELECT `+teamColumns+`
+		FROM teams t
+		WHERE t.team_id = ?`)
+
+	updateTeam = newQuery("UpdateTeam", `
+		UPDATE teams SET team_name = ?, description = ?, updated_at = ? WHERE team_id = ?`)
+
+	setTeamLocale = newQuery("SetTeamLocale", `
+		UPDATE teams SET locale = ? WHERE team_id = ?`)
+
+	countUserTeams = newQuery("CountUserTeams", `
+		SELECT COUNT(*)
+		FROM teams t
+		INNER JOIN user_teams_mapper tm ON tm.team_id = t.team_id
+		WHERE tm.user_id = ?`)
+
+	listUserTeams = newQuery("ListUserTeams", `
+		SELECT `+teamColumns+`
+		FROM teams t
+		INNER JOIN user_teams_mapper tm ON tm.team_id = t.team_id
+		WHERE tm.user_id = ?
+		ORDER BY t.created_at DESC
+		LIMIT ? OFFSET ?`)
+)
+
+func scanTeam(row rowScanner) (models.Team, error) {
+	var t models.Team
+	err := row.Scan(&t.ID, &t.Name, &t.Description, &t.Locale, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt, &t.WorkspaceID)
+	return t, err
+}
+
+// CreateTeam inserts a team in the context's workspace and returns its ID
+func (q *Queries) CreateTeam(ctx context.Context, t models.Team) (int64, error) {
+	result, err := q.exec(ctx, createTeam, t.Name, t.Description, t.CreatedBy, t.CreatedAt, t.UpdatedAt, workspace.FromContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetTeam returns a team, or sql.ErrNoRows
+func (q *Queries) GetTeam(ctx context.Context, teamID int64) (models.Team, error) {
+	return scanTeam(q.queryRow(ctx, getTeam, teamID))
+}
+
+// UpdateTeam sets a team's name and description, reporting the number of
+// rows changed
+func (q *Queries) UpdateTeam(ctx context.Context, teamID int64, name, description string, updatedAt int64) (int64, error) {
+	result, err := q.exec(ctx, updateTeam, name, description, updatedAt, teamID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SetTeamLocale sets the locale of a team's system messages; "" follows the
+// deployment default
+func (q *Queries) SetTeamLocale(ctx context.Context, teamID int64, locale string) error {
+	_, err := q.exec(ctx, setTeamLocale, locale, teamID)
+	return err
+}
+
+// CountUserTeams counts the teams a user belongs to
+func (q *Queries) CountUserTeams(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := q.queryRow(ctx, countUserTeams, userID).Scan(&n)
+	return n, err
+}
+
+// ListUserTeams returns a page of the teams a user belongs to, newest first
+func (q *Queries) ListUserTeams(ctx context.Context, userID int64, limit, offset int) ([]models.Team, error) {
+	rows, err := q.query(ctx, listUserTeams, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []models.Team
+	for rows.Next() {
+		t, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
@@ -0,0 +1,116 @@
+// Package reload applies configuration changes while the process runs, on
+// SIGHUP or from the admin API, so tuning a setting needs no restart and
+// keeps clients connected. Only the settings registered here are reread;
+// the rest still take a restart.
+package reload
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/joho/godotenv"
+
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// Result is the outcome of reloading one setting
+type Result struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+type reloader struct {
+	name  string
+	apply func() (interface{}, error)
+}
+
+var (
+	mu        sync.Mutex
+	reloaders []reloader
+	// fromEnv are the variables set before .env was loaded. As at startup,
+	// .env does not override them.
+	fromEnv = environ()
+	log     = logger.NewLogger("config-reload")
+)
+
+func environ() map[string]bool {
+	names := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		names[name] = true
+	}
+	return names
+}
+
+// Register adds a setting to reload. apply rereads it from the environment
+// and returns the value now in effect.
+func Register(name string, apply func() (interface{}, error)) {
+	mu.Lock()
+	defer mu.Unlock()
+	reloaders = append(reloaders, reloader{name: name, apply: apply})
+}
+
+// All rereads .env, then reloads every registered setting in order. A
+// variable removed from .env is unset, so its setting falls back to its
+// default; one set in the real environment is never touched. A setting that
+// fails keeps its previous value; the others still apply.
+func All() ([]Result, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	vars, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for name, value := range vars {
+		if !fromEnv[name] {
+			os.Setenv(name, value)
+		}
+	}
+	// Only .env sets variables in this process, so any other variable not
+	// in the real environment came from a line since removed
+	for name := range environ() {
+		if _, ok := vars[name]; !ok && !fromEnv[name] {
+			os.Unsetenv(name)
+		}
+	}
+
+	results := make([]Result, 0, len(reloaders))
+	for _, r := range reloaders {
+		value, err := r.apply()
+		result := Result{Name: r.name, Value: value}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Watch reloads the settings whenever the process receives SIGHUP
+func Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			results, err := All()
+			if err != nil {
+				log.Error("Failed to reload configuration", "error", err)
+				continue
+			}
+			for _, r := range results {
+				if r.Error != "" {
+					log.Error("Failed to reload setting", "setting", r.Name, "error", r.Error)
+					continue
+				}
+				log.Info("Reloaded setting", "setting", r.Name, "value", r.Value)
+			}
+		}
+	}()
+}
@@ -0,0 +1,136 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/media"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// Reaper deletes the messages of channels with a message TTL once they
+// expire, along with their attachments, and tells the channel about each
+// one. Like the janitor it rolls them up into the daily channel stats first.
+type Reaper struct {
+	DB      *sql.DB
+	Log     *logger.Logger
+	Storage storage.Storage
+}
+
+// StartDisappearing launches the reaper of disappearing messages.
+// DISAPPEARING_INTERVAL_SECONDS sets how often expired messages are looked
+// for (default 60), which bounds how long they outlive their TTL.
+func StartDisappearing() {
+	seconds := 60
+	if v, err := strconv.Atoi(os.Getenv("DISAPPEARING_INTERVAL_SECONDS")); err == nil && v > 0 {
+		seconds = v
+	}
+
+	r := &Reaper{
+		DB:      database.DB,
+		Log:     logger.NewLogger("disappearing-messages"),
+		Storage: storage.Default(),
+	}
+	go r.run(time.Duration(seconds) * time.Second)
+}
+
+func (r *Reaper) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		purged, err := r.Purge(ctx, now.UTC())
+		if err != nil {
+			r.Log.Error("Failed to purge disappearing messages", "error", err, "purged", purged)
+		} else if purged > 0 {
+			r.Log.Info("Purged disappearing messages", "purged", purged)
+		}
+		cancel()
+	}
+}
+
+type ttlChannel struct {
+	channelID int64
+	teamID    int64
+	ttl       int64
+}
+
+// Purge deletes every message older than its channel's TTL, hot or
+// archived, and returns how many were deleted
+func (r *Reaper) Purge(ctx context.Context, now time.Time) (int64, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT channel_id, team_id, message_ttl_seconds FROM channels
+		WHERE message_ttl_seconds > 0`)
+	if err != nil {
+		return 0, err
+	}
+	var channels []ttlChannel
+	for rows.Next() {
+		var c ttlChannel
+		if err := rows.Scan(&c.channelID, &c.teamID, &c.ttl); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		channels = append(channels, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	defer func() {
+		if total > 0 {
+			outbox.Notify()
+		}
+	}()
+	for _, c := range channels {
+		args := []interface{}{c.channelID, now.Unix() - c.ttl}
+		var files []string
+		deleted := func(tx *sql.Tx, ids []int64) error {
+			keys, err := media.DeleteForMessages(ctx, tx, ids)
+			if err != nil {
+				return err
+			}
+			files = keys
+			for _, id := range ids {
+				err := outbox.Write(ctx, tx, c.channelID, events.TypeMessageDeleted, events.MessageDeleted{
+					MessageID: id,
+					ChannelID: c.channelID,
+					TeamID:    c.teamID,
+					Reason:    "expired",
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, table := range history.Tables {
+			for {
+				files = nil
+				n, err := purgeBatch(ctx, r.DB, table, `channel_id = ? AND message_created_at < ?`, args, deleted)
+				total += n
+				if err != nil {
+					return total, err
+				}
+				// Files go once their rows are gone
+				if err := media.DeleteFiles(ctx, r.Storage, files); err != nil {
+					r.Log.Error("Failed to delete expired attachment files", "error", err, "channel_id", c.channelID)
+				}
+				if n == 0 {
+					break
+				}
+			}
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,187 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/media"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// batchSize bounds how many messages one purge transaction removes
+const batchSize = 1000
+
+// Janitor deletes messages older than the retention period, along with
+// their attachments. Each batch is first rolled up into the daily channel
+// stats, so analytics outlive the messages without keeping their content.
+type Janitor struct {
+	DB            *sql.DB
+	Log           *logger.Logger
+	Storage       storage.Storage
+	RetentionDays int
+}
+
+// Start launches the retention janitor. MESSAGE_RETENTION_DAYS sets how long
+// messages are kept (default 0, which keeps them forever) and
+// RETENTION_INTERVAL_HOURS how often old messages are purged (default 24).
+func Start() {
+	days := 0
+	if v, err := strconv.Atoi(os.Getenv("MESSAGE_RETENTION_DAYS")); err == nil && v >= 0 {
+		days = v
+	}
+	hours := 24
+	if v, err := strconv.Atoi(os.Getenv("RETENTION_INTERVAL_HOURS")); err == nil && v > 0 {
+		hours = v
+	}
+	if days == 0 {
+		return
+	}
+
+	j := &Janitor{
+		DB:            database.DB,
+		Log:           logger.NewLogger("retention-janitor"),
+		Storage:       storage.Default(),
+		RetentionDays: days,
+	}
+	go j.run(time.Duration(hours) * time.Hour)
+}
+
+func (j *Janitor) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		purged, err := j.Purge(ctx, now.UTC())
+		if err != nil {
+			j.Log.Error("Failed to purge expired messages", "error", err, "purged", purged)
+		} else if purged > 0 {
+			j.Log.Info("Purged expired messages", "purged", purged)
+		}
+		cancel()
+	}
+}
+
+// Purge rolls up and deletes every message older than RetentionDays, hot or
+// archived, one batch per transaction, and returns how many were deleted
+func (j *Janitor) Purge(ctx context.Context, now time.Time) (int64, error) {
+	cutoff := now.AddDate(0, 0, -j.RetentionDays).Unix()
+	var total int64
+	var files []string
+	deleted := func(tx *sql.Tx, ids []int64) error {
+		keys, err := media.DeleteForMessages(ctx, tx, ids)
+		files = keys
+		return err
+	}
+	for _, table := range history.Tables {
+		for {
+			files = nil
+			n, err := purgeBatch(ctx, j.DB, table, `message_created_at < ?`, []interface{}{cutoff}, deleted)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			// Files go once their rows are gone
+			if err := media.DeleteFiles(ctx, j.Storage, files); err != nil {
+				j.Log.Error("Failed to delete purged attachment files", "error", err)
+			}
+			if n == 0 {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// purgeBatch handles the oldest messages of a message table matching where
+// up to batchSize. Rollup and delete use the same predicate inside one
+// transaction, so every purged message is counted exactly once. deleted,
+// when set, is given the IDs of the batch before it commits.
+func purgeBatch(ctx context.Context, db *sql.DB, table, where string, args []interface{}, deleted func(tx *sql.Tx, ids []int64) error) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the batch; its highest ID bounds every statement below
+	rows, err := tx.QueryContext(ctx, `
+		SELECT message_id FROM `+table+`
+		WHERE `+where+`
+		ORDER BY message_id
+		LIMIT ?
+		FOR UPDATE`, append(args, batchSize)...)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	batch := append(append([]interface{}{}, args...), ids[len(ids)-1])
+	where += ` AND message_id <= ?`
+
+	// Participation first; the daily participant count is derived from it
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_daily_participants (channel_id, day_start, user_id, message_count)
+		SELECT channel_id, message_created_at - MOD(message_created_at, 86400), user_id, COUNT(*)
+		FROM `+table+`
+		WHERE `+where+`
+		GROUP BY channel_id, message_created_at - MOD(message_created_at, 86400), user_id
+		ON DUPLICATE KEY UPDATE message_count = message_count + VALUES(message_count)`, batch...)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO channel_daily_stats (channel_id, day_start, message_count, participant_count)
+		SELECT m.channel_id, m.day_start, m.message_count,
+			(SELECT COUNT(*) FROM channel_daily_participants p
+			 WHERE p.channel_id = m.channel_id AND p.day_start = m.day_start)
+		FROM (
+			SELECT channel_id, message_created_at - MOD(message_created_at, 86400) AS day_start, COUNT(*) AS message_count
+			FROM `+table+`
+			WHERE `+where+`
+			GROUP BY channel_id, message_created_at - MOD(message_created_at, 86400)
+		) m
+		ON DUPLICATE KEY UPDATE message_count = message_count + VALUES(message_count),
+			participant_count = VALUES(participant_count)`, batch...)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM message_link_previews
+		WHERE message_id IN (SELECT message_id FROM (
+			SELECT message_id FROM `+table+` WHERE `+where+`) m)`, batch...)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+where, batch...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if deleted != nil {
+		if err := deleted(tx, ids); err != nil {
+			return 0, err
+		}
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// writeError sends the JSON error envelope every endpoint uses
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// notFound answers requests for paths no route declares
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "No route for "+r.URL.Path)
+}
+
+// methodNotAllowed answers requests for a declared path with a method it
+// does not serve, listing the ones it does in Allow
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed []string
+		seen := make(map[string]bool)
+		for _, route := range registered {
+			if seen[route.Method] {
+				continue
+			}
+			probe := r.Clone(r.Context())
+			probe.Method = route.Method
+			var match mux.RouteMatch
+			if router.Match(probe, &match) && match.MatchErr == nil {
+				seen[route.Method] = true
+				allowed = append(allowed, route.Method)
+			}
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed on "+r.URL.Path)
+	})
+}
+
+// debugEnabled reports whether debug endpoints are served. Like the logger,
+// an unset APP_ENV means development.
+func debugEnabled() bool {
+	env := os.Getenv("APP_ENV")
+	return env == "" || env == "development"
+}
+
+// routeInfo describes a registered route for the route listing
+type routeInfo struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Permission   string `json:"permission"`
+	RateLimit    string `json:"rate_limit"`
+	TokenScope   string `json:"token_scope,omitempty"`
+	Tag          string `json:"tag,omitempty"`
+	Summary      string `json:"summary,omitempty"`
+	Impersonable bool   `json:"impersonable,omitempty"`
+	Streaming    bool   `json:"streaming,omitempty"`
+	Deprecated   bool   `json:"deprecated,omitempty"`
+}
+
+// listRoutes returns every registered route with its middleware settings,
+// for troubleshooting routing and permissions in development
+func listRoutes(w http.ResponseWriter, r *http.Request) {
+	names := map[Permission]string{Public: "public", Authenticated: "authenticated", Admin: "admin"}
+	list := make([]routeInfo, 0, len(registered))
+	for _, route := range registered {
+		info := routeInfo{
+			Method:       route.Method,
+			Path:         route.Path,
+			Permission:   names[route.Permission],
+			RateLimit:    string(route.RateLimit),
+			Tag:          route.Tag,
+			Summary:      route.Summary,
+			Impersonable: route.Impersonable,
+			Streaming:    route.Streaming,
+			Deprecated:   route.Deprecation != nil,
+		}
+		if route.Permission != Public {
+			info.TokenScope = tokenScope(route)
+		}
+		list = append(list, info)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"routes": list})
+}
+
+// registerDebug adds the debug endpoints outside the route table, so they
+// never appear in the OpenAPI document, and only in development. They still
+// require an administrator.
+func registerDebug(router *mux.Router) {
+	if !debugEnabled() {
+		return
+	}
+	route := Route{Method: http.MethodGet, Path: "/debug/routes", Handler: listRoutes, Permission: Admin, RateLimit: RateLimitAdmin, SessionOnly: true}
+	router.Handle(route.Path, chain(route)).Methods(route.Method)
+}
@@ -0,0 +1,212 @@
+package routes
+
+//go:generate go run ../../cmd/openapi -out ../../api/openapi.json
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// APIVersion is the version reported in the OpenAPI document
+const APIVersion = "1.0.0"
+
+// Spec builds the OpenAPI 3 document describing the route table. It is
+// derived from the same declarations the router is built from, so served
+// documentation cannot drift from the handlers; api/openapi.json is the
+// committed copy for SDK generation, refreshed with go generate.
+func Spec() map[string]interface{} {
+	table := Table()
+	if table == nil {
+		table = routeTable(Services{})
+	}
+
+	paths := make(map[string]map[string]interface{})
+	tags := make(map[string]bool)
+	operationIDs := make(map[string]int)
+	for _, route := range table {
+		path, params := openAPIPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		if route.Tag != "" {
+			tags[route.Tag] = true
+		}
+
+		id := operationID(route.Handler)
+		operationIDs[id]++
+		if n := operationIDs[id]; n > 1 {
+			id = fmt.Sprintf("%s%d", id, n)
+		}
+
+		responses := map[string]interface{}{
+			"200":     map[string]interface{}{"description": "Success"},
+			"default": map[string]interface{}{"$ref": "#/components/responses/Error"},
+		}
+		op := map[string]interface{}{
+			"operationId": id,
+			"summary":     route.Summary,
+			"responses":   responses,
+		}
+		if route.Tag != "" {
+			op["tags"] = []string{route.Tag}
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		var notes []string
+		switch route.Permission {
+		case Public:
+			op["security"] = []interface{}{}
+		case Admin:
+			notes = append(notes, "Requires an instance administrator.")
+			responses["403"] = map[string]interface{}{"$ref": "#/components/responses/Error"}
+			fallthrough
+		case Authenticated:
+			responses["401"] = map[string]interface{}{"$ref": "#/components/responses/Error"}
+		}
+		if route.Impersonable {
+			notes = append(notes, "Accepts impersonation tokens.")
+		}
+		if route.Permission != Public {
+			if scope := tokenScope(route); scope != "" {
+				notes = append(notes, "Personal access tokens need the "+scope+" scope.")
+			} else {
+				notes = append(notes, "Does not accept personal access tokens.")
+			}
+		}
+		if route.Deprecation != nil {
+			op["deprecated"] = true
+			if route.Deprecation.Successor != "" {
+				notes = append(notes, "Use "+route.Deprecation.Successor+" instead.")
+			}
+			if route.Deprecation.Sunset != "" {
+				notes = append(notes, "May be removed after "+route.Deprecation.Sunset+".")
+			}
+		}
+		if len(notes) > 0 {
+			op["description"] = strings.Join(notes, " ")
+		}
+
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	tagList := make([]map[string]string, 0, len(tags))
+	for tag := range tags {
+		tagList = append(tagList, map[string]string{"name": tag})
+	}
+	sort.Slice(tagList, func(i, j int) bool { return tagList[i]["name"] < tagList[j]["name"] })
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Eaven API",
+			"version": APIVersion,
+		},
+		"tags":  tagList,
+		"paths": paths,
+		// Routes without security of their own require a bearer token
+		"security": []interface{}{map[string][]string{"bearerAuth": {}}},
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT or personal access token"},
+			},
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "Error",
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type":       "object",
+								"properties": map[string]interface{}{"error": map[string]string{"type": "string"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts a mux path template to OpenAPI form, dropping any
+// variable patterns, and returns its path parameters
+func openAPIPath(path string) (string, []map[string]interface{}) {
+	var params []map[string]interface{}
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(path, '{')
+		if start < 0 {
+			b.WriteString(path)
+			break
+		}
+		end := strings.IndexByte(path[start:], '}')
+		if end < 0 {
+			b.WriteString(path)
+			break
+		}
+		name, _, _ := strings.Cut(path[start+1:start+end], ":")
+		b.WriteString(path[:start] + "{" + name + "}")
+		path = path[start+end+1:]
+
+		schema := map[string]string{"type": "string"}
+		if strings.HasSuffix(name, "_id") || name == "id" {
+			schema = map[string]string{"type": "integer", "format": "int64"}
+		}
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	return b.String(), params
+}
+
+// operationID names an operation after its handler method
+func operationID(h http.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	name = strings.TrimSuffix(name, "-fm")
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return "operation"
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// serveOpenAPI serves the OpenAPI document of the running server
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(Spec())
+}
+
+// swaggerUI loads Swagger UI from its CDN and points it at /openapi.json
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Eaven API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
+
+// serveSwaggerUI serves interactive documentation for /openapi.json
+func serveSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	fmt.Fprint(w, swaggerUI)
+}
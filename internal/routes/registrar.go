@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/pat"
+)
+
+// Permission is the access level a route requires
+type Permission int
+
+const (
+	// Public routes need no authentication
+	Public Permission = iota
+	// Authenticated routes need a valid user token
+	Authenticated
+	// Admin routes need an instance administrator
+	Admin
+)
+
+// RateLimitClass groups routes that share a rate limit budget
+type RateLimitClass string
+
+const (
+	RateLimitDefault RateLimitClass = "default"
+	RateLimitAuth    RateLimitClass = "auth"
+	RateLimitWrite   RateLimitClass = "write"
+	RateLimitAdmin   RateLimitClass = "admin"
+	// RateLimitPublic covers unauthenticated pages anyone with a link can open
+	RateLimitPublic RateLimitClass = "public"
+)
+
+// Deprecation marks a route as scheduled for removal
+type Deprecation struct {
+	// Sunset is the HTTP date after which the route may be removed
+	Sunset string
+	// Successor is the path clients should move to
+	Successor string
+}
+
+// Route declares a single endpoint
+type Route struct {
+	Method      string
+	Path        string
+	Handler     http.HandlerFunc
+	Permission  Permission
+	RateLimit   RateLimitClass
+	Summary     string
+	Tag         string
+	Deprecation *Deprecation
+	// Streaming routes move bodies for as long as the client takes, so they
+	// run without the request DB timeout
+	Streaming bool
+	// Impersonable routes accept impersonation tokens. They must only read.
+	Impersonable bool
+	// TokenScope is the personal access token scope the route needs. It
+	// defaults to admin for admin routes, read for GET and impersonable
+	// routes and admin for the rest.
+	TokenScope string
+	// SessionOnly routes refuse personal access tokens, so a token cannot mint
+	// more tokens or change the password
+	SessionOnly bool
+}
+
+var (
+	rateLimitMu  sync.RWMutex
+	rateLimiters = make(map[RateLimitClass]func(http.Handler) http.Handler)
+)
+
+// RegisterRateLimiter installs the middleware enforcing a rate limit class.
+// Classes have no limit until a limiter is registered. It must be called
+// before RegisterAllRoutes.
+func RegisterRateLimiter(class RateLimitClass, limiter func(http.Handler) http.Handler) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+	rateLimiters[class] = limiter
+}
+
+// register adds every route in the table to the router with the middleware
+// implied by its declaration
+func register(router *mux.Router, table []Route) {
+	for _, route := range table {
+		router.Handle(route.Path, chain(route)).Methods(route.Method)
+	}
+}
+
+// chain wraps a route's handler, outermost first: the DB timeout, the
+// maintenance mode check (admin routes are exempt, so it can be turned off),
+// authentication, the impersonation and token scope guards, admin check,
+// rate limiting, deprecation headers, then the JSON response wrapper
+func chain(route Route) http.Handler {
+	var h http.Handler = route.Handler
+	h = middleware.ResponseWrapperMiddleware(h)
+	if route.Deprecation != nil {
+		h = deprecationHeaders(*route.Deprecation, h)
+	}
+
+	rateLimitMu.RLock()
+	limiter, ok := rateLimiters[route.RateLimit]
+	rateLimitMu.RUnlock()
+	if ok {
+		h = limiter(h)
+	}
+
+	switch route.Permission {
+	case Admin:
+		h = middleware.AuthMiddleware(middleware.DenyImpersonation(middleware.RequireTokenScope(tokenScope(route), middleware.AdminMiddleware(h))))
+	case Authenticated:
+		h = middleware.RequireTokenScope(tokenScope(route), h)
+		if !route.Impersonable {
+			h = middleware.DenyImpersonation(h)
+		}
+		h = middleware.AuthMiddleware(h)
+	}
+
+	if route.Permission != Admin {
+		h = middleware.RejectDuringMaintenance(h)
+	}
+	if !route.Streaming {
+		h = middleware.TimeoutMiddleware(middleware.DBTimeout(), h)
+	}
+	return h
+}
+
+// tokenScope is the personal access token scope a route needs, or "" when
+// tokens are refused
+func tokenScope(route Route) string {
+	switch {
+	case route.SessionOnly:
+		return ""
+	case route.TokenScope != "":
+		return route.TokenScope
+	case route.Permission == Admin:
+		return pat.ScopeAdmin
+	case route.Method == http.MethodGet || route.Impersonable:
+		return pat.ScopeRead
+	default:
+		return pat.ScopeAdmin
+	}
+}
+
+// deprecationHeaders advertises a route's deprecation following the
+// Deprecation and Sunset header drafts
+func deprecationHeaders(d Deprecation, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if d.Sunset != "" {
+			w.Header().Set("Sunset", d.Sunset)
+		}
+		if d.Successor != "" {
+			w.Header().Set("Link", "<"+d.Successor+`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,29 +1,31 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/gorilla/mux"
-	authRoute "github.com/nikhil/eaven/internal/routes/Auth"
-	teamroutes "github.com/nikhil/eaven/internal/routes/TeamRoutes"
-	channnelRoutes "github.com/nikhil/eaven/internal/routes/channels"
-	userRoutes "github.com/nikhil/eaven/internal/routes/user"
+	"github.com/nikhil/eaven/internal/middleware"
 )
 
-// List of all route registration functions
-var routeModules = []func(*mux.Router){
-	authRoute.RegisterAuthRoutes,
-	userRoutes.UserProfileRoutes,
-	teamroutes.TeamRoutes,
-	channnelRoutes.ChannelRoutes,
-}
+// registered holds the table used to build the router, for introspection
+var registered []Route
 
-// Register all routes dynamically
-func RegisterAllRoutes() *mux.Router {
+// Register all routes from the route table, served by svc
+func RegisterAllRoutes(svc Services) *mux.Router {
 	router := mux.NewRouter()
+	router.Use(middleware.LogContextMiddleware, middleware.WorkspaceMiddleware)
 
-	// Apply route modules
-	for _, register := range routeModules {
-		register(router)
-	}
+	registered = routeTable(svc)
+	register(router, registered)
+	registerDebug(router)
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = methodNotAllowed(router)
 
 	return router
 }
+
+// Table returns the routes registered by RegisterAllRoutes. The OpenAPI
+// generator and route listings read from this.
+func Table() []Route {
+	return registered
+}
@@ -0,0 +1,209 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/handlers"
+	"github.com/nikhil/eaven/internal/pat"
+	adminService "github.com/nikhil/eaven/internal/service/admin"
+	attachmentService "github.com/nikhil/eaven/internal/service/attachments"
+	services "github.com/nikhil/eaven/internal/service/auth"
+	channelService "github.com/nikhil/eaven/internal/service/channels"
+	graphService "github.com/nikhil/eaven/internal/service/graph"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+	teamService "github.com/nikhil/eaven/internal/service/team"
+	profileService "github.com/nikhil/eaven/internal/service/users"
+)
+
+// Services are the handlers the route table dispatches to. They are built
+// with their dependencies by the caller of RegisterAllRoutes.
+type Services struct {
+	Auth       *services.AuthService
+	Profile    *profileService.ProfileService
+	Team       *teamService.TeamService
+	Channel    *channelService.ChannelService
+	Message    *messageService.MessageService
+	Admin      *adminService.AdminService
+	Attachment *attachmentService.AttachmentService
+	Graph      *graphService.GraphService
+}
+
+// routeTable declares every endpoint served by the API. Handlers are only
+// referenced here, not called, so the OpenAPI generator can build the table
+// from an empty Services.
+func routeTable(svc Services) []Route {
+	authHandler := handlers.NewAuthHandler(svc.Auth)
+	profileService := svc.Profile
+	teamService := svc.Team
+	channelService := svc.Channel
+	messageService := svc.Message
+	adminService := svc.Admin
+	attachmentService := svc.Attachment
+	graphService := svc.Graph
+
+	return []Route{
+		// Auth routes
+		{Method: http.MethodPost, Path: "/auth/signup", Handler: authHandler.Signup, Permission: Public, RateLimit: RateLimitAuth, Tag: "auth", Summary: "Register a new user"},
+		{Method: http.MethodPost, Path: "/auth/login", Handler: authHandler.Login, Permission: Public, RateLimit: RateLimitAuth, Tag: "auth", Summary: "Log in and receive a token"},
+
+		// User profile routes
+		{Method: http.MethodGet, Path: "/user/profile", Handler: profileService.GetUserProfile, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "Get the current user's profile"},
+		{Method: http.MethodPut, Path: "/user/profile", Handler: profileService.UpdateUserProfile, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Update the current user's profile"},
+		{Method: http.MethodPost, Path: "/user/change-password", Handler: authHandler.ChangePassword, Permission: Authenticated, RateLimit: RateLimitAuth, Tag: "user", Summary: "Change the password and sign out other sessions", SessionOnly: true},
+		{Method: http.MethodPut, Path: "/user/handle", Handler: profileService.ChangeHandle, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Change your @handle; the old one redirects for 30 days"},
+		{Method: http.MethodGet, Path: "/user/by-handle/{handle}", Handler: profileService.GetUserByHandle, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "Look up a user by @handle", Impersonable: true},
+		{Method: http.MethodGet, Path: "/user/preferences", Handler: profileService.GetPreferences, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "Get client settings synced across devices"},
+		{Method: http.MethodPatch, Path: "/user/preferences", Handler: profileService.UpdatePreferences, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Merge-patch client settings; null resets a key"},
+		{Method: http.MethodGet, Path: "/user/activity", Handler: profileService.GetUserActivity, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "Unread and mention counts across all channels", Impersonable: true},
+		{Method: http.MethodGet, Path: "/user/digest", Handler: profileService.GetDigestPreferences, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "Get digest email preferences"},
+		{Method: http.MethodPut, Path: "/user/digest", Handler: profileService.UpdateDigestPreferences, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Update digest email preferences"},
+		{Method: http.MethodGet, Path: "/user/offline-email", Handler: profileService.GetOfflineEmailPreferences, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "Get offline mention email preferences"},
+		{Method: http.MethodPut, Path: "/user/offline-email", Handler: profileService.UpdateOfflineEmailPreferences, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Turn offline mention emails on or off"},
+		{Method: http.MethodPost, Path: "/user/{user_id}/report", Handler: profileService.ReportUser, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Report a member of one of your teams"},
+		{Method: http.MethodGet, Path: "/user/tokens", Handler: profileService.ListAccessTokens, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "List personal access tokens", SessionOnly: true},
+		{Method: http.MethodPost, Path: "/user/tokens", Handler: profileService.CreateAccessToken, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Create a scoped, expiring personal access token", SessionOnly: true},
+		{Method: http.MethodDelete, Path: "/user/tokens/{token_id}", Handler: profileService.RevokeAccessToken, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Revoke a personal access token", SessionOnly: true},
+		{Method: http.MethodGet, Path: "/user/keys", Handler: profileService.ListDeviceKeys, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "List the public keys of your devices"},
+		{Method: http.MethodPut, Path: "/user/keys/{device_id}", Handler: profileService.PublishDeviceKey, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Publish or rotate a device's public key"},
+		{Method: http.MethodDelete, Path: "/user/keys/{device_id}", Handler: profileService.RevokeDeviceKey, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "user", Summary: "Revoke a device's public key"},
+		{Method: http.MethodGet, Path: "/user/{user_id}/keys", Handler: profileService.GetUserKeys, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "user", Summary: "Get another user's device public keys"},
+		{Method: http.MethodGet, Path: "/email-subscriptions/unsubscribe", Handler: profileService.UnsubscribeChannelEmail, Permission: Public, RateLimit: RateLimitAuth, Tag: "user", Summary: "Unsubscribe an email address from channel summaries"},
+
+		// Team routes
+		{Method: http.MethodPost, Path: "/team/create", Handler: teamService.CreateTeam, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Create a team"},
+		{Method: http.MethodGet, Path: "/team/all", Handler: teamService.GetUserTeams, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "List the current user's teams", Impersonable: true},
+		{Method: http.MethodGet, Path: "/team/get/{team_id}", Handler: teamService.GetTeam, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Get a team", Impersonable: true},
+		{Method: http.MethodPut, Path: "/team/update/{team_id}", Handler: teamService.UpdateTeam, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Update a team"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/channels", Handler: teamService.GetTeamChannels, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "List the user's channels in a team", Impersonable: true},
+		{Method: http.MethodGet, Path: "/team/{team_id}/channels/delta", Handler: teamService.GetTeamChannelsDelta, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Channel changes since a checkpoint", Impersonable: true},
+		{Method: http.MethodPut, Path: "/team/{team_id}/channels/order", Handler: teamService.SetChannelOrder, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Save your manual order of the team's channels"},
+		{Method: http.MethodPost, Path: "/team/{team_id}/channels/bulk", Handler: teamService.BulkCreateChannels, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Create a set of channels from a template or list"},
+		{Method: http.MethodGet, Path: "/channel-templates", Handler: teamService.ListChannelTemplates, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "List the built-in channel templates"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/messages/search", Handler: teamService.SearchMessages, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Search messages with from:, in:, before:, after: and has: filters", TokenScope: pat.ScopeRead},
+		{Method: http.MethodGet, Path: "/team/{team_id}/autocomplete", Handler: teamService.Autocomplete, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Suggest members and channels for @mention and #channel pickers", Impersonable: true},
+		{Method: http.MethodGet, Path: "/team/{team_id}/members/search", Handler: teamService.SearchMembers, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Find team members by @handle or name", Impersonable: true},
+		{Method: http.MethodPost, Path: "/team/{team_id}/guests", Handler: teamService.AddGuest, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Add a guest limited to specific channels"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/stats", Handler: teamService.GetTeamStats, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Usage statistics for team owners"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/limits", Handler: teamService.GetTeamLimits, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Plan limits and usage of a team"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/features", Handler: teamService.GetTeamFeatures, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Feature flags that are on for a team", Impersonable: true, TokenScope: pat.ScopeRead},
+		{Method: http.MethodGet, Path: "/team/{team_id}/link-policy", Handler: teamService.GetLinkPolicy, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "List the team's allowed and blocked link domains"},
+		{Method: http.MethodPut, Path: "/team/{team_id}/link-policy", Handler: teamService.SetLinkPolicy, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Allow or block a link domain"},
+		{Method: http.MethodDelete, Path: "/team/{team_id}/link-policy/{domain}", Handler: teamService.DeleteLinkPolicy, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Remove a link domain rule"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/sections", Handler: teamService.ListSections, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "List the team's channel sections in sidebar order", TokenScope: pat.ScopeRead},
+		{Method: http.MethodPost, Path: "/team/{team_id}/sections", Handler: teamService.CreateSection, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Add a channel section"},
+		{Method: http.MethodPut, Path: "/team/{team_id}/sections", Handler: teamService.OrderSections, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Reorder the team's channel sections"},
+		{Method: http.MethodPut, Path: "/team/{team_id}/sections/{section_id}", Handler: teamService.RenameSection, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Rename a channel section"},
+		{Method: http.MethodDelete, Path: "/team/{team_id}/sections/{section_id}", Handler: teamService.DeleteSection, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Delete a channel section, leaving its channels unsectioned"},
+		{Method: http.MethodPut, Path: "/team/{team_id}/sections/{section_id}/channels", Handler: teamService.SetSectionChannels, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Set the channels of a section and their order"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/sidebar", Handler: teamService.GetSidebar, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Your channels grouped by section in sidebar order", Impersonable: true, TokenScope: pat.ScopeRead},
+		{Method: http.MethodGet, Path: "/team/{team_id}/shared-channels", Handler: teamService.ListSharedChannels, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Channels other teams share with the team, invitations included"},
+		{Method: http.MethodPost, Path: "/team/{team_id}/shared-channels/{channel_id}/accept", Handler: teamService.AcceptSharedChannel, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Accept another team's invitation to share a channel"},
+		{Method: http.MethodPost, Path: "/team/{team_id}/announce", Handler: teamService.Announce, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Announce to the whole team in its public channels or by direct notification"},
+		{Method: http.MethodGet, Path: "/team/{team_id}/moderation-policy", Handler: teamService.GetModerationPolicy, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "team", Summary: "Get the team's content moderation policy"},
+		{Method: http.MethodPut, Path: "/team/{team_id}/moderation-policy", Handler: teamService.SetModerationPolicy, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "team", Summary: "Change the team's content moderation policy"},
+
+		// Channel routes
+		{Method: http.MethodPost, Path: "/channel/create", Handler: channelService.CreateChannel, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Create a channel"},
+		{Method: http.MethodGet, Path: "/channel/get/{channel_id}", Handler: channelService.GetChannel, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "Get a channel", Impersonable: true},
+		{Method: http.MethodGet, Path: "/team/{team_id}/channel/{slug}", Handler: channelService.GetChannelBySlug, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "Get a team channel by its slug", Impersonable: true},
+		{Method: http.MethodPost, Path: "/channel/{channel_id}/join", Handler: channelService.SubscribeChannel, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Join a channel"},
+		{Method: http.MethodPost, Path: "/channel/{channel_id}/read", Handler: channelService.MarkChannelRead, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Mark a channel as read"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/notifications", Handler: channelService.GetNotificationLevel, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "Get how the channel notifies you", Impersonable: true},
+		{Method: http.MethodPut, Path: "/channel/{channel_id}/notifications", Handler: channelService.SetNotificationLevel, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Get all messages, only mentions, or mute the channel"},
+		{Method: http.MethodPut, Path: "/channel/{channel_id}/star", Handler: channelService.SetChannelStarred, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Star or unstar a channel in your sidebar"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/shares", Handler: channelService.ListChannelShares, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "The team a channel is shared with"},
+		{Method: http.MethodPost, Path: "/channel/{channel_id}/shares", Handler: channelService.ShareChannel, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Invite another team to share a channel"},
+		{Method: http.MethodDelete, Path: "/channel/{channel_id}/shares/{team_id}", Handler: channelService.UnshareChannel, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Stop sharing a channel with a team"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/keys", Handler: channelService.GetChannelKeys, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "Device public keys of every channel member, for encrypting messages"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/standup", Handler: channelService.GetStandup, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "Get the channel's standup schedule"},
+		{Method: http.MethodPut, Path: "/channel/{channel_id}/standup", Handler: channelService.UpdateStandup, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Schedule a standup in the channel"},
+		{Method: http.MethodDelete, Path: "/channel/{channel_id}/standup", Handler: channelService.DeleteStandup, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Stop the channel's standups"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/posters", Handler: channelService.ListPostGrants, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "List members allowed to post in an announcement channel"},
+		{Method: http.MethodPut, Path: "/channel/{channel_id}/posters/{user_id}", Handler: channelService.GrantPosting, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Let a member post in an announcement channel"},
+		{Method: http.MethodDelete, Path: "/channel/{channel_id}/posters/{user_id}", Handler: channelService.RevokePosting, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Stop a member posting in an announcement channel"},
+		{Method: http.MethodPost, Path: "/reminders", Handler: channelService.CreateReminder, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Set a reminder in a channel"},
+		{Method: http.MethodGet, Path: "/reminders", Handler: channelService.ListReminders, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "List your pending reminders"},
+		{Method: http.MethodDelete, Path: "/reminders/{reminder_id}", Handler: channelService.CancelReminder, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Cancel a reminder"},
+		{Method: http.MethodPost, Path: "/channel/{channel_id}/messages/{message_id}/share", Handler: channelService.CreateShareLink, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Create an expiring public link to a message"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/share-links", Handler: channelService.ListShareLinks, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "List the channel's share links and their views"},
+		{Method: http.MethodDelete, Path: "/channel/{channel_id}/share-links/{link_id}", Handler: channelService.RevokeShareLink, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Revoke a share link"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/export", Handler: channelService.ExportChannel, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Stream the message history of a channel small enough to export in the request", Streaming: true},
+		{Method: http.MethodPost, Path: "/channel/{channel_id}/exports", Handler: channelService.CreateChannelExport, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "channel", Summary: "Start a background export of the channel, emailed when ready"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/exports/{export_id}", Handler: channelService.GetChannelExport, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "Get the status of a channel export"},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/exports/{export_id}/download", Handler: channelService.DownloadChannelExport, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "channel", Summary: "Download a channel export", Streaming: true},
+		{Method: http.MethodPost, Path: "/channel/message", Handler: messageService.SendMessage, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "message", Summary: "Send a message", TokenScope: pat.ScopePostMessage},
+		{Method: http.MethodPost, Path: "/channel/{channel_id}/ephemeral", Handler: messageService.SendEphemeralMessage, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "message", Summary: "Show a message to one channel member only, without storing it", TokenScope: pat.ScopePostMessage},
+		{Method: http.MethodPost, Path: "/messages/batch", Handler: messageService.GetMessagesBatch, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "message", Summary: "Recent messages for several channels in one request", TokenScope: pat.ScopeRead},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/messages/around/{message_id}", Handler: messageService.GetMessagesAround, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "message", Summary: "Messages around one, to open a search result or permalink in context", TokenScope: pat.ScopeRead},
+		{Method: http.MethodGet, Path: "/channel/{channel_id}/messages/at", Handler: messageService.GetMessagesAt, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "message", Summary: "Messages around a point in time, to jump to a date", TokenScope: pat.ScopeRead},
+		{Method: http.MethodGet, Path: "/integrations/giphy/search", Handler: messageService.SearchGiphy, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "message", Summary: "Search GIFs to post", TokenScope: pat.ScopeRead},
+		{Method: http.MethodPost, Path: "/message/{message_id}/report", Handler: messageService.ReportMessage, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "message", Summary: "Report a message"},
+		{Method: http.MethodPost, Path: "/channel/{channel_id}/attachments", Handler: attachmentService.UploadAttachment, Permission: Authenticated, RateLimit: RateLimitWrite, Tag: "attachment", Summary: "Upload a file to a channel", Streaming: true, TokenScope: pat.ScopePostMessage},
+
+		// Signed email action routes
+		{Method: http.MethodGet, Path: "/actions/archive-channel", Handler: channelService.ConfirmArchiveAction, Permission: Public, RateLimit: RateLimitAuth, Tag: "channel", Summary: "Confirm archiving an inactive channel"},
+		{Method: http.MethodPost, Path: "/actions/archive-channel", Handler: channelService.ArchiveChannelAction, Permission: Public, RateLimit: RateLimitAuth, Tag: "channel", Summary: "Archive an inactive channel from a signed link"},
+
+		// Public share routes
+		{Method: http.MethodGet, Path: "/share/message", Handler: channelService.ViewSharedMessage, Permission: Public, RateLimit: RateLimitPublic, Tag: "channel", Summary: "View a message through a share link"},
+
+		// Attachment routes
+		{Method: http.MethodGet, Path: "/attachments/{attachment_id}", Handler: attachmentService.GetAttachment, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "attachment", Summary: "Get an attachment with its scan status", TokenScope: pat.ScopeRead},
+		{Method: http.MethodGet, Path: "/attachments/{attachment_id}/download", Handler: attachmentService.DownloadAttachment, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "attachment", Summary: "Download an attachment", Streaming: true},
+		{Method: http.MethodGet, Path: "/attachments/{attachment_id}/thumbnail", Handler: attachmentService.DownloadThumbnail, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "attachment", Summary: "Download the thumbnail of an image attachment", Streaming: true},
+
+		// API documentation routes
+		{Method: http.MethodGet, Path: "/openapi.json", Handler: serveOpenAPI, Permission: Public, RateLimit: RateLimitDefault, Tag: "docs", Summary: "Get the OpenAPI document of this API"},
+		{Method: http.MethodGet, Path: "/docs", Handler: serveSwaggerUI, Permission: Public, RateLimit: RateLimitDefault, Tag: "docs", Summary: "Browse the API documentation"},
+
+		// Realtime routes
+		{Method: http.MethodGet, Path: "/events", Handler: handlers.StreamEvents, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "events", Summary: "Stream realtime events as Server-Sent Events", Streaming: true},
+		{Method: http.MethodGet, Path: "/poll", Handler: handlers.PollEvents, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "events", Summary: "Wait for realtime events after a cursor", Streaming: true},
+
+		// GraphQL routes
+		{Method: http.MethodPost, Path: "/graphql", Handler: graphService.Query, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "graphql", Summary: "Run a GraphQL query over teams, channels, members and messages", Impersonable: true},
+		{Method: http.MethodGet, Path: "/graphql", Handler: graphService.Query, Permission: Authenticated, RateLimit: RateLimitDefault, Tag: "graphql", Summary: "Run a GraphQL query passed in the URL", Impersonable: true},
+
+		// Integration contract routes
+		{Method: http.MethodGet, Path: "/api/v1/event-schemas", Handler: handlers.ListEventSchemas, Permission: Public, RateLimit: RateLimitDefault, Tag: "events", Summary: "List the published event schemas"},
+		{Method: http.MethodGet, Path: "/api/v1/event-schemas/{schema}", Handler: handlers.GetEventSchema, Permission: Public, RateLimit: RateLimitDefault, Tag: "events", Summary: "Get the JSON Schema of an event"},
+
+		// Admin routes
+		{Method: http.MethodGet, Path: "/admin/dead-letters", Handler: adminService.ListDeadLetters, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List failed deliveries"},
+		{Method: http.MethodGet, Path: "/admin/dead-letters/{id}", Handler: adminService.GetDeadLetter, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get a failed delivery"},
+		{Method: http.MethodPost, Path: "/admin/dead-letters/{id}/replay", Handler: adminService.ReplayDeadLetter, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Replay a failed delivery"},
+		{Method: http.MethodGet, Path: "/admin/moderation/queue", Handler: adminService.ListModerationQueue, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List messages held for moderation review"},
+		{Method: http.MethodPost, Path: "/admin/moderation/queue/{item_id}/resolve", Handler: adminService.ResolveModerationItem, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Dismiss or remove a message held for review"},
+		{Method: http.MethodGet, Path: "/admin/reports", Handler: adminService.ListReports, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List abuse reports"},
+		{Method: http.MethodGet, Path: "/admin/reports/{report_id}", Handler: adminService.GetReport, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get an abuse report"},
+		{Method: http.MethodPost, Path: "/admin/reports/{report_id}/resolve", Handler: adminService.ResolveReport, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Dismiss or act on an abuse report"},
+		{Method: http.MethodGet, Path: "/admin/channels/{channel_id}/email-subscriptions", Handler: adminService.ListChannelEmailSubscriptions, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List a channel's email subscribers"},
+		{Method: http.MethodPost, Path: "/admin/channels/{channel_id}/email-subscriptions", Handler: adminService.AddChannelEmailSubscription, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Subscribe an email address to a public channel"},
+		{Method: http.MethodDelete, Path: "/admin/channels/{channel_id}/email-subscriptions/{subscription_id}", Handler: adminService.DeleteChannelEmailSubscription, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Remove a channel email subscriber"},
+		{Method: http.MethodPost, Path: "/admin/users/merge", Handler: adminService.MergeUsers, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Merge a duplicate account into another"},
+		{Method: http.MethodGet, Path: "/admin/account-merges", Handler: adminService.ListAccountMerges, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List account merges"},
+		{Method: http.MethodPost, Path: "/admin/users/{user_id}/impersonate", Handler: adminService.StartImpersonation, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Issue a short-lived read-only token acting as a user", SessionOnly: true},
+		{Method: http.MethodGet, Path: "/admin/impersonations", Handler: adminService.ListImpersonations, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List impersonation sessions"},
+		{Method: http.MethodPost, Path: "/admin/impersonations/{session_id}/end", Handler: adminService.EndImpersonation, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "End an impersonation session"},
+		{Method: http.MethodGet, Path: "/admin/workspaces", Handler: adminService.ListWorkspaces, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List workspaces"},
+		{Method: http.MethodPost, Path: "/admin/workspaces", Handler: adminService.CreateWorkspace, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Create an isolated workspace"},
+		{Method: http.MethodGet, Path: "/admin/workspaces/{workspace_id}/limits", Handler: adminService.GetWorkspaceLimitOverrides, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get the plan limits set on a workspace"},
+		{Method: http.MethodPut, Path: "/admin/workspaces/{workspace_id}/limits", Handler: adminService.SetWorkspaceLimitOverrides, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Set the plan limits of a workspace"},
+		{Method: http.MethodGet, Path: "/admin/teams/{team_id}/limits", Handler: adminService.GetTeamLimitOverrides, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get the plan limits set on a team"},
+		{Method: http.MethodPut, Path: "/admin/teams/{team_id}/limits", Handler: adminService.SetTeamLimitOverrides, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Set the plan limits of a team"},
+		{Method: http.MethodGet, Path: "/admin/feature-flags", Handler: adminService.ListFeatureFlags, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "List feature flags and their settings"},
+		{Method: http.MethodPut, Path: "/admin/feature-flags/{flag}", Handler: adminService.SetFeatureFlag, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Turn a feature flag on or off for every team"},
+		{Method: http.MethodPut, Path: "/admin/feature-flags/{flag}/teams/{team_id}", Handler: adminService.SetTeamFeatureFlag, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Turn a feature flag on or off for one team"},
+		{Method: http.MethodGet, Path: "/admin/diagnostics/stats", Handler: adminService.GetInstanceStats, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get the operational counters of this API process"},
+		{Method: http.MethodGet, Path: "/admin/diagnostics/database", Handler: adminService.GetDatabaseStats, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get database connection pool statistics"},
+		{Method: http.MethodGet, Path: "/admin/diagnostics/streams", Handler: adminService.GetStreamStats, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get the event streams connected to this API process"},
+		{Method: http.MethodGet, Path: "/admin/diagnostics/message-pipeline", Handler: adminService.GetMessagePipelineStats, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Compare the shadowed fan-out pipeline with the current message path"},
+		{Method: http.MethodGet, Path: "/admin/log-level", Handler: adminService.GetLogLevel, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get the log level of this process"},
+		{Method: http.MethodPut, Path: "/admin/log-level", Handler: adminService.SetLogLevel, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Switch this process's log level for a bounded time, then revert"},
+		{Method: http.MethodDelete, Path: "/admin/log-level", Handler: adminService.RevertLogLevel, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Revert a temporary log level early"},
+		{Method: http.MethodPost, Path: "/admin/config/reload", Handler: adminService.ReloadConfig, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Reload the log level, rate limits, CORS origins and feature flags of this process"},
+		{Method: http.MethodGet, Path: "/admin/maintenance", Handler: adminService.GetMaintenance, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Get the maintenance mode and this process's event streams"},
+		{Method: http.MethodPut, Path: "/admin/maintenance", Handler: adminService.SetMaintenance, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Turn maintenance mode on or off, rejecting writes with 503 while it is on"},
+		{Method: http.MethodPost, Path: "/admin/maintenance/drain", Handler: adminService.DrainStreams, Permission: Admin, RateLimit: RateLimitAdmin, Tag: "admin", Summary: "Close this process's event streams with a reconnect notice before a deploy"},
+	}
+}
@@ -0,0 +1,229 @@
+package scan
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+// Scan statuses of attachments. Only clean and unscanned files can be
+// downloaded.
+const (
+	// StatusUnscanned files were uploaded while scanning was disabled
+	StatusUnscanned = "unscanned"
+	StatusPending   = "pending"
+	StatusClean     = "clean"
+	// StatusInfected files have been moved to quarantine
+	StatusInfected = "infected"
+)
+
+// Result is the verdict on one file
+type Result struct {
+	Infected bool
+	// Signature names the malware found
+	Signature string
+}
+
+// Scanner checks file contents for malware
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+const (
+	// pollInterval is how often workers look for files uploaded through
+	// other processes
+	pollInterval = 10 * time.Second
+	// claimTTL is how long a worker has to scan a file before another may
+	// retry it, which is also how failed scans are retried
+	claimTTL = 5 * time.Minute
+	// fileTimeout bounds the scan of one file
+	fileTimeout = 2 * time.Minute
+	batchSize   = 50
+)
+
+var (
+	defaultScanner Scanner
+	loaded         bool
+)
+
+// Default returns the scanner configured from CLAMAV_ADDR, a clamd
+// host:port or Unix socket path, or nil when scanning is disabled
+func Default() Scanner {
+	if !loaded {
+		loaded = true
+		if addr := os.Getenv("CLAMAV_ADDR"); addr != "" {
+			defaultScanner = &ClamAV{Addr: addr, Timeout: fileTimeout}
+		}
+	}
+	return defaultScanner
+}
+
+// wake lets uploads in this process start a scan without waiting for the
+// next poll
+var wake = make(chan struct{}, 1)
+
+// Enqueue tells this process's worker that a file is waiting to be scanned
+func Enqueue() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Worker scans pending attachments and moves infected ones to quarantine
+type Worker struct {
+	DB         *sql.DB
+	Log        *logger.Logger
+	Scanner    Scanner
+	Storage    storage.Storage
+	Quarantine storage.Storage
+}
+
+// Start launches the scan worker when a scanner is configured. Infected
+// files are moved to QUARANTINE_DIR (default ./data/quarantine), out of
+// reach of downloads but kept for inspection.
+func Start() {
+	scanner := Default()
+	if scanner == nil {
+		return
+	}
+	dir := os.Getenv("QUARANTINE_DIR")
+	if dir == "" {
+		dir = filepath.Join("data", "quarantine")
+	}
+	w := &Worker{
+		DB:         database.DB,
+		Log:        logger.NewLogger("scan-worker"),
+		Scanner:    scanner,
+		Storage:    storage.Default(),
+		Quarantine: &storage.LocalStorage{Dir: dir},
+	}
+	go w.run()
+}
+
+func (w *Worker) run() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-wake:
+		}
+		for {
+			n, err := w.ScanPending(context.Background(), time.Now().UTC())
+			if err != nil {
+				w.Log.Error("Failed to scan attachments", "error", err)
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+	}
+}
+
+type pending struct {
+	attachmentID int64
+	key          string
+}
+
+// ScanPending scans up to batchSize pending attachments and returns how
+// many it claimed
+func (w *Worker) ScanPending(ctx context.Context, now time.Time) (int, error) {
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT attachment_id, storage_key
+		FROM attachments
+		WHERE scan_status = ? AND scan_claimed_at < ?
+		ORDER BY attachment_id
+		LIMIT ?`, StatusPending, now.Add(-claimTTL).Unix(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.attachmentID, &p.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	claimed := 0
+	for _, p := range batch {
+		// Claim the file so concurrent workers scan it once
+		claim, err := w.DB.ExecContext(ctx, `
+			UPDATE attachments SET scan_claimed_at = ?
+			WHERE attachment_id = ? AND scan_status = ? AND scan_claimed_at < ?`,
+			now.Unix(), p.attachmentID, StatusPending, now.Add(-claimTTL).Unix())
+		if err != nil {
+			return claimed, err
+		}
+		if n, err := claim.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		claimed++
+		// A failed scan leaves the file pending until its claim expires
+		if err := w.scan(ctx, p); err != nil {
+			w.Log.Error("Failed to scan attachment", "error", err, "attachment_id", p.attachmentID)
+		}
+	}
+	return claimed, nil
+}
+
+func (w *Worker) scan(ctx context.Context, p pending) error {
+	ctx, cancel := context.WithTimeout(ctx, fileTimeout)
+	defer cancel()
+
+	object, err := w.Storage.Open(ctx, p.key)
+	if err != nil {
+		return err
+	}
+	result, err := w.Scanner.Scan(ctx, object)
+	object.Close()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Unix()
+	if !result.Infected {
+		_, err := w.DB.ExecContext(ctx, `UPDATE attachments SET scan_status = ?, scanned_at = ? WHERE attachment_id = ?`, StatusClean, now, p.attachmentID)
+		return err
+	}
+
+	if err := w.quarantine(ctx, p.key); err != nil {
+		return err
+	}
+	_, err = w.DB.ExecContext(ctx, `
+		UPDATE attachments SET scan_status = ?, scan_signature = ?, scanned_at = ?
+		WHERE attachment_id = ?`, StatusInfected, result.Signature, now, p.attachmentID)
+	if err != nil {
+		return err
+	}
+	w.Log.Audit("Attachment quarantined", "attachment_id", p.attachmentID, "signature", result.Signature)
+	return nil
+}
+
+// quarantine moves an object from storage into quarantine under the same key
+func (w *Worker) quarantine(ctx context.Context, key string) error {
+	object, err := w.Storage.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	_, err = w.Quarantine.Put(ctx, key, object)
+	object.Close()
+	if err != nil {
+		return err
+	}
+	return w.Storage.Delete(ctx, key)
+}
@@ -0,0 +1,416 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/outbox"
+)
+
+const (
+	defaultIndexName = "eaven-messages"
+	requestTimeout   = 10 * time.Second
+	reindexPage      = 500
+)
+
+// linkPattern decides has:link for indexed messages. MySQL search uses the
+// previews the unfurler stored instead, which come from the same URLs.
+var linkPattern = regexp.MustCompile(`https?://\S`)
+
+// indexMapping is applied when the index is created. Content goes through
+// the standard analyzer, which matches words case-insensitively.
+const indexMapping = `{
+	"mappings": {
+		"properties": {
+			"message_id": {"type": "long"},
+			"channel_id": {"type": "long"},
+			"team_id":    {"type": "long"},
+			"user_id":    {"type": "long"},
+			"content":    {"type": "text"},
+			"created_at": {"type": "long"},
+			"has":        {"type": "keyword"}
+		}
+	}
+}`
+
+// Elastic mirrors messages into an Elasticsearch or OpenSearch index and
+// searches them there, for installations whose message table is too large
+// for MySQL FULLTEXT. The index holds only what matching needs: results are
+// loaded from MySQL, so permissions, deletions and retention still apply.
+type Elastic struct {
+	URL      string
+	Index    string
+	Username string
+	Password string
+	HTTP     *http.Client
+	Log      *logger.Logger
+}
+
+// document is a message as stored in the index
+type document struct {
+	MessageID int64    `json:"message_id"`
+	ChannelID int64    `json:"channel_id"`
+	TeamID    int64    `json:"team_id"`
+	UserID    int64    `json:"user_id"`
+	Content   string   `json:"content"`
+	CreatedAt int64    `json:"created_at"`
+	Has       []string `json:"has,omitempty"`
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultElastic *Elastic
+)
+
+// Default returns the backend configured from ELASTICSEARCH_URL, with
+// ELASTICSEARCH_INDEX (default "eaven-messages") and, for basic auth,
+// ELASTICSEARCH_USERNAME and ELASTICSEARCH_PASSWORD. It is nil when no URL is
+// set, and search runs on MySQL.
+func Default() *Elastic {
+	defaultOnce.Do(func() {
+		base := os.Getenv("ELASTICSEARCH_URL")
+		if base == "" {
+			return
+		}
+		index := os.Getenv("ELASTICSEARCH_INDEX")
+		if index == "" {
+			index = defaultIndexName
+		}
+		defaultElastic = &Elastic{
+			URL:      strings.TrimRight(base, "/"),
+			Index:    index,
+			Username: os.Getenv("ELASTICSEARCH_USERNAME"),
+			Password: os.Getenv("ELASTICSEARCH_PASSWORD"),
+			HTTP:     &http.Client{Timeout: requestTimeout},
+			Log:      logger.NewLogger("search-indexer"),
+		}
+	})
+	return defaultElastic
+}
+
+// StartIndexer mirrors message writes into the search backend, when one is
+// configured, by publishing outbox events to it. Messages sent before the
+// backend was set up are copied with eavenctl reindex-search.
+func StartIndexer() {
+	e := Default()
+	if e == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := e.EnsureIndex(ctx); err != nil {
+		// Publishing fails until the index exists, so events are retried
+		// and nothing is lost
+		e.Log.Error("Failed to create the search index", "index", e.Index, "error", err)
+	}
+	outbox.RegisterPublisher("search", e.publish)
+}
+
+func (e *Elastic) publish(ctx context.Context, ev outbox.Event) error {
+	switch ev.Envelope.Type {
+	case events.TypeMessageCreated:
+		var m events.MessageCreated
+		if err := json.Unmarshal(ev.Envelope.Payload, &m); err != nil {
+			return err
+		}
+		if m.ContentType == models.ContentTypeEncrypted {
+			return nil
+		}
+		d := document{
+			MessageID: m.MessageID,
+			ChannelID: m.ChannelID,
+			TeamID:    m.TeamID,
+			UserID:    m.UserID,
+			Content:   m.Content,
+			CreatedAt: m.CreatedAt,
+			Has:       has(m.Content, len(m.AttachmentIDs) > 0),
+		}
+		return e.do(ctx, http.MethodPut, "/"+url.PathEscape(e.Index)+"/_doc/"+strconv.FormatInt(d.MessageID, 10), "application/json", d, nil)
+	case events.TypeMessageDeleted:
+		var m events.MessageDeleted
+		if err := json.Unmarshal(ev.Envelope.Payload, &m); err != nil {
+			return err
+		}
+		err := e.do(ctx, http.MethodDelete, "/"+url.PathEscape(e.Index)+"/_doc/"+strconv.FormatInt(m.MessageID, 10), "", nil, nil)
+		var status *statusError
+		if errors.As(err, &status) && status.Code == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// EnsureIndex creates the index with its mapping unless it exists
+func (e *Elastic) EnsureIndex(ctx context.Context) error {
+	err := e.do(ctx, http.MethodHead, "/"+url.PathEscape(e.Index), "", nil, nil)
+	var status *statusError
+	if errors.As(err, &status) && status.Code == http.StatusNotFound {
+		return e.do(ctx, http.MethodPut, "/"+url.PathEscape(e.Index), "application/json", json.RawMessage(indexMapping), nil)
+	}
+	return err
+}
+
+// Reindex copies the messages with IDs above afterID into the index, oldest
+// first, and returns how many it copied and the last ID it reached, from which
+// an interrupted run can resume
+func (e *Elastic) Reindex(ctx context.Context, db *sql.DB, afterID int64) (int, int64, error) {
+	if err := e.EnsureIndex(ctx); err != nil {
+		return 0, afterID, err
+	}
+	copied := 0
+	for {
+		var body bytes.Buffer
+		n, err := history.Each(ctx, db, false, reindexPage, `
+			SELECT m.message_id, m.channel_id, c.team_id, m.user_id, m.content, m.message_created_at,
+				EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.message_id)
+			FROM {messages} m
+			INNER JOIN channels c ON c.channel_id = m.channel_id
+			WHERE m.message_id > ? AND m.content_type <> ?
+			ORDER BY m.message_id
+			LIMIT ?`, []interface{}{afterID, models.ContentTypeEncrypted}, func(rows *sql.Rows) error {
+			var d document
+			var hasFile bool
+			if err := rows.Scan(&d.MessageID, &d.ChannelID, &d.TeamID, &d.UserID, &d.Content, &d.CreatedAt, &hasFile); err != nil {
+				return err
+			}
+			d.Has = has(d.Content, hasFile)
+			fmt.Fprintf(&body, `{"index":{"_id":"%d"}}`+"\n", d.MessageID)
+			line, _ := json.Marshal(d)
+			body.Write(line)
+			body.WriteByte('\n')
+			afterID = d.MessageID
+			return nil
+		})
+		if err != nil {
+			return copied, afterID, err
+		}
+		if n == 0 {
+			return copied, afterID, nil
+		}
+
+		var resp struct {
+			Errors bool `json:"errors"`
+		}
+		if err := e.do(ctx, http.MethodPost, "/"+url.PathEscape(e.Index)+"/_bulk", "application/x-ndjson", body.Bytes(), &resp); err != nil {
+			return copied, afterID, err
+		}
+		if resp.Errors {
+			return copied, afterID, fmt.Errorf("search index rejected some of the messages up to %d", afterID)
+		}
+		copied += n
+		if n < reindexPage {
+			return copied, afterID, nil
+		}
+	}
+}
+
+// messages runs a search on the index, then loads the matching messages
+// from MySQL
+func (e *Elastic) messages(ctx context.Context, db *sql.DB, req Request) (Result, error) {
+	channels, err := scopeChannels(ctx, db, req)
+	if err != nil || len(channels) == 0 {
+		return Result{Hits: []Hit{}}, err
+	}
+	filter := []interface{}{
+		map[string]interface{}{"terms": map[string]interface{}{"channel_id": channels}},
+	}
+	if len(req.Query.From) > 0 {
+		authors, err := authorIDs(ctx, db, req.TeamID, req.Query.From)
+		if err != nil || len(authors) == 0 {
+			return Result{Hits: []Hit{}}, err
+		}
+		filter = append(filter, map[string]interface{}{"terms": map[string]interface{}{"user_id": authors}})
+	}
+	createdAt := map[string]interface{}{"gte": max(req.Cutoff, req.Query.After)}
+	if req.Query.Before > 0 {
+		createdAt["lt"] = req.Query.Before
+	}
+	filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"created_at": createdAt}})
+	for _, h := range req.Query.Has {
+		filter = append(filter, map[string]interface{}{"term": map[string]interface{}{"has": h}})
+	}
+	if req.BeforeID > 0 {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"message_id": map[string]interface{}{"lt": req.BeforeID}}})
+	}
+	must := make([]interface{}, 0, len(req.Query.Terms))
+	for _, term := range req.Query.Terms {
+		must = append(must, map[string]interface{}{"match_phrase": map[string]interface{}{"content": term}})
+	}
+
+	query := map[string]interface{}{
+		"size":    req.Limit,
+		"_source": false,
+		"sort":    []interface{}{map[string]interface{}{"message_id": "desc"}},
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"must": must, "filter": filter}},
+	}
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := e.do(ctx, http.MethodPost, "/"+url.PathEscape(e.Index)+"/_search", "application/json", query, &resp); err != nil {
+		return Result{}, err
+	}
+
+	ids := make([]interface{}, 0, len(resp.Hits.Hits))
+	for _, h := range resp.Hits.Hits {
+		id, err := strconv.ParseInt(h.ID, 10, 64)
+		if err != nil {
+			return Result{}, fmt.Errorf("search index returned message ID %q", h.ID)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return Result{Hits: []Hit{}}, nil
+	}
+
+	// The index may still hold messages deleted since, or hidden by the
+	// plan's history limit; loading them again drops those
+	hits := []Hit{}
+	_, err = history.Each(ctx, db, true, 0, `
+		SELECT `+hitColumns+`
+		FROM {messages} m
+		INNER JOIN channel_members cm ON cm.channel_id = m.channel_id AND cm.user_id = ?
+		INNER JOIN channels c ON c.channel_id = m.channel_id
+		LEFT JOIN users u ON u.user_id = m.user_id
+		WHERE m.message_id IN (`+placeholders(len(ids))+`) AND m.message_created_at >= ?
+		ORDER BY m.message_id DESC`, append(append([]interface{}{req.UserID}, ids...), req.Cutoff), scanHits(&hits, req.Query.Terms))
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Hits: hits}
+	if len(ids) == req.Limit {
+		result.NextBeforeID = ids[len(ids)-1].(int64)
+	}
+	return result, nil
+}
+
+// scopeChannels returns the channels of the team the user is a member of,
+// narrowed to the in: channels when there are any
+func scopeChannels(ctx context.Context, db *sql.DB, req Request) ([]int64, error) {
+	query := `
+		SELECT c.channel_id
+		FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		WHERE cm.user_id = ? AND ` + teamChannel
+	args := []interface{}{req.UserID, req.TeamID, req.TeamID}
+	if len(req.Query.In) > 0 {
+		query += ` AND c.slug IN (` + placeholders(len(req.Query.In)) + `)`
+		for _, s := range req.Query.In {
+			args = append(args, s)
+		}
+	}
+	return int64s(ctx, db, query, args...)
+}
+
+// authorIDs returns the users of the team's workspace with the handles
+func authorIDs(ctx context.Context, db *sql.DB, teamID int64, handles []string) ([]int64, error) {
+	args := []interface{}{teamID}
+	for _, h := range handles {
+		args = append(args, h)
+	}
+	return int64s(ctx, db, `
+		SELECT u.user_id
+		FROM users u
+		INNER JOIN teams t ON t.workspace_id = u.workspace_id
+		WHERE t.team_id = ? AND u.handle IN (`+placeholders(len(handles))+`)`, args...)
+}
+
+func int64s(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func has(content string, hasFile bool) []string {
+	var h []string
+	if linkPattern.MatchString(content) {
+		h = append(h, HasLink)
+	}
+	if hasFile {
+		h = append(h, HasFile)
+	}
+	return h
+}
+
+// statusError is an unexpected HTTP status from the search backend
+type statusError struct {
+	Code int
+	Body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("search backend answered %d: %s", e.Code, e.Body)
+}
+
+// do sends a request to the backend. body is sent as is when it is a []byte
+// and as JSON otherwise; the response is decoded into out unless it is nil.
+func (e *Elastic) do(ctx context.Context, method, path, contentType string, body, out interface{}) error {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if e.Username != "" {
+		req.SetBasicAuth(e.Username, e.Password)
+	}
+
+	resp, err := e.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,174 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// minWordLength is InnoDB's default innodb_ft_min_token_size. Terms with a
+// shorter word are not in the FULLTEXT index and are matched with LIKE.
+const minWordLength = 3
+
+// Request is a search of the messages a user can read in a team
+type Request struct {
+	UserID int64
+	TeamID int64
+	Query  Query
+	// Cutoff hides messages older than the team's plan keeps, as Unix
+	// seconds; 0 shows the whole history
+	Cutoff int64
+	// BeforeID pages through results: only messages older than it are
+	// returned. 0 starts from the newest.
+	BeforeID int64
+	Limit    int
+}
+
+// Hit is a message that matched a search
+type Hit struct {
+	MessageID   int64       `json:"message_id"`
+	ChannelID   int64       `json:"channel_id"`
+	ChannelSlug string      `json:"channel_slug"`
+	UserID      int64       `json:"user_id"`
+	Handle      string      `json:"handle"`
+	Content     string      `json:"content"`
+	MessageTime int64       `json:"message_created_at"`
+	Highlights  []Highlight `json:"highlights"`
+}
+
+// Result is a page of search hits. NextBeforeID is the BeforeID of the next
+// page, or 0 on the last one.
+type Result struct {
+	Hits         []Hit `json:"messages"`
+	NextBeforeID int64 `json:"next_before_id,omitempty"`
+}
+
+// teamChannel matches when channel c belongs to team ? or is shared with it;
+// it takes the team ID twice
+const teamChannel = `(c.team_id = ? OR EXISTS (
+	SELECT 1 FROM channel_shares s WHERE s.channel_id = c.channel_id AND s.team_id = ? AND s.status = 'active'))`
+
+// hitColumns are read by scanHits; the query must join channels as c and
+// users as u
+const hitColumns = `m.message_id, m.channel_id, c.slug, m.user_id, COALESCE(u.handle, ''), m.content, m.message_created_at`
+
+// Messages runs a search, newest messages first. Only channels the user is a
+// member of are searched, and encrypted messages, whose content the server
+// cannot read, never match. The search backend is used when one is
+// configured, MySQL otherwise.
+func Messages(ctx context.Context, db *sql.DB, req Request) (Result, error) {
+	if backend := Default(); backend != nil {
+		return backend.messages(ctx, db, req)
+	}
+
+	where := []string{teamChannel, "m.content_type <> ?", "m.message_created_at >= ?"}
+	args := []interface{}{req.UserID, req.TeamID, req.TeamID, models.ContentTypeEncrypted, req.Cutoff}
+
+	var words []string
+	for _, term := range req.Query.Terms {
+		if indexed(term) {
+			words = append(words, `+"`+term+`"`)
+			continue
+		}
+		where = append(where, `m.content LIKE ?`)
+		args = append(args, "%"+escapeLike(term)+"%")
+	}
+	if len(words) > 0 {
+		where = append(where, "MATCH(m.content) AGAINST(? IN BOOLEAN MODE)")
+		args = append(args, strings.Join(words, " "))
+	}
+	if len(req.Query.From) > 0 {
+		where = append(where, "u.handle IN ("+placeholders(len(req.Query.From))+")")
+		for _, h := range req.Query.From {
+			args = append(args, h)
+		}
+	}
+	if len(req.Query.In) > 0 {
+		where = append(where, "c.slug IN ("+placeholders(len(req.Query.In))+")")
+		for _, s := range req.Query.In {
+			args = append(args, s)
+		}
+	}
+	if req.Query.Before > 0 {
+		where = append(where, "m.message_created_at < ?")
+		args = append(args, req.Query.Before)
+	}
+	if req.Query.After > 0 {
+		where = append(where, "m.message_created_at >= ?")
+		args = append(args, req.Query.After)
+	}
+	for _, has := range req.Query.Has {
+		switch has {
+		case HasLink:
+			where = append(where, "EXISTS (SELECT 1 FROM message_link_previews mlp WHERE mlp.message_id = m.message_id)")
+		case HasFile:
+			where = append(where, "EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.message_id)")
+		}
+	}
+	if req.BeforeID > 0 {
+		where = append(where, "m.message_id < ?")
+		args = append(args, req.BeforeID)
+	}
+
+	hits := []Hit{}
+	_, err := history.Each(ctx, db, true, req.Limit, `
+		SELECT `+hitColumns+`
+		FROM {messages} m
+		INNER JOIN channel_members cm ON cm.channel_id = m.channel_id AND cm.user_id = ?
+		INNER JOIN channels c ON c.channel_id = m.channel_id
+		LEFT JOIN users u ON u.user_id = m.user_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY m.message_id DESC
+		LIMIT ?`, args, scanHits(&hits, req.Query.Terms))
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{Hits: hits}
+	if len(hits) == req.Limit {
+		result.NextBeforeID = hits[len(hits)-1].MessageID
+	}
+	return result, nil
+}
+
+// scanHits returns a scan func for history.Each that appends each row to
+// hits
+func scanHits(hits *[]Hit, terms []string) func(*sql.Rows) error {
+	return func(rows *sql.Rows) error {
+		var h Hit
+		if err := rows.Scan(&h.MessageID, &h.ChannelID, &h.ChannelSlug, &h.UserID, &h.Handle, &h.Content, &h.MessageTime); err != nil {
+			return err
+		}
+		h.Highlights = Highlights(h.Content, terms)
+		*hits = append(*hits, h)
+		return nil
+	}
+}
+
+// indexed reports whether every word of a term can be found through the
+// FULLTEXT index
+func indexed(term string) bool {
+	for _, word := range strings.Fields(term) {
+		if utf8.RuneCountInString(word) < minWordLength {
+			return false
+		}
+		for _, r := range word {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
@@ -0,0 +1,204 @@
+// Package search finds messages with Slack-style queries: free text narrowed
+// by operators such as from:@ada, in:#general, before:2024-06-01, after:,
+// has:link and has:file.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nikhil/eaven/internal/handles"
+	"github.com/nikhil/eaven/internal/utils"
+)
+
+// dateLayout is the format of before: and after: dates, read as UTC days
+const dateLayout = "2006-01-02"
+
+// What has: can ask for
+const (
+	HasLink = "link"
+	HasFile = "file"
+)
+
+// ErrEmptyQuery is returned for a query with neither text nor operators
+var ErrEmptyQuery = errors.New("search query is empty")
+
+// ParseError reports an operator with a value that cannot be used
+type ParseError struct {
+	Operator string
+	Value    string
+	Reason   string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%s %s", e.Operator, e.Value, e.Reason)
+}
+
+// Query is a parsed search query. Terms must all appear in a message; each
+// operator that is given narrows the results further.
+type Query struct {
+	// Terms are words and "quoted phrases", lowercased
+	Terms []string `json:"terms"`
+	// From holds the handles of the authors to include
+	From []string `json:"from,omitempty"`
+	// In holds the slugs of the channels to include
+	In []string `json:"in,omitempty"`
+	// Before and After bound the message time, as Unix seconds; 0 if unset.
+	// Before is exclusive of its day and After of its own, as in Slack:
+	// after:2024-06-01 starts on June 2nd.
+	Before int64    `json:"before,omitempty"`
+	After  int64    `json:"after,omitempty"`
+	Has    []string `json:"has,omitempty"`
+}
+
+// Parse reads a search query. Operators it does not know, such as the
+// scheme of a pasted URL, are searched for as text.
+func Parse(s string) (Query, error) {
+	var q Query
+	for _, token := range tokenize(s) {
+		if token.quoted {
+			q.Terms = appendTerm(q.Terms, token.text)
+			continue
+		}
+		op, value, found := strings.Cut(token.text, ":")
+		if !found || value == "" {
+			q.Terms = appendTerm(q.Terms, token.text)
+			continue
+		}
+		switch op = strings.ToLower(op); op {
+		case "from":
+			handle := handles.Normalize(value)
+			if !handles.Valid(handle) {
+				return Query{}, &ParseError{Operator: op, Value: value, Reason: "is not a valid @handle"}
+			}
+			q.From = append(q.From, handle)
+		case "in":
+			slug := utils.Slugify(strings.TrimPrefix(value, "#"))
+			if slug == "" {
+				return Query{}, &ParseError{Operator: op, Value: value, Reason: "is not a valid #channel"}
+			}
+			q.In = append(q.In, slug)
+		case "before", "after":
+			day, err := time.Parse(dateLayout, value)
+			if err != nil {
+				return Query{}, &ParseError{Operator: op, Value: value, Reason: "must be a date such as 2024-06-01"}
+			}
+			if op == "before" {
+				q.Before = day.Unix()
+			} else {
+				q.After = day.AddDate(0, 0, 1).Unix()
+			}
+		case "has":
+			switch has := strings.ToLower(value); has {
+			case HasLink, HasFile:
+				q.Has = append(q.Has, has)
+			default:
+				return Query{}, &ParseError{Operator: op, Value: value, Reason: "must be link or file"}
+			}
+		default:
+			q.Terms = appendTerm(q.Terms, token.text)
+		}
+	}
+	if len(q.Terms) == 0 && len(q.From) == 0 && len(q.In) == 0 && q.Before == 0 && q.After == 0 && len(q.Has) == 0 {
+		return Query{}, ErrEmptyQuery
+	}
+	return q, nil
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits a query on spaces, keeping "quoted phrases" whole. An
+// unclosed quote runs to the end of the query.
+func tokenize(s string) []token {
+	var tokens []token
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeftFunc(s, unicode.IsSpace) {
+		if s[0] == '"' {
+			phrase, rest, _ := strings.Cut(s[1:], `"`)
+			tokens = append(tokens, token{text: phrase, quoted: true})
+			s = rest
+			continue
+		}
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		tokens = append(tokens, token{text: s[:end]})
+		s = s[end:]
+	}
+	return tokens
+}
+
+func appendTerm(terms []string, term string) []string {
+	term = strings.Join(strings.Fields(strings.ToLower(term)), " ")
+	if term == "" {
+		return terms
+	}
+	for _, t := range terms {
+		if t == term {
+			return terms
+		}
+	}
+	return append(terms, term)
+}
+
+// Highlight marks where a term was found in a message's content, as
+// character offsets: Start is the first matching character and End the one
+// after the last. Offsets count Unicode code points, not bytes.
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Highlights returns where the terms appear in content, ignoring case, in
+// order and with overlapping matches merged
+func Highlights(content string, terms []string) []Highlight {
+	// ToLower maps rune by rune, so offsets into text are offsets into
+	// content
+	text := []rune(strings.ToLower(content))
+
+	var found []Highlight
+	for _, term := range terms {
+		needle := []rune(term)
+		for i := 0; i+len(needle) <= len(text); i++ {
+			if runesEqual(text[i:i+len(needle)], needle) {
+				found = append(found, Highlight{Start: i, End: i + len(needle)})
+			}
+		}
+	}
+	if len(found) == 0 {
+		return []Highlight{}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Start != found[j].Start {
+			return found[i].Start < found[j].Start
+		}
+		return found[i].End > found[j].End
+	})
+	merged := found[:1]
+	for _, h := range found[1:] {
+		last := &merged[len(merged)-1]
+		if h.Start <= last.End {
+			last.End = max(last.End, h.End)
+			continue
+		}
+		merged = append(merged, h)
+	}
+	return merged
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package adminService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/deadletter"
+	"github.com/nikhil/eaven/internal/logger"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+	"github.com/nikhil/eaven/internal/sse"
+)
+
+// AdminService exposes instance administration endpoints
+type AdminService struct {
+	DB *sql.DB
+	// Reader returns the pool for the stats queries. It defaults to DB.
+	Reader func() *sql.DB
+	Log    *logger.Logger
+}
+
+// NewAdminService initializes a new admin service
+func NewAdminService(db *sql.DB, log *logger.Logger) *AdminService {
+	return &AdminService{
+		DB:     db,
+		Reader: func() *sql.DB { return db },
+		Log:    log,
+	}
+}
+
+// ListDeadLetters returns failed deliveries, filterable by ?kind= and
+// ?include_replayed=true
+func (as *AdminService) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get pagination parameters
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 20 // Default to 20 items per page
+	}
+	offset := (page - 1) * perPage
+
+	kind := r.URL.Query().Get("kind")
+	includeReplayed := r.URL.Query().Get("include_replayed") == "true"
+
+	entries, err := deadletter.List(ctx, kind, includeReplayed, perPage, offset)
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to list dead letters", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get dead letters")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"dead_letters": entries,
+		"page":         page,
+		"per_page":     perPage,
+	})
+}
+
+// GetDeadLetter returns a single failed delivery with its payload
+func (as *AdminService) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid dead letter ID")
+		return
+	}
+
+	entry, err := deadletter.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, deadletter.ErrNotFound) {
+			respondWithError(w, http.StatusNotFound, "Dead letter not found")
+			return
+		}
+		as.Log.WithContext(r.Context()).Error("Failed to get dead letter", "error", err, "dead_letter_id", id)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get dead letter")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, entry)
+}
+
+// ReplayDeadLetter re-attempts delivery of a failed event
+func (as *AdminService) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid dead letter ID")
+		return
+	}
+
+	entry, err := deadletter.Replay(r.Context(), id)
+	switch {
+	case err == nil:
+		as.Log.WithContext(r.Context()).Audit("Dead letter replayed", "dead_letter_id", id, "kind", entry.Kind)
+		respondWithJSON(w, http.StatusOK, entry)
+	case errors.Is(err, deadletter.ErrNotFound):
+		respondWithError(w, http.StatusNotFound, "Dead letter not found")
+	case errors.Is(err, deadletter.ErrNoReplayer):
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, deadletter.ErrReplayFailed):
+		as.Log.WithContext(r.Context()).Warn("Dead letter replay failed", "dead_letter_id", id, "error", err)
+		respondWithJSON(w, http.StatusBadGateway, map[string]interface{}{"error": err.Error(), "dead_letter": entry})
+	default:
+		as.Log.WithContext(r.Context()).Error("Failed to replay dead letter", "error", err, "dead_letter_id", id)
+		respondWithError(w, http.StatusInternalServerError, "Failed to replay dead letter")
+	}
+}
+
+// GetDatabaseStats reports the database connection pool state and the number
+// of slow queries logged since startup
+func (as *AdminService) GetDatabaseStats(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, database.PoolStats())
+}
+
+// GetStreamStats reports the event streams connected to the API process
+// serving the request. Each process keeps its own streams.
+func (as *AdminService) GetStreamStats(w http.ResponseWriter, r *http.Request) {
+	stats := sse.Stats{}
+	if b := sse.Default(); b != nil {
+		stats = b.Stats()
+	}
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+// GetMessagePipelineStats reports how the shadowed fan-out pipeline compares
+// with the current message path
+func (as *AdminService) GetMessagePipelineStats(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, messageService.GetShadowStats())
+}
+
+// Helper functions for HTTP responses
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	respondWithJSON(w, code, map[string]string{"error": message})
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling JSON: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
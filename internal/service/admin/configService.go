@@ -0,0 +1,29 @@
+package adminService
+
+import (
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/reload"
+)
+
+// ReloadConfig rereads the reloadable settings of this API process: the log
+// level, the rate limits, flood control, the CORS origins and the
+// feature flags. Other processes reload on SIGHUP or their own call.
+func (as *AdminService) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	results, err := reload.All()
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to reload configuration", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to reload configuration")
+		return
+	}
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Error != "" {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+	as.Log.WithContext(ctx).Audit("Configuration reloaded", "settings", len(results), "ok", status == http.StatusOK)
+	respondWithJSON(w, status, map[string]interface{}{"settings": results})
+}
@@ -0,0 +1,71 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/featureflags"
+)
+
+// flagSetting is the body of a flag change; a null enabled removes the
+// setting
+type flagSetting struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// ListFeatureFlags returns every feature flag with its default and the
+// settings made deployment-wide and per team
+func (as *AdminService) ListFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := featureflags.List(r.Context())
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to list feature flags", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list feature flags")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"flags": flags})
+}
+
+// SetFeatureFlag turns a flag on or off for every team without a setting of
+// its own. Other processes apply the change within 30 seconds.
+func (as *AdminService) SetFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	as.setFlag(w, r, 0)
+}
+
+// SetTeamFeatureFlag turns a flag on or off for one team, overriding the
+// deployment-wide setting
+func (as *AdminService) SetTeamFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	teamID, err := strconv.ParseInt(mux.Vars(r)["team_id"], 10, 64)
+	if err != nil || teamID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	as.setFlag(w, r, teamID)
+}
+
+func (as *AdminService) setFlag(w http.ResponseWriter, r *http.Request, teamID int64) {
+	ctx := r.Context()
+	flag := mux.Vars(r)["flag"]
+	var body flagSetting
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	err := featureflags.Set(ctx, as.DB, flag, teamID, body.Enabled)
+	if errors.Is(err, featureflags.ErrUnknownFlag) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to set feature flag", "error", err, "flag", flag, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to set feature flag")
+		return
+	}
+
+	as.Log.WithContext(ctx).Audit("Feature flag changed", "flag", flag, "team_id", teamID, "enabled", body.Enabled)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"flag": flag, "team_id": teamID, "enabled": body.Enabled})
+}
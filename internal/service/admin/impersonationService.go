@@ -0,0 +1,163 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/accounts"
+	"github.com/nikhil/eaven/internal/mailer"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// StartImpersonationRequest represents the request body for impersonating a
+// user. The reason is kept in the audit trail and shown to the user.
+type StartImpersonationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// impersonationStartedEmail is the data passed to the impersonation_started
+// mail template
+type impersonationStartedEmail struct {
+	FirstName string
+	Reason    string
+	Minutes   int
+}
+
+// impersonationTTL is how long impersonation tokens last, read from
+// IMPERSONATION_TTL_MINUTES (default 15)
+func impersonationTTL() time.Duration {
+	minutes := 15
+	if v, err := strconv.Atoi(os.Getenv("IMPERSONATION_TTL_MINUTES")); err == nil && v > 0 {
+		minutes = v
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// StartImpersonation issues a short-lived token acting as a user on the
+// read-only routes open to impersonation, and emails the user about it
+func (as *AdminService) StartImpersonation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var req StartImpersonationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > 500 {
+		respondWithError(w, http.StatusBadRequest, "A reason of at most 500 characters is required")
+		return
+	}
+
+	userDetails, _ := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	adminID, _ := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+
+	ttl := impersonationTTL()
+	session, err := accounts.StartImpersonation(ctx, adminID, userID, req.Reason, ttl)
+	switch {
+	case err == nil:
+	case errors.Is(err, accounts.ErrUserNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, accounts.ErrSelfImpersonation), errors.Is(err, accounts.ErrProtectedAccount):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		as.Log.WithContext(ctx).Error("Failed to start impersonation", "error", err, "target_user_id", userID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to start impersonation")
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email":                       session.UserEmail,
+		"user_id":                     session.UserID,
+		"impersonator_id":             adminID,
+		middleware.ImpersonationClaim: session.SessionID,
+		"exp":                         session.ExpiresAt,
+	})
+	signed, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to sign impersonation token", "error", err, "impersonation_id", session.SessionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to start impersonation")
+		return
+	}
+
+	as.Log.WithContext(ctx).Audit("Impersonation started", "impersonation_id", session.SessionID, "target_user_id", session.UserID, "reason", session.Reason, "expires_at", session.ExpiresAt)
+
+	// The session is open, so a failed email is only logged
+	err = mailer.SendTemplate(session.UserEmail, "impersonation_started", impersonationStartedEmail{
+		FirstName: session.UserFirstName,
+		Reason:    session.Reason,
+		Minutes:   int(ttl / time.Minute),
+	})
+	if err != nil {
+		as.Log.WithContext(ctx).Warn("Failed to send impersonation notice", "error", err, "impersonation_id", session.SessionID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"token":   signed,
+		"session": session,
+	})
+}
+
+// EndImpersonation revokes an impersonation token before it expires
+func (as *AdminService) EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := strconv.ParseInt(mux.Vars(r)["session_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	err = accounts.EndImpersonation(r.Context(), sessionID)
+	if errors.Is(err, accounts.ErrSessionNotFound) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to end impersonation", "error", err, "impersonation_id", sessionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to end impersonation")
+		return
+	}
+
+	as.Log.WithContext(r.Context()).Audit("Impersonation ended", "impersonation_id", sessionID)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Impersonation ended"})
+}
+
+// ListImpersonations returns the audit trail of impersonation sessions
+func (as *AdminService) ListImpersonations(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 20 // Default to 20 items per page
+	}
+
+	sessions, err := accounts.ListImpersonations(r.Context(), perPage, (page-1)*perPage)
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to list impersonations", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get impersonations")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": sessions,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
@@ -0,0 +1,76 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/limits"
+)
+
+// GetTeamLimitOverrides returns the limits set on a team itself
+func (as *AdminService) GetTeamLimitOverrides(w http.ResponseWriter, r *http.Request) {
+	as.getLimits(w, r, limits.ScopeTeam, "team_id")
+}
+
+// SetTeamLimitOverrides replaces the limits set on a team. Null fields
+// inherit the workspace's limits.
+func (as *AdminService) SetTeamLimitOverrides(w http.ResponseWriter, r *http.Request) {
+	as.setLimits(w, r, limits.ScopeTeam, "team_id")
+}
+
+// GetWorkspaceLimitOverrides returns the limits set on a workspace itself
+func (as *AdminService) GetWorkspaceLimitOverrides(w http.ResponseWriter, r *http.Request) {
+	as.getLimits(w, r, limits.ScopeWorkspace, "workspace_id")
+}
+
+// SetWorkspaceLimitOverrides replaces the limits set on a workspace, which
+// apply to its teams. Null fields inherit the deployment defaults.
+func (as *AdminService) SetWorkspaceLimitOverrides(w http.ResponseWriter, r *http.Request) {
+	as.setLimits(w, r, limits.ScopeWorkspace, "workspace_id")
+}
+
+func (as *AdminService) getLimits(w http.ResponseWriter, r *http.Request, scope, idVar string) {
+	id, err := strconv.ParseInt(mux.Vars(r)[idVar], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	o, err := limits.Get(r.Context(), scope, id)
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to get limits", "error", err, "scope", scope, "id", id)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get limits")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"scope": scope, "id": id, "limits": o, "defaults": limits.Defaults()})
+}
+
+func (as *AdminService) setLimits(w http.ResponseWriter, r *http.Request, scope, idVar string) {
+	id, err := strconv.ParseInt(mux.Vars(r)[idVar], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var o limits.Override
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	err = limits.Set(r.Context(), as.DB, scope, id, o)
+	if errors.Is(err, limits.ErrInvalidLimits) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to set limits", "error", err, "scope", scope, "id", id)
+		respondWithError(w, http.StatusInternalServerError, "Failed to set limits")
+		return
+	}
+
+	as.Log.WithContext(r.Context()).Audit("Plan limits changed", "scope", scope, "id", id, "limits", o)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"scope": scope, "id": id, "limits": o})
+}
@@ -0,0 +1,63 @@
+package adminService
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+// Bounds of a temporary log level, in seconds
+const (
+	defaultLogLevelSeconds = 15 * 60
+	maxLogLevelSeconds     = 4 * 60 * 60
+)
+
+// SetLogLevelRequest switches the log level for DurationSeconds, 15
+// minutes when unset
+type SetLogLevelRequest struct {
+	Level           string `json:"level"`
+	DurationSeconds int    `json:"duration_seconds"`
+}
+
+// GetLogLevel returns the log level of this API process and, during a
+// temporary override, when it reverts
+func (as *AdminService) GetLogLevel(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, logger.Level())
+}
+
+// SetLogLevel switches the log level of this API process, typically to
+// debug, for a bounded time; it then reverts to the configured level by
+// itself, so a forgotten override cannot flood the logs
+func (as *AdminService) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req SetLogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.DurationSeconds == 0 {
+		req.DurationSeconds = defaultLogLevelSeconds
+	}
+	if req.DurationSeconds < 1 || req.DurationSeconds > maxLogLevelSeconds {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("duration_seconds must be between 1 and %d", maxLogLevelSeconds))
+		return
+	}
+
+	state, err := logger.SetLevelFor(req.Level, time.Duration(req.DurationSeconds)*time.Second)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	as.Log.WithContext(ctx).Audit("Log level overridden", "level", state.Level, "duration_seconds", req.DurationSeconds)
+	respondWithJSON(w, http.StatusOK, state)
+}
+
+// RevertLogLevel ends a temporary log level early
+func (as *AdminService) RevertLogLevel(w http.ResponseWriter, r *http.Request) {
+	state := logger.RevertLevel()
+	as.Log.WithContext(r.Context()).Audit("Log level reverted", "level", state.Level)
+	respondWithJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,125 @@
+package adminService
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/nikhil/eaven/internal/maintenance"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/sse"
+)
+
+// maxRetryAfter bounds the retry delay given to clients, in seconds
+const maxRetryAfter = 3600
+
+// SetMaintenanceRequest turns maintenance mode on or off. Message and
+// RetryAfterSeconds are shown to clients whose writes are rejected.
+type SetMaintenanceRequest struct {
+	Enabled           bool   `json:"enabled"`
+	Message           string `json:"message"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// DrainRequest sets the window within which drained clients reconnect
+type DrainRequest struct {
+	ReconnectWithinSeconds int `json:"reconnect_within_seconds"`
+}
+
+// GetMaintenance returns the maintenance mode and the state of this
+// process's event streams
+func (as *AdminService) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	state, err := maintenance.Current(ctx)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to read maintenance mode", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get maintenance mode")
+		return
+	}
+	stats := sse.Stats{}
+	if b := sse.Default(); b != nil {
+		stats = b.Stats()
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"maintenance": state, "streams": stats})
+}
+
+// SetMaintenance turns maintenance mode on or off for every API process.
+// Other processes apply the change within 5 seconds. Turning it off also
+// lets this process accept event streams again if it was drained.
+func (as *AdminService) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req SetMaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	req.Message = strings.TrimSpace(req.Message)
+	if len(req.Message) > 500 {
+		respondWithError(w, http.StatusBadRequest, "message must be at most 500 characters")
+		return
+	}
+	if req.RetryAfterSeconds < 0 || req.RetryAfterSeconds > maxRetryAfter {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("retry_after_seconds must be between 0 and %d", maxRetryAfter))
+		return
+	}
+
+	userDetails, _ := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	adminID, _ := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+
+	var err error
+	if req.Enabled {
+		err = maintenance.Enable(ctx, as.DB, req.Message, req.RetryAfterSeconds, adminID)
+	} else {
+		err = maintenance.Disable(ctx, as.DB)
+		if b := sse.Default(); b != nil {
+			b.Resume()
+		}
+	}
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to set maintenance mode", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to set maintenance mode")
+		return
+	}
+	state, err := maintenance.Current(ctx)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to read maintenance mode", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get maintenance mode")
+		return
+	}
+
+	as.Log.WithContext(ctx).Audit("Maintenance mode changed", "enabled", req.Enabled, "admin_id", adminID, "retry_after_seconds", state.RetryAfterSeconds)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"maintenance": state})
+}
+
+// DrainStreams closes the event streams connected to this API process, each
+// told to reconnect at a random time within the window, and refuses new
+// ones, so the process can be stopped without dropping clients. Run it
+// against each process before it is replaced.
+func (as *AdminService) DrainStreams(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := DrainRequest{ReconnectWithinSeconds: 10}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if req.ReconnectWithinSeconds < 1 || req.ReconnectWithinSeconds > maxRetryAfter {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("reconnect_within_seconds must be between 1 and %d", maxRetryAfter))
+		return
+	}
+
+	b := sse.Default()
+	if b == nil {
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"drained": 0})
+		return
+	}
+	drained := b.Drain(time.Duration(req.ReconnectWithinSeconds) * time.Second)
+	as.Log.WithContext(ctx).Audit("Event streams drained", "drained", drained)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"drained": drained, "streams": b.Stats()})
+}
@@ -0,0 +1,108 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/nikhil/eaven/internal/accounts"
+	"github.com/nikhil/eaven/internal/mailer"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// MergeUsersRequest represents the request body for merging two accounts.
+// Everything owned by the source account moves to the target account.
+type MergeUsersRequest struct {
+	SourceUserID int64 `json:"source_user_id"`
+	TargetUserID int64 `json:"target_user_id"`
+}
+
+// accountMergedEmail is the data passed to the account_merged mail template
+type accountMergedEmail struct {
+	FirstName   string
+	SourceEmail string
+	TargetEmail string
+}
+
+// MergeUsers merges a duplicate account into another and emails both
+// addresses about it
+func (as *AdminService) MergeUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req MergeUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.SourceUserID <= 0 || req.TargetUserID <= 0 {
+		respondWithError(w, http.StatusBadRequest, "source_user_id and target_user_id are required")
+		return
+	}
+
+	userDetails, _ := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	adminID, _ := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+
+	result, err := accounts.Merge(ctx, req.SourceUserID, req.TargetUserID, adminID)
+	switch {
+	case err == nil:
+	case errors.Is(err, accounts.ErrUserNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, accounts.ErrSameUser), errors.Is(err, accounts.ErrBotAccount):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, accounts.ErrAlreadyMerged):
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		as.Log.WithContext(ctx).Error("Failed to merge accounts", "error", err, "source_user_id", req.SourceUserID, "target_user_id", req.TargetUserID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to merge accounts")
+		return
+	}
+
+	as.Log.WithContext(ctx).Audit("Accounts merged", "merge_id", result.MergeID, "source_user_id", result.SourceUserID, "target_user_id", result.TargetUserID, "moved", result.Moved)
+
+	// Tell both addresses, so the owner of the old one learns why it stopped
+	// working. The merge is committed, so a failed email is only logged.
+	data := accountMergedEmail{
+		FirstName:   result.TargetFirstName,
+		SourceEmail: result.SourceEmail,
+		TargetEmail: result.TargetEmail,
+	}
+	for _, to := range []string{result.TargetEmail, result.SourceEmail} {
+		if err := mailer.SendTemplate(to, "account_merged", data); err != nil {
+			as.Log.WithContext(ctx).Warn("Failed to send account merge notice", "error", err, "merge_id", result.MergeID)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// ListAccountMerges returns the audit trail of account merges
+func (as *AdminService) ListAccountMerges(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 20 // Default to 20 items per page
+	}
+
+	merges, err := accounts.ListMerges(r.Context(), perPage, (page-1)*perPage)
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to list account merges", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get account merges")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"merges":   merges,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
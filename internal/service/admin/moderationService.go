@@ -0,0 +1,106 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/moderation"
+)
+
+// ResolveModerationRequest represents the request body for deciding on a
+// queued message
+type ResolveModerationRequest struct {
+	Action string `json:"action"`
+}
+
+// ListModerationQueue returns messages held for review, oldest first,
+// filterable by ?status= (default pending) and ?team_id=
+func (as *AdminService) ListModerationQueue(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	offset := (page - 1) * perPage
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = moderation.StatusPending
+	case moderation.StatusPending, moderation.StatusDismissed, moderation.StatusRemoved:
+	default:
+		respondWithError(w, http.StatusBadRequest, "status must be pending, dismissed or removed")
+		return
+	}
+	var teamID int64
+	if v := r.URL.Query().Get("team_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid team ID")
+			return
+		}
+		teamID = id
+	}
+
+	items, err := moderation.List(ctx, as.DB, status, teamID, perPage, offset)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to list moderation queue", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get moderation queue")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"items":    items,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+// ResolveModerationItem dismisses a queued message or removes it from its
+// channel
+func (as *AdminService) ResolveModerationItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	itemID, err := strconv.ParseInt(mux.Vars(r)["item_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid item ID")
+		return
+	}
+	var req ResolveModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userDetails, _ := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	adminID, _ := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+
+	item, err := moderation.Resolve(ctx, as.DB, itemID, adminID, req.Action)
+	switch {
+	case err == nil:
+		as.Log.WithContext(ctx).Audit("Moderation item resolved", "item_id", item.ItemID, "message_id", item.MessageID,
+			"team_id", item.TeamID, "action", req.Action)
+		respondWithJSON(w, http.StatusOK, item)
+	case errors.Is(err, moderation.ErrInvalidDecision):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, moderation.ErrItemNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, moderation.ErrAlreadyResolved):
+		respondWithError(w, http.StatusConflict, err.Error())
+	default:
+		as.Log.WithContext(ctx).Error("Failed to resolve moderation item", "error", err, "item_id", itemID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve moderation item")
+	}
+}
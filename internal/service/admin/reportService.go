@@ -0,0 +1,127 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/moderation"
+)
+
+// ResolveReportRequest represents the request body for acting on an abuse
+// report
+type ResolveReportRequest struct {
+	Action string `json:"action"`
+}
+
+// ListReports returns abuse reports, oldest first, filterable by ?status=
+// (default open) and ?team_id=
+func (as *AdminService) ListReports(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+	offset := (page - 1) * perPage
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = moderation.ReportOpen
+	case moderation.ReportOpen, moderation.ReportDismissed, moderation.ReportActioned:
+	default:
+		respondWithError(w, http.StatusBadRequest, "status must be open, dismissed or actioned")
+		return
+	}
+	var teamID int64
+	if v := r.URL.Query().Get("team_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid team ID")
+			return
+		}
+		teamID = id
+	}
+
+	reports, err := moderation.ListReports(ctx, as.DB, status, teamID, perPage, offset)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to list reports", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get reports")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"reports":  reports,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+// GetReport returns a single abuse report
+func (as *AdminService) GetReport(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.ParseInt(mux.Vars(r)["report_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+
+	report, err := moderation.GetReport(r.Context(), as.DB, reportID)
+	if err != nil {
+		if errors.Is(err, moderation.ErrReportNotFound) {
+			respondWithError(w, http.StatusNotFound, "Report not found")
+			return
+		}
+		as.Log.WithContext(r.Context()).Error("Failed to get report", "error", err, "report_id", reportID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get report")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// ResolveReport dismisses an abuse report or acts on it by deleting the
+// reported message or removing the reported user from the team
+func (as *AdminService) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	reportID, err := strconv.ParseInt(mux.Vars(r)["report_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+	var req ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userDetails, _ := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	adminID, _ := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+
+	report, err := moderation.ResolveReport(ctx, as.DB, reportID, adminID, req.Action)
+	switch {
+	case err == nil:
+		as.Log.WithContext(ctx).Audit("Report resolved", "report_id", report.ReportID, "kind", report.Kind, "team_id", report.TeamID,
+			"message_id", report.MessageID, "reported_user_id", report.ReportedUserID, "action", req.Action)
+		respondWithJSON(w, http.StatusOK, report)
+	case errors.Is(err, moderation.ErrInvalidReportDecision):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, moderation.ErrReportNotFound):
+		respondWithError(w, http.StatusNotFound, "Report not found")
+	case errors.Is(err, moderation.ErrAlreadyResolved):
+		respondWithError(w, http.StatusConflict, "Report is already resolved")
+	default:
+		as.Log.WithContext(ctx).Error("Failed to resolve report", "error", err, "report_id", reportID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve report")
+	}
+}
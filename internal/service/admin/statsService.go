@@ -0,0 +1,137 @@
+package adminService
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/outbox"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+	"github.com/nikhil/eaven/internal/sse"
+)
+
+// started is when this process started, for its uptime
+var started = time.Now()
+
+// maxStatsTeams bounds the teams listed with connected clients
+const maxStatsTeams = 50
+
+// InstanceStats is a snapshot of one API process for operational debugging
+type InstanceStats struct {
+	GeneratedAt   int64 `json:"generated_at"`
+	UptimeSeconds int64 `json:"uptime_seconds"`
+	Goroutines    int   `json:"goroutines"`
+	// Messages counts the messages saved through this process
+	Messages messageService.MessageRate `json:"messages"`
+	Streams  sse.Stats                  `json:"streams"`
+	// StreamUsers is the number of distinct users with a stream open
+	StreamUsers int `json:"stream_users"`
+	// Teams lists the teams with the most connected clients, most first
+	Teams []TeamClients `json:"teams"`
+	// OutboxPending counts the events not yet published to streams and
+	// webhooks, across every process
+	OutboxPending int64          `json:"outbox_pending"`
+	Database      database.Stats `json:"database"`
+}
+
+// TeamClients counts the connected members of a team
+type TeamClients struct {
+	TeamID  int64 `json:"team_id"`
+	Users   int   `json:"users"`
+	Streams int   `json:"streams"`
+}
+
+// GetInstanceStats reports the counters of the API process serving the
+// request: messages saved per second, connected clients per team, how far
+// streams are behind, pending outbox events and the database pools
+func (as *AdminService) GetInstanceStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	now := time.Now()
+	stats := InstanceStats{
+		GeneratedAt:   now.Unix(),
+		UptimeSeconds: int64(now.Sub(started).Seconds()),
+		Goroutines:    runtime.NumGoroutine(),
+		Messages:      messageService.GetMessageRate(),
+		Teams:         []TeamClients{},
+		Database:      database.PoolStats(),
+	}
+
+	if b := sse.Default(); b != nil {
+		stats.Streams = b.Stats()
+		perUser := b.StreamsPerUser()
+		stats.StreamUsers = len(perUser)
+		teams, err := as.teamClients(ctx, perUser)
+		if err != nil {
+			as.Log.WithContext(ctx).Error("Failed to count connected clients per team", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to get stats")
+			return
+		}
+		stats.Teams = teams
+	}
+
+	pending, err := outbox.Pending(ctx, as.DB)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to count pending outbox events", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get stats")
+		return
+	}
+	stats.OutboxPending = pending
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+// teamClients groups the streams of connected users by the teams they are
+// members of, busiest teams first
+func (as *AdminService) teamClients(ctx context.Context, perUser map[int64]int) ([]TeamClients, error) {
+	teams := []TeamClients{}
+	if len(perUser) == 0 {
+		return teams, nil
+	}
+	args := make([]interface{}, 0, len(perUser))
+	for id := range perUser {
+		args = append(args, id)
+	}
+	rows, err := as.Reader().QueryContext(ctx, `
+		SELECT team_id, user_id FROM user_teams_mapper
+		WHERE user_id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byTeam := make(map[int64]*TeamClients)
+	for rows.Next() {
+		var teamID, userID int64
+		if err := rows.Scan(&teamID, &userID); err != nil {
+			return nil, err
+		}
+		t, ok := byTeam[teamID]
+		if !ok {
+			t = &TeamClients{TeamID: teamID}
+			byTeam[teamID] = t
+		}
+		t.Users++
+		t.Streams += perUser[userID]
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range byTeam {
+		teams = append(teams, *t)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		if teams[i].Streams != teams[j].Streams {
+			return teams[i].Streams > teams[j].Streams
+		}
+		return teams[i].TeamID < teams[j].TeamID
+	})
+	if len(teams) > maxStatsTeams {
+		teams = teams[:maxStatsTeams]
+	}
+	return teams, nil
+}
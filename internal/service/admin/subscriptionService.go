@@ -0,0 +1,107 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/digest"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// SubscribeEmailRequest represents the request body for adding a channel
+// email subscriber
+type SubscribeEmailRequest struct {
+	Email   string `json:"email"`
+	Cadence string `json:"cadence"`
+}
+
+// ListChannelEmailSubscriptions returns the email subscribers of a channel
+func (as *AdminService) ListChannelEmailSubscriptions(w http.ResponseWriter, r *http.Request) {
+	channelID, err := strconv.ParseInt(mux.Vars(r)["channel_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+
+	subs, err := digest.ListChannelSubscriptions(r.Context(), channelID)
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to list channel email subscriptions", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get subscriptions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"subscriptions": subs})
+}
+
+// AddChannelEmailSubscription subscribes an email address to periodic
+// summaries of a public channel
+func (as *AdminService) AddChannelEmailSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	channelID, err := strconv.ParseInt(mux.Vars(r)["channel_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+
+	var req SubscribeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Cadence == "" {
+		req.Cadence = digest.CadenceWeekly
+	}
+
+	userDetails, _ := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	adminID, _ := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+
+	sub, err := digest.SubscribeChannel(ctx, channelID, req.Email, req.Cadence, adminID)
+	switch {
+	case err == nil:
+		as.Log.WithContext(ctx).Audit("Channel email subscription added", "channel_id", channelID, "subscription_id", sub.ID, "user_id", adminID)
+		respondWithJSON(w, http.StatusOK, sub)
+	case errors.Is(err, digest.ErrChannelNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, digest.ErrPrivateChannel), errors.Is(err, digest.ErrInvalidEmail), errors.Is(err, digest.ErrInvalidCadence):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		as.Log.WithContext(ctx).Error("Failed to add channel email subscription", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to add subscription")
+	}
+}
+
+// DeleteChannelEmailSubscription removes a channel email subscriber
+func (as *AdminService) DeleteChannelEmailSubscription(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channelID, err := strconv.ParseInt(vars["channel_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+	subscriptionID, err := strconv.ParseInt(vars["subscription_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid subscription ID")
+		return
+	}
+
+	err = digest.DeleteChannelSubscription(r.Context(), channelID, subscriptionID)
+	if errors.Is(err, digest.ErrSubscriptionNotFound) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to delete channel email subscription", "error", err, "subscription_id", subscriptionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete subscription")
+		return
+	}
+
+	as.Log.WithContext(r.Context()).Audit("Channel email subscription removed", "channel_id", channelID, "subscription_id", subscriptionID)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Subscription removed"})
+}
@@ -0,0 +1,55 @@
+package adminService
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+// CreateWorkspaceRequest represents the request body for creating a
+// workspace. The slug names it in the X-Workspace header and as the
+// subdomain under WORKSPACE_BASE_DOMAIN.
+type CreateWorkspaceRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// ListWorkspaces returns every workspace hosted on the deployment
+func (as *AdminService) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	list, err := workspace.List(r.Context(), as.DB)
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to list workspaces", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list workspaces")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"workspaces": list})
+}
+
+// CreateWorkspace adds an isolated workspace. Accounts sign up into it by
+// naming it in their requests.
+func (as *AdminService) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req CreateWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	ws, err := workspace.Create(r.Context(), as.DB, req.Slug, req.Name)
+	switch {
+	case errors.Is(err, workspace.ErrInvalidSlug):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, workspace.ErrSlugTaken):
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		as.Log.WithContext(r.Context()).Error("Failed to create workspace", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create workspace")
+		return
+	}
+
+	as.Log.WithContext(r.Context()).Audit("Workspace created", "workspace_id", ws.ID, "slug", ws.Slug)
+	respondWithJSON(w, http.StatusCreated, ws)
+}
@@ -0,0 +1,417 @@
+package attachmentService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/limits"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/media"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/scan"
+	"github.com/nikhil/eaven/internal/storage"
+)
+
+const (
+	defaultMaxUploadBytes    = 25 << 20
+	defaultDownloadRateBytes = 2 << 20
+)
+
+// messageExists matches attachments not sent yet and those whose message
+// still exists, hot or archived, so the files of a deleted message stop
+// being served even before they are removed from storage
+var messageExists = func() string {
+	parts := []string{"a.message_id = 0"}
+	for _, table := range history.Tables {
+		parts = append(parts, "EXISTS(SELECT 1 FROM "+table+" m WHERE m.message_id = a.message_id)")
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}()
+
+// AttachmentService handles file uploads and authenticated downloads
+type AttachmentService struct {
+	DB      *sql.DB
+	Log     *logger.Logger
+	Storage storage.Storage
+	// Scanner, when set, holds new uploads back from download until the
+	// scan worker has found them clean
+	Scanner        scan.Scanner
+	MaxUploadBytes int64
+	bandwidth      *bandwidthLimiter
+}
+
+// NewAttachmentService initializes a new attachment service.
+// ATTACHMENT_MAX_BYTES caps upload size (default 25MB) and
+// DOWNLOAD_BYTES_PER_SECOND caps each user's download bandwidth across all
+// their downloads (default 2MB/s, 0 for unlimited).
+func NewAttachmentService(db *sql.DB, store storage.Storage, scanner scan.Scanner, log *logger.Logger) *AttachmentService {
+	maxUpload := int64(defaultMaxUploadBytes)
+	if v, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		maxUpload = v
+	}
+	rate := int64(defaultDownloadRateBytes)
+	if v, err := strconv.ParseInt(os.Getenv("DOWNLOAD_BYTES_PER_SECOND"), 10, 64); err == nil && v >= 0 {
+		rate = v
+	}
+
+	return &AttachmentService{
+		DB:             db,
+		Log:            log,
+		Storage:        store,
+		Scanner:        scanner,
+		MaxUploadBytes: maxUpload,
+		bandwidth:      newBandwidthLimiter(rate),
+	}
+}
+
+// UploadAttachment stores a file sent as the "file" field of a multipart
+// form in a channel the user belongs to
+func (as *AttachmentService) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := as.userID(w, r)
+	if !ok {
+		return
+	}
+
+	channelID, err := strconv.ParseInt(mux.Vars(r)["channel_id"], 10, 64)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Invalid channel ID in URL", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+
+	isMember, err := as.isMember(r, channelID, userID)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check channel membership")
+		return
+	}
+	if !isMember {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+	var teamID int64
+	if err := as.DB.QueryRowContext(ctx, `SELECT team_id FROM channels WHERE channel_id = ?`, channelID).Scan(&teamID); err != nil {
+		as.Log.WithContext(ctx).Error("Failed to get channel team", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to store attachment")
+		return
+	}
+	// Refuse early when the quota is used up, before reading the file
+	if !as.checkStorage(w, r, teamID, 0) {
+		return
+	}
+
+	// Stream the part straight to storage instead of buffering the form
+	r.Body = http.MaxBytesReader(w, r.Body, as.MaxUploadBytes+1024*1024)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Expected a multipart/form-data body")
+		return
+	}
+	var part io.ReadCloser
+	var fileName, contentType string
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Missing file field")
+			return
+		}
+		if p.FormName() == "file" {
+			part = p
+			fileName = sanitizeFileName(p.FileName())
+			contentType = p.Header.Get("Content-Type")
+			break
+		}
+		p.Close()
+	}
+	defer part.Close()
+
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		contentType = "application/octet-stream"
+	}
+
+	key := storage.NewKey()
+	size, err := as.Storage.Put(ctx, key, io.LimitReader(part, as.MaxUploadBytes+1))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		as.Log.WithContext(ctx).Error("Failed to store attachment", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to store attachment")
+		return
+	}
+	if size > as.MaxUploadBytes {
+		as.Storage.Delete(ctx, key)
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+	if !as.checkStorage(w, r, teamID, size) {
+		as.Storage.Delete(ctx, key)
+		return
+	}
+
+	attachment := models.Attachment{
+		ChannelID:   channelID,
+		UploaderID:  userID,
+		FileName:    fileName,
+		ContentType: contentType,
+		SizeBytes:   size,
+		ScanStatus:  scan.StatusUnscanned,
+		CreatedAt:   time.Now().UTC().Unix(),
+	}
+	if as.Scanner != nil {
+		attachment.ScanStatus = scan.StatusPending
+	}
+	mediaStatus := media.StatusFor(contentType)
+	query := `
+		INSERT INTO attachments (channel_id, uploader_id, file_name, content_type, size_bytes, storage_key, scan_status, media_status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := as.DB.ExecContext(ctx, query, channelID, userID, fieldcrypt.String(fileName), contentType, size, key,
+		attachment.ScanStatus, mediaStatus, attachment.CreatedAt)
+	if err != nil {
+		as.Storage.Delete(ctx, key)
+		as.Log.WithContext(ctx).Error("Failed to save attachment", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save attachment")
+		return
+	}
+	attachment.AttachmentID, _ = result.LastInsertId()
+	attachment.Media = media.Describe(attachment.AttachmentID, mediaStatus, models.Media{}, "")
+	if as.Scanner != nil {
+		scan.Enqueue()
+	}
+	if mediaStatus == media.StatusPending {
+		media.Enqueue()
+	}
+
+	if err := limits.WriteHeaders(ctx, as.DB, w.Header(), teamID); err != nil {
+		as.Log.WithContext(ctx).Warn("Failed to get team quota", "error", err, "team_id", teamID)
+	}
+	respondWithJSON(w, http.StatusCreated, attachment)
+}
+
+// GetAttachment returns an attachment's record, including its scan status
+// and media metadata, to a current member of its channel
+func (as *AttachmentService) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := as.userID(w, r)
+	if !ok {
+		return
+	}
+
+	attachmentID, err := strconv.ParseInt(mux.Vars(r)["attachment_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid attachment ID")
+		return
+	}
+
+	var a models.Attachment
+	var meta models.Media
+	var mediaStatus, thumbnailKey string
+	var isMember bool
+	query := `
+		SELECT a.attachment_id, a.message_id, a.channel_id, a.uploader_id, a.file_name, a.content_type, a.size_bytes, a.scan_status, a.created_at,
+			a.media_status, a.media_width, a.media_height, a.media_duration_ms, a.thumbnail_key,
+			EXISTS(SELECT 1 FROM channel_members cm WHERE cm.channel_id = a.channel_id AND cm.user_id = ?)
+		FROM attachments a
+		WHERE a.attachment_id = ? AND ` + messageExists + `
+	`
+	err = as.DB.QueryRowContext(ctx, query, userID, attachmentID).Scan(&a.AttachmentID, &a.MessageID, &a.ChannelID, &a.UploaderID,
+		(*fieldcrypt.String)(&a.FileName), &a.ContentType, &a.SizeBytes, &a.ScanStatus, &a.CreatedAt,
+		&mediaStatus, &meta.Width, &meta.Height, &meta.DurationMS, &thumbnailKey, &isMember)
+	if err == sql.ErrNoRows || (err == nil && !isMember) {
+		respondWithError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to get attachment", "error", err, "attachment_id", attachmentID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get attachment")
+		return
+	}
+	a.Media = media.Describe(a.AttachmentID, mediaStatus, meta, thumbnailKey)
+	respondWithJSON(w, http.StatusOK, a)
+}
+
+// DownloadAttachment streams an attachment to a current member of its
+// channel. Range and conditional requests are handled by http.ServeContent.
+// Files still being scanned are refused with 409 and quarantined ones with
+// 403.
+func (as *AttachmentService) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	as.serve(w, r, false)
+}
+
+// DownloadThumbnail streams the JPEG thumbnail of an image attachment, with
+// the same access checks as the file itself
+func (as *AttachmentService) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	as.serve(w, r, true)
+}
+
+func (as *AttachmentService) serve(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	ctx := r.Context()
+
+	userID, ok := as.userID(w, r)
+	if !ok {
+		return
+	}
+
+	attachmentID, err := strconv.ParseInt(mux.Vars(r)["attachment_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid attachment ID")
+		return
+	}
+
+	// Membership is checked on every request, including conditional ones, so
+	// users who leave a channel lose access to its files immediately
+	var fileName, contentType, key, scanStatus, thumbnailKey string
+	var isMember bool
+	query := `
+		SELECT a.file_name, a.content_type, a.storage_key, a.scan_status, a.thumbnail_key,
+			EXISTS(SELECT 1 FROM channel_members cm WHERE cm.channel_id = a.channel_id AND cm.user_id = ?)
+		FROM attachments a
+		WHERE a.attachment_id = ? AND ` + messageExists + `
+	`
+	err = as.DB.QueryRowContext(ctx, query, userID, attachmentID).Scan((*fieldcrypt.String)(&fileName), &contentType, &key, &scanStatus, &thumbnailKey, &isMember)
+	if err == sql.ErrNoRows || (err == nil && !isMember) {
+		// Do not reveal whether the attachment exists to non-members
+		respondWithError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to get attachment", "error", err, "attachment_id", attachmentID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get attachment")
+		return
+	}
+	switch scanStatus {
+	case scan.StatusPending:
+		w.Header().Set("Retry-After", "10")
+		respondWithError(w, http.StatusConflict, "Attachment is still being scanned")
+		return
+	case scan.StatusInfected:
+		respondWithError(w, http.StatusForbidden, "Attachment was quarantined because it failed a virus scan")
+		return
+	}
+
+	disposition := "attachment"
+	if thumbnail {
+		if thumbnailKey == "" {
+			respondWithError(w, http.StatusNotFound, "Attachment has no thumbnail")
+			return
+		}
+		key, contentType, disposition = thumbnailKey, "image/jpeg", "inline"
+	}
+
+	object, err := as.Storage.Open(ctx, key)
+	if err != nil {
+		as.Log.WithContext(ctx).Error("Failed to open attachment", "error", err, "attachment_id", attachmentID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to read attachment")
+		return
+	}
+	defer object.Close()
+
+	// Objects are immutable, so the storage key is a strong validator.
+	// Caches must revalidate so the access check above always runs.
+	w.Header().Set("ETag", `"`+key+`"`)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+
+	http.ServeContent(w, r, fileName, object.ModTime(), as.bandwidth.reader(ctx, userID, object))
+}
+
+func (as *AttachmentService) userID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		as.Log.WithContext(r.Context()).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return userID, true
+}
+
+// checkStorage responds and returns false if storing size more bytes would
+// take the team over its storage quota
+func (as *AttachmentService) checkStorage(w http.ResponseWriter, r *http.Request, teamID, size int64) bool {
+	err := limits.CheckStorage(r.Context(), as.DB, teamID, size)
+	var exceeded *limits.ExceededError
+	if errors.As(err, &exceeded) {
+		exceeded.SetHeaders(w.Header())
+		respondWithJSON(w, http.StatusPaymentRequired, exceeded.Body())
+		return false
+	}
+	if err != nil {
+		as.Log.WithContext(r.Context()).Error("Failed to check storage quota", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to store attachment")
+		return false
+	}
+	return true
+}
+
+func (as *AttachmentService) isMember(r *http.Request, channelID, userID int64) (bool, error) {
+	var isMember bool
+	query := `SELECT EXISTS(SELECT 1 FROM channel_members WHERE channel_id = ? AND user_id = ?)`
+	err := as.DB.QueryRowContext(r.Context(), query, channelID, userID).Scan(&isMember)
+	return isMember, err
+}
+
+// sanitizeFileName keeps only the base name and drops control characters
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
+
+// Helper functions for HTTP responses
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	respondWithJSON(w, code, map[string]string{"error": message})
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling JSON: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
@@ -0,0 +1,114 @@
+package attachmentService
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunk caps how much is read per call so a single large read cannot
+// overdraw a user's bucket far into the future
+const throttleChunk = 32 * 1024
+
+// bandwidthLimiter shares a token bucket per user across all their
+// concurrent downloads
+type bandwidthLimiter struct {
+	rate int64 // bytes per second, 0 means unlimited
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		rate:    bytesPerSecond,
+		buckets: make(map[int64]*bucket),
+	}
+}
+
+// reserve takes n bytes from the user's bucket and returns how long the
+// caller must wait before sending them
+func (l *bandwidthLimiter) reserve(userID int64, n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[userID]
+	if !ok {
+		l.prune(now)
+		b = &bucket{tokens: float64(l.rate), last: now}
+		l.buckets[userID] = b
+	}
+
+	// Refill, allowing at most one second of burst
+	b.tokens += now.Sub(b.last).Seconds() * float64(l.rate)
+	if b.tokens > float64(l.rate) {
+		b.tokens = float64(l.rate)
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// prune drops buckets that have fully refilled, which are equivalent to a
+// fresh bucket. Called with mu held.
+func (l *bandwidthLimiter) prune(now time.Time) {
+	if len(l.buckets) < 1024 {
+		return
+	}
+	for id, b := range l.buckets {
+		if now.Sub(b.last) > time.Second {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// reader wraps content so it is read no faster than the user's share allows.
+// Throttling the read side lets the client's TCP window provide the
+// backpressure: http.ServeContent only reads as fast as it can write.
+func (l *bandwidthLimiter) reader(ctx context.Context, userID int64, content io.ReadSeeker) io.ReadSeeker {
+	if l.rate <= 0 {
+		return content
+	}
+	return &throttledReader{ctx: ctx, limiter: l, userID: userID, content: content}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	limiter *bandwidthLimiter
+	userID  int64
+	content io.ReadSeeker
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := t.content.Read(p)
+	if n > 0 {
+		if wait := t.limiter.reserve(t.userID, n); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-t.ctx.Done():
+				timer.Stop()
+				return 0, t.ctx.Err()
+			}
+		}
+	}
+	return n, err
+}
+
+func (t *throttledReader) Seek(offset int64, whence int) (int64, error) {
+	return t.content.Seek(offset, whence)
+}
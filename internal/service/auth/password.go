@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nikhil/eaven/internal/accounts"
+	"github.com/nikhil/eaven/internal/lockout"
+	"github.com/nikhil/eaven/internal/passwordpolicy"
+	"github.com/nikhil/eaven/internal/workspace"
+	"github.com/nikhil/eaven/pkg/utils"
+)
+
+// ErrWrongPassword is returned when the current password given to
+// ChangePassword does not match
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// ChangePassword replaces a user's password after checking the current one,
+// signs out every other session and returns a fresh token for the caller.
+// Wrong current passwords count towards the login lockout.
+func (s *AuthService) ChangePassword(ctx context.Context, userID int64, current, next, ip string) (string, error) {
+	var email, hash, firstName, lastName string
+	query := "SELECT email, password, first_name, last_name FROM users WHERE user_id = ?"
+	if err := s.DB.QueryRowContext(ctx, query, userID).Scan(&email, &hash, &firstName, &lastName); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if err := lockout.Check(ctx, s.DB, email, ip, now); err != nil {
+		var locked *lockout.LockedError
+		if errors.As(err, &locked) {
+			return "", err
+		}
+		s.Log.WithContext(ctx).Error("Failed to check login lockout", "error", err)
+	}
+	if utils.CheckPassword(hash, current) != nil {
+		if lockErr := s.loginFailed(ctx, email, ip, "wrong_current_password", now); lockErr != nil {
+			return "", lockErr
+		}
+		return "", ErrWrongPassword
+	}
+	if utils.CheckPassword(hash, next) == nil {
+		return "", &passwordpolicy.ValidationError{Problems: []string{"choose a password different from your current one"}}
+	}
+	if err := passwordpolicy.Check(next, email, firstName, lastName); err != nil {
+		return "", err
+	}
+
+	hashed, err := utils.HashPassword(next)
+	if err != nil {
+		return "", err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password = ? WHERE user_id = ?", hashed, userID); err != nil {
+		return "", err
+	}
+	version, err := accounts.RevokeTokens(ctx, tx, userID)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	accounts.InvalidateTokenVersions()
+
+	s.Log.WithContext(ctx).Audit("Password changed", "user_id", userID, "ip", ip, "token_version", version)
+	return s.GenerateJWT(email, userID, version)
+}
+
+// ResetPassword sets a new password for the account with the given email in
+// the context's workspace without checking the current one, for administrators. It signs out every
+// session and clears the account's login lockout.
+func (s *AuthService) ResetPassword(ctx context.Context, email, next string) (int64, error) {
+	var userID int64
+	var firstName, lastName string
+	query := "SELECT user_id, first_name, last_name FROM users WHERE email = ? AND workspace_id = ?"
+	if err := s.DB.QueryRowContext(ctx, query, email, workspace.FromContext(ctx)).Scan(&userID, &firstName, &lastName); err != nil {
+		return 0, err
+	}
+	if err := passwordpolicy.Check(next, email, firstName, lastName); err != nil {
+		return 0, err
+	}
+
+	hashed, err := utils.HashPassword(next)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password = ? WHERE user_id = ?", hashed, userID); err != nil {
+		return 0, err
+	}
+	version, err := accounts.RevokeTokens(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	accounts.InvalidateTokenVersions()
+	if _, err := lockout.RecordSuccess(ctx, s.DB, email); err != nil {
+		s.Log.WithContext(ctx).Error("Failed to clear login lockout", "error", err)
+	}
+
+	s.Log.WithContext(ctx).Audit("Password reset", "user_id", userID, "token_version", version)
+	return userID, nil
+}
@@ -1,44 +1,67 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/accounts"
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+	"github.com/nikhil/eaven/internal/handles"
+	"github.com/nikhil/eaven/internal/lockout"
+	"github.com/nikhil/eaven/internal/logger"
 	models "github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/passwordpolicy"
+	"github.com/nikhil/eaven/internal/workspace"
 	"github.com/nikhil/eaven/pkg/utils"
 )
 
 type AuthService struct {
-	DB *sql.DB
+	DB  *sql.DB
+	Log *logger.Logger
 }
 
 // NewAuthService creates a new instance of AuthService
-func NewAuthService() *AuthService {
+func NewAuthService(db *sql.DB, log *logger.Logger) *AuthService {
 	return &AuthService{
-		DB: database.DB,
+		DB:  db,
+		Log: log,
 	}
 }
 
-// Signup handles user registration
-func (s *AuthService) Signup(user models.User) (int64, error) {
+// Signup handles user registration and sets user.Handle to the handle the
+// account got. Passwords that break the policy fail with a
+// *passwordpolicy.ValidationError.
+func (s *AuthService) Signup(ctx context.Context, user *models.User) (int64, error) {
+	if err := passwordpolicy.Check(user.Password, user.Email, user.FirstName, user.LastName); err != nil {
+		return 0, err
+	}
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
 		return 0, err
 	}
 	var existingUserID int
-	userquery := "SELECT user_id FROM users WHERE email = ?"
-	err = s.DB.QueryRow(userquery, user.Email).Scan(&existingUserID)
+	// Accounts belong to the workspace they signed up in, so the same email
+	// can have an account in several
+	ws := workspace.FromContext(ctx)
+	userquery := "SELECT user_id FROM users WHERE email = ? AND workspace_id = ?"
+	err = s.DB.QueryRowContext(ctx, userquery, user.Email, ws).Scan(&existingUserID)
 
 	if err == nil {
 		return 0, errors.New("Email already registered")
 	}
 
-	query := "INSERT INTO users (email, password , contact_number , first_name , last_name , created_at	) VALUES (?, ? , ? , ? , ? , ?)"
-	value, err := s.DB.Exec(query, user.Email, hashedPassword, user.ContactNumber, user.FirstName, user.LastName, time.Now().Unix())
+	handle, err := s.signupHandle(ctx, ws, *user)
+	if err != nil {
+		return 0, err
+	}
+	user.Handle = handle
+
+	query := "INSERT INTO users (email, handle, password , contact_number , first_name , last_name , created_at, workspace_id) VALUES (?, ?, ? , ? , ? , ? , ?, ?)"
+	value, err := s.DB.ExecContext(ctx, query, user.Email, handle, hashedPassword, fieldcrypt.String(user.ContactNumber), user.FirstName, user.LastName, time.Now().Unix(), ws)
 	if err != nil {
 		return 0, err
 	}
@@ -50,22 +73,77 @@ func (s *AuthService) Signup(user models.User) (int64, error) {
 	return id, nil
 }
 
-// Login authenticates a user
-func (s *AuthService) Login(email, password string) (string, models.User, error) {
+// signupHandle checks the handle a new user asked for, or picks a free one
+// from their email address. Bad handles fail with handles.ErrInvalidHandle
+// or handles.ErrHandleTaken.
+func (s *AuthService) signupHandle(ctx context.Context, workspaceID int64, user models.User) (string, error) {
+	now := time.Now().UTC()
+	if user.Handle == "" {
+		return handles.Available(ctx, s.DB, workspaceID, handles.Suggest(user.Email), now)
+	}
+	handle := handles.Normalize(user.Handle)
+	if !handles.Valid(handle) {
+		return "", handles.ErrInvalidHandle
+	}
+	free, err := handles.Available(ctx, s.DB, workspaceID, handle, now)
+	if err != nil {
+		return "", err
+	}
+	if free != handle {
+		return "", handles.ErrHandleTaken
+	}
+	return handle, nil
+}
+
+// Login authenticates a user. Attempts against a locked out account or from
+// a locked out address fail with a *lockout.LockedError before the password
+// is checked.
+func (s *AuthService) Login(ctx context.Context, email, password, ip string) (string, models.User, error) {
+	now := time.Now().UTC()
+	if err := lockout.Check(ctx, s.DB, email, ip, now); err != nil {
+		var locked *lockout.LockedError
+		if errors.As(err, &locked) {
+			s.Log.WithContext(ctx).Audit("Login refused during lockout", "email", email, "ip", ip, "scope", locked.Scope, "locked_until", locked.Until)
+			return "", models.User{}, err
+		}
+		// Lockouts fail open so a database hiccup does not stop every login
+		s.Log.WithContext(ctx).Error("Failed to check login lockout", "error", err)
+	}
+
 	var user models.User
-	query := "SELECT user_id, email, password , contact_number , first_name , last_name FROM users WHERE email = ?"
-	err := s.DB.QueryRow(query, email).Scan(&user.UserID, &user.Email, &user.Password, &user.ContactNumber, &user.FirstName, &user.LastName)
+	var tokenVersion int64
+	query := "SELECT user_id, email, password , contact_number , first_name , last_name, token_version FROM users WHERE email = ? AND workspace_id = ? AND merged_into = 0"
+	err := s.DB.QueryRowContext(ctx, query, email, workspace.FromContext(ctx)).Scan(&user.UserID, &user.Email, &user.Password, (*fieldcrypt.String)(&user.ContactNumber), &user.FirstName, &user.LastName, &tokenVersion)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			// Unknown emails count too, so probing for accounts is throttled
+			// and indistinguishable from guessing passwords
+			if lockErr := s.loginFailed(ctx, email, ip, "unknown_email", now); lockErr != nil {
+				return "", models.User{}, lockErr
+			}
 			return "", models.User{}, errors.New("user not found")
 		}
 		return "", models.User{}, err
 	}
 	if err := utils.CheckPassword(user.Password, password); err != nil {
+		if lockErr := s.loginFailed(ctx, email, ip, "wrong_password", now); lockErr != nil {
+			return "", models.User{}, lockErr
+		}
 		return "", models.User{}, err
 	}
 
-	token, err := s.GenerateJWT(user.Email, user.UserID)
+	failures, err := lockout.RecordSuccess(ctx, s.DB, email)
+	if err != nil {
+		s.Log.WithContext(ctx).Error("Failed to clear login failures", "error", err, "user_id", user.UserID)
+	}
+	if failures > 0 {
+		s.Log.WithContext(ctx).Audit("Login succeeded after failures", "user_id", user.UserID, "ip", ip, "failures", failures)
+	}
+	if utils.NeedsRehash(user.Password) {
+		s.rehashPassword(ctx, user.UserID, user.Password, password)
+	}
+
+	token, err := s.GenerateJWT(user.Email, user.UserID, tokenVersion)
 	user.Password = ""
 	if err != nil {
 		return "", models.User{}, err
@@ -74,13 +152,50 @@ func (s *AuthService) Login(email, password string) (string, models.User, error)
 	return token, user, nil
 }
 
-// GenerateJWT creates a JWT token for authentication
-func (s *AuthService) GenerateJWT(email string, userID int64) (string, error) {
+// rehashPassword upgrades a stored hash made with an older algorithm or
+// parameters while the password is at hand. It is not a password change, so
+// sessions are left alone, and a failure only means trying again on the next
+// login. Matching the old hash keeps it from undoing a concurrent change.
+func (s *AuthService) rehashPassword(ctx context.Context, userID int64, oldHash, password string) {
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		s.Log.WithContext(ctx).Warn("Failed to rehash password", "error", err, "user_id", userID)
+		return
+	}
+	if _, err := s.DB.ExecContext(ctx, "UPDATE users SET password = ? WHERE user_id = ? AND password = ?", hashed, userID, oldHash); err != nil {
+		s.Log.WithContext(ctx).Warn("Failed to store rehashed password", "error", err, "user_id", userID)
+		return
+	}
+	s.Log.WithContext(ctx).Audit("Password rehashed", "user_id", userID, "algorithm", utils.PasswordHashConfig().Algorithm)
+}
+
+// loginFailed records a failed attempt and returns the lockout it caused, if
+// any. Every failure is audited so brute force shows up in the logs even
+// below the lockout limits.
+func (s *AuthService) loginFailed(ctx context.Context, email, ip, reason string, now time.Time) error {
+	failures, err := lockout.RecordFailure(ctx, s.DB, email, ip, now)
+	var locked *lockout.LockedError
+	if errors.As(err, &locked) {
+		s.Log.WithContext(ctx).Audit("Login locked out", "email", email, "ip", ip, "reason", reason, "failures", failures,
+			"scope", locked.Scope, "locked_until", locked.Until)
+		return err
+	}
+	if err != nil {
+		s.Log.WithContext(ctx).Error("Failed to record login failure", "error", err)
+	}
+	s.Log.WithContext(ctx).Audit("Login failed", "email", email, "ip", ip, "reason", reason, "failures", failures)
+	return nil
+}
+
+// GenerateJWT creates a JWT token for authentication. tokenVersion is the
+// account's current token version; the token stops working once it changes.
+func (s *AuthService) GenerateJWT(email string, userID, tokenVersion int64) (string, error) {
 	secretKey := os.Getenv("JWT_SECRET")
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"email":   email,
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"email":                    email,
+		"user_id":                  userID,
+		accounts.TokenVersionClaim: tokenVersion,
+		"exp":                      time.Now().Add(time.Hour * 24).Unix(),
 	})
 
 	return token.SignedString([]byte(secretKey))
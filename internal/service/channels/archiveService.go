@@ -0,0 +1,99 @@
+package channelService
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/actiontoken"
+	"github.com/nikhil/eaven/internal/archival"
+)
+
+// Archive links are opened from email in a browser, so these handlers answer
+// with minimal HTML pages instead of JSON
+var archivePage = template.Must(template.New("archive").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Archive channel</title></head>
+<body style="font-family:sans-serif;max-width:32em;margin:4em auto">
+{{if .Confirm}}
+<p>Archive <strong>#{{.ChannelName}}</strong>? It will leave the channel list, and no one will be able to post in it or join it.</p>
+<form method="POST"><input type="hidden" name="token" value="{{.Token}}"><button type="submit">Archive channel</button></form>
+{{else}}
+<p>{{.Message}}</p>
+{{end}}
+</body></html>`))
+
+type archivePageData struct {
+	Confirm     bool
+	ChannelName string
+	Token       string
+	Message     string
+}
+
+func renderArchivePage(w http.ResponseWriter, code int, data archivePageData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	archivePage.Execute(w, data)
+}
+
+// ConfirmArchiveAction shows a confirmation button for a signed archive link.
+// The archive itself needs a POST so link scanners that prefetch email links
+// cannot archive channels.
+func (cs *ChannelService) ConfirmArchiveAction(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	claims, err := actiontoken.Verify(token, archival.ActionArchiveChannel)
+	if err != nil {
+		renderArchivePage(w, http.StatusUnauthorized, archivePageData{Message: "This archive link is invalid or has expired."})
+		return
+	}
+
+	var name string
+	var archivedAt int64
+	err = cs.DB.QueryRowContext(r.Context(), `SELECT channel_name, archived_at FROM channels WHERE channel_id = ?`, claims.SubjectID).Scan(&name, &archivedAt)
+	if err != nil {
+		renderArchivePage(w, http.StatusNotFound, archivePageData{Message: "This channel no longer exists."})
+		return
+	}
+	if archivedAt > 0 {
+		renderArchivePage(w, http.StatusOK, archivePageData{Message: "#" + name + " is already archived."})
+		return
+	}
+
+	renderArchivePage(w, http.StatusOK, archivePageData{Confirm: true, ChannelName: name, Token: token})
+}
+
+// ArchiveChannelAction archives the channel named by a signed archive link.
+// The signer must still be allowed to archive the channel.
+func (cs *ChannelService) ArchiveChannelAction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, err := actiontoken.Verify(r.FormValue("token"), archival.ActionArchiveChannel)
+	if err != nil {
+		renderArchivePage(w, http.StatusUnauthorized, archivePageData{Message: "This archive link is invalid or has expired."})
+		return
+	}
+
+	allowed, err := archival.CanArchive(ctx, cs.DB, claims.UserID, claims.SubjectID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to check archive permission", "error", err, "channel_id", claims.SubjectID)
+		renderArchivePage(w, http.StatusInternalServerError, archivePageData{Message: "Something went wrong. Please try again."})
+		return
+	}
+	if !allowed {
+		renderArchivePage(w, http.StatusForbidden, archivePageData{Message: "You are no longer allowed to archive this channel."})
+		return
+	}
+
+	archived, err := archival.Archive(ctx, cs.DB, claims.SubjectID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to archive channel", "error", err, "channel_id", claims.SubjectID)
+		renderArchivePage(w, http.StatusInternalServerError, archivePageData{Message: "Something went wrong. Please try again."})
+		return
+	}
+	if !archived {
+		renderArchivePage(w, http.StatusOK, archivePageData{Message: "This channel is already archived."})
+		return
+	}
+
+	cs.Log.WithContext(ctx).Audit("Channel archived from suggestion", "channel_id", claims.SubjectID, "user_id", claims.UserID)
+	renderArchivePage(w, http.StatusOK, archivePageData{Message: "The channel has been archived."})
+}
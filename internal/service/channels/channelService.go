@@ -1,6 +1,7 @@
 package channelService
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -13,17 +14,26 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 
-	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/export"
+	"github.com/nikhil/eaven/internal/i18n"
 	"github.com/nikhil/eaven/internal/logger"
 	"github.com/nikhil/eaven/internal/middleware"
 	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/queries"
 	messageService "github.com/nikhil/eaven/internal/service/messages"
+	"github.com/nikhil/eaven/internal/utils"
 )
 
 // ChannelService handles channel-related operations
 type ChannelService struct {
-	DB  *sql.DB
-	Log *logger.Logger
+	DB      *sql.DB
+	Queries *queries.Queries
+	Log     *logger.Logger
+	Exports *export.Exporter
+	// Messages posts the messages channel changes announce
+	Messages *messageService.MessageService
 }
 
 // CreateChannelRequest represents the request body for channel creation
@@ -38,8 +48,20 @@ type CreateChannelRequest struct {
 type UpdateChannelRequest struct {
 	Name        string `json:"name" validate:"required,min=1,max=80"`
 	Description string `json:"description" validate:"max=300"`
+	// AnnouncementOnly, when given, restricts posting to admins and members
+	// granted posting
+	AnnouncementOnly *bool `json:"announcement_only"`
+	// MessageTTLSeconds, when given, makes messages disappear that long
+	// after they are posted; 0 turns it off
+	MessageTTLSeconds *int `json:"message_ttl_seconds"`
 }
 
+// Bounds of a channel's message TTL
+const (
+	minMessageTTL = 60
+	maxMessageTTL = 365 * 24 * 60 * 60
+)
+
 // PaginationResponse wraps paginated channel results
 type PaginationResponse struct {
 	Channels   []models.Channel `json:"channels"`
@@ -48,11 +70,37 @@ type PaginationResponse struct {
 	PerPage    int              `json:"per_page"`
 }
 
-// NewChannelService initializes a new channel service
-func NewChannelService() *ChannelService {
+// channelSlug derives the slug of a channel name and checks no other channel
+// of the team has it, answering the request otherwise. channelID is the
+// channel being renamed, or 0 for a new one.
+func (cs *ChannelService) channelSlug(ctx context.Context, w http.ResponseWriter, teamID int64, name string, channelID int64) (string, bool) {
+	slug := utils.Slugify(name)
+	if slug == "" {
+		respondWithError(w, http.StatusBadRequest, "Channel name must contain a letter or digit")
+		return "", false
+	}
+	taken, err := cs.Queries.ChannelSlugTaken(ctx, teamID, slug, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to check channel slug", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check channel name")
+		return "", false
+	}
+	if taken {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("A channel named %q already exists in this team", slug))
+		return "", false
+	}
+	return slug, true
+}
+
+// NewChannelService initializes a new channel service. Join messages are
+// posted through messages.
+func NewChannelService(db *sql.DB, q *queries.Queries, log *logger.Logger, messages *messageService.MessageService) *ChannelService {
 	return &ChannelService{
-		DB:  database.DB,
-		Log: logger.NewLogger("channel-service"),
+		DB:       db,
+		Queries:  q,
+		Log:      log,
+		Exports:  export.NewExporter(db),
+		Messages: messages,
 	}
 }
 
@@ -63,7 +111,7 @@ func (cs *ChannelService) CreateChannel(w http.ResponseWriter, r *http.Request)
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		cs.Log.Error("Failed to extract user details from context")
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -71,7 +119,7 @@ func (cs *ChannelService) CreateChannel(w http.ResponseWriter, r *http.Request)
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid user ID in token", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
@@ -79,31 +127,40 @@ func (cs *ChannelService) CreateChannel(w http.ResponseWriter, r *http.Request)
 	// Parse and validate request body
 	var req CreateChannelRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		cs.Log.Error("Failed to decode request body", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	// Verify user is a member of the team
-	var isMember bool
-	memberQuery := `SELECT 1 FROM user_teams_mapper WHERE team_id = ? AND user_id = ?`
-	err = cs.DB.QueryRowContext(ctx, memberQuery, req.TeamID, userID).Scan(&isMember)
-	if err != nil {
-		cs.Log.Error("Failed to check team membership", "error", err)
+	// Verify user is a member of the team; guests cannot create channels
+	teamRole, err := cs.Queries.GetTeamRole(ctx, req.TeamID, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cs.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to verify team membership")
 		return
 	}
 
-	if !isMember {
-		cs.Log.Warn("Unauthorized channel creation attempt", "team_id", req.TeamID, "user_id", userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		cs.Log.WithContext(ctx).Warn("Unauthorized channel creation attempt", "team_id", req.TeamID, "user_id", userID)
 		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
 		return
 	}
+	if teamRole == queries.TeamRoleGuest {
+		cs.Log.WithContext(ctx).Warn("Guest channel creation attempt", "team_id", req.TeamID, "user_id", userID)
+		respondWithError(w, http.StatusForbidden, "Guests cannot create channels")
+		return
+	}
+	ctx = logger.ContextWithFields(ctx, "team_id", req.TeamID)
+
+	slug, ok := cs.channelSlug(ctx, w, req.TeamID, req.Name, 0)
+	if !ok {
+		return
+	}
 
 	// Begin transaction
 	tx, err := cs.DB.BeginTx(ctx, nil)
 	if err != nil {
-		cs.Log.Error("Failed to begin transaction", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
@@ -111,58 +168,42 @@ func (cs *ChannelService) CreateChannel(w http.ResponseWriter, r *http.Request)
 
 	// Insert channel into database
 	currentTime := time.Now().UTC().Unix()
-	query := `
-		INSERT INTO channels (team_id, channel_name, description, is_private, created_by, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`
-	result, err := tx.ExecContext(ctx, query, req.TeamID, req.Name, req.Description, req.IsPrivate, userID, currentTime, currentTime)
-	if err != nil {
-		cs.Log.Error("Failed to create channel", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to create channel")
-		return
+	newChannel := models.Channel{
+		TeamID:      req.TeamID,
+		Name:        req.Name,
+		Slug:        slug,
+		Description: req.Description,
+		IsPrivate:   req.IsPrivate,
+		CreatedBy:   userID,
+		CreatedAt:   currentTime,
+		UpdatedAt:   currentTime,
 	}
-
-	// Get the ID of the newly created channel
-	channelID, err := result.LastInsertId()
+	qtx := cs.Queries.WithTx(tx)
+	newChannel.ChannelID, err = qtx.CreateChannel(ctx, newChannel)
 	if err != nil {
-		cs.Log.Error("Failed to get channel ID", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to get channel ID")
+		cs.Log.WithContext(ctx).Error("Failed to create channel", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create channel")
 		return
 	}
+	channelID := newChannel.ChannelID
 
 	// Create channel-user relationship (add creator as channel admin)
-	query = `
-		INSERT INTO channel_members (channel_id, user_id, role, joined_at, invited_by) 
-		VALUES (?, ?, ?, ?, ?)
-	`
-	_, err = tx.ExecContext(ctx, query, channelID, userID, 1, currentTime, userID)
+	err = qtx.AddChannelMember(ctx, channelID, userID, channelRoleAdmin, currentTime, userID)
 	if err != nil {
-		cs.Log.Error("Failed to add user as channel admin", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to add user as channel admin", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to add user to channel")
 		return
 	}
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		cs.Log.Error("Failed to commit transaction", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
-	// Return the created channel
-	newChannel := models.Channel{
-		ChannelID:   channelID,
-		TeamID:      req.TeamID,
-		Name:        req.Name,
-		Description: req.Description,
-		IsPrivate:   req.IsPrivate,
-		CreatedBy:   userID,
-		CreatedAt:   currentTime,
-		UpdatedAt:   currentTime,
-	}
-
 	// Audit log
-	cs.Log.Info("Channel created", "channel_id", channelID, "team_id", req.TeamID, "user_id", userID)
+	cs.Log.WithContext(ctx).Info("Channel created", "channel_id", channelID, "team_id", req.TeamID, "user_id", userID)
 
 	respondWithJSON(w, http.StatusCreated, newChannel)
 }
@@ -174,7 +215,7 @@ func (cs *ChannelService) GetTeamChannels(w http.ResponseWriter, r *http.Request
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		cs.Log.Error("Failed to extract user details from context")
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -182,7 +223,7 @@ func (cs *ChannelService) GetTeamChannels(w http.ResponseWriter, r *http.Request
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid user ID in token", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
@@ -191,23 +232,21 @@ func (cs *ChannelService) GetTeamChannels(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	teamID, err := strconv.ParseInt(vars["team_id"], 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid team ID in URL", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid team ID in URL", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
 		return
 	}
 
 	// Verify user is a member of the team
-	var isMember bool
-	memberQuery := `SELECT EXISTS(SELECT 1 FROM user_teams_mapper WHERE team_id = ? AND user_id = ?)`
-	err = cs.DB.QueryRowContext(ctx, memberQuery, teamID, userID).Scan(&isMember)
+	isMember, err := cs.Queries.IsTeamMember(ctx, teamID, userID)
 	if err != nil {
-		cs.Log.Error("Failed to check team membership", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to verify team membership")
 		return
 	}
 
 	if !isMember {
-		cs.Log.Warn("Unauthorized channel access attempt", "team_id", teamID, "user_id", userID)
+		cs.Log.WithContext(ctx).Warn("Unauthorized channel access attempt", "team_id", teamID, "user_id", userID)
 		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
 		return
 	}
@@ -224,57 +263,19 @@ func (cs *ChannelService) GetTeamChannels(w http.ResponseWriter, r *http.Request
 	offset := (page - 1) * perPage
 
 	// Count total channels for pagination
-	var totalCount int
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM channels c
-		WHERE c.team_id = ? AND (
-			c.is_private = 0 OR
-			EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = c.id AND cm.user_id = ?)
-		)
-	`
-	err = cs.DB.QueryRowContext(ctx, countQuery, teamID, userID).Scan(&totalCount)
-	if err != nil {
-		cs.Log.Error("Failed to count channels", "error", err)
+	totalCount, err := cs.Queries.Reads().CountVisibleTeamChannels(ctx, teamID, userID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to count channels", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get channels")
 		return
 	}
 
-	// Query to get channels with pagination
-	query := `
-		SELECT c.id, c.team_id, c.name, c.description, c.is_private, c.created_by, c.created_at, c.updated_at
-		FROM channels c
-		WHERE c.team_id = ? AND (
-			c.is_private = 0 OR
-			EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = c.id AND cm.user_id = ?)
-		)
-		ORDER BY c.created_at DESC
-		LIMIT ? OFFSET ?
-	`
-	rows, err := cs.DB.QueryContext(ctx, query, teamID, userID, perPage, offset)
+	channels, err := cs.Queries.Reads().ListVisibleTeamChannels(ctx, teamID, userID, perPage, offset)
 	if err != nil {
-		cs.Log.Error("Failed to query channels", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to query channels", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get channels")
 		return
 	}
-	defer rows.Close()
-
-	var channels []models.Channel
-	for rows.Next() {
-		var c models.Channel
-		if err := rows.Scan(&c.ChannelID, &c.TeamID, &c.Name, &c.Description, &c.IsPrivate, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt); err != nil {
-			cs.Log.Error("Failed to scan channel row", "error", err)
-			respondWithError(w, http.StatusInternalServerError, "Failed to process channels data")
-			return
-		}
-		channels = append(channels, c)
-	}
-
-	if err := rows.Err(); err != nil {
-		cs.Log.Error("Error iterating channels rows", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Error processing channels data")
-		return
-	}
 
 	// Build response
 	response := PaginationResponse{
@@ -284,7 +285,24 @@ func (cs *ChannelService) GetTeamChannels(w http.ResponseWriter, r *http.Request
 		PerPage:    perPage,
 	}
 
-	cs.Log.Info("Channels fetched from database", "team_id", teamID, "user_id", userID, "count", len(channels))
+	// Trim the payload when the client asked for specific fields
+	if selection := utils.ParseFieldSelection(r, models.ChannelCompactFields); selection != nil {
+		trimmed, err := selection.Apply(channels)
+		if err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to apply field selection", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Error processing channels data")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"channels":    trimmed,
+			"total_count": response.TotalCount,
+			"page":        response.Page,
+			"per_page":    response.PerPage,
+		})
+		return
+	}
+
+	cs.Log.WithContext(ctx).Info("Channels fetched from database", "team_id", teamID, "user_id", userID, "count", len(channels))
 	respondWithJSON(w, http.StatusOK, response)
 }
 
@@ -295,7 +313,7 @@ func (cs *ChannelService) GetChannel(w http.ResponseWriter, r *http.Request) {
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		cs.Log.Error("Failed to extract user details from context")
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -303,57 +321,97 @@ func (cs *ChannelService) GetChannel(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid user ID in token", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	// Get channel ID from URL parameters
 	vars := mux.Vars(r)
-	channelID, err := strconv.ParseInt(vars["id"], 10, 64)
+	channelID, err := strconv.ParseInt(vars["channel_id"], 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid channel ID in URL", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid channel ID in URL", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
 		return
 	}
 
+	cs.writeChannel(w, r, userID, channelID)
+}
+
+// GetChannelBySlug retrieves a team channel by its slug. The slug is
+// normalized first, so any casing of the channel's name finds it.
+func (cs *ChannelService) GetChannelBySlug(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := cs.requestUser(w, r)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	teamID, err := strconv.ParseInt(vars["team_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	channelID, err := cs.Queries.GetTeamChannelIDBySlug(ctx, teamID, utils.Slugify(vars["slug"]))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Channel not found or you don't have access")
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to look up channel slug", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve channel details")
+		return
+	}
+
+	cs.writeChannel(w, r, userID, channelID)
+}
+
+// writeChannel answers with a channel the user is a member of
+func (cs *ChannelService) writeChannel(w http.ResponseWriter, r *http.Request, userID, channelID int64) {
+	ctx := r.Context()
+
 	// Check if channel exists and user has access
-	var channel models.Channel
-	var userRole string
-
-	query := `
-		SELECT c.channel_id, c.team_id, c.name, c.description, c.is_private, c.created_by, c.created_at, c.updated_at , CM.role
-		FROM channels c
-		INNER JOIN channel_members CM ON c.channel_id = CM.channel_id
-		WHERE c.channel_id = ? AND CM.user_id = ?
-	`
-	err = cs.DB.QueryRowContext(ctx, query, channelID, userID).Scan(
-		&channel.ChannelID, &channel.TeamID, &channel.Name, &channel.Description,
-		&channel.IsPrivate, &channel.CreatedBy, &channel.CreatedAt, &channel.UpdatedAt, &userRole,
-	)
+	channel, role, err := cs.Queries.GetMemberChannel(ctx, channelID, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			cs.Log.Warn("Channel not found or access denied", "channel_id", channelID, "user_id", userID)
+			cs.Log.WithContext(ctx).Warn("Channel not found or access denied", "channel_id", channelID, "user_id", userID)
 			respondWithError(w, http.StatusNotFound, "Channel not found or you don't have access")
 		} else {
-			cs.Log.Error("Failed to get channel details", "error", err)
+			cs.Log.WithContext(ctx).Error("Failed to get channel details", "error", err)
 			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve channel details")
 		}
 		return
 	}
 
-	// If no role found and channel is public, user is a viewer
-	if errors.Is(err, sql.ErrNoRows) && !channel.IsPrivate {
-		userRole = "viewer"
+	userRole := "member"
+	if role == channelRoleAdmin {
+		userRole = "admin"
+	}
+	canPost, err := cs.Queries.CanPost(ctx, channelID, userID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to check posting permission", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve channel details")
+		return
+	}
+
+	// Role changes and posting grants do not touch updated_at, so they are
+	// part of the tag and no Last-Modified is given
+	etag := utils.ETag("channel", channel.ChannelID, channel.UpdatedAt, channel.ArchivedAt, userRole, canPost)
+	if utils.NotModified(w, r, etag, 0) {
+		return
 	}
 
 	// Return channel with user's role
 	response := struct {
 		Channel  models.Channel `json:"channel"`
 		UserRole string         `json:"user_role"`
+		CanPost  bool           `json:"can_post"`
 	}{
 		Channel:  channel,
 		UserRole: userRole,
+		CanPost:  canPost,
 	}
 
 	respondWithJSON(w, http.StatusOK, response)
@@ -366,7 +424,7 @@ func (cs *ChannelService) UpdateChannel(w http.ResponseWriter, r *http.Request)
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		cs.Log.Error("Failed to extract user details from context")
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -374,16 +432,16 @@ func (cs *ChannelService) UpdateChannel(w http.ResponseWriter, r *http.Request)
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid user ID in token", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	// Get channel ID from URL parameters
 	vars := mux.Vars(r)
-	channelID, err := strconv.ParseInt(vars["id"], 10, 64)
+	channelID, err := strconv.ParseInt(vars["channel_id"], 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid channel ID in URL", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid channel ID in URL", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
 		return
 	}
@@ -391,74 +449,86 @@ func (cs *ChannelService) UpdateChannel(w http.ResponseWriter, r *http.Request)
 	// Parse and validate request body
 	var req UpdateChannelRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		cs.Log.Error("Failed to decode request body", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if ttl := req.MessageTTLSeconds; ttl != nil && *ttl != 0 && (*ttl < minMessageTTL || *ttl > maxMessageTTL) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("message_ttl_seconds must be 0 or between %d and %d", minMessageTTL, maxMessageTTL))
+		return
+	}
 
 	// Check if user has admin role in the channel
-	var role int
-	roleQuery := `SELECT role FROM channel_members WHERE channel_id = ? AND user_id = ?`
-	err = cs.DB.QueryRowContext(ctx, roleQuery, channelID, userID).Scan(&role)
+	role, err := cs.Queries.GetChannelRole(ctx, channelID, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			cs.Log.Warn("Unauthorized channel update attempt", "channel_id", channelID, "user_id", userID)
+			cs.Log.WithContext(ctx).Warn("Unauthorized channel update attempt", "channel_id", channelID, "user_id", userID)
 			respondWithError(w, http.StatusForbidden, "You don't have permission to update this channel")
 		} else {
-			cs.Log.Error("Failed to check channel permissions", "error", err)
+			cs.Log.WithContext(ctx).Error("Failed to check channel permissions", "error", err)
 			respondWithError(w, http.StatusInternalServerError, "Failed to check permissions")
 		}
 		return
 	}
 
 	// Only admins can update channel details
-	if role != 1 {
-		cs.Log.Warn("Insufficient permissions for channel update", "channel_id", channelID, "user_id", userID, "role", role)
+	if role != channelRoleAdmin {
+		cs.Log.WithContext(ctx).Warn("Insufficient permissions for channel update", "channel_id", channelID, "user_id", userID, "role", role)
 		respondWithError(w, http.StatusForbidden, "You don't have permission to update this channel")
 		return
 	}
 
-	// Update channel details
-	currentTime := time.Now().UTC().Unix()
-	updateQuery := `UPDATE channels SET name = ?, description = ?, updated_at = ? WHERE channl_id = ?`
-	result, err := cs.DB.ExecContext(ctx, updateQuery, req.Name, req.Description, currentTime, channelID)
+	channel, err := cs.Queries.GetChannel(ctx, channelID)
 	if err != nil {
-		cs.Log.Error("Failed to update channel", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to get channel", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to update channel")
 		return
 	}
+	slug, ok := cs.channelSlug(ctx, w, channel.TeamID, req.Name, channelID)
+	if !ok {
+		return
+	}
 
-	rowsAffected, err := result.RowsAffected()
+	// Update channel details
+	currentTime := time.Now().UTC().Unix()
+	rowsAffected, err := cs.Queries.UpdateChannel(ctx, channelID, req.Name, slug, req.Description, currentTime)
 	if err != nil {
-		cs.Log.Error("Failed to get rows affected", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to verify update")
+		cs.Log.WithContext(ctx).Error("Failed to update channel", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update channel")
 		return
 	}
 
 	if rowsAffected == 0 {
-		cs.Log.Warn("Channel not found for update", "channel_id", channelID)
+		cs.Log.WithContext(ctx).Warn("Channel not found for update", "channel_id", channelID)
 		respondWithError(w, http.StatusNotFound, "Channel not found")
 		return
 	}
+	if req.AnnouncementOnly != nil {
+		if _, err := cs.Queries.SetAnnouncementOnly(ctx, channelID, *req.AnnouncementOnly, currentTime); err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to update channel posting setting", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update channel")
+			return
+		}
+	}
+	if req.MessageTTLSeconds != nil && *req.MessageTTLSeconds != channel.MessageTTLSeconds {
+		if err := cs.Queries.SetMessageTTL(ctx, channelID, *req.MessageTTLSeconds, currentTime); err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to update channel message TTL", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update channel")
+			return
+		}
+		cs.Log.WithContext(ctx).Audit("Channel message TTL changed", "channel_id", channelID, "user_id", userID, "ttl_seconds", *req.MessageTTLSeconds)
+	}
 
 	// Get the updated channel
-	var updatedChannel models.Channel
-	query := `
-		SELECT channel_id, team_id, name, description, is_private, created_by, created_at, updated_at
-		FROM channels WHERE id = ?
-	`
-	err = cs.DB.QueryRowContext(ctx, query, channelID).Scan(
-		&updatedChannel.ChannelID, &updatedChannel.TeamID, &updatedChannel.Name, &updatedChannel.Description,
-		&updatedChannel.IsPrivate, &updatedChannel.CreatedBy, &updatedChannel.CreatedAt, &updatedChannel.UpdatedAt,
-	)
-	if err != nil {
-		cs.Log.Error("Failed to get updated channel", "error", err)
+	updatedChannel, err := cs.Queries.GetChannel(ctx, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get updated channel", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve updated channel")
 		return
 	}
 
 	// Log the update
-	cs.Log.Info("Channel updated", "channel_id", channelID, "updated_by", userID)
+	cs.Log.WithContext(ctx).Info("Channel updated", "channel_id", channelID, "updated_by", userID)
 
 	respondWithJSON(w, http.StatusOK, updatedChannel)
 }
@@ -469,7 +539,7 @@ func (cs *ChannelService) SubscribeChannel(w http.ResponseWriter, r *http.Reques
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		cs.Log.Error("Failed to extract user details from context")
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -477,7 +547,7 @@ func (cs *ChannelService) SubscribeChannel(w http.ResponseWriter, r *http.Reques
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid user ID in token", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
@@ -486,69 +556,89 @@ func (cs *ChannelService) SubscribeChannel(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	channelID, err := strconv.ParseInt(vars["channel_id"], 10, 64)
 	if err != nil {
-		cs.Log.Error("Invalid channel ID in URL", "error", err)
+		cs.Log.WithContext(ctx).Error("Invalid channel ID in URL", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
 		return
 	}
 
-	var memeberID int64
-	fmt.Println("userID", userID)
-	fmt.Println("channelID", channelID)
-	sqlQuery := `Select channel_member_id from channel_members where  user_id=? and channel_id = ?`
-	err = cs.DB.QueryRowContext(ctx, sqlQuery, userID, channelID).Scan(&memeberID)
+	alreadyMember, err := cs.Queries.IsChannelMember(ctx, channelID, userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			// User is not in the channel, which is fine - we'll add them
-		} else {
-			// Some other database error occurred
-			cs.Log.Error("Database error checking channel membership", "error", err)
-			respondWithError(w, http.StatusInternalServerError, "Failed to check channel membership")
-			return
-		}
-	} else {
-		// User already exists in the channel
+		cs.Log.WithContext(ctx).Error("Database error checking channel membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check channel membership")
+		return
+	}
+	if alreadyMember {
 		respondWithError(w, http.StatusConflict, "User is already a member of this channel")
 		return
 	}
-	//check if user already exists in the team , if yes then add or else throw error that user is not present in team
-	var channelUserData models.ChannelUserDataStruct
-	memberQuery := `SELECT CM.channel_id , UTM.user_id , T.team_id , U.first_name , U.last_name  , CM.channel_name
-					FROM channels CM
-					INNER JOIN teams T on CM.team_id = T.team_id
-					INNER JOIN user_teams_mapper UTM on  UTM.team_id = CM.team_id
-					INNER JOIN users U on U.user_id = UTM.user_id
-					WHERE CM.channel_id = ? and UTM.user_id = ?`
-	err = cs.DB.QueryRowContext(ctx, memberQuery, channelID, userID).Scan(&channelUserData.ChannelID, &channelUserData.UserID, &channelUserData.TeamID, &channelUserData.FirstName, &channelUserData.LastName, &channelUserData.ChannelName)
+	// Only members of the channel's team may join it
+	channelUserData, err := cs.Queries.GetJoinableChannel(ctx, channelID, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			cs.Log.Warn("Unauthorized channel join attempt", "channel_id", channelID, "user_id", userID)
+			cs.Log.WithContext(ctx).Warn("Unauthorized channel join attempt", "channel_id", channelID, "user_id", userID)
 			respondWithError(w, http.StatusForbidden, "You don't have permission to join this channel")
 			return
 		}
-		cs.Log.Error("Failed to check channel membership", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to check membership")
 		return
 	}
+	ctx = logger.ContextWithFields(ctx, "team_id", channelUserData.TeamID)
+	channel, err := cs.Queries.GetChannel(ctx, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get channel", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check membership")
+		return
+	}
+	if channel.ArchivedAt > 0 {
+		respondWithError(w, http.StatusConflict, "Archived channels can't be joined")
+		return
+	}
 	currentTime := time.Now().UTC().Unix()
 
+	tx, err := cs.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
 	// Subscribe user to channel
-	subscribeQuery := `INSERT INTO channel_members (channel_id, user_id ,role, joined_at) VALUES (?,?,?,?)`
-	_, err = cs.DB.ExecContext(ctx, subscribeQuery, channelID, userID, 2, currentTime)
+	err = cs.Queries.WithTx(tx).JoinChannel(ctx, channelID, userID, channelRoleMember, currentTime)
 	if err != nil {
-		cs.Log.Error("Failed to subscribe user to channel", "error", err)
+		cs.Log.WithContext(ctx).Error("Failed to subscribe user to channel", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to subscribe user")
 		return
 	}
+	// Lets open member lists add the user without refetching
+	joined := events.ChannelMemberJoined{ChannelID: channelID, TeamID: channelUserData.TeamID, UserID: userID, JoinedAt: currentTime}
+	if err := outbox.Write(ctx, tx, channelID, events.TypeChannelMemberJoined, joined); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to write member joined event", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to subscribe user")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	outbox.Notify()
 
-	ms := messageService.NewMessageService()
+	// The join notice is read by the whole channel, so it is in the team's
+	// language rather than the joining user's
+	locale, err := i18n.ChannelLocale(ctx, cs.DB, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Warn("Failed to get channel locale", "error", err, "channel_id", channelID)
+	}
 	msg := models.MessageBody{
 		ChannelID:   channelID,
 		UserID:      userID,
-		Content:     channelUserData.FirstName + " has joined " + channelUserData.ChannelName,
+		Content:     i18n.Text(locale, "channel.joined", "name", channelUserData.FirstName, "channel", channelUserData.ChannelName),
 		MessageTime: currentTime,
 	}
 
-	_, err = ms.SaveMessage(ctx, msg)
+	_, err = cs.Messages.SaveMessage(ctx, msg)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Failed to insert message")
 		return
@@ -577,6 +667,60 @@ func (cs *ChannelService) SubscribeChannel(w http.ResponseWriter, r *http.Reques
 	respondWithJSON(w, http.StatusOK, response)
 }
 
+// MarkChannelRead moves the user's read cursor to the latest message in the channel
+func (cs *ChannelService) MarkChannelRead(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Extract user details from context
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+
+	// Extract user ID from token
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	// Get channel ID from URL parameters
+	vars := mux.Vars(r)
+	channelID, err := strconv.ParseInt(vars["channel_id"], 10, 64)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Invalid channel ID in URL", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+
+	moved, err := cs.Queries.MarkChannelRead(ctx, channelID, userID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to mark channel as read", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to mark channel as read")
+		return
+	}
+
+	// MySQL reports zero affected rows when the cursor is already current, so
+	// only treat it as an error when the user is not a member
+	if !moved {
+		isMember, err := cs.Queries.IsChannelMember(ctx, channelID, userID)
+		if err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to check channel membership")
+			return
+		}
+		if !isMember {
+			respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Channel marked as read"})
+}
+
 // Helper functions for HTTP responses
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
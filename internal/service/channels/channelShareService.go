@@ -0,0 +1,235 @@
+package channelService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/queries"
+)
+
+// ShareChannelRequest represents the request body for sharing a channel
+// with another team
+type ShareChannelRequest struct {
+	TeamID int64 `json:"team_id"`
+}
+
+// ShareChannel invites a second team to share a channel. Owners of the
+// channel's team can share it; the share is active once an owner of the
+// invited team accepts it. A channel is shared with one other team at most.
+func (cs *ChannelService) ShareChannel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, _, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	channel, ok := cs.hostOwnerChannel(w, r, channelID, userID)
+	if !ok {
+		return
+	}
+
+	var req ShareChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.TeamID == channel.TeamID {
+		respondWithError(w, http.StatusBadRequest, "A channel can't be shared with its own team")
+		return
+	}
+	if channel.ArchivedAt > 0 {
+		respondWithError(w, http.StatusBadRequest, "Archived channels can't be shared")
+		return
+	}
+	owner, err := cs.Queries.GetTeam(ctx, channel.TeamID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get team", "error", err, "team_id", channel.TeamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to share channel")
+		return
+	}
+	// Teams of other workspaces answer like missing ones, so their IDs
+	// cannot be probed
+	target, err := cs.Queries.GetTeam(ctx, req.TeamID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && target.WorkspaceID != owner.WorkspaceID) {
+		respondWithError(w, http.StatusNotFound, "Team not found")
+		return
+	} else if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get team", "error", err, "team_id", req.TeamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to share channel")
+		return
+	}
+
+	shares, err := cs.Queries.ListChannelShares(ctx, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to list channel shares", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to share channel")
+		return
+	}
+	if len(shares) > 0 {
+		respondWithError(w, http.StatusConflict, "This channel is already shared with another team")
+		return
+	}
+
+	if err := cs.Queries.CreateShare(ctx, channelID, req.TeamID, userID, time.Now().UTC().Unix()); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to share channel", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to share channel")
+		return
+	}
+	share, err := cs.Queries.GetShare(ctx, channelID, req.TeamID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get channel share", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to share channel")
+		return
+	}
+
+	cs.Log.WithContext(ctx).Audit("Channel share offered", "channel_id", channelID, "team_id", channel.TeamID, "user_id", userID, "shared_team_id", req.TeamID)
+	respondWithJSON(w, http.StatusCreated, share)
+}
+
+// ListChannelShares returns the team a channel is shared with or invited
+// to. Any member of the channel can list them.
+func (cs *ChannelService) ListChannelShares(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	shares, err := cs.Queries.ListChannelShares(ctx, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to list channel shares", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get channel shares")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"channel_id": channelID, "shares": shares})
+}
+
+// UnshareChannel ends a share or withdraws an invitation. Owners of either
+// team can do so. Members who were only in the channel through the other
+// team are removed from it.
+func (cs *ChannelService) UnshareChannel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, _, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	teamID, err := strconv.ParseInt(mux.Vars(r)["team_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+
+	share, err := cs.Queries.GetShare(ctx, channelID, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "This channel is not shared with this team")
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get channel share", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unshare channel")
+		return
+	}
+	owner := false
+	for _, id := range []int64{share.HostTeamID, share.TeamID} {
+		role, err := cs.Queries.GetTeamRole(ctx, id, userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			cs.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to verify team membership")
+			return
+		}
+		owner = owner || (err == nil && role == queries.TeamRoleOwner)
+	}
+	if !owner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to unshare this channel")
+		return
+	}
+
+	tx, err := cs.DB.BeginTx(ctx, nil)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	qtx := cs.Queries.WithTx(tx)
+	if _, err := qtx.DeleteShare(ctx, channelID, teamID); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to delete channel share", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unshare channel")
+		return
+	}
+	stranded, err := qtx.ListStrandedMembers(ctx, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to list stranded channel members", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unshare channel")
+		return
+	}
+	currentTime := time.Now().UTC().Unix()
+	for _, memberID := range stranded {
+		if err := qtx.RemoveChannelMember(ctx, channelID, memberID); err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to remove channel member", "error", err, "channel_id", channelID, "member_id", memberID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to unshare channel")
+			return
+		}
+		left := events.ChannelMemberLeft{ChannelID: channelID, TeamID: share.HostTeamID, UserID: memberID, LeftAt: currentTime, RemovedBy: userID}
+		if err := outbox.Write(ctx, tx, channelID, events.TypeChannelMemberLeft, left); err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to write member left event", "error", err, "channel_id", channelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to unshare channel")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if len(stranded) > 0 {
+		outbox.Notify()
+	}
+
+	cs.Log.WithContext(ctx).Audit("Channel unshared", "channel_id", channelID, "team_id", share.HostTeamID, "user_id", userID, "shared_team_id", teamID, "removed_members", len(stranded))
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Channel unshared", "removed_members": len(stranded)})
+}
+
+// hostOwnerChannel loads a channel and checks the user owns its team
+func (cs *ChannelService) hostOwnerChannel(w http.ResponseWriter, r *http.Request, channelID, userID int64) (models.Channel, bool) {
+	ctx := r.Context()
+
+	channel, err := cs.Queries.GetChannel(ctx, channelID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Channel not found")
+		return models.Channel{}, false
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get channel", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get channel")
+		return models.Channel{}, false
+	}
+	role, err := cs.Queries.GetTeamRole(ctx, channel.TeamID, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cs.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify team membership")
+		return models.Channel{}, false
+	}
+	if err != nil || role != queries.TeamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to share this channel")
+		return models.Channel{}, false
+	}
+	return channel, true
+}
@@ -0,0 +1,189 @@
+package channelService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/export"
+)
+
+// CreateChannelExportRequest starts a background export. Format is "json"
+// (the default) or "csv".
+type CreateChannelExportRequest struct {
+	Format string `json:"format"`
+}
+
+// ExportChannel streams the channel's full message history as JSON or CSV.
+// Channels too large to export in the request answer 409; create a
+// background export for them with CreateChannelExport. Only channel admins
+// can export.
+func (cs *ChannelService) ExportChannel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to export this channel")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatJSON
+	}
+	if format != export.FormatJSON && format != export.FormatCSV {
+		respondWithError(w, http.StatusBadRequest, export.ErrInvalidFormat.Error())
+		return
+	}
+
+	fits, err := cs.Exports.Fits(ctx, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to count channel messages", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to export channel")
+		return
+	}
+	if !fits {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("This channel is too large to export in the request; create a background export with POST /channel/%d/exports", channelID))
+		return
+	}
+
+	fileName := fmt.Sprintf("channel-%d-%s.%s", channelID, time.Now().UTC().Format("20060102"), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+
+	// Headers are already sent once rows are written, so a failure midway can
+	// only be logged; the client sees a truncated file
+	n, err := export.Write(ctx, cs.DB, w, channelID, format)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Channel export interrupted", "error", err, "channel_id", channelID, "messages", n)
+		return
+	}
+	cs.Log.WithContext(ctx).Audit("Channel exported", "channel_id", channelID, "format", format, "messages", n)
+}
+
+// CreateChannelExport starts a background export of the channel and answers
+// 202 with its status. The requester is emailed a download link when it is
+// ready. A pending export in the same format, or one finished within the
+// last hour, is returned with 200 instead of starting another. Only channel
+// admins can export.
+func (cs *ChannelService) CreateChannelExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to export this channel")
+		return
+	}
+
+	req := CreateChannelExportRequest{Format: export.FormatJSON}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		if req.Format == "" {
+			req.Format = export.FormatJSON
+		}
+	}
+
+	job, created, err := cs.Exports.Enqueue(ctx, channelID, userID, req.Format)
+	if errors.Is(err, export.ErrInvalidFormat) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to queue channel export", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to export channel")
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/channel/%d/exports/%d", channelID, job.ExportID))
+	if !created {
+		respondWithJSON(w, http.StatusOK, job)
+		return
+	}
+	cs.Log.WithContext(ctx).Audit("Channel export queued", "channel_id", channelID, "export_id", job.ExportID, "format", job.Format)
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// GetChannelExport returns the status of a background export
+func (cs *ChannelService) GetChannelExport(w http.ResponseWriter, r *http.Request) {
+	job, ok := cs.exportJob(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// DownloadChannelExport streams a finished background export
+func (cs *ChannelService) DownloadChannelExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	job, ok := cs.exportJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != export.StatusReady {
+		respondWithError(w, http.StatusConflict, "This export is not ready")
+		return
+	}
+
+	object, err := cs.Exports.Open(ctx, job)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to open channel export", "error", err, "export_id", job.ExportID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to read export")
+		return
+	}
+	defer object.Close()
+
+	fileName := fmt.Sprintf("channel-%d-%s.%s", job.ChannelID, time.Unix(job.CompletedAt, 0).UTC().Format("20060102"), job.Format)
+	w.Header().Set("Content-Type", export.ContentType(job.Format))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+
+	http.ServeContent(w, r, fileName, object.ModTime(), object)
+}
+
+// exportJob loads the export named in the URL for a channel admin
+func (cs *ChannelService) exportJob(w http.ResponseWriter, r *http.Request) (export.Job, bool) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return export.Job{}, false
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to export this channel")
+		return export.Job{}, false
+	}
+	exportID, err := strconv.ParseInt(mux.Vars(r)["export_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid export ID")
+		return export.Job{}, false
+	}
+
+	job, err := cs.Exports.Get(ctx, channelID, exportID)
+	if errors.Is(err, export.ErrJobNotFound) {
+		respondWithError(w, http.StatusNotFound, "Export not found")
+		return export.Job{}, false
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get channel export", "error", err, "export_id", exportID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get export")
+		return export.Job{}, false
+	}
+	return job, true
+}
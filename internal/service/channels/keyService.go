@@ -0,0 +1,31 @@
+package channelService
+
+import (
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/e2e"
+)
+
+// GetChannelKeys returns the published device keys of every member of the
+// channel, so a sender can encrypt a message to all of them
+func (cs *ChannelService) GetChannelKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	keys, err := e2e.ChannelKeys(ctx, cs.DB, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to list channel device keys", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get device keys")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"channel_id": channelID, "keys": keys})
+}
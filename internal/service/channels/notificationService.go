@@ -0,0 +1,72 @@
+package channelService
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// NotificationLevelRequest represents the request body for changing how a
+// channel notifies the user
+type NotificationLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// GetNotificationLevel returns the user's notification level for a channel:
+// all, mentions or muted
+func (cs *ChannelService) GetNotificationLevel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	level, err := cs.Queries.GetNotifyLevel(ctx, channelID, userID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get notification level", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get notification level")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"level": level})
+}
+
+// SetNotificationLevel changes how a channel notifies the user. Muted
+// channels add nothing to the unread and mention totals and send no digest
+// or mention emails; mentions-only channels count mentions alone.
+func (cs *ChannelService) SetNotificationLevel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	var req NotificationLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !models.ValidNotifyLevel(req.Level) {
+		respondWithError(w, http.StatusBadRequest, "level must be one of all, mentions, muted")
+		return
+	}
+
+	if err := cs.Queries.SetNotifyLevel(ctx, channelID, userID, req.Level); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to set notification level", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to set notification level")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"level": req.Level})
+}
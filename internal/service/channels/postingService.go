@@ -0,0 +1,106 @@
+package channelService
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ListPostGrants returns the members allowed to post in an announcement
+// channel besides its admins
+func (cs *ChannelService) ListPostGrants(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	grants, err := cs.Queries.ListPostGrants(ctx, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to list posting grants", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list posting grants")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"grants": grants})
+}
+
+// GrantPosting lets a member post in an announcement channel. Only channel
+// admins can grant it.
+func (cs *ChannelService) GrantPosting(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	adminID, channelID, memberID, ok := cs.postGrantAccess(w, r)
+	if !ok {
+		return
+	}
+	memberRole, err := cs.channelRole(ctx, channelID, memberID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check channel membership")
+		return
+	}
+	if memberRole == 0 {
+		respondWithError(w, http.StatusBadRequest, "The user is not a member of this channel")
+		return
+	}
+
+	if err := cs.Queries.GrantPosting(ctx, channelID, memberID, adminID, time.Now().UTC().Unix()); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to grant posting", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to grant posting")
+		return
+	}
+
+	cs.Log.WithContext(ctx).Audit("Channel posting granted", "channel_id", channelID, "user_id", adminID, "member_id", memberID)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Posting granted"})
+}
+
+// RevokePosting removes a member's posting grant
+func (cs *ChannelService) RevokePosting(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	adminID, channelID, memberID, ok := cs.postGrantAccess(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := cs.Queries.RevokePosting(ctx, channelID, memberID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to revoke posting", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke posting")
+		return
+	}
+	if !revoked {
+		respondWithError(w, http.StatusNotFound, "The user has no posting grant in this channel")
+		return
+	}
+
+	cs.Log.WithContext(ctx).Audit("Channel posting revoked", "channel_id", channelID, "user_id", adminID, "member_id", memberID)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Posting revoked"})
+}
+
+// postGrantAccess checks that the user is an admin of the channel and reads
+// the member the grant is for
+func (cs *ChannelService) postGrantAccess(w http.ResponseWriter, r *http.Request) (adminID, channelID, memberID int64, ok bool) {
+	adminID, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage posting in this channel")
+		return 0, 0, 0, false
+	}
+	memberID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, 0, 0, false
+	}
+	return adminID, channelID, memberID, true
+}
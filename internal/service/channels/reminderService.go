@@ -0,0 +1,139 @@
+package channelService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/bots"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+type createReminderRequest struct {
+	ChannelID int64  `json:"channel_id"`
+	Text      string `json:"text"`
+	// RemindAt is a Unix time within the next year
+	RemindAt int64 `json:"remind_at"`
+}
+
+// CreateReminder schedules a reminder in a channel the user belongs to, the
+// same as /remind. The Reminder Bot posts it there when it is due.
+func (cs *ChannelService) CreateReminder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := cs.requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req createReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	role, err := cs.channelRole(ctx, req.ChannelID, userID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check channel membership")
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	reminder, err := bots.CreateReminder(ctx, userID, req.ChannelID, req.Text, time.Unix(req.RemindAt, 0))
+	if errors.Is(err, bots.ErrInvalidReminder) || errors.Is(err, bots.ErrTooManySchedules) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to create reminder", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create reminder")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, reminder)
+}
+
+// ListReminders returns the user's pending reminders, optionally only those
+// in ?channel_id
+func (cs *ChannelService) ListReminders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := cs.requestUser(w, r)
+	if !ok {
+		return
+	}
+	var channelID int64
+	if v := r.URL.Query().Get("channel_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+			return
+		}
+		channelID = id
+	}
+
+	reminders, err := bots.ListReminders(ctx, userID, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to list reminders", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list reminders")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"reminders": reminders})
+}
+
+// CancelReminder deletes one of the user's pending reminders
+func (cs *ChannelService) CancelReminder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, ok := cs.requestUser(w, r)
+	if !ok {
+		return
+	}
+	reminderID, err := strconv.ParseInt(mux.Vars(r)["reminder_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid reminder ID")
+		return
+	}
+
+	err = bots.CancelReminder(ctx, userID, reminderID)
+	if errors.Is(err, bots.ErrReminderNotFound) {
+		respondWithError(w, http.StatusNotFound, "Reminder not found")
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to cancel reminder", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to cancel reminder")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Reminder cancelled"})
+}
+
+// requestUser reads the user ID from the request's token
+func (cs *ChannelService) requestUser(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	ctx := r.Context()
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,339 @@
+package channelService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/actiontoken"
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/mailer"
+)
+
+// actionShareMessage is the action token purpose of public share links. The
+// token names the link row, so revoking the row kills the link.
+const actionShareMessage = "share_message"
+
+const (
+	defaultShareHours = 72
+	maxShareHours     = 30 * 24
+	// maxSharedReplies bounds the quote-replies shown with a shared message
+	maxSharedReplies = 20
+)
+
+// ShareLink is a public link to a message
+type ShareLink struct {
+	LinkID         int64  `json:"link_id"`
+	ChannelID      int64  `json:"channel_id"`
+	MessageID      int64  `json:"message_id"`
+	CreatedBy      int64  `json:"created_by"`
+	IncludeReplies bool   `json:"include_replies"`
+	CreatedAt      int64  `json:"created_at"`
+	ExpiresAt      int64  `json:"expires_at"`
+	RevokedAt      int64  `json:"revoked_at,omitempty"`
+	ViewCount      int64  `json:"view_count"`
+	LastViewedAt   int64  `json:"last_viewed_at,omitempty"`
+	URL            string `json:"url,omitempty"`
+}
+
+type createShareLinkRequest struct {
+	ExpiresInHours int  `json:"expires_in_hours"`
+	IncludeReplies bool `json:"include_replies"`
+}
+
+// SharedMessage is a message as shown on a public share page
+type SharedMessage struct {
+	Author    string `json:"author"`
+	Content   string `json:"content"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// SharedView is what a share link shows
+type SharedView struct {
+	ChannelName string          `json:"channel_name"`
+	Message     SharedMessage   `json:"message"`
+	Replies     []SharedMessage `json:"replies,omitempty"`
+	ExpiresAt   int64           `json:"expires_at"`
+}
+
+// CreateShareLink creates an expiring public link to a message of the
+// channel, optionally with its quote-replies. Only channel admins can share.
+func (cs *ChannelService) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to share messages from this channel")
+		return
+	}
+	messageID, err := strconv.ParseInt(mux.Vars(r)["message_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	var req createShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = defaultShareHours
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > maxShareHours {
+		respondWithError(w, http.StatusBadRequest, "expires_in_hours must be between 1 and 720")
+		return
+	}
+
+	if _, err := cs.Queries.GetChannelMessage(ctx, messageID, channelID); errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Message not found")
+		return
+	} else if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get message", "error", err, "message_id", messageID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInHours) * time.Hour
+	now := time.Now()
+	link := ShareLink{
+		ChannelID:      channelID,
+		MessageID:      messageID,
+		CreatedBy:      userID,
+		IncludeReplies: req.IncludeReplies,
+		CreatedAt:      now.Unix(),
+		ExpiresAt:      now.Add(ttl).Unix(),
+	}
+	result, err := cs.DB.ExecContext(ctx, `
+		INSERT INTO message_share_links (channel_id, message_id, created_by, include_replies, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, link.ChannelID, link.MessageID, link.CreatedBy, link.IncludeReplies, link.CreatedAt, link.ExpiresAt)
+	if err == nil {
+		link.LinkID, err = result.LastInsertId()
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to create share link", "error", err, "message_id", messageID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+
+	token, err := actiontoken.Sign(actionShareMessage, userID, link.LinkID, ttl)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to sign share link", "error", err, "link_id", link.LinkID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+	link.URL = mailer.Link("/share/message?token=" + url.QueryEscape(token))
+
+	cs.Log.WithContext(ctx).Audit("Message share link created", "link_id", link.LinkID, "message_id", messageID, "expires_at", link.ExpiresAt)
+	respondWithJSON(w, http.StatusCreated, link)
+}
+
+// ListShareLinks lists the channel's share links with their view counts.
+// Link URLs are only returned when a link is created.
+func (cs *ChannelService) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage this channel's share links")
+		return
+	}
+
+	rows, err := cs.DB.QueryContext(ctx, `
+		SELECT link_id, channel_id, message_id, created_by, include_replies, created_at, expires_at, revoked_at, view_count, last_viewed_at
+		FROM message_share_links
+		WHERE channel_id = ?
+		ORDER BY created_at DESC
+		LIMIT 200`, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to list share links", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list share links")
+		return
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		var l ShareLink
+		if err := rows.Scan(&l.LinkID, &l.ChannelID, &l.MessageID, &l.CreatedBy, &l.IncludeReplies, &l.CreatedAt, &l.ExpiresAt, &l.RevokedAt, &l.ViewCount, &l.LastViewedAt); err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to scan share link", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to list share links")
+			return
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		cs.Log.WithContext(ctx).Error("Error iterating share links", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list share links")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"share_links": links})
+}
+
+// RevokeShareLink stops a share link from working
+func (cs *ChannelService) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage this channel's share links")
+		return
+	}
+	linkID, err := strconv.ParseInt(mux.Vars(r)["link_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid link ID")
+		return
+	}
+
+	result, err := cs.DB.ExecContext(ctx, `
+		UPDATE message_share_links SET revoked_at = ?
+		WHERE link_id = ? AND channel_id = ? AND revoked_at = 0`, time.Now().Unix(), linkID, channelID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to revoke share link", "error", err, "link_id", linkID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke share link")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Share link not found")
+		return
+	}
+
+	cs.Log.WithContext(ctx).Audit("Message share link revoked", "link_id", linkID)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Share link revoked"})
+}
+
+// Share pages are opened by people without an account, so they render HTML
+// unless the client asks for JSON
+var sharePage = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Shared message</title></head>
+<body style="font-family:sans-serif;max-width:40em;margin:4em auto">
+{{if .View}}
+<p style="color:#666">Shared from #{{.View.ChannelName}}</p>
+<blockquote><strong>{{.View.Message.Author}}</strong><p style="white-space:pre-wrap">{{.View.Message.Content}}</p></blockquote>
+{{range .View.Replies}}
+<blockquote style="margin-left:3em"><strong>{{.Author}}</strong><p style="white-space:pre-wrap">{{.Content}}</p></blockquote>
+{{end}}
+{{else}}
+<p>{{.Message}}</p>
+{{end}}
+</body></html>`))
+
+type sharePageData struct {
+	View    *SharedView
+	Message string
+}
+
+func renderShare(w http.ResponseWriter, r *http.Request, code int, data sharePageData) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		if data.View == nil {
+			respondWithError(w, code, data.Message)
+			return
+		}
+		respondWithJSON(w, code, data.View)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	sharePage.Execute(w, data)
+}
+
+// ViewSharedMessage shows the message behind a share link to anyone holding
+// it, counting the view. Expired and revoked links show nothing.
+func (cs *ChannelService) ViewSharedMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, err := actiontoken.Verify(r.URL.Query().Get("token"), actionShareMessage)
+	if err != nil {
+		renderShare(w, r, http.StatusNotFound, sharePageData{Message: "This link is invalid or has expired."})
+		return
+	}
+
+	now := time.Now().Unix()
+	var channelID, messageID int64
+	var includeReplies bool
+	var expiresAt int64
+	err = cs.DB.QueryRowContext(ctx, `
+		SELECT channel_id, message_id, include_replies, expires_at
+		FROM message_share_links
+		WHERE link_id = ? AND revoked_at = 0 AND expires_at > ?`, claims.SubjectID, now).
+		Scan(&channelID, &messageID, &includeReplies, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		renderShare(w, r, http.StatusNotFound, sharePageData{Message: "This link is invalid or has expired."})
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get share link", "error", err, "link_id", claims.SubjectID)
+		renderShare(w, r, http.StatusInternalServerError, sharePageData{Message: "Something went wrong. Please try again."})
+		return
+	}
+
+	view := &SharedView{ExpiresAt: expiresAt}
+	query, args := history.Union(`
+		SELECT c.channel_name, CONCAT_WS(' ', u.first_name, u.last_name), m.content, m.message_created_at
+		FROM {messages} m
+		INNER JOIN channels c ON c.channel_id = m.channel_id
+		INNER JOIN users u ON u.user_id = m.user_id
+		WHERE m.message_id = ? AND m.channel_id = ?`, messageID, channelID)
+	err = cs.DB.QueryRowContext(ctx, query, args...).
+		Scan(&view.ChannelName, &view.Message.Author, &view.Message.Content, &view.Message.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		renderShare(w, r, http.StatusNotFound, sharePageData{Message: "This message is no longer available."})
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get shared message", "error", err, "link_id", claims.SubjectID)
+		renderShare(w, r, http.StatusInternalServerError, sharePageData{Message: "Something went wrong. Please try again."})
+		return
+	}
+
+	if includeReplies {
+		_, err := history.Each(ctx, cs.DB, false, maxSharedReplies, `
+			SELECT CONCAT_WS(' ', u.first_name, u.last_name), m.content, m.message_created_at
+			FROM {messages} m
+			INNER JOIN users u ON u.user_id = m.user_id
+			WHERE m.channel_id = ? AND m.reply_to_id = ?
+			ORDER BY m.message_id
+			LIMIT ?`, []interface{}{channelID, messageID}, func(rows *sql.Rows) error {
+			var m SharedMessage
+			if err := rows.Scan(&m.Author, &m.Content, &m.CreatedAt); err != nil {
+				return err
+			}
+			view.Replies = append(view.Replies, m)
+			return nil
+		})
+		if err != nil {
+			cs.Log.WithContext(ctx).Error("Failed to get shared replies", "error", err, "link_id", claims.SubjectID)
+			renderShare(w, r, http.StatusInternalServerError, sharePageData{Message: "Something went wrong. Please try again."})
+			return
+		}
+	}
+
+	if _, err := cs.DB.ExecContext(ctx, `
+		UPDATE message_share_links SET view_count = view_count + 1, last_viewed_at = ? WHERE link_id = ?`, now, claims.SubjectID); err != nil {
+		// The view still succeeds; only the count is off
+		cs.Log.WithContext(ctx).Warn("Failed to count share link view", "error", err, "link_id", claims.SubjectID)
+	}
+
+	renderShare(w, r, http.StatusOK, sharePageData{View: view})
+}
@@ -0,0 +1,157 @@
+package channelService
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/bots"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// channel_members roles
+const (
+	// channelRoleAdmin is allowed to manage a channel
+	channelRoleAdmin = 1
+	// channelRoleMember is the role of users who joined a channel themselves
+	channelRoleMember = 2
+)
+
+// GetStandup returns the channel's standup schedule
+func (cs *ChannelService) GetStandup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	standup, err := bots.GetStandup(ctx, channelID)
+	if errors.Is(err, bots.ErrStandupNotFound) {
+		respondWithError(w, http.StatusNotFound, "This channel has no standup")
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to get standup", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get standup")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, standup)
+}
+
+// UpdateStandup creates or replaces the channel's standup schedule. Only
+// channel admins can change it.
+func (cs *ChannelService) UpdateStandup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage this channel's standup")
+		return
+	}
+
+	var req bots.Standup
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.ChannelID = channelID
+	req.CreatedBy = userID
+
+	standup, err := bots.SaveStandup(ctx, req)
+	if errors.Is(err, bots.ErrInvalidStandup) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to save standup", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save standup")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, standup)
+}
+
+// DeleteStandup stops the channel's standups
+func (cs *ChannelService) DeleteStandup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != channelRoleAdmin {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to manage this channel's standup")
+		return
+	}
+
+	err := bots.DeleteStandup(ctx, channelID)
+	if errors.Is(err, bots.ErrStandupNotFound) {
+		respondWithError(w, http.StatusNotFound, "This channel has no standup")
+		return
+	}
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to delete standup", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete standup")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Standup removed"})
+}
+
+// channelAccess reads the user and channel IDs from the request and looks up
+// the user's role in the channel, which is 0 when they are not a member
+func (cs *ChannelService) channelAccess(w http.ResponseWriter, r *http.Request) (userID, channelID int64, role int, ok bool) {
+	ctx := r.Context()
+
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		cs.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return 0, 0, 0, false
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, 0, 0, false
+	}
+	channelID, err = strconv.ParseInt(mux.Vars(r)["channel_id"], 10, 64)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Invalid channel ID in URL", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return 0, 0, 0, false
+	}
+
+	role, err = cs.channelRole(ctx, channelID, userID)
+	if err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check channel membership")
+		return 0, 0, 0, false
+	}
+	return userID, channelID, role, true
+}
+
+func (cs *ChannelService) channelRole(ctx context.Context, channelID, userID int64) (int, error) {
+	role, err := cs.Queries.GetChannelRole(ctx, channelID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return role, err
+}
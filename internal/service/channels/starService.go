@@ -0,0 +1,42 @@
+package channelService
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// StarChannelRequest represents the request body for starring a channel
+type StarChannelRequest struct {
+	Starred bool `json:"starred"`
+}
+
+// SetChannelStarred stars or unstars a channel in the user's sidebar.
+// Starred channels are listed first in the user's team channels on every
+// device.
+func (cs *ChannelService) SetChannelStarred(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, channelID, role, ok := cs.channelAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+
+	var req StarChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := cs.Queries.SetChannelStarred(ctx, channelID, userID, req.Starred, time.Now().UTC().Unix()); err != nil {
+		cs.Log.WithContext(ctx).Error("Failed to star channel", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to star channel")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"channel_id": channelID, "starred": req.Starred})
+}
@@ -0,0 +1,123 @@
+package graphService
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/nikhil/eaven/internal/graphql"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/queries"
+)
+
+const maxQueryBytes = 64 * 1024
+
+// GraphService serves the GraphQL API over teams, channels, members and
+// messages
+type GraphService struct {
+	DB      *sql.DB
+	Queries *queries.Queries
+	Log     *logger.Logger
+	schema  *graphql.Schema
+}
+
+// NewGraphService initializes a new GraphQL service
+func NewGraphService(db *sql.DB, q *queries.Queries, log *logger.Logger) *GraphService {
+	gs := &GraphService{
+		DB:      db,
+		Queries: q,
+		Log:     log,
+	}
+	gs.schema = gs.buildSchema()
+	return gs
+}
+
+type viewerKey struct{}
+
+func viewer(ctx context.Context) int64 {
+	id, _ := ctx.Value(viewerKey{}).(int64)
+	return id
+}
+
+// Query executes a GraphQL query sent as a JSON body, or in the query,
+// operationName and variables parameters of a GET request
+func (gs *GraphService) Query(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		gs.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		gs.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req graphql.Request
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := decodeJSON([]byte(v), &req.Variables); err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid variables")
+				return
+			}
+		}
+	} else {
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueryBytes))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	if req.Query == "" || len(req.Query) > maxQueryBytes {
+		respondWithError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	result := graphql.Execute(context.WithValue(ctx, viewerKey{}, userID), gs.schema, req)
+	if result.Data == nil && len(result.Errors) > 0 {
+		respondWithJSON(w, http.StatusBadRequest, result)
+		return
+	}
+	for _, e := range result.Errors {
+		gs.Log.WithContext(ctx).Warn("GraphQL field error", "error", e.Message, "path", e.Path)
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Helper functions for HTTP responses
+func respondWithError(w http.ResponseWriter, code int, message string) {
+	respondWithJSON(w, code, map[string]string{"error": message})
+}
+
+func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error marshaling JSON: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
@@ -0,0 +1,245 @@
+package graphService
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/limits"
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// Loaders fetch what a field needs for every parent in one query. Per-parent
+// limits use a UNION ALL of limited index range scans, as the message batch
+// endpoint does.
+
+// teamNode is a team as seen by the viewer
+type teamNode struct {
+	models.Team
+	Role int
+}
+
+// channelNode is a channel as seen by the viewer; Role is 0 for visible
+// channels the viewer has not joined
+type channelNode struct {
+	models.Channel
+	Role int
+}
+
+// memberNode is a team or channel membership
+type memberNode struct {
+	UserID   int64
+	Role     int
+	JoinedAt int64
+}
+
+type messagePage struct {
+	Messages []models.MessageBody
+	HasMore  bool
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func int64Args(ids []int64) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+// uniqueIDs drops duplicates and zero IDs
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func (gs *GraphService) loadUsers(ctx context.Context, ids []int64) (map[int64]models.User, error) {
+	ids = uniqueIDs(ids)
+	users := make(map[int64]models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	rows, err := gs.DB.QueryContext(ctx, `
+		SELECT user_id, first_name, last_name FROM users WHERE user_id IN (`+placeholders(len(ids))+`)`, int64Args(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.UserID, &u.FirstName, &u.LastName); err != nil {
+			return nil, err
+		}
+		users[u.UserID] = u
+	}
+	return users, rows.Err()
+}
+
+// loadTeams returns the listed teams the viewer belongs to
+func (gs *GraphService) loadTeams(ctx context.Context, viewerID int64, ids []int64) (map[int64]teamNode, error) {
+	ids = uniqueIDs(ids)
+	teams := make(map[int64]teamNode, len(ids))
+	if len(ids) == 0 {
+		return teams, nil
+	}
+	args := append([]interface{}{viewerID}, int64Args(ids)...)
+	rows, err := gs.DB.QueryContext(ctx, `
+		SELECT t.team_id, t.team_name, t.description, t.created_by, t.created_at, t.updated_at, utm.role
+		FROM teams t
+		INNER JOIN user_teams_mapper utm ON utm.team_id = t.team_id AND utm.user_id = ?
+		WHERE t.team_id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t teamNode
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt, &t.Role); err != nil {
+			return nil, err
+		}
+		teams[t.ID] = t
+	}
+	return teams, rows.Err()
+}
+
+// loadVisibleChannels returns, per team, the channels the viewer can see:
+// the ones they belong to plus, unless they are a guest, public ones
+func (gs *GraphService) loadVisibleChannels(ctx context.Context, viewerID int64, teamIDs []int64) (map[int64][]channelNode, error) {
+	teamIDs = uniqueIDs(teamIDs)
+	channels := make(map[int64][]channelNode, len(teamIDs))
+	if len(teamIDs) == 0 {
+		return channels, nil
+	}
+	args := append([]interface{}{viewerID, viewerID}, int64Args(teamIDs)...)
+	rows, err := gs.DB.QueryContext(ctx, `
+		SELECT c.channel_id, c.team_id, c.channel_name, c.description, c.is_private, c.created_by, c.created_at, c.updated_at, c.archived_at,
+			COALESCE(cm.role, 0)
+		FROM channels c
+		INNER JOIN user_teams_mapper utm ON utm.team_id = c.team_id AND utm.user_id = ?
+		LEFT JOIN channel_members cm ON cm.channel_id = c.channel_id AND cm.user_id = ?
+		WHERE c.team_id IN (`+placeholders(len(teamIDs))+`)
+			AND (cm.user_id IS NOT NULL OR (c.is_private = 0 AND utm.role <> 3))
+		ORDER BY c.team_id, c.created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c channelNode
+		if err := rows.Scan(&c.ChannelID, &c.TeamID, &c.Name, &c.Description, &c.IsPrivate, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt, &c.ArchivedAt, &c.Role); err != nil {
+			return nil, err
+		}
+		channels[c.TeamID] = append(channels[c.TeamID], c)
+	}
+	return channels, rows.Err()
+}
+
+// loadMembers returns up to limit members per team or channel, oldest
+// membership first. table is user_teams_mapper keyed by team_id or
+// channel_members keyed by channel_id.
+func (gs *GraphService) loadMembers(ctx context.Context, table, key string, ids []int64, limit int) (map[int64][]memberNode, error) {
+	ids = uniqueIDs(ids)
+	members := make(map[int64][]memberNode, len(ids))
+	if len(ids) == 0 {
+		return members, nil
+	}
+	parts := make([]string, 0, len(ids))
+	args := make([]interface{}, 0, len(ids)*2)
+	for _, id := range ids {
+		parts = append(parts, `(SELECT `+key+`, user_id, role, joined_at FROM `+table+` WHERE `+key+` = ? ORDER BY joined_at, user_id LIMIT ?)`)
+		args = append(args, id, limit)
+	}
+	rows, err := gs.DB.QueryContext(ctx, strings.Join(parts, " UNION ALL "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var owner int64
+		var m memberNode
+		if err := rows.Scan(&owner, &m.UserID, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members[owner] = append(members[owner], m)
+	}
+	return members, rows.Err()
+}
+
+// loadMessages returns, per channel, the last messages before a message ID
+// (0 for the latest), oldest first
+func (gs *GraphService) loadMessages(ctx context.Context, channelIDs []int64, before int64, limit int) (map[int64]*messagePage, error) {
+	channelIDs = uniqueIDs(channelIDs)
+	pages := make(map[int64]*messagePage, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return pages, nil
+	}
+	// Messages older than the team's plan keeps are hidden
+	cutoffs, err := limits.HistoryCutoffs(ctx, gs.DB, channelIDs, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range channelIDs {
+		pages[id] = &messagePage{Messages: []models.MessageBody{}}
+	}
+	// Channels the hot table cannot fill continue into the archive
+	for _, table := range history.Tables {
+		parts := make([]string, 0, len(channelIDs))
+		args := make([]interface{}, 0, len(channelIDs)*5)
+		for _, id := range channelIDs {
+			// One extra row tells whether older messages remain
+			missing := limit + 1 - len(pages[id].Messages)
+			if missing <= 0 {
+				continue
+			}
+			parts = append(parts, `(SELECT m.message_id, m.channel_id, m.user_id, m.content, COALESCE(m.rendered_html, ''), m.message_created_at, m.reply_to_id,
+					m.content_type, COALESCE(m.encrypted_payload, '')
+				FROM `+table+` m
+				WHERE m.channel_id = ? AND (? = 0 OR m.message_id < ?) AND m.message_created_at >= ?
+				ORDER BY m.message_id DESC
+				LIMIT ?)`)
+			args = append(args, id, before, before, cutoffs[id], missing)
+		}
+		if len(parts) == 0 {
+			break
+		}
+		if err := gs.scanMessages(ctx, pages, strings.Join(parts, " UNION ALL "), args); err != nil {
+			return nil, err
+		}
+	}
+	for _, page := range pages {
+		sort.Slice(page.Messages, func(i, j int) bool { return page.Messages[i].MessageID < page.Messages[j].MessageID })
+		if len(page.Messages) > limit {
+			page.HasMore = true
+			page.Messages = page.Messages[1:]
+		}
+	}
+	return pages, nil
+}
+
+func (gs *GraphService) scanMessages(ctx context.Context, pages map[int64]*messagePage, query string, args []interface{}) error {
+	rows, err := gs.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m models.MessageBody
+		if err := rows.Scan(&m.MessageID, &m.ChannelID, &m.UserID, &m.Content, &m.RenderedHTML, &m.MessageTime, &m.ReplyToID, &m.ContentType, &m.EncryptedPayload); err != nil {
+			return err
+		}
+		pages[m.ChannelID].Messages = append(pages[m.ChannelID].Messages, m)
+	}
+	return rows.Err()
+}
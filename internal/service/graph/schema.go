@@ -0,0 +1,396 @@
+package graphService
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/nikhil/eaven/internal/graphql"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/queries"
+)
+
+const (
+	defaultMembers  = 100
+	maxMembers      = 500
+	defaultMessages = 50
+	maxMessages     = 100
+	maxTeams        = 100
+	// channelsPerTeam is the per-team estimate used to cost queries
+	channelsPerTeam = 50
+)
+
+// errNotFound hides whether objects the viewer cannot see exist
+var errNotFound = errors.New("not found")
+
+// buildSchema declares the GraphQL API:
+//
+//	type Query {
+//	  me: User
+//	  teams(first: Int = 50): [Team]
+//	  team(id: ID!): Team
+//	  channel(id: ID!): Channel
+//	}
+//	type Team { id name description createdAt role channels members(first: Int = 100) }
+//	type Channel { id teamId name description isPrivate createdAt archivedAt role team members(first) messages(last: Int = 50, before: ID) }
+//	type Member { user role joinedAt }
+//	type MessagePage { nodes: [Message] hasMore }
+//	type Message { id channelId content renderedHtml contentType encryptedPayload createdAt replyToId author }
+//	type User { id firstName lastName }
+//
+// Channel members and messages are null for channels the viewer has not
+// joined, and team members are null for guests.
+func (gs *GraphService) buildSchema() *graphql.Schema {
+	user := &graphql.Object{Name: "User"}
+	team := &graphql.Object{Name: "Team"}
+	channel := &graphql.Object{Name: "Channel"}
+	member := &graphql.Object{Name: "Member"}
+	message := &graphql.Object{Name: "Message"}
+	page := &graphql.Object{Name: "MessagePage"}
+
+	user.Fields = map[string]*graphql.Field{
+		"id":        scalar(graphql.ID, func(u models.User) interface{} { return u.UserID }),
+		"firstName": scalar(graphql.String, func(u models.User) interface{} { return u.FirstName }),
+		"lastName":  scalar(graphql.String, func(u models.User) interface{} { return u.LastName }),
+	}
+
+	team.Fields = map[string]*graphql.Field{
+		"id":          scalar(graphql.ID, func(t teamNode) interface{} { return t.ID }),
+		"name":        scalar(graphql.String, func(t teamNode) interface{} { return t.Name }),
+		"description": scalar(graphql.String, func(t teamNode) interface{} { return t.Description }),
+		"createdAt":   scalar(graphql.Int, func(t teamNode) interface{} { return t.CreatedAt }),
+		"role":        scalar(graphql.Int, func(t teamNode) interface{} { return t.Role }),
+		"channels": {
+			Type: graphql.List(graphql.Of(channel)),
+			Cost: func(graphql.Args) int { return channelsPerTeam },
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				ids := make([]int64, len(parents))
+				for i, p := range parents {
+					ids[i] = p.(teamNode).ID
+				}
+				channels, err := gs.loadVisibleChannels(ctx, viewer(ctx), ids)
+				if err != nil {
+					return nil, gs.internal(ctx, "channels", err)
+				}
+				out := make([]interface{}, len(parents))
+				for i, id := range ids {
+					out[i] = toList(channels[id])
+				}
+				return out, nil
+			},
+		},
+		"members": {
+			Type: graphql.List(graphql.Of(member)),
+			Args: firstArg(),
+			Cost: firstCost,
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				var ids []int64
+				for _, p := range parents {
+					if t := p.(teamNode); t.Role != queries.TeamRoleGuest {
+						ids = append(ids, t.ID)
+					}
+				}
+				members, err := gs.loadMembers(ctx, "user_teams_mapper", "team_id", ids, limit(args.Int("first"), maxMembers))
+				if err != nil {
+					return nil, gs.internal(ctx, "team members", err)
+				}
+				out := make([]interface{}, len(parents))
+				for i, p := range parents {
+					if t := p.(teamNode); t.Role != queries.TeamRoleGuest {
+						out[i] = toList(members[t.ID])
+					}
+				}
+				return out, nil
+			},
+		},
+	}
+
+	channel.Fields = map[string]*graphql.Field{
+		"id":          scalar(graphql.ID, func(c channelNode) interface{} { return c.ChannelID }),
+		"teamId":      scalar(graphql.ID, func(c channelNode) interface{} { return c.TeamID }),
+		"name":        scalar(graphql.String, func(c channelNode) interface{} { return c.Name }),
+		"description": scalar(graphql.String, func(c channelNode) interface{} { return c.Description }),
+		"isPrivate":   scalar(graphql.Boolean, func(c channelNode) interface{} { return c.IsPrivate }),
+		"createdAt":   scalar(graphql.Int, func(c channelNode) interface{} { return c.CreatedAt }),
+		"archivedAt":  scalar(graphql.Int, func(c channelNode) interface{} { return c.ArchivedAt }),
+		"role":        scalar(graphql.Int, func(c channelNode) interface{} { return c.Role }),
+		"team": {
+			Type: graphql.Of(team),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				ids := make([]int64, len(parents))
+				for i, p := range parents {
+					ids[i] = p.(channelNode).TeamID
+				}
+				teams, err := gs.loadTeams(ctx, viewer(ctx), ids)
+				if err != nil {
+					return nil, gs.internal(ctx, "teams", err)
+				}
+				out := make([]interface{}, len(parents))
+				for i, id := range ids {
+					if t, ok := teams[id]; ok {
+						out[i] = t
+					}
+				}
+				return out, nil
+			},
+		},
+		"members": {
+			Type: graphql.List(graphql.Of(member)),
+			Args: firstArg(),
+			Cost: firstCost,
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				ids := joinedChannels(parents)
+				members, err := gs.loadMembers(ctx, "channel_members", "channel_id", ids, limit(args.Int("first"), maxMembers))
+				if err != nil {
+					return nil, gs.internal(ctx, "channel members", err)
+				}
+				out := make([]interface{}, len(parents))
+				for i, p := range parents {
+					if c := p.(channelNode); c.Role != 0 {
+						out[i] = toList(members[c.ChannelID])
+					}
+				}
+				return out, nil
+			},
+		},
+		"messages": {
+			Type: graphql.Of(page),
+			Args: map[string]*graphql.Arg{
+				"last":   {Type: graphql.Int, Default: int64(defaultMessages)},
+				"before": {Type: graphql.ID},
+			},
+			Cost: func(args graphql.Args) int { return int(limit(args.Int("last"), maxMessages)) },
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				var before int64
+				if args.String("before") != "" {
+					var err error
+					if before, err = args.IntID("before"); err != nil {
+						return nil, err
+					}
+				}
+				pages, err := gs.loadMessages(ctx, joinedChannels(parents), before, limit(args.Int("last"), maxMessages))
+				if err != nil {
+					return nil, gs.internal(ctx, "messages", err)
+				}
+				out := make([]interface{}, len(parents))
+				for i, p := range parents {
+					if c := p.(channelNode); c.Role != 0 {
+						out[i] = pages[c.ChannelID]
+					}
+				}
+				return out, nil
+			},
+		},
+	}
+
+	member.Fields = map[string]*graphql.Field{
+		"role":     scalar(graphql.Int, func(m memberNode) interface{} { return m.Role }),
+		"joinedAt": scalar(graphql.Int, func(m memberNode) interface{} { return m.JoinedAt }),
+		"user": {
+			Type: graphql.Of(user),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				ids := make([]int64, len(parents))
+				for i, p := range parents {
+					ids[i] = p.(memberNode).UserID
+				}
+				return gs.resolveUsers(ctx, ids)
+			},
+		},
+	}
+
+	page.Fields = map[string]*graphql.Field{
+		"hasMore": scalar(graphql.Boolean, func(p *messagePage) interface{} { return p.HasMore }),
+		"nodes": {
+			Type: graphql.List(graphql.Of(message)),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				out := make([]interface{}, len(parents))
+				for i, p := range parents {
+					out[i] = toList(p.(*messagePage).Messages)
+				}
+				return out, nil
+			},
+		},
+	}
+
+	message.Fields = map[string]*graphql.Field{
+		"id":           scalar(graphql.ID, func(m models.MessageBody) interface{} { return m.MessageID }),
+		"channelId":    scalar(graphql.ID, func(m models.MessageBody) interface{} { return m.ChannelID }),
+		"content":      scalar(graphql.String, func(m models.MessageBody) interface{} { return m.Content }),
+		"renderedHtml": scalar(graphql.String, func(m models.MessageBody) interface{} { return m.RenderedHTML }),
+		"contentType":  scalar(graphql.String, func(m models.MessageBody) interface{} { return m.ContentType }),
+		"encryptedPayload": scalar(graphql.String, func(m models.MessageBody) interface{} {
+			if m.EncryptedPayload == "" {
+				return nil
+			}
+			return m.EncryptedPayload
+		}),
+		"createdAt": scalar(graphql.Int, func(m models.MessageBody) interface{} { return m.MessageTime }),
+		"replyToId": scalar(graphql.ID, func(m models.MessageBody) interface{} {
+			if m.ReplyToID == 0 {
+				return nil
+			}
+			return m.ReplyToID
+		}),
+		"author": {
+			Type: graphql.Of(user),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				ids := make([]int64, len(parents))
+				for i, p := range parents {
+					ids[i] = p.(models.MessageBody).UserID
+				}
+				return gs.resolveUsers(ctx, ids)
+			},
+		},
+	}
+
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"me": {
+			Type: graphql.Of(user),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				return gs.resolveUsers(ctx, []int64{viewer(ctx)})
+			},
+		},
+		"teams": {
+			Type: graphql.List(graphql.Of(team)),
+			Args: map[string]*graphql.Arg{"first": {Type: graphql.Int, Default: int64(50)}},
+			Cost: func(args graphql.Args) int { return int(limit(args.Int("first"), maxTeams)) },
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				teams, err := gs.Queries.ListUserTeams(ctx, viewer(ctx), int(limit(args.Int("first"), maxTeams)), 0)
+				if err != nil {
+					return nil, gs.internal(ctx, "teams", err)
+				}
+				ids := make([]int64, len(teams))
+				for i, t := range teams {
+					ids[i] = t.ID
+				}
+				nodes, err := gs.loadTeams(ctx, viewer(ctx), ids)
+				if err != nil {
+					return nil, gs.internal(ctx, "teams", err)
+				}
+				list := make([]interface{}, 0, len(ids))
+				for _, id := range ids {
+					if t, ok := nodes[id]; ok {
+						list = append(list, t)
+					}
+				}
+				return []interface{}{list}, nil
+			},
+		},
+		"team": {
+			Type: graphql.Of(team),
+			Args: map[string]*graphql.Arg{"id": {Type: graphql.NonNull(graphql.ID)}},
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				id, err := args.IntID("id")
+				if err != nil {
+					return nil, err
+				}
+				teams, err := gs.loadTeams(ctx, viewer(ctx), []int64{id})
+				if err != nil {
+					return nil, gs.internal(ctx, "team", err)
+				}
+				t, ok := teams[id]
+				if !ok {
+					return nil, fmt.Errorf("team %w", errNotFound)
+				}
+				return []interface{}{t}, nil
+			},
+		},
+		"channel": {
+			Type: graphql.Of(channel),
+			Args: map[string]*graphql.Arg{"id": {Type: graphql.NonNull(graphql.ID)}},
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				id, err := args.IntID("id")
+				if err != nil {
+					return nil, err
+				}
+				c, err := gs.Queries.GetChannel(ctx, id)
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil, fmt.Errorf("channel %w", errNotFound)
+				}
+				if err != nil {
+					return nil, gs.internal(ctx, "channel", err)
+				}
+				// Resolve through the team's visible channels so the same
+				// access rules apply as on Team.channels
+				visible, err := gs.loadVisibleChannels(ctx, viewer(ctx), []int64{c.TeamID})
+				if err != nil {
+					return nil, gs.internal(ctx, "channel", err)
+				}
+				for _, node := range visible[c.TeamID] {
+					if node.ChannelID == id {
+						return []interface{}{node}, nil
+					}
+				}
+				return nil, fmt.Errorf("channel %w", errNotFound)
+			},
+		},
+	}}
+
+	return &graphql.Schema{Query: query, MaxDepth: 8}
+}
+
+// scalar declares a field read from each parent of type T
+func scalar[T any](t *graphql.Type, get func(T) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+			out := make([]interface{}, len(parents))
+			for i, p := range parents {
+				out[i] = get(p.(T))
+			}
+			return out, nil
+		},
+	}
+}
+
+func (gs *GraphService) resolveUsers(ctx context.Context, ids []int64) ([]interface{}, error) {
+	users, err := gs.loadUsers(ctx, ids)
+	if err != nil {
+		return nil, gs.internal(ctx, "users", err)
+	}
+	out := make([]interface{}, len(ids))
+	for i, id := range ids {
+		if u, ok := users[id]; ok {
+			out[i] = u
+		}
+	}
+	return out, nil
+}
+
+// internal logs a failed load and returns an error safe to show clients
+func (gs *GraphService) internal(ctx context.Context, what string, err error) error {
+	gs.Log.WithContext(ctx).Error("Failed to load "+what, "error", err)
+	return fmt.Errorf("failed to load %s", what)
+}
+
+func joinedChannels(parents []interface{}) []int64 {
+	var ids []int64
+	for _, p := range parents {
+		if c := p.(channelNode); c.Role != 0 {
+			ids = append(ids, c.ChannelID)
+		}
+	}
+	return ids
+}
+
+func firstArg() map[string]*graphql.Arg {
+	return map[string]*graphql.Arg{"first": {Type: graphql.Int, Default: int64(defaultMembers)}}
+}
+
+func firstCost(args graphql.Args) int {
+	return int(limit(args.Int("first"), maxMembers))
+}
+
+// limit clamps a requested count to [1, upper]
+func limit(n, upper int64) int {
+	return int(min(max(n, 1), upper))
+}
+
+func toList[T any](items []T) []interface{} {
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		out[i] = item
+	}
+	return out
+}
@@ -0,0 +1,276 @@
+package messageService
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/limits"
+	"github.com/nikhil/eaven/internal/media"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/unfurl"
+	"github.com/nikhil/eaven/internal/utils"
+)
+
+const (
+	defaultWindowSize = 50
+	maxWindowSize     = 100
+)
+
+// MessageWindow is a run of a channel's messages around a target, oldest
+// first. HasOlder and HasNewer tell whether the channel has messages beyond
+// either end, to page from with the batch endpoint.
+type MessageWindow struct {
+	ChannelID int64          `json:"channel_id"`
+	TargetID  int64          `json:"target_id"`
+	Messages  []BatchMessage `json:"messages"`
+	HasOlder  bool           `json:"has_older"`
+	HasNewer  bool           `json:"has_newer"`
+}
+
+// GetMessagesAround returns a window of messages centred on one, so search
+// results and permalinks open in context. limit sets the window size
+// (default 50, at most 100).
+func (ms *MessageService) GetMessagesAround(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	channelID, limit, cutoff, ok := ms.windowAccess(w, r)
+	if !ok {
+		return
+	}
+	targetID, err := strconv.ParseInt(mux.Vars(r)["message_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	var createdAt int64
+	query, args := history.Union(`SELECT message_created_at FROM {messages} WHERE message_id = ? AND channel_id = ?`, targetID, channelID)
+	err = ms.Reader().QueryRowContext(ctx, query, args...).Scan(&createdAt)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && createdAt < cutoff {
+		respondWithError(w, http.StatusNotFound, "Message not found")
+		return
+	}
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to get message", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+	ms.writeWindow(w, r, channelID, targetID, limit, cutoff)
+}
+
+// GetMessagesAt returns a window of messages centred on the first one sent
+// at or after ts, in Unix seconds, to jump to a date. When nothing was sent
+// since, the window ends with the channel's latest message.
+func (ms *MessageService) GetMessagesAt(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	channelID, limit, cutoff, ok := ms.windowAccess(w, r)
+	if !ok {
+		return
+	}
+	ts, err := strconv.ParseInt(r.URL.Query().Get("ts"), 10, 64)
+	if err != nil || ts < 0 {
+		respondWithError(w, http.StatusBadRequest, "ts must be a Unix time in seconds")
+		return
+	}
+
+	reader := ms.Reader()
+	var targetID int64
+	scanID := func(rows *sql.Rows) error { return rows.Scan(&targetID) }
+	n, err := history.Each(ctx, reader, false, 1, `
+		SELECT message_id FROM {messages}
+		WHERE channel_id = ? AND message_created_at >= ?
+		ORDER BY message_created_at, message_id
+		LIMIT ?`, []interface{}{channelID, max(ts, cutoff)}, scanID)
+	if err == nil && n == 0 {
+		_, err = history.Each(ctx, reader, true, 1, `
+			SELECT message_id FROM {messages}
+			WHERE channel_id = ? AND message_created_at >= ?
+			ORDER BY message_id DESC
+			LIMIT ?`, []interface{}{channelID, cutoff}, scanID)
+	}
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to find message by time", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+	if targetID == 0 {
+		respondWithJSON(w, http.StatusOK, MessageWindow{ChannelID: channelID, Messages: []BatchMessage{}})
+		return
+	}
+	ms.writeWindow(w, r, channelID, targetID, limit, cutoff)
+}
+
+// windowAccess reads the channel and window size of a request and checks
+// that the user is a member. cutoff is the channel's history limit.
+func (ms *MessageService) windowAccess(w http.ResponseWriter, r *http.Request) (channelID int64, limit int, cutoff int64, ok bool) {
+	ctx := r.Context()
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		ms.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return 0, 0, 0, false
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, 0, 0, false
+	}
+	channelID, err = strconv.ParseInt(mux.Vars(r)["channel_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return 0, 0, 0, false
+	}
+	limit = defaultWindowSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxWindowSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxWindowSize))
+			return 0, 0, 0, false
+		}
+	}
+
+	member, err := ms.Queries.IsChannelMember(ctx, channelID, userID)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return 0, 0, 0, false
+	}
+	if !member {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return 0, 0, 0, false
+	}
+
+	cutoffs, err := limits.HistoryCutoffs(ctx, ms.DB, []int64{channelID}, time.Now().UTC())
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to get message history limits", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return 0, 0, 0, false
+	}
+	return channelID, limit, cutoffs[channelID], true
+}
+
+// writeWindow answers with up to limit messages: the target, the half of
+// the rest before it and the others after it. ?fields= and ?compact=true
+// trim the messages.
+func (ms *MessageService) writeWindow(w http.ResponseWriter, r *http.Request, channelID, targetID int64, limit int, cutoff int64) {
+	ctx := r.Context()
+	older := (limit - 1) / 2
+	newer := limit - 1 - older
+
+	// One extra row on each side tells whether there is more
+	before, err := ms.windowRows(ctx, true, channelID, targetID, cutoff, older+1)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to query older messages", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+	after, err := ms.windowRows(ctx, false, channelID, targetID, cutoff, newer+2)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to query newer messages", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+
+	window := MessageWindow{ChannelID: channelID, TargetID: targetID}
+	if len(before) > older {
+		window.HasOlder = true
+		before = before[:older]
+	}
+	if len(after) > newer+1 {
+		window.HasNewer = true
+		after = after[:newer+1]
+	}
+	window.Messages = make([]BatchMessage, 0, len(before)+len(after))
+	for i := len(before) - 1; i >= 0; i-- {
+		window.Messages = append(window.Messages, before[i])
+	}
+	window.Messages = append(window.Messages, after...)
+
+	if err := ms.decorate(ctx, window.Messages); err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to load message attachments", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+
+	// Trim the payload when the client asked for specific fields
+	if selection := utils.ParseFieldSelection(r, models.MessageCompactFields); selection != nil {
+		trimmed, err := selection.Apply(window.Messages)
+		if err != nil {
+			ms.Log.WithContext(ctx).Error("Failed to apply field selection", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process messages")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"channel_id": window.ChannelID,
+			"target_id":  window.TargetID,
+			"messages":   trimmed,
+			"has_older":  window.HasOlder,
+			"has_newer":  window.HasNewer,
+		})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, window)
+}
+
+// windowRows reads messages of a channel on one side of a target: older
+// ones newest first, or the target and newer ones oldest first. Archived
+// messages are included.
+func (ms *MessageService) windowRows(ctx context.Context, older bool, channelID, targetID, cutoff int64, limit int) ([]BatchMessage, error) {
+	side := `m.message_id >= ? ORDER BY m.message_id`
+	if older {
+		side = `m.message_id < ? ORDER BY m.message_id DESC`
+	}
+	var messages []BatchMessage
+	_, err := history.Each(ctx, ms.Reader(), older, limit, `
+		SELECT m.message_id, m.channel_id, m.user_id, m.content, COALESCE(m.rendered_html, ''), m.message_created_at, m.reply_to_id,
+			m.content_type, COALESCE(m.encrypted_payload, '')
+		FROM {messages} m
+		WHERE m.channel_id = ? AND m.message_created_at >= ? AND `+side+`
+		LIMIT ?`, []interface{}{channelID, cutoff, targetID}, func(rows *sql.Rows) error {
+		var m BatchMessage
+		if err := rows.Scan(&m.MessageID, &m.ChannelID, &m.UserID, &m.Content, &m.RenderedHTML, &m.MessageTime, &m.ReplyToID, &m.ContentType, &m.EncryptedPayload); err != nil {
+			return err
+		}
+		messages = append(messages, m)
+		return nil
+	})
+	return messages, err
+}
+
+// decorate loads the quotes, link previews and attachments of messages.
+// Quotes and previews are decoration and are left out when they fail to
+// load; only failing to load attachments is an error.
+func (ms *MessageService) decorate(ctx context.Context, messages []BatchMessage) error {
+	bodies := make([]*models.MessageBody, len(messages))
+	ids := make([]int64, len(messages))
+	for i := range messages {
+		bodies[i] = &messages[i].MessageBody
+		ids[i] = messages[i].MessageID
+	}
+	if err := loadQuotes(ctx, ms.DB, bodies); err != nil {
+		// Replies keep their reply_to_id
+		ms.Log.WithContext(ctx).Warn("Failed to load quoted messages", "error", err)
+	}
+	previews, err := unfurl.GetPreviews(ctx, ms.DB, ids)
+	if err != nil {
+		ms.Log.WithContext(ctx).Warn("Failed to load link previews", "error", err)
+	}
+	attachments, err := media.ForMessages(ctx, ms.DB, ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Links = previews[messages[i].MessageID]
+		messages[i].Attachments = attachments[messages[i].MessageID]
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package messageService
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// maxAttachmentsPerMessage bounds how many files one message can carry
+const maxAttachmentsPerMessage = 10
+
+// ErrInvalidAttachments is returned when a message sends files that are not
+// the sender's unsent uploads to its channel
+var ErrInvalidAttachments = fmt.Errorf("attachment_ids must be your own unsent uploads to this channel, at most %d", maxAttachmentsPerMessage)
+
+// attachFiles links a new message's attachments to it. Each upload can be
+// sent once, by its uploader, in the channel it was uploaded to.
+func attachFiles(ctx context.Context, tx *sql.Tx, m models.MessageBody) error {
+	if len(m.AttachmentIDs) == 0 {
+		return nil
+	}
+	seen := make(map[int64]bool, len(m.AttachmentIDs))
+	args := []interface{}{m.MessageID, m.ChannelID, m.UserID}
+	for _, id := range m.AttachmentIDs {
+		if seen[id] {
+			return ErrInvalidAttachments
+		}
+		seen[id] = true
+		args = append(args, id)
+	}
+	if len(seen) > maxAttachmentsPerMessage {
+		return ErrInvalidAttachments
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE attachments SET message_id = ?
+		WHERE channel_id = ? AND uploader_id = ? AND message_id = 0
+			AND attachment_id IN (?`+strings.Repeat(", ?", len(seen)-1)+`)`, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != int64(len(seen)) {
+		return ErrInvalidAttachments
+	}
+	return nil
+}
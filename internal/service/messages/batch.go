@@ -0,0 +1,233 @@
+package messageService
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/limits"
+	"github.com/nikhil/eaven/internal/media"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/unfurl"
+	"github.com/nikhil/eaven/internal/utils"
+)
+
+const (
+	maxBatchChannels    = 50
+	defaultBatchPerChan = 50
+	maxBatchPerChannel  = 100
+)
+
+// BatchCursor asks for messages in a channel newer than Since, a message ID
+// the client already has (0 for the latest messages)
+type BatchCursor struct {
+	ChannelID int64 `json:"channel_id"`
+	Since     int64 `json:"since"`
+}
+
+type batchRequest struct {
+	Channels []BatchCursor `json:"channels"`
+	Limit    int           `json:"limit"`
+}
+
+// BatchMessage is a message with the links found in it and the files sent
+// with it
+type BatchMessage struct {
+	models.MessageBody
+	Links       []unfurl.Preview    `json:"links,omitempty"`
+	Attachments []models.Attachment `json:"attachments,omitempty"`
+}
+
+// ChannelBatch holds the newest messages of one channel, oldest first.
+// HasMore is set when older messages after Since were left out.
+type ChannelBatch struct {
+	ChannelID int64          `json:"channel_id"`
+	Messages  []BatchMessage `json:"messages"`
+	HasMore   bool           `json:"has_more"`
+}
+
+// GetMessagesBatch returns recent messages for several channels in one round
+// trip. Channels the user is not a member of come back empty. ?fields= and
+// ?compact=true trim the messages.
+func (ms *MessageService) GetMessagesBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		ms.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Channels) == 0 || len(req.Channels) > maxBatchChannels {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("channels must list between 1 and %d channels", maxBatchChannels))
+		return
+	}
+	if req.Limit < 1 || req.Limit > maxBatchPerChannel {
+		req.Limit = defaultBatchPerChan
+	}
+
+	// Messages older than the team's plan keeps are hidden
+	channelIDs := make([]int64, 0, len(req.Channels))
+	for _, c := range req.Channels {
+		channelIDs = append(channelIDs, c.ChannelID)
+	}
+	cutoffs, err := limits.HistoryCutoffs(ctx, ms.DB, channelIDs, time.Now().UTC())
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to get message history limits", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+
+	batches := make(map[int64]*ChannelBatch, len(req.Channels))
+	order := make([]int64, 0, len(req.Channels))
+	since := make(map[int64]int64, len(req.Channels))
+	for _, c := range req.Channels {
+		if _, ok := batches[c.ChannelID]; ok {
+			continue
+		}
+		batches[c.ChannelID] = &ChannelBatch{ChannelID: c.ChannelID, Messages: []BatchMessage{}}
+		order = append(order, c.ChannelID)
+		since[c.ChannelID] = c.Since
+	}
+
+	// One query per message table for every channel: a UNION ALL of
+	// per-channel index range scans, each limited on its own. One extra row
+	// is read to detect more. Channels the hot table cannot fill continue
+	// into the archive.
+	reader := ms.Reader()
+	for _, table := range history.Tables {
+		parts := make([]string, 0, len(order))
+		args := make([]interface{}, 0, len(order)*5)
+		for _, id := range order {
+			missing := req.Limit + 1 - len(batches[id].Messages)
+			if missing <= 0 {
+				continue
+			}
+			parts = append(parts, `(SELECT m.message_id, m.channel_id, m.user_id, m.content, COALESCE(m.rendered_html, ''), m.message_created_at, m.reply_to_id,
+					m.content_type, COALESCE(m.encrypted_payload, '')
+				FROM `+table+` m
+				INNER JOIN channel_members cm ON cm.channel_id = m.channel_id AND cm.user_id = ?
+				WHERE m.channel_id = ? AND m.message_id > ? AND m.message_created_at >= ?
+				ORDER BY m.message_id DESC
+				LIMIT ?)`)
+			args = append(args, userID, id, since[id], cutoffs[id], missing)
+		}
+		if len(parts) == 0 {
+			break
+		}
+
+		rows, err := reader.QueryContext(ctx, strings.Join(parts, " UNION ALL "), args...)
+		if err != nil {
+			ms.Log.WithContext(ctx).Error("Failed to query message batch", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+			return
+		}
+		for rows.Next() {
+			var m BatchMessage
+			if err := rows.Scan(&m.MessageID, &m.ChannelID, &m.UserID, &m.Content, &m.RenderedHTML, &m.MessageTime, &m.ReplyToID, &m.ContentType, &m.EncryptedPayload); err != nil {
+				rows.Close()
+				ms.Log.WithContext(ctx).Error("Failed to scan message row", "error", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to process messages")
+				return
+			}
+			batch := batches[m.ChannelID]
+			batch.Messages = append(batch.Messages, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			ms.Log.WithContext(ctx).Error("Error iterating message rows", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process messages")
+			return
+		}
+	}
+
+	var messageIDs []int64
+	// UNION ALL does not keep the per-channel order, so sort oldest first here
+	// and drop the extra row
+	for _, batch := range batches {
+		sort.Slice(batch.Messages, func(i, j int) bool { return batch.Messages[i].MessageID < batch.Messages[j].MessageID })
+		if len(batch.Messages) > req.Limit {
+			batch.HasMore = true
+			batch.Messages = batch.Messages[1:]
+		}
+		for _, m := range batch.Messages {
+			messageIDs = append(messageIDs, m.MessageID)
+		}
+	}
+
+	var all []*models.MessageBody
+	for _, batch := range batches {
+		for i := range batch.Messages {
+			all = append(all, &batch.Messages[i].MessageBody)
+		}
+	}
+	if err := loadQuotes(ctx, ms.DB, all); err != nil {
+		// Quotes are decoration; replies keep their reply_to_id
+		ms.Log.WithContext(ctx).Warn("Failed to load quoted messages", "error", err)
+	}
+
+	previews, err := unfurl.GetPreviews(ctx, ms.DB, messageIDs)
+	if err != nil {
+		// Previews are decoration; return the messages without them
+		ms.Log.WithContext(ctx).Warn("Failed to load link previews", "error", err)
+	}
+
+	attachments, err := media.ForMessages(ctx, ms.DB, messageIDs)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to load message attachments", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get messages")
+		return
+	}
+
+	response := make([]ChannelBatch, 0, len(order))
+	for _, id := range order {
+		batch := batches[id]
+		for i := range batch.Messages {
+			batch.Messages[i].Links = previews[batch.Messages[i].MessageID]
+			batch.Messages[i].Attachments = attachments[batch.Messages[i].MessageID]
+		}
+		response = append(response, *batch)
+	}
+
+	// Trim the payload when the client asked for specific fields
+	if selection := utils.ParseFieldSelection(r, models.MessageCompactFields); selection != nil {
+		trimmed := make([]map[string]interface{}, 0, len(response))
+		for _, batch := range response {
+			messages, err := selection.Apply(batch.Messages)
+			if err != nil {
+				ms.Log.WithContext(ctx).Error("Failed to apply field selection", "error", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to process messages")
+				return
+			}
+			trimmed = append(trimmed, map[string]interface{}{
+				"channel_id": batch.ChannelID,
+				"messages":   messages,
+				"has_more":   batch.HasMore,
+			})
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"channels": trimmed})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"channels": response})
+}
@@ -0,0 +1,138 @@
+package messageService
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/content"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/i18n"
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/preferences"
+)
+
+// EphemeralRequest represents the request body for an ephemeral message
+type EphemeralRequest struct {
+	UserID  int64  `json:"user_id"`
+	Content string `json:"content"`
+}
+
+// SendEphemeral delivers a message to one member of a channel through their
+// event streams. It is not stored as a message, so it never shows up in
+// history, search or exports, and is gone once the client that showed it
+// reloads.
+func SendEphemeral(ctx context.Context, db *sql.DB, msg events.MessageEphemeral) error {
+	if msg.CreatedAt == 0 {
+		msg.CreatedAt = time.Now().UTC().Unix()
+	}
+	if err := outbox.WriteTo(ctx, db, msg.ChannelID, msg.RecipientID, events.TypeMessageEphemeral, msg); err != nil {
+		return err
+	}
+	outbox.Notify()
+	return nil
+}
+
+// SendEphemeralMessage shows a message to one member of a channel only, for
+// integrations answering a command or hinting at a mistake. The sender must
+// be able to post in the channel and the recipient must be a member.
+func (ms *MessageService) SendEphemeralMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		ms.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	channelID, err := strconv.ParseInt(mux.Vars(r)["channel_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+
+	var req EphemeralRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	processed, err := content.Process(req.Content)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sender, err := ms.Queries.GetChannelMembership(ctx, channelID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusForbidden, "You are not a member of this channel")
+		return
+	}
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to check channel subscription", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify channel subscription")
+		return
+	}
+	canPost, err := ms.Queries.CanPost(ctx, channelID, userID)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to check posting permission", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify channel subscription")
+		return
+	}
+	if !canPost {
+		respondWithError(w, http.StatusForbidden, "Only channel admins can post in this announcement channel")
+		return
+	}
+	member, err := ms.Queries.IsChannelMember(ctx, channelID, req.UserID)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify channel subscription")
+		return
+	}
+	if !member {
+		respondWithError(w, http.StatusBadRequest, "The recipient is not a member of this channel")
+		return
+	}
+
+	msg := events.MessageEphemeral{
+		ChannelID:   channelID,
+		TeamID:      sender.TeamID,
+		UserID:      userID,
+		RecipientID: req.UserID,
+		Content:     processed.Content,
+		CreatedAt:   time.Now().UTC().Unix(),
+	}
+	if err := SendEphemeral(ctx, ms.DB, msg); err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to send ephemeral message", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to send message")
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, msg)
+}
+
+// userLocale is the locale of text shown to one user: their preference, else
+// their team's locale
+func (ms *MessageService) userLocale(ctx context.Context, userID, teamID int64) string {
+	if locale, err := preferences.Locale(ctx, ms.DB, userID); err == nil && locale != "" {
+		return locale
+	}
+	locale, err := i18n.TeamLocale(ctx, ms.DB, teamID)
+	if err != nil {
+		ms.Log.WithContext(ctx).Warn("Failed to get team locale", "error", err, "team_id", teamID)
+	}
+	return locale
+}
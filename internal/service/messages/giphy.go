@@ -0,0 +1,88 @@
+package messageService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nikhil/eaven/internal/giphy"
+	"github.com/nikhil/eaven/internal/models"
+)
+
+const (
+	defaultGiphyLimit = 25
+	// maxGiphyOffset is the deepest page Giphy serves
+	maxGiphyOffset = 4999
+)
+
+// ErrInvalidGiphy is returned for GIF messages whose giphy_id cannot be
+// posted
+var ErrInvalidGiphy = errors.New("giphy_id must be a GIF returned by GIF search")
+
+// SearchGiphy proxies a GIF search so clients never see the API key.
+// Results are cached by query.
+func (ms *MessageService) SearchGiphy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || len(query) > 50 {
+		respondWithError(w, http.StatusBadRequest, "q must be between 1 and 50 characters")
+		return
+	}
+	limit := defaultGiphyLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > giphy.MaxLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", giphy.MaxLimit))
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxGiphyOffset {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("offset must be between 0 and %d", maxGiphyOffset))
+			return
+		}
+		offset = n
+	}
+
+	result, err := giphy.Default().Search(ctx, query, limit, offset)
+	if errors.Is(err, giphy.ErrDisabled) {
+		respondWithError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("GIF search failed", "error", err)
+		respondWithError(w, http.StatusBadGateway, "GIF search failed")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// resolveGiphy looks up the GIF a message posts and stores its URL as the
+// content, rendered as an image of the right size
+func (ms *MessageService) resolveGiphy(ctx context.Context, messageBody *models.MessageBody) error {
+	id := strings.TrimSpace(messageBody.GiphyID)
+	if id == "" {
+		return ErrInvalidGiphy
+	}
+	gif, err := giphy.Default().Get(ctx, id)
+	if errors.Is(err, giphy.ErrDisabled) || errors.Is(err, giphy.ErrNotFound) {
+		return fmt.Errorf("%w: %v", ErrInvalidGiphy, err)
+	}
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to look up GIF", "error", err, "giphy_id", id)
+		return fmt.Errorf("failed to insert message: %v", err)
+	}
+	messageBody.GiphyID = gif.ID
+	messageBody.Content = gif.Original.URL
+	messageBody.RenderedHTML = fmt.Sprintf(`<img src="%s" width="%d" height="%d" alt="%s">`,
+		html.EscapeString(gif.Original.URL), gif.Original.Width, gif.Original.Height, html.EscapeString(gif.Title))
+	return nil
+}
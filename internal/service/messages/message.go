@@ -4,41 +4,100 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikhil/eaven/internal/commands"
+	"github.com/nikhil/eaven/internal/content"
 	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/e2e"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/featureflags"
+	"github.com/nikhil/eaven/internal/floodcontrol"
+	"github.com/nikhil/eaven/internal/i18n"
 	"github.com/nikhil/eaven/internal/logger"
 	"github.com/nikhil/eaven/internal/middleware"
 	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/moderation"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/queries"
+	"github.com/nikhil/eaven/internal/snowflake"
+	"github.com/nikhil/eaven/internal/unfurl"
 )
 
+// maxIDAttempts bounds the message IDs tried when one is already taken
+const maxIDAttempts = 3
+
 type MessageService struct {
-	DB  *sql.DB
-	Log *logger.Logger
+	DB *sql.DB
+	// Reader returns the pool for history reads, which may lag behind DB
+	// by a few seconds. It defaults to DB.
+	Reader  func() *sql.DB
+	Queries *queries.Queries
+	Log     *logger.Logger
 }
 
-func NewMessageService() *MessageService {
+func NewMessageService(db *sql.DB, q *queries.Queries, log *logger.Logger) *MessageService {
 	return &MessageService{
-		DB:  database.DB,
-		Log: logger.NewLogger("message-service"),
+		DB:      db,
+		Reader:  func() *sql.DB { return db },
+		Queries: q,
+		Log:     log,
 	}
 }
 
+// MentionCondition is the SQL predicate deciding whether message m mentions
+// user u: the user's @handle, a handle they changed away from that was
+// still redirecting when m was sent, or the whole channel via @channel /
+// @here. Queries must alias the tables as m and u.
+const MentionCondition = `((u.handle <> '' AND m.content LIKE CONCAT('%@', u.handle, '%'))
+	OR EXISTS(SELECT 1 FROM handle_redirects hr
+		WHERE hr.user_id = u.user_id AND hr.expires_at > m.message_created_at
+			AND m.content LIKE CONCAT('%@', hr.handle, '%'))
+	OR m.content LIKE '%@channel%'
+	OR m.content LIKE '%@here%')`
+
 type sendMessageRequest struct {
 	ChannelID int64  `json:"channel_id"`
 	Content   string `json:"content"`
+	// ClientMessageID is an optional client-generated ID echoed back so the
+	// client can match the response to its optimistic message
+	ClientMessageID string `json:"client_message_id,omitempty"`
+	// ReplyToID quotes another message of the same channel
+	ReplyToID int64 `json:"reply_to_id,omitempty"`
+	// ContentType "e2e" sends EncryptedPayload, an opaque base64 blob, in
+	// place of Content. Only private channels accept it.
+	ContentType      string `json:"content_type,omitempty"`
+	EncryptedPayload string `json:"encrypted_payload,omitempty"`
+	// AttachmentIDs sends files uploaded to the channel with the message
+	AttachmentIDs []int64 `json:"attachment_ids,omitempty"`
+	// GiphyID is the GIF a content_type "giphy" message posts, as returned
+	// by GIF search
+	GiphyID string `json:"giphy_id,omitempty"`
+}
+
+type sendMessageResponse struct {
+	Message         string             `json:"message"`
+	MessageID       int64              `json:"message_id"`
+	MessageTime     int64              `json:"message_created_at"`
+	ClientMessageID string             `json:"client_message_id,omitempty"`
+	Data            models.MessageBody `json:"data"`
 }
 
+// ErrChannelArchived is returned when posting to an archived channel
+var ErrChannelArchived = errors.New("channel is archived")
+
 func (ms *MessageService) SendMessage(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		ms.Log.Error("Failed to extract user details from context")
+		ms.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -46,70 +105,311 @@ func (ms *MessageService) SendMessage(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		ms.Log.Error("Invalid user ID in token", "error", err)
+		ms.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	var messageBody sendMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&messageBody); err != nil {
-		ms.Log.Error("Failed to decode request body", "error", err)
+		ms.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-	// ms.Log.Info("User : ", userID, messageBody.ChannelID)
-	// fmt.Println(userID, messageBody.ChannelID)
-	var channelUserData models.ChannelUserDataStruct
-	memberQuery := `SELECT C.channel_id , CM.user_id , T.team_id , U.first_name , U.last_name  , C.channel_name
-					FROM channel_members CM
-					INNER JOIN channels C on C.channel_id = CM.channel_id
-					INNER JOIN teams T on C.team_id = T.team_id
-					INNER JOIN users U on U.user_id = CM.user_id
-					INNER JOIN user_teams_mapper UTM on UTM.user_id = CM.user_id and UTM.team_id = C.team_id
-					WHERE CM.channel_id = ?  and CM.user_id = ?`
-	err = ms.DB.QueryRowContext(ctx, memberQuery, messageBody.ChannelID, userID).Scan(&channelUserData.ChannelID, &channelUserData.UserID, &channelUserData.TeamID, &channelUserData.FirstName, &channelUserData.LastName, &channelUserData.ChannelName)
-	if err != nil {
-		ms.Log.Error("Failed to check channel subscription", "error", err)
+	channelUserData, err := ms.Queries.GetChannelMembership(ctx, messageBody.ChannelID, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ms.Log.WithContext(ctx).Error("Failed to check channel subscription", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to verify channel subscription")
 		return
 	}
 
 	if channelUserData.ChannelID == 0 {
-		ms.Log.Error("User is not a member of the channel", "error", err)
+		ms.Log.WithContext(ctx).Warn("User is not a member of the channel", "channel_id", messageBody.ChannelID, "user_id", userID)
 		respondWithError(w, http.StatusUnauthorized, "User is not a member of the channel")
 		return
 	}
+	ctx = logger.ContextWithFields(ctx, "team_id", channelUserData.TeamID, "channel_id", channelUserData.ChannelID)
 
-	currentTime := time.Now().UTC().Unix()
+	// Slash commands are answered to the sender instead of being posted. The
+	// answer also goes to the sender's streams as an ephemeral message, so
+	// it shows in the channel on each of their clients.
+	if handler, inv, ok := commands.Lookup(messageBody.Content); ok {
+		inv.UserID = userID
+		inv.ChannelID = channelUserData.ChannelID
+		inv.TeamID = channelUserData.TeamID
+		response, err := handler(ctx, inv)
+		hint := events.MessageEphemeral{
+			ChannelID:   inv.ChannelID,
+			TeamID:      inv.TeamID,
+			RecipientID: userID,
+			Content:     response.Text,
+			Command:     inv.Name,
+		}
+		if err != nil {
+			ms.Log.WithContext(ctx).Error("Slash command failed", "error", err, "command", inv.Name)
+			hint.Content = i18n.Text(ms.userLocale(ctx, userID, inv.TeamID), "command.failed", "command", inv.Name)
+		}
+		if hint.Content != "" {
+			if err := SendEphemeral(ctx, ms.DB, hint); err != nil {
+				ms.Log.WithContext(ctx).Warn("Failed to send command response", "error", err, "command", inv.Name)
+			}
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to run command")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"command": inv.Name, "response": response})
+		return
+	}
+
+	canPost, err := ms.Queries.CanPost(ctx, channelUserData.ChannelID, userID)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to check posting permission", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify channel subscription")
+		return
+	}
+	if !canPost {
+		respondWithError(w, http.StatusForbidden, "Only channel admins can post in this announcement channel")
+		return
+	}
+
+	now := time.Now().UTC()
+	flood, err := floodcontrol.Check(ctx, ms.DB, channelUserData.ChannelID, userID, now)
+	if err != nil {
+		// Fail open rather than stop everyone from posting
+		ms.Log.WithContext(ctx).Warn("Flood control check failed", "error", err)
+	}
+	if flood.Muted {
+		retryAfter := flood.RetryAfter(now)
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		respondWithJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"error":       "You are posting too fast. Please wait before sending more messages to this channel.",
+			"muted_until": flood.MutedUntil,
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	currentTime := now.Unix()
 
 	msg := models.MessageBody{
-		ChannelID:   messageBody.ChannelID,
-		UserID:      userID,
-		Content:     messageBody.Content,
-		MessageTime: currentTime,
+		ChannelID:        messageBody.ChannelID,
+		UserID:           userID,
+		Content:          messageBody.Content,
+		MessageTime:      currentTime,
+		ReplyToID:        messageBody.ReplyToID,
+		ContentType:      messageBody.ContentType,
+		EncryptedPayload: messageBody.EncryptedPayload,
+		AttachmentIDs:    messageBody.AttachmentIDs,
+		GiphyID:          messageBody.GiphyID,
 	}
 
-	_, err = ms.SaveMessage(ctx, msg)
+	saved, err := ms.SaveMessage(ctx, msg)
 	if err != nil {
+		if errors.Is(err, content.ErrInvalidContent) || errors.Is(err, ErrInvalidReply) || errors.Is(err, ErrInvalidAttachments) || errors.Is(err, ErrInvalidGiphy) ||
+			errors.Is(err, e2e.ErrInvalidPayload) || errors.Is(err, e2e.ErrNotPrivate) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, moderation.ErrBlocked) {
+			respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if errors.Is(err, ErrChannelArchived) {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+		var disabled *featureflags.DisabledError
+		if errors.As(err, &disabled) {
+			respondWithJSON(w, http.StatusForbidden, disabled.Body())
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Failed to insert message")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Message sent successfully"})
+	respondWithJSON(w, http.StatusOK, sendMessageResponse{
+		Message:         "Message sent successfully",
+		MessageID:       saved.MessageID,
+		MessageTime:     saved.MessageTime,
+		ClientMessageID: messageBody.ClientMessageID,
+		Data:            saved,
+	})
 }
 
-func (ms *MessageService) SaveMessage(ctx context.Context, messageBody models.MessageBody) (bool, error) {
-	// Insert the message into the database
-	query := `INSERT INTO messages (channel_id, user_id, content, message_created_at) VALUES (?, ?, ? , ?)`
-	_, err := ms.DB.ExecContext(ctx, query, messageBody.ChannelID, messageBody.UserID, messageBody.Content, messageBody.MessageTime)
+// SaveMessage validates and stores a message, returning it as persisted with
+// its ID and sanitized content
+func (ms *MessageService) SaveMessage(ctx context.Context, messageBody models.MessageBody) (models.MessageBody, error) {
+	channel, err := ms.Queries.GetChannel(ctx, messageBody.ChannelID)
 	if err != nil {
-		ms.Log.Error("Failed to insert message", "error", err)
-		return false, fmt.Errorf("failed to insert message: %v", err)
+		ms.Log.WithContext(ctx).Error("Failed to load channel", "error", err)
+		return models.MessageBody{}, fmt.Errorf("failed to insert message: %v", err)
+	}
+	if channel.ArchivedAt > 0 {
+		return models.MessageBody{}, ErrChannelArchived
 	}
 
-	// trigger messages to channel users
+	var verdict moderation.Result
+	switch messageBody.ContentType {
+	case models.ContentTypeEncrypted:
+		// The server cannot read encrypted messages, so content checks,
+		// moderation and link previews do not apply; the payload is relayed
+		// as it is
+		if err := featureflags.Require(ctx, channel.TeamID, featureflags.EncryptedMessages); err != nil {
+			return models.MessageBody{}, err
+		}
+		if !channel.IsPrivate {
+			return models.MessageBody{}, e2e.ErrNotPrivate
+		}
+		if err := e2e.ValidatePayload(messageBody.EncryptedPayload); err != nil {
+			return models.MessageBody{}, err
+		}
+		messageBody.Content = ""
+		messageBody.RenderedHTML = ""
+	case models.ContentTypeGiphy:
+		if err := featureflags.Require(ctx, channel.TeamID, featureflags.GiphyMessages); err != nil {
+			return models.MessageBody{}, err
+		}
+		if err := ms.resolveGiphy(ctx, &messageBody); err != nil {
+			return models.MessageBody{}, err
+		}
+		messageBody.EncryptedPayload = ""
+	case "", models.ContentTypeText:
+		messageBody.ContentType = models.ContentTypeText
+		messageBody.EncryptedPayload = ""
+		// Files can be sent without any text
+		if len(messageBody.AttachmentIDs) > 0 && strings.TrimSpace(messageBody.Content) == "" {
+			messageBody.Content = ""
+		} else if verdict, err = ms.screenContent(ctx, channel.TeamID, &messageBody); err != nil {
+			return models.MessageBody{}, err
+		}
+	default:
+		return models.MessageBody{}, fmt.Errorf("%w: content_type must be text, e2e or giphy", content.ErrInvalidContent)
+	}
 
-	return true, nil
+	// The message and its event commit together, so a crash cannot store a
+	// message that never notifies anyone
+	tx, err := ms.DB.BeginTx(ctx, nil)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to start transaction", "error", err)
+		return models.MessageBody{}, fmt.Errorf("failed to insert message: %v", err)
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	qtx := ms.Queries.WithTx(tx)
+	if messageBody.ReplyToID != 0 {
+		quoted, err := qtx.GetChannelMessage(ctx, messageBody.ReplyToID, messageBody.ChannelID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.MessageBody{}, ErrInvalidReply
+		}
+		if err != nil {
+			ms.Log.WithContext(ctx).Error("Failed to load quoted message", "error", err, "reply_to_id", messageBody.ReplyToID)
+			return models.MessageBody{}, fmt.Errorf("failed to insert message: %v", err)
+		}
+		quoted.Snippet = snippet(quoted.Snippet)
+		messageBody.ReplyTo = &quoted
+	}
+	// Processes sharing a snowflake node can pick the same ID in the same
+	// tick; a failed insert leaves the transaction usable, so try another
+	for attempt := 0; ; attempt++ {
+		messageBody.MessageID = snowflake.Default().Next()
+		err = qtx.InsertMessage(ctx, messageBody)
+		if err == nil || !database.IsDuplicate(err) || attempt == maxIDAttempts-1 {
+			break
+		}
+	}
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to insert message", "error", err)
+		return models.MessageBody{}, fmt.Errorf("failed to insert message: %v", err)
+	}
+	if err := attachFiles(ctx, tx, messageBody); err != nil {
+		if !errors.Is(err, ErrInvalidAttachments) {
+			ms.Log.WithContext(ctx).Error("Failed to attach files to message", "error", err)
+		}
+		return models.MessageBody{}, err
+	}
+	if verdict.Review {
+		err = moderation.Enqueue(ctx, tx, moderation.Item{
+			MessageID: messageBody.MessageID,
+			ChannelID: messageBody.ChannelID,
+			TeamID:    channel.TeamID,
+			UserID:    messageBody.UserID,
+			Content:   messageBody.Content,
+			Findings:  verdict.Findings,
+		})
+		if err != nil {
+			ms.Log.WithContext(ctx).Error("Failed to queue message for review", "error", err)
+			return models.MessageBody{}, fmt.Errorf("failed to insert message: %v", err)
+		}
+	}
+	event := events.MessageCreated{
+		MessageID:        messageBody.MessageID,
+		ChannelID:        messageBody.ChannelID,
+		TeamID:           channel.TeamID,
+		UserID:           messageBody.UserID,
+		Content:          messageBody.Content,
+		RenderedHTML:     messageBody.RenderedHTML,
+		CreatedAt:        messageBody.MessageTime,
+		ReplyToID:        messageBody.ReplyToID,
+		ContentType:      messageBody.ContentType,
+		EncryptedPayload: messageBody.EncryptedPayload,
+		AttachmentIDs:    messageBody.AttachmentIDs,
+	}
+	if q := messageBody.ReplyTo; q != nil {
+		event.ReplyTo = &events.Quote{MessageID: q.MessageID, UserID: q.UserID, Snippet: q.Snippet, CreatedAt: q.MessageTime}
+	}
+	err = outbox.Write(ctx, tx, messageBody.ChannelID, events.TypeMessageCreated, event)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to write message event", "error", err)
+		return models.MessageBody{}, fmt.Errorf("failed to insert message: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		ms.Log.WithContext(ctx).Error("Failed to commit message", "error", err)
+		return models.MessageBody{}, fmt.Errorf("failed to insert message: %v", err)
+	}
+	outbox.Notify()
+	savedMessages.record(time.Now())
+
+	if messageBody.ContentType == models.ContentTypeText {
+		// Link previews are generated in the background so sending stays fast
+		unfurl.Enqueue(messageBody.MessageID, messageBody.Content)
+	}
+	shadowMessage(ms.DB, messageBody)
+
+	return messageBody, nil
+}
+
+// screenContent validates and sanitizes a plain message and applies the
+// team's moderation policy to it
+func (ms *MessageService) screenContent(ctx context.Context, teamID int64, messageBody *models.MessageBody) (moderation.Result, error) {
+	processed, err := content.Process(messageBody.Content)
+	if err != nil {
+		return moderation.Result{}, err
+	}
+	messageBody.Content = processed.Content
+	messageBody.RenderedHTML = processed.HTML
+
+	// Moderation fails open: a broken classifier must not stop people from
+	// talking, so its error is logged and the message posts with whatever
+	// the other classifiers decided
+	verdict, err := moderation.Check(ctx, ms.DB, teamID, messageBody.Content)
+	if err != nil {
+		ms.Log.WithContext(ctx).Warn("Moderation check failed", "error", err, "team_id", teamID)
+	}
+	if verdict.Blocked {
+		ms.Log.WithContext(ctx).Info("Message blocked by moderation policy", "team_id", teamID,
+			"channel_id", messageBody.ChannelID, "reasons", moderation.Reasons(verdict.Findings))
+		return moderation.Result{}, moderation.ErrBlocked
+	}
+	if verdict.Content != messageBody.Content {
+		processed, err = content.Process(verdict.Content)
+		if err != nil {
+			return moderation.Result{}, err
+		}
+		messageBody.Content = processed.Content
+		messageBody.RenderedHTML = processed.HTML
+	}
+	return verdict, nil
 }
 
 func respondWithError(w http.ResponseWriter, code int, message string) {
@@ -0,0 +1,72 @@
+package messageService
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/nikhil/eaven/internal/history"
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// maxSnippetRunes bounds the quoted text returned with a reply
+const maxSnippetRunes = 200
+
+// ErrInvalidReply is returned when a reply quotes a message outside its channel
+var ErrInvalidReply = errors.New("reply_to_id must reference a message in the same channel")
+
+// snippet shortens quoted content for inline display
+func snippet(content string) string {
+	runes := []rune(content)
+	if len(runes) <= maxSnippetRunes {
+		return content
+	}
+	return strings.TrimSpace(string(runes[:maxSnippetRunes])) + "..."
+}
+
+// loadQuotes fetches the snippets of the messages quoted by msgs and attaches
+// them. Quotes whose message was deleted stay nil.
+func loadQuotes(ctx context.Context, db *sql.DB, msgs []*models.MessageBody) error {
+	var ids []interface{}
+	seen := make(map[int64]bool)
+	for _, m := range msgs {
+		if m.ReplyToID != 0 && !seen[m.ReplyToID] {
+			seen[m.ReplyToID] = true
+			ids = append(ids, m.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	query, args := history.Union(`
+		SELECT message_id, user_id, content, message_created_at
+		FROM {messages}
+		WHERE message_id IN (`+placeholders+`)`, ids...)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	quotes := make(map[int64]*models.QuotedMessage, len(ids))
+	for rows.Next() {
+		var q models.QuotedMessage
+		if err := rows.Scan(&q.MessageID, &q.UserID, &q.Snippet, &q.MessageTime); err != nil {
+			return err
+		}
+		q.Snippet = snippet(q.Snippet)
+		quotes[q.MessageID] = &q
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.ReplyToID != 0 {
+			m.ReplyTo = quotes[m.ReplyToID]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package messageService
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is how many seconds the message rate is averaged over
+const rateWindow = 60
+
+// MessageRate reports the messages saved by this process
+type MessageRate struct {
+	// Total counts the messages saved since startup
+	Total int64 `json:"total"`
+	// PerSecond is the average over the last minute
+	PerSecond float64 `json:"per_second"`
+	// PeakPerSecond is the busiest second of the last minute
+	PeakPerSecond int64 `json:"peak_per_second"`
+}
+
+// rateMeter counts events in one-second buckets over the last rateWindow
+// seconds
+type rateMeter struct {
+	mu      sync.Mutex
+	total   int64
+	buckets [rateWindow]int64
+	// seconds holds the Unix second each bucket counts, so buckets left
+	// from an earlier minute are ignored
+	seconds [rateWindow]int64
+}
+
+var savedMessages rateMeter
+
+func (m *rateMeter) record(now time.Time) {
+	sec := now.Unix()
+	i := sec % rateWindow
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.buckets[i] = 0
+	}
+	m.buckets[i]++
+	m.total++
+}
+
+func (m *rateMeter) rate(now time.Time) MessageRate {
+	sec := now.Unix()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := MessageRate{Total: m.total}
+	var sum int64
+	for i := range m.buckets {
+		// The current second is still filling, so the window is the
+		// rateWindow seconds before it
+		if age := sec - m.seconds[i]; age >= 1 && age <= rateWindow {
+			sum += m.buckets[i]
+			r.PeakPerSecond = max(r.PeakPerSecond, m.buckets[i])
+		}
+	}
+	r.PerSecond = float64(sum) / rateWindow
+	return r
+}
+
+// GetMessageRate returns how fast this process has been saving messages
+func GetMessageRate() MessageRate {
+	return savedMessages.rate(time.Now())
+}
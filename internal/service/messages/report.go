@@ -0,0 +1,80 @@
+package messageService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/moderation"
+)
+
+// ReportRequest represents the request body for reporting a message
+type ReportRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// ReportMessage files an abuse report against a message and tells the
+// owners of its team. Any member of the message's channel can report it.
+func (ms *MessageService) ReportMessage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		ms.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		ms.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	messageID, err := strconv.ParseInt(mux.Vars(r)["message_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid message ID")
+		return
+	}
+
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	report, err := moderation.FileMessageReport(ctx, ms.DB, userID, messageID, req.Reason, req.Details)
+	switch {
+	case err == nil:
+	case errors.Is(err, moderation.ErrInvalidReport):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, moderation.ErrReportTargetNotFound):
+		respondWithError(w, http.StatusNotFound, "Message not found")
+		return
+	case errors.Is(err, moderation.ErrDuplicateReport):
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		ms.Log.WithContext(ctx).Error("Failed to file message report", "error", err, "message_id", messageID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to report message")
+		return
+	}
+
+	ms.Log.WithContext(ctx).Audit("Message reported", "report_id", report.ReportID, "message_id", messageID, "team_id", report.TeamID, "reason", report.Reason)
+
+	// The report is stored, so a failed email is only logged
+	if _, err := moderation.NotifyReport(ctx, ms.DB, report); err != nil {
+		ms.Log.WithContext(ctx).Warn("Failed to notify team owners of report", "error", err, "report_id", report.ReportID)
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":   "Thanks, the report was sent to your team's administrators",
+		"report_id": report.ReportID,
+	})
+}
@@ -0,0 +1,167 @@
+package messageService
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikhil/eaven/internal/fanout"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/models"
+)
+
+const shadowQueueSize = 256
+
+// shadowRun holds the shadow comparison state; nil until StartShadow enables it
+type shadowRun struct {
+	percent int
+	jobs    chan shadowJob
+	log     *logger.Logger
+
+	sampled  atomic.Int64
+	compared atomic.Int64
+	diverged atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+}
+
+var shadow atomic.Pointer[shadowRun]
+
+// shadowJob is a saved message and the database of the service that saved it
+type shadowJob struct {
+	db  *sql.DB
+	msg models.MessageBody
+}
+
+// ShadowStats reports how the fan-out pipeline compares with the current
+// synchronous path on sampled messages
+type ShadowStats struct {
+	Percent  int   `json:"percent"`
+	Sampled  int64 `json:"sampled"`
+	Compared int64 `json:"compared"`
+	Diverged int64 `json:"diverged"`
+	Failed   int64 `json:"failed"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// StartShadow runs a share of saved messages through the fan-out pipeline as
+// well, in the background, and compares its recipients and mentions with the
+// ones the current SQL reports. The pipeline's results are discarded.
+// MESSAGE_PIPELINE_SHADOW_PERCENT sets the share (default 0, disabled).
+func StartShadow() {
+	percent, err := strconv.Atoi(os.Getenv("MESSAGE_PIPELINE_SHADOW_PERCENT"))
+	if err != nil || percent <= 0 {
+		return
+	}
+	if percent > 100 {
+		percent = 100
+	}
+
+	s := &shadowRun{
+		percent: percent,
+		jobs:    make(chan shadowJob, shadowQueueSize),
+		log:     logger.NewLogger("message-pipeline-shadow"),
+	}
+	go s.run()
+	shadow.Store(s)
+}
+
+// GetShadowStats returns the shadow comparison counters since startup
+func GetShadowStats() ShadowStats {
+	s := shadow.Load()
+	if s == nil {
+		return ShadowStats{}
+	}
+	return ShadowStats{
+		Percent:  s.percent,
+		Sampled:  s.sampled.Load(),
+		Compared: s.compared.Load(),
+		Diverged: s.diverged.Load(),
+		Failed:   s.failed.Load(),
+		Dropped:  s.dropped.Load(),
+	}
+}
+
+// shadowMessage samples a saved message for comparison. It never blocks the
+// write; when the queue is full the message is dropped.
+func shadowMessage(db *sql.DB, msg models.MessageBody) {
+	s := shadow.Load()
+	if s == nil || rand.Intn(100) >= s.percent {
+		return
+	}
+	s.sampled.Add(1)
+	select {
+	case s.jobs <- shadowJob{db: db, msg: msg}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *shadowRun) run() {
+	for job := range s.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		s.compare(ctx, job.db, job.msg)
+		cancel()
+	}
+}
+
+func (s *shadowRun) compare(ctx context.Context, db *sql.DB, msg models.MessageBody) {
+	ctx = logger.ContextWithFields(ctx, "message_id", msg.MessageID, "channel_id", msg.ChannelID)
+	planned, err := fanout.Plan(ctx, db, msg)
+	if err != nil {
+		s.failed.Add(1)
+		s.log.WithContext(ctx).Error("Failed to plan shadow delivery", "error", err)
+		return
+	}
+	current, err := currentDelivery(ctx, db, msg)
+	if err != nil {
+		s.failed.Add(1)
+		s.log.WithContext(ctx).Error("Failed to load current delivery", "error", err)
+		return
+	}
+	s.compared.Add(1)
+
+	missingRecipients, extraRecipients := fanout.Diff(current.Recipients, planned.Recipients)
+	missingMentions, extraMentions := fanout.Diff(current.Mentioned, planned.Mentioned)
+	if len(missingRecipients)+len(extraRecipients)+len(missingMentions)+len(extraMentions) == 0 {
+		return
+	}
+	s.diverged.Add(1)
+	s.log.WithContext(ctx).Warn("Message pipeline diverged",
+		"missing_recipients", missingRecipients, "extra_recipients", extraRecipients,
+		"missing_mentions", missingMentions, "extra_mentions", extraMentions)
+}
+
+// currentDelivery reads the recipients and mentions of a stored message the
+// way unread and mention counts see them today
+func currentDelivery(ctx context.Context, db *sql.DB, msg models.MessageBody) (fanout.Delivery, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.user_id, `+MentionCondition+` AS mentioned
+		FROM messages m
+		INNER JOIN channel_members cm ON cm.channel_id = m.channel_id AND cm.user_id <> m.user_id
+		INNER JOIN users u ON u.user_id = cm.user_id
+		WHERE m.message_id = ?
+		ORDER BY u.user_id`, msg.MessageID)
+	if err != nil {
+		return fanout.Delivery{}, err
+	}
+	defer rows.Close()
+
+	d := fanout.Delivery{MessageID: msg.MessageID, ChannelID: msg.ChannelID}
+	for rows.Next() {
+		var userID int64
+		var mentioned bool
+		if err := rows.Scan(&userID, &mentioned); err != nil {
+			return fanout.Delivery{}, err
+		}
+		d.Recipients = append(d.Recipients, userID)
+		if mentioned {
+			d.Mentioned = append(d.Mentioned, userID)
+		}
+	}
+	return d, rows.Err()
+}
@@ -0,0 +1,136 @@
+package teamService
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nikhil/eaven/internal/bots"
+	"github.com/nikhil/eaven/internal/content"
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/i18n"
+	"github.com/nikhil/eaven/internal/outbox"
+)
+
+// Ways an announcement reaches the team
+const (
+	// deliverChannels posts it to every default channel
+	deliverChannels = "channels"
+	// deliverNotify sends it to every member directly, outside any channel
+	deliverNotify = "notify"
+)
+
+// AnnounceRequest represents the request body for a team announcement.
+// Delivery is "channels" (the default) or "notify".
+type AnnounceRequest struct {
+	Content  string `json:"content"`
+	Delivery string `json:"delivery"`
+}
+
+// AnnounceResponse reports how an announcement was delivered. Targets are
+// the default channels, or the members when notifying; Recipients counts
+// the members reached.
+type AnnounceResponse struct {
+	TeamID     int64  `json:"team_id"`
+	Delivery   string `json:"delivery"`
+	Targets    int    `json:"targets"`
+	Delivered  int    `json:"delivered"`
+	Failed     int    `json:"failed"`
+	Recipients int    `json:"recipients"`
+}
+
+// Announce sends an announcement to the whole team: posted by the
+// announcements bot to each of the team's public channels, or delivered to
+// every member as a team.announcement event. Only team owners can announce.
+func (ts *TeamService) Announce(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to announce to this team")
+		return
+	}
+
+	var req AnnounceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Delivery == "" {
+		req.Delivery = deliverChannels
+	}
+	if req.Delivery != deliverChannels && req.Delivery != deliverNotify {
+		respondWithError(w, http.StatusBadRequest, "delivery must be channels or notify")
+		return
+	}
+	processed, err := content.Process(req.Content)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := AnnounceResponse{TeamID: teamID, Delivery: req.Delivery}
+	if req.Delivery == deliverNotify {
+		memberIDs, err := ts.Queries.ListTeamMemberIDs(ctx, teamID)
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to list team members", "error", err, "team_id", teamID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to send announcement")
+			return
+		}
+		announcement := events.TeamAnnouncement{
+			TeamID:    teamID,
+			UserID:    userID,
+			Content:   processed.Content,
+			CreatedAt: time.Now().UTC().Unix(),
+		}
+		resp.Targets = len(memberIDs)
+		for _, memberID := range memberIDs {
+			if err := outbox.WriteTo(ctx, ts.DB, 0, memberID, events.TypeTeamAnnouncement, announcement); err != nil {
+				ts.Log.WithContext(ctx).Error("Failed to write team announcement", "error", err, "team_id", teamID, "recipient_id", memberID)
+				resp.Failed++
+				continue
+			}
+			resp.Delivered++
+		}
+		resp.Recipients = resp.Delivered
+		outbox.Notify()
+	} else {
+		channels, err := ts.Queries.ListDefaultChannels(ctx, teamID)
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to list default channels", "error", err, "team_id", teamID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to send announcement")
+			return
+		}
+		if resp.Recipients, err = ts.Queries.CountDefaultChannelMembers(ctx, teamID); err != nil {
+			ts.Log.WithContext(ctx).Warn("Failed to count announcement recipients", "error", err, "team_id", teamID)
+		}
+
+		// Posted in every channel, so it is in the team's language
+		locale, err := i18n.TeamLocale(ctx, ts.DB, teamID)
+		if err != nil {
+			ts.Log.WithContext(ctx).Warn("Failed to get team locale", "error", err, "team_id", teamID)
+		}
+		var name string
+		if err := ts.DB.QueryRowContext(ctx, `SELECT first_name FROM users WHERE user_id = ?`, userID).Scan(&name); err != nil {
+			ts.Log.WithContext(ctx).Warn("Failed to get announcer name", "error", err, "user_id", userID)
+		}
+		text := i18n.Text(locale, "team.announcement", "name", name, "text", processed.Content)
+
+		resp.Targets = len(channels)
+		for _, channel := range channels {
+			if err := bots.AnnouncementBot.Post(ctx, channel.ChannelID, text); err != nil {
+				ts.Log.WithContext(ctx).Error("Failed to post team announcement", "error", err, "channel_id", channel.ChannelID)
+				resp.Failed++
+				continue
+			}
+			resp.Delivered++
+		}
+	}
+
+	ts.Log.WithContext(ctx).Audit("Team announcement sent", "team_id", teamID, "user_id", userID,
+		"delivery", resp.Delivery, "delivered", resp.Delivered, "failed", resp.Failed)
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,179 @@
+package teamService
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/handles"
+	"github.com/nikhil/eaven/internal/queries"
+)
+
+const (
+	maxAutocompleteResults = 10
+	// autocompleteBudget bounds how long the lookups may take. Pickers fire
+	// on every keystroke, so a late answer is worth less than a partial one.
+	autocompleteBudget = 150 * time.Millisecond
+	autocompleteTTL    = 30 * time.Second
+	// maxAutocompleteEntries bounds the cache; it is emptied when full
+	maxAutocompleteEntries = 10000
+)
+
+// ChannelMatch is a channel found by autocomplete
+type ChannelMatch struct {
+	ChannelID int64  `json:"channel_id"`
+	Slug      string `json:"slug"`
+	Name      string `json:"channel_name"`
+	IsPrivate bool   `json:"is_private"`
+	IsMember  bool   `json:"is_member"`
+}
+
+// Autocomplete holds the suggestions for a prefix. Partial is set when a
+// lookup ran out of time and its list was left empty.
+type Autocomplete struct {
+	Members  []MemberMatch  `json:"members"`
+	Channels []ChannelMatch `json:"channels"`
+	Partial  bool           `json:"partial"`
+}
+
+type autocompleteKey struct {
+	teamID, userID int64
+	q              string
+}
+
+type cachedAutocomplete struct {
+	result    Autocomplete
+	expiresAt time.Time
+}
+
+// Channels visible to a user differ, so entries are per user
+var autocompleteCache = struct {
+	sync.Mutex
+	entries map[autocompleteKey]cachedAutocomplete
+}{entries: make(map[autocompleteKey]cachedAutocomplete)}
+
+// Autocomplete suggests members and channels starting with q, for the
+// @mention and #channel pickers. A leading @ or # limits the answer to
+// members or channels. Members whose handle matches come before name matches,
+// and channels the user is in come first. Lookups that miss the latency
+// budget are skipped and the answer is marked partial; complete answers are
+// cached for a short while.
+func (ts *TeamService) Autocomplete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	raw := strings.TrimSpace(r.URL.Query().Get("q"))
+	// Guests cannot look up the team's members, as in member search
+	wantMembers := !strings.HasPrefix(raw, "#") && role != queries.TeamRoleGuest
+	wantChannels := !strings.HasPrefix(raw, "@")
+	q := handles.Normalize(strings.TrimPrefix(raw, "#"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	key := autocompleteKey{teamID: teamID, userID: userID, q: raw}
+	autocompleteCache.Lock()
+	cached, hit := autocompleteCache.entries[key]
+	autocompleteCache.Unlock()
+	if hit && time.Now().Before(cached.expiresAt) {
+		respondWithJSON(w, http.StatusOK, cached.result)
+		return
+	}
+
+	budget, cancel := context.WithTimeout(ctx, autocompleteBudget)
+	defer cancel()
+
+	result := Autocomplete{Members: []MemberMatch{}, Channels: []ChannelMatch{}}
+	var membersErr, channelsErr error
+	var wg sync.WaitGroup
+	if wantMembers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			members, err := ts.findMembers(budget, teamID, q, maxAutocompleteResults)
+			if err == nil {
+				result.Members = members
+			}
+			membersErr = err
+		}()
+	}
+	if wantChannels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			channels, err := ts.findChannels(budget, teamID, userID, role == queries.TeamRoleGuest, q)
+			if err == nil {
+				result.Channels = channels
+			}
+			channelsErr = err
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range []error{membersErr, channelsErr} {
+		if err == nil {
+			continue
+		}
+		if budget.Err() == nil {
+			ts.Log.WithContext(ctx).Error("Failed to autocomplete", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to autocomplete")
+			return
+		}
+		result.Partial = true
+	}
+	if result.Partial {
+		ts.Log.WithContext(ctx).Warn("Autocomplete ran over its latency budget", "team_id", teamID, "budget_ms", autocompleteBudget.Milliseconds())
+		respondWithJSON(w, http.StatusOK, result)
+		return
+	}
+
+	autocompleteCache.Lock()
+	if len(autocompleteCache.entries) >= maxAutocompleteEntries {
+		autocompleteCache.entries = make(map[autocompleteKey]cachedAutocomplete)
+	}
+	autocompleteCache.entries[key] = cachedAutocomplete{result: result, expiresAt: time.Now().Add(autocompleteTTL)}
+	autocompleteCache.Unlock()
+
+	respondWithJSON(w, http.StatusOK, result)
+}
+
+// findChannels returns the unarchived channels of the team the user can see
+// whose slug or name starts with q: the ones they are in, plus public ones
+// unless they are a guest
+func (ts *TeamService) findChannels(ctx context.Context, teamID, userID int64, guest bool, q string) ([]ChannelMatch, error) {
+	prefix := likePrefix(q)
+	rows, err := ts.Reader().QueryContext(ctx, `
+		SELECT c.channel_id, c.slug, c.channel_name, c.is_private, cm.user_id IS NOT NULL AS is_member
+		FROM channels c
+		LEFT JOIN channel_members cm ON cm.channel_id = c.channel_id AND cm.user_id = ?
+		WHERE c.team_id = ? AND c.archived_at = 0
+			AND (cm.user_id IS NOT NULL OR (c.is_private = 0 AND ? = 0))
+			AND (c.slug LIKE ? OR c.channel_name LIKE ?)
+		ORDER BY is_member DESC, c.slug LIKE ? DESC, CHAR_LENGTH(c.slug), c.slug
+		LIMIT ?`, userID, teamID, guest, prefix, prefix, prefix, maxAutocompleteResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []ChannelMatch{}
+	for rows.Next() {
+		var c ChannelMatch
+		if err := rows.Scan(&c.ChannelID, &c.Slug, &c.Name, &c.IsPrivate, &c.IsMember); err != nil {
+			return nil, err
+		}
+		channels = append(channels, c)
+	}
+	return channels, rows.Err()
+}
@@ -0,0 +1,84 @@
+package teamService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ChannelOrderRequest lists the user's channels of a team in the order
+// their sidebar shows them
+type ChannelOrderRequest struct {
+	ChannelIDs []int64 `json:"channel_ids"`
+}
+
+// SetChannelOrder saves the user's manual order of their channels in a
+// team. Listed channels are ordered as given; the others are unordered and
+// follow them. Starred channels still come first. An empty list clears the
+// order.
+func (ts *TeamService) SetChannelOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	var req ChannelOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tx, err := ts.DB.BeginTx(ctx, nil)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	qtx := ts.Queries.WithTx(tx)
+	currentTime := time.Now().UTC().Unix()
+	if err := qtx.ClearChannelOrder(ctx, teamID, userID, currentTime); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to clear channel order", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save channel order")
+		return
+	}
+	seen := make(map[int64]bool, len(req.ChannelIDs))
+	for i, channelID := range req.ChannelIDs {
+		if seen[channelID] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Channel %d is listed more than once", channelID))
+			return
+		}
+		seen[channelID] = true
+		channel, _, err := qtx.GetMemberChannel(ctx, channelID, userID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && channel.TeamID != teamID) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("You are not a member of channel %d in this team", channelID))
+			return
+		}
+		if err == nil {
+			err = qtx.SetChannelOrder(ctx, channelID, userID, i+1, currentTime)
+		}
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to order channel", "error", err, "channel_id", channelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to save channel order")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"team_id": teamID, "channel_ids": req.ChannelIDs})
+}
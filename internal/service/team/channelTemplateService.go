@@ -0,0 +1,218 @@
+package teamService
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/utils"
+)
+
+// Channel roles stored in channel_members.role
+const (
+	channelRoleAdmin  = 1
+	channelRoleMember = 2
+)
+
+// maxBulkChannels bounds how many channels one bulk request creates
+const maxBulkChannels = 50
+
+// ChannelSpec describes one channel to create
+type ChannelSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsPrivate   bool   `json:"is_private"`
+}
+
+// ChannelTemplate is a named set of channels for provisioning a team
+type ChannelTemplate struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Channels    []ChannelSpec `json:"channels"`
+}
+
+// channelTemplates are the built-in channel sets, keyed by name
+var channelTemplates = map[string]ChannelTemplate{
+	"onboarding": {
+		Name:        "onboarding",
+		Description: "The standard channels for a new team",
+		Channels: []ChannelSpec{
+			{Name: "general", Description: "Team-wide conversation"},
+			{Name: "announcements", Description: "Important updates for everyone"},
+			{Name: "introductions", Description: "Say hello to the team"},
+			{Name: "help", Description: "Ask questions and get answers"},
+			{Name: "random", Description: "Everything else"},
+		},
+	},
+	"engineering": {
+		Name:        "engineering",
+		Description: "Channels for a software team",
+		Channels: []ChannelSpec{
+			{Name: "engineering", Description: "Engineering discussion"},
+			{Name: "deploys", Description: "Release and deployment notices"},
+			{Name: "incidents", Description: "Coordinate incident response"},
+			{Name: "code-review", Description: "Ask for and discuss reviews"},
+		},
+	},
+	"project": {
+		Name:        "project",
+		Description: "Channels for running a project",
+		Channels: []ChannelSpec{
+			{Name: "project", Description: "Project discussion"},
+			{Name: "planning", Description: "Milestones and priorities"},
+			{Name: "status", Description: "Weekly status updates"},
+			{Name: "leads", Description: "Project leads", IsPrivate: true},
+		},
+	},
+}
+
+// BulkCreateChannelsRequest represents the request body for bulk channel
+// creation. The template's channels are created first, then the listed ones.
+type BulkCreateChannelsRequest struct {
+	Template string        `json:"template"`
+	Channels []ChannelSpec `json:"channels"`
+}
+
+// ListChannelTemplates lists the built-in channel templates
+func (ts *TeamService) ListChannelTemplates(w http.ResponseWriter, r *http.Request) {
+	templates := make([]ChannelTemplate, 0, len(channelTemplates))
+	for _, t := range channelTemplates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"templates": templates})
+}
+
+// BulkCreateChannels creates a set of channels in one transaction, from a
+// template, an explicit list or both. Only team owners can provision
+// channels in bulk; nothing is created if any channel is invalid or its name
+// is taken.
+func (ts *TeamService) BulkCreateChannels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to provision channels in this team")
+		return
+	}
+	ctx = logger.ContextWithFields(ctx, "team_id", teamID)
+
+	var req BulkCreateChannelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var specs []ChannelSpec
+	if req.Template != "" {
+		template, ok := channelTemplates[req.Template]
+		if !ok {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown channel template %q", req.Template))
+			return
+		}
+		specs = append(specs, template.Channels...)
+	}
+	specs = append(specs, req.Channels...)
+	if err := validateChannelSpecs(specs); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := ts.DB.BeginTx(ctx, nil)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	qtx := ts.Queries.WithTx(tx)
+	currentTime := time.Now().UTC().Unix()
+	created := make([]models.Channel, 0, len(specs))
+	for _, spec := range specs {
+		slug := utils.Slugify(spec.Name)
+		if slug == "" {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Channel name %q must contain a letter or digit", spec.Name))
+			return
+		}
+		taken, err := qtx.ChannelSlugTaken(ctx, teamID, slug, 0)
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to check channel name", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create channels")
+			return
+		}
+		if taken {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("A channel named %q already exists", slug))
+			return
+		}
+
+		channel := models.Channel{
+			TeamID:      teamID,
+			Name:        spec.Name,
+			Slug:        slug,
+			Description: spec.Description,
+			IsPrivate:   spec.IsPrivate,
+			CreatedBy:   userID,
+			CreatedAt:   currentTime,
+			UpdatedAt:   currentTime,
+		}
+		channel.ChannelID, err = qtx.CreateChannel(ctx, channel)
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to create channel", "error", err, "channel_name", spec.Name)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create channels")
+			return
+		}
+		if err := qtx.AddChannelMember(ctx, channel.ChannelID, userID, channelRoleAdmin, currentTime, userID); err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to add user as channel admin", "error", err, "channel_id", channel.ChannelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to create channels")
+			return
+		}
+		created = append(created, channel)
+	}
+
+	if err := tx.Commit(); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Info("Channels provisioned", "team_id", teamID, "user_id", userID, "template", req.Template, "count", len(created))
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{"channels": created})
+}
+
+// validateChannelSpecs applies the single channel creation limits to each
+// spec and rejects names repeated within the request
+func validateChannelSpecs(specs []ChannelSpec) error {
+	if len(specs) == 0 {
+		return fmt.Errorf("a template or at least one channel is required")
+	}
+	if len(specs) > maxBulkChannels {
+		return fmt.Errorf("at most %d channels can be created at once", maxBulkChannels)
+	}
+	seen := make(map[string]bool, len(specs))
+	for i := range specs {
+		specs[i].Name = strings.TrimSpace(specs[i].Name)
+		name := specs[i].Name
+		if name == "" || len(name) > 80 {
+			return fmt.Errorf("channel names must be 1 to 80 characters")
+		}
+		if len(specs[i].Description) > 300 {
+			return fmt.Errorf("the description of %q exceeds 300 characters", name)
+		}
+		key := strings.ToLower(name)
+		if seen[key] {
+			return fmt.Errorf("channel %q is listed more than once", name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
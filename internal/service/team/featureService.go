@@ -0,0 +1,30 @@
+package teamService
+
+import (
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/featureflags"
+)
+
+// GetTeamFeatures returns which feature flags are on for a team, so
+// clients can hide what the server would refuse
+func (ts *TeamService) GetTeamFeatures(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	flags, err := featureflags.ForTeam(ctx, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get team features", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get team features")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"team_id": teamID, "features": flags})
+}
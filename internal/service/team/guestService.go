@@ -0,0 +1,160 @@
+package teamService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nikhil/eaven/internal/events"
+	"github.com/nikhil/eaven/internal/limits"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/outbox"
+	"github.com/nikhil/eaven/internal/queries"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+// AddGuestRequest represents the request body for adding a guest to a team.
+// The guest joins only the listed channels.
+type AddGuestRequest struct {
+	Email      string  `json:"email"`
+	ChannelIDs []int64 `json:"channel_ids"`
+}
+
+// AddGuest adds an existing user to the team as a guest limited to the given
+// channels, or gives an existing guest access to more channels. Only team
+// owners can add guests.
+func (ts *TeamService) AddGuest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ownerID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to add guests to this team")
+		return
+	}
+	ctx = logger.ContextWithFields(ctx, "team_id", teamID)
+
+	var req AddGuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" || len(req.ChannelIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "email and at least one channel_id are required")
+		return
+	}
+
+	var guestID int64
+	var isBot bool
+	err := ts.DB.QueryRowContext(ctx, `SELECT user_id, is_bot FROM users WHERE email = ? AND workspace_id = ? AND merged_into = 0`, req.Email, workspace.FromContext(ctx)).Scan(&guestID, &isBot)
+	if errors.Is(err, sql.ErrNoRows) || isBot {
+		respondWithError(w, http.StatusNotFound, "No user with this email")
+		return
+	}
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to look up guest", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+		return
+	}
+
+	tx, err := ts.DB.BeginTx(ctx, nil)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	qtx := ts.Queries.WithTx(tx)
+	currentTime := time.Now().UTC().Unix()
+	existingRole, err := qtx.GetTeamRole(ctx, teamID, guestID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if err := limits.CheckMembers(ctx, ts.DB, teamID, 1); err != nil {
+			var exceeded *limits.ExceededError
+			if errors.As(err, &exceeded) {
+				exceeded.SetHeaders(w.Header())
+				respondWithJSON(w, http.StatusPaymentRequired, exceeded.Body())
+				return
+			}
+			ts.Log.WithContext(ctx).Error("Failed to check member limit", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+			return
+		}
+		if err := qtx.AddTeamMember(ctx, teamID, guestID, queries.TeamRoleGuest, currentTime, ownerID); err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to add guest to team", "error", err, "guest_id", guestID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+			return
+		}
+	case err != nil:
+		ts.Log.WithContext(ctx).Error("Failed to check team membership", "error", err, "guest_id", guestID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+		return
+	case existingRole != queries.TeamRoleGuest:
+		respondWithError(w, http.StatusConflict, "This user is already a full member of the team")
+		return
+	}
+
+	added := []int64{}
+	for _, channelID := range req.ChannelIDs {
+		channel, err := qtx.GetChannel(ctx, channelID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && channel.TeamID != teamID) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Channel %d is not in this team", channelID))
+			return
+		}
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to get channel", "error", err, "channel_id", channelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+			return
+		}
+		member, err := qtx.IsChannelMember(ctx, channelID, guestID)
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to check channel membership", "error", err, "channel_id", channelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+			return
+		}
+		if member {
+			continue
+		}
+		if err := qtx.AddChannelMember(ctx, channelID, guestID, channelRoleMember, currentTime, ownerID); err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to add guest to channel", "error", err, "channel_id", channelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+			return
+		}
+		joined := events.ChannelMemberJoined{ChannelID: channelID, TeamID: teamID, UserID: guestID, JoinedAt: currentTime, AddedBy: ownerID}
+		if err := outbox.Write(ctx, tx, channelID, events.TypeChannelMemberJoined, joined); err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to write member joined event", "error", err, "channel_id", channelID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to add guest")
+			return
+		}
+		added = append(added, channelID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if len(added) > 0 {
+		outbox.Notify()
+	}
+
+	ts.Log.WithContext(ctx).Audit("Guest added", "team_id", teamID, "user_id", ownerID, "guest_id", guestID, "channel_ids", added)
+	if err := limits.WriteHeaders(ctx, ts.DB, w.Header(), teamID); err != nil {
+		ts.Log.WithContext(ctx).Warn("Failed to get team quota", "error", err, "team_id", teamID)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"team_id":        teamID,
+		"user_id":        guestID,
+		"role":           "guest",
+		"added_channels": added,
+	})
+}
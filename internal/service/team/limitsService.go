@@ -0,0 +1,41 @@
+package teamService
+
+import (
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/limits"
+)
+
+// TeamLimits is a team's plan limits with its current usage
+type TeamLimits struct {
+	TeamID int64         `json:"team_id"`
+	Limits limits.Limits `json:"limits"`
+	Usage  limits.Usage  `json:"usage"`
+}
+
+// GetTeamLimits returns the plan limits that apply to a team and how much of
+// them it uses. Zero limits are unlimited. The same figures are sent as
+// X-Quota-* headers, like on the endpoints that consume them.
+func (ts *TeamService) GetTeamLimits(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, _, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+
+	l, err := limits.For(ctx, ts.DB, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get team limits", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get team limits")
+		return
+	}
+	usage, err := limits.GetUsage(ctx, ts.DB, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get team usage", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get team limits")
+		return
+	}
+	limits.SetHeaders(w.Header(), l, usage)
+	respondWithJSON(w, http.StatusOK, TeamLimits{TeamID: teamID, Limits: l, Usage: usage})
+}
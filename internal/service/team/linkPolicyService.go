@@ -0,0 +1,154 @@
+package teamService
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/linkpolicy"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// SetLinkPolicyRequest represents the request body for adding a link rule
+type SetLinkPolicyRequest struct {
+	Domain string `json:"domain"`
+	Action string `json:"action"`
+}
+
+// GetLinkPolicy lists the team's allowed and blocked domains. Any team
+// member can read the policy.
+func (ts *TeamService) GetLinkPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	rules, err := linkpolicy.List(ctx, ts.DB, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to list link policy", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get link policy")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"team_id": teamID, "rules": rules})
+}
+
+// SetLinkPolicy allows or blocks a domain for the team. Only team owners can
+// change the policy.
+func (ts *TeamService) SetLinkPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's link policy")
+		return
+	}
+
+	var req SetLinkPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rule, err := linkpolicy.Set(ctx, ts.DB, teamID, userID, req.Domain, req.Action)
+	if err != nil {
+		if errors.Is(err, linkpolicy.ErrInvalidDomain) || errors.Is(err, linkpolicy.ErrInvalidAction) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ts.Log.WithContext(ctx).Error("Failed to save link policy", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save link policy")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Audit("Link policy changed", "team_id", teamID, "user_id", userID, "domain", rule.Domain, "action", rule.Action)
+	respondWithJSON(w, http.StatusOK, rule)
+}
+
+// DeleteLinkPolicy removes a domain rule, returning the domain to the
+// default warning treatment
+func (ts *TeamService) DeleteLinkPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's link policy")
+		return
+	}
+
+	domain := mux.Vars(r)["domain"]
+	deleted, err := linkpolicy.Delete(ctx, ts.DB, teamID, domain)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to delete link policy", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete link policy")
+		return
+	}
+	if !deleted {
+		respondWithError(w, http.StatusNotFound, "No rule for this domain")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Audit("Link policy removed", "team_id", teamID, "user_id", userID, "domain", domain)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Link policy rule removed"})
+}
+
+// teamAccess reads the user and team IDs from the request and looks up the
+// user's role in the team, which is 0 when they are not a member
+func (ts *TeamService) teamAccess(w http.ResponseWriter, r *http.Request) (userID, teamID int64, role int, ok bool) {
+	ctx := r.Context()
+
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		ts.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return 0, 0, 0, false
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, 0, 0, false
+	}
+	teamID, err = strconv.ParseInt(mux.Vars(r)["team_id"], 10, 64)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Invalid team ID in URL", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
+		return 0, 0, 0, false
+	}
+
+	role, err = ts.teamRole(ctx, teamID, userID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify team membership")
+		return 0, 0, 0, false
+	}
+	return userID, teamID, role, true
+}
+
+func (ts *TeamService) teamRole(ctx context.Context, teamID, userID int64) (int, error) {
+	role, err := ts.Queries.GetTeamRole(ctx, teamID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return role, err
+}
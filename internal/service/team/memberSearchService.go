@@ -0,0 +1,90 @@
+package teamService
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/nikhil/eaven/internal/handles"
+	"github.com/nikhil/eaven/internal/queries"
+)
+
+// maxMemberSearchResults caps a member search, which serves @-autocomplete
+const maxMemberSearchResults = 20
+
+// MemberMatch is a team member found by a member search
+type MemberMatch struct {
+	UserID    int64  `json:"user_id"`
+	Handle    string `json:"handle"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// SearchMembers finds team members whose @handle, first name or last name
+// starts with q. Handle matches come first, shortest handle first, so typing
+// "@ad" suggests "ada" before "adam".
+func (ts *TeamService) SearchMembers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+	if role == queries.TeamRoleGuest {
+		respondWithError(w, http.StatusForbidden, "Guests cannot search the team's members")
+		return
+	}
+
+	q := handles.Normalize(r.URL.Query().Get("q"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	members, err := ts.findMembers(ctx, teamID, q, maxMemberSearchResults)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to search team members", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to search members")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"members": members})
+}
+
+// findMembers returns up to limit team members whose handle or name starts
+// with a normalized query, best matches first
+func (ts *TeamService) findMembers(ctx context.Context, teamID int64, q string, limit int) ([]MemberMatch, error) {
+	prefix := likePrefix(q)
+	rows, err := ts.Reader().QueryContext(ctx, `
+		SELECT u.user_id, u.handle, u.first_name, u.last_name
+		FROM user_teams_mapper utm
+		INNER JOIN users u ON u.user_id = utm.user_id
+		WHERE utm.team_id = ? AND u.merged_into = 0
+			AND (u.handle LIKE ? OR u.first_name LIKE ? OR u.last_name LIKE ?)
+		ORDER BY u.handle LIKE ? DESC, CHAR_LENGTH(u.handle), u.handle
+		LIMIT ?`, teamID, prefix, prefix, prefix, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []MemberMatch{}
+	for rows.Next() {
+		var m MemberMatch
+		if err := rows.Scan(&m.UserID, &m.Handle, &m.FirstName, &m.LastName); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// likePrefix is a LIKE pattern matching values that start with q. LIKE
+// wildcards in q are matched literally.
+func likePrefix(q string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q) + "%"
+}
@@ -0,0 +1,87 @@
+package teamService
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nikhil/eaven/internal/limits"
+	"github.com/nikhil/eaven/internal/search"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+)
+
+// SearchMessages searches the messages of the team's channels the user is a
+// member of. q takes free text and "quoted phrases" with the operators
+// from:@handle, in:#channel, before:YYYY-MM-DD, after:YYYY-MM-DD, has:link and
+// has:file. Results come newest first, each with the offsets of the matched
+// text; pass next_before_id back as before_id for the next page.
+func (ts *TeamService) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	query, err := search.Parse(r.URL.Query().Get("q"))
+	var invalid *search.ParseError
+	switch {
+	case errors.Is(err, search.ErrEmptyQuery):
+		respondWithError(w, http.StatusBadRequest, "q is required")
+		return
+	case errors.As(err, &invalid):
+		respondWithError(w, http.StatusBadRequest, invalid.Error())
+		return
+	}
+
+	limit := defaultSearchResults
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxSearchResults {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+	}
+	var beforeID int64
+	if v := r.URL.Query().Get("before_id"); v != "" {
+		if beforeID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid before_id")
+			return
+		}
+	}
+
+	cutoff, err := limits.HistoryCutoff(ctx, ts.DB, teamID, time.Now().UTC())
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get message history limit", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to search messages")
+		return
+	}
+
+	result, err := search.Messages(ctx, ts.Reader(), search.Request{
+		UserID:   userID,
+		TeamID:   teamID,
+		Query:    query,
+		Cutoff:   cutoff,
+		BeforeID: beforeID,
+		Limit:    limit,
+	})
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to search messages", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to search messages")
+		return
+	}
+
+	response := map[string]interface{}{"query": query, "messages": result.Hits}
+	if result.NextBeforeID > 0 {
+		response["next_before_id"] = result.NextBeforeID
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
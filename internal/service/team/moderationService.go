@@ -0,0 +1,82 @@
+package teamService
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nikhil/eaven/internal/moderation"
+)
+
+// SetModerationPolicyRequest represents the request body for changing a
+// team's moderation policy
+type SetModerationPolicyRequest struct {
+	Action          string   `json:"action"`
+	Words           []string `json:"words"`
+	UseDefaultWords *bool    `json:"use_default_words"`
+}
+
+// GetModerationPolicy returns the team's moderation policy. Any team member
+// can read it.
+func (ts *TeamService) GetModerationPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	policy, err := moderation.GetPolicy(ctx, ts.DB, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get moderation policy", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get moderation policy")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, policy)
+}
+
+// SetModerationPolicy replaces the team's moderation policy. Only team
+// owners can change it.
+func (ts *TeamService) SetModerationPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's moderation policy")
+		return
+	}
+
+	var req SetModerationPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	policy := moderation.Policy{Action: req.Action, Words: req.Words, UseDefaultWords: true}
+	if req.UseDefaultWords != nil {
+		policy.UseDefaultWords = *req.UseDefaultWords
+	}
+	policy, err := moderation.SetPolicy(ctx, ts.DB, teamID, userID, policy)
+	if err != nil {
+		if errors.Is(err, moderation.ErrInvalidPolicy) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ts.Log.WithContext(ctx).Error("Failed to save moderation policy", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save moderation policy")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Audit("Moderation policy changed", "team_id", teamID, "user_id", userID,
+		"action", policy.Action, "words", len(policy.Words), "use_default_words", policy.UseDefaultWords)
+	respondWithJSON(w, http.StatusOK, policy)
+}
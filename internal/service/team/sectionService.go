@@ -0,0 +1,433 @@
+package teamService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/models"
+)
+
+// maxSectionName bounds section names, as the column does
+const maxSectionName = 80
+
+// SectionRequest represents the request body for creating or renaming a
+// section
+type SectionRequest struct {
+	Name string `json:"name"`
+}
+
+// OrderSectionsRequest lists every section of a team in its new order
+type OrderSectionsRequest struct {
+	SectionIDs []int64 `json:"section_ids"`
+}
+
+// SectionChannelsRequest lists the channels of a section in order
+type SectionChannelsRequest struct {
+	ChannelIDs []int64 `json:"channel_ids"`
+}
+
+// SidebarSection is a section with the user's channels in it. The channels
+// in no section are grouped last under section ID 0.
+type SidebarSection struct {
+	SectionID int64            `json:"section_id"`
+	Name      string           `json:"name"`
+	Position  int              `json:"position"`
+	Channels  []models.Channel `json:"channels"`
+}
+
+// ListSections returns the team's sections in sidebar order. Any team member
+// can list them.
+func (ts *TeamService) ListSections(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	sections, err := ts.Queries.Reads().ListSections(ctx, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to list sections", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get sections")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"team_id": teamID, "sections": sections})
+}
+
+// CreateSection adds a section at the end of the team's sidebar. Only team
+// owners can change sections.
+func (ts *TeamService) CreateSection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's sections")
+		return
+	}
+
+	name, ok := ts.sectionName(w, r)
+	if !ok {
+		return
+	}
+
+	currentTime := time.Now().UTC().Unix()
+	sectionID, err := ts.Queries.CreateSection(ctx, teamID, name, userID, currentTime)
+	if database.IsDuplicate(err) {
+		respondWithError(w, http.StatusConflict, "A section with this name already exists")
+		return
+	}
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to create section", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create section")
+		return
+	}
+	section, err := ts.Queries.GetSection(ctx, sectionID, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get created section", "error", err, "section_id", sectionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create section")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Info("Section created", "team_id", teamID, "user_id", userID, "section_id", sectionID)
+	respondWithJSON(w, http.StatusCreated, section)
+}
+
+// RenameSection changes a section's name
+func (ts *TeamService) RenameSection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's sections")
+		return
+	}
+
+	section, ok := ts.teamSection(w, r, teamID)
+	if !ok {
+		return
+	}
+	name, ok := ts.sectionName(w, r)
+	if !ok {
+		return
+	}
+
+	err := ts.Queries.RenameSection(ctx, section.SectionID, teamID, name)
+	if database.IsDuplicate(err) {
+		respondWithError(w, http.StatusConflict, "A section with this name already exists")
+		return
+	}
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to rename section", "error", err, "section_id", section.SectionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to rename section")
+		return
+	}
+	section.Name = name
+
+	ts.Log.WithContext(ctx).Info("Section renamed", "team_id", teamID, "user_id", userID, "section_id", section.SectionID)
+	respondWithJSON(w, http.StatusOK, section)
+}
+
+// DeleteSection removes a section. Its channels stay, in no section.
+func (ts *TeamService) DeleteSection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's sections")
+		return
+	}
+
+	sectionID, err := strconv.ParseInt(mux.Vars(r)["section_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid section ID")
+		return
+	}
+
+	tx, err := ts.DB.BeginTx(ctx, nil)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	deleted, err := ts.Queries.WithTx(tx).DeleteSection(ctx, sectionID, teamID, time.Now().UTC().Unix())
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to delete section", "error", err, "section_id", sectionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete section")
+		return
+	}
+	if !deleted {
+		respondWithError(w, http.StatusNotFound, "Section not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Info("Section deleted", "team_id", teamID, "user_id", userID, "section_id", sectionID)
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Section deleted"})
+}
+
+// OrderSections puts the team's sections in a new order. The request must
+// list every section exactly once.
+func (ts *TeamService) OrderSections(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's sections")
+		return
+	}
+
+	var req OrderSectionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tx, err := ts.DB.BeginTx(ctx, nil)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	qtx := ts.Queries.WithTx(tx)
+	sections, err := qtx.ListSections(ctx, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to list sections", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to order sections")
+		return
+	}
+	byID := make(map[int64]*models.ChannelSection, len(sections))
+	for i := range sections {
+		byID[sections[i].SectionID] = &sections[i]
+	}
+	if len(req.SectionIDs) != len(sections) {
+		respondWithError(w, http.StatusBadRequest, "section_ids must list every section of the team once")
+		return
+	}
+	placed := make(map[int64]bool, len(sections))
+	for i, id := range req.SectionIDs {
+		if byID[id] == nil || placed[id] {
+			respondWithError(w, http.StatusBadRequest, "section_ids must list every section of the team once")
+			return
+		}
+		placed[id] = true
+		if err := qtx.SetSectionPosition(ctx, id, teamID, i+1); err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to move section", "error", err, "section_id", id)
+			respondWithError(w, http.StatusInternalServerError, "Failed to order sections")
+			return
+		}
+	}
+
+	ordered := make([]models.ChannelSection, 0, len(sections))
+	for i, id := range req.SectionIDs {
+		s := *byID[id]
+		s.Position = i + 1
+		ordered = append(ordered, s)
+	}
+	if err := tx.Commit(); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Info("Sections reordered", "team_id", teamID, "user_id", userID)
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"team_id": teamID, "sections": ordered})
+}
+
+// SetSectionChannels makes the listed channels, in order, the channels of a
+// section. Channels no longer listed are left in no section, and channels
+// listed from another section move here.
+func (ts *TeamService) SetSectionChannels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to change this team's sections")
+		return
+	}
+
+	section, ok := ts.teamSection(w, r, teamID)
+	if !ok {
+		return
+	}
+	var req SectionChannelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tx, err := ts.DB.BeginTx(ctx, nil)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+
+	qtx := ts.Queries.WithTx(tx)
+	currentTime := time.Now().UTC().Unix()
+	if err := qtx.ClearSection(ctx, section.SectionID, teamID, currentTime); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to clear section", "error", err, "section_id", section.SectionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to set section channels")
+		return
+	}
+	seen := make(map[int64]bool, len(req.ChannelIDs))
+	for i, channelID := range req.ChannelIDs {
+		if seen[channelID] {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Channel %d is listed more than once", channelID))
+			return
+		}
+		seen[channelID] = true
+		channel, err := qtx.GetChannel(ctx, channelID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && channel.TeamID != teamID) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Channel %d is not a channel of this team", channelID))
+			return
+		}
+		if err == nil {
+			err = qtx.SetChannelSection(ctx, channelID, teamID, section.SectionID, i+1, currentTime)
+		}
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to move channel to section", "error", err, "channel_id", channelID, "section_id", section.SectionID)
+			respondWithError(w, http.StatusInternalServerError, "Failed to set section channels")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Info("Section channels set", "team_id", teamID, "user_id", userID, "section_id", section.SectionID, "count", len(req.ChannelIDs))
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"section": section, "channel_ids": req.ChannelIDs})
+}
+
+// GetSidebar returns the team channels the user belongs to grouped by
+// section, sections and channels in the order the team owners set, for
+// client sidebars. Empty sections are included so clients can show them.
+func (ts *TeamService) GetSidebar(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	reads := ts.Queries.Reads()
+	sections, err := reads.ListSections(ctx, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to list sections", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get sidebar")
+		return
+	}
+	channels, err := reads.ListMemberSidebarChannels(ctx, teamID, userID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to list sidebar channels", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get sidebar")
+		return
+	}
+
+	groups := make([]SidebarSection, 0, len(sections)+1)
+	index := make(map[int64]int, len(sections))
+	for _, s := range sections {
+		index[s.SectionID] = len(groups)
+		groups = append(groups, SidebarSection{SectionID: s.SectionID, Name: s.Name, Position: s.Position, Channels: []models.Channel{}})
+	}
+	unsectioned := SidebarSection{Channels: []models.Channel{}}
+	for _, c := range channels {
+		if i, ok := index[c.SectionID]; ok {
+			groups[i].Channels = append(groups[i].Channels, c)
+			continue
+		}
+		unsectioned.Channels = append(unsectioned.Channels, c)
+	}
+	groups = append(groups, unsectioned)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"team_id": teamID, "sections": groups})
+}
+
+// teamSection reads the section ID from the URL and loads the section,
+// answering 404 when the team has no such section
+func (ts *TeamService) teamSection(w http.ResponseWriter, r *http.Request, teamID int64) (models.ChannelSection, bool) {
+	ctx := r.Context()
+
+	sectionID, err := strconv.ParseInt(mux.Vars(r)["section_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid section ID")
+		return models.ChannelSection{}, false
+	}
+	section, err := ts.Queries.GetSection(ctx, sectionID, teamID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Section not found")
+		return models.ChannelSection{}, false
+	}
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get section", "error", err, "section_id", sectionID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get section")
+		return models.ChannelSection{}, false
+	}
+	return section, true
+}
+
+// sectionName decodes and checks the name of a SectionRequest
+func (ts *TeamService) sectionName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req SectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		ts.Log.WithContext(r.Context()).Error("Failed to decode request body", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return "", false
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		respondWithError(w, http.StatusBadRequest, "Section name is required")
+		return "", false
+	}
+	if utf8.RuneCountInString(name) > maxSectionName {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Section name must be at most %d characters", maxSectionName))
+		return "", false
+	}
+	return name, true
+}
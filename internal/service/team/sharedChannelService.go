@@ -0,0 +1,74 @@
+package teamService
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ListSharedChannels returns the channels other teams share with the team,
+// pending invitations included. Any team member can list them.
+func (ts *TeamService) ListSharedChannels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role == 0 {
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	shares, err := ts.Queries.ListTeamShares(ctx, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to list shared channels", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get shared channels")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"team_id": teamID, "shares": shares})
+}
+
+// AcceptSharedChannel accepts another team's invitation to share a channel.
+// From then on the team's members, guests aside, can join the channel, post
+// in it and receive its events. Only team owners can accept.
+func (ts *TeamService) AcceptSharedChannel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "You don't have permission to accept shared channels for this team")
+		return
+	}
+	channelID, err := strconv.ParseInt(mux.Vars(r)["channel_id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid channel ID")
+		return
+	}
+
+	accepted, err := ts.Queries.AcceptShare(ctx, channelID, teamID, userID, time.Now().UTC().Unix())
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to accept shared channel", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to accept shared channel")
+		return
+	}
+	if !accepted {
+		respondWithError(w, http.StatusNotFound, "No pending share of this channel")
+		return
+	}
+	share, err := ts.Queries.GetShare(ctx, channelID, teamID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to get channel share", "error", err, "channel_id", channelID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to accept shared channel")
+		return
+	}
+
+	ts.Log.WithContext(ctx).Audit("Channel share accepted", "channel_id", channelID, "team_id", teamID, "user_id", userID, "host_team_id", share.HostTeamID)
+	respondWithJSON(w, http.StatusOK, share)
+}
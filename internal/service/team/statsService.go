@@ -0,0 +1,180 @@
+package teamService
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statsTTL bounds how stale a team's cached statistics may be
+const statsTTL = 5 * time.Minute
+
+// activityWindows are the periods active members are counted over, in days
+var activityWindows = []int{1, 7, 30}
+
+// ChannelStats is one channel's message count. Messages purged by retention
+// are included through the daily rollups.
+type ChannelStats struct {
+	ChannelID    int64  `json:"channel_id"`
+	ChannelName  string `json:"channel_name"`
+	MessageCount int64  `json:"message_count"`
+	LastActiveAt int64  `json:"last_active_at"`
+}
+
+// ActiveMembers is how many team members posted within a window
+type ActiveMembers struct {
+	Days    int   `json:"days"`
+	Members int64 `json:"members"`
+}
+
+// TeamStats summarises a team's usage for its owners
+type TeamStats struct {
+	TeamID          int64           `json:"team_id"`
+	MemberCount     int64           `json:"member_count"`
+	MessageCount    int64           `json:"message_count"`
+	Channels        []ChannelStats  `json:"channels"`
+	ActiveMembers   []ActiveMembers `json:"active_members"`
+	AttachmentCount int64           `json:"attachment_count"`
+	StorageBytes    int64           `json:"storage_bytes"`
+	GeneratedAt     int64           `json:"generated_at"`
+}
+
+type cachedStats struct {
+	stats     TeamStats
+	expiresAt time.Time
+}
+
+var statsCache = struct {
+	sync.Mutex
+	entries map[int64]cachedStats
+}{entries: make(map[int64]cachedStats)}
+
+// GetTeamStats returns usage statistics for a team. Only team owners can see
+// them. Results are cached for a few minutes, and generated_at tells when
+// they were computed.
+func (ts *TeamService) GetTeamStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	_, teamID, role, ok := ts.teamAccess(w, r)
+	if !ok {
+		return
+	}
+	if role != teamRoleOwner {
+		respondWithError(w, http.StatusForbidden, "Only team owners can view team statistics")
+		return
+	}
+
+	statsCache.Lock()
+	cached, hit := statsCache.entries[teamID]
+	statsCache.Unlock()
+	if hit && time.Now().Before(cached.expiresAt) {
+		respondWithJSON(w, http.StatusOK, cached.stats)
+		return
+	}
+
+	stats, err := ts.computeTeamStats(ctx, teamID, time.Now().UTC())
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to compute team statistics", "error", err, "team_id", teamID)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get team statistics")
+		return
+	}
+
+	statsCache.Lock()
+	statsCache.entries[teamID] = cachedStats{stats: stats, expiresAt: time.Now().Add(statsTTL)}
+	statsCache.Unlock()
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+func (ts *TeamService) computeTeamStats(ctx context.Context, teamID int64, now time.Time) (TeamStats, error) {
+	stats := TeamStats{
+		TeamID:        teamID,
+		Channels:      []ChannelStats{},
+		ActiveMembers: []ActiveMembers{},
+		GeneratedAt:   now.Unix(),
+	}
+
+	err := ts.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_teams_mapper WHERE team_id = ?`, teamID).Scan(&stats.MemberCount)
+	if err != nil {
+		return TeamStats{}, err
+	}
+
+	rows, err := ts.DB.QueryContext(ctx, `
+		SELECT c.channel_id, c.channel_name,
+			COALESCE(live.message_count, 0) + COALESCE(rolled.message_count, 0),
+			GREATEST(COALESCE(live.last_active_at, 0), COALESCE(rolled.last_active_at, 0))
+		FROM channels c
+		LEFT JOIN (
+			SELECT channel_id, COUNT(*) AS message_count, MAX(message_created_at) AS last_active_at
+			FROM (
+				SELECT channel_id, message_created_at FROM messages
+				WHERE channel_id IN (SELECT channel_id FROM channels WHERE team_id = ?)
+				UNION ALL
+				SELECT channel_id, message_created_at FROM messages_archive
+				WHERE channel_id IN (SELECT channel_id FROM channels WHERE team_id = ?)
+			) m
+			GROUP BY channel_id
+		) live ON live.channel_id = c.channel_id
+		LEFT JOIN (
+			SELECT channel_id, SUM(message_count) AS message_count, MAX(day_start) AS last_active_at
+			FROM channel_daily_stats
+			WHERE channel_id IN (SELECT channel_id FROM channels WHERE team_id = ?)
+			GROUP BY channel_id
+		) rolled ON rolled.channel_id = c.channel_id
+		WHERE c.team_id = ?
+		ORDER BY 3 DESC, c.channel_id`, teamID, teamID, teamID, teamID)
+	if err != nil {
+		return TeamStats{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ChannelStats
+		if err := rows.Scan(&c.ChannelID, &c.ChannelName, &c.MessageCount, &c.LastActiveAt); err != nil {
+			return TeamStats{}, err
+		}
+		stats.MessageCount += c.MessageCount
+		stats.Channels = append(stats.Channels, c)
+	}
+	if err := rows.Err(); err != nil {
+		return TeamStats{}, err
+	}
+
+	// Active members are current team members who posted in the team. Live
+	// and archived messages and retention rollups are all searched, so windows
+	// reaching past the retention period still count.
+	for _, days := range activityWindows {
+		since := now.AddDate(0, 0, -days).Unix()
+		a := ActiveMembers{Days: days}
+		err := ts.DB.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM user_teams_mapper utm
+			WHERE utm.team_id = ? AND (
+				EXISTS (
+					SELECT 1 FROM messages m
+					INNER JOIN channels c ON c.channel_id = m.channel_id
+					WHERE c.team_id = utm.team_id AND m.user_id = utm.user_id AND m.message_created_at >= ?)
+				OR EXISTS (
+					SELECT 1 FROM messages_archive m
+					INNER JOIN channels c ON c.channel_id = m.channel_id
+					WHERE c.team_id = utm.team_id AND m.user_id = utm.user_id AND m.message_created_at >= ?)
+				OR EXISTS (
+					SELECT 1 FROM channel_daily_participants p
+					INNER JOIN channels c ON c.channel_id = p.channel_id
+					WHERE c.team_id = utm.team_id AND p.user_id = utm.user_id AND p.day_start >= ?))`,
+			teamID, since, since, since-since%86400).Scan(&a.Members)
+		if err != nil {
+			return TeamStats{}, err
+		}
+		stats.ActiveMembers = append(stats.ActiveMembers, a)
+	}
+
+	err = ts.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(a.size_bytes), 0)
+		FROM attachments a
+		INNER JOIN channels c ON c.channel_id = a.channel_id
+		WHERE c.team_id = ?`, teamID).Scan(&stats.AttachmentCount, &stats.StorageBytes)
+	if err != nil {
+		return TeamStats{}, err
+	}
+	return stats, nil
+}
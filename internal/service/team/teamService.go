@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,16 +16,25 @@ import (
 
 	// "github.com/nikhil/eaven/internal/cache"
 	// "github.com/nikhil/eaven/internal/database"
-	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/i18n"
 	"github.com/nikhil/eaven/internal/logger"
 	"github.com/nikhil/eaven/internal/middleware"
 	"github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/queries"
+	"github.com/nikhil/eaven/internal/utils"
 	// "github.com/nikhil/eaven/internal/validator"
 )
 
+// teamRoleOwner is the user_teams_mapper role of a team's creator
+const teamRoleOwner = queries.TeamRoleOwner
+
 // TeamService handles team-related operations
 type TeamService struct {
 	DB *sql.DB
+	// Reader returns the pool search and autocomplete read from; they
+	// tolerate replica lag. It defaults to DB.
+	Reader  func() *sql.DB
+	Queries *queries.Queries
 	// Cache cache.CacheInterface
 	Log *logger.Logger
 }
@@ -33,12 +43,16 @@ type TeamService struct {
 type CreateTeamRequest struct {
 	Name        string `json:"name" validate:"required,min=1,max=100"`
 	Description string `json:"description" validate:"max=500"`
+	// Locale changes the language of the team's system messages when set
+	Locale *string `json:"locale"`
 }
 
 // UpdateTeamRequest represents the request body for team updates
 type UpdateTeamRequest struct {
 	Name        string `json:"name" validate:"required,min=1,max=100"`
 	Description string `json:"description" validate:"max=500"`
+	// Locale changes the language of the team's system messages when set
+	Locale *string `json:"locale"`
 }
 
 // PaginationResponse wraps paginated team results
@@ -50,11 +64,12 @@ type PaginationResponse struct {
 }
 
 // NewTeamService initializes a new team service
-func NewTeamService() *TeamService {
+func NewTeamService(db *sql.DB, q *queries.Queries, log *logger.Logger) *TeamService {
 	return &TeamService{
-		DB: database.DB,
-		// Cache: cache.NewRedisCache(),
-		Log: logger.NewLogger("team-service"),
+		DB:      db,
+		Reader:  func() *sql.DB { return db },
+		Queries: q,
+		Log:     log,
 	}
 }
 
@@ -65,7 +80,7 @@ func (ts *TeamService) CreateTeam(w http.ResponseWriter, r *http.Request) {
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		ts.Log.Error("Failed to extract user details from context")
+		ts.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -73,7 +88,7 @@ func (ts *TeamService) CreateTeam(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid user ID in token", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
@@ -81,14 +96,14 @@ func (ts *TeamService) CreateTeam(w http.ResponseWriter, r *http.Request) {
 	// Parse and validate request body
 	var req CreateTeamRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ts.Log.Error("Failed to decode request body", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Validate input
 	// if err := validator.Validate(req); err != nil {
-	// 	ts.Log.Error("Validation failed", "error", err)
+	// 	ts.Log.WithContext(ctx).Error("Validation failed", "error", err)
 	// 	respondWithError(w, http.StatusBadRequest, err.Error())
 	// 	return
 	// }
@@ -96,7 +111,7 @@ func (ts *TeamService) CreateTeam(w http.ResponseWriter, r *http.Request) {
 	// Begin transaction
 	tx, err := ts.DB.BeginTx(ctx, nil)
 	if err != nil {
-		ts.Log.Error("Failed to begin transaction", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to begin transaction", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
@@ -104,62 +119,46 @@ func (ts *TeamService) CreateTeam(w http.ResponseWriter, r *http.Request) {
 
 	// Insert team into database
 	currentTime := time.Now().UTC().Unix()
-	query := `
-		INSERT INTO teams (team_name,  created_by, created_at) 
-		VALUES (?, ?, ?)
-	`
-	result, err := tx.ExecContext(ctx, query, req.Name, userID, currentTime)
+	newTeam := models.Team{
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedBy:   userID,
+		CreatedAt:   currentTime,
+		UpdatedAt:   currentTime,
+	}
+	qtx := ts.Queries.WithTx(tx)
+	newTeam.ID, err = qtx.CreateTeam(ctx, newTeam)
 	if err != nil {
-		ts.Log.Error("Failed to create team", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to create team", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to create team")
 		return
 	}
-
-	// Get the ID of the newly created team
-	teamID, err := result.LastInsertId()
-	if err != nil {
-		ts.Log.Error("Failed to get team ID", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to get team ID")
-		return
-	}
+	teamID := newTeam.ID
 
 	// Create team-user relationship (add creator as team owner)
-	query = `
-		INSERT INTO user_teams_mapper (team_id, user_id, role, joined_at, invited_by) 
-		VALUES (?, ?, ?, ?, ?)
-	`
-	_, err = tx.ExecContext(ctx, query, teamID, userID, 1, currentTime, userID)
+	err = qtx.AddTeamMember(ctx, teamID, userID, teamRoleOwner, currentTime, userID)
 	if err != nil {
-		ts.Log.Error("Failed to add user to team", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to add user to team", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to add user to team")
 		return
 	}
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		ts.Log.Error("Failed to commit transaction", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to commit transaction", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
 
-	// Return the created team
-	newTeam := models.Team{
-		ID:        teamID,
-		Name:      req.Name,
-		CreatedBy: userID,
-		CreatedAt: currentTime,
-		UpdatedAt: currentTime,
-	}
-
 	// Invalidate cache for this user's teams
 	// cacheKey := fmt.Sprintf("user_teams:%d", userID)
 	// if err := ts.Cache.Delete(ctx, cacheKey); err != nil {
-	// 	ts.Log.Error("Failed to invalidate cache", "error", err, "key", cacheKey)
+	// 	ts.Log.WithContext(ctx).Error("Failed to invalidate cache", "error", err, "key", cacheKey)
 	// 	// Continue execution despite cache error
 	// }
 
 	// Audit log
-	ts.Log.Info("Team created", "team_id", teamID, "user_id", userID)
+	ts.Log.WithContext(ctx).Info("Team created", "team_id", teamID, "user_id", userID)
 
 	respondWithJSON(w, http.StatusCreated, newTeam)
 }
@@ -171,7 +170,7 @@ func (ts *TeamService) GetUserTeams(w http.ResponseWriter, r *http.Request) {
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		ts.Log.Error("Failed to extract user details from context")
+		ts.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
@@ -179,7 +178,7 @@ func (ts *TeamService) GetUserTeams(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from token
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid user ID in token", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
@@ -201,60 +200,26 @@ func (ts *TeamService) GetUserTeams(w http.ResponseWriter, r *http.Request) {
 
 	// if cached, err := ts.Cache.Get(ctx, cacheKey); err == nil {
 	// 	if err := json.Unmarshal([]byte(cached), &response); err == nil {
-	// 		ts.Log.Info("Teams fetched from cache", "user_id", userID)
+	// 		ts.Log.WithContext(ctx).Info("Teams fetched from cache", "user_id", userID)
 	// 		respondWithJSON(w, http.StatusOK, response)
 	// 		return
 	// 	}
 	// }
 
 	// Count total teams for pagination
-	var totalCount int
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM teams t
-		JOIN user_teams_mapper tm ON t.team_id = tm.team_id
-		WHERE tm.user_id = ?
-	`
-	err = ts.DB.QueryRowContext(ctx, countQuery, userID).Scan(&totalCount)
+	totalCount, err := ts.Queries.Reads().CountUserTeams(ctx, userID)
 	if err != nil {
-		ts.Log.Error("Failed to count teams", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to count teams", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get teams")
 		return
 	}
 
-	// Query to get teams with pagination
-	query := `
-		SELECT t.team_id, t.team_name,  t.created_by, t.created_at
-		FROM teams t
-		JOIN user_teams_mapper tm ON t.team_id = tm.team_id
-		WHERE tm.user_id = ?
-		ORDER BY t.created_at DESC
-		LIMIT ? OFFSET ?
-	`
-	rows, err := ts.DB.QueryContext(ctx, query, userID, perPage, offset)
+	teams, err := ts.Queries.Reads().ListUserTeams(ctx, userID, perPage, offset)
 	if err != nil {
-		ts.Log.Error("Failed to query teams", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to query teams", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get teams")
 		return
 	}
-	defer rows.Close()
-
-	var teams []models.Team
-	for rows.Next() {
-		var t models.Team
-		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedBy, &t.CreatedAt); err != nil {
-			ts.Log.Error("Failed to scan team row", "error", err)
-			respondWithError(w, http.StatusInternalServerError, "Failed to process teams data")
-			return
-		}
-		teams = append(teams, t)
-	}
-
-	if err := rows.Err(); err != nil {
-		ts.Log.Error("Error iterating teams rows", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Error processing teams data")
-		return
-	}
 
 	// Build response
 	response = PaginationResponse{
@@ -267,12 +232,12 @@ func (ts *TeamService) GetUserTeams(w http.ResponseWriter, r *http.Request) {
 	// Cache the result (with 5 minute expiry)
 	// if data, err := json.Marshal(response); err == nil {
 	// 	if err := ts.Cache.Set(ctx, cacheKey, string(data), 5*time.Minute); err != nil {
-	// 		ts.Log.Error("Failed to cache teams", "error", err)
+	// 		ts.Log.WithContext(ctx).Error("Failed to cache teams", "error", err)
 	// 		// Continue despite cache error
 	// 	}
 	// }
 
-	ts.Log.Info("Teams fetched from database", "user_id", userID, "count", len(teams))
+	ts.Log.WithContext(ctx).Info("Teams fetched from database", "user_id", userID, "count", len(teams))
 	// respondWithJSON(w, http.StatusOK, response)
 	json.NewEncoder(w).Encode(response)
 }
@@ -284,47 +249,44 @@ func (ts *TeamService) GetTeam(w http.ResponseWriter, r *http.Request) {
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		ts.Log.Error("Failed to extract user details from context")
+		ts.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
 
 	// Extract user ID from token
-	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["id"]), 10, 64)
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid user ID in token", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	// Get team ID from URL parameters
 	vars := mux.Vars(r)
-	teamID, err := strconv.ParseInt(vars["id"], 10, 64)
+	teamID, err := strconv.ParseInt(vars["team_id"], 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid team ID in URL", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid team ID in URL", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
 		return
 	}
 
 	// Check if user has access to this team
-	var membershipExists bool
-	memberQuery := `SELECT EXISTS(SELECT 1 FROM team_members WHERE team_id = ? AND user_id = ?)`
-	err = ts.DB.QueryRowContext(ctx, memberQuery, teamID, userID).Scan(&membershipExists)
+	membershipExists, err := ts.Queries.IsTeamMember(ctx, teamID, userID)
 	if err != nil {
-		ts.Log.Error("Failed to check team membership", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to verify team access")
 		return
 	}
 
 	if !membershipExists {
-		ts.Log.Warn("Unauthorized team access attempt", "team_id", teamID, "user_id", userID)
+		ts.Log.WithContext(ctx).Warn("Unauthorized team access attempt", "team_id", teamID, "user_id", userID)
 		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
 		return
 	}
 
 	// Try to get from cache
 	// cacheKey := fmt.Sprintf("team:%d", teamID)
-	var team models.Team
 
 	// if cached, err := ts.Cache.Get(ctx, cacheKey); err == nil {
 	// 	if err := json.Unmarshal([]byte(cached), &team); err == nil {
@@ -334,20 +296,13 @@ func (ts *TeamService) GetTeam(w http.ResponseWriter, r *http.Request) {
 	// }
 
 	// Get team details
-	query := `
-		SELECT id, name, description, created_by, created_at, updated_at
-		FROM teams WHERE id = ?
-	`
-	err = ts.DB.QueryRowContext(ctx, query, teamID).Scan(
-		&team.ID, &team.Name,
-		&team.CreatedBy, &team.CreatedAt, &team.UpdatedAt,
-	)
+	team, err := ts.Queries.GetTeam(ctx, teamID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			ts.Log.Warn("Team not found", "team_id", teamID)
+			ts.Log.WithContext(ctx).Warn("Team not found", "team_id", teamID)
 			respondWithError(w, http.StatusNotFound, "Team not found")
 		} else {
-			ts.Log.Error("Failed to query team", "error", err, "team_id", teamID)
+			ts.Log.WithContext(ctx).Error("Failed to query team", "error", err, "team_id", teamID)
 			respondWithError(w, http.StatusInternalServerError, "Failed to get team details")
 		}
 		return
@@ -356,11 +311,14 @@ func (ts *TeamService) GetTeam(w http.ResponseWriter, r *http.Request) {
 	// Cache the result (with 5 minute expiry)
 	// if data, err := json.Marshal(team); err == nil {
 	// 	if err := ts.Cache.Set(ctx, cacheKey, string(data), 5*time.Minute); err != nil {
-	// 		ts.Log.Error("Failed to cache team", "error", err)
+	// 		ts.Log.WithContext(ctx).Error("Failed to cache team", "error", err)
 	// 		// Continue despite cache error
 	// 	}
 	// }
 
+	if utils.NotModified(w, r, utils.ETag("team", team.ID, team.UpdatedAt), team.UpdatedAt) {
+		return
+	}
 	respondWithJSON(w, http.StatusOK, team)
 }
 
@@ -371,24 +329,24 @@ func (ts *TeamService) UpdateTeam(w http.ResponseWriter, r *http.Request) {
 	// Extract user details from context
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		ts.Log.Error("Failed to extract user details from context")
+		ts.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
 
 	// Extract user ID from token
-	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["id"]), 10, 64)
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid user ID in token", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
 	// Get team ID from URL parameters
 	vars := mux.Vars(r)
-	teamID, err := strconv.ParseInt(vars["id"], 10, 64)
+	teamID, err := strconv.ParseInt(vars["team_id"], 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid team ID in URL", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid team ID in URL", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
 		return
 	}
@@ -396,75 +354,71 @@ func (ts *TeamService) UpdateTeam(w http.ResponseWriter, r *http.Request) {
 	// Parse and validate request body
 	var req UpdateTeamRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ts.Log.Error("Failed to decode request body", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to decode request body", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	// Validate input
 	// if err := validator.Validate(req); err != nil {
-	// 	ts.Log.Error("Validation failed", "error", err)
+	// 	ts.Log.WithContext(ctx).Error("Validation failed", "error", err)
 	// 	respondWithError(w, http.StatusBadRequest, err.Error())
 	// 	return
 	// }
 
-	// Check if user has admin or owner role in the team
-	var role string
-	roleQuery := `SELECT role FROM team_members WHERE team_id = ? AND user_id = ?`
-	err = ts.DB.QueryRowContext(ctx, roleQuery, teamID, userID).Scan(&role)
+	if req.Locale != nil && *req.Locale != "" {
+		if l, ok := i18n.Supported(*req.Locale); !ok || l != *req.Locale {
+			respondWithError(w, http.StatusBadRequest, "locale must be one of "+strings.Join(i18n.Locales, ", "))
+			return
+		}
+	}
+
+	// Check if user owns the team
+	role, err := ts.Queries.GetTeamRole(ctx, teamID, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			ts.Log.Warn("Unauthorized team update attempt", "team_id", teamID, "user_id", userID)
+			ts.Log.WithContext(ctx).Warn("Unauthorized team update attempt", "team_id", teamID, "user_id", userID)
 			respondWithError(w, http.StatusForbidden, "You don't have permission to update this team")
 		} else {
-			ts.Log.Error("Failed to check team permissions", "error", err)
+			ts.Log.WithContext(ctx).Error("Failed to check team permissions", "error", err)
 			respondWithError(w, http.StatusInternalServerError, "Failed to check permissions")
 		}
 		return
 	}
 
-	// Only owners and admins can update team details
-	if role != "owner" && role != "admin" {
-		ts.Log.Warn("Insufficient permissions for team update", "team_id", teamID, "user_id", userID, "role", role)
+	// Only owners can update team details
+	if role != teamRoleOwner {
+		ts.Log.WithContext(ctx).Warn("Insufficient permissions for team update", "team_id", teamID, "user_id", userID, "role", role)
 		respondWithError(w, http.StatusForbidden, "You don't have permission to update this team")
 		return
 	}
 
 	// Update team details
-	currentTime := time.Now().UTC()
-	updateQuery := `UPDATE teams SET name = ?, description = ?, updated_at = ? WHERE id = ?`
-	result, err := ts.DB.ExecContext(ctx, updateQuery, req.Name, req.Description, currentTime, teamID)
+	currentTime := time.Now().UTC().Unix()
+	rowsAffected, err := ts.Queries.UpdateTeam(ctx, teamID, req.Name, req.Description, currentTime)
 	if err != nil {
-		ts.Log.Error("Failed to update team", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to update team", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to update team")
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		ts.Log.Error("Failed to get rows affected", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to verify update")
-		return
-	}
-
 	if rowsAffected == 0 {
-		ts.Log.Warn("Team not found for update", "team_id", teamID)
+		ts.Log.WithContext(ctx).Warn("Team not found for update", "team_id", teamID)
 		respondWithError(w, http.StatusNotFound, "Team not found")
 		return
 	}
+	if req.Locale != nil {
+		if err := ts.Queries.SetTeamLocale(ctx, teamID, *req.Locale); err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to set team locale", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update team")
+			return
+		}
+	}
 
 	// Get the updated team
-	var updatedTeam models.Team
-	query := `
-		SELECT id, name, description, created_by, created_at, updated_at
-		FROM teams WHERE id = ?
-	`
-	err = ts.DB.QueryRowContext(ctx, query, teamID).Scan(
-		&updatedTeam.ID, &updatedTeam.Name,
-		&updatedTeam.CreatedBy, &updatedTeam.CreatedAt, &updatedTeam.UpdatedAt,
-	)
+	updatedTeam, err := ts.Queries.GetTeam(ctx, teamID)
 	if err != nil {
-		ts.Log.Error("Failed to get updated team", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to get updated team", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve updated team")
 		return
 	}
@@ -477,13 +431,13 @@ func (ts *TeamService) UpdateTeam(w http.ResponseWriter, r *http.Request) {
 
 	// for _, key := range cacheKeys {
 	// 	if err := ts.Cache.Delete(ctx, key); err != nil {
-	// 		ts.Log.Error("Failed to invalidate cache", "error", err, "key", key)
+	// 		ts.Log.WithContext(ctx).Error("Failed to invalidate cache", "error", err, "key", key)
 	// 		// Continue despite cache error
 	// 	}
 	// }
 
 	// Log the update
-	ts.Log.Info("Team updated", "team_id", teamID, "updated_by", userID)
+	ts.Log.WithContext(ctx).Info("Team updated", "team_id", teamID, "updated_by", userID)
 
 	respondWithJSON(w, http.StatusOK, updatedTeam)
 }
@@ -493,36 +447,34 @@ func (ts *TeamService) GetTeamChannels(w http.ResponseWriter, r *http.Request) {
 
 	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
 	if !ok {
-		ts.Log.Error("Failed to extract user details from context")
+		ts.Log.WithContext(ctx).Error("Failed to extract user details from context")
 		respondWithError(w, http.StatusUnauthorized, "Invalid token")
 		return
 	}
 	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid user ID in token", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 	vars := mux.Vars(r)
 	teamID, err := strconv.ParseInt(vars["team_id"], 10, 64)
 	if err != nil {
-		ts.Log.Error("Invalid team ID in URL", "error", err)
+		ts.Log.WithContext(ctx).Error("Invalid team ID in URL", "error", err)
 		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
 		return
 	}
 
 	// Verify user is a member of the team
-	var isMember bool
-	memberQuery := `SELECT 1 FROM user_teams_mapper WHERE team_id = ? AND user_id = ?`
-	err = ts.DB.QueryRowContext(ctx, memberQuery, teamID, userID).Scan(&isMember)
+	isMember, err := ts.Queries.IsTeamMember(ctx, teamID, userID)
 	if err != nil {
-		ts.Log.Error("Failed to check team membership", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to verify team membership")
 		return
 	}
 
 	if !isMember {
-		ts.Log.Warn("Unauthorized channel access attempt", "team_id", teamID, "user_id", userID)
+		ts.Log.WithContext(ctx).Warn("Unauthorized channel access attempt", "team_id", teamID, "user_id", userID)
 		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
 		return
 	}
@@ -539,52 +491,19 @@ func (ts *TeamService) GetTeamChannels(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * perPage
 
 	// Count total channels for pagination
-	var totalCount int
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM channels c
-		INNER JOIN channel_members CM on CM.channel_id = c.channel_id
-		WHERE c.team_id = ? and CM.user_id = ?
-	`
-	err = ts.DB.QueryRowContext(ctx, countQuery, teamID, userID).Scan(&totalCount)
+	totalCount, err := ts.Queries.Reads().CountMemberTeamChannels(ctx, teamID, userID)
 	if err != nil {
-		ts.Log.Error("Failed to count channels", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to count channels", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get channels")
 		return
 	}
 
-	// Query to get channels with pagination
-	query := `
-		SELECT c.channel_id, c.team_id, c.channel_name, c.description, c.is_private, c.created_by, c.created_at, c.updated_at
-		FROM channels c
-		INNER JOIN channel_members CM on CM.channel_id = c.channel_id
-		WHERE c.team_id = ? and CM.user_id = ?
-		LIMIT ? OFFSET ?
-	`
-	rows, err := ts.DB.QueryContext(ctx, query, teamID, userID, perPage, offset)
+	channels, err := ts.Queries.Reads().ListMemberTeamChannels(ctx, teamID, userID, perPage, offset)
 	if err != nil {
-		ts.Log.Error("Failed to query channels", "error", err)
+		ts.Log.WithContext(ctx).Error("Failed to query channels", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to get channels")
 		return
 	}
-	defer rows.Close()
-
-	var channels []models.Channel
-	for rows.Next() {
-		var c models.Channel
-		if err := rows.Scan(&c.ChannelID, &c.TeamID, &c.Name, &c.Description, &c.IsPrivate, &c.CreatedBy, &c.CreatedAt, &c.UpdatedAt); err != nil {
-			ts.Log.Error("Failed to scan channel row", "error", err)
-			respondWithError(w, http.StatusInternalServerError, "Failed to process channels data")
-			return
-		}
-		channels = append(channels, c)
-	}
-
-	if err := rows.Err(); err != nil {
-		ts.Log.Error("Error iterating channels rows", "error", err)
-		respondWithError(w, http.StatusInternalServerError, "Error processing channels data")
-		return
-	}
 
 	// Build response
 	response := models.PaginationResponse{
@@ -594,11 +513,113 @@ func (ts *TeamService) GetTeamChannels(w http.ResponseWriter, r *http.Request) {
 		PerPage:    perPage,
 	}
 
-	ts.Log.Info("Channels fetched from database", "team_id", teamID, "user_id", userID, "count", len(channels))
+	// Every change to a listed channel bumps its updated_at, joins and leaves
+	// change the IDs or the total, and the user's own stars and order are
+	// hashed with each channel
+	parts := []interface{}{"team-channels", teamID, userID, r.URL.RawQuery, totalCount}
+	for _, c := range channels {
+		parts = append(parts, c.ChannelID, c.UpdatedAt, c.ArchivedAt, c.Starred, c.SortOrder)
+	}
+	if utils.NotModified(w, r, utils.ETag(parts...), 0) {
+		return
+	}
+
+	// Trim the payload when the client asked for specific fields
+	if selection := utils.ParseFieldSelection(r, models.ChannelCompactFields); selection != nil {
+		trimmed, err := selection.Apply(channels)
+		if err != nil {
+			ts.Log.WithContext(ctx).Error("Failed to apply field selection", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "Error processing channels data")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"channels":    trimmed,
+			"total_count": response.TotalCount,
+			"page":        response.Page,
+			"per_page":    response.PerPage,
+		})
+		return
+	}
+
+	ts.Log.WithContext(ctx).Info("Channels fetched from database", "team_id", teamID, "user_id", userID, "count", len(channels))
 	respondWithJSON(w, http.StatusOK, response)
 
 }
 
+// GetTeamChannelsDelta returns the user's channels in a team that were created,
+// updated or archived since the given checkpoint
+func (ts *TeamService) GetTeamChannelsDelta(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		ts.Log.WithContext(ctx).Error("Failed to extract user details from context")
+		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Invalid user ID in token", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	vars := mux.Vars(r)
+	teamID, err := strconv.ParseInt(vars["team_id"], 10, 64)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Invalid team ID in URL", "error", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid since checkpoint")
+		return
+	}
+
+	// Verify user is a member of the team
+	isMember, err := ts.Queries.IsTeamMember(ctx, teamID, userID)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to check team membership", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify team membership")
+		return
+	}
+
+	if !isMember {
+		ts.Log.WithContext(ctx).Warn("Unauthorized channel access attempt", "team_id", teamID, "user_id", userID)
+		respondWithError(w, http.StatusForbidden, "You don't have access to this team")
+		return
+	}
+
+	// Take the checkpoint before querying so changes made while the query runs
+	// are picked up by the next delta. Timestamps have second precision, so the
+	// comparison is inclusive and clients may see a channel twice.
+	checkpoint := time.Now().UTC().Unix()
+
+	changed, err := ts.Queries.ListMemberTeamChannelChanges(ctx, teamID, userID, since)
+	if err != nil {
+		ts.Log.WithContext(ctx).Error("Failed to query channel delta", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to get channels")
+		return
+	}
+
+	response := models.ChannelDeltaResponse{
+		Channels:    []models.Channel{},
+		ArchivedIDs: []int64{},
+		Since:       since,
+		Checkpoint:  checkpoint,
+	}
+	for _, c := range changed {
+		if c.ArchivedAt > 0 {
+			response.ArchivedIDs = append(response.ArchivedIDs, c.ChannelID)
+			continue
+		}
+		response.Channels = append(response.Channels, c)
+	}
+
+	ts.Log.WithContext(ctx).Info("Channel delta fetched", "team_id", teamID, "user_id", userID, "since", since, "changed", len(response.Channels), "archived", len(response.ArchivedIDs))
+	respondWithJSON(w, http.StatusOK, response)
+}
+
 // Helper functions for HTTP responses
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
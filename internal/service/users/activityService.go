@@ -0,0 +1,104 @@
+package profileService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikhil/eaven/internal/middleware"
+	models "github.com/nikhil/eaven/internal/models"
+	messageService "github.com/nikhil/eaven/internal/service/messages"
+)
+
+// previewLength caps the latest message preview returned per channel
+const previewLength = 100
+
+// GetUserActivity returns unread counts, mention counts and the latest message
+// preview for every channel the user belongs to, across all of their teams.
+// The totals follow each channel's notification level.
+func (profile *ProfileService) GetUserActivity(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	// Unread messages are the ones after the member's read cursor that were not
+	// written by the member
+	query := `
+		SELECT c.channel_id, c.channel_name, t.team_id, t.team_name,
+			COUNT(m.message_id) AS unread_count,
+			CASE WHEN cm.notify_level = 'muted' THEN 0
+				ELSE COALESCE(SUM(` + messageService.MentionCondition + `), 0) END AS mention_count,
+			cm.notify_level,
+			lm.message_id, lm.user_id, lm.content, lm.message_created_at
+		FROM channel_members cm
+		INNER JOIN channels c ON c.channel_id = cm.channel_id
+		INNER JOIN teams t ON t.team_id = c.team_id
+		INNER JOIN users u ON u.user_id = cm.user_id
+		LEFT JOIN messages m ON m.channel_id = cm.channel_id
+			AND m.message_id > cm.last_read_message_id
+			AND m.user_id <> cm.user_id
+		LEFT JOIN messages lm ON lm.message_id = (
+			SELECT MAX(message_id) FROM messages WHERE channel_id = cm.channel_id
+		)
+		WHERE cm.user_id = ?
+		GROUP BY c.channel_id, c.channel_name, t.team_id, t.team_name, cm.notify_level,
+			lm.message_id, lm.user_id, lm.content, lm.message_created_at
+		ORDER BY lm.message_created_at DESC
+	`
+	rows, err := profile.DB.QueryContext(r.Context(), query, userDetails["user_id"])
+	if err != nil {
+		http.Error(w, "Failed to get activity", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	activity := []models.ChannelActivity{}
+	totalUnread, totalMentions := 0, 0
+	for rows.Next() {
+		var a models.ChannelActivity
+		var lastID, lastUserID, lastTime sql.NullInt64
+		var lastContent sql.NullString
+		if err := rows.Scan(&a.ChannelID, &a.ChannelName, &a.TeamID, &a.TeamName,
+			&a.UnreadCount, &a.MentionCount, &a.NotifyLevel,
+			&lastID, &lastUserID, &lastContent, &lastTime); err != nil {
+			http.Error(w, "Failed to process activity data", http.StatusInternalServerError)
+			return
+		}
+		if lastID.Valid {
+			a.LatestMessage = &models.MessagePreview{
+				MessageID:   lastID.Int64,
+				UserID:      lastUserID.Int64,
+				Content:     truncatePreview(lastContent.String),
+				MessageTime: lastTime.Int64,
+			}
+		}
+		if a.NotifyLevel == models.NotifyAll {
+			totalUnread += a.UnreadCount
+		}
+		totalMentions += a.MentionCount
+		activity = append(activity, a)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to process activity data", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":           "200",
+		"message":        "User activity",
+		"total_unread":   totalUnread,
+		"total_mentions": totalMentions,
+		"channels":       activity,
+	})
+}
+
+func truncatePreview(content string) string {
+	runes := []rune(content)
+	if len(runes) <= previewLength {
+		return content
+	}
+	return string(runes[:previewLength]) + "…"
+}
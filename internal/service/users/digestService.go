@@ -0,0 +1,108 @@
+package profileService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikhil/eaven/internal/digest"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// DigestPreferences is a user's digest email schedule. Hours and weekdays are
+// in UTC; weekday 0 is Sunday.
+type DigestPreferences struct {
+	Cadence     string `json:"cadence"`
+	SendHour    int    `json:"send_hour"`
+	SendWeekday int    `json:"send_weekday"`
+	LastSentAt  int64  `json:"last_sent_at,omitempty"`
+}
+
+// GetDigestPreferences returns the user's digest schedule, or the defaults
+// when they never configured one
+func (profile *ProfileService) GetDigestPreferences(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	prefs := DigestPreferences{
+		Cadence:     digest.DefaultCadence,
+		SendHour:    digest.DefaultHour,
+		SendWeekday: digest.DefaultWeekday,
+	}
+	query := "SELECT cadence, send_hour, send_weekday, last_sent_at FROM digest_preferences WHERE user_id = ?"
+	err := profile.DB.QueryRowContext(r.Context(), query, userDetails["user_id"]).Scan(&prefs.Cadence, &prefs.SendHour, &prefs.SendWeekday, &prefs.LastSentAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Failed to get digest preferences", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Digest preferences", "digest": prefs})
+}
+
+// UpdateDigestPreferences sets the digest cadence and send time. Setting the
+// cadence to "off" opts the user out of digest emails.
+func (profile *ProfileService) UpdateDigestPreferences(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	prefs := DigestPreferences{SendHour: digest.DefaultHour, SendWeekday: digest.DefaultWeekday}
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	switch prefs.Cadence {
+	case digest.CadenceOff, digest.CadenceDaily, digest.CadenceWeekly:
+	default:
+		http.Error(w, "cadence must be one of off, daily, weekly", http.StatusBadRequest)
+		return
+	}
+	if prefs.SendHour < 0 || prefs.SendHour > 23 {
+		http.Error(w, "send_hour must be between 0 and 23", http.StatusBadRequest)
+		return
+	}
+	if prefs.SendWeekday < 0 || prefs.SendWeekday > 6 {
+		http.Error(w, "send_weekday must be between 0 and 6", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		INSERT INTO digest_preferences (user_id, cadence, send_hour, send_weekday, last_sent_at, updated_at)
+		VALUES (?, ?, ?, ?, 0, ?)
+		ON DUPLICATE KEY UPDATE cadence = VALUES(cadence), send_hour = VALUES(send_hour),
+			send_weekday = VALUES(send_weekday), updated_at = VALUES(updated_at)
+	`
+	_, err := profile.DB.ExecContext(r.Context(), query, userDetails["user_id"], prefs.Cadence, prefs.SendHour, prefs.SendWeekday, time.Now().UTC().Unix())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Digest preferences updated successfully", "digest": prefs})
+}
+
+// UnsubscribeChannelEmail removes a channel email subscription using the
+// token from the summary email. Subscribers have no account, so this route
+// is public and the token is the only credential.
+func (profile *ProfileService) UnsubscribeChannelEmail(w http.ResponseWriter, r *http.Request) {
+	err := digest.Unsubscribe(r.Context(), r.URL.Query().Get("token"))
+	if errors.Is(err, digest.ErrSubscriptionNotFound) {
+		http.Error(w, "Subscription not found or already removed", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "You have been unsubscribed"})
+}
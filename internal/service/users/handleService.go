@@ -0,0 +1,111 @@
+package profileService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/handles"
+	"github.com/nikhil/eaven/internal/workspace"
+)
+
+// ChangeHandleRequest represents the request body for changing the user's
+// @handle
+type ChangeHandleRequest struct {
+	Handle string `json:"handle"`
+}
+
+// handleProfile is what other users see when looking someone up by handle
+type handleProfile struct {
+	UserID    int64  `json:"user_id"`
+	Handle    string `json:"handle"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// ChangeHandle gives the user a new @handle. The old handle keeps resolving
+// to them, and keeps mentioning them, for handles.GracePeriod.
+func (profile *ProfileService) ChangeHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req ChangeHandleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	handle, err := handles.Change(ctx, profile.DB, userID, req.Handle, now)
+	switch {
+	case err == nil:
+	case errors.Is(err, handles.ErrInvalidHandle):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, handles.ErrHandleTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		profile.Log.WithContext(ctx).Error("Failed to change handle", "error", err)
+		http.Error(w, "Failed to change handle", http.StatusInternalServerError)
+		return
+	}
+
+	profile.Log.WithContext(ctx).Audit("Handle changed", "user_id", userID, "handle", handle)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":                 "200",
+		"message":              "Handle changed",
+		"handle":               handle,
+		"old_handle_redirects": now.Add(handles.GracePeriod).Unix(),
+	})
+}
+
+// GetUserByHandle looks up a user of the workspace by @handle. A handle
+// changed within the grace period answers 301 with the user's current handle
+// in Location, so old links keep working.
+func (profile *ProfileService) GetUserByHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if _, ok := keyUser(w, r); !ok {
+		return
+	}
+
+	userID, moved, err := handles.Resolve(ctx, profile.DB, workspace.FromContext(ctx), mux.Vars(r)["handle"], time.Now().UTC())
+	if errors.Is(err, handles.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		profile.Log.WithContext(ctx).Error("Failed to resolve handle", "error", err)
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return
+	}
+
+	var user handleProfile
+	err = profile.DB.QueryRowContext(ctx, `SELECT user_id, handle, first_name, last_name FROM users WHERE user_id = ?`, userID).
+		Scan(&user.UserID, &user.Handle, &user.FirstName, &user.LastName)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		profile.Log.WithContext(ctx).Error("Failed to get user", "error", err)
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return
+	}
+
+	if moved {
+		// Relative to the requested path, so it resolves wherever the API is
+		// mounted
+		w.Header().Set("Location", url.PathEscape(user.Handle))
+		w.WriteHeader(http.StatusMovedPermanently)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "User details", "user": user, "moved": moved})
+}
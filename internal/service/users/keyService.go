@@ -0,0 +1,143 @@
+package profileService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/e2e"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// PublishDeviceKeyRequest represents the request body for publishing the
+// public key of one of the user's devices
+type PublishDeviceKeyRequest struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+}
+
+// ListDeviceKeys returns the public keys the user has published
+func (profile *ProfileService) ListDeviceKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := e2e.UserKeys(r.Context(), profile.DB, userID)
+	if err != nil {
+		profile.Log.WithContext(r.Context()).Error("Failed to list device keys", "error", err)
+		http.Error(w, "Failed to get device keys", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Device keys", "keys": keys})
+}
+
+// PublishDeviceKey publishes or rotates the public key of one of the user's
+// devices
+func (profile *ProfileService) PublishDeviceKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req PublishDeviceKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := e2e.PublishKey(r.Context(), profile.DB, userID, mux.Vars(r)["device_id"], req.Algorithm, req.PublicKey)
+	switch {
+	case err == nil:
+	case errors.Is(err, e2e.ErrInvalidKey):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, e2e.ErrTooManyDevices):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		profile.Log.WithContext(r.Context()).Error("Failed to publish device key", "error", err)
+		http.Error(w, "Failed to publish device key", http.StatusInternalServerError)
+		return
+	}
+
+	profile.Log.WithContext(r.Context()).Audit("Device key published", "user_id", userID, "device_id", key.DeviceID, "algorithm", key.Algorithm)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Device key published", "key": key})
+}
+
+// RevokeDeviceKey removes the public key of one of the user's devices
+func (profile *ProfileService) RevokeDeviceKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	deviceID := mux.Vars(r)["device_id"]
+	removed, err := e2e.RevokeKey(r.Context(), profile.DB, userID, deviceID)
+	if err != nil {
+		profile.Log.WithContext(r.Context()).Error("Failed to revoke device key", "error", err)
+		http.Error(w, "Failed to revoke device key", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "No key for this device", http.StatusNotFound)
+		return
+	}
+
+	profile.Log.WithContext(r.Context()).Audit("Device key revoked", "user_id", userID, "device_id", deviceID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Device key revoked"})
+}
+
+// GetUserKeys returns the public keys of another user. Keys are visible to
+// the members of the teams the user belongs to.
+func (profile *ProfileService) GetUserKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+	peerID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if peerID != userID {
+		shared, err := e2e.SharesTeam(r.Context(), profile.DB, userID, peerID)
+		if err != nil {
+			profile.Log.WithContext(r.Context()).Error("Failed to check shared teams", "error", err)
+			http.Error(w, "Failed to get device keys", http.StatusInternalServerError)
+			return
+		}
+		if !shared {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	keys, err := e2e.UserKeys(r.Context(), profile.DB, peerID)
+	if err != nil {
+		profile.Log.WithContext(r.Context()).Error("Failed to list device keys", "error", err)
+		http.Error(w, "Failed to get device keys", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Device keys", "user_id": peerID, "keys": keys})
+}
+
+func keyUser(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,68 @@
+package profileService
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikhil/eaven/internal/middleware"
+)
+
+// OfflineEmailPreferences controls the emails sent about mentions while the
+// user is away. They are on by default.
+type OfflineEmailPreferences struct {
+	Enabled    bool  `json:"enabled"`
+	LastSentAt int64 `json:"last_sent_at,omitempty"`
+}
+
+// GetOfflineEmailPreferences returns whether the user gets offline mention
+// emails
+func (profile *ProfileService) GetOfflineEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	prefs := OfflineEmailPreferences{Enabled: true}
+	query := "SELECT enabled, last_sent_at FROM offline_email_preferences WHERE user_id = ?"
+	err := profile.DB.QueryRowContext(r.Context(), query, userDetails["user_id"]).Scan(&prefs.Enabled, &prefs.LastSentAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Failed to get offline email preferences", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Offline email preferences", "offline_email": prefs})
+}
+
+// UpdateOfflineEmailPreferences opts the user in or out of offline mention
+// emails
+func (profile *ProfileService) UpdateOfflineEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	userDetails, ok := r.Context().Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var prefs OfflineEmailPreferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		INSERT INTO offline_email_preferences (user_id, enabled, updated_at)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE enabled = VALUES(enabled), updated_at = VALUES(updated_at)
+	`
+	_, err := profile.DB.ExecContext(r.Context(), query, userDetails["user_id"], prefs.Enabled, time.Now().UTC().Unix())
+	if err != nil {
+		http.Error(w, "Failed to update offline email preferences", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Offline email preferences updated successfully", "offline_email": prefs})
+}
@@ -0,0 +1,73 @@
+package profileService
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nikhil/eaven/internal/preferences"
+	"github.com/nikhil/eaven/internal/utils"
+)
+
+// GetPreferences returns the user's synced client settings, with defaults for
+// the known keys they never set. Clients revalidate with If-None-Match.
+func (profile *ProfileService) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := preferences.Get(ctx, profile.DB, userID)
+	if err != nil {
+		profile.Log.WithContext(ctx).Error("Failed to get preferences", "error", err)
+		http.Error(w, "Failed to get preferences", http.StatusInternalServerError)
+		return
+	}
+	writePreferences(w, r, prefs)
+}
+
+// UpdatePreferences applies a JSON merge patch to the user's settings: keys
+// given a value are stored and keys set to null go back to their default
+func (profile *ProfileService) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&patch); err != nil {
+		http.Error(w, "Invalid request payload: expected a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := preferences.Patch(ctx, profile.DB, userID, patch, time.Now().UTC())
+	var invalid *preferences.ValidationError
+	if errors.As(err, &invalid) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": "400", "message": "Invalid preferences", "errors": invalid.Problems})
+		return
+	}
+	if err != nil {
+		profile.Log.WithContext(ctx).Error("Failed to update preferences", "error", err)
+		http.Error(w, "Failed to update preferences", http.StatusInternalServerError)
+		return
+	}
+	writePreferences(w, r, prefs)
+}
+
+func writePreferences(w http.ResponseWriter, r *http.Request, prefs preferences.Preferences) {
+	// Removing a key does not leave a newer updated_at behind, so the tag
+	// covers the values themselves
+	values, _ := json.Marshal(prefs.Values)
+	etag := utils.ETag("preferences", string(values))
+	if r.Method != http.MethodGet {
+		w.Header().Set("ETag", etag)
+	} else if utils.NotModified(w, r, etag, 0) {
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Preferences", "preferences": prefs.Values, "updated_at": prefs.UpdatedAt})
+}
@@ -4,20 +4,26 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/fieldcrypt"
+	"github.com/nikhil/eaven/internal/logger"
 	"github.com/nikhil/eaven/internal/middleware"
 	models "github.com/nikhil/eaven/internal/models"
+	"github.com/nikhil/eaven/internal/utils"
 )
 
 type ProfileService struct {
-	DB *sql.DB
+	DB  *sql.DB
+	Log *logger.Logger
 }
 
-func NewProfileService() *ProfileService {
+func NewProfileService(db *sql.DB, log *logger.Logger) *ProfileService {
 	return &ProfileService{
-		DB: database.DB,
+		DB:  db,
+		Log: log,
 	}
 }
 func (profile *ProfileService) GetUserProfile(w http.ResponseWriter, r *http.Request) {
@@ -29,8 +35,25 @@ func (profile *ProfileService) GetUserProfile(w http.ResponseWriter, r *http.Req
 	// var user map[string]interface{}
 	// query := "Select * from users where user_id =  ?"
 	// profile.DB.QueryRow(query, userDetails["user_id"]).Scan(&user)
-	user, _ := database.GetSqlQueryRow("Select user_id , email , contact_number , first_name , last_name, created_at from users where user_id =  ?", userDetails["user_id"])
+	user, err := database.GetSqlQueryRow(r.Context(), "Select user_id , email , handle , contact_number , first_name , last_name, created_at, updated_at from users where user_id =  ?", userDetails["user_id"])
+	if err != nil {
+		http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+		return
+	}
+	if stored, ok := user["contact_number"].(string); ok {
+		contactNumber, err := fieldcrypt.Default().Open(stored)
+		if err != nil {
+			profile.Log.WithContext(r.Context()).Error("Failed to decrypt contact number", "error", err)
+			http.Error(w, "Failed to get user details", http.StatusInternalServerError)
+			return
+		}
+		user["contact_number"] = contactNumber
+	}
 	user["name"] = user["first_name"].(string) + " " + user["last_name"].(string)
+	updatedAt, _ := user["updated_at"].(int64)
+	if utils.NotModified(w, r, utils.ETag("profile", user["user_id"], updatedAt), updatedAt) {
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "User details", "user_details": user})
 }
 
@@ -46,8 +69,8 @@ func (profile *ProfileService) UpdateUserProfile(w http.ResponseWriter, r *http.
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
-	query := "UPDATE users SET contact_number = ? , first_name = ? , last_name = ? WHERE user_id = ?"
-	err = database.SendSqlStatement(query, user.ContactNumber, user.FirstName, user.LastName, userDetails["user_id"])
+	query := "UPDATE users SET contact_number = ? , first_name = ? , last_name = ?, updated_at = ? WHERE user_id = ?"
+	err = database.SendSqlStatement(r.Context(), query, fieldcrypt.String(user.ContactNumber), user.FirstName, user.LastName, time.Now().UTC().Unix(), userDetails["user_id"])
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,74 @@
+package profileService
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/middleware"
+	"github.com/nikhil/eaven/internal/moderation"
+)
+
+// ReportUserRequest represents the request body for reporting a member of a
+// team
+type ReportUserRequest struct {
+	TeamID  int64  `json:"team_id"`
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// ReportUser files an abuse report against another member of one of the
+// user's teams and tells the team's owners
+func (profile *ProfileService) ReportUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userDetails, ok := ctx.Value(middleware.UserContextKey).(jwt.MapClaims)
+	if !ok {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	reporterID, _ := strconv.ParseInt(fmt.Sprintf("%v", userDetails["user_id"]), 10, 64)
+	userID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReportUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TeamID <= 0 {
+		http.Error(w, "Invalid request payload: team_id is required", http.StatusBadRequest)
+		return
+	}
+
+	report, err := moderation.FileUserReport(ctx, profile.DB, reporterID, userID, req.TeamID, req.Reason, req.Details)
+	switch {
+	case err == nil:
+	case errors.Is(err, moderation.ErrInvalidReport):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, moderation.ErrReportTargetNotFound):
+		http.Error(w, "User not found in this team", http.StatusNotFound)
+		return
+	case errors.Is(err, moderation.ErrDuplicateReport):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		profile.Log.WithContext(ctx).Error("Failed to file user report", "error", err, "reported_user_id", userID)
+		http.Error(w, "Failed to report user", http.StatusInternalServerError)
+		return
+	}
+
+	profile.Log.WithContext(ctx).Audit("User reported", "report_id", report.ReportID, "reported_user_id", userID, "team_id", report.TeamID, "reason", report.Reason)
+
+	// The report is stored, so a failed email is only logged
+	if _, err := moderation.NotifyReport(ctx, profile.DB, report); err != nil {
+		profile.Log.WithContext(ctx).Warn("Failed to notify team owners of report", "error", err, "report_id", report.ReportID)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "201", "message": "Thanks, the report was sent to your team's administrators", "report_id": report.ReportID})
+}
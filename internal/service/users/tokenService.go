@@ -0,0 +1,105 @@
+package profileService
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nikhil/eaven/internal/pat"
+)
+
+// defaultTokenDays is how long a token lives when the request does not say
+const defaultTokenDays = 30
+
+// CreateAccessTokenRequest represents the request body for creating a
+// personal access token
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// ListAccessTokens returns the user's personal access tokens, including
+// revoked and expired ones, without their secrets
+func (profile *ProfileService) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := pat.List(r.Context(), profile.DB, userID)
+	if err != nil {
+		profile.Log.WithContext(r.Context()).Error("Failed to list access tokens", "error", err)
+		http.Error(w, "Failed to get access tokens", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Access tokens", "tokens": tokens})
+}
+
+// CreateAccessToken issues a personal access token. The token is only ever
+// returned in this response.
+func (profile *ProfileService) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenDays
+	}
+
+	token, err := pat.Create(r.Context(), profile.DB, userID, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	switch {
+	case err == nil:
+	case errors.Is(err, pat.ErrInvalidToken):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, pat.ErrTooManyTokens):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		profile.Log.WithContext(r.Context()).Error("Failed to create access token", "error", err)
+		http.Error(w, "Failed to create access token", http.StatusInternalServerError)
+		return
+	}
+
+	profile.Log.WithContext(r.Context()).Audit("Access token created", "user_id", userID, "token_id", token.TokenID, "scopes", token.Scopes, "expires_at", token.ExpiresAt)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "201", "message": "Access token created, store it now as it cannot be shown again", "token": token})
+}
+
+// RevokeAccessToken disables one of the user's personal access tokens
+func (profile *ProfileService) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := keyUser(w, r)
+	if !ok {
+		return
+	}
+	tokenID, err := strconv.ParseInt(mux.Vars(r)["token_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	err = pat.Revoke(r.Context(), profile.DB, userID, tokenID)
+	if errors.Is(err, pat.ErrTokenNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		profile.Log.WithContext(r.Context()).Error("Failed to revoke access token", "error", err)
+		http.Error(w, "Failed to revoke access token", http.StatusInternalServerError)
+		return
+	}
+
+	profile.Log.WithContext(r.Context()).Audit("Access token revoked", "user_id", userID, "token_id", tokenID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": "200", "message": "Access token revoked"})
+}
@@ -0,0 +1,232 @@
+// Package smoke runs the core user flows end to end against the API:
+// signup and login, profile, team, channel and message. Each step checks the
+// response and reads the change back, so queries that succeed without
+// changing anything are caught too. cmd/smoke runs the steps against a
+// deployed server, and the integration tests against one they start.
+package smoke
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Client sends JSON requests as the smoke user and carries what earlier
+// steps created to later ones
+type Client struct {
+	Base string
+	HTTP *http.Client
+
+	email     string
+	password  string
+	token     string
+	teamID    int64
+	channelID int64
+	messageID int64
+}
+
+// NewClient returns a client for the API at base. Each client signs up a
+// fresh user, so runs do not depend on each other.
+func NewClient(base string, httpClient *http.Client) *Client {
+	return &Client{Base: base, HTTP: httpClient}
+}
+
+// Step is one flow, run in order after the ones before it
+type Step struct {
+	Name string
+	Run  func(*Client) error
+}
+
+// Steps are the flows in the order they must run
+var Steps = []Step{
+	{"signup", signup},
+	{"login", login},
+	{"update profile", updateProfile},
+	{"create team", createTeam},
+	{"update team", updateTeam},
+	{"create channel", createChannel},
+	{"send message", sendMessage},
+	{"read messages", readMessages},
+}
+
+func signup(c *Client) error {
+	c.email = fmt.Sprintf("smoke-%d@example.com", time.Now().UnixNano())
+	c.password = "Quartz-Lantern-" + strconv.FormatInt(time.Now().Unix(), 36)
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"email": c.email, "password": c.password, "first_name": "Smoke", "last_name": "Test"}
+	if err := c.do(http.MethodPost, "/auth/signup", body, http.StatusCreated, &resp); err != nil {
+		return err
+	}
+	if resp.Token == "" {
+		return fmt.Errorf("no token in response")
+	}
+	return nil
+}
+
+func login(c *Client) error {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := map[string]string{"email": c.email, "password": c.password}
+	if err := c.do(http.MethodPost, "/auth/login", body, http.StatusOK, &resp); err != nil {
+		return err
+	}
+	if resp.Token == "" {
+		return fmt.Errorf("no token in response")
+	}
+	c.token = resp.Token
+	return nil
+}
+
+func updateProfile(c *Client) error {
+	body := map[string]string{"first_name": "Updated", "last_name": "Smoke", "contact_number": "+15550100"}
+	if err := c.do(http.MethodPut, "/user/profile", body, http.StatusOK, nil); err != nil {
+		return err
+	}
+	var resp struct {
+		User struct {
+			FirstName     string `json:"first_name"`
+			ContactNumber string `json:"contact_number"`
+		} `json:"user_details"`
+	}
+	if err := c.do(http.MethodGet, "/user/profile", nil, http.StatusOK, &resp); err != nil {
+		return err
+	}
+	if resp.User.FirstName != "Updated" || resp.User.ContactNumber != "+15550100" {
+		return fmt.Errorf("profile not updated: got %+v", resp.User)
+	}
+	return nil
+}
+
+func createTeam(c *Client) error {
+	var resp struct {
+		ID int64 `json:"id"`
+	}
+	body := map[string]string{"name": "Smoke team", "description": "Created by the smoke run"}
+	if err := c.do(http.MethodPost, "/team/create", body, http.StatusCreated, &resp); err != nil {
+		return err
+	}
+	if resp.ID == 0 {
+		return fmt.Errorf("no team ID in response")
+	}
+	c.teamID = resp.ID
+	return nil
+}
+
+func updateTeam(c *Client) error {
+	path := fmt.Sprintf("/team/update/%d", c.teamID)
+	body := map[string]string{"name": "Smoke team renamed", "description": "Updated by the smoke run"}
+	if err := c.do(http.MethodPut, path, body, http.StatusOK, nil); err != nil {
+		return err
+	}
+	var resp struct {
+		Name string `json:"name"`
+	}
+	if err := c.do(http.MethodGet, fmt.Sprintf("/team/get/%d", c.teamID), nil, http.StatusOK, &resp); err != nil {
+		return err
+	}
+	if resp.Name != "Smoke team renamed" {
+		return fmt.Errorf("team not updated: name is %q", resp.Name)
+	}
+	return nil
+}
+
+func createChannel(c *Client) error {
+	var resp struct {
+		ChannelID int64 `json:"channl_id"`
+	}
+	body := map[string]interface{}{"team_id": c.teamID, "name": "smoke", "description": "Created by the smoke run"}
+	if err := c.do(http.MethodPost, "/channel/create", body, http.StatusCreated, &resp); err != nil {
+		return err
+	}
+	if resp.ChannelID == 0 {
+		return fmt.Errorf("no channel ID in response")
+	}
+	c.channelID = resp.ChannelID
+	return nil
+}
+
+func sendMessage(c *Client) error {
+	var resp struct {
+		MessageID int64 `json:"message_id"`
+	}
+	body := map[string]interface{}{"channel_id": c.channelID, "content": "hello from the smoke run"}
+	if err := c.do(http.MethodPost, "/channel/message", body, http.StatusOK, &resp); err != nil {
+		return err
+	}
+	if resp.MessageID == 0 {
+		return fmt.Errorf("no message ID in response")
+	}
+	c.messageID = resp.MessageID
+	return nil
+}
+
+func readMessages(c *Client) error {
+	var resp struct {
+		Channels []struct {
+			Messages []struct {
+				MessageID int64  `json:"message_id"`
+				Content   string `json:"content"`
+			} `json:"messages"`
+		} `json:"channels"`
+	}
+	body := map[string]interface{}{"channels": []map[string]int64{{"channel_id": c.channelID}}}
+	if err := c.do(http.MethodPost, "/messages/batch", body, http.StatusOK, &resp); err != nil {
+		return err
+	}
+	for _, channel := range resp.Channels {
+		for _, msg := range channel.Messages {
+			if msg.MessageID == c.messageID && msg.Content == "hello from the smoke run" {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("message %d not in the channel's messages", c.messageID)
+}
+
+// do sends body as JSON, fails unless the response has status want and
+// decodes it into out when out is not nil
+func (c *Client) do(method, path string, body interface{}, want int, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, c.Base+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != want {
+		return fmt.Errorf("%s %s: status %d, want %d: %s", method, path, resp.StatusCode, want, bytes.TrimSpace(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,456 @@
+package sse
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/logger"
+	"github.com/nikhil/eaven/internal/outbox"
+)
+
+const (
+	// tailBatch bounds the events read per poll
+	tailBatch = 500
+	// gapWait is how long a skipped event ID is watched for. Transactions
+	// commit out of ID order, so an event can appear after later ones; IDs
+	// still missing after this were rolled back.
+	gapWait = 10 * time.Second
+	// subscriberBuffer is how many events a slow stream may fall behind
+	// before it is closed; the client resumes with Last-Event-ID
+	subscriberBuffer = 256
+	// maxGaps bounds the skipped IDs watched after one jump, since an
+	// auto-increment can leap ahead after a restart
+	maxGaps = 1000
+	// StaleAfter is how long a stream may go without delivering anything
+	// before the broker closes it. Streams send a heartbeat well within it,
+	// so only connections whose peer stopped reading reach it.
+	StaleAfter = 90 * time.Second
+	// reapEvery is how often streams are checked for staleness
+	reapEvery = 15 * time.Second
+)
+
+// LimitError refuses a stream because its user or address already has as
+// many streams open as allowed. Clients should share one stream between
+// their tabs instead of opening more.
+type LimitError struct {
+	// Scope is "user" or "ip"
+	Scope string
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("too many event streams: at most %d per %s", e.Limit, e.Scope)
+}
+
+// ErrDraining refuses a stream because this process is draining its
+// connections before it stops; clients reconnect, reaching another process
+var ErrDraining = errors.New("this server is draining its event streams")
+
+// Broker tails the event outbox and fans events out to connected streams.
+// Every API process tails the table itself, so streams see events written by
+// any process, in addition to those dispatched here.
+type Broker struct {
+	DB   *sql.DB
+	Log  *logger.Logger
+	Poll time.Duration
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	cursor atomic.Int64
+	// settled is the newest ID below which no event can still appear
+	settled atomic.Int64
+	gaps    map[int64]time.Time
+	wake    chan struct{}
+	// reaped counts streams closed for going stale
+	reaped atomic.Int64
+	// MaxPerUser and MaxPerIP cap the streams open at once in this process;
+	// 0 is no cap
+	MaxPerUser int
+	MaxPerIP   int
+	perUser    map[int64]int
+	perIP      map[string]int
+	refused    atomic.Int64
+	// draining refuses new streams once Drain closed the open ones
+	draining atomic.Bool
+}
+
+// Subscription receives the events of one stream
+type Subscription struct {
+	Events chan outbox.Event
+	// Done is closed when the broker drops a stream that fell behind or
+	// went stale
+	Done chan struct{}
+	once sync.Once
+	// alive is the Unix nanosecond time of the stream's last delivery
+	alive  atomic.Int64
+	userID int64
+	ip     string
+	// reconnect is set, in milliseconds, when the stream is closed by Drain
+	reconnect atomic.Int64
+}
+
+// Alive records that the stream just delivered something to its client. A
+// stream that does not call it within StaleAfter is closed.
+func (s *Subscription) Alive(now time.Time) {
+	s.alive.Store(now.UnixNano())
+}
+
+// Reconnect returns how long the client should wait before reconnecting
+// when its stream was closed by Drain
+func (s *Subscription) Reconnect() (time.Duration, bool) {
+	ms := s.reconnect.Load()
+	return time.Duration(ms) * time.Millisecond, ms > 0
+}
+
+func (s *Subscription) drop() {
+	s.once.Do(func() { close(s.Done) })
+}
+
+var defaultBroker *Broker
+
+// Start launches the broker of this process. SSE_POLL_MS sets how often the
+// outbox is tailed (default 500; 0 disables the /events stream). Events
+// dispatched by this process wake it immediately. SSE_MAX_STREAMS_PER_USER
+// (default 5) and SSE_MAX_STREAMS_PER_IP (default 50) cap the streams and
+// polls open at once; 0 lifts a cap.
+func Start() {
+	pollMS := 500
+	if v, err := strconv.Atoi(os.Getenv("SSE_POLL_MS")); err == nil && v >= 0 {
+		pollMS = v
+	}
+	if pollMS == 0 {
+		return
+	}
+
+	b := &Broker{
+		DB:   database.DB,
+		Log:  logger.NewLogger("sse-broker"),
+		Poll: time.Duration(pollMS) * time.Millisecond,
+		subs: make(map[*Subscription]struct{}),
+		gaps: make(map[int64]time.Time),
+		wake: make(chan struct{}, 1),
+
+		MaxPerUser: envInt("SSE_MAX_STREAMS_PER_USER", 5),
+		MaxPerIP:   envInt("SSE_MAX_STREAMS_PER_IP", 50),
+		perUser:    make(map[int64]int),
+		perIP:      make(map[string]int),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var cursor int64
+	err := b.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(event_id), 0) FROM event_outbox`).Scan(&cursor)
+	cancel()
+	if err != nil {
+		b.Log.Error("Failed to read the outbox position, event streams are disabled", "error", err)
+		return
+	}
+	b.cursor.Store(cursor)
+	b.settled.Store(cursor)
+
+	outbox.RegisterPublisher("sse", func(ctx context.Context, e outbox.Event) error {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	defaultBroker = b
+	go b.run()
+}
+
+// Default returns the broker started by Start, or nil when streams are
+// disabled
+func Default() *Broker {
+	return defaultBroker
+}
+
+// Subscribe registers a stream of a user connected from ip. It fails with a
+// *LimitError when either already has as many streams as allowed, and with
+// ErrDraining once the process is draining. Call Unsubscribe when the
+// stream ends.
+func (b *Broker) Subscribe(userID int64, ip string) (*Subscription, error) {
+	s := &Subscription{
+		Events: make(chan outbox.Event, subscriberBuffer),
+		Done:   make(chan struct{}),
+		userID: userID,
+		ip:     ip,
+	}
+	s.Alive(time.Now())
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.draining.Load() {
+		b.refused.Add(1)
+		return nil, ErrDraining
+	}
+	if b.MaxPerUser > 0 && b.perUser[userID] >= b.MaxPerUser {
+		b.refused.Add(1)
+		return nil, &LimitError{Scope: "user", Limit: b.MaxPerUser}
+	}
+	if b.MaxPerIP > 0 && b.perIP[ip] >= b.MaxPerIP {
+		b.refused.Add(1)
+		return nil, &LimitError{Scope: "ip", Limit: b.MaxPerIP}
+	}
+	b.subs[s] = struct{}{}
+	b.perUser[userID]++
+	b.perIP[ip]++
+	return s, nil
+}
+
+// Settled returns the newest event ID up to which every event has been
+// handed to subscriptions. Cursors handed to clients that received nothing
+// use it, so an event committed late is not skipped.
+func (b *Broker) Settled() int64 {
+	return b.settled.Load()
+}
+
+// Stats describes the event streams of one process
+type Stats struct {
+	Enabled bool  `json:"enabled"`
+	Streams int   `json:"streams"`
+	Cursor  int64 `json:"cursor"`
+	Settled int64 `json:"settled"`
+	// Reaped counts the streams closed since startup because their client
+	// stopped reading
+	Reaped int64 `json:"reaped"`
+	// Refused counts the streams turned away for exceeding a cap
+	Refused int64 `json:"refused"`
+	// Queued counts the events handed to streams and not yet written to
+	// their clients; MaxQueued is the most any one stream is behind, out of
+	// the buffer it is closed at
+	Queued    int `json:"queued"`
+	MaxQueued int `json:"max_queued"`
+	Buffer    int `json:"buffer"`
+	// Draining is set once Drain closed the streams; new ones are refused
+	Draining bool `json:"draining"`
+}
+
+// Stats reports the streams connected to this process and how far it has
+// tailed the outbox
+func (b *Broker) Stats() Stats {
+	stats := Stats{Enabled: true, Draining: b.draining.Load(), Cursor: b.cursor.Load(), Settled: b.settled.Load(), Reaped: b.reaped.Load(), Refused: b.refused.Load(), Buffer: subscriberBuffer}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats.Streams = len(b.subs)
+	for s := range b.subs {
+		n := len(s.Events)
+		stats.Queued += n
+		stats.MaxQueued = max(stats.MaxQueued, n)
+	}
+	return stats
+}
+
+// Drain closes every stream of this process after telling its client to
+// reconnect within window, each after a random delay so they do not all
+// come back at once, and refuses new streams until Resume. It returns how
+// many streams it closed.
+func (b *Broker) Drain(window time.Duration) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.draining.Store(true)
+	n := len(b.subs)
+	for s := range b.subs {
+		delay := time.Second
+		if window > delay {
+			delay += rand.N(window - delay)
+		}
+		s.reconnect.Store(delay.Milliseconds())
+		delete(b.subs, s)
+		s.drop()
+	}
+	b.Log.Info("Drained event streams", "streams", n)
+	return n
+}
+
+// Resume accepts new streams again after Drain
+func (b *Broker) Resume() {
+	b.draining.Store(false)
+}
+
+// StreamsPerUser returns how many streams each connected user has open in
+// this process
+func (b *Broker) StreamsPerUser() map[int64]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	perUser := make(map[int64]int, len(b.perUser))
+	for id, n := range b.perUser {
+		perUser[id] = n
+	}
+	return perUser
+}
+
+// Unsubscribe removes a stream. A stream counts against its user's and
+// address's caps until it is unsubscribed, even once the broker dropped it.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, s)
+	if b.perUser[s.userID]--; b.perUser[s.userID] <= 0 {
+		delete(b.perUser, s.userID)
+	}
+	if b.perIP[s.ip]--; b.perIP[s.ip] <= 0 {
+		delete(b.perIP, s.ip)
+	}
+}
+
+// Since returns up to limit stored events after the given ID in the listed
+// channels that userID may see, oldest first, for resuming a stream
+func (b *Broker) Since(ctx context.Context, userID, afterID int64, channelIDs []int64, limit int) ([]outbox.Event, error) {
+	if len(channelIDs) == 0 {
+		return nil, nil
+	}
+	query := `SELECT event_id, channel_id, recipient_id, envelope FROM event_outbox
+		WHERE event_id > ? AND recipient_id IN (0, ?) AND channel_id IN (` +
+		strings.TrimSuffix(strings.Repeat("?,", len(channelIDs)), ",") + `) ORDER BY event_id LIMIT ?`
+	args := make([]interface{}, 0, len(channelIDs)+3)
+	args = append(args, afterID, userID)
+	for _, id := range channelIDs {
+		args = append(args, id)
+	}
+	args = append(args, limit)
+	return b.scan(ctx, query, args...)
+}
+
+func (b *Broker) run() {
+	ticker := time.NewTicker(b.Poll)
+	defer ticker.Stop()
+	reap := time.NewTicker(reapEvery)
+	defer reap.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.wake:
+		case now := <-reap.C:
+			b.reap(now)
+			continue
+		}
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			n, err := b.tail(ctx, time.Now())
+			cancel()
+			if err != nil {
+				b.Log.Error("Failed to tail the event outbox", "error", err)
+			}
+			if err != nil || n < tailBatch {
+				break
+			}
+		}
+	}
+}
+
+// tail reads the events after the cursor, and any that filled a recent gap,
+// and hands them to every subscription
+func (b *Broker) tail(ctx context.Context, now time.Time) (int, error) {
+	query := `SELECT event_id, channel_id, recipient_id, envelope FROM event_outbox WHERE event_id > ?`
+	cursor := b.cursor.Load()
+	args := []interface{}{cursor}
+	for id, seen := range b.gaps {
+		if now.Sub(seen) > gapWait {
+			delete(b.gaps, id)
+		}
+	}
+	if len(b.gaps) > 0 {
+		query += ` OR event_id IN (` + strings.TrimSuffix(strings.Repeat("?,", len(b.gaps)), ",") + `)`
+		for id := range b.gaps {
+			args = append(args, id)
+		}
+	}
+	query += ` ORDER BY event_id LIMIT ?`
+	args = append(args, tailBatch)
+
+	batch, err := b.scan(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	fresh := 0
+	for _, e := range batch {
+		if _, ok := b.gaps[e.ID]; ok {
+			delete(b.gaps, e.ID)
+		} else if e.ID > cursor {
+			fresh++
+			for id := max(cursor+1, e.ID-maxGaps); id < e.ID; id++ {
+				b.gaps[id] = now
+			}
+			cursor = e.ID
+		} else {
+			continue
+		}
+		b.fanout(e)
+	}
+	b.cursor.Store(cursor)
+	settled := cursor
+	for id := range b.gaps {
+		settled = min(settled, id-1)
+	}
+	b.settled.Store(settled)
+	return fresh, nil
+}
+
+func (b *Broker) fanout(e outbox.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		select {
+		case s.Events <- e:
+		default:
+			delete(b.subs, s)
+			s.drop()
+		}
+	}
+}
+
+// reap closes the streams that delivered nothing within StaleAfter. A TCP
+// connection can outlive its peer by minutes, and a stream stuck writing to
+// it would otherwise hold its subscription until then.
+func (b *Broker) reap(now time.Time) {
+	cutoff := now.Add(-StaleAfter).UnixNano()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if s.alive.Load() < cutoff {
+			delete(b.subs, s)
+			s.drop()
+			b.reaped.Add(1)
+			b.Log.Info("Reaped stale event stream", "idle_seconds", int64(now.Sub(time.Unix(0, s.alive.Load())).Seconds()))
+		}
+	}
+}
+
+func (b *Broker) scan(ctx context.Context, query string, args ...interface{}) ([]outbox.Event, error) {
+	rows, err := b.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var batch []outbox.Event
+	for rows.Next() {
+		var e outbox.Event
+		var envelope []byte
+		if err := rows.Scan(&e.ID, &e.ChannelID, &e.RecipientID, &envelope); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(envelope, &e.Envelope); err != nil {
+			b.Log.Warn("Skipping undecodable outbox event", "event_id", e.ID, "error", err)
+			continue
+		}
+		batch = append(batch, e)
+	}
+	return batch, rows.Err()
+}
+
+func envInt(name string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v >= 0 {
+		return v
+	}
+	return fallback
+}
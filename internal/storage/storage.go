@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("storage object not found")
+
+// Object is an open stored file
+type Object interface {
+	io.ReadSeekCloser
+	ModTime() time.Time
+	Size() int64
+}
+
+// Storage persists attachment bytes. Keys are opaque and never exposed to
+// clients; downloads go through the API so access checks always apply.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Open(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewKey returns a random storage key
+func NewKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var defaultStorage Storage
+
+// Default returns the storage configured from STORAGE_DIR (default
+// ./data/attachments)
+func Default() Storage {
+	if defaultStorage == nil {
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = filepath.Join("data", "attachments")
+		}
+		defaultStorage = &LocalStorage{Dir: dir}
+	}
+	return defaultStorage
+}
+
+// LocalStorage keeps objects on the local filesystem
+type LocalStorage struct {
+	Dir string
+}
+
+func (s *LocalStorage) path(key string) string {
+	// Fan out into subdirectories so no single directory grows unbounded
+	if len(key) < 4 {
+		return filepath.Join(s.Dir, key)
+	}
+	return filepath.Join(s.Dir, key[:2], key[2:4], key)
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary file first so a failed upload never leaves a
+	// partial object behind
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+type localObject struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (o *localObject) ModTime() time.Time { return o.info.ModTime() }
+func (o *localObject) Size() int64        { return o.info.Size() }
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (Object, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &localObject{File: f, info: info}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	fetchTimeout = 5 * time.Second
+	maxBodyBytes = 512 * 1024
+	maxRedirects = 3
+)
+
+var errBlockedAddress = errors.New("unfurl: destination address is not allowed")
+
+// Preview holds the OpenGraph metadata extracted from a page. When attached
+// to a message it also carries the team's link policy verdict; blocked links
+// have no metadata.
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	Policy      string `json:"policy,omitempty"`
+	Warning     string `json:"warning,omitempty"`
+}
+
+// newSafeClient returns an HTTP client that refuses to connect to loopback,
+// private, link-local and other internal addresses. The check runs on the
+// resolved IP at dial time, so redirects and DNS rebinding are covered too.
+func newSafeClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return errBlockedAddress
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   fetchTimeout,
+		ResponseHeaderTimeout: fetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   fetchTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("unfurl: too many redirects")
+			}
+			return validateURL(req.URL)
+		},
+	}
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+func validateURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unfurl: unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("unfurl: missing host")
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return fmt.Errorf("unfurl: port %s is not allowed", port)
+	}
+	return nil
+}
+
+// fetchPreview downloads the page at rawURL and parses its OpenGraph tags
+func fetchPreview(ctx context.Context, client *http.Client, rawURL string) (*Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "EavenBot/1.0 (+link preview)")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unfurl: unexpected status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "text/html") {
+		return nil, fmt.Errorf("unfurl: unsupported content type %q", ct)
+	}
+
+	preview := parseOpenGraph(io.LimitReader(resp.Body, maxBodyBytes))
+	preview.URL = rawURL
+	if preview.Title == "" && preview.Description == "" {
+		return nil, errors.New("unfurl: no preview metadata found")
+	}
+	return preview, nil
+}
+
+// parseOpenGraph reads og:* meta tags, falling back to <title> and the
+// description meta tag when the page does not declare OpenGraph data
+func parseOpenGraph(body io.Reader) *Preview {
+	preview := &Preview{}
+	var fallbackTitle, fallbackDescription string
+	inTitle := false
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if preview.Title == "" {
+				preview.Title = fallbackTitle
+			}
+			if preview.Description == "" {
+				preview.Description = fallbackDescription
+			}
+			return preview
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "title":
+				inTitle = true
+			case "meta":
+				var property, name, content string
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "property":
+						property = attr.Val
+					case "name":
+						name = attr.Val
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+				switch property {
+				case "og:title":
+					preview.Title = content
+				case "og:description":
+					preview.Description = content
+				case "og:image":
+					preview.ImageURL = content
+				case "og:site_name":
+					preview.SiteName = content
+				}
+				if name == "description" {
+					fallbackDescription = content
+				}
+			case "body":
+				// OpenGraph tags live in <head>; stop once the body starts
+				if preview.Title == "" {
+					preview.Title = fallbackTitle
+				}
+				if preview.Description == "" {
+					preview.Description = fallbackDescription
+				}
+				return preview
+			}
+		case html.TextToken:
+			if inTitle && fallbackTitle == "" {
+				fallbackTitle = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package unfurl
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nikhil/eaven/internal/database.go"
+	"github.com/nikhil/eaven/internal/featureflags"
+	"github.com/nikhil/eaven/internal/linkpolicy"
+	"github.com/nikhil/eaven/internal/logger"
+)
+
+const (
+	maxURLsPerMessage = 3
+	queueSize         = 256
+	cacheTTL          = 24 * time.Hour
+	failureTTL        = 10 * time.Minute
+	// maxCacheEntries bounds the in-memory cache of previews
+	maxCacheEntries = 10000
+	// maxURLLength is the longest URL stored, the size of the url columns
+	maxURLLength = 2048
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// defaultWorker is set by Start; Enqueue is a no-op until then
+var defaultWorker *Worker
+
+type job struct {
+	messageID int64
+	content   string
+}
+
+type cacheEntry struct {
+	preview   *Preview
+	expiresAt time.Time
+}
+
+// Worker fetches link previews for new messages in the background
+type Worker struct {
+	DB     *sql.DB
+	Log    *logger.Logger
+	client *http.Client
+	jobs   chan job
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// Start launches the background unfurl workers. The number of goroutines is
+// read from UNFURL_WORKERS (default 2); setting it to 0 disables unfurling.
+func Start() {
+	workers := 2
+	if v, err := strconv.Atoi(os.Getenv("UNFURL_WORKERS")); err == nil && v >= 0 {
+		workers = v
+	}
+	if workers == 0 {
+		return
+	}
+
+	w := &Worker{
+		DB:     database.DB,
+		Log:    logger.NewLogger("unfurl-worker"),
+		client: newSafeClient(),
+		jobs:   make(chan job, queueSize),
+		cache:  make(map[string]cacheEntry),
+	}
+	for i := 0; i < workers; i++ {
+		go w.run()
+	}
+	defaultWorker = w
+}
+
+// Enqueue schedules link preview generation for a saved message. It never
+// blocks the caller; when the queue is full the message is skipped.
+func Enqueue(messageID int64, content string) {
+	if defaultWorker == nil || messageID == 0 || len(ExtractURLs(content)) == 0 {
+		return
+	}
+	select {
+	case defaultWorker.jobs <- job{messageID: messageID, content: content}:
+	default:
+		defaultWorker.Log.Warn("Unfurl queue full, skipping message", "message_id", messageID)
+	}
+}
+
+// ExtractURLs returns the distinct http(s) URLs in content, capped per message
+func ExtractURLs(content string) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, match := range urlPattern.FindAllString(content, -1) {
+		match = strings.TrimRight(match, ".,;:!?)]}")
+		if seen[match] || len(match) > maxURLLength {
+			continue
+		}
+		seen[match] = true
+		urls = append(urls, match)
+		if len(urls) == maxURLsPerMessage {
+			break
+		}
+	}
+	return urls
+}
+
+func (w *Worker) run() {
+	for j := range w.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*fetchTimeout)
+		w.process(ctx, j)
+		cancel()
+	}
+}
+
+func (w *Worker) process(ctx context.Context, j job) {
+	// Link policies are per team, so resolve the message's team first
+	var teamID int64
+	teamQuery := `SELECT c.team_id FROM messages m INNER JOIN channels c ON c.channel_id = m.channel_id WHERE m.message_id = ?`
+	if err := w.DB.QueryRowContext(ctx, teamQuery, j.messageID).Scan(&teamID); err != nil {
+		w.Log.Error("Failed to resolve message team", "error", err, "message_id", j.messageID)
+		return
+	}
+
+	// Without previews links are still checked against the link policy,
+	// just never fetched
+	fetch, err := featureflags.Enabled(ctx, teamID, featureflags.LinkPreviews)
+	if err != nil {
+		w.Log.Error("Failed to check the link previews flag", "error", err, "team_id", teamID)
+	}
+
+	for _, rawURL := range ExtractURLs(j.content) {
+		decision, err := linkpolicy.Evaluate(ctx, w.DB, teamID, rawURL)
+		if err != nil {
+			w.Log.Error("Failed to evaluate link policy", "error", err, "url", rawURL)
+			decision = linkpolicy.Decision{Verdict: linkpolicy.Warn, Warning: "This link could not be checked against your team's link policy."}
+		}
+
+		// Blocked links are recorded so clients can flag them, but never fetched
+		if fetch && decision.Verdict != linkpolicy.Block {
+			if _, err := w.lookup(ctx, rawURL); err != nil {
+				w.Log.Debug("Failed to unfurl link", "url", rawURL, "error", err)
+			}
+		}
+
+		query := `INSERT IGNORE INTO message_link_previews (message_id, url_hash, url, policy, warning) VALUES (?, ?, ?, ?, ?)`
+		if _, err := w.DB.ExecContext(ctx, query, j.messageID, urlHash(rawURL), rawURL, decision.Verdict, decision.Warning); err != nil {
+			w.Log.Error("Failed to attach link preview", "error", err, "message_id", j.messageID)
+		}
+	}
+}
+
+// lookup resolves a preview from the in-memory cache, then the stored
+// previews table, and only fetches the page when both are stale
+func (w *Worker) lookup(ctx context.Context, rawURL string) (*Preview, error) {
+	now := time.Now()
+
+	w.mu.Lock()
+	entry, ok := w.cache[rawURL]
+	w.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.preview, nil
+	}
+
+	var p Preview
+	var fetchedAt int64
+	query := `SELECT url, title, description, image_url, site_name, fetched_at FROM link_previews WHERE url_hash = ?`
+	err := w.DB.QueryRowContext(ctx, query, urlHash(rawURL)).Scan(&p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &fetchedAt)
+	if err == nil && now.Sub(time.Unix(fetchedAt, 0)) < cacheTTL {
+		w.remember(rawURL, &p, cacheTTL)
+		return &p, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	preview, err := fetchPreview(ctx, w.client, rawURL)
+	if err != nil {
+		// Remember failures briefly so a popular broken link isn't refetched
+		// for every message that contains it
+		w.remember(rawURL, nil, failureTTL)
+		return nil, err
+	}
+
+	// Pages choose their own metadata, so it is cut to the column sizes
+	preview.Title = clip(preview.Title, 512)
+	preview.Description = clipBytes(preview.Description, 65535)
+	preview.SiteName = clip(preview.SiteName, 255)
+	if len(preview.ImageURL) > maxURLLength {
+		preview.ImageURL = ""
+	}
+	upsert := `
+		INSERT INTO link_previews (url_hash, url, title, description, image_url, site_name, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE title = VALUES(title), description = VALUES(description),
+			image_url = VALUES(image_url), site_name = VALUES(site_name), fetched_at = VALUES(fetched_at)
+	`
+	if _, err := w.DB.ExecContext(ctx, upsert, urlHash(rawURL), rawURL, preview.Title, preview.Description, preview.ImageURL, preview.SiteName, now.Unix()); err != nil {
+		return nil, err
+	}
+
+	w.remember(rawURL, preview, cacheTTL)
+	return preview, nil
+}
+
+// remember caches a preview. A full cache first drops its expired entries,
+// then arbitrary ones, so it stays within maxCacheEntries.
+func (w *Worker) remember(rawURL string, preview *Preview, ttl time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	if _, ok := w.cache[rawURL]; !ok && len(w.cache) >= maxCacheEntries {
+		for key, entry := range w.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(w.cache, key)
+			}
+		}
+		for key := range w.cache {
+			if len(w.cache) < maxCacheEntries {
+				break
+			}
+			delete(w.cache, key)
+		}
+	}
+	w.cache[rawURL] = cacheEntry{preview: preview, expiresAt: now.Add(ttl)}
+}
+
+// urlHash is the key URLs are stored under
+func urlHash(rawURL string) []byte {
+	sum := sha256.Sum256([]byte(rawURL))
+	return sum[:]
+}
+
+// clip cuts s to at most n characters
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// clipBytes cuts s to at most n bytes without splitting a character
+func clipBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// GetPreviews loads the links and stored previews for the given messages,
+// keyed by message ID. Links without a preview, including blocked ones, are
+// returned with only their URL and policy verdict.
+func GetPreviews(ctx context.Context, db *sql.DB, messageIDs []int64) (map[int64][]Preview, error) {
+	previews := make(map[int64][]Preview)
+	if len(messageIDs) == 0 {
+		return previews, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(messageIDs)), ",")
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+
+	query := `
+		SELECT mlp.message_id, mlp.url, COALESCE(lp.title, ''), COALESCE(lp.description, ''),
+			COALESCE(lp.image_url, ''), COALESCE(lp.site_name, ''), mlp.policy, mlp.warning
+		FROM message_link_previews mlp
+		LEFT JOIN link_previews lp ON lp.url_hash = mlp.url_hash AND mlp.policy <> 'block'
+		WHERE mlp.message_id IN (` + placeholders + `)
+	`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var p Preview
+		if err := rows.Scan(&messageID, &p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.Policy, &p.Warning); err != nil {
+			return nil, err
+		}
+		previews[messageID] = append(previews[messageID], p)
+	}
+	return previews, rows.Err()
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag builds a weak entity tag from the values a response is derived from,
+// such as IDs and updated_at timestamps. Equal values give equal tags.
+func ETag(parts ...interface{}) string {
+	h := sha256.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%v|", part)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// NotModified sets the validators of a response and reports whether the
+// client's copy is current, in which case it has answered 304 and the caller
+// must not write a body. lastModified is a Unix time, or 0 when the response
+// has no single modification time. If-None-Match takes precedence over
+// If-Modified-Since, as in RFC 9110.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified int64) bool {
+	w.Header().Set("ETag", etag)
+	if lastModified > 0 {
+		w.Header().Set("Last-Modified", time.Unix(lastModified, 0).UTC().Format(http.TimeFormat))
+	}
+	// Responses depend on who is asking, so shared caches must not keep them
+	// and browsers must revalidate before reuse
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Add("Vary", "Authorization")
+
+	match := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		match = etagMatches(inm, etag)
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && lastModified > 0 {
+		if t, err := http.ParseTime(ims); err == nil {
+			match = lastModified <= t.Unix()
+		}
+	}
+	if match {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return match
+}
+
+// etagMatches compares an If-None-Match header with a tag using the weak
+// comparison
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FieldSelection is the set of JSON fields a client asked to receive
+type FieldSelection map[string]bool
+
+// ParseFieldSelection reads ?fields=a,b,c or ?compact=true from the request.
+// compact=true selects compactFields. It returns nil when the client wants
+// the full payload.
+func ParseFieldSelection(r *http.Request, compactFields []string) FieldSelection {
+	query := r.URL.Query()
+
+	var names []string
+	if raw := query.Get("fields"); raw != "" {
+		names = strings.Split(raw, ",")
+	} else if query.Get("compact") == "true" {
+		names = compactFields
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	selection := make(FieldSelection, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			selection[name] = true
+		}
+	}
+	return selection
+}
+
+// Apply trims each element of items down to the selected fields. items must
+// marshal to a JSON array of objects. A nil selection returns items unchanged.
+func (fs FieldSelection) Apply(items interface{}) (interface{}, error) {
+	if fs == nil {
+		return items, nil
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+
+	trimmed := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		kept := make(map[string]interface{}, len(fs))
+		for key, value := range row {
+			if fs[key] {
+				kept[key] = value
+			}
+		}
+		trimmed = append(trimmed, kept)
+	}
+	return trimmed, nil
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxSlugLength matches the width of channels.slug
+const maxSlugLength = 100
+
+// Slugify turns a name into a lowercase slug of letters, digits and single
+// dashes, so "Q3 Planning & Ops" becomes "q3-planning-ops". Names with no
+// letters or digits give "".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = b.Len() > 0
+			continue
+		}
+		n := len(string(r))
+		if dash {
+			n++
+		}
+		if b.Len()+n > maxSlugLength {
+			break
+		}
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,194 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhil/eaven/internal/database.go"
+)
+
+// DefaultID is the workspace every account and team belonged to before
+// workspaces existed, and the one requests without a tenant resolve to
+const DefaultID int64 = 1
+
+// Header names the workspace of a request by its slug
+const Header = "X-Workspace"
+
+// ErrUnknown is returned for slugs no workspace has
+var ErrUnknown = errors.New("unknown workspace")
+
+// ErrSlugTaken is returned when creating a workspace with a slug in use
+var ErrSlugTaken = errors.New("slug is already in use")
+
+// ErrInvalidSlug is returned when creating a workspace with an unusable slug
+var ErrInvalidSlug = errors.New("slug must be 2 to 63 lowercase letters, digits or dashes")
+
+// Workspace is an isolated organization with its own accounts and teams
+type Workspace struct {
+	ID        int64  `json:"workspace_id"`
+	Slug      string `json:"slug"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type contextKey struct{}
+
+// WithID returns a context for requests in a workspace
+func WithID(ctx context.Context, id int64) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the workspace of a request, or DefaultID
+func FromContext(ctx context.Context) int64 {
+	if id, ok := ctx.Value(contextKey{}).(int64); ok {
+		return id
+	}
+	return DefaultID
+}
+
+// FromHost extracts the slug from a host under WORKSPACE_BASE_DOMAIN, so
+// acme.chat.example.com names the acme workspace when the base domain is
+// chat.example.com. Hosts outside the base domain, or the base domain
+// itself, name none.
+func FromHost(host string) string {
+	base := strings.ToLower(os.Getenv("WORKSPACE_BASE_DOMAIN"))
+	if base == "" {
+		return ""
+	}
+	host = strings.ToLower(host)
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	sub, ok := strings.CutSuffix(host, "."+base)
+	if !ok || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// slugsTTL bounds how long a new workspace may be unknown to other
+// processes
+const slugsTTL = 30 * time.Second
+
+// slugs caches every workspace ID by slug. There are few workspaces, so the
+// whole table fits in memory.
+var slugs struct {
+	sync.Mutex
+	loadedAt time.Time
+	ids      map[string]int64
+}
+
+// Resolve returns the ID of the workspace with a slug, or ErrUnknown
+func Resolve(ctx context.Context, slug string) (int64, error) {
+	slugs.Lock()
+	defer slugs.Unlock()
+
+	if slugs.ids == nil || time.Since(slugs.loadedAt) > slugsTTL {
+		ids, err := loadSlugs(ctx)
+		if err != nil {
+			return 0, err
+		}
+		slugs.ids = ids
+		slugs.loadedAt = time.Now()
+	}
+	id, ok := slugs.ids[strings.ToLower(slug)]
+	if !ok {
+		return 0, ErrUnknown
+	}
+	return id, nil
+}
+
+func loadSlugs(ctx context.Context) (map[string]int64, error) {
+	rows, err := database.DB.QueryContext(ctx, `SELECT workspace_id, slug FROM workspaces`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var slug string
+		if err := rows.Scan(&id, &slug); err != nil {
+			return nil, err
+		}
+		ids[slug] = id
+	}
+	return ids, rows.Err()
+}
+
+// members caches the workspace of each user seen. Accounts never move
+// between workspaces, so entries never go stale.
+var members sync.Map
+
+// OfUser returns the workspace a user belongs to
+func OfUser(ctx context.Context, userID int64) (int64, error) {
+	if id, ok := members.Load(userID); ok {
+		return id.(int64), nil
+	}
+	var id int64
+	err := database.DB.QueryRowContext(ctx, `SELECT workspace_id FROM users WHERE user_id = ?`, userID).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	members.Store(userID, id)
+	return id, nil
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,61}[a-z0-9]$`)
+
+// Create adds a workspace
+func Create(ctx context.Context, db *sql.DB, slug, name string) (Workspace, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if !slugPattern.MatchString(slug) {
+		return Workspace{}, ErrInvalidSlug
+	}
+	w := Workspace{Slug: slug, Name: strings.TrimSpace(name), CreatedAt: time.Now().UTC().Unix()}
+	if w.Name == "" {
+		w.Name = slug
+	}
+	var taken bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM workspaces WHERE slug = ?)`, slug).Scan(&taken); err != nil {
+		return Workspace{}, err
+	}
+	if taken {
+		return Workspace{}, ErrSlugTaken
+	}
+	result, err := db.ExecContext(ctx, `INSERT INTO workspaces (slug, name, created_at) VALUES (?, ?, ?)`, w.Slug, w.Name, w.CreatedAt)
+	if err != nil {
+		return Workspace{}, err
+	}
+	if w.ID, err = result.LastInsertId(); err != nil {
+		return Workspace{}, err
+	}
+
+	slugs.Lock()
+	slugs.ids = nil
+	slugs.Unlock()
+	return w, nil
+}
+
+// List returns every workspace, oldest first
+func List(ctx context.Context, db *sql.DB) ([]Workspace, error) {
+	rows, err := db.QueryContext(ctx, `SELECT workspace_id, slug, name, created_at FROM workspaces ORDER BY workspace_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Workspace{}
+	for rows.Next() {
+		var w Workspace
+		if err := rows.Scan(&w.ID, &w.Slug, &w.Name, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, w)
+	}
+	return list, rows.Err()
+}
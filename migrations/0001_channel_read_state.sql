@@ -0,0 +1,6 @@
+-- Track the last message each member has read so unread and mention
+-- counts can be computed per channel.
+ALTER TABLE channel_members
+    ADD COLUMN last_read_message_id BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_messages_channel_message ON messages (channel_id, message_id);
@@ -0,0 +1,20 @@
+-- OpenGraph previews fetched by the unfurl worker, shared across messages
+-- that link to the same URL. URLs are keyed by their SHA-256, since a prefix
+-- index would make URLs sharing their first 255 characters collide.
+CREATE TABLE link_previews (
+    url_hash    BINARY(32)    NOT NULL,
+    url         VARCHAR(2048) NOT NULL,
+    title       VARCHAR(512)  NOT NULL DEFAULT '',
+    description TEXT          NOT NULL,
+    image_url   VARCHAR(2048) NOT NULL DEFAULT '',
+    site_name   VARCHAR(255)  NOT NULL DEFAULT '',
+    fetched_at  BIGINT        NOT NULL,
+    PRIMARY KEY (url_hash)
+);
+
+CREATE TABLE message_link_previews (
+    message_id BIGINT        NOT NULL,
+    url_hash   BINARY(32)    NOT NULL,
+    url        VARCHAR(2048) NOT NULL,
+    PRIMARY KEY (message_id, url_hash)
+);
@@ -0,0 +1,5 @@
+-- Archived channels stay in the table so delta sync can report them.
+ALTER TABLE channels
+    ADD COLUMN archived_at BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_channels_team_updated ON channels (team_id, updated_at);
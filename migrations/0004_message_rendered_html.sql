@@ -0,0 +1,3 @@
+-- Sanitized HTML rendering stored next to the raw markdown content.
+ALTER TABLE messages
+    ADD COLUMN rendered_html TEXT NULL AFTER content;
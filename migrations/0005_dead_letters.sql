@@ -0,0 +1,17 @@
+-- Instance administrators can reach the /admin endpoints.
+ALTER TABLE users
+    ADD COLUMN is_admin TINYINT(1) NOT NULL DEFAULT 0;
+
+-- Deliveries that exhausted their retries, kept for inspection and replay.
+CREATE TABLE dead_letters (
+    dead_letter_id BIGINT       NOT NULL AUTO_INCREMENT,
+    kind           VARCHAR(64)  NOT NULL,
+    payload        JSON         NOT NULL,
+    last_error     TEXT         NOT NULL,
+    attempts       INT          NOT NULL DEFAULT 0,
+    created_at     BIGINT       NOT NULL,
+    replayed_at    BIGINT       NOT NULL DEFAULT 0,
+    replay_error   TEXT         NULL,
+    PRIMARY KEY (dead_letter_id),
+    INDEX idx_dead_letters_kind_created (kind, created_at)
+);
@@ -0,0 +1,11 @@
+-- Per-user digest email schedule. Users without a row get the defaults from
+-- internal/digest (weekly, Monday 09:00 UTC).
+CREATE TABLE digest_preferences (
+    user_id      BIGINT      NOT NULL,
+    cadence      VARCHAR(16) NOT NULL,
+    send_hour    TINYINT     NOT NULL,
+    send_weekday TINYINT     NOT NULL,
+    last_sent_at BIGINT      NOT NULL DEFAULT 0,
+    updated_at   BIGINT      NOT NULL,
+    PRIMARY KEY (user_id)
+);
@@ -0,0 +1,15 @@
+-- Files uploaded to channels. storage_key is internal and never returned to
+-- clients; downloads go through the authenticated API.
+CREATE TABLE attachments (
+    attachment_id BIGINT        NOT NULL AUTO_INCREMENT,
+    channel_id    BIGINT        NOT NULL,
+    uploader_id   BIGINT        NOT NULL,
+    file_name     VARCHAR(255)  NOT NULL,
+    content_type  VARCHAR(255)  NOT NULL,
+    size_bytes    BIGINT        NOT NULL,
+    storage_key   VARCHAR(64)   NOT NULL,
+    created_at    BIGINT        NOT NULL,
+    PRIMARY KEY (attachment_id),
+    UNIQUE KEY uq_attachments_storage_key (storage_key),
+    INDEX idx_attachments_channel (channel_id, created_at)
+);
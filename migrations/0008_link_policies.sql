@@ -0,0 +1,16 @@
+-- Per-team domain allowlist and blocklist applied when links are unfurled.
+-- Rules match the domain and all of its subdomains.
+CREATE TABLE team_link_policies (
+    team_id    BIGINT       NOT NULL,
+    domain     VARCHAR(253) NOT NULL,
+    action     VARCHAR(16)  NOT NULL,
+    created_by BIGINT       NOT NULL,
+    created_at BIGINT       NOT NULL,
+    PRIMARY KEY (team_id, domain)
+);
+
+-- Every link in a message is now recorded with its policy verdict, including
+-- links that were blocked or could not be previewed.
+ALTER TABLE message_link_previews
+    ADD COLUMN policy  VARCHAR(16)  NOT NULL DEFAULT 'allow',
+    ADD COLUMN warning VARCHAR(512) NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- Email addresses subscribed by an administrator to periodic summaries of a
+-- public channel. Subscribers do not need an account.
+CREATE TABLE channel_email_subscriptions (
+    subscription_id   BIGINT       NOT NULL AUTO_INCREMENT,
+    channel_id        BIGINT       NOT NULL,
+    email             VARCHAR(255) NOT NULL,
+    cadence           VARCHAR(16)  NOT NULL,
+    unsubscribe_token CHAR(64)     NOT NULL,
+    created_by        BIGINT       NOT NULL,
+    created_at        BIGINT       NOT NULL,
+    last_sent_at      BIGINT       NOT NULL,
+    PRIMARY KEY (subscription_id),
+    UNIQUE KEY uq_channel_email_subscriptions (channel_id, email),
+    UNIQUE KEY uq_channel_email_subscriptions_token (unsubscribe_token)
+);
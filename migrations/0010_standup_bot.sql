@@ -0,0 +1,40 @@
+-- Built-in bots are regular users that cannot log in.
+ALTER TABLE users
+    ADD COLUMN is_bot TINYINT(1) NOT NULL DEFAULT 0;
+
+-- A channel's standup schedule. weekdays is a bitmask with bit 0 for Sunday;
+-- send_hour is in UTC.
+CREATE TABLE standups (
+    standup_id      BIGINT       NOT NULL AUTO_INCREMENT,
+    channel_id      BIGINT       NOT NULL,
+    prompt          VARCHAR(1000) NOT NULL,
+    send_hour       TINYINT      NOT NULL,
+    weekdays        TINYINT      NOT NULL,
+    collect_minutes INT          NOT NULL,
+    created_by      BIGINT       NOT NULL,
+    created_at      BIGINT       NOT NULL,
+    last_run_at     BIGINT       NOT NULL DEFAULT 0,
+    PRIMARY KEY (standup_id),
+    UNIQUE KEY uq_standups_channel (channel_id)
+);
+
+-- One collection window per scheduled standup.
+CREATE TABLE standup_runs (
+    run_id     BIGINT NOT NULL AUTO_INCREMENT,
+    standup_id BIGINT NOT NULL,
+    channel_id BIGINT NOT NULL,
+    started_at BIGINT NOT NULL,
+    closes_at  BIGINT NOT NULL,
+    closed_at  BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (run_id),
+    INDEX idx_standup_runs_open (closed_at, closes_at),
+    INDEX idx_standup_runs_channel (channel_id, closed_at)
+);
+
+CREATE TABLE standup_replies (
+    run_id     BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    content    TEXT   NOT NULL,
+    created_at BIGINT NOT NULL,
+    PRIMARY KEY (run_id, user_id)
+);
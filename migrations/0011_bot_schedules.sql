@@ -0,0 +1,15 @@
+-- Reminders and recurring channel posts created with /remind and /recurring.
+-- One-off reminders are deleted once posted; recurring posts move next_run_at.
+CREATE TABLE bot_schedules (
+    schedule_id     BIGINT      NOT NULL AUTO_INCREMENT,
+    channel_id      BIGINT      NOT NULL,
+    user_id         BIGINT      NOT NULL,
+    kind            VARCHAR(16) NOT NULL,
+    repeat_interval VARCHAR(16) NOT NULL,
+    content         TEXT        NOT NULL,
+    next_run_at     BIGINT      NOT NULL,
+    created_at      BIGINT      NOT NULL,
+    PRIMARY KEY (schedule_id),
+    INDEX idx_bot_schedules_next_run (next_run_at),
+    INDEX idx_bot_schedules_user (user_id)
+);
@@ -0,0 +1,3 @@
+-- When the archival analyzer last suggested archiving an idle channel.
+ALTER TABLE channels
+    ADD COLUMN archive_suggested_at BIGINT NOT NULL DEFAULT 0;
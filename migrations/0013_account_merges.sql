@@ -0,0 +1,15 @@
+-- Accounts merged into another keep their row for the audit trail but can no
+-- longer log in; their tokens act as the target account.
+ALTER TABLE users
+    ADD COLUMN merged_into BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE account_merges (
+    merge_id       BIGINT NOT NULL AUTO_INCREMENT,
+    source_user_id BIGINT NOT NULL,
+    target_user_id BIGINT NOT NULL,
+    performed_by   BIGINT NOT NULL,
+    summary        JSON   NOT NULL,
+    created_at     BIGINT NOT NULL,
+    PRIMARY KEY (merge_id),
+    INDEX idx_account_merges_target (target_user_id)
+);
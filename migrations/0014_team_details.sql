@@ -0,0 +1,6 @@
+-- Teams gain the description and update time their API already accepted
+ALTER TABLE teams
+    ADD COLUMN description VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN updated_at  BIGINT       NOT NULL DEFAULT 0;
+
+UPDATE teams SET updated_at = created_at;
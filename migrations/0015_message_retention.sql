@@ -0,0 +1,19 @@
+-- Per-channel activity rolled up by the retention janitor before it purges
+-- old messages. day_start is UTC midnight in Unix seconds. No content is kept.
+CREATE TABLE channel_daily_stats (
+    channel_id        BIGINT NOT NULL,
+    day_start         BIGINT NOT NULL,
+    message_count     BIGINT NOT NULL DEFAULT 0,
+    participant_count INT    NOT NULL DEFAULT 0,
+    PRIMARY KEY (channel_id, day_start)
+);
+
+CREATE TABLE channel_daily_participants (
+    channel_id    BIGINT NOT NULL,
+    day_start     BIGINT NOT NULL,
+    user_id       BIGINT NOT NULL,
+    message_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (channel_id, day_start, user_id)
+);
+
+CREATE INDEX idx_messages_created ON messages (message_created_at);
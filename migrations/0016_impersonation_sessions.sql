@@ -0,0 +1,16 @@
+-- Support staff impersonating a user to debug a reported issue. Every session
+-- is kept as the audit trail; request_count and last_used_at show what the
+-- token was used for.
+CREATE TABLE impersonation_sessions (
+    session_id    BIGINT       NOT NULL AUTO_INCREMENT,
+    admin_id      BIGINT       NOT NULL,
+    user_id       BIGINT       NOT NULL,
+    reason        VARCHAR(500) NOT NULL,
+    created_at    BIGINT       NOT NULL,
+    expires_at    BIGINT       NOT NULL,
+    ended_at      BIGINT       NOT NULL DEFAULT 0,
+    request_count INT          NOT NULL DEFAULT 0,
+    last_used_at  BIGINT       NOT NULL DEFAULT 0,
+    PRIMARY KEY (session_id),
+    INDEX idx_impersonation_sessions_user (user_id, created_at)
+);
@@ -0,0 +1,16 @@
+-- Events written in the same transaction as the change they describe and
+-- published afterwards by the outbox dispatcher, so a crash between the two
+-- delays an event instead of losing it.
+CREATE TABLE event_outbox (
+    event_id        BIGINT      NOT NULL AUTO_INCREMENT,
+    event_type      VARCHAR(64) NOT NULL,
+    channel_id      BIGINT      NOT NULL DEFAULT 0,
+    envelope        JSON        NOT NULL,
+    created_at      BIGINT      NOT NULL,
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at BIGINT      NOT NULL,
+    dispatched_at   BIGINT      NOT NULL DEFAULT 0,
+    last_error      TEXT        NULL,
+    PRIMARY KEY (event_id),
+    INDEX idx_event_outbox_pending (dispatched_at, next_attempt_at)
+);
@@ -0,0 +1,4 @@
+-- The message a message quotes, or 0. Quote-replies are separate from
+-- threads: the reply stays in the channel timeline.
+ALTER TABLE messages
+    ADD COLUMN reply_to_id BIGINT NOT NULL DEFAULT 0;
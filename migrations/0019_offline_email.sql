@@ -0,0 +1,15 @@
+-- When the user last made an authenticated request, updated at most once a
+-- minute. Users idle for longer than the offline threshold get their unread
+-- mentions by email.
+ALTER TABLE users
+    ADD COLUMN last_seen_at BIGINT NOT NULL DEFAULT 0;
+
+-- last_notified_message_id keeps a mention from being emailed twice.
+CREATE TABLE offline_email_preferences (
+    user_id                  BIGINT     NOT NULL,
+    enabled                  TINYINT(1) NOT NULL DEFAULT 1,
+    last_notified_message_id BIGINT     NOT NULL DEFAULT 0,
+    last_sent_at             BIGINT     NOT NULL DEFAULT 0,
+    updated_at               BIGINT     NOT NULL,
+    PRIMARY KEY (user_id)
+);
@@ -0,0 +1,17 @@
+-- Channel exports too large to stream in the request, generated in the
+-- background into storage. storage_key is internal and never returned.
+CREATE TABLE channel_exports (
+    export_id    BIGINT       NOT NULL AUTO_INCREMENT,
+    channel_id   BIGINT       NOT NULL,
+    requested_by BIGINT       NOT NULL,
+    format       VARCHAR(8)   NOT NULL,
+    status       VARCHAR(16)  NOT NULL,
+    storage_key  VARCHAR(64)  NOT NULL DEFAULT '',
+    size_bytes   BIGINT       NOT NULL DEFAULT 0,
+    message_count BIGINT       NOT NULL DEFAULT 0,
+    error        VARCHAR(500) NOT NULL DEFAULT '',
+    created_at   BIGINT       NOT NULL,
+    completed_at BIGINT       NOT NULL DEFAULT 0,
+    PRIMARY KEY (export_id),
+    INDEX idx_channel_exports_channel (channel_id, created_at)
+);
@@ -0,0 +1,17 @@
+-- Public links to a message, and optionally its quote-replies, created by
+-- channel admins. The link token is signed; the row is what revocation and
+-- view counting act on.
+CREATE TABLE message_share_links (
+    link_id         BIGINT     NOT NULL AUTO_INCREMENT,
+    channel_id      BIGINT     NOT NULL,
+    message_id      BIGINT     NOT NULL,
+    created_by      BIGINT     NOT NULL,
+    include_replies TINYINT(1) NOT NULL DEFAULT 0,
+    created_at      BIGINT     NOT NULL,
+    expires_at      BIGINT     NOT NULL,
+    revoked_at      BIGINT     NOT NULL DEFAULT 0,
+    view_count      BIGINT     NOT NULL DEFAULT 0,
+    last_viewed_at  BIGINT     NOT NULL DEFAULT 0,
+    PRIMARY KEY (link_id),
+    INDEX idx_message_share_links_channel (channel_id, created_at)
+);
@@ -0,0 +1,29 @@
+-- Per-team moderation settings. action decides what happens to a message a
+-- classifier flags; words extends the server-wide word list.
+CREATE TABLE team_moderation_policies (
+    team_id           BIGINT      NOT NULL,
+    action            VARCHAR(16) NOT NULL DEFAULT 'off',
+    words             JSON        NOT NULL,
+    use_default_words TINYINT(1)  NOT NULL DEFAULT 1,
+    updated_by        BIGINT      NOT NULL,
+    updated_at        BIGINT      NOT NULL,
+    PRIMARY KEY (team_id)
+);
+
+-- Messages held for admin review under a team's review action. The message
+-- stays visible until an admin removes it.
+CREATE TABLE moderation_queue (
+    item_id     BIGINT      NOT NULL AUTO_INCREMENT,
+    message_id  BIGINT      NOT NULL,
+    channel_id  BIGINT      NOT NULL,
+    team_id     BIGINT      NOT NULL,
+    user_id     BIGINT      NOT NULL,
+    content     TEXT        NOT NULL,
+    reasons     JSON        NOT NULL,
+    status      VARCHAR(16) NOT NULL DEFAULT 'pending',
+    created_at  BIGINT      NOT NULL,
+    resolved_by BIGINT      NOT NULL DEFAULT 0,
+    resolved_at BIGINT      NOT NULL DEFAULT 0,
+    PRIMARY KEY (item_id),
+    INDEX idx_moderation_queue_status (status, created_at)
+);
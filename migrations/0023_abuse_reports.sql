@@ -0,0 +1,24 @@
+-- Reports filed by users against a message or another member of their team.
+-- content keeps what was reported, so a report stays reviewable after the
+-- message is edited or removed.
+CREATE TABLE abuse_reports (
+    report_id        BIGINT        NOT NULL AUTO_INCREMENT,
+    kind             VARCHAR(16)   NOT NULL,
+    team_id          BIGINT        NOT NULL,
+    channel_id       BIGINT        NOT NULL DEFAULT 0,
+    message_id       BIGINT        NOT NULL DEFAULT 0,
+    reported_user_id BIGINT        NOT NULL,
+    reporter_id      BIGINT        NOT NULL,
+    reason           VARCHAR(32)   NOT NULL,
+    details          VARCHAR(1000) NOT NULL DEFAULT '',
+    content          TEXT          NOT NULL,
+    status           VARCHAR(16)   NOT NULL DEFAULT 'open',
+    resolution       VARCHAR(32)   NOT NULL DEFAULT '',
+    created_at       BIGINT        NOT NULL,
+    resolved_by      BIGINT        NOT NULL DEFAULT 0,
+    resolved_at      BIGINT        NOT NULL DEFAULT 0,
+    PRIMARY KEY (report_id),
+    INDEX idx_abuse_reports_status (status, created_at),
+    INDEX idx_abuse_reports_message (message_id),
+    INDEX idx_abuse_reports_reporter (reporter_id, reported_user_id)
+);
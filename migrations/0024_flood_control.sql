@@ -0,0 +1,18 @@
+-- Events addressed to a single member of a channel, such as flood control
+-- notices. 0 keeps the existing behaviour of reaching every member.
+ALTER TABLE event_outbox
+    ADD COLUMN recipient_id BIGINT NOT NULL DEFAULT 0 AFTER channel_id;
+
+-- Flood control counts a sender's recent messages in a channel
+CREATE INDEX idx_messages_channel_user_created ON messages (channel_id, user_id, message_created_at);
+
+-- Users muted in a channel for posting too fast. strikes grows with each mute
+-- inside the reset window and lengthens the next one.
+CREATE TABLE channel_flood_mutes (
+    channel_id     BIGINT NOT NULL,
+    user_id        BIGINT NOT NULL,
+    strikes        INT    NOT NULL DEFAULT 0,
+    muted_until    BIGINT NOT NULL DEFAULT 0,
+    last_strike_at BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (channel_id, user_id)
+);
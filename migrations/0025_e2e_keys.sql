@@ -0,0 +1,16 @@
+-- Public keys published by each of a user's devices for end-to-end
+-- encryption. Private keys never reach the server.
+CREATE TABLE device_keys (
+    user_id    BIGINT       NOT NULL,
+    device_id  VARCHAR(64)  NOT NULL,
+    algorithm  VARCHAR(32)  NOT NULL,
+    public_key VARCHAR(2048) NOT NULL,
+    created_at BIGINT       NOT NULL,
+    PRIMARY KEY (user_id, device_id)
+);
+
+-- Encrypted messages keep an empty content and carry an opaque payload the
+-- server stores and relays without reading it
+ALTER TABLE messages
+    ADD COLUMN content_type VARCHAR(16) NOT NULL DEFAULT 'text',
+    ADD COLUMN encrypted_payload MEDIUMTEXT NULL;
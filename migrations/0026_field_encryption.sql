@@ -0,0 +1,8 @@
+-- Encrypted values are stored as enc:<key id>:<base64 nonce and ciphertext>,
+-- which is longer than the plaintext, so sensitive columns are widened to
+-- hold the largest value their plaintext limits allow
+ALTER TABLE users
+    MODIFY COLUMN contact_number VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE attachments
+    MODIFY COLUMN file_name VARCHAR(1536) NOT NULL;
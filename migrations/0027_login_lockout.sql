@@ -0,0 +1,11 @@
+-- Failed login attempts per account (lowercased email) and per client
+-- address. locked_until is set once failures reach the limit and grows with
+-- each further failure inside the reset window.
+CREATE TABLE login_failures (
+    scope           VARCHAR(16)  NOT NULL,
+    subject         VARCHAR(255) NOT NULL,
+    failures        INT          NOT NULL DEFAULT 0,
+    locked_until    BIGINT       NOT NULL DEFAULT 0,
+    last_failure_at BIGINT       NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, subject)
+);
@@ -0,0 +1,4 @@
+-- Login tokens carry the account's token version. Changing the password bumps
+-- it, which signs out every other session of the account.
+ALTER TABLE users
+    ADD COLUMN token_version BIGINT NOT NULL DEFAULT 0;
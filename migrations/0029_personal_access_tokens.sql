@@ -0,0 +1,18 @@
+-- Personal access tokens for scripts and integrations. Only a SHA-256 hash
+-- of each token is stored; hint keeps its last characters so users can tell
+-- tokens apart. scopes is a comma-separated list.
+CREATE TABLE personal_access_tokens (
+    token_id     BIGINT       NOT NULL AUTO_INCREMENT,
+    user_id      BIGINT       NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    scopes       VARCHAR(64)  NOT NULL,
+    token_hash   CHAR(64)     NOT NULL,
+    hint         VARCHAR(8)   NOT NULL,
+    created_at   BIGINT       NOT NULL,
+    expires_at   BIGINT       NOT NULL,
+    last_used_at BIGINT       NOT NULL DEFAULT 0,
+    revoked_at   BIGINT       NOT NULL DEFAULT 0,
+    PRIMARY KEY (token_id),
+    UNIQUE KEY uq_personal_access_tokens_hash (token_hash),
+    INDEX idx_personal_access_tokens_user (user_id, created_at)
+);
@@ -0,0 +1,6 @@
+-- Profile edits bump updated_at, which the profile endpoint uses for
+-- conditional requests
+ALTER TABLE users
+    ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0;
+
+UPDATE users SET updated_at = created_at;
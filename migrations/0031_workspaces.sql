@@ -0,0 +1,25 @@
+-- Workspaces isolate organizations hosted on one deployment. Accounts and
+-- teams belong to exactly one; everything that existed before joins the
+-- default workspace, which requests naming no workspace resolve to.
+CREATE TABLE workspaces (
+    workspace_id BIGINT       NOT NULL AUTO_INCREMENT,
+    slug         VARCHAR(63)  NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    created_at   BIGINT       NOT NULL,
+    PRIMARY KEY (workspace_id),
+    UNIQUE KEY uq_workspaces_slug (slug)
+);
+
+INSERT INTO workspaces (workspace_id, slug, name, created_at)
+VALUES (1, 'default', 'Default', UNIX_TIMESTAMP());
+
+-- Emails are unique per workspace: uq_users_workspace_email lets the same
+-- address sign up in several workspaces, and serves the login and signup
+-- lookups by workspace and email.
+ALTER TABLE users
+    ADD COLUMN workspace_id BIGINT NOT NULL DEFAULT 1,
+    ADD UNIQUE KEY uq_users_workspace_email (workspace_id, email);
+
+ALTER TABLE teams
+    ADD COLUMN workspace_id BIGINT NOT NULL DEFAULT 1,
+    ADD INDEX idx_teams_workspace (workspace_id);
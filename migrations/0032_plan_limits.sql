@@ -0,0 +1,11 @@
+-- Plan limits set on a workspace or team. NULL columns inherit from the
+-- workspace, then from the deployment defaults; 0 means unlimited.
+CREATE TABLE plan_limits (
+    scope                ENUM('workspace', 'team') NOT NULL,
+    subject_id           BIGINT NOT NULL,
+    max_team_members     INT    NULL,
+    message_history_days INT    NULL,
+    storage_bytes        BIGINT NULL,
+    updated_at           BIGINT NOT NULL,
+    PRIMARY KEY (scope, subject_id)
+);
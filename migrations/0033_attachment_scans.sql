@@ -0,0 +1,9 @@
+-- Virus scan state of attachments. Files uploaded before scanning existed,
+-- or while it is disabled, stay 'unscanned' and remain downloadable.
+-- scan_claimed_at lets one worker scan each pending file.
+ALTER TABLE attachments
+    ADD COLUMN scan_status     VARCHAR(16)  NOT NULL DEFAULT 'unscanned',
+    ADD COLUMN scan_signature  VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN scanned_at      BIGINT       NOT NULL DEFAULT 0,
+    ADD COLUMN scan_claimed_at BIGINT       NOT NULL DEFAULT 0,
+    ADD INDEX idx_attachments_scan (scan_status, attachment_id);
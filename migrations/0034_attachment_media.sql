@@ -0,0 +1,17 @@
+-- Attachments sent with a message, and the media metadata and thumbnails
+-- extracted from images and videos in the background. message_id is 0 until
+-- the file is sent.
+ALTER TABLE attachments
+    ADD COLUMN message_id        BIGINT      NOT NULL DEFAULT 0,
+    ADD COLUMN media_status      VARCHAR(16) NOT NULL DEFAULT 'none',
+    ADD COLUMN media_width       INT         NOT NULL DEFAULT 0,
+    ADD COLUMN media_height      INT         NOT NULL DEFAULT 0,
+    ADD COLUMN media_duration_ms BIGINT      NOT NULL DEFAULT 0,
+    ADD COLUMN thumbnail_key     VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN media_claimed_at  BIGINT      NOT NULL DEFAULT 0,
+    ADD INDEX idx_attachments_message (message_id),
+    ADD INDEX idx_attachments_media (media_status, attachment_id);
+
+-- Images and videos uploaded earlier are processed too
+UPDATE attachments SET media_status = 'pending'
+WHERE content_type LIKE 'image/%' OR content_type LIKE 'video/%';
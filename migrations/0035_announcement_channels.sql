@@ -0,0 +1,12 @@
+-- Announcement channels only accept posts from their admins and from members
+-- granted posting in channel_post_grants
+ALTER TABLE channels
+    ADD COLUMN announcement_only TINYINT(1) NOT NULL DEFAULT 0;
+
+CREATE TABLE channel_post_grants (
+    channel_id BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    granted_by BIGINT NOT NULL,
+    granted_at BIGINT NOT NULL,
+    PRIMARY KEY (channel_id, user_id)
+);
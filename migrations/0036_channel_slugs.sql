@@ -0,0 +1,23 @@
+-- URL-safe channel slugs: the lowercased name with runs of other characters
+-- turned into dashes, unique within a team
+ALTER TABLE channels
+    ADD COLUMN slug VARCHAR(100) NOT NULL DEFAULT '';
+
+UPDATE channels
+SET slug = TRIM(BOTH '-' FROM LOWER(REGEXP_REPLACE(channel_name, '[^[:alnum:]]+', '-')));
+
+UPDATE channels SET slug = CONCAT('channel-', channel_id) WHERE slug = '';
+
+-- Existing channels whose names differ only in case or punctuation keep the
+-- plain slug on the oldest one and get their ID appended otherwise
+UPDATE channels c
+INNER JOIN (
+    SELECT team_id, slug, MIN(channel_id) AS first_id
+    FROM channels
+    GROUP BY team_id, slug
+    HAVING COUNT(*) > 1
+) d ON d.team_id = c.team_id AND d.slug = c.slug
+SET c.slug = CONCAT(c.slug, '-', c.channel_id)
+WHERE c.channel_id <> d.first_id;
+
+CREATE UNIQUE INDEX idx_channels_team_slug ON channels (team_id, slug);
@@ -0,0 +1,33 @@
+-- @handles name users in mentions and member search, unique per workspace.
+-- Existing accounts get one from their email address, with the user ID
+-- appended where two addresses would give the same handle.
+ALTER TABLE users
+    ADD COLUMN handle VARCHAR(32) NOT NULL DEFAULT '';
+
+UPDATE users
+SET handle = LEFT(TRIM(BOTH '.' FROM REGEXP_REPLACE(LOWER(SUBSTRING_INDEX(email, '@', 1)), '[^a-z0-9_.]+', '')), 20);
+
+UPDATE users SET handle = CONCAT('user', user_id) WHERE CHAR_LENGTH(handle) < 2;
+
+UPDATE users u
+INNER JOIN (
+    SELECT workspace_id, handle, MIN(user_id) AS first_id
+    FROM users
+    GROUP BY workspace_id, handle
+    HAVING COUNT(*) > 1
+) d ON d.workspace_id = u.workspace_id AND d.handle = u.handle
+SET u.handle = CONCAT(u.handle, u.user_id)
+WHERE u.user_id <> d.first_id;
+
+CREATE UNIQUE INDEX uq_users_workspace_handle ON users (workspace_id, handle);
+
+-- A changed handle keeps pointing at its user until expires_at, and nobody
+-- else can take it before then
+CREATE TABLE handle_redirects (
+    workspace_id BIGINT      NOT NULL,
+    handle       VARCHAR(32) NOT NULL,
+    user_id      BIGINT      NOT NULL,
+    expires_at   BIGINT      NOT NULL,
+    PRIMARY KEY (workspace_id, handle),
+    INDEX idx_handle_redirects_user (user_id, expires_at)
+);
@@ -0,0 +1,9 @@
+-- Client settings synced across a user's devices. value is the JSON the
+-- client sent; known keys are validated before they are stored.
+CREATE TABLE user_preferences (
+    user_id    BIGINT      NOT NULL,
+    pref_key   VARCHAR(64) NOT NULL,
+    value      TEXT        NOT NULL,
+    updated_at BIGINT      NOT NULL,
+    PRIMARY KEY (user_id, pref_key)
+);
@@ -0,0 +1,5 @@
+-- How much a channel notifies its member: all messages, only mentions, or
+-- nothing (muted). Unread and mention counters, digests and offline mention
+-- emails honor it.
+ALTER TABLE channel_members
+    ADD COLUMN notify_level VARCHAR(16) NOT NULL DEFAULT 'all';
@@ -0,0 +1,4 @@
+-- Message search matches words through a FULLTEXT index. Words shorter than
+-- innodb_ft_min_token_size are matched with LIKE instead.
+ALTER TABLE messages
+    ADD FULLTEXT INDEX ft_messages_content (content);
@@ -0,0 +1,5 @@
+-- Messages older than MESSAGE_ARCHIVE_AFTER_MONTHS are moved here by the
+-- history mover, keeping the hot table small. The archive mirrors messages
+-- column for column, so every later change to messages must be made to
+-- messages_archive too.
+CREATE TABLE messages_archive LIKE messages;
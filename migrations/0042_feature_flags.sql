@@ -0,0 +1,9 @@
+-- Feature flag settings changed at runtime. team_id 0 is the setting for
+-- every team without one of its own; flags without a row use their default.
+CREATE TABLE feature_flags (
+    flag       VARCHAR(64) NOT NULL,
+    team_id    BIGINT      NOT NULL DEFAULT 0,
+    enabled    TINYINT(1)  NOT NULL,
+    updated_at BIGINT      NOT NULL,
+    PRIMARY KEY (flag, team_id)
+);
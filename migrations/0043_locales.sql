@@ -0,0 +1,3 @@
+-- The language of a team's system messages; empty follows DEFAULT_LOCALE
+ALTER TABLE teams
+    ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,18 @@
+-- Sidebar sections a team groups its channels into. Channels with
+-- section_id 0 are in no section; section_position orders the channels of
+-- a section.
+CREATE TABLE channel_sections (
+    section_id BIGINT      NOT NULL AUTO_INCREMENT,
+    team_id    BIGINT      NOT NULL,
+    name       VARCHAR(80) NOT NULL,
+    position   INT         NOT NULL,
+    created_by BIGINT      NOT NULL,
+    created_at BIGINT      NOT NULL,
+    PRIMARY KEY (section_id),
+    UNIQUE KEY uq_channel_sections_name (team_id, name)
+);
+
+ALTER TABLE channels
+    ADD COLUMN section_id       BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN section_position INT    NOT NULL DEFAULT 0,
+    ADD INDEX idx_channels_section (section_id);
@@ -0,0 +1,7 @@
+-- A member's own sidebar layout: starred channels and a manual order
+-- (sort_order 0 is unordered, after the ordered ones). layout_updated_at
+-- lets channel deltas pick up layout changes on other devices.
+ALTER TABLE channel_members
+    ADD COLUMN starred           TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN sort_order        INT        NOT NULL DEFAULT 0,
+    ADD COLUMN layout_updated_at BIGINT     NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+-- Channels shared with a second team. The channel's own team invites the
+-- other team (pending) and an owner of that team accepts (active). Members
+-- of an active share's team can join, post and stream as if the channel were
+-- theirs.
+CREATE TABLE channel_shares (
+    channel_id  BIGINT      NOT NULL,
+    team_id     BIGINT      NOT NULL,
+    status      VARCHAR(16) NOT NULL,
+    invited_by  BIGINT      NOT NULL,
+    invited_at  BIGINT      NOT NULL,
+    accepted_by BIGINT      NOT NULL DEFAULT 0,
+    accepted_at BIGINT      NOT NULL DEFAULT 0,
+    PRIMARY KEY (channel_id, team_id),
+    INDEX idx_channel_shares_team (team_id, status)
+);
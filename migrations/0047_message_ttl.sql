@@ -0,0 +1,5 @@
+-- Disappearing messages: when message_ttl_seconds is set, a channel's
+-- messages are deleted that many seconds after they were posted.
+ALTER TABLE channels
+    ADD COLUMN message_ttl_seconds INT NOT NULL DEFAULT 0,
+    ADD INDEX idx_channels_message_ttl (message_ttl_seconds);
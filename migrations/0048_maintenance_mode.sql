@@ -0,0 +1,9 @@
+-- Maintenance mode: while the row exists, every API process rejects writes
+-- with 503 until an admin turns it off
+CREATE TABLE maintenance_mode (
+    id TINYINT NOT NULL PRIMARY KEY,
+    message VARCHAR(500) NOT NULL DEFAULT '',
+    retry_after_seconds INT NOT NULL,
+    started_by BIGINT NOT NULL,
+    started_at BIGINT NOT NULL
+);
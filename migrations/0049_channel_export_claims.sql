@@ -0,0 +1,7 @@
+-- Background exports are generated by the workers, which claim pending jobs
+-- so each runs once. A claim older than the job timeout belongs to a process
+-- that died, and the job is retried until it runs out of attempts.
+ALTER TABLE channel_exports
+    ADD COLUMN claimed_at BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN attempts   INT    NOT NULL DEFAULT 0,
+    ADD INDEX idx_channel_exports_status (status, claimed_at);
@@ -1,12 +1,181 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms. A hash records its algorithm and parameters,
+// so hashes made under older settings keep verifying and can be upgraded
+// when the user next logs in.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// HashConfig selects how new password hashes are made
+type HashConfig struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2id parameters: memory in KiB, passes and parallelism
+	ArgonMemory  uint32
+	ArgonTime    uint32
+	ArgonThreads uint8
+}
+
+const (
+	argonSaltLen = 16
+	argonKeyLen  = 32
+)
+
+var (
+	hashConfigOnce sync.Once
+	hashConfig     HashConfig
+)
+
+// PasswordHashConfig reads the settings from the environment:
+// PASSWORD_HASH (bcrypt, the default, or argon2id), BCRYPT_COST (default 10,
+// within 4 to 31), ARGON2_MEMORY_KIB (default 65536), ARGON2_TIME (default 3)
+// and ARGON2_THREADS (default 2)
+func PasswordHashConfig() HashConfig {
+	hashConfigOnce.Do(func() {
+		hashConfig = HashConfig{
+			Algorithm:    strings.ToLower(os.Getenv("PASSWORD_HASH")),
+			BcryptCost:   min(max(envInt("BCRYPT_COST", bcrypt.DefaultCost), bcrypt.MinCost), bcrypt.MaxCost),
+			ArgonMemory:  uint32(envInt("ARGON2_MEMORY_KIB", 64*1024)),
+			ArgonTime:    uint32(envInt("ARGON2_TIME", 3)),
+			ArgonThreads: uint8(min(envInt("ARGON2_THREADS", 2), 255)),
+		}
+		if hashConfig.Algorithm == "" {
+			hashConfig.Algorithm = HashBcrypt
+		}
+	})
+	return hashConfig
+}
+
+// Validate reports a config that cannot hash passwords, so a misspelt
+// PASSWORD_HASH fails at startup rather than on the first signup
+func (cfg HashConfig) Validate() error {
+	switch cfg.Algorithm {
+	case HashBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("BCRYPT_COST %d is outside %d to %d", cfg.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		// Argon2 needs at least 8 KiB of memory for each lane
+		if cfg.ArgonTime == 0 || cfg.ArgonThreads == 0 || cfg.ArgonMemory < 8*uint32(cfg.ArgonThreads) {
+			return fmt.Errorf("invalid argon2id parameters m=%d,t=%d,p=%d", cfg.ArgonMemory, cfg.ArgonTime, cfg.ArgonThreads)
+		}
+	default:
+		return fmt.Errorf("unknown PASSWORD_HASH %q (want %s or %s)", cfg.Algorithm, HashBcrypt, HashArgon2id)
+	}
+	return nil
+}
+
+func envInt(name string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+// HashPassword hashes a password with the configured algorithm
 func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashed), err
+	return HashPasswordWith(PasswordHashConfig(), password)
 }
 
+// HashPasswordWith hashes a password with an explicit config, which must be
+// valid: argon2 panics on parameters it cannot use
+func HashPasswordWith(cfg HashConfig, password string) (string, error) {
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	if cfg.Algorithm == HashBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+		return string(hashed), err
+	}
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, cfg.ArgonTime, cfg.ArgonMemory, cfg.ArgonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, cfg.ArgonMemory, cfg.ArgonTime, cfg.ArgonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword verifies a password against a hash of either algorithm,
+// returning bcrypt.ErrMismatchedHashAndPassword when it does not match
 func CheckPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if !strings.HasPrefix(hashedPassword, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	}
+	params, salt, key, err := parseArgon2id(hashedPassword)
+	if err != nil {
+		return err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.ArgonTime, params.ArgonMemory, params.ArgonThreads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return bcrypt.ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+// NeedsRehash reports whether a hash was made with another algorithm or
+// parameters than the configured ones. Call it after CheckPassword
+// succeeds, while the password is at hand, to upgrade the stored hash.
+func NeedsRehash(hashedPassword string) bool {
+	return NeedsRehashWith(PasswordHashConfig(), hashedPassword)
+}
+
+// NeedsRehashWith checks a hash against an explicit config
+func NeedsRehashWith(cfg HashConfig, hashedPassword string) bool {
+	switch cfg.Algorithm {
+	case HashBcrypt:
+		cost, err := bcrypt.Cost([]byte(hashedPassword))
+		return err != nil || cost != cfg.BcryptCost
+	case HashArgon2id:
+		params, _, key, err := parseArgon2id(hashedPassword)
+		return err != nil || len(key) != argonKeyLen || params.ArgonMemory != cfg.ArgonMemory ||
+			params.ArgonTime != cfg.ArgonTime || params.ArgonThreads != cfg.ArgonThreads
+	default:
+		return false
+	}
+}
+
+// parseArgon2id reads a hash in the PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func parseArgon2id(hashedPassword string) (HashConfig, []byte, []byte, error) {
+	parts := strings.Split(hashedPassword, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return HashConfig{}, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return HashConfig{}, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	cfg := HashConfig{Algorithm: HashArgon2id}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &cfg.ArgonMemory, &cfg.ArgonTime, &cfg.ArgonThreads); err != nil {
+		return HashConfig{}, nil, nil, fmt.Errorf("malformed argon2id parameters: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return HashConfig{}, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return HashConfig{}, nil, nil, fmt.Errorf("malformed argon2id salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return HashConfig{}, nil, nil, fmt.Errorf("malformed argon2id key")
+	}
+	return cfg, salt, key, nil
 }
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Small parameters keep the tests fast; the format does not depend on them
+var (
+	testBcrypt = HashConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost}
+	testArgon  = HashConfig{Algorithm: HashArgon2id, ArgonMemory: 64, ArgonTime: 1, ArgonThreads: 1}
+)
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	hashed, err := HashPasswordWith(testArgon, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hashed, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %q", hashed)
+	}
+
+	params, salt, key, err := parseArgon2id(hashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params != testArgon {
+		t.Errorf("parsed params %+v, want %+v", params, testArgon)
+	}
+	if len(salt) != argonSaltLen || len(key) != argonKeyLen {
+		t.Errorf("salt %d and key %d bytes, want %d and %d", len(salt), len(key), argonSaltLen, argonKeyLen)
+	}
+
+	if err := CheckPassword(hashed, "correct horse"); err != nil {
+		t.Errorf("correct password: %v", err)
+	}
+	if err := CheckPassword(hashed, "wrong horse"); !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		t.Errorf("wrong password: got %v, want a mismatch", err)
+	}
+
+	again, err := HashPasswordWith(testArgon, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hashed {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestBcryptRoundTrip(t *testing.T) {
+	hashed, err := HashPasswordWith(testBcrypt, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPassword(hashed, "correct horse"); err != nil {
+		t.Errorf("correct password: %v", err)
+	}
+	if err := CheckPassword(hashed, "wrong horse"); !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		t.Errorf("wrong password: got %v, want a mismatch", err)
+	}
+}
+
+func TestParseArgon2idMalformed(t *testing.T) {
+	valid, err := HashPasswordWith(testArgon, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(valid, "$")
+	with := func(i int, v string) string {
+		p := append([]string(nil), parts...)
+		p[i] = v
+		return strings.Join(p, "$")
+	}
+
+	for name, hashed := range map[string]string{
+		"too few fields":  strings.Join(parts[:5], "$"),
+		"other algorithm": with(1, "argon2i"),
+		"old version":     with(2, "v=16"),
+		"bad parameters":  with(3, "m=64,t=x,p=1"),
+		"zero threads":    with(3, "m=64,t=1,p=0"),
+		"bad salt":        with(4, "!!"),
+		"bad key":         with(5, "!!"),
+		"empty key":       with(5, ""),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, _, err := parseArgon2id(hashed); err == nil {
+				t.Errorf("parsed %q", hashed)
+			}
+			if err := CheckPassword(hashed, "correct horse"); err == nil {
+				t.Errorf("verified %q", hashed)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := HashPasswordWith(testBcrypt, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := HashPasswordWith(testArgon, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moreMemory, morePasses, moreThreads := testArgon, testArgon, testArgon
+	moreMemory.ArgonMemory *= 2
+	morePasses.ArgonTime++
+	moreThreads.ArgonThreads++
+	higherCost := testBcrypt
+	higherCost.BcryptCost++
+
+	for _, tc := range []struct {
+		name   string
+		cfg    HashConfig
+		hashed string
+		want   bool
+	}{
+		{"bcrypt unchanged", testBcrypt, bcryptHash, false},
+		{"bcrypt cost raised", higherCost, bcryptHash, true},
+		{"bcrypt to argon2id", testArgon, bcryptHash, true},
+		{"argon2id unchanged", testArgon, argonHash, false},
+		{"argon2id memory raised", moreMemory, argonHash, true},
+		{"argon2id passes raised", morePasses, argonHash, true},
+		{"argon2id threads raised", moreThreads, argonHash, true},
+		{"argon2id to bcrypt", testBcrypt, argonHash, true},
+		{"unreadable hash", testArgon, "not a hash", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NeedsRehashWith(tc.cfg, tc.hashed); got != tc.want {
+				t.Errorf("NeedsRehashWith = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHashConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  HashConfig
+		ok   bool
+	}{
+		{"bcrypt", testBcrypt, true},
+		{"argon2id", testArgon, true},
+		{"misspelt algorithm", HashConfig{Algorithm: "argon2", BcryptCost: bcrypt.DefaultCost}, false},
+		{"bcrypt cost too high", HashConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MaxCost + 1}, false},
+		{"argon2id without threads", HashConfig{Algorithm: HashArgon2id, ArgonMemory: 64, ArgonTime: 1}, false},
+		{"argon2id memory below 8 KiB a lane", HashConfig{Algorithm: HashArgon2id, ArgonMemory: 8, ArgonTime: 1, ArgonThreads: 2}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+				t.Errorf("Validate() = %v, want ok %v", err, tc.ok)
+			}
+			if _, err := HashPasswordWith(tc.cfg, "correct horse"); (err == nil) != tc.ok {
+				t.Errorf("HashPasswordWith error = %v, want ok %v", err, tc.ok)
+			}
+		})
+	}
+}